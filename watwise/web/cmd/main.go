@@ -2,25 +2,39 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"wattwise/internal/config"
 	"wattwise/internal/database"
+	"wattwise/internal/docs"
 	"wattwise/internal/handlers"
+	"wattwise/internal/logger"
+	"wattwise/internal/middleware"
+	"wattwise/internal/models"
 	"wattwise/internal/mqtt"
+	"wattwise/internal/repositories"
 	"wattwise/internal/routes"
 	"wattwise/internal/services"
+	"wattwise/internal/utils"
 
 	mqttLib "github.com/eclipse/paho.mqtt.golang"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
+	fiberlogger "github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 )
 
 // getWSLIP returns the WSL IP address for display purposes
@@ -62,41 +76,174 @@ func getWSLIP() string {
 	return "localhost"
 }
 
+// printConfig prints the effective config (secrets masked) and the validation
+// result for --check-config, returning the exit code
+func printConfig(cfg *config.Config, configErr error) int {
+	raw, err := json.MarshalIndent(cfg.Masked(), "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to print configuration: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(raw))
+
+	if configErr != nil {
+		fmt.Fprintf(os.Stderr, "❌ Invalid configuration:\n%v\n", configErr)
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "✅ Configuration is valid")
+	return 0
+}
+
+// runMigrate creates the IoTDB schema (--migrate) and returns the exit code
+func runMigrate(db *database.IoTDB) int {
+	if err := db.Connect(); err != nil {
+		log.Printf("❌ IoTDB connection failed: %v", err)
+		return 1
+	}
+	defer db.Close()
+
+	report, err := db.Migrate(context.Background())
+	if err != nil {
+		log.Printf("❌ Migration failed: %v", err)
+		return 1
+	}
+	if len(report.LegacyMoved) > 0 {
+		log.Printf("   ✓ moved %d single-device series to %s", len(report.LegacyMoved), models.DefaultDeviceID)
+	}
+	for _, device := range report.Devices {
+		log.Printf("   ✓ %s: %d created, %d failed", device.DeviceID, len(device.Created), len(device.Failed))
+	}
+	if !report.OK {
+		log.Println("❌ Migration incomplete, see the errors above")
+		return 1
+	}
+	log.Println("✅ Schema is up to date")
+	return 0
+}
+
 func main() {
+	checkConfig := flag.Bool("check-config", false, "load and validate the configuration, print it with secrets masked, then exit")
+	migrate := flag.Bool("migrate", false, "create the IoTDB storage groups and missing timeseries, then exit")
+	flag.Parse()
+
+	// ===== LOAD CONFIGURATION =====
+	cfg := config.Load()
+	configErr := cfg.Validate()
+	if *checkConfig {
+		os.Exit(printConfig(cfg, configErr))
+	}
+	if configErr != nil {
+		log.Fatalf("❌ Invalid configuration:\n%v", configErr)
+	}
+	utils.SetJWTSecret([]byte(cfg.JWT.Secret))
+	utils.SetTokenTTL(time.Duration(cfg.JWT.AccessTTLMinutes)*time.Minute, time.Duration(cfg.JWT.RefreshTTLHours)*time.Hour)
+
 	// ===== SETUP LOGGING =====
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	// Semua log (termasuk package log) lewat slog dengan LOG_LEVEL
+	appLogger := logger.New(cfg.Log)
+	slog.SetDefault(appLogger)
+
 	log.Println("╔═══════════════════════════════════════╗")
 	log.Println("║     🚀 Wattwise Energy Monitor      ║")
 	log.Println("║        v1.0 - IoTDB Enabled         ║")
 	log.Println("╚═══════════════════════════════════════╝")
 
 	// ===== LOAD CONFIGURATION =====
-	log.Println("\n📋 Loading configuration...")
-	cfg := config.Load()
+	log.Println("\n📋 Configuration loaded")
+	log.Printf("   ✓ Log Level: %s", cfg.Log.Level)
 	log.Printf("   ✓ Server Port: %s", cfg.Server.Port)
-	log.Printf("   ✓ IoTDB: %s:%s", cfg.IoTDB.Host, cfg.IoTDB.Port)
+	log.Printf("   ✓ IoTDB: %s:%s (%s)", cfg.IoTDB.Host, cfg.IoTDB.Port, cfg.IoTDB.RootPath)
 	log.Printf("   ✓ MQTT Broker: %s", cfg.MQTT.Broker)
 	log.Printf("   ✓ MQTT Username: %s", cfg.MQTT.Username) // ✅ TAMBAHKAN LOG INI
-	log.Printf("   ✓ MQTT Password: %s", cfg.MQTT.Password) // ✅ TAMBAHKAN LOG INI
 
 	// ===== SETUP IOTDB CONNECTION =====
 	log.Println("\n🗄️  Initializing IoTDB...")
-	db := database.NewIoTDB(cfg.IoTDB)
+	db := database.NewIoTDB(cfg.IoTDB, appLogger)
 
-	if err := db.Connect(); err != nil {
-		log.Printf("⚠️  IoTDB connection failed: %v", err)
-		log.Println("   ℹ️  Running in DUMMY MODE - data won't be persisted")
+	if *migrate {
+		os.Exit(runMigrate(db))
+	}
+
+	// Services dan handler membaca lewat database.Store; job maintenance,
+	// admin dan migrate tetap memakai IoTDB langsung
+	var store database.Store = db
+	var storeHealth handlers.IoTDBHealth = db
+	if cfg.IoTDB.Driver == database.DriverMemory {
+		memory := database.NewMemoryStore()
+		store, storeHealth = memory, memory
+		log.Println("   ℹ️  DB_DRIVER=memory - readings kept in memory only, lost on restart")
 	} else {
-		log.Println("✅ IoTDB connected successfully")
-		if db.IsEnabled() {
-			log.Println("   ✓ Schema initialization completed")
+		if err := db.Connect(); err != nil {
+			log.Printf("⚠️  IoTDB connection failed: %v", err)
+			if cfg.IoTDB.DummyMode == "off" {
+				log.Println("   ℹ️  DUMMY_MODE=off - queries answer 503 until reconnected (retrying in background)")
+			} else {
+				log.Println("   ℹ️  Running in DUMMY MODE - retrying in background with backoff")
+			}
+			db.StartReconnect()
+		} else {
+			log.Println("✅ IoTDB connected successfully")
+			if db.IsEnabled() {
+				log.Println("   ✓ Schema verified (create missing timeseries with --migrate)")
+			}
 		}
 	}
 
 	// ===== SETUP SERVICES =====
 	log.Println("\n🔧 Initializing services...")
-	energyService := services.NewEnergyService(db)
+	tariffService := services.NewTariffService(cfg.Tariff.PerKWh)
+	tariffService.SetCurrency(cfg.Tariff.CurrencyCode, cfg.Tariff.CurrencySymbol, cfg.Tariff.CurrencyDecimals)
+	energyService := services.NewEnergyService(store, tariffService, appLogger)
+	energyService.SetStandbyWindow(cfg.Standby.StartHour, cfg.Standby.EndHour, cfg.Standby.MinSamples)
+	energyService.SetDemandWindow(cfg.Demand.WindowMinutes, cfg.Location())
+	energyService.SetSeverityBands(cfg.Severity.WarningPercent, cfg.Severity.CriticalPercent, time.Duration(cfg.Severity.EscalateMinutes)*time.Minute)
+	energyService.SetAnomalyScan(cfg.Anomaly.Window, cfg.Anomaly.ZScore)
+	energyService.SetGapDetection(time.Duration(cfg.MQTT.ReportIntervalSeconds)*time.Second, cfg.Gap.Tolerance)
+	// Tarif, batas alert dan log level diatur SettingsManager (bisa berubah
+	// lewat SIGHUP atau PUT /api/admin/settings)
+	settingsRepo, err := repositories.NewSettingsRepository(filepath.Join(cfg.Server.DataDir, "settings.json"))
+	if err != nil {
+		log.Fatalf("❌ Failed to load settings: %v", err)
+	}
+	settingsManager, err := services.NewSettingsManager(settingsRepo, cfg.RuntimeSettings(), config.ReloadRuntimeSettings, tariffService, energyService, appLogger)
+	if err != nil {
+		log.Fatalf("❌ Invalid settings in %s: %v", filepath.Join(cfg.Server.DataDir, "settings.json"), err)
+	}
+	watchSettingsSIGHUP(settingsManager)
+	energyService.SetResponseCache(services.NewResponseCache(time.Duration(cfg.Server.ResponseCacheTTLSeconds) * time.Second))
 	log.Println("   ✓ Energy Service initialized")
+	if cfg.Server.ResponseCacheTTLSeconds > 0 {
+		log.Printf("   ✓ Response cache enabled (TTL %ds)", cfg.Server.ResponseCacheTTLSeconds)
+	}
+	energyService.SetSummaryCache(services.NewSummaryCache(
+		time.Duration(cfg.Server.MonthlySummaryCacheTTLSeconds)*time.Second,
+		time.Duration(cfg.Server.MonthlySummaryCurrentTTLSeconds)*time.Second))
+	if cfg.Server.MonthlySummaryCacheTTLSeconds > 0 {
+		log.Printf("   ✓ Monthly summary cache enabled (TTL %ds, current month %ds)",
+			cfg.Server.MonthlySummaryCacheTTLSeconds, cfg.Server.MonthlySummaryCurrentTTLSeconds)
+	}
+	energyService.SetLatestCache(services.NewLatestCache(time.Duration(cfg.Server.LatestMaxAgeSeconds) * time.Second))
+	if cfg.Server.LatestMaxAgeSeconds > 0 {
+		log.Printf("   ✓ Latest reading cache enabled (max age %ds)", cfg.Server.LatestMaxAgeSeconds)
+	}
+
+	deviceRepo, err := repositories.NewDeviceRepository(filepath.Join(cfg.Server.DataDir, "devices.json"))
+	if err != nil {
+		log.Fatalf("❌ Failed to load device registry: %v", err)
+	}
+	deviceService := services.NewDeviceService(deviceRepo, appLogger)
+	log.Printf("   ✓ Device Service initialized (%d devices)", len(deviceService.List()))
+
+	retentionJob := services.NewRetentionJob(db, cfg.Server.RetentionDays, cfg.Server.RetentionHour, appLogger)
+	retentionJob.Start()
+
+	downsampleJob := services.NewDownsampleJob(db, cfg.IoTDB.DownsampleAfterDays, cfg.IoTDB.DownsampleIntervalMinutes, appLogger)
+	downsampleJob.Start()
+
+	// Rollup per jam untuk filter daily/weekly/monthly
+	rollupJob := services.NewRollupJob(db, cfg.IoTDB.RollupIntervalMinutes, appLogger)
+	energyService.SetRollups(rollupJob)
+	rollupJob.Start()
 
 	// ===== SETUP MQTT CONNECTION =====
 	log.Println("\n📡 Initializing MQTT...")
@@ -115,7 +262,7 @@ func main() {
 	// ✅ CRITICAL: Set credentials SEBELUM connection
 	mqttOpts.SetUsername(cfg.MQTT.Username)
 	mqttOpts.SetPassword(cfg.MQTT.Password)
-	log.Printf("   ✓ MQTT Auth: %s / %s", cfg.MQTT.Username, cfg.MQTT.Password)
+	log.Printf("   ✓ MQTT Auth: %s", cfg.MQTT.Username)
 	
 	mqttOpts.SetClientID(cfg.MQTT.ClientID)
 	mqttOpts.SetCleanSession(true)
@@ -124,13 +271,38 @@ func main() {
 	mqttOpts.SetConnectTimeout(10 * time.Second)
 	mqttOpts.SetMaxReconnectInterval(10 * time.Second)
 
+	// Last Will: broker menandai server offline kalau koneksi putus tanpa
+	// disconnect (crash, network)
+	serverStatusTopic := cfg.MQTT.ServerStatusTopic
+	if serverStatusTopic != "" {
+		mqtt.SetServerWill(mqttOpts, serverStatusTopic, cfg.MQTT.ClientID, byte(cfg.MQTT.QoS))
+		log.Printf("   ✓ MQTT Last Will: %s", serverStatusTopic)
+	}
+
+	// Subscriber dibuat setelah client, callback membaca lewat pointer atomic
+	var subscriberRef atomic.Pointer[mqtt.Subscriber]
+
 	// Connection callbacks
 	mqttOpts.OnConnect = func(client mqttLib.Client) {
 		log.Println("✅ MQTT: Connected to broker")
+		if subscriber := subscriberRef.Load(); subscriber != nil {
+			subscriber.HandleReconnect()
+		}
+		if serverStatusTopic != "" {
+			// Tidak menunggu PUBACK di dalam callback paho
+			go func() {
+				if err := mqtt.PublishServerStatus(client, serverStatusTopic, cfg.MQTT.ClientID, "online", byte(cfg.MQTT.QoS)); err != nil {
+					log.Printf("⚠️  MQTT: Failed to publish server status: %v", err)
+				}
+			}()
+		}
 	}
 
 	mqttOpts.OnConnectionLost = func(client mqttLib.Client, err error) {
 		log.Printf("⚠️  MQTT: Connection lost - %v", err)
+		if subscriber := subscriberRef.Load(); subscriber != nil {
+			subscriber.HandleConnectionLost(err)
+		}
 	}
 
 	mqttOpts.OnReconnecting = func(client mqttLib.Client, opts *mqttLib.ClientOptions) {
@@ -139,7 +311,6 @@ func main() {
 
 	// Create MQTT client
 	mqttClient := mqttLib.NewClient(mqttOpts)
-	mqttConnected := false
 
 	// Try to connect
 	log.Println("   ⏳ Connecting to MQTT broker...")
@@ -153,7 +324,6 @@ func main() {
 			log.Println("   ℹ️  CHECK: Network, firewall, broker status")
 		} else {
 			log.Println("✅ MQTT connected successfully")
-			mqttConnected = true
 		}
 	} else {
 		log.Println("❌ MQTT connection timeout after 10s")
@@ -162,18 +332,105 @@ func main() {
 
 	// ===== SETUP WEBSOCKET HANDLER =====
 	log.Println("\n🌐 Initializing WebSocket...")
-	wsHandler := handlers.NewWebSocketHandler(db)
+	wsHandler := handlers.NewWebSocketHandler(store, appLogger)
+	wsHandler.SetHistorySize(cfg.Server.WSHistorySize)
+	wsHandler.SetBroadcastBuffer(cfg.Server.WSBroadcastBuffer, cfg.Server.WSBroadcastPolicy)
+	wsHandler.SetFlushInterval(time.Duration(cfg.Server.WSFlushIntervalMs) * time.Millisecond)
+	wsHandler.SetLegacyFormat(cfg.Server.WSLegacyFormat)
+	settingsManager.SetBroadcaster(wsHandler.Events())
+	// Dashboard diberi tahu saat IoTDB putus atau tersambung lagi; cache
+	// dibuang supaya data dummy dan data asli tidak tercampur
+	db.OnModeChange(func(mode string) {
+		log.Printf("🔁 IoTDB mode: %s", mode)
+		energyService.ResponseCache().Flush()
+		energyService.SummaryCache().Flush()
+		wsHandler.Events().BroadcastSystemNotice(models.NewDataSourceNotice(mode, db.ServesDummyData()))
+	})
 	log.Println("   ✓ WebSocket handler initialized")
 
 	// ===== SETUP MQTT SUBSCRIBER =====
 	log.Println("\n📥 Initializing MQTT Subscriber...")
-	subscriber := mqtt.NewSubscriber(mqttClient, energyService)
-	subscriber.SetWebSocketBroadcaster(wsHandler)
+	subscriber := mqtt.NewSubscriber(mqttClient, energyService, deviceService, appLogger)
+	subscriber.SetBroadcaster(wsHandler.Events())
+	subscriber.SetTopics(cfg.MQTT.Topics, cfg.MQTT.QoS)
+
+	commandTracker := services.NewCommandTracker(time.Duration(cfg.MQTT.CommandAckTimeoutSeconds)*time.Second, appLogger)
+	commandTracker.Start()
+	subscriber.SetCommandTracker(commandTracker)
+	alertRepo, err := repositories.NewAlertRepository(filepath.Join(cfg.Server.DataDir, "alerts.json"), repositories.DefaultMaxAlerts)
+	if err != nil {
+		log.Fatalf("❌ Failed to load alert store: %v", err)
+	}
+	subscriber.SetAlertStore(alertRepo)
+
+	anomalyDetector := services.NewAnomalyDetector(store, deviceService, cfg.Anomaly.Sigma, cfg.Anomaly.WarmupDays, appLogger)
+	go anomalyDetector.Seed(time.Now()) // baseline 14 hari, jangan block startup
+	subscriber.SetAnomalyDetector(anomalyDetector)
+	subscriber.EnableDedup(time.Duration(cfg.MQTT.DedupWindowSeconds)*time.Second, cfg.MQTT.DedupCacheSize)
+	subscriber.EnableThrottle(time.Duration(cfg.MQTT.StoreIntervalSeconds) * time.Second)
+	subscriber.SetHeartbeat(time.Duration(cfg.MQTT.ReportIntervalSeconds)*time.Second, cfg.MQTT.OfflineMissedReports)
+	defaultDecoder, _ := mqtt.NewPayloadDecoder(cfg.MQTT.PayloadFormat) // sudah divalidasi di config
+	subscriber.SetPayloadDecoder(defaultDecoder)
+	for _, tf := range cfg.MQTT.PayloadFormats {
+		decoder, _ := mqtt.NewPayloadDecoder(tf.Format)
+		subscriber.RegisterPayloadDecoder(tf.Filter, decoder)
+		log.Printf("📦 MQTT payload format %s on %s", tf.Format, tf.Filter)
+	}
+	subscriberRef.Store(subscriber)
+	energyService.SetDeviceSources(deviceService, subscriber)
+
+	predictionService := services.NewPredictionService(store, deviceService, tariffService,
+		cfg.Prediction.LookbackDays, cfg.Prediction.IntervalMinutes, cfg.Prediction.Smoothing, appLogger)
+	predictionService.SetBroadcaster(wsHandler.Events())
+	predictionService.Start()
+
+	budgetRepo, err := repositories.NewBudgetRepository(filepath.Join(cfg.Server.DataDir, "budgets.json"))
+	if err != nil {
+		log.Fatalf("❌ Failed to load budgets: %v", err)
+	}
+	budgetService := services.NewBudgetService(budgetRepo, energyService, deviceService, cfg.Budget.CheckMinutes, appLogger)
+	budgetService.SetAlertSink(subscriber)
+	budgetService.Start()
+	log.Printf("   ✓ Budget Service initialized (%d budgets)", len(budgetService.List()))
+
+	auditRepo, err := repositories.NewAuditRepository(filepath.Join(cfg.Server.DataDir, "audit.jsonl"), cfg.Audit.MaxEvents)
+	if err != nil {
+		log.Fatalf("❌ Failed to load audit log: %v", err)
+	}
+	auditService := services.NewAuditService(auditRepo, cfg.Audit.RetentionDays, appLogger)
+	auditService.Start()
+
+	// Alert juga dikirim via email/webhook (SMTP_HOST, NOTIFY_WEBHOOK_URL)
+	notificationService := routes.NewNotificationService(cfg, filepath.Join(cfg.Server.DataDir, "notifications_dead.jsonl"), appLogger)
+	notificationService.Start()
+	subscriber.SetNotifier(notificationService)
+
+	userRepo, err := repositories.NewUserRepository(filepath.Join(cfg.Server.DataDir, "users.json"))
+	if err != nil {
+		log.Fatalf("❌ Failed to load users: %v", err)
+	}
+	userService := services.NewUserService(userRepo, appLogger)
+	log.Printf("   ✓ User Service initialized (%d accounts)", len(userService.List()))
+
+	// Key API (Grafana, script) disimpan sebagai hash SHA-256
+	apiKeyRepo, err := repositories.NewAPIKeyRepository(filepath.Join(cfg.Server.DataDir, "apikeys.json"))
+	if err != nil {
+		log.Fatalf("❌ Failed to load API keys: %v", err)
+	}
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, appLogger)
+	log.Printf("   ✓ API Key Service initialized (%d keys)", len(apiKeyService.List()))
+
+	// Rate limit dan lockout login (per IP dan username), janitor dihentikan saat shutdown
+	loginStore := middleware.NewMemoryLoginStore(time.Hour)
+
+	publisher := mqtt.NewPublisher(mqttClient)
+	log.Println("   ✓ Command publisher initialized")
 	log.Println("   ✓ Subscriber initialized")
 	log.Println("   ✓ WebSocket broadcaster connected")
 
-	// Subscribe to energy data jika MQTT connected
-	if mqttConnected {
+	// Subscribe to energy data jika MQTT connected. Kalau belum, OnConnect
+	// (HandleReconnect) subscribe begitu broker tersambung.
+	if mqttClient.IsConnected() {
 		log.Println("\n🔔 Subscribing to MQTT topics...")
 		if err := subscriber.SubscribeToEnergyData(); err != nil {
 			log.Printf("❌ Failed to subscribe to topics: %v", err)
@@ -181,24 +438,7 @@ func main() {
 			log.Println("✅ Successfully subscribed to energy topics")
 		}
 	} else {
-		log.Println("⚠️  Skipping MQTT subscription - broker not connected")
-		// Retry setelah connected
-		go func() {
-			retries := 0
-			for retries < 10 {
-				time.Sleep(5 * time.Second)
-				if mqttClient.IsConnected() {
-					log.Println("🔔 Retrying MQTT subscription after reconnection...")
-					if err := subscriber.SubscribeToEnergyData(); err != nil {
-						log.Printf("   ❌ Subscription attempt %d failed: %v", retries+1, err)
-						retries++
-					} else {
-						log.Println("   ✅ Subscription successful!")
-						break
-					}
-				}
-			}
-		}()
+		log.Println("⚠️  Skipping MQTT subscription - will subscribe once the broker connects")
 	}
 
 	// ===== SETUP FIBER APP =====
@@ -207,18 +447,25 @@ func main() {
 		AppName:       "Wattwise v1.0",
 		CaseSensitive: false,
 		Immutable:     true,
+		// Upload import + multipart overhead; body lain dibatasi BODY_LIMIT_MB
+		// oleh middleware.BodyLimit
+		BodyLimit: max(cfg.Server.ImportMaxMB+1, cfg.Server.BodyLimitMB) << 20,
 	})
 
 	// Middleware
 	app.Use(recover.New())
-	app.Use(logger.New(logger.Config{
-		Format: "[${time}] ${status} - ${method} ${path}\n",
+	app.Use(requestid.New())
+	app.Use(fiberlogger.New(fiberlogger.Config{
+		Format: "[${time}] ${status} - ${method} ${path} request_id=${locals:requestid}\n",
 	}))
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-API-Key, Last-Event-ID",
 		AllowMethods: "GET, POST, PUT, DELETE, OPTIONS",
 	}))
+	app.Use(middleware.BodyLimit(cfg.Server.BodyLimitMB<<20, "/api/energy/import"))
+	// gzip/brotli sesuai Accept-Encoding, lihat middleware.Compress
+	app.Use(middleware.Compress(cfg.Server.CompressLevel))
 
 	log.Println("   ✓ Middleware configured")
 
@@ -236,7 +483,7 @@ func main() {
 		log.Printf("   ✓ View path: %s", viewPath)
 	}
 
-	routes.SetupWithWebSocket(app, db, wsHandler)
+	routes.SetupWithWebSocket(app, cfg, db, store, energyService, deviceService, publisher, commandTracker, predictionService, budgetService, settingsManager, wsHandler, auditService, userService, apiKeyService, notificationService, alertRepo, loginStore)
 	log.Println("   ✓ API routes configured")
 
 	app.Static("/css", filepath.Join(viewPath, "css"))
@@ -248,51 +495,104 @@ func main() {
 		return c.Redirect("/view/login.html")
 	})
 
-	app.Get("/health", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{
-			"status":         "ok",
-			"service":        "Wattwise Energy Monitor",
-			"version":        "1.0.0",
-			"iotdb_enabled":  db.IsEnabled(),
-			"mqtt_connected": mqttClient.IsConnected(),
-			"ws_clients":     wsHandler.GetConnectedClients(),
-			"timestamp":      time.Now().Unix(),
-		})
-	})
-
-	log.Println("   ✓ Health check endpoint available at /health")
+	// /health/live: proses hidup, /health/ready: IoTDB + MQTT siap (503 kalau belum)
+	healthHandler := handlers.NewHealthHandler(storeHealth, subscriber, wsHandler)
+	healthHandler.SetStrict(cfg.Server.StrictHealth)
+	healthHandler.SetSchemaDevices(deviceService.IDs)
+	app.Get("/health/live", healthHandler.Live)
+	app.Get("/health/ready", healthHandler.Ready)
+	// Detail IoTDB latency, MQTT topics, backlog; 503 hanya kalau STRICT_HEALTH
+	app.Get("/health", healthHandler.Health)
+
+	log.Println("   ✓ Health check endpoints available at /health/live and /health/ready")
+
+	// openapi.json ditulis manual, ingatkan kalau ada route yang belum masuk
+	if missing, err := docs.Undocumented(app.GetRoutes(true)); err != nil {
+		log.Printf("⚠️  Failed to read openapi.json: %v", err)
+	} else if len(missing) > 0 {
+		log.Printf("⚠️  Routes missing from /api/openapi.json: %v", missing)
+	}
 
 	// ===== SETUP GRACEFUL SHUTDOWN =====
 	log.Println("\n🛡️  Setting up graceful shutdown...")
 
-	defer func() {
+	// Dipanggil setelah app.Shutdown, bukan lewat defer: log.Fatalf dan
+	// listener yang memblokir tidak pernah menjalankan defer di main
+	shutdown := func() {
 		log.Println("\n🛑 Shutting down gracefully...")
 
+		// Reading yang masih ditahan throttle disimpan dulu
+		subscriber.Stop()
+		subscriber.FlushThrottled()
+
 		if mqttClient.IsConnected() {
+			// Disconnect normal tidak memicu Last Will
+			if serverStatusTopic != "" {
+				if err := mqtt.PublishServerStatus(mqttClient, serverStatusTopic, cfg.MQTT.ClientID, "offline", byte(cfg.MQTT.QoS)); err != nil {
+					log.Printf("   ⚠️  Failed to publish offline status: %v", err)
+				}
+			}
 			log.Println("   ⏳ Disconnecting MQTT...")
 			mqttClient.Disconnect(250)
 			log.Println("   ✓ MQTT disconnected")
 		}
 
+		retentionJob.Stop()
+		downsampleJob.Stop()
+		rollupJob.Stop()
+		commandTracker.Stop()
+		predictionService.Stop()
+		budgetService.Stop()
+		auditService.Stop()
+		notificationService.Stop()
+		loginStore.Close()
+
 		log.Println("   ⏳ Closing IoTDB...")
 		db.Close()
 		log.Println("   ✓ IoTDB closed")
 
 		log.Println("✅ Graceful shutdown completed")
-	}()
+	}
+
+	// ===== SETUP TLS =====
+	// Tanpa cert/key (atau TLS_SELF_SIGNED) server tetap plain HTTP
+	var certs *certReloader
+	certFile, keyFile := cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile
+	if certFile == "" && keyFile == "" && cfg.Server.TLSSelfSigned {
+		var err error
+		certFile, keyFile, err = ensureSelfSigned(filepath.Join(cfg.Server.DataDir, "tls"))
+		if err != nil {
+			log.Fatalf("❌ Failed to create self-signed certificate: %v", err)
+		}
+		log.Printf("⚠️  Using self-signed certificate %s (development only)", certFile)
+	}
+	if certFile != "" || keyFile != "" {
+		var err error
+		certs, err = newCertReloader(certFile, keyFile)
+		if err != nil {
+			log.Fatalf("❌ Failed to load TLS certificate (check TLS_CERT_FILE / TLS_KEY_FILE): %v", err)
+		}
+		certs.watchSIGHUP()
+		log.Println("   ✓ TLS enabled (kill -HUP to reload the certificate)")
+	}
+
+	scheme, wsScheme := "http", "ws"
+	if certs != nil {
+		scheme, wsScheme = "https", "wss"
+	}
 
 	// ===== GET WSL IP FOR DISPLAY =====
 	wslIP := getWSLIP()
 
 	// ===== START SERVER =====
 	log.Println("\n" + "═════════════════════════════════════════════")
-	log.Printf("✅ Server starting: http://%s:%s", wslIP, cfg.Server.Port)
+	log.Printf("✅ Server starting: %s://%s:%s", scheme, wslIP, cfg.Server.Port)
 	log.Println("═════════════════════════════════════════════")
 
-	webUI := fmt.Sprintf("http://%s:%s/view/login.html", wslIP, cfg.Server.Port)
-	apiHealth := fmt.Sprintf("http://%s:%s/health", wslIP, cfg.Server.Port)
-	wsURL := fmt.Sprintf("ws://%s:%s/ws", wslIP, cfg.Server.Port)
-	apiDocs := fmt.Sprintf("http://%s:%s/api/", wslIP, cfg.Server.Port)
+	webUI := fmt.Sprintf("%s://%s:%s/view/login.html", scheme, wslIP, cfg.Server.Port)
+	apiHealth := fmt.Sprintf("%s://%s:%s/health", scheme, wslIP, cfg.Server.Port)
+	wsURL := fmt.Sprintf("%s://%s:%s/ws", wsScheme, wslIP, cfg.Server.Port)
+	apiDocs := fmt.Sprintf("%s://%s:%s/api/docs", scheme, wslIP, cfg.Server.Port)
 
 	log.Println("\n📝 Available endpoints:")
 	log.Printf("   • Web UI:     %s", webUI)
@@ -300,12 +600,12 @@ func main() {
 	log.Printf("   • WebSocket:  %s", wsURL)
 	log.Printf("   • API Docs:   %s", apiDocs)
 
-	log.Println("\n🔐 Default credentials:")
+	log.Println("\n🔐 Default credentials (first start only, change the password):")
 	log.Println("   • Username: admin")
 	log.Println("   • Password: admin123")
 
 	log.Println("\n📊 Status:")
-	log.Printf("   • IoTDB: %v", db.IsEnabled())
+	log.Printf("   • IoTDB: %v (%s)", store.IsEnabled(), storeHealth.Status().Mode)
 	log.Printf("   • MQTT: %v", mqttClient.IsConnected())
 
 	log.Println("\n🌐 COPY & PASTE THIS URL TO YOUR BROWSER:")
@@ -319,10 +619,70 @@ func main() {
 		log.Println("   (Run as Administrator)")
 	}
 
-	log.Println("\n⏹️  Press Ctrl+C to stop the server\n")
+	log.Println("\n⏹️  Press Ctrl+C to stop the server")
 
 	listenAddr := "0.0.0.0:" + cfg.Server.Port
-	if err := app.Listen(listenAddr); err != nil {
-		log.Fatalf("❌ Server error: %v", err)
+	if certs != nil && cfg.Server.HTTPRedirectPort != "" {
+		serveHTTPRedirect(cfg.Server.HTTPRedirectPort, cfg.Server.Port)
+		log.Printf("   ↪️  http://%s:%s redirects to HTTPS", wslIP, cfg.Server.HTTPRedirectPort)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- serve(app, listenAddr, certs)
+	}()
+
+	exitCode := 0
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			log.Printf("❌ Server error: %v", err)
+			exitCode = 1
+		}
+	case <-ctx.Done():
+		log.Println("\n⏹️  Shutdown signal received")
 	}
-}
\ No newline at end of file
+	stop()
+
+	// Tunggu request yang sedang berjalan; OnShutdown hooks (login store
+	// routes) ikut dijalankan di sini
+	if err := app.ShutdownWithTimeout(10 * time.Second); err != nil {
+		log.Printf("⚠️  HTTP shutdown: %v", err)
+	}
+	shutdown()
+	os.Exit(exitCode)
+}
+
+// serve blocks in app.Listen, or app.Listener over TLS when certs is set,
+// until the app shuts down
+func serve(app *fiber.App, addr string, certs *certReloader) error {
+	if certs == nil {
+		return app.Listen(addr)
+	}
+	ln, err := tlsListener(addr, certs)
+	if err != nil {
+		return err
+	}
+	return app.Listener(ln)
+}
+
+// watchSettingsSIGHUP re-reads .env and data/settings.json on every SIGHUP;
+// invalid settings are rejected and the current ones kept
+func watchSettingsSIGHUP(settings *services.SettingsManager) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			changes, err := settings.Reload()
+			if err != nil {
+				log.Printf("⚠️  Settings reload failed, keeping the current settings: %v", err)
+				continue
+			}
+			log.Printf("⚙️ Settings reloaded: %d change(s)", len(changes))
+		}
+	}()
+}
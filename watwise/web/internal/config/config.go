@@ -2,29 +2,123 @@
 package config
 
 import (
+	"errors"
 	"log"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Server ServerConfig
-	IoTDB  IoTDBConfig
-	MQTT   MQTTConfig
-	JWT    JWTConfig
+	Server     ServerConfig
+	IoTDB      IoTDBConfig
+	MQTT       MQTTConfig
+	JWT        JWTConfig
+	Login      LoginConfig
+	Tariff     TariffConfig
+	Prediction PredictionConfig
+	Alert      AlertConfig
+	Anomaly    AnomalyConfig
+	Budget     BudgetConfig
+	Log        LogConfig
+
+	AlertToggles AlertToggleConfig
+	Standby      StandbyConfig
+	Demand       DemandConfig
+	Gap          GapConfig
+	Severity     SeverityConfig
+	Audit        AuditConfig
+	Report       ReportConfig
+	Notification NotificationConfig
 }
 
 type ServerConfig struct {
-	Port string
-	Env  string
+	Port          string
+	Env           string
+	BulkInsertMax int    // max readings per POST /api/energy/insert/bulk
+	ImportMaxMB   int    // max file size for POST /api/energy/import
+	BodyLimitMB   int    // max request body elsewhere
+	RetentionDays int    // delete readings older than this every night, 0 = keep forever
+	RetentionHour int    // local hour the retention job runs at
+	DataDir       string // local files (device registry, ...)
+	WSHistorySize int    // readings sent to a new WebSocket client, max 1000
+	// Pending WebSocket broadcasts, and what to drop when that many wait:
+	// drop-oldest (a newer reading replaces the pending one of its device)
+	// or drop-newest
+	WSBroadcastBuffer int
+	WSBroadcastPolicy string
+	// Realtime readings are sent every WSFlushIntervalMs, latest per device,
+	// batched when several devices reported; 0 = send each reading at once
+	WSFlushIntervalMs int
+	// Send bare objects instead of {"type","ts","data"} frames (clients not
+	// updated to the envelope yet), removed in the next release
+	WSLegacyFormat bool
+	// Energy and device requests are cancelled with 503 after RequestTimeout;
+	// streamed history/data and imports get StreamTimeout. 0 = no limit.
+	RequestTimeout time.Duration
+	StreamTimeout  time.Duration
+	// IANA zone for daily/weekly/monthly buckets when a request has no tz
+	// param, empty = server local time
+	Timezone string
+	// TTL of cached /summary/daily and /filtered responses, 0 = no cache
+	ResponseCacheTTLSeconds int
+	// TTL of computed monthly summaries, 0 = no cache; the current month,
+	// still growing, uses MonthlySummaryCurrentTTLSeconds (0 = not cached)
+	MonthlySummaryCacheTTLSeconds   int
+	MonthlySummaryCurrentTTLSeconds int
+
+	// GET /api/energy/latest answers from the newest saved reading while it
+	// is younger than this, 0 = always query IoTDB
+	LatestMaxAgeSeconds int
+	// gzip/brotli level for responses: -1 off, 0 default, 1 best speed, 2 best compression
+	CompressLevel int
+	// /health answers 503 (instead of 200 "degraded") when IoTDB is down
+	StrictHealth bool
+
+	// HTTPS: set TLSCertFile+TLSKeyFile, or TLSSelfSigned for development.
+	// SERVER_PORT is then the HTTPS port.
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSSelfSigned bool
+	// Plain HTTP port that redirects to HTTPS, empty = no redirect listener
+	HTTPRedirectPort string
 }
 
 type IoTDBConfig struct {
-	Host     string
-	Port     string
-	Username string
-	Password string
+	// DB_DRIVER: "iotdb", or "memory" to keep readings in process memory
+	// (lost on restart; for development and demos without a server)
+	Driver string
+
+	Host       string
+	Port       string
+	Username   string
+	Password   string
+	PoolSize   int
+	MaxRetries int // attempts per operation before giving up (IOTDB_MAX_RETRIES)
+
+	// Longest an operation (query, insert, delete) may take, 0 = no limit
+	QueryTimeout time.Duration
+
+	// Storage group of all data, e.g. root.tenantA.wattwise on a shared
+	// cluster; rollups go to <RootPath>_rollup
+	RootPath string
+
+	// DUMMY_MODE: "on" serves generated readings while IoTDB is not
+	// connected, "off" answers 503 instead
+	DummyMode string
+
+	// Raw data older than this is replaced by hourly aggregates, 0 = off
+	DownsampleAfterDays int
+	// How often the downsample job runs
+	DownsampleIntervalMinutes int
+
+	// How often hourly rollups (root.wattwise_rollup) are updated, 0 = off
+	RollupIntervalMinutes int
 }
 
 type MQTTConfig struct {
@@ -33,44 +127,574 @@ type MQTTConfig struct {
 	ClientID string
 	Username string
 	Password string
+	Topics   []string // energy topics, empty = mqtt.DefaultTopics
+	QoS      int
+
+	CommandAckTimeoutSeconds int // pending commands without ack become "timeout"
+
+	DedupWindowSeconds int // drop readings with a (device, timestamp or payload hash) seen this recently, 0 = off
+	DedupCacheSize     int // readings remembered for dedup
+
+	// Store at most one reading per device this often (latest of each
+	// window); every reading is still broadcast. 0 = store every reading
+	StoreIntervalSeconds int
+
+	// Devices without LWT go offline after OfflineMissedReports report
+	// intervals without data; a device's expected_report_interval_seconds
+	// overrides ReportIntervalSeconds
+	ReportIntervalSeconds int
+	OfflineMissedReports  int
+
+	// auto|json|cbor|msgpack for energy topics; PayloadFormats overrides it
+	// per topic filter ("filter=format" entries of MQTT_PAYLOAD_FORMATS)
+	PayloadFormat  string
+	PayloadFormats []TopicFormat
+
+	// Retained online/offline of this server, with "offline" as Last Will;
+	// "" = off
+	ServerStatusTopic string
+}
+
+// TopicFormat is one MQTT_PAYLOAD_FORMATS entry, kept in the order given
+type TopicFormat struct {
+	Filter string
+	Format string
 }
 
 type JWTConfig struct {
 	Secret     string
 	ExpireTime int
+
+	AccessTTLMinutes int // access token lifetime
+	RefreshTTLHours  int // refresh token lifetime
+}
+
+type LoginConfig struct {
+	AttemptsPerMinute  int // per IP and per username
+	LockoutThreshold   int // consecutive failures before lockout
+	LockoutBaseSeconds int // first lockout, doubled on every further failure
+	LockoutMaxSeconds  int
 }
 
+type TariffConfig struct {
+	PerKWh float64 // Rp per kWh; off-peak rate when time-of-use is on
+
+	// Time-of-use (PLN WBP/LWBP): PeakPerKWh applies from PeakStartHour up
+	// to PeakEndHour (local hours, may wrap past midnight). PeakPerKWh 0
+	// disables it.
+	PeakPerKWh    float64
+	PeakStartHour int
+	PeakEndHour   int
+
+	// Currency of all costs, returned with them as {amount, currency}
+	CurrencyCode     string // ISO 4217
+	CurrencySymbol   string
+	CurrencyDecimals int
+}
+
+type PredictionConfig struct {
+	LookbackDays    int     // history used for the forecast
+	IntervalMinutes int     // how often the forecast is recomputed, 0 = only on request
+	Smoothing       float64 // exponential smoothing factor (0-1], weight of the newest week
+}
+
+// AlertConfig holds the fixed alert bounds, see services.AlertThresholds
+type AlertConfig struct {
+	MaxPower       float64
+	MaxCurrent     float64
+	MinVoltage     float64
+	MaxVoltage     float64
+	MinPowerFactor float64 // 0 = off
+	MinFrequency   float64 // 0 = off; 59.5/60.5 for 60 Hz grids
+	MaxFrequency   float64 // 0 = off
+
+	// Power factor and frequency must be out of range this many readings in
+	// a row before they alert
+	SustainedReadings int
+}
+
+// AlertToggleConfig switches alert kinds on or off without touching their
+// bounds; all can be changed at runtime, see services.SettingsManager
+type AlertToggleConfig struct {
+	Threshold bool
+	Quality   bool
+	Anomaly   bool
+	Budget    bool
+}
+
+type BudgetConfig struct {
+	CheckMinutes int // how often budgets are checked for projected overruns, 0 = off
+}
+
+// StandbyConfig is the night window searched for standby (phantom) power
+type StandbyConfig struct {
+	StartHour  int // local hour, window may wrap past midnight
+	EndHour    int
+	MinSamples int // readings a night needs to count
+}
+
+// DemandConfig is the averaging window of peak demand (commercial tariffs)
+type DemandConfig struct {
+	WindowMinutes int // 15, 30 or 60
+}
+
+// GapConfig is the data gap scan of GET /api/energy/gaps: a gap is a
+// spacing between readings above the expected interval (the device's, else
+// MQTT_REPORT_INTERVAL_SECONDS) times Tolerance
+type GapConfig struct {
+	Tolerance float64
+}
+
+// SeverityConfig grades threshold alerts by how far the bound is exceeded,
+// see services.EnergyService.SetSeverityBands
+type SeverityConfig struct {
+	WarningPercent  float64 // more than this % over the bound = warning, else info
+	CriticalPercent float64 // more than this % over = critical
+	EscalateMinutes int     // a warning lasting longer becomes critical, 0 = off
+}
+
+// ReportConfig holds the figures of GET /api/reports/monthly
+type ReportConfig struct {
+	CarbonKgPerKWh float64 // grid emission factor, kg CO2 per kWh
+}
+
+// NotificationConfig: alerts sent by email (SMTP) and/or webhook, see
+// services.NotificationService. A channel is off while its SMTP_HOST /
+// NOTIFY_WEBHOOK_URL is empty.
+type NotificationConfig struct {
+	SMTPHost     string
+	SMTPPort     int // 465 = implicit TLS, otherwise STARTTLS when offered
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	EmailTo      []string
+	// Alert types to send (empty = all) and the lowest severity sent
+	EmailTypes       []string
+	EmailMinSeverity string
+
+	WebhookURL         string
+	WebhookSecret      string // HMAC-SHA256 of the body in X-Wattwise-Signature
+	WebhookTypes       []string
+	WebhookMinSeverity string
+
+	MaxAttempts int           // per notification, then data/notifications_dead.jsonl
+	RetryDelay  time.Duration // doubled after every failed attempt
+	// More than DigestThreshold alerts within DigestWindow are collapsed into
+	// one digest per channel, 0 = never
+	DigestThreshold int
+	DigestWindow    time.Duration
+}
+
+// AuditConfig bounds the audit trail in data/audit.jsonl
+type AuditConfig struct {
+	RetentionDays int // drop events older than this, 0 = keep until MaxEvents
+	MaxEvents     int
+}
+
+type AnomalyConfig struct {
+	Sigma      float64 // flag readings this many stddevs from the hourly baseline, 0 = off
+	WarmupDays int     // no anomaly alerts until a device has this much history
+
+	// GET /api/energy/anomalies: readings whose |z-score| against the
+	// rolling mean/stddev of the previous Window readings exceeds ZScore
+	ZScore float64
+	Window int
+}
+
+type LogConfig struct {
+	Level  string // debug, info, warn, error
+	Format string // text, json
+}
+
+// processEnv remembers the variables set before .env was read: they keep
+// winning over .env, also on Reload
+var (
+	envMu      sync.Mutex
+	processEnv map[string]bool
+	dotenvKeys map[string]bool
+)
+
 func Load() *Config {
+	envMu.Lock()
+	processEnv = make(map[string]bool)
+	for _, entry := range os.Environ() {
+		key, _, _ := strings.Cut(entry, "=")
+		processEnv[key] = true
+	}
+	envMu.Unlock()
+
 	// Load .env file
-	if err := godotenv.Load(); err != nil {
+	if err := loadDotenv(); err != nil {
 		log.Println("⚠️  No .env file found, using environment variables")
 	}
+	return build()
+}
+
+// Reload re-reads .env (SIGHUP). Variables of the process environment still
+// win; variables removed from .env fall back to their defaults.
+func Reload() *Config {
+	if err := loadDotenv(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("⚠️  Failed to re-read .env, keeping the previous values: %v", err)
+	}
+	return build()
+}
+
+// loadDotenv copies .env into the environment; a missing .env removes what
+// an earlier call set
+func loadDotenv() error {
+	values, err := godotenv.Read()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	envMu.Lock()
+	defer envMu.Unlock()
+
+	for key := range dotenvKeys {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+		}
+	}
+	dotenvKeys = make(map[string]bool)
+	for key, value := range values {
+		if processEnv[key] {
+			continue
+		}
+		os.Setenv(key, value)
+		dotenvKeys[key] = true
+	}
+	return err
+}
+
+func build() *Config {
+	currencyCode := validCurrencyCode(getEnv("CURRENCY_CODE", "IDR"))
 
 	return &Config{
 		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", "8080"),
-			Env:  getEnv("ENV", "development"),
+			Port:          getEnv("SERVER_PORT", "8080"),
+			Env:           getEnv("ENV", "development"),
+			BulkInsertMax: getEnvInt("BULK_INSERT_MAX", 5000),
+			ImportMaxMB:   getEnvInt("IMPORT_MAX_MB", 50),
+			RetentionDays: getEnvInt("RETENTION_DAYS", 0),
+			RetentionHour: getEnvInt("RETENTION_HOUR", 2),
+			DataDir:       getEnv("DATA_DIR", "data"),
+			WSHistorySize: getEnvInt("WS_HISTORY_SIZE", 100),
+			Timezone:      getEnv("TIMEZONE", ""),
+
+			WSBroadcastBuffer: validBroadcastBuffer(getEnvInt("WS_BROADCAST_BUFFER", 100)),
+			WSBroadcastPolicy: validBroadcastPolicy(getEnv("WS_BROADCAST_POLICY", "drop-oldest")),
+			WSFlushIntervalMs: getEnvInt("WS_FLUSH_INTERVAL_MS", 250),
+			WSLegacyFormat:    getEnvBool("WS_LEGACY_FORMAT", false),
+
+			BodyLimitMB:    getEnvInt("BODY_LIMIT_MB", 4),
+			RequestTimeout: getEnvDuration("REQUEST_TIMEOUT", 30*time.Second),
+			StreamTimeout:  getEnvDuration("STREAM_TIMEOUT", 10*time.Minute),
+
+			ResponseCacheTTLSeconds: getEnvInt("RESPONSE_CACHE_TTL_SECONDS", 300),
+			CompressLevel:           validCompressLevel(getEnvInt("COMPRESS_LEVEL", 0)),
+			StrictHealth:            getEnvBool("STRICT_HEALTH", false),
+
+			MonthlySummaryCacheTTLSeconds:   getEnvInt("MONTHLY_SUMMARY_CACHE_TTL_SECONDS", 3600),
+			MonthlySummaryCurrentTTLSeconds: getEnvInt("MONTHLY_SUMMARY_CURRENT_TTL_SECONDS", 60),
+
+			LatestMaxAgeSeconds: getEnvInt("LATEST_MAX_AGE_SECONDS", 30),
+
+			TLSCertFile:      getEnv("TLS_CERT_FILE", ""),
+			TLSKeyFile:       getEnv("TLS_KEY_FILE", ""),
+			TLSSelfSigned:    getEnvBool("TLS_SELF_SIGNED", false),
+			HTTPRedirectPort: getEnv("HTTP_REDIRECT_PORT", ""),
 		},
 		IoTDB: IoTDBConfig{
 			// ✅ FIXED: Gunakan IP 46.8.226.208 sesuai info teman
-			Host:     getEnv("IOTDB_HOST", "127.0.0.1"),
-			Port:     getEnv("IOTDB_PORT", "6667"),
-			Username: getEnv("IOTDB_USERNAME", "root"),
-			Password: getEnv("IOTDB_PASSWORD", "root"),
+			Host:       getEnv("IOTDB_HOST", "127.0.0.1"),
+			Port:       getEnv("IOTDB_PORT", "6667"),
+			Username:   getEnv("IOTDB_USERNAME", "root"),
+			Password:   getEnv("IOTDB_PASSWORD", "root"),
+			PoolSize:   getEnvInt("IOTDB_POOL_SIZE", 4),
+			MaxRetries: getEnvInt("IOTDB_MAX_RETRIES", 3),
+
+			QueryTimeout: getEnvDuration("IOTDB_QUERY_TIMEOUT", 30*time.Second),
+			RootPath:     getEnv("IOTDB_ROOT_PATH", "root.wattwise"),
+			DummyMode:    strings.ToLower(getEnv("DUMMY_MODE", "on")),
+			Driver:       strings.ToLower(getEnv("DB_DRIVER", "iotdb")),
+
+			DownsampleAfterDays:       getEnvInt("IOTDB_DOWNSAMPLE_AFTER_DAYS", 0),
+			DownsampleIntervalMinutes: getEnvInt("IOTDB_DOWNSAMPLE_INTERVAL_MINUTES", 60),
+
+			RollupIntervalMinutes: getEnvInt("ROLLUP_INTERVAL_MINUTES", 15),
 		},
-				MQTT: MQTTConfig{
+		MQTT: MQTTConfig{
 			// ✅ FIXED: Kredensial yang BENAR dari teman
 			Broker:   getEnv("MQTT_BROKER", "tcp://46.8.226.208:1883"),
 			Port:     getEnv("MQTT_PORT", "1883"),
 			ClientID: getEnv("MQTT_CLIENT_ID", "wattwise_server_go"),
-			Username: getEnv("MQTT_USERNAME", "iotesp32"),   // ← INI YANG BENER!
-			Password: getEnv("MQTT_PASSWORD", "iot2025"),    // ← INI YANG BENER!
+			Username: getEnv("MQTT_USERNAME", "iotesp32"), // ← INI YANG BENER!
+			Password: getEnv("MQTT_PASSWORD", "iot2025"),  // ← INI YANG BENER!
+			Topics:   validTopics(getEnvList("MQTT_TOPICS")),
+			QoS:      validQoS(getEnvInt("MQTT_QOS", 1)),
+
+			CommandAckTimeoutSeconds: getEnvInt("MQTT_COMMAND_ACK_TIMEOUT_SECONDS", 30),
+
+			DedupWindowSeconds: getEnvInt("MQTT_DEDUP_WINDOW_SECONDS", 300),
+			DedupCacheSize:     getEnvInt("MQTT_DEDUP_CACHE_SIZE", 1024),
+
+			StoreIntervalSeconds: getEnvInt("MQTT_STORE_INTERVAL_SECONDS", 0),
+
+			ReportIntervalSeconds: getEnvInt("MQTT_REPORT_INTERVAL_SECONDS", 20),
+			OfflineMissedReports:  getEnvInt("MQTT_OFFLINE_MISSED_REPORTS", 3),
+
+			PayloadFormat:  validPayloadFormat(getEnv("MQTT_PAYLOAD_FORMAT", "auto")),
+			PayloadFormats: validPayloadFormats(getEnvList("MQTT_PAYLOAD_FORMATS")),
+
+			ServerStatusTopic: validServerStatusTopic(getEnv("MQTT_SERVER_STATUS_TOPIC", "wattwise/server/status")),
 		},
 		JWT: JWTConfig{
-			Secret:     getEnv("JWT_SECRET", "wattwise-secret-key-change-in-production"),
+			Secret:     getEnv("JWT_SECRET", DefaultJWTSecret),
 			ExpireTime: 24, // hours
+
+			AccessTTLMinutes: getEnvInt("JWT_ACCESS_TTL_MINUTES", 15),
+			RefreshTTLHours:  getEnvInt("JWT_REFRESH_TTL_HOURS", 7*24),
 		},
+		Tariff: TariffConfig{
+			PerKWh: getEnvFloat("TARIFF_PER_KWH", 0), // 0 = DefaultTariffPerKWh,
+
+			PeakPerKWh:    getEnvFloat("TARIFF_PEAK_PER_KWH", 0),
+			PeakStartHour: validHour("TARIFF_PEAK_START_HOUR", getEnvInt("TARIFF_PEAK_START_HOUR", 17), 17),
+			PeakEndHour:   validHour("TARIFF_PEAK_END_HOUR", getEnvInt("TARIFF_PEAK_END_HOUR", 22), 22),
+
+			CurrencyCode:     currencyCode,
+			CurrencySymbol:   getEnv("CURRENCY_SYMBOL", defaultCurrencySymbol(currencyCode)),
+			CurrencyDecimals: validCurrencyDecimals(getEnvInt("CURRENCY_DECIMALS", 0)),
+		},
+		Prediction: PredictionConfig{
+			LookbackDays:    getEnvInt("PREDICTION_LOOKBACK_DAYS", 28),
+			IntervalMinutes: getEnvInt("PREDICTION_INTERVAL_MINUTES", 60),
+			Smoothing:       getEnvFloat("PREDICTION_SMOOTHING", 0.5),
+		},
+		Alert: AlertConfig{
+			MaxPower:       getEnvFloat("ALERT_MAX_POWER", 2200),
+			MaxCurrent:     getEnvFloat("ALERT_MAX_CURRENT", 10),
+			MinVoltage:     getEnvFloat("ALERT_MIN_VOLTAGE", 200),
+			MaxVoltage:     getEnvFloat("ALERT_MAX_VOLTAGE", 240),
+			MinPowerFactor: getEnvFloat("ALERT_MIN_POWER_FACTOR", 0.8),
+			MinFrequency:   getEnvFloat("ALERT_MIN_FREQUENCY", 49.5),
+			MaxFrequency:   getEnvFloat("ALERT_MAX_FREQUENCY", 50.5),
+
+			SustainedReadings: validSustainedReadings(getEnvInt("ALERT_SUSTAINED_READINGS", 3)),
+		},
+		Budget: BudgetConfig{
+			CheckMinutes: getEnvInt("BUDGET_CHECK_MINUTES", 15),
+		},
+		AlertToggles: AlertToggleConfig{
+			Threshold: getEnvBool("ALERT_THRESHOLD_ENABLED", true),
+			Quality:   getEnvBool("ALERT_QUALITY_ENABLED", true),
+			Anomaly:   getEnvBool("ALERT_ANOMALY_ENABLED", true),
+			Budget:    getEnvBool("ALERT_BUDGET_ENABLED", true),
+		},
+		Standby: StandbyConfig{
+			StartHour:  validHour("STANDBY_START_HOUR", getEnvInt("STANDBY_START_HOUR", 1), 1),
+			EndHour:    validHour("STANDBY_END_HOUR", getEnvInt("STANDBY_END_HOUR", 5), 5),
+			MinSamples: getEnvInt("STANDBY_MIN_SAMPLES", 30),
+		},
+		Demand: DemandConfig{
+			WindowMinutes: getEnvInt("DEMAND_WINDOW_MINUTES", 15),
+		},
+		Gap: GapConfig{
+			Tolerance: getEnvFloat("GAP_TOLERANCE", 2),
+		},
+		Severity: SeverityConfig{
+			WarningPercent:  getEnvFloat("ALERT_WARNING_PERCENT", 10),
+			CriticalPercent: getEnvFloat("ALERT_CRITICAL_PERCENT", 25),
+			EscalateMinutes: getEnvInt("ALERT_ESCALATE_MINUTES", 10),
+		},
+		Audit: AuditConfig{
+			RetentionDays: getEnvInt("AUDIT_RETENTION_DAYS", 90),
+			MaxEvents:     getEnvInt("AUDIT_MAX_EVENTS", 10000),
+		},
+		Notification: NotificationConfig{
+			SMTPHost:         getEnv("SMTP_HOST", ""),
+			SMTPPort:         getEnvInt("SMTP_PORT", 587),
+			SMTPUsername:     getEnv("SMTP_USERNAME", ""),
+			SMTPPassword:     getEnv("SMTP_PASSWORD", ""),
+			SMTPFrom:         getEnv("SMTP_FROM", ""),
+			EmailTo:          getEnvList("NOTIFY_EMAIL_TO"),
+			EmailTypes:       getEnvList("NOTIFY_EMAIL_TYPES"),
+			EmailMinSeverity: getEnv("NOTIFY_EMAIL_MIN_SEVERITY", "warning"),
+
+			WebhookURL:         getEnv("NOTIFY_WEBHOOK_URL", ""),
+			WebhookSecret:      getEnv("NOTIFY_WEBHOOK_SECRET", ""),
+			WebhookTypes:       getEnvList("NOTIFY_WEBHOOK_TYPES"),
+			WebhookMinSeverity: getEnv("NOTIFY_WEBHOOK_MIN_SEVERITY", "info"),
+
+			MaxAttempts:     getEnvInt("NOTIFY_MAX_ATTEMPTS", 4),
+			RetryDelay:      getEnvDuration("NOTIFY_RETRY_DELAY", 10*time.Second),
+			DigestThreshold: getEnvInt("NOTIFY_DIGEST_THRESHOLD", 5),
+			DigestWindow:    getEnvDuration("NOTIFY_DIGEST_WINDOW", 15*time.Minute),
+		},
+		Report: ReportConfig{
+			CarbonKgPerKWh: getEnvFloat("CARBON_KG_PER_KWH", 0.87), // grid Jawa-Bali
+		},
+		Anomaly: AnomalyConfig{
+			Sigma:      getEnvFloat("ANOMALY_SIGMA", 3),
+			WarmupDays: getEnvInt("ANOMALY_WARMUP_DAYS", 3),
+			ZScore:     getEnvFloat("ANOMALY_ZSCORE", 3),
+			Window:     getEnvInt("ANOMALY_WINDOW", 30),
+		},
+		Login: LoginConfig{
+			AttemptsPerMinute:  getEnvInt("LOGIN_ATTEMPTS_PER_MINUTE", 10),
+			LockoutThreshold:   getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 5),
+			LockoutBaseSeconds: getEnvInt("LOGIN_LOCKOUT_BASE_SECONDS", 30),
+			LockoutMaxSeconds:  getEnvInt("LOGIN_LOCKOUT_MAX_SECONDS", 900),
+		},
+		Log: LogConfig{
+			Level:  getEnv("LOG_LEVEL", "info"),
+			Format: getEnv("LOG_FORMAT", "text"),
+		},
+	}
+}
+
+// validTopics drops MQTT_TOPICS entries that are not valid subscription
+// filters: '#' only as the last level, '+' and '#' only as a whole level
+func validTopics(topics []string) []string {
+	var valid []string
+	for _, topic := range topics {
+		if !validTopicFilter(topic) {
+			log.Printf("⚠️  Invalid MQTT_TOPICS entry %q, skipped", topic)
+			continue
+		}
+		valid = append(valid, topic)
 	}
+	return valid
+}
+
+func validTopicFilter(topic string) bool {
+	levels := strings.Split(topic, "/")
+	for i, level := range levels {
+		if strings.ContainsAny(level, "+#") && len(level) > 1 {
+			return false
+		}
+		if level == "#" && i != len(levels)-1 {
+			return false
+		}
+	}
+	return topic != ""
+}
+
+var payloadFormats = []string{"auto", "json", "cbor", "msgpack"}
+
+func validPayloadFormat(format string) string {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if !slices.Contains(payloadFormats, format) {
+		log.Printf("⚠️  Invalid MQTT_PAYLOAD_FORMAT=%q, using auto", format)
+		return "auto"
+	}
+	return format
+}
+
+// validPayloadFormats parses "wattwise/energy/lora/+=cbor" entries, skipping
+// invalid filters and unknown formats
+func validPayloadFormats(entries []string) []TopicFormat {
+	var formats []TopicFormat
+	for _, entry := range entries {
+		filter, format, ok := strings.Cut(entry, "=")
+		filter, format = strings.TrimSpace(filter), strings.ToLower(strings.TrimSpace(format))
+		if !ok || !validTopicFilter(filter) || !slices.Contains(payloadFormats, format) {
+			log.Printf("⚠️  Invalid MQTT_PAYLOAD_FORMATS entry %q, use topic=auto|json|cbor|msgpack", entry)
+			continue
+		}
+		formats = append(formats, TopicFormat{Filter: filter, Format: format})
+	}
+	return formats
+}
+
+// validServerStatusTopic rejects wildcards and topics under
+// wattwise/status/, which the subscriber reads as device status
+func validServerStatusTopic(topic string) string {
+	topic = strings.TrimSpace(topic)
+	if topic == "-" || topic == "off" {
+		return ""
+	}
+	if strings.ContainsAny(topic, "+#") || strings.HasPrefix(topic, "wattwise/status/") {
+		log.Printf("⚠️  Invalid MQTT_SERVER_STATUS_TOPIC=%q, using wattwise/server/status", topic)
+		return "wattwise/server/status"
+	}
+	return topic
+}
+
+func validBroadcastBuffer(size int) int {
+	if size <= 0 {
+		log.Printf("⚠️  Invalid WS_BROADCAST_BUFFER=%d, using default 100", size)
+		return 100
+	}
+	return size
+}
+
+func validBroadcastPolicy(policy string) string {
+	policy = strings.ToLower(strings.TrimSpace(policy))
+	if policy != "drop-oldest" && policy != "drop-newest" {
+		log.Printf("⚠️  Invalid WS_BROADCAST_POLICY=%q, use drop-oldest or drop-newest; using drop-oldest", policy)
+		return "drop-oldest"
+	}
+	return policy
+}
+
+// validCurrencyCode accepts three-letter ISO 4217 codes, upper-cased
+func validCurrencyCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 || strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		log.Printf("⚠️  Invalid CURRENCY_CODE=%q, use an ISO 4217 code like IDR; using default IDR", code)
+		return "IDR"
+	}
+	return code
+}
+
+// defaultCurrencySymbol is Rp for Rupiah, else the code itself
+func defaultCurrencySymbol(code string) string {
+	if code == "IDR" {
+		return "Rp"
+	}
+	return code
+}
+
+func validCurrencyDecimals(n int) int {
+	if n < 0 || n > 4 {
+		log.Printf("⚠️  Invalid CURRENCY_DECIMALS=%d, use 0-4; using default 0", n)
+		return 0
+	}
+	return n
+}
+
+func validSustainedReadings(n int) int {
+	if n < 1 {
+		log.Printf("⚠️  Invalid ALERT_SUSTAINED_READINGS=%d, using default 3", n)
+		return 3
+	}
+	return n
+}
+
+// validHour accepts 0-24 (24 = midnight at the end of the day)
+func validHour(key string, hour, def int) int {
+	if hour < 0 || hour > 24 {
+		log.Printf("⚠️  Invalid %s=%d, use 0-24; using default %d", key, hour, def)
+		return def
+	}
+	return hour
+}
+
+func validQoS(qos int) int {
+	if qos < 0 || qos > 2 {
+		log.Printf("⚠️  Invalid MQTT_QOS=%d, using default 1", qos)
+		return 1
+	}
+	return qos
+}
+
+func validCompressLevel(level int) int {
+	if level < -1 || level > 2 {
+		log.Printf("⚠️  Invalid COMPRESS_LEVEL=%d, using default 0", level)
+		return 0
+	}
+	return level
 }
 
 func getEnv(key, defaultValue string) string {
@@ -78,4 +702,76 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("⚠️  Invalid %s=%q, using default %g", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("⚠️  Invalid %s=%q, using default %t", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvList splits a comma separated value, skipping empty items
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("⚠️  Invalid %s=%q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvDuration reads a duration like "30s" or "2m"; a bare number is
+// taken as seconds
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		log.Printf("⚠️  Invalid %s=%q, using default %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
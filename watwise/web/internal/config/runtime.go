@@ -0,0 +1,35 @@
+package config
+
+import "wattwise/internal/models"
+
+// RuntimeSettings returns the settings services.SettingsManager may change
+// without a restart
+func (c *Config) RuntimeSettings() models.RuntimeSettings {
+	return models.RuntimeSettings{
+		LogLevel: c.Log.Level,
+
+		TariffPerKWh:        c.Tariff.PerKWh,
+		TariffPeakPerKWh:    c.Tariff.PeakPerKWh,
+		TariffPeakStartHour: c.Tariff.PeakStartHour,
+		TariffPeakEndHour:   c.Tariff.PeakEndHour,
+
+		AlertMaxPower:          c.Alert.MaxPower,
+		AlertMaxCurrent:        c.Alert.MaxCurrent,
+		AlertMinVoltage:        c.Alert.MinVoltage,
+		AlertMaxVoltage:        c.Alert.MaxVoltage,
+		AlertMinPowerFactor:    c.Alert.MinPowerFactor,
+		AlertMinFrequency:      c.Alert.MinFrequency,
+		AlertMaxFrequency:      c.Alert.MaxFrequency,
+		AlertSustainedReadings: c.Alert.SustainedReadings,
+
+		ThresholdAlerts: c.AlertToggles.Threshold,
+		QualityAlerts:   c.AlertToggles.Quality,
+		AnomalyAlerts:   c.AlertToggles.Anomaly,
+		BudgetAlerts:    c.AlertToggles.Budget,
+	}
+}
+
+// ReloadRuntimeSettings re-reads .env, see Reload
+func ReloadRuntimeSettings() models.RuntimeSettings {
+	return Reload().RuntimeSettings()
+}
@@ -0,0 +1,263 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultJWTSecret is the JWT_SECRET fallback; Validate refuses it in production
+const DefaultJWTSecret = "wattwise-secret-key-change-in-production"
+
+// mqttSchemes are the broker URL schemes paho supports
+var mqttSchemes = []string{"tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss"}
+
+var logLevels = []string{"debug", "info", "warn", "warning", "error"}
+
+// notifySeverities mirrors models.Severities, lowest first
+var notifySeverities = []string{"info", "warning", "critical"}
+
+// Validate checks the loaded config and returns every problem at once
+// (errors.Join), nil when the config is usable. Load already replaced some
+// bad values with defaults and logged them; Validate catches what it cannot.
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	for _, p := range []struct {
+		key, value string
+		optional   bool
+	}{
+		{"SERVER_PORT", c.Server.Port, false},
+		{"HTTP_REDIRECT_PORT", c.Server.HTTPRedirectPort, true},
+		{"IOTDB_PORT", c.IoTDB.Port, false},
+		{"MQTT_PORT", c.MQTT.Port, false},
+	} {
+		if p.optional && p.value == "" {
+			continue
+		}
+		if err := validPort(p.value); err != nil {
+			add("%s=%q: %v", p.key, p.value, err)
+		}
+	}
+	if c.Server.HTTPRedirectPort != "" && c.Server.HTTPRedirectPort == c.Server.Port {
+		add("HTTP_REDIRECT_PORT=%q must differ from SERVER_PORT", c.Server.HTTPRedirectPort)
+	}
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		add("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	if c.IoTDB.Driver != "iotdb" && c.IoTDB.Driver != "memory" {
+		add("DB_DRIVER=%q, use iotdb or memory", c.IoTDB.Driver)
+	}
+	if strings.TrimSpace(c.IoTDB.Host) == "" {
+		add("IOTDB_HOST is empty")
+	}
+	if err := validRootPath(c.IoTDB.RootPath); err != nil {
+		add("IOTDB_ROOT_PATH=%q: %v", c.IoTDB.RootPath, err)
+	}
+	if c.IoTDB.DummyMode != "on" && c.IoTDB.DummyMode != "off" {
+		add("DUMMY_MODE=%q, use on or off", c.IoTDB.DummyMode)
+	}
+
+	if err := validBrokerURL(c.MQTT.Broker); err != nil {
+		add("MQTT_BROKER=%q: %v", c.MQTT.Broker, err)
+	}
+
+	if c.JWT.Secret == "" {
+		add("JWT_SECRET is empty")
+	} else if c.Production() && c.JWT.Secret == DefaultJWTSecret {
+		add("JWT_SECRET is the built-in default, set a secret when ENV=%s", c.Server.Env)
+	}
+
+	if c.Server.Timezone != "" {
+		if _, err := time.LoadLocation(c.Server.Timezone); err != nil {
+			add("TIMEZONE=%q: %v", c.Server.Timezone, err)
+		}
+	}
+	if c.MQTT.ReportIntervalSeconds < 1 {
+		add("MQTT_REPORT_INTERVAL_SECONDS=%d must be >= 1", c.MQTT.ReportIntervalSeconds)
+	}
+	if c.MQTT.OfflineMissedReports < 1 {
+		add("MQTT_OFFLINE_MISSED_REPORTS=%d must be >= 1", c.MQTT.OfflineMissedReports)
+	}
+	if c.Server.BodyLimitMB < 1 {
+		add("BODY_LIMIT_MB=%d must be >= 1", c.Server.BodyLimitMB)
+	}
+	if c.Server.StreamTimeout > 0 && c.Server.StreamTimeout < c.Server.RequestTimeout {
+		add("STREAM_TIMEOUT=%s must not be shorter than REQUEST_TIMEOUT=%s", c.Server.StreamTimeout, c.Server.RequestTimeout)
+	}
+
+	if !validRate(c.Tariff.PerKWh) {
+		add("TARIFF_PER_KWH=%v must be a number >= 0", c.Tariff.PerKWh)
+	}
+	if !validRate(c.Report.CarbonKgPerKWh) {
+		add("CARBON_KG_PER_KWH=%v must be a number >= 0", c.Report.CarbonKgPerKWh)
+	}
+	if !validRate(c.Tariff.PeakPerKWh) {
+		add("TARIFF_PEAK_PER_KWH=%v must be a number >= 0", c.Tariff.PeakPerKWh)
+	}
+	if c.Tariff.PeakPerKWh > 0 && c.Tariff.PeakStartHour == c.Tariff.PeakEndHour {
+		add("TARIFF_PEAK_START_HOUR and TARIFF_PEAK_END_HOUR are both %d, the peak window is empty", c.Tariff.PeakStartHour)
+	}
+
+	if !slices.Contains([]int{15, 30, 60}, c.Demand.WindowMinutes) {
+		add("DEMAND_WINDOW_MINUTES=%d, use 15, 30 or 60", c.Demand.WindowMinutes)
+	}
+	if c.Gap.Tolerance <= 1 {
+		add("GAP_TOLERANCE=%v must be > 1", c.Gap.Tolerance)
+	}
+	if c.Anomaly.ZScore <= 0 {
+		add("ANOMALY_ZSCORE=%v must be > 0", c.Anomaly.ZScore)
+	}
+	if c.Anomaly.Window < 2 || c.Anomaly.Window > 1440 {
+		add("ANOMALY_WINDOW=%d must be between 2 and 1440 readings", c.Anomaly.Window)
+	}
+	if c.Severity.WarningPercent < 0 || c.Severity.CriticalPercent < c.Severity.WarningPercent {
+		add("ALERT_WARNING_PERCENT=%v and ALERT_CRITICAL_PERCENT=%v need 0 <= warning <= critical", c.Severity.WarningPercent, c.Severity.CriticalPercent)
+	}
+	if c.Severity.EscalateMinutes < 0 {
+		add("ALERT_ESCALATE_MINUTES=%d must be >= 0", c.Severity.EscalateMinutes)
+	}
+	if c.Audit.RetentionDays < 0 {
+		add("AUDIT_RETENTION_DAYS=%d must be >= 0", c.Audit.RetentionDays)
+	}
+	if c.Audit.MaxEvents < 1 {
+		add("AUDIT_MAX_EVENTS=%d must be >= 1", c.Audit.MaxEvents)
+	}
+
+	n := c.Notification
+	if n.SMTPHost != "" {
+		if n.SMTPFrom == "" || len(n.EmailTo) == 0 {
+			add("SMTP_HOST is set, SMTP_FROM and NOTIFY_EMAIL_TO are required too")
+		}
+		if n.SMTPPort < 1 || n.SMTPPort > 65535 {
+			add("SMTP_PORT=%d out of range 1-65535", n.SMTPPort)
+		}
+	}
+	if n.WebhookURL != "" {
+		if u, err := url.Parse(n.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("NOTIFY_WEBHOOK_URL=%q must be an http(s) URL", n.WebhookURL)
+		}
+	}
+	if !slices.Contains(notifySeverities, n.EmailMinSeverity) {
+		add("NOTIFY_EMAIL_MIN_SEVERITY=%q, use info, warning or critical", n.EmailMinSeverity)
+	}
+	if !slices.Contains(notifySeverities, n.WebhookMinSeverity) {
+		add("NOTIFY_WEBHOOK_MIN_SEVERITY=%q, use info, warning or critical", n.WebhookMinSeverity)
+	}
+	if n.MaxAttempts < 1 {
+		add("NOTIFY_MAX_ATTEMPTS=%d must be >= 1", n.MaxAttempts)
+	}
+	if n.RetryDelay < 0 || n.DigestWindow < 0 || n.DigestThreshold < 0 {
+		add("NOTIFY_RETRY_DELAY, NOTIFY_DIGEST_WINDOW and NOTIFY_DIGEST_THRESHOLD must be >= 0")
+	}
+	if n.DigestThreshold > 0 && n.DigestWindow == 0 {
+		add("NOTIFY_DIGEST_THRESHOLD=%d needs a NOTIFY_DIGEST_WINDOW", n.DigestThreshold)
+	}
+
+	if !slices.Contains(logLevels, strings.ToLower(strings.TrimSpace(c.Log.Level))) {
+		add("LOG_LEVEL=%q, use debug, info, warn or error", c.Log.Level)
+	}
+	if format := strings.ToLower(c.Log.Format); format != "text" && format != "json" {
+		add("LOG_FORMAT=%q, use text or json", c.Log.Format)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Production reports whether ENV is production
+func (c *Config) Production() bool {
+	env := strings.ToLower(strings.TrimSpace(c.Server.Env))
+	return env == "production" || env == "prod"
+}
+
+// Location is the TIMEZONE zone, server local time when unset or invalid
+func (c *Config) Location() *time.Location {
+	if c.Server.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(c.Server.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// Masked returns a copy with passwords and secrets replaced, for printing
+func (c *Config) Masked() Config {
+	masked := *c
+	masked.IoTDB.Password = mask(c.IoTDB.Password)
+	masked.MQTT.Password = mask(c.MQTT.Password)
+	masked.JWT.Secret = mask(c.JWT.Secret)
+	masked.Notification.SMTPPassword = mask(c.Notification.SMTPPassword)
+	masked.Notification.WebhookSecret = mask(c.Notification.WebhookSecret)
+	return masked
+}
+
+func mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "********"
+}
+
+// iotdbNode is one level of an IoTDB path that needs no backquotes
+var iotdbNode = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validRootPath accepts root.<node>[.<node>...] of plain identifiers, e.g.
+// root.tenantA.wattwise
+func validRootPath(path string) error {
+	nodes := strings.Split(path, ".")
+	if len(nodes) < 2 || nodes[0] != "root" {
+		return errors.New("must start with root.")
+	}
+	for _, node := range nodes[1:] {
+		if !iotdbNode.MatchString(node) {
+			return fmt.Errorf("invalid node %q, use letters, digits and _", node)
+		}
+	}
+	return nil
+}
+
+func validPort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return errors.New("not a number")
+	}
+	if n < 1 || n > 65535 {
+		return errors.New("out of range 1-65535")
+	}
+	return nil
+}
+
+func validBrokerURL(broker string) error {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(mqttSchemes, strings.ToLower(u.Scheme)) {
+		return fmt.Errorf("unsupported scheme %q, use one of %s", u.Scheme, strings.Join(mqttSchemes, ", "))
+	}
+	if u.Hostname() == "" {
+		return errors.New("missing host")
+	}
+	if port := u.Port(); port != "" {
+		if err := validPort(port); err != nil {
+			return fmt.Errorf("port %q: %v", port, err)
+		}
+	}
+	return nil
+}
+
+func validRate(rate float64) bool {
+	return rate >= 0 && !math.IsInf(rate, 0) && !math.IsNaN(rate)
+}
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig passes Validate; each test case breaks one rule
+func validConfig() *Config {
+	c := &Config{}
+	c.Server.Port = "8080"
+	c.Server.Env = "development"
+	c.Server.BodyLimitMB = 4
+	c.Server.RequestTimeout = 30 * time.Second
+	c.Server.StreamTimeout = 5 * time.Minute
+	c.Server.Timezone = "UTC"
+	c.IoTDB.Driver = "iotdb"
+	c.IoTDB.Host = "localhost"
+	c.IoTDB.Port = "6667"
+	c.IoTDB.RootPath = "root.wattwise"
+	c.IoTDB.DummyMode = "on"
+	c.MQTT.Broker = "tcp://localhost:1883"
+	c.MQTT.Port = "1883"
+	c.MQTT.ReportIntervalSeconds = 5
+	c.MQTT.OfflineMissedReports = 3
+	c.JWT.Secret = DefaultJWTSecret
+	c.Tariff.PerKWh = 1444.70
+	c.Tariff.PeakStartHour = 17
+	c.Tariff.PeakEndHour = 22
+	c.Report.CarbonKgPerKWh = 0.85
+	c.Demand.WindowMinutes = 15
+	c.Gap.Tolerance = 3
+	c.Anomaly.ZScore = 3
+	c.Anomaly.Window = 60
+	c.Severity.WarningPercent = 10
+	c.Severity.CriticalPercent = 25
+	c.Audit.MaxEvents = 10000
+	c.Notification.SMTPPort = 587
+	c.Notification.EmailMinSeverity = "warning"
+	c.Notification.WebhookMinSeverity = "info"
+	c.Notification.MaxAttempts = 5
+	c.Log.Level = "info"
+	c.Log.Format = "text"
+	return c
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		err    string // "" = valid
+	}{
+		{"valid", func(c *Config) {}, ""},
+
+		{"port not a number", func(c *Config) { c.Server.Port = "80a" }, `SERVER_PORT="80a": not a number`},
+		{"port zero", func(c *Config) { c.Server.Port = "0" }, `SERVER_PORT="0": out of range`},
+		{"port above 65535", func(c *Config) { c.IoTDB.Port = "65536" }, `IOTDB_PORT="65536": out of range`},
+		{"port empty", func(c *Config) { c.MQTT.Port = "" }, `MQTT_PORT="": not a number`},
+		{"highest port", func(c *Config) { c.MQTT.Port = "65535" }, ""},
+		{"redirect port optional", func(c *Config) { c.Server.HTTPRedirectPort = "" }, ""},
+		{"redirect port invalid", func(c *Config) { c.Server.HTTPRedirectPort = "http" }, `HTTP_REDIRECT_PORT="http": not a number`},
+		{"redirect port same as server", func(c *Config) { c.Server.HTTPRedirectPort = "8080" }, "must differ from SERVER_PORT"},
+		{"TLS cert without key", func(c *Config) { c.Server.TLSCertFile = "cert.pem" }, "TLS_CERT_FILE and TLS_KEY_FILE"},
+		{"TLS key without cert", func(c *Config) { c.Server.TLSKeyFile = "key.pem" }, "TLS_CERT_FILE and TLS_KEY_FILE"},
+		{"TLS cert and key", func(c *Config) { c.Server.TLSCertFile, c.Server.TLSKeyFile = "cert.pem", "key.pem" }, ""},
+
+		{"unknown driver", func(c *Config) { c.IoTDB.Driver = "postgres" }, `DB_DRIVER="postgres"`},
+		{"memory driver", func(c *Config) { c.IoTDB.Driver = "memory" }, ""},
+		{"empty host", func(c *Config) { c.IoTDB.Host = " " }, "IOTDB_HOST is empty"},
+		{"root path without root", func(c *Config) { c.IoTDB.RootPath = "wattwise" }, "must start with root."},
+		{"root path only root", func(c *Config) { c.IoTDB.RootPath = "root" }, "must start with root."},
+		{"root path bad node", func(c *Config) { c.IoTDB.RootPath = "root.tenant-a" }, `invalid node "tenant-a"`},
+		{"root path nested", func(c *Config) { c.IoTDB.RootPath = "root.tenantA.wattwise_2" }, ""},
+		{"dummy mode", func(c *Config) { c.IoTDB.DummyMode = "yes" }, `DUMMY_MODE="yes"`},
+
+		{"broker scheme", func(c *Config) { c.MQTT.Broker = "http://localhost:1883" }, `unsupported scheme "http"`},
+		{"broker without scheme", func(c *Config) { c.MQTT.Broker = "localhost" }, "unsupported scheme"},
+		{"broker without host", func(c *Config) { c.MQTT.Broker = "tcp://:1883" }, "missing host"},
+		{"broker port", func(c *Config) { c.MQTT.Broker = "tcp://localhost:99999" }, `port "99999": out of range`},
+		{"broker unparsable", func(c *Config) { c.MQTT.Broker = "tcp://local host" }, "MQTT_BROKER"},
+		{"broker websocket", func(c *Config) { c.MQTT.Broker = "wss://broker.example.com/mqtt" }, ""},
+		{"broker scheme case", func(c *Config) { c.MQTT.Broker = "SSL://broker:8883" }, ""},
+
+		{"empty JWT secret", func(c *Config) { c.JWT.Secret = "" }, "JWT_SECRET is empty"},
+		{"default JWT secret in production", func(c *Config) { c.Server.Env = "production" }, "JWT_SECRET is the built-in default"},
+		{"default JWT secret in prod", func(c *Config) { c.Server.Env = " PROD " }, "JWT_SECRET is the built-in default"},
+		{"own JWT secret in production", func(c *Config) { c.Server.Env, c.JWT.Secret = "production", "s3cret" }, ""},
+
+		{"unknown timezone", func(c *Config) { c.Server.Timezone = "Mars/Olympus" }, `TIMEZONE="Mars/Olympus"`},
+		{"no timezone", func(c *Config) { c.Server.Timezone = "" }, ""},
+		{"report interval", func(c *Config) { c.MQTT.ReportIntervalSeconds = 0 }, "MQTT_REPORT_INTERVAL_SECONDS=0"},
+		{"offline missed reports", func(c *Config) { c.MQTT.OfflineMissedReports = 0 }, "MQTT_OFFLINE_MISSED_REPORTS=0"},
+		{"body limit", func(c *Config) { c.Server.BodyLimitMB = 0 }, "BODY_LIMIT_MB=0"},
+		{"stream timeout shorter", func(c *Config) { c.Server.StreamTimeout = time.Second }, "STREAM_TIMEOUT=1s must not be shorter"},
+		{"no stream timeout", func(c *Config) { c.Server.StreamTimeout = 0 }, ""},
+
+		{"negative tariff", func(c *Config) { c.Tariff.PerKWh = -1 }, "TARIFF_PER_KWH=-1"},
+		{"NaN tariff", func(c *Config) { c.Tariff.PerKWh = math.NaN() }, "TARIFF_PER_KWH=NaN"},
+		{"infinite tariff", func(c *Config) { c.Tariff.PerKWh = math.Inf(1) }, "TARIFF_PER_KWH=+Inf"},
+		{"free tariff", func(c *Config) { c.Tariff.PerKWh = 0 }, ""},
+		{"negative carbon", func(c *Config) { c.Report.CarbonKgPerKWh = -0.1 }, "CARBON_KG_PER_KWH=-0.1"},
+		{"negative peak tariff", func(c *Config) { c.Tariff.PeakPerKWh = -5 }, "TARIFF_PEAK_PER_KWH=-5"},
+		{"empty peak window", func(c *Config) { c.Tariff.PeakPerKWh, c.Tariff.PeakEndHour = 2000, 17 }, "peak window is empty"},
+		{"empty peak window unused", func(c *Config) { c.Tariff.PeakEndHour = 17 }, ""},
+
+		{"demand window", func(c *Config) { c.Demand.WindowMinutes = 45 }, "DEMAND_WINDOW_MINUTES=45"},
+		{"gap tolerance", func(c *Config) { c.Gap.Tolerance = 1 }, "GAP_TOLERANCE=1"},
+		{"anomaly z-score", func(c *Config) { c.Anomaly.ZScore = 0 }, "ANOMALY_ZSCORE=0"},
+		{"anomaly window too small", func(c *Config) { c.Anomaly.Window = 1 }, "ANOMALY_WINDOW=1"},
+		{"anomaly window too large", func(c *Config) { c.Anomaly.Window = 1441 }, "ANOMALY_WINDOW=1441"},
+		{"negative warning percent", func(c *Config) { c.Severity.WarningPercent = -1 }, "ALERT_WARNING_PERCENT=-1"},
+		{"critical below warning", func(c *Config) { c.Severity.CriticalPercent = 5 }, "ALERT_CRITICAL_PERCENT=5"},
+		{"critical equals warning", func(c *Config) { c.Severity.CriticalPercent = 10 }, ""},
+		{"escalate minutes", func(c *Config) { c.Severity.EscalateMinutes = -1 }, "ALERT_ESCALATE_MINUTES=-1"},
+		{"audit retention", func(c *Config) { c.Audit.RetentionDays = -1 }, "AUDIT_RETENTION_DAYS=-1"},
+		{"audit max events", func(c *Config) { c.Audit.MaxEvents = 0 }, "AUDIT_MAX_EVENTS=0"},
+
+		{"SMTP without from", func(c *Config) {
+			c.Notification.SMTPHost, c.Notification.EmailTo = "smtp.example.com", []string{"a@example.com"}
+		}, "SMTP_FROM and NOTIFY_EMAIL_TO are required"},
+		{"SMTP without recipients", func(c *Config) {
+			c.Notification.SMTPHost, c.Notification.SMTPFrom = "smtp.example.com", "w@example.com"
+		}, "SMTP_FROM and NOTIFY_EMAIL_TO are required"},
+		{"SMTP port", func(c *Config) {
+			c.Notification.SMTPHost, c.Notification.SMTPFrom, c.Notification.EmailTo = "smtp.example.com", "w@example.com", []string{"a@example.com"}
+			c.Notification.SMTPPort = 0
+		}, "SMTP_PORT=0"},
+		{"SMTP port unused without host", func(c *Config) { c.Notification.SMTPPort = 0 }, ""},
+		{"webhook scheme", func(c *Config) { c.Notification.WebhookURL = "ftp://hooks.example.com" }, "NOTIFY_WEBHOOK_URL"},
+		{"webhook without host", func(c *Config) { c.Notification.WebhookURL = "https:///hook" }, "NOTIFY_WEBHOOK_URL"},
+		{"webhook", func(c *Config) { c.Notification.WebhookURL = "https://hooks.example.com/wattwise" }, ""},
+		{"email severity", func(c *Config) { c.Notification.EmailMinSeverity = "high" }, `NOTIFY_EMAIL_MIN_SEVERITY="high"`},
+		{"webhook severity", func(c *Config) { c.Notification.WebhookMinSeverity = "" }, `NOTIFY_WEBHOOK_MIN_SEVERITY=""`},
+		{"max attempts", func(c *Config) { c.Notification.MaxAttempts = 0 }, "NOTIFY_MAX_ATTEMPTS=0"},
+		{"negative retry delay", func(c *Config) { c.Notification.RetryDelay = -time.Second }, "NOTIFY_RETRY_DELAY"},
+		{"negative digest threshold", func(c *Config) { c.Notification.DigestThreshold = -1 }, "NOTIFY_DIGEST_THRESHOLD must be >= 0"},
+		{"digest without window", func(c *Config) { c.Notification.DigestThreshold = 10 }, "NOTIFY_DIGEST_THRESHOLD=10 needs a NOTIFY_DIGEST_WINDOW"},
+
+		{"log level", func(c *Config) { c.Log.Level = "verbose" }, `LOG_LEVEL="verbose"`},
+		{"log level case", func(c *Config) { c.Log.Level = " WARNING " }, ""},
+		{"log format", func(c *Config) { c.Log.Format = "logfmt" }, `LOG_FORMAT="logfmt"`},
+		{"log format case", func(c *Config) { c.Log.Format = "JSON" }, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.modify(c)
+			err := c.Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Validate() = %v, want %q", err, tt.err)
+			}
+			// Tiap aturan hanya melaporkan masalahnya sendiri
+			if n := len(strings.Split(err.Error(), "\n")); n != 1 {
+				t.Errorf("%d problems reported, want 1:\n%v", n, err)
+			}
+		})
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	c := validConfig()
+	c.Server.Port = "http"
+	c.MQTT.Broker = "localhost:1883"
+	c.Log.Format = "xml"
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil")
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "SERVER_PORT") || !strings.HasPrefix(lines[1], "MQTT_BROKER") || !strings.HasPrefix(lines[2], "LOG_FORMAT") {
+		t.Errorf("Validate() =\n%v\nwant SERVER_PORT, MQTT_BROKER and LOG_FORMAT", err)
+	}
+}
+
+func TestMasked(t *testing.T) {
+	c := validConfig()
+	c.IoTDB.Password = "root"
+	c.MQTT.Password = "mqtt"
+	c.Notification.SMTPPassword = "smtp"
+	c.Notification.WebhookSecret = "hmac"
+
+	masked := c.Masked()
+	for name, value := range map[string]string{
+		"IOTDB_PASSWORD": masked.IoTDB.Password, "MQTT_PASSWORD": masked.MQTT.Password, "JWT_SECRET": masked.JWT.Secret,
+		"SMTP_PASSWORD": masked.Notification.SMTPPassword, "NOTIFY_WEBHOOK_SECRET": masked.Notification.WebhookSecret,
+	} {
+		if value != "********" {
+			t.Errorf("%s = %q, want masked", name, value)
+		}
+	}
+	if masked.IoTDB.Host != c.IoTDB.Host || c.IoTDB.Password != "root" {
+		t.Error("Masked changed the original or non-secret fields")
+	}
+	// Password kosong tetap kosong, supaya terlihat belum di-set
+	if c.MQTT.Password = ""; c.Masked().MQTT.Password != "" {
+		t.Error("empty MQTT_PASSWORD masked, want empty")
+	}
+}
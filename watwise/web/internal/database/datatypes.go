@@ -0,0 +1,293 @@
+package database
+
+import (
+	"slices"
+	"strings"
+	"wattwise/internal/models"
+
+	"github.com/apache/iotdb-client-go/client"
+)
+
+// Older deployments created the energy timeseries as FLOAT, newer ones as
+// DOUBLE. The actual types are read from SHOW TIMESERIES on connect, writes
+// use them, and reads convert whatever type comes back (see energyScanner).
+
+// loadSeriesTypes records the datatype of every device's energy timeseries
+// and warns about the ones that are not DOUBLE
+func (db *IoTDB) loadSeriesTypes(session session) {
+	dataSet, err := session.ExecuteQueryStatement("SHOW TIMESERIES "+db.root+".**", nil)
+	if err != nil {
+		db.logger.Warn("could not read timeseries datatypes, assuming DOUBLE", "error", err)
+		return
+	}
+	defer dataSet.Close()
+
+	types := make(map[string][]client.TSDataType)
+	for {
+		hasNext, err := dataSet.Next()
+		if err != nil {
+			db.logger.Warn("could not read timeseries datatypes, assuming DOUBLE", "error", err)
+			return
+		}
+		if !hasNext {
+			break
+		}
+
+		deviceID, measurement, ok := db.splitSeriesPath(dataSet.GetText("Timeseries"))
+		if !ok {
+			continue
+		}
+		index := measurementIndex(measurement)
+		if index < 0 {
+			continue
+		}
+
+		dataType, ok := parseDataType(dataSet.GetText("DataType"))
+		if !ok {
+			continue
+		}
+		if _, ok := types[deviceID]; !ok {
+			types[deviceID] = defaultEnergyTypes()
+		}
+		types[deviceID][index] = dataType
+
+		if dataType != client.DOUBLE {
+			db.logger.Warn("timeseries datatype mismatch, values will be converted (recreate as DOUBLE to fix)",
+				"device_id", deviceID,
+				"measurement", measurement,
+				"datatype", dataSet.GetText("DataType"),
+				"expected", "DOUBLE")
+		}
+	}
+
+	for deviceID, t := range types {
+		db.seriesTypes.Store(deviceID, t)
+	}
+}
+
+// energyTypes returns the datatypes to write energyMeasurements with
+func (db *IoTDB) energyTypes(deviceID string) []client.TSDataType {
+	if t, ok := db.seriesTypes.Load(deviceID); ok {
+		return t.([]client.TSDataType)
+	}
+	return defaultEnergyTypes()
+}
+
+// energyValues orders a reading like energyMeasurements, converted to types
+func energyValues(types []client.TSDataType, data models.EnergyData) []interface{} {
+	raw := []float64{data.Voltage, data.Current, data.Power, data.Energy, data.Frequency, data.PowerFactor}
+
+	values := make([]interface{}, len(raw))
+	for i, v := range raw {
+		switch types[i] {
+		case client.FLOAT:
+			values[i] = float32(v)
+		case client.INT32:
+			values[i] = int32(v)
+		case client.INT64:
+			values[i] = int64(v)
+		default:
+			values[i] = v
+		}
+	}
+	return values
+}
+
+// readingRecord is the measurements, datatypes and values of one insert: the
+// energy measurements (converted to types) and, for a 3-phase reading, its
+// phases as DOUBLE
+func readingRecord(types []client.TSDataType, data models.EnergyData) ([]string, []client.TSDataType, []interface{}) {
+	if len(data.Phases) == 0 {
+		return energyMeasurements, types, energyValues(types, data)
+	}
+
+	n := 3 * len(data.Phases)
+	measurements := slices.Concat(energyMeasurements, phaseMeasurements[:n])
+	dataTypes := slices.Grow(slices.Clone(types), n)
+	values := energyValues(types, data)
+	for _, p := range data.Phases {
+		dataTypes = append(dataTypes, client.DOUBLE, client.DOUBLE, client.DOUBLE)
+		values = append(values, p.Voltage, p.Current, p.Power)
+	}
+	return measurements, dataTypes, values
+}
+
+// resultSet is the part of *client.SessionDataSet a scanner reads, so rows
+// can be faked in tests. GetValue is nil for a NULL cell.
+type resultSet interface {
+	GetColumnNames() []string
+	Next() (bool, error)
+	GetTimestamp() int64
+	GetValue(columnName string) interface{}
+}
+
+// energyScanner reads rows of selectReadings, whatever the column types are.
+// The dataset's columns are matched to measurements by name once per query:
+// a device without e.g. a frequency timeseries gets fewer columns back. NULL
+// cells and absent columns stay 0 and are flagged in EnergyData.Missing, so
+// they are not mistaken for a measured 0. Phase columns fill
+// EnergyData.Phases up to the highest phase with a value. The samples
+// column of hourly aggregates goes to EnergyData.Samples.
+type energyScanner struct {
+	names   []string
+	columns []int // column -> index in energyMeasurements+phaseMeasurements, -1 = ignored, samplesColumn
+}
+
+const samplesColumn = -2
+
+func newEnergyScanner(columnNames []string) energyScanner {
+	columns := make([]int, len(columnNames))
+	for i, name := range columnNames {
+		measurement := name[strings.LastIndex(name, ".")+1:]
+		columns[i] = readingIndex(measurement)
+		switch {
+		case measurement == "samples":
+			columns[i] = samplesColumn
+		case columns[i] < 0 && i < len(energyMeasurements):
+			// Kolom tanpa nama path (alias), pakai posisinya
+			columns[i] = i
+		}
+	}
+	return energyScanner{names: columnNames, columns: columns}
+}
+
+// scan reads the current row of rs
+func (sc energyScanner) scan(rs resultSet) models.EnergyData {
+	var values [6]float64
+	var phases [models.MaxPhases]models.PhaseReading
+	phaseCount := 0
+	missing := models.MeasurementMask(1<<len(values) - 1)
+	var samples int64
+	for i, index := range sc.columns {
+		if index == -1 {
+			continue
+		}
+		value := rs.GetValue(sc.names[i])
+		if value == nil {
+			continue
+		}
+		if index == samplesColumn {
+			samples = int64(valueFloat(value))
+			continue
+		}
+		if index >= len(values) {
+			phase, quantity := (index-len(values))/3, (index-len(values))%3
+			switch quantity {
+			case 0:
+				phases[phase].Voltage = valueFloat(value)
+			case 1:
+				phases[phase].Current = valueFloat(value)
+			default:
+				phases[phase].Power = valueFloat(value)
+			}
+			phaseCount = max(phaseCount, phase+1)
+			continue
+		}
+		values[index] = valueFloat(value)
+		missing &^= 1 << index
+	}
+
+	data := models.EnergyData{
+		Timestamp:   rs.GetTimestamp(),
+		Voltage:     values[0],
+		Current:     values[1],
+		Power:       values[2],
+		Energy:      values[3],
+		Frequency:   values[4],
+		PowerFactor: values[5],
+		Missing:     missing,
+		Samples:     samples,
+	}
+	if phaseCount > 0 {
+		data.Phases = slices.Clone(phases[:phaseCount])
+	}
+	return data
+}
+
+// readRows scans the rows of rs into fn until fn returns false. A failing
+// Next is returned; fn has seen the rows before it.
+func readRows(rs resultSet, fn func(models.EnergyData) bool) error {
+	scanner := newEnergyScanner(rs.GetColumnNames())
+	for {
+		hasNext, err := rs.Next()
+		if err != nil || !hasNext {
+			return err
+		}
+		if !fn(scanner.scan(rs)) {
+			return nil
+		}
+	}
+}
+
+func defaultEnergyTypes() []client.TSDataType {
+	types := make([]client.TSDataType, len(energyMeasurements))
+	for i := range types {
+		types[i] = client.DOUBLE
+	}
+	return types
+}
+
+func measurementIndex(measurement string) int {
+	for i, m := range energyMeasurements {
+		if m == measurement {
+			return i
+		}
+	}
+	return -1
+}
+
+// readingIndex is the index of a measurement in energyMeasurements followed
+// by phaseMeasurements, -1 for others
+func readingIndex(measurement string) int {
+	if i := measurementIndex(measurement); i >= 0 {
+		return i
+	}
+	if i := slices.Index(phaseMeasurements, measurement); i >= 0 {
+		return len(energyMeasurements) + i
+	}
+	return -1
+}
+
+func parseDataType(name string) (client.TSDataType, bool) {
+	switch strings.ToUpper(name) {
+	case "DOUBLE":
+		return client.DOUBLE, true
+	case "FLOAT":
+		return client.FLOAT, true
+	case "INT32":
+		return client.INT32, true
+	case "INT64":
+		return client.INT64, true
+	}
+	return 0, false
+}
+
+// splitSeriesPath splits <root>.<device>.<measurement>. Paths with
+// more levels (hourly aggregates) are skipped.
+func (db *IoTDB) splitSeriesPath(path string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(path, db.root+".")
+	if !ok {
+		return "", "", false
+	}
+	dot := strings.LastIndex(rest, ".")
+	if dot < 0 {
+		return "", "", false
+	}
+
+	device, measurement := rest[:dot], rest[dot+1:]
+	if strings.HasPrefix(device, "`") && strings.HasSuffix(device, "`") {
+		return unquoteNode(device), measurement, true
+	}
+	if strings.Contains(device, ".") {
+		return "", "", false
+	}
+	return device, measurement, true
+}
+
+// unquoteNode reverses the backquoting done by devicePath
+func unquoteNode(node string) string {
+	if len(node) >= 2 && strings.HasPrefix(node, "`") && strings.HasSuffix(node, "`") {
+		return strings.ReplaceAll(node[1:len(node)-1], "``", "`")
+	}
+	return node
+}
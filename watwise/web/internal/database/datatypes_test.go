@@ -0,0 +1,255 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"wattwise/internal/models"
+
+	"github.com/apache/iotdb-client-go/client"
+)
+
+// fakeDataSet is a resultSet over rows held in memory; a nil value is a NULL
+// cell. err is returned by Next once the rows are used up.
+type fakeDataSet struct {
+	columns []string
+	times   []int64
+	rows    [][]interface{}
+	err     error
+
+	row int // 1-based current row
+}
+
+func (d *fakeDataSet) GetColumnNames() []string { return d.columns }
+
+func (d *fakeDataSet) Next() (bool, error) {
+	if d.row >= len(d.rows) {
+		return false, d.err
+	}
+	d.row++
+	return true, nil
+}
+
+func (d *fakeDataSet) GetTimestamp() int64 { return d.times[d.row-1] }
+
+func (d *fakeDataSet) GetValue(columnName string) interface{} {
+	for i, name := range d.columns {
+		if name == columnName {
+			return d.rows[d.row-1][i]
+		}
+	}
+	panic("unknown column " + columnName) // seperti client, kolom harus dari GetColumnNames
+}
+
+func (d *fakeDataSet) GetText(columnName string) string {
+	return fmt.Sprint(d.GetValue(columnName))
+}
+
+func (d *fakeDataSet) GetRowRecord() (*client.RowRecord, error) {
+	return nil, errors.New("fakeDataSet has no row records")
+}
+
+func (d *fakeDataSet) Close() error { return nil }
+
+// deviceColumns are the result columns of measurements of device A
+func deviceColumns(measurements ...string) []string {
+	columns := make([]string, len(measurements))
+	for i, m := range measurements {
+		columns[i] = "root.wattwise.A." + m
+	}
+	return columns
+}
+
+// scanAll scans every row of ds
+func scanAll(t *testing.T, ds *fakeDataSet) []models.EnergyData {
+	t.Helper()
+	var rows []models.EnergyData
+	err := readRows(ds, func(data models.EnergyData) bool {
+		rows = append(rows, data)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestScanNullFrequency(t *testing.T) {
+	ds := &fakeDataSet{
+		columns: deviceColumns(energyMeasurements...),
+		times:   []int64{3000, 2000, 1000},
+		rows: [][]interface{}{
+			{220.5, 2.0, 441.0, 1.5, 50.0, 0.95},
+			{221.0, 2.0, 442.0, 1.4, nil, 0.95}, // device tidak mengirim frequency
+			{219.5, 2.0, 439.0, 1.3, 49.9, 0.95},
+		},
+	}
+
+	rows := scanAll(t, ds)
+	if len(rows) != 3 {
+		t.Fatalf("%d rows, want 3: a NULL cell must not end the scan", len(rows))
+	}
+	for i, want := range []float64{50, 0, 49.9} {
+		if rows[i].Frequency != want {
+			t.Errorf("row %d: frequency = %v, want %v", i, rows[i].Frequency, want)
+		}
+	}
+	if rows[0].Missing != 0 || rows[2].Missing != 0 {
+		t.Errorf("missing = %b/%b for complete rows, want none", rows[0].Missing, rows[2].Missing)
+	}
+	if rows[1].Missing != models.MissingFrequency {
+		t.Errorf("missing = %b, want only frequency", rows[1].Missing)
+	}
+	if rows[1].Timestamp != 2000 || rows[1].Voltage != 221 || rows[1].Power != 442 || rows[1].Energy != 1.4 || rows[1].PowerFactor != 0.95 {
+		t.Errorf("row with NULL frequency = %+v, want its other values", rows[1])
+	}
+
+	// NULL tidak tampil sebagai 0 di JSON
+	b, err := json.Marshal(rows[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "frequency") || !strings.Contains(string(b), `"voltage":221`) {
+		t.Errorf("JSON = %s, want voltage without frequency", b)
+	}
+}
+
+func TestScanWithoutFrequencyColumn(t *testing.T) {
+	// Device yang tidak pernah mengirim frequency tidak punya timeseries-nya
+	ds := &fakeDataSet{
+		columns: deviceColumns("voltage", "current", "power", "energy", "power_factor"),
+		times:   []int64{1000},
+		rows:    [][]interface{}{{220.0, 1.0, 220.0, 0.5, 1.0}},
+	}
+
+	rows := scanAll(t, ds)
+	if len(rows) != 1 {
+		t.Fatalf("%d rows, want 1", len(rows))
+	}
+	got := rows[0]
+	if got.Voltage != 220 || got.Energy != 0.5 || got.PowerFactor != 1 || got.Frequency != 0 {
+		t.Errorf("row = %+v, want power_factor in its own field", got)
+	}
+	if got.Missing != models.MissingFrequency {
+		t.Errorf("missing = %b, want only frequency", got.Missing)
+	}
+}
+
+func TestScanColumnTypesAndOrder(t *testing.T) {
+	// Kolom dicocokkan per nama: urutan bebas, kolom lain diabaikan, dan
+	// timeseries FLOAT/INT32/INT64 lama tetap terbaca
+	ds := &fakeDataSet{
+		columns: deviceColumns("power_factor", "temperature", "energy", "power", "current", "voltage", "frequency"),
+		times:   []int64{1000},
+		rows:    [][]interface{}{{float32(0.5), 31.5, int64(12), int32(440), float32(2), 220.0, 50.0}},
+	}
+
+	rows := scanAll(t, ds)
+	want := models.EnergyData{Timestamp: 1000, Voltage: 220, Current: 2, Power: 440, Energy: 12, Frequency: 50, PowerFactor: 0.5}
+	if len(rows) != 1 || !reflect.DeepEqual(rows[0], want) {
+		t.Errorf("rows = %+v, want %+v", rows, want)
+	}
+}
+
+func TestScanPositionalAliases(t *testing.T) {
+	// Kolom agregat tanpa nama measurement memakai posisinya di selectReadings
+	ds := &fakeDataSet{
+		columns: []string{"last_value(v)", "last_value(c)", "last_value(p)", "last_value(e)", "last_value(f)", "last_value(pf)", "extra"},
+		times:   []int64{1000},
+		rows:    [][]interface{}{{230.0, 1.0, 230.0, 3.0, 50.0, 1.0, 99.0}},
+	}
+
+	rows := scanAll(t, ds)
+	want := models.EnergyData{Timestamp: 1000, Voltage: 230, Current: 1, Power: 230, Energy: 3, Frequency: 50, PowerFactor: 1}
+	if len(rows) != 1 || !reflect.DeepEqual(rows[0], want) {
+		t.Errorf("rows = %+v, want %+v", rows, want)
+	}
+}
+
+func TestScanPhasesAndSamples(t *testing.T) {
+	columns := []string{"voltage", "current", "power", "energy", "frequency", "power_factor",
+		"voltage_l1", "current_l1", "power_l1", "voltage_l2", "current_l2", "power_l2", "voltage_l3", "current_l3", "power_l3"}
+	ds := &fakeDataSet{
+		columns: append(deviceColumns(columns...), "root.wattwise.A.hourly.samples"),
+		times:   []int64{3000, 2000, 1000},
+		rows: [][]interface{}{
+			// 3 phase
+			{230.0, 3.0, 690.0, 5.0, 50.0, 1.0, 230.0, 1.0, 230.0, 231.0, 1.0, 231.0, 229.0, 1.0, 229.0, int64(60)},
+			// 1 phase: kolom L1..L3 NULL
+			{220.0, 1.0, 220.0, 4.0, 50.0, 1.0, nil, nil, nil, nil, nil, nil, nil, nil, nil, int32(12)},
+			// Hanya L2 terisi: L1 tetap ada sebagai nol
+			{220.0, 1.0, 220.0, 3.0, 50.0, 1.0, nil, nil, nil, 220.0, 1.0, 220.0, nil, nil, nil, nil},
+		},
+	}
+
+	rows := scanAll(t, ds)
+	if len(rows) != 3 {
+		t.Fatalf("%d rows, want 3", len(rows))
+	}
+	wantPhases := []models.PhaseReading{{Voltage: 230, Current: 1, Power: 230}, {Voltage: 231, Current: 1, Power: 231}, {Voltage: 229, Current: 1, Power: 229}}
+	if !reflect.DeepEqual(rows[0].Phases, wantPhases) || rows[0].Samples != 60 {
+		t.Errorf("3-phase row: phases %+v, samples %d", rows[0].Phases, rows[0].Samples)
+	}
+	if rows[1].Phases != nil || rows[1].Samples != 12 || rows[1].Missing != 0 {
+		t.Errorf("1-phase row: phases %+v, samples %d, missing %b", rows[1].Phases, rows[1].Samples, rows[1].Missing)
+	}
+	if len(rows[2].Phases) != 2 || rows[2].Phases[0] != (models.PhaseReading{}) || rows[2].Phases[1].Voltage != 220 || rows[2].Samples != 0 {
+		t.Errorf("row with only L2: phases %+v, samples %d", rows[2].Phases, rows[2].Samples)
+	}
+}
+
+func TestScanAllNull(t *testing.T) {
+	ds := &fakeDataSet{
+		columns: deviceColumns(energyMeasurements...),
+		times:   []int64{1000},
+		rows:    [][]interface{}{{nil, nil, nil, nil, nil, nil}},
+	}
+
+	rows := scanAll(t, ds)
+	want := models.MissingVoltage | models.MissingCurrent | models.MissingPower | models.MissingEnergy | models.MissingFrequency | models.MissingPowerFactor
+	if len(rows) != 1 || rows[0].Missing != want || rows[0].Timestamp != 1000 {
+		t.Errorf("rows = %+v, want every measurement missing", rows)
+	}
+}
+
+func TestReadRows(t *testing.T) {
+	newDataSet := func(err error) *fakeDataSet {
+		return &fakeDataSet{
+			columns: deviceColumns("power"),
+			times:   []int64{3000, 2000, 1000},
+			rows:    [][]interface{}{{3.0}, {2.0}, {1.0}},
+			err:     err,
+		}
+	}
+	collect := func(ds *fakeDataSet, stopAfter int) ([]float64, error) {
+		var powers []float64
+		err := readRows(ds, func(data models.EnergyData) bool {
+			powers = append(powers, data.Power)
+			return len(powers) < stopAfter
+		})
+		return powers, err
+	}
+
+	// Next yang gagal dikembalikan, baris sebelumnya sudah sampai ke fn
+	failed := errors.New("connection reset")
+	powers, err := collect(newDataSet(failed), 10)
+	if !errors.Is(err, failed) || !reflect.DeepEqual(powers, []float64{3, 2, 1}) {
+		t.Errorf("failing Next: %v, %v; want all 3 rows then the error", powers, err)
+	}
+
+	// fn bisa berhenti lebih awal tanpa membaca baris berikutnya
+	ds := newDataSet(failed)
+	powers, err = collect(ds, 2)
+	if err != nil || !reflect.DeepEqual(powers, []float64{3, 2}) || ds.row != 2 {
+		t.Errorf("stopped after 2: %v, %v, read %d rows", powers, err, ds.row)
+	}
+
+	// Tanpa baris sama sekali
+	powers, err = collect(&fakeDataSet{columns: deviceColumns("power")}, 10)
+	if err != nil || powers != nil {
+		t.Errorf("empty dataset: %v, %v", powers, err)
+	}
+}
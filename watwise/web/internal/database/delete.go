@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidTimeRange is returned when a delete is requested without an
+// explicit, ordered time range. Deletes are never run unbounded.
+var ErrInvalidTimeRange = errors.New("an explicit time range is required (start_time <= end_time, both > 0)")
+
+// DeleteDataByTimeRange deletes one device's readings (raw and hourly
+// aggregates) with startMs <= time <= endMs.
+// It returns the number of timeseries the delete was applied to.
+func (db *IoTDB) DeleteDataByTimeRange(ctx context.Context, deviceID string, startMs, endMs int64) (int, error) {
+	if deviceID == "" || startMs <= 0 || endMs <= 0 || startMs > endMs {
+		return 0, ErrInvalidTimeRange
+	}
+	if !db.IsEnabled() {
+		return 0, errNotConnected
+	}
+
+	// Selalu dibatasi ke satu device, tidak pernah <root>.**
+	pattern := db.DeviceDataPattern(deviceID)
+	statement := fmt.Sprintf("DELETE FROM %s WHERE time >= %d AND time <= %d", pattern, startMs, endMs)
+
+	return db.deleteSeries(ctx, pattern, statement)
+}
+
+// DeleteDataBefore deletes readings of every device older than cutoffMs.
+// Used by the retention job.
+func (db *IoTDB) DeleteDataBefore(ctx context.Context, cutoffMs int64) (int, error) {
+	if cutoffMs <= 0 {
+		return 0, ErrInvalidTimeRange
+	}
+	if !db.IsEnabled() {
+		return 0, errNotConnected
+	}
+
+	pattern := db.root + ".**"
+	statement := fmt.Sprintf("DELETE FROM %s WHERE time < %d", pattern, cutoffMs)
+
+	return db.deleteSeries(ctx, pattern, statement)
+}
+
+func (db *IoTDB) deleteSeries(ctx context.Context, pattern, statement string) (int, error) {
+	var series int
+
+	err := db.withSession(ctx, func(session session) error {
+		count, err := countTimeseries(session, pattern)
+		if err != nil {
+			return err
+		}
+
+		if _, err := session.ExecuteStatement(statement); err != nil {
+			return err
+		}
+		series = count
+		return nil
+	})
+	if err != nil {
+		db.logger.Error("delete failed", "statement", statement, "error", err)
+		return 0, err
+	}
+
+	db.logger.Info("deleted data", "statement", statement, "series", series)
+	return series, nil
+}
+
+// countTimeseries returns how many timeseries match pattern
+func countTimeseries(session session, pattern string) (int, error) {
+	dataSet, err := session.ExecuteQueryStatement("SHOW TIMESERIES "+pattern, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer dataSet.Close()
+
+	count := 0
+	for {
+		hasNext, err := dataSet.Next()
+		if err != nil {
+			return count, err
+		}
+		if !hasNext {
+			return count, nil
+		}
+		count++
+	}
+}
@@ -0,0 +1,336 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/apache/iotdb-client-go/client"
+)
+
+// Raw readings older than IOTDB_DOWNSAMPLE_AFTER_DAYS are replaced by hourly
+// aggregates under <root>.<device>.hourly.<measurement>. Averages are
+// stored under the raw measurement names (energy keeps the last meter value of
+// the hour), so readers can treat an hourly row like a reading; L1..L3 phase
+// series are averaged the same way. Afterwards only the raw series that were
+// aggregated are deleted, forecasts stay.
+const (
+	hourlyNode        = "hourly"
+	hourMs            = int64(time.Hour / time.Millisecond)
+	downsampleChunkMs = 7 * 24 * hourMs
+)
+
+// hourlyMeasurements are the hourly series of every device; 3-phase devices
+// also get the phase measurements (see ensurePhaseSchema)
+var hourlyMeasurements = []string{
+	"voltage", "current", "power", "energy", "frequency", "power_factor",
+	"power_max", "power_min", "samples",
+}
+
+// hourlyAggregate is one column of the downsampling query: function of the
+// raw measurement, stored in the hourly series of the same name as the alias
+type hourlyAggregate struct {
+	function, raw, hourly string
+}
+
+// hourlyAggregates lists the columns downsampleChunk selects. IoTDB leaves
+// out the columns of series a device does not have (frequency, phases), so
+// they are matched by alias.
+var hourlyAggregates = func() []hourlyAggregate {
+	aggregates := []hourlyAggregate{
+		{"avg", "voltage", "voltage"},
+		{"avg", "current", "current"},
+		{"avg", "power", "power"},
+		{"last_value", "energy", "energy"},
+		{"avg", "frequency", "frequency"},
+		{"avg", "power_factor", "power_factor"},
+		{"max_value", "power", "power_max"},
+		{"min_value", "power", "power_min"},
+		{"count", "power", "samples"},
+	}
+	for _, m := range phaseMeasurements {
+		aggregates = append(aggregates, hourlyAggregate{"avg", m, m})
+	}
+	return aggregates
+}()
+
+func (db *IoTDB) hourlyPath(deviceID string) string {
+	return db.devicePath(deviceID) + "." + hourlyNode
+}
+
+// downsampleCutoff returns the time before which raw data has been (or will
+// be) downsampled, aligned to the hour. Zero when downsampling is off.
+func (db *IoTDB) downsampleCutoff(now time.Time) int64 {
+	if db.config.DownsampleAfterDays <= 0 {
+		return 0
+	}
+	cutoff := now.AddDate(0, 0, -db.config.DownsampleAfterDays).UnixMilli()
+	return cutoff - cutoff%hourMs
+}
+
+// readsHourly reports whether a range starting at startTime reaches into
+// downsampled data
+func (db *IoTDB) readsHourly(startTime int64) bool {
+	cutoff := db.downsampleCutoff(time.Now())
+	return cutoff > 0 && startTime < cutoff
+}
+
+// ListDeviceIDs returns the ids of all devices that have data in IoTDB
+func (db *IoTDB) ListDeviceIDs(ctx context.Context) ([]string, error) {
+	if !db.IsEnabled() {
+		return nil, errNotConnected
+	}
+
+	var ids []string
+	err := db.withSession(ctx, func(session session) error {
+		ids = nil
+
+		dataSet, err := session.ExecuteQueryStatement("SHOW DEVICES "+db.root+".*", nil)
+		if err != nil {
+			return err
+		}
+		defer dataSet.Close()
+
+		for {
+			hasNext, err := dataSet.Next()
+			if err != nil {
+				return err
+			}
+			if !hasNext {
+				return nil
+			}
+
+			id := strings.TrimPrefix(dataSet.GetText("Device"), db.root+".")
+			ids = append(ids, unquoteNode(id))
+		}
+	})
+	return ids, err
+}
+
+// DownsampleBefore aggregates a device's raw readings older than cutoffMs
+// (rounded down to the hour) into hourly rows, then deletes those raw points
+// of the aggregated measurements.
+// It returns the number of hourly rows written.
+func (db *IoTDB) DownsampleBefore(ctx context.Context, deviceID string, cutoffMs int64) (int, error) {
+	if !db.IsEnabled() {
+		return 0, errNotConnected
+	}
+	cutoffMs -= cutoffMs % hourMs
+	if cutoffMs <= 0 {
+		return 0, ErrInvalidTimeRange
+	}
+
+	earliest, err := db.earliestRawBefore(ctx, deviceID, cutoffMs)
+	if err != nil || earliest < 0 {
+		return 0, err
+	}
+
+	rows := 0
+	aggregated := make(map[string]bool)
+	for from := earliest - earliest%hourMs; from < cutoffMs; from += downsampleChunkMs {
+		to := from + downsampleChunkMs
+		if to > cutoffMs {
+			to = cutoffMs
+		}
+
+		n, err := db.downsampleChunk(ctx, deviceID, from, to, aggregated)
+		if err != nil {
+			return rows, err
+		}
+		rows += n
+	}
+
+	// Raw data baru dihapus setelah semua aggregate tersimpan, dan hanya
+	// series yang ikut di-aggregate
+	statement := db.downsampleDelete(deviceID, aggregated, cutoffMs)
+	if statement == "" {
+		return rows, nil
+	}
+	err = db.withSession(ctx, func(session session) error {
+		_, err := session.ExecuteStatement(statement)
+		return err
+	})
+	if err != nil {
+		return rows, err
+	}
+
+	db.logger.Info("downsampled raw data",
+		"device_id", deviceID,
+		"from", time.UnixMilli(earliest),
+		"cutoff", time.UnixMilli(cutoffMs),
+		"hourly_rows", rows)
+	return rows, nil
+}
+
+// downsampleDelete deletes the raw points < cutoffMs of the aggregated raw
+// measurements and nothing else of the device; "" when none were
+func (db *IoTDB) downsampleDelete(deviceID string, aggregated map[string]bool, cutoffMs int64) string {
+	var paths []string
+	for _, m := range slices.Concat(energyMeasurements, phaseMeasurements) {
+		if aggregated[m] {
+			paths = append(paths, db.devicePath(deviceID)+"."+m)
+		}
+	}
+	if len(paths) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("DELETE FROM %s WHERE time < %d", strings.Join(paths, ", "), cutoffMs)
+}
+
+// earliestRawBefore returns the oldest raw timestamp < cutoffMs, or -1 if none
+func (db *IoTDB) earliestRawBefore(ctx context.Context, deviceID string, cutoffMs int64) (int64, error) {
+	query := fmt.Sprintf("SELECT power FROM %s WHERE time < %d ORDER BY time ASC LIMIT 1", db.devicePath(deviceID), cutoffMs)
+
+	earliest := int64(-1)
+	err := db.withSession(ctx, func(session session) error {
+		dataSet, err := session.ExecuteQueryStatement(query, nil)
+		if err != nil {
+			return err
+		}
+		defer dataSet.Close()
+
+		hasNext, err := dataSet.Next()
+		if err != nil {
+			return err
+		}
+		if hasNext {
+			earliest = dataSet.GetTimestamp()
+		}
+		return nil
+	})
+	return earliest, err
+}
+
+// downsampleChunk aggregates [fromMs, toMs) and writes the non-empty hours.
+// The raw measurements that had values are added to aggregated.
+func (db *IoTDB) downsampleChunk(ctx context.Context, deviceID string, fromMs, toMs int64, aggregated map[string]bool) (int, error) {
+	columns := make([]string, len(hourlyAggregates))
+	for i, a := range hourlyAggregates {
+		columns[i] = fmt.Sprintf("%s(%s) AS %s", a.function, a.raw, a.hourly)
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s GROUP BY ([%d, %d), 1h)", strings.Join(columns, ", "), db.devicePath(deviceID), fromMs, toMs)
+
+	var rows hourlyRows
+	err := db.withSession(ctx, func(session session) error {
+		dataSet, err := session.ExecuteQueryStatement(query, nil)
+		if err != nil {
+			return err
+		}
+		defer dataSet.Close()
+
+		rows, err = readHourlyRows(dataSet)
+		if err != nil || len(rows.timestamps) == 0 {
+			return err
+		}
+
+		db.ensureDeviceSchema(session, deviceID)
+		if rows.phases {
+			db.ensurePhaseSchema(session, deviceID)
+		}
+
+		status, err := session.InsertRecordsOfOneDevice(db.hourlyPath(deviceID), rows.timestamps, rows.measurements, rows.dataTypes, rows.values, true)
+		if err != nil {
+			return err
+		}
+		if status != nil && status.GetCode() != 200 {
+			return fmt.Errorf("hourly insert returned status %d", status.GetCode())
+		}
+		return nil
+	})
+	if err != nil {
+		db.logger.Error("downsample chunk failed", "device_id", deviceID, "from", fromMs, "to", toMs, "error", err)
+		return 0, err
+	}
+
+	for raw := range rows.aggregated {
+		aggregated[raw] = true
+	}
+	return len(rows.timestamps), nil
+}
+
+// hourlyRows are the records of one downsampled chunk, one per hour with
+// readings. Each row has only the measurements that had a value.
+type hourlyRows struct {
+	timestamps   []int64
+	measurements [][]string
+	dataTypes    [][]client.TSDataType
+	values       [][]interface{}
+
+	aggregated map[string]bool // raw measurements with a value
+	phases     bool
+}
+
+// readHourlyRows reads the result of the downsampling query; hours without
+// readings (count 0) are skipped
+func readHourlyRows(rs resultSet) (hourlyRows, error) {
+	rows := hourlyRows{aggregated: make(map[string]bool)}
+	var present []hourlyAggregate
+	for _, name := range rs.GetColumnNames() {
+		for _, a := range hourlyAggregates {
+			if a.hourly == name {
+				present = append(present, a)
+			}
+		}
+	}
+
+	for {
+		hasNext, err := rs.Next()
+		if err != nil || !hasNext {
+			return rows, err
+		}
+		if samples := valueFloat(rs.GetValue("samples")); samples == 0 {
+			continue // jam tanpa data
+		}
+
+		var (
+			measurements []string
+			dataTypes    []client.TSDataType
+			values       []interface{}
+		)
+		for _, a := range present {
+			value := rs.GetValue(a.hourly)
+			if value == nil {
+				continue
+			}
+			measurements = append(measurements, a.hourly)
+			if a.hourly == "samples" {
+				dataTypes = append(dataTypes, client.INT64)
+				values = append(values, int64(valueFloat(value)))
+			} else {
+				dataTypes = append(dataTypes, client.DOUBLE)
+				values = append(values, valueFloat(value))
+			}
+			rows.aggregated[a.raw] = true
+			if slices.Contains(phaseMeasurements, a.raw) {
+				rows.phases = true
+			}
+		}
+
+		rows.timestamps = append(rows.timestamps, rs.GetTimestamp())
+		rows.measurements = append(rows.measurements, measurements)
+		rows.dataTypes = append(rows.dataTypes, dataTypes)
+		rows.values = append(rows.values, values)
+	}
+}
+
+// fieldFloat converts a numeric aggregate field to float64 (0 when null)
+func fieldFloat(f *client.Field) float64 {
+	return valueFloat(f.GetValue())
+}
+
+// valueFloat converts a numeric cell to float64 (0 when nil)
+func valueFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case int32:
+		return float64(v)
+	}
+	return 0
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"wattwise/internal/config"
+
+	"github.com/apache/iotdb-client-go/client"
+)
+
+// aggregateColumns are the result columns of the downsampling query for a
+// device with the given raw measurements
+func aggregateColumns(raw ...string) []string {
+	var columns []string
+	for _, a := range hourlyAggregates {
+		for _, m := range raw {
+			if a.raw == m {
+				columns = append(columns, a.hourly)
+			}
+		}
+	}
+	return columns
+}
+
+func TestReadHourlyRowsWithoutFrequency(t *testing.T) {
+	// Device tanpa timeseries frequency: kolomnya tidak ada sama sekali
+	ds := &fakeDataSet{
+		columns: aggregateColumns("voltage", "current", "power", "energy", "power_factor"),
+		times:   []int64{0, hourMs, 2 * hourMs},
+		rows: [][]interface{}{
+			// voltage, current, power, energy, power_factor, power_max, power_min, samples
+			{220.0, 1.0, 220.0, 5.0, 0.9, 300.0, 100.0, int64(60)},
+			{nil, nil, nil, nil, nil, nil, nil, int64(0)}, // jam tanpa data
+			{221.0, 1.0, 221.0, float32(5.5), nil, 250.0, 150.0, int64(30)},
+		},
+	}
+
+	rows, err := readHourlyRows(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rows.timestamps, []int64{0, 2 * hourMs}) {
+		t.Fatalf("timestamps = %v, want the two hours with readings", rows.timestamps)
+	}
+	want := []string{"voltage", "current", "power", "energy", "power_factor", "power_max", "power_min", "samples"}
+	if !reflect.DeepEqual(rows.measurements[0], want) {
+		t.Errorf("measurements = %v, want %v", rows.measurements[0], want)
+	}
+	if got := rows.measurements[1]; len(got) != len(want)-1 || rows.values[1][3] != 5.5 {
+		t.Errorf("hour with NULL power_factor: %v = %v", got, rows.values[1])
+	}
+	if last := len(want) - 1; rows.dataTypes[0][last] != client.INT64 || rows.values[0][last] != int64(60) || rows.dataTypes[0][0] != client.DOUBLE {
+		t.Errorf("types = %v, values = %v, want DOUBLE and INT64 samples", rows.dataTypes[0], rows.values[0])
+	}
+	wantAggregated := map[string]bool{"voltage": true, "current": true, "power": true, "energy": true, "power_factor": true}
+	if !reflect.DeepEqual(rows.aggregated, wantAggregated) || rows.phases {
+		t.Errorf("aggregated = %v (phases %v), want %v", rows.aggregated, rows.phases, wantAggregated)
+	}
+}
+
+func TestReadHourlyRowsPhases(t *testing.T) {
+	raw := append([]string{"voltage", "current", "power", "energy", "frequency", "power_factor"}, phaseMeasurements...)
+	row := func(phases ...interface{}) []interface{} {
+		return append([]interface{}{230.0, 3.0, 690.0, 9.0, 50.0, 1.0, 700.0, 680.0, int64(60)}, phases...)
+	}
+	ds := &fakeDataSet{
+		columns: aggregateColumns(raw...),
+		times:   []int64{0, hourMs},
+		rows: [][]interface{}{
+			row(230.0, 1.0, 230.0, 231.0, 1.0, 231.0, 229.0, 1.0, 229.0),
+			// Jam dengan reading 1-phase saja
+			row(nil, nil, nil, nil, nil, nil, nil, nil, nil),
+		},
+	}
+
+	rows, err := readHourlyRows(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows.measurements) != 2 || len(rows.measurements[0]) != 18 || len(rows.measurements[1]) != 9 {
+		t.Fatalf("measurements = %v", rows.measurements)
+	}
+	if rows.measurements[0][9] != "voltage_l1" || rows.values[0][17] != 229.0 {
+		t.Errorf("phase values = %v: %v", rows.measurements[0][9:], rows.values[0][9:])
+	}
+	if !rows.phases || !rows.aggregated["power_l3"] || len(rows.aggregated) != len(raw) {
+		t.Errorf("aggregated = %v (phases %v), want every raw measurement", rows.aggregated, rows.phases)
+	}
+}
+
+func TestDownsampleDelete(t *testing.T) {
+	db := NewIoTDB(config.IoTDBConfig{}, discardLogger())
+	tests := []struct {
+		name       string
+		aggregated map[string]bool
+		want       string
+	}{
+		{
+			name:       "totals only",
+			aggregated: map[string]bool{"power": true, "voltage": true, "energy": true},
+			want:       "DELETE FROM root.wattwise.`ESP32-01`.voltage, root.wattwise.`ESP32-01`.power, root.wattwise.`ESP32-01`.energy WHERE time < 3600000",
+		},
+		{
+			name:       "with phases",
+			aggregated: map[string]bool{"power": true, "power_l1": true, "current_l2": true},
+			want:       "DELETE FROM root.wattwise.`ESP32-01`.power, root.wattwise.`ESP32-01`.power_l1, root.wattwise.`ESP32-01`.current_l2 WHERE time < 3600000",
+		},
+		{name: "nothing aggregated", aggregated: map[string]bool{}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Forecast dan series lain device tidak pernah ikut dihapus
+			if got := db.downsampleDelete("ESP32-01", tt.aggregated, hourMs); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,14 @@
 package database
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"wattwise/internal/config"
 	"wattwise/internal/models"
@@ -10,349 +16,540 @@ import (
 	"github.com/apache/iotdb-client-go/client"
 )
 
+var errNotConnected = errors.New("IoTDB not connected")
+
+// ErrQueryTimeout is returned when an operation did not finish within
+// IOTDB_QUERY_TIMEOUT (or the caller's deadline). Handlers answer 504.
+var ErrQueryTimeout = errors.New("IoTDB query timed out")
+
+// IoTDB is shared by the MQTT goroutine, HTTP handlers, the retention job and
+// the reconnection manager. Sessions are never shared: every operation borrows
+// its own session from the pool via withSession, so queries and inserts do not
+// interleave on one TCP connection. mu only protects swapping the pool and the
+// connection state; it is not held while a statement runs.
 type IoTDB struct {
-	session *client.Session
-	config 	config.IoTDBConfig
+	pool    *sessionPool
+	config  config.IoTDBConfig
 	enabled bool
+	logger  *slog.Logger
+
+	// Storage group of all data, IOTDB_ROOT_PATH (DefaultRootPath)
+	root string
+
+	// Device yang timeseries-nya sudah dibuat
+	knownDevices sync.Map
+	// Device yang timeseries rollup-nya sudah dibuat, see rollup.go
+	knownRollups sync.Map
+	// Device 3-phase yang timeseries L1..L3-nya sudah dibuat
+	knownPhases sync.Map
+	// deviceID -> []client.TSDataType of energyMeasurements, see datatypes.go
+	seriesTypes sync.Map
+
+	// Unix ms of the last successful operation, for health checks
+	lastSuccess atomic.Int64
+
+	// mu guards pool/enabled and the reconnection state below
+	mu           sync.RWMutex
+	reconnecting bool
+	closed       bool
+	attempts     int
+	lastError    string
+	lastErrorAt  time.Time
+	nextRetryAt  time.Time
+	stop         chan struct{}
+
+	// Last mode passed to onModeChange, see mode.go
+	lastMode     string
+	onModeChange func(mode string)
+
+	// Generated readings served while not connected (dummy mode)
+	dummy *MemoryStore
 }
 
-func NewIoTDB(cfg config.IoTDBConfig) *IoTDB {
+func NewIoTDB(cfg config.IoTDBConfig, logger *slog.Logger) *IoTDB {
+	root := strings.TrimSuffix(strings.TrimSpace(cfg.RootPath), ".")
+	if root == "" {
+		root = DefaultRootPath
+	}
 	return &IoTDB{
-		config: 	cfg,
+		config:  cfg,
 		enabled: false,
+		logger:  logger.With("component", "iotdb", "root", root),
+		root:    root,
+		stop:    make(chan struct{}),
+
+		lastMode: ModeDummy,
+		dummy:    newDummyStore(),
 	}
 }
 
+// RootPath is the storage group all device data lives under
+func (db *IoTDB) RootPath() string {
+	return db.root
+}
+
 func (db *IoTDB) Connect() error {
-	cfg := &client.Config{
-		Host: 	 db.config.Host,
-		Port: 	 db.config.Port,
-		UserName: db.config.Username,
-		Password: db.config.Password,
-	}
+	pool := newSessionPool(db.config)
 
-	session := client.NewSession(cfg)
-	if err := session.Open(false, 0); err != nil {
+	// Dial satu session di awal supaya error koneksi langsung kelihatan
+	session, err := pool.acquire()
+	if err != nil {
+		pool.close()
+		db.mu.Lock()
+		db.recordError(err)
+		db.mu.Unlock()
 		return err
 	}
-
-	db.session = &session
+	// Server bisa saja baru (data hilang), jadi schema dicek ulang
+	db.knownDevices.Range(func(key, _ any) bool {
+		db.knownDevices.Delete(key)
+		return true
+	})
+	db.knownRollups.Range(func(key, _ any) bool {
+		db.knownRollups.Delete(key)
+		return true
+	})
+	db.knownPhases.Range(func(key, _ any) bool {
+		db.knownPhases.Delete(key)
+		return true
+	})
+	db.checkSchema(session)
+	pool.release(session, nil)
+
+	db.mu.Lock()
+	if db.closed {
+		// Close() ran while we were dialing
+		db.mu.Unlock()
+		pool.close()
+		return errNotConnected
+	}
+	oldPool := db.pool
+	db.pool = pool
 	db.enabled = true
-	db.initSchema()
+	db.mu.Unlock()
+	db.lastSuccess.Store(time.Now().UnixMilli())
+
+	if oldPool != nil {
+		oldPool.close()
+	}
+	db.modeChanged()
 	return nil
 }
 
 func (db *IoTDB) Close() {
-	if db.enabled && db.session != nil {
-		(*db.session).Close()
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return
+	}
+	db.closed = true
+	close(db.stop)
+	pool := db.pool
+	db.mu.Unlock()
+
+	if pool != nil {
+		pool.close()
+	}
+}
+
+// withSession runs fn on a session borrowed from the pool. If fn (or the
+// acquire) fails with a connection-level error the broken session is dropped
+// and fn is retried on a fresh one with exponential backoff, up to
+// IOTDB_MAX_RETRIES attempts. When the retries run out the database switches
+// to dummy mode, the reconnection manager takes over and a *TransientError is
+// returned. fn must therefore be safe to run more than once.
+//
+// The whole operation, retries included, is bounded by ctx and
+// IOTDB_QUERY_TIMEOUT; see trySession for what happens to a query that does
+// not finish in time.
+func (db *IoTDB) withSession(ctx context.Context, fn func(session session) error) error {
+	ctx, cancel := db.queryContext(ctx)
+	defer cancel()
+
+	maxAttempts := db.maxRetries()
+	backoff := retryInitialBackoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = db.trySession(ctx, fn)
+		if err == nil {
+			db.lastSuccess.Store(time.Now().UnixMilli())
+			return nil
+		}
+		if !retryable(err) {
+			return err
+		}
+
+		if attempt >= maxAttempts {
+			break
+		}
+
+		db.logger.Warn("IoTDB operation failed, retrying",
+			"attempt", attempt,
+			"max_attempts", maxAttempts,
+			"in", backoff,
+			"error", err)
+
+		select {
+		case <-time.After(backoff):
+		case <-db.stop:
+			return &TransientError{Attempts: attempt, Err: err}
+		case <-ctx.Done():
+			return abandoned(ctx)
+		}
+
+		backoff *= 2
+		if backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+	}
+
+	// Pool habis (semua session dipakai) bukan berarti server down
+	if err != errNotConnected && !isPoolTimeout(err) {
+		db.markConnectionLost(err)
 	}
+	return &TransientError{Attempts: maxAttempts, Err: err}
+}
+
+// trySession is a single attempt of withSession. The session calls block
+// without a deadline, so acquire and fn run in their own goroutine and
+// trySession returns as soon as ctx is done. The abandoned goroutine finishes
+// on its own; its session is then closed instead of going back to the pool,
+// since a hung connection must not be handed to the next caller.
+func (db *IoTDB) trySession(ctx context.Context, fn func(session session) error) error {
+	db.mu.RLock()
+	pool := db.pool
+	db.mu.RUnlock()
+	if pool == nil {
+		return errNotConnected
+	}
+	if ctx.Err() != nil {
+		return abandoned(ctx)
+	}
+
+	var gaveUp atomic.Bool
+	result := make(chan error, 1)
+	go func() {
+		session, err := pool.acquire()
+		if err != nil {
+			result <- err
+			return
+		}
+		if ctx.Err() != nil {
+			err = abandoned(ctx)
+		} else {
+			err = fn(session)
+		}
+		if gaveUp.Load() {
+			pool.discard(session)
+		} else {
+			pool.release(session, err)
+		}
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		gaveUp.Store(true)
+		return abandoned(ctx)
+	}
+}
+
+// queryContext applies IOTDB_QUERY_TIMEOUT to ctx, unless ctx already has an
+// earlier deadline
+func (db *IoTDB) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if db.config.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, db.config.QueryTimeout)
+}
+
+// abandoned is the error for an operation given up because ctx is done:
+// ErrQueryTimeout for a deadline, context.Canceled as-is
+func abandoned(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrQueryTimeout, ctx.Err())
+	}
+	return ctx.Err()
 }
 
 func (db *IoTDB) IsEnabled() bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
 	return db.enabled
 }
 
-func (db *IoTDB) initSchema() {
-    log.Println("🔧 Initializing IoTDB schema...")
-    
-    storageGroupCmd := "CREATE STORAGE GROUP root.wattwise"
-    log.Printf("   Executing: %s", storageGroupCmd)
-    _, err := (*db.session).ExecuteStatement(storageGroupCmd)
-    if err != nil {
-        log.Printf("⚠️ Error creating storage group: %v", err)
-    }
-
-    timeseries := []string{
-        "CREATE TIMESERIES root.wattwise.voltage WITH DATATYPE=DOUBLE, ENCODING=GORILLA, COMPRESSOR=LZ4",
-        "CREATE TIMESERIES root.wattwise.current WITH DATATYPE=DOUBLE, ENCODING=GORILLA, COMPRESSOR=LZ4",
-        "CREATE TIMESERIES root.wattwise.power WITH DATATYPE=DOUBLE, ENCODING=GORILLA, COMPRESSOR=LZ4",
-        "CREATE TIMESERIES root.wattwise.energy WITH DATATYPE=DOUBLE, ENCODING=GORILLA, COMPRESSOR=LZ4",
-        "CREATE TIMESERIES root.wattwise.frequency WITH DATATYPE=DOUBLE, ENCODING=GORILLA, COMPRESSOR=LZ4",
-        "CREATE TIMESERIES root.wattwise.power_factor WITH DATATYPE=DOUBLE, ENCODING=GORILLA, COMPRESSOR=LZ4",
-        "CREATE TIMESERIES root.wattwise.prediction WITH DATATYPE=FLOAT, ENCODING=RLE, COMPRESSOR=SNAPPY",
-    }
-
-    for _, ts := range timeseries {
-        log.Printf("   Executing: %s", ts)
-        _, err := (*db.session).ExecuteStatement(ts)
-        if err != nil {
-            log.Printf("⚠️ Info creating timeseries: %v (mungkin sudah ada)", err)
-        }
-    }
-
-    log.Println("✅ IoTDB schema initialized!")
+// createDeviceSchema creates the timeseries for one device. Errors are
+// expected when the series already exist (mungkin sudah ada).
+func (db *IoTDB) createDeviceSchema(session session, deviceID string) {
+	for _, spec := range db.deviceSeries() {
+		ts := spec.create(db.devicePath(deviceID))
+		if _, err := session.ExecuteStatement(ts); err != nil {
+			db.logger.Debug("create timeseries", "statement", ts, "error", err)
+		}
+	}
+
+	db.knownDevices.Store(deviceID, true)
+}
+
+// ensureDeviceSchema creates the device's timeseries the first time it is
+// written to, so new devices get the same encodings as the default one.
+func (db *IoTDB) ensureDeviceSchema(session session, deviceID string) {
+	if _, ok := db.knownDevices.Load(deviceID); ok {
+		return
+	}
+	db.createDeviceSchema(session, deviceID)
+}
+
+// ensurePhaseSchema creates the L1..L3 timeseries (and, with downsampling on,
+// their hourly series) the first time a device sends a 3-phase reading
+func (db *IoTDB) ensurePhaseSchema(session session, deviceID string) {
+	if _, ok := db.knownPhases.Load(deviceID); ok {
+		return
+	}
+	specs := phaseSeries()
+	if db.config.DownsampleAfterDays > 0 {
+		for _, spec := range phaseSeries() {
+			spec.measurement = hourlyNode + "." + spec.measurement
+			specs = append(specs, spec)
+		}
+	}
+	for _, spec := range specs {
+		ts := spec.create(db.devicePath(deviceID))
+		if _, err := session.ExecuteStatement(ts); err != nil {
+			db.logger.Debug("create timeseries", "statement", ts, "error", err)
+		}
+	}
+	db.knownPhases.Store(deviceID, true)
 }
 
 // ✅ FIXED: GetLatestData - properly handle ALL data requests
-func (db *IoTDB) GetLatestData(limit int) ([]models.EnergyData, error) {
-	if !db.enabled {
-		log.Println("⚠️ IoTDB disabled, returning dummy data.")
-		return db.getDummyData(limit), nil
-	}
-
-	// ✅ Handle different limit scenarios
-	var query string
-	
-	if limit <= 0 {
-		// limit=0 or negative means fetch ALL data without limit
-		log.Printf("📊 Fetching ALL records from IoTDB (no limit)")
-		query = `SELECT voltage, current, power, energy, frequency, power_factor FROM root.wattwise ORDER BY time DESC`
-	} else if limit >= 1000000 {
-		// Very large limit (>= 1M), treat as "fetch all"
-		log.Printf("📊 Large limit detected (%d), fetching ALL records", limit)
-		query = `SELECT voltage, current, power, energy, frequency, power_factor FROM root.wattwise ORDER BY time DESC`
-	} else {
-		// Normal query with specific limit
-		log.Printf("📊 Fetching latest %d records from IoTDB", limit)
-		query = fmt.Sprintf(`SELECT voltage, current, power, energy, frequency, power_factor FROM root.wattwise ORDER BY time DESC LIMIT %d`, limit)
-	}
-	
-	log.Printf("🔍 Executing query: %s", query)
-	
-	sessionDataSet, err := (*db.session).ExecuteQueryStatement(query, nil)
-	if err != nil {
-		log.Printf("❌ Query error: %v", err)
-		return nil, fmt.Errorf("query failed: %w", err)
+func (db *IoTDB) GetLatestData(ctx context.Context, deviceID string, limit int) ([]models.EnergyData, error) {
+	if !db.IsEnabled() {
+		if err := db.dummyAllowed(); err != nil {
+			return nil, err
+		}
+		db.logger.Debug("disabled, returning dummy data", "limit", limit)
+		return db.dummy.GetLatestData(ctx, deviceID, limit)
 	}
-	defer sessionDataSet.Close()
+
+	query := db.latestQuery(deviceID, limit)
+
+	db.logger.Debug("executing query", "query", query)
 
 	var dataList []models.EnergyData
 	recordCount := 0
 
-	log.Printf("📥 Processing query results...")
-	
-	for {
-		hasNext, err := sessionDataSet.Next()
-		if err != nil {
-			log.Printf("❌ Error during dataset iteration: %v", err)
-			break
-		}
-		if !hasNext {
-			break
-		}
-		
-		ts := sessionDataSet.GetTimestamp()
-
-		data := models.EnergyData{
-			Timestamp:   ts,
-			Voltage:     float64(sessionDataSet.GetDouble("voltage")),
-			Current:     float64(sessionDataSet.GetDouble("current")),
-			Power:       float64(sessionDataSet.GetDouble("power")),
-			Energy:      float64(sessionDataSet.GetDouble("energy")),
-			Frequency:   float64(sessionDataSet.GetDouble("frequency")),
-			PowerFactor: float64(sessionDataSet.GetDouble("power_factor")),
-		}
+	err := db.withSession(ctx, func(session session) error {
+		dataList = nil
+		recordCount = 0
 
-		dataList = append(dataList, data)
-		recordCount++
-		
-		// Progress indicator for large datasets
-		if recordCount%1000 == 0 {
-			log.Printf("   📥 Processed %d records...", recordCount)
-		}
-		
-		// Safety check: prevent OOM for extremely large datasets
-		if limit > 0 && recordCount >= 1000000 {
-			log.Printf("⚠️ Reached safety limit of 1M records, stopping fetch")
-			break
+		sessionDataSet, err := session.ExecuteQueryStatement(query, nil)
+		if err != nil {
+			return err
 		}
+		defer sessionDataSet.Close()
+
+		// Cell NULL (mis. device tanpa frequency) hanya ditandai Missing,
+		// baris lain tetap dibaca
+		err = readRows(sessionDataSet, func(data models.EnergyData) bool {
+			dataList = append(dataList, data)
+			recordCount++
+
+			// Safety check: prevent OOM for extremely large datasets
+			if limit > 0 && recordCount >= 1000000 {
+				db.logger.Warn("reached safety limit of 1M records, stopping fetch")
+				return false
+			}
+			return true
+		})
+		// Hasil setengah terbaca bukan sukses: withSession membuang session
+		// yang rusak dan mengulang query dari awal
+		return err
+	})
+	if err != nil {
+		db.logger.Error("query failed", "query", query, "error", err)
+		return nil, fmt.Errorf("query failed: %w", err)
 	}
 
-	log.Printf("✅ Retrieved %d records from IoTDB", recordCount)
-	
+	db.logger.Debug("query completed", "records", recordCount)
+
 	// Data already sorted DESC from query, no need to sort again
 	return dataList, nil
 }
 
-func (db *IoTDB) InsertData(data models.EnergyData) error {
-    if !db.enabled {
-        log.Println("⚠️ IoTDB not enabled, skipping insert")
-        return nil
-    }
-
-    timestamp := data.Timestamp
-    if timestamp == 0 {
-        timestamp = time.Now().UnixMilli()
-    }
-
-    measurements := []string{"voltage", "current", "power", "energy", "frequency", "power_factor"}
-    values := []interface{}{
-        float64(data.Voltage),
-        float64(data.Current),
-        float64(data.Power),
-        float64(data.Energy),
-        float64(data.Frequency),
-        float64(data.PowerFactor),
-    }
-    dataTypes := []client.TSDataType{
-        client.DOUBLE, client.DOUBLE, client.DOUBLE, client.DOUBLE, client.DOUBLE, client.DOUBLE,
-    }
-
-    status, err := (*db.session).InsertRecord("root.wattwise", measurements, dataTypes, values, timestamp)
-    
-    if err != nil {
-        errMsg := err.Error()
-        
-        if contains(errMsg, "doesn't exist") || contains(errMsg, "session") || contains(errMsg, "statement") {
-            log.Printf("⚠️ IoTDB session error detected, attempting reconnect...")
-            
-            if db.session != nil {
-                (*db.session).Close()
-            }
-            
-            if reconnectErr := db.Connect(); reconnectErr != nil {
-                log.Printf("❌ Failed to reconnect to IoTDB: %v", reconnectErr)
-                return fmt.Errorf("IoTDB reconnect failed: %w", reconnectErr)
-            }
-            
-            log.Println("✅ IoTDB reconnected successfully, retrying insert...")
-            
-            status, err = (*db.session).InsertRecord("root.wattwise", measurements, dataTypes, values, timestamp)
-            if err != nil {
-                log.Printf("❌ Retry insert also failed: %v", err)
-                return err
-            }
-        } else {
-            log.Printf("❌ Failed to insert data to IoTDB: %v", err)
-            return err
-        }
-    }
-
-    if status != nil && status.GetCode() != 200 {
-        log.Printf("⚠️ IoTDB insert returned non-OK status: %v", status)
-    }
-
-    log.Printf("✅ Inserted to IoTDB: V=%.2fV I=%.3fA P=%.2fW E=%.5fkWh T=%d", 
-        data.Voltage, data.Current, data.Power, data.Energy, timestamp)
-
-    return nil
-}
-
-func contains(s, substr string) bool {
-    return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && (s[:len(substr)] == substr || s[len(s)-len(substr):] == substr || containsMiddle(s, substr)))
+// latestQuery selects a device's newest readings. limit=0, negative or very
+// large (>= 1M) means fetch ALL data without limit.
+func (db *IoTDB) latestQuery(deviceID string, limit int) string {
+	if limit <= 0 || limit >= 1000000 {
+		return fmt.Sprintf(`%s FROM %s ORDER BY time DESC`, selectReadings, db.devicePath(deviceID))
+	}
+	return fmt.Sprintf(`%s FROM %s ORDER BY time DESC LIMIT %d`, selectReadings, db.devicePath(deviceID), limit)
 }
 
-func containsMiddle(s, substr string) bool {
-    for i := 0; i <= len(s)-len(substr); i++ {
-        if s[i:i+len(substr)] == substr {
-            return true
-        }
-    }
-    return false
-}
+func (db *IoTDB) InsertData(ctx context.Context, deviceID string, data models.EnergyData) error {
+	if !db.IsEnabled() {
+		// Dummy mode hanya untuk baca; write yang hilang harus kelihatan
+		db.logger.Debug("disabled, refusing insert")
+		return db.notConnected()
+	}
 
-func (db *IoTDB) getDummyData(limit int) []models.EnergyData {
-	if limit <= 0 {
-		limit = 100
+	timestamp := data.Timestamp
+	if timestamp == 0 {
+		timestamp = time.Now().UnixMilli()
 	}
-	
-	var dataList []models.EnergyData
-	now := time.Now()
-
-	for i := 0; i < limit; i++ {
-		voltage := 220.0 + float64(i%5)*0.5
-		current := 5.0 + float64(i%3)*0.2
-		power := voltage * current
-		energy := 24.0 + float64(i)*0.3
-
-		data := models.EnergyData{
-			Timestamp: 	now.Add(-time.Duration(i) * time.Minute).UnixMilli(), 
-			Voltage: 	voltage,
-			Current: 	current,
-			Power: 		power,
-			Energy: 	energy,
-			Frequency:	50.0,
-			PowerFactor: 0.95,
+
+	measurements, dataTypes, values := readingRecord(db.energyTypes(deviceID), data)
+
+	err := db.withSession(ctx, func(session session) error {
+		db.ensureDeviceSchema(session, deviceID)
+		if len(data.Phases) > 0 {
+			db.ensurePhaseSchema(session, deviceID)
 		}
-		dataList = append(dataList, data)
+
+		status, err := session.InsertRecord(db.devicePath(deviceID), measurements, dataTypes, values, timestamp)
+		if err != nil {
+			return err
+		}
+		if status != nil && status.GetCode() != 200 {
+			db.logger.Warn("insert returned non-OK status", "status", status)
+		}
+		return nil
+	})
+	if err != nil {
+		db.logger.Error("insert failed", "error", err)
+		return err
 	}
 
-	return dataList
+	db.logger.Debug("inserted reading",
+		"device_id", deviceID,
+		"timestamp", timestamp,
+		"voltage", data.Voltage,
+		"current", data.Current,
+		"power", data.Power,
+		"energy", data.Energy)
+
+	return nil
 }
 
-func (db *IoTDB) GetDataByTimeRange(startTime, endTime int64) ([]models.EnergyData, error) {
-	if !db.enabled {
-		log.Println("⚠️ IoTDB disabled, returning dummy data.")
-		return db.getDummyDataByTimeRange(startTime, endTime), nil
+// InsertBatch writes all readings in a single InsertRecordsOfOneDevice call.
+// Readings must carry their own timestamps.
+func (db *IoTDB) InsertBatch(ctx context.Context, deviceID string, dataList []models.EnergyData) error {
+	if !db.IsEnabled() {
+		db.logger.Debug("disabled, refusing batch insert", "records", len(dataList))
+		return db.notConnected()
+	}
+	if len(dataList) == 0 {
+		return nil
 	}
 
-	query := fmt.Sprintf("SELECT voltage, current, power, energy, frequency, power_factor FROM root.wattwise WHERE time >= %d AND time <= %d ORDER BY time DESC", startTime, endTime)
-	log.Printf("🔍 Executing time range query: %s", query)
+	sorted := make([]models.EnergyData, len(dataList))
+	copy(sorted, dataList)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
 
-	sessionDataSet, err := (*db.session).ExecuteQueryStatement(query, nil)
-	if err != nil {
-		log.Printf("❌ Error executing query: %v", err)
-		return nil, err
+	types := db.energyTypes(deviceID)
+
+	timestamps := make([]int64, len(sorted))
+	measurementsSlice := make([][]string, len(sorted))
+	dataTypesSlice := make([][]client.TSDataType, len(sorted))
+	valuesSlice := make([][]interface{}, len(sorted))
+	threePhase := false
+
+	for i, data := range sorted {
+		timestamps[i] = data.Timestamp
+		measurementsSlice[i], dataTypesSlice[i], valuesSlice[i] = readingRecord(types, data)
+		threePhase = threePhase || len(data.Phases) > 0
 	}
-	defer sessionDataSet.Close()
 
-	var dataList []models.EnergyData
-	recordCount := 0
+	err := db.withSession(ctx, func(session session) error {
+		db.ensureDeviceSchema(session, deviceID)
+		if threePhase {
+			db.ensurePhaseSchema(session, deviceID)
+		}
 
-	for {
-		hasNext, err := sessionDataSet.Next()
+		status, err := session.InsertRecordsOfOneDevice(db.devicePath(deviceID), timestamps, measurementsSlice, dataTypesSlice, valuesSlice, true)
 		if err != nil {
-			log.Printf("❌ Error during dataset iteration: %v", err)
-			break
+			return err
 		}
-		if !hasNext {
-			break
+		if status != nil && status.GetCode() != 200 {
+			return fmt.Errorf("batch insert returned status %d: %s", status.GetCode(), status.GetMessage())
 		}
+		return nil
+	})
+	if err != nil {
+		db.logger.Error("batch insert failed", "device_id", deviceID, "records", len(sorted), "error", err)
+		return err
+	}
 
-		ts := sessionDataSet.GetTimestamp()
+	db.logger.Debug("inserted batch", "device_id", deviceID, "records", len(sorted))
+	return nil
+}
 
-		data := models.EnergyData{
-			Timestamp:   ts,
-			Voltage:    	float64(sessionDataSet.GetDouble("voltage")),
-			Current:    	float64(sessionDataSet.GetDouble("current")),
-			Power:      	float64(sessionDataSet.GetDouble("power")),
-			Energy:     	float64(sessionDataSet.GetDouble("energy")),
-			Frequency:     	float64(sessionDataSet.GetDouble("frequency")),
-			PowerFactor:   	float64(sessionDataSet.GetDouble("power_factor")),
+// GetDataByTimeRange returns a device's readings in [startTime, endTime],
+// newest first. Ranges reaching past the downsample age also include the
+// hourly aggregates that replaced the raw points there, marked by their
+// Samples so averages can weight them (see EnergyData.Weight).
+func (db *IoTDB) GetDataByTimeRange(ctx context.Context, deviceID string, startTime, endTime int64) ([]models.EnergyData, error) {
+	if !db.IsEnabled() {
+		if err := db.dummyAllowed(); err != nil {
+			return nil, err
 		}
+		db.logger.Debug("disabled, returning dummy data", "start", startTime, "end", endTime)
+		return db.dummy.GetDataByTimeRange(ctx, deviceID, startTime, endTime)
+	}
 
-		dataList = append(dataList, data)
-		recordCount++
-		
-		if recordCount%1000 == 0 {
-			log.Printf("   📥 Processed %d records...", recordCount)
+	dataList, err := db.queryRange(ctx, selectReadings, db.devicePath(deviceID), startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	if db.readsHourly(startTime) {
+		hourly, err := db.queryRange(ctx, selectHourly, db.hourlyPath(deviceID), startTime, endTime)
+		if err != nil {
+			return nil, err
+		}
+		if len(hourly) > 0 {
+			dataList = append(dataList, hourly...)
+			sort.Slice(dataList, func(i, j int) bool { return dataList[i].Timestamp > dataList[j].Timestamp })
 		}
 	}
 
-	log.Printf("✅ Retrieved %d records from time range %d to %d", len(dataList), startTime, endTime)
+	db.logger.Debug("time range query completed", "device_id", deviceID, "records", len(dataList), "start", startTime, "end", endTime)
 	return dataList, nil
 }
 
-func (db *IoTDB) getDummyDataByTimeRange(startTime, endTime int64) []models.EnergyData {
+func (db *IoTDB) queryRange(ctx context.Context, columns, path string, startTime, endTime int64) ([]models.EnergyData, error) {
+	query := fmt.Sprintf("%s FROM %s WHERE time >= %d AND time <= %d ORDER BY time DESC", columns, path, startTime, endTime)
+	db.logger.Debug("executing time range query", "query", query)
+
 	var dataList []models.EnergyData
 
-	startTimeObj := time.UnixMilli(startTime)
-	endTimeObj := time.UnixMilli(endTime)
+	err := db.withSession(ctx, func(session session) error {
+		dataList = nil
 
-	for ts := startTimeObj; ts.Before(endTimeObj); ts = ts.Add(5 * time.Minute) {
-		hour := ts.Hour()
-		
-		basePower := 500.0
-		if hour >= 8 && hour <= 18 {
-			basePower = 1200.0
-		}
-
-		voltage := 220.0 + (float64(hour%4) * 0.5)
-		current := basePower / voltage
-		power := voltage * current
-		energy := 0.04 + (float64(hour) * 0.02)
-
-		data := models.EnergyData{
-			Timestamp:  ts.UnixMilli(),
-			Voltage:    voltage,
-			Current:    current,
-			Power:      power,
-			Energy:     energy,
-			Frequency:	50.0,
-			PowerFactor: 0.95,
+		sessionDataSet, err := session.ExecuteQueryStatement(query, nil)
+		if err != nil {
+			return err
 		}
-		dataList = append(dataList, data)
+		defer sessionDataSet.Close()
+
+		// Cell NULL (mis. device tanpa frequency) hanya ditandai Missing,
+		// baris lain tetap dibaca
+		err = readRows(sessionDataSet, func(data models.EnergyData) bool {
+			dataList = append(dataList, data)
+			return true
+		})
+		return err
+	})
+	if err != nil {
+		db.logger.Error("time range query failed", "query", query, "error", err)
+		return nil, err
 	}
 
-	return dataList
-}
\ No newline at end of file
+	return dataList, nil
+}
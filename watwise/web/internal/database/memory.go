@@ -0,0 +1,348 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"wattwise/internal/models"
+)
+
+// dummyReadings is how many readings generated latest/page queries return
+// when no limit is given, and what CountReadings reports for them
+const dummyReadings = 100
+
+// MemoryStore keeps readings and forecasts in process memory (DB_DRIVER=memory,
+// lost on restart). A generating MemoryStore (newDummyStore) stores nothing
+// and answers every read with generated readings; IoTDB serves those while
+// it is not connected (dummy mode).
+type MemoryStore struct {
+	mu          sync.RWMutex
+	readings    map[string][]models.EnergyData // per device, oldest first, unique timestamps
+	predictions map[string][]models.PredictionPoint
+
+	generate bool
+
+	// Unix ms of the last write, reported as last_success_at
+	lastSuccess atomic.Int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		readings:    make(map[string][]models.EnergyData),
+		predictions: make(map[string][]models.PredictionPoint),
+	}
+}
+
+// newDummyStore returns the generating store of dummy mode
+func newDummyStore() *MemoryStore {
+	store := NewMemoryStore()
+	store.generate = true
+	return store
+}
+
+// IsEnabled is false for the generating store: nothing real is stored
+func (m *MemoryStore) IsEnabled() bool {
+	return !m.generate
+}
+
+func (m *MemoryStore) ServesDummyData() bool {
+	return m.generate
+}
+
+// Mode is ModeMemory, or ModeDummy for the generating store
+func (m *MemoryStore) Mode() string {
+	if m.generate {
+		return ModeDummy
+	}
+	return ModeMemory
+}
+
+func (m *MemoryStore) Ping(timeout time.Duration) error {
+	return nil
+}
+
+// Status describes the store for /health like IoTDB.Status
+func (m *MemoryStore) Status() Status {
+	status := Status{
+		Mode:      m.Mode(),
+		DummyData: m.generate,
+		Enabled:   m.IsEnabled(),
+	}
+	if ms := m.lastSuccess.Load(); ms > 0 {
+		t := time.UnixMilli(ms)
+		status.LastSuccessAt = &t
+	}
+	return status
+}
+
+// VerifySchema always passes, the store has no schema
+func (m *MemoryStore) VerifySchema(ctx context.Context, deviceIDs []string, repair bool) (*models.SchemaReport, error) {
+	return &models.SchemaReport{OK: true, CheckedAt: time.Now()}, nil
+}
+
+func (m *MemoryStore) InsertData(ctx context.Context, deviceID string, data models.EnergyData) error {
+	if data.Timestamp == 0 {
+		data.Timestamp = time.Now().UnixMilli()
+	}
+	return m.InsertBatch(ctx, deviceID, []models.EnergyData{data})
+}
+
+// InsertBatch stores the readings; one with the timestamp of a stored reading
+// replaces it, like an IoTDB insert
+func (m *MemoryStore) InsertBatch(ctx context.Context, deviceID string, dataList []models.EnergyData) error {
+	if m.generate || len(dataList) == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series := m.readings[deviceID]
+	for _, data := range dataList {
+		i := sort.Search(len(series), func(i int) bool { return series[i].Timestamp >= data.Timestamp })
+		if i < len(series) && series[i].Timestamp == data.Timestamp {
+			series[i] = data
+			continue
+		}
+		series = slices.Insert(series, i, data)
+	}
+	m.readings[deviceID] = series
+	m.lastSuccess.Store(time.Now().UnixMilli())
+	return nil
+}
+
+// newest returns a device's newest limit readings (<= 0 = all), newest first
+func (m *MemoryStore) newest(deviceID string, limit int) []models.EnergyData {
+	if m.generate {
+		if limit <= 0 {
+			limit = dummyReadings
+		}
+		return generateLatest(limit)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	series := m.readings[deviceID]
+	if limit > 0 && limit < len(series) {
+		series = series[len(series)-limit:]
+	}
+	dataList := slices.Clone(series)
+	slices.Reverse(dataList)
+	return dataList
+}
+
+// between returns a device's readings in [startTime, endTime], oldest first
+func (m *MemoryStore) between(deviceID string, startTime, endTime int64) []models.EnergyData {
+	if m.generate {
+		return generateRange(startTime, endTime)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	series := m.readings[deviceID]
+	from := sort.Search(len(series), func(i int) bool { return series[i].Timestamp >= startTime })
+	to := sort.Search(len(series), func(i int) bool { return series[i].Timestamp > endTime })
+	if from >= to {
+		return nil
+	}
+	return slices.Clone(series[from:to])
+}
+
+func (m *MemoryStore) GetLatestData(ctx context.Context, deviceID string, limit int) ([]models.EnergyData, error) {
+	return m.newest(deviceID, limit), nil
+}
+
+func (m *MemoryStore) GetDataByTimeRange(ctx context.Context, deviceID string, startTime, endTime int64) ([]models.EnergyData, error) {
+	dataList := m.between(deviceID, startTime, endTime)
+	slices.Reverse(dataList)
+	return dataList, nil
+}
+
+func (m *MemoryStore) StreamLatestData(ctx context.Context, deviceID string, limit int, fn func(models.EnergyData) error) error {
+	return emitAll(ctx, m.newest(deviceID, limit), fn)
+}
+
+func (m *MemoryStore) StreamPage(ctx context.Context, deviceID string, ascending bool, offset, limit int, fn func(models.EnergyData) error) error {
+	data := m.newest(deviceID, 0)
+	if ascending {
+		slices.Reverse(data)
+	}
+	data = data[min(offset, len(data)):]
+	data = data[:min(limit, len(data))]
+	return emitAll(ctx, data, fn)
+}
+
+func (m *MemoryStore) StreamDataByTimeRange(ctx context.Context, deviceID string, startTime, endTime int64, limit int, fn func(models.EnergyData) error) error {
+	dataList, _ := m.GetDataByTimeRange(ctx, deviceID, startTime, endTime)
+	if limit > 0 && len(dataList) > limit {
+		dataList = dataList[:limit]
+	}
+	return emitAll(ctx, dataList, fn)
+}
+
+func (m *MemoryStore) StreamRangeAscending(ctx context.Context, deviceID string, startTime, endTime int64, fn func(models.EnergyData) error) error {
+	return emitAll(ctx, m.between(deviceID, startTime, endTime), fn)
+}
+
+func (m *MemoryStore) CountReadings(ctx context.Context, deviceID string) (int64, error) {
+	if m.generate {
+		return dummyReadings, nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return int64(len(m.readings[deviceID])), nil
+}
+
+// GetRollups returns nothing: the store keeps no precomputed rollups, callers
+// aggregate raw readings instead
+func (m *MemoryStore) GetRollups(ctx context.Context, deviceID string, startMs, endMs int64) ([]models.HourlyRollup, error) {
+	return nil, nil
+}
+
+// DeleteDataByTimeRange returns how many of the device's series (readings,
+// forecasts) it was applied to
+func (m *MemoryStore) DeleteDataByTimeRange(ctx context.Context, deviceID string, startMs, endMs int64) (int, error) {
+	if deviceID == "" || startMs <= 0 || endMs <= 0 || startMs > endMs {
+		return 0, ErrInvalidTimeRange
+	}
+	if m.generate {
+		return 0, errNotConnected
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	series := 0
+	if readings, ok := m.readings[deviceID]; ok {
+		m.readings[deviceID] = slices.DeleteFunc(readings, func(d models.EnergyData) bool {
+			return d.Timestamp >= startMs && d.Timestamp <= endMs
+		})
+		series++
+	}
+	if points, ok := m.predictions[deviceID]; ok {
+		m.predictions[deviceID] = slices.DeleteFunc(points, func(p models.PredictionPoint) bool {
+			return p.Timestamp >= startMs && p.Timestamp <= endMs
+		})
+		series++
+	}
+	return series, nil
+}
+
+func (m *MemoryStore) DeviceDataPattern(deviceID string) string {
+	return "memory:" + deviceID
+}
+
+// WritePredictions stores forecasts, overwriting an earlier one for the same hour
+func (m *MemoryStore) WritePredictions(ctx context.Context, deviceID string, points []models.PredictionPoint) error {
+	if m.generate || len(points) == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.predictions[deviceID]
+	for _, p := range points {
+		i := sort.Search(len(stored), func(i int) bool { return stored[i].Timestamp >= p.Timestamp })
+		if i < len(stored) && stored[i].Timestamp == p.Timestamp {
+			stored[i] = p
+			continue
+		}
+		stored = slices.Insert(stored, i, p)
+	}
+	m.predictions[deviceID] = stored
+	return nil
+}
+
+// GetPredictions returns the stored forecasts in [startTime, endTime], oldest first
+func (m *MemoryStore) GetPredictions(ctx context.Context, deviceID string, startTime, endTime int64) ([]models.PredictionPoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var points []models.PredictionPoint
+	for _, p := range m.predictions[deviceID] {
+		if p.Timestamp >= startTime && p.Timestamp <= endTime {
+			points = append(points, p)
+		}
+	}
+	return points, nil
+}
+
+func emitAll(ctx context.Context, dataList []models.EnergyData, fn func(models.EnergyData) error) error {
+	for _, data := range dataList {
+		if ctx.Err() != nil {
+			return abandoned(ctx)
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateLatest returns limit readings one minute apart, newest (now) first
+func generateLatest(limit int) []models.EnergyData {
+	var dataList []models.EnergyData
+	now := time.Now()
+
+	for i := 0; i < limit; i++ {
+		voltage := 220.0 + float64(i%5)*0.5
+		current := 5.0 + float64(i%3)*0.2
+		power := voltage * current
+		energy := 24.0 + float64(i)*0.3
+
+		data := models.EnergyData{
+			Timestamp:   now.Add(-time.Duration(i) * time.Minute).UnixMilli(),
+			Voltage:     voltage,
+			Current:     current,
+			Power:       power,
+			Energy:      energy,
+			Frequency:   50.0,
+			PowerFactor: 0.95,
+		}
+		dataList = append(dataList, data)
+	}
+
+	return dataList
+}
+
+// generateRange returns readings every 5 minutes from startTime up to
+// endTime, oldest first, with a higher load during the day
+func generateRange(startTime, endTime int64) []models.EnergyData {
+	var dataList []models.EnergyData
+
+	startTimeObj := time.UnixMilli(startTime)
+	endTimeObj := time.UnixMilli(endTime)
+
+	for ts := startTimeObj; ts.Before(endTimeObj); ts = ts.Add(5 * time.Minute) {
+		hour := ts.Hour()
+
+		basePower := 500.0
+		if hour >= 8 && hour <= 18 {
+			basePower = 1200.0
+		}
+
+		voltage := 220.0 + (float64(hour%4) * 0.5)
+		current := basePower / voltage
+		power := voltage * current
+		energy := 0.04 + (float64(hour) * 0.02)
+
+		data := models.EnergyData{
+			Timestamp:   ts.UnixMilli(),
+			Voltage:     voltage,
+			Current:     current,
+			Power:       power,
+			Energy:      energy,
+			Frequency:   50.0,
+			PowerFactor: 0.95,
+		}
+		dataList = append(dataList, data)
+	}
+
+	return dataList
+}
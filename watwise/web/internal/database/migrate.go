@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"wattwise/internal/models"
+)
+
+// Schema changes are explicit: Connect only reads SHOW TIMESERIES (see
+// checkSchema), Migrate creates what is missing. Run it with
+// `wattwise --migrate` after installing or upgrading.
+//
+// Upgrading from the single-device layout: readings used to be stored
+// directly under the root (root.wattwise.power). Migrate moves them to the
+// default device (root.wattwise.ESP32_PZEM.power); until it has run they are
+// not visible to any query, and Connect warns about them.
+
+// legacyMeasurements are the series of the single-device layout,
+// <root>.<measurement>, all of them readings of models.DefaultDeviceID
+var legacyMeasurements = append(slices.Clone(energyMeasurements), "prediction")
+
+// Migrate creates the storage groups and every missing timeseries of the
+// default device and of each device that already has data. New devices still
+// get their timeseries on their first write.
+func (db *IoTDB) Migrate(ctx context.Context) (*models.SchemaReport, error) {
+	if !db.IsEnabled() {
+		return nil, errNotConnected
+	}
+
+	err := db.withSession(ctx, func(session session) error {
+		for _, group := range []string{db.root, db.rollupRoot()} {
+			if _, err := session.ExecuteStatement("CREATE STORAGE GROUP " + group); err != nil {
+				// Storage group sudah ada
+				db.logger.Debug("create storage group", "storage_group", group, "error", err)
+				continue
+			}
+			db.logger.Info("storage group created", "storage_group", group)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create storage groups: %w", err)
+	}
+
+	moved, err := db.moveLegacyData(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("move single-device data to %s: %w", models.DefaultDeviceID, err)
+	}
+
+	deviceIDs, err := db.ListDeviceIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list devices: %w", err)
+	}
+
+	report, err := db.VerifySchema(ctx, deviceIDs, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range report.Devices {
+		if len(device.Failed) == 0 {
+			db.knownDevices.Store(device.DeviceID, true)
+		}
+	}
+	report.LegacyMoved = moved
+	return report, nil
+}
+
+// legacySeries returns the single-device series among existing paths
+func (db *IoTDB) legacySeries(existing map[string]bool) []string {
+	var paths []string
+	for _, m := range legacyMeasurements {
+		if path := db.root + "." + m; existing[path] {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// legacyCopy is the SELECT INTO copying the single-device series paths to the
+// same measurements of the default device
+func (db *IoTDB) legacyCopy(paths []string) string {
+	measurements := make([]string, len(paths))
+	for i, path := range paths {
+		measurements[i] = strings.TrimPrefix(path, db.root+".")
+	}
+	list := strings.Join(measurements, ", ")
+	return fmt.Sprintf("SELECT %s INTO %s(%s) FROM %s", list, db.devicePath(models.DefaultDeviceID), list, db.root)
+}
+
+// moveLegacyData copies the readings of the single-device layout to the
+// default device, then deletes the old series so the move runs only once.
+// A retry after a failed delete copies again, which only overwrites the same
+// points. Returns the series moved.
+func (db *IoTDB) moveLegacyData(ctx context.Context) ([]string, error) {
+	var moved []string
+	err := db.withSession(ctx, func(session session) error {
+		moved = nil
+		existing, err := db.showTimeseries(session)
+		if err != nil {
+			return err
+		}
+		paths := db.legacySeries(existing)
+		if len(paths) == 0 {
+			return nil
+		}
+
+		dataSet, err := session.ExecuteQueryStatement(db.legacyCopy(paths), nil)
+		if err != nil {
+			return err
+		}
+		dataSet.Close()
+		if _, err := session.ExecuteStatement("DELETE TIMESERIES " + strings.Join(paths, ", ")); err != nil {
+			return err
+		}
+		moved = paths
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(moved) > 0 {
+		db.logger.Info("moved single-device data", "device_id", models.DefaultDeviceID, "series", moved)
+	}
+	return moved, nil
+}
+
+// checkSchema reads the existing timeseries on connect without creating any:
+// their datatypes (loadSeriesTypes), and which devices are complete so
+// ensureDeviceSchema leaves them alone. A missing default device schema is
+// reported once.
+func (db *IoTDB) checkSchema(session session) {
+	db.loadSeriesTypes(session)
+
+	existing, err := db.showTimeseries(session)
+	if err != nil {
+		db.logger.Warn("could not verify schema", "error", err)
+		return
+	}
+
+	if legacy := db.legacySeries(existing); len(legacy) > 0 {
+		db.logger.Warn("readings in the single-device layout are not visible until they are moved, run with --migrate",
+			"device_id", models.DefaultDeviceID, "series", legacy)
+	}
+
+	var devices []string
+	for path := range existing {
+		if deviceID, _, ok := db.splitSeriesPath(path); ok {
+			devices = append(devices, deviceID)
+		}
+	}
+	devices = append(devices, models.DefaultDeviceID)
+	slices.Sort(devices)
+
+	for _, deviceID := range slices.Compact(devices) {
+		complete := !slices.ContainsFunc(db.deviceSeries(), func(spec seriesSpec) bool {
+			return !existing[db.devicePath(deviceID)+"."+spec.measurement]
+		})
+		if complete {
+			db.knownDevices.Store(deviceID, true)
+		} else if deviceID == models.DefaultDeviceID {
+			db.logger.Warn("schema incomplete, run with --migrate to create it", "device_id", deviceID)
+		}
+	}
+	db.logger.Info("schema verified", "timeseries", len(existing))
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"wattwise/internal/config"
+)
+
+func TestLegacyLayoutMove(t *testing.T) {
+	tests := []struct {
+		name     string
+		root     string
+		existing []string
+		series   []string
+		copy     string
+	}{
+		{
+			name: "single-device layout",
+			root: "",
+			existing: []string{"root.wattwise.voltage", "root.wattwise.current", "root.wattwise.power", "root.wattwise.energy",
+				"root.wattwise.frequency", "root.wattwise.power_factor", "root.wattwise.prediction"},
+			series: []string{"root.wattwise.voltage", "root.wattwise.current", "root.wattwise.power", "root.wattwise.energy",
+				"root.wattwise.frequency", "root.wattwise.power_factor", "root.wattwise.prediction"},
+			copy: "SELECT voltage, current, power, energy, frequency, power_factor, prediction INTO root.wattwise.ESP32_PZEM" +
+				"(voltage, current, power, energy, frequency, power_factor, prediction) FROM root.wattwise",
+		},
+		{
+			// Instalasi lama tanpa frequency/power_factor/prediction
+			name:     "some series",
+			root:     "",
+			existing: []string{"root.wattwise.voltage", "root.wattwise.power", "root.wattwise.ESP32_PZEM.power"},
+			series:   []string{"root.wattwise.voltage", "root.wattwise.power"},
+			copy:     "SELECT voltage, power INTO root.wattwise.ESP32_PZEM(voltage, power) FROM root.wattwise",
+		},
+		{
+			name:     "tenant root",
+			root:     "root.tenantA.wattwise",
+			existing: []string{"root.tenantA.wattwise.energy", "root.wattwise.power"},
+			series:   []string{"root.tenantA.wattwise.energy"},
+			copy:     "SELECT energy INTO root.tenantA.wattwise.ESP32_PZEM(energy) FROM root.tenantA.wattwise",
+		},
+		{
+			name:     "already per device",
+			root:     "",
+			existing: []string{"root.wattwise.ESP32_PZEM.power", "root.wattwise.ESP32_PZEM.hourly.power", "root.wattwise.`ESP32-01`.power"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := NewIoTDB(config.IoTDBConfig{RootPath: tt.root}, discardLogger())
+			existing := make(map[string]bool)
+			for _, path := range tt.existing {
+				existing[path] = true
+			}
+
+			series := db.legacySeries(existing)
+			if !reflect.DeepEqual(series, tt.series) {
+				t.Fatalf("legacy series = %v, want %v", series, tt.series)
+			}
+			if len(series) > 0 {
+				if got := db.legacyCopy(series); got != tt.copy {
+					t.Errorf("copy =\n%s\nwant\n%s", got, tt.copy)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package database
+
+import "errors"
+
+// Data source modes reported by Mode
+const (
+	ModeConnected = "connected"
+	// Never connected (or Close was called); generated readings are served
+	ModeDummy = "dummy"
+	// Connection lost, the reconnection manager is retrying; generated
+	// readings are served until it succeeds
+	ModeReconnecting = "reconnecting"
+	// DB_DRIVER=memory, readings are kept in process memory (MemoryStore)
+	ModeMemory = "memory"
+)
+
+// ErrDummyDisabled is returned by queries instead of generated readings while
+// IoTDB is not connected and DUMMY_MODE=off. Handlers answer 503.
+var ErrDummyDisabled = errors.New("IoTDB not connected (DUMMY_MODE=off)")
+
+// notConnected is the error of a write while IoTDB is not connected:
+// generated readings are never a place to store real ones
+func (db *IoTDB) notConnected() error {
+	if err := db.dummyAllowed(); err != nil {
+		return err
+	}
+	return errNotConnected
+}
+
+// Mode returns where query results currently come from
+func (db *IoTDB) Mode() string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.modeLocked()
+}
+
+func (db *IoTDB) modeLocked() string {
+	switch {
+	case db.enabled:
+		return ModeConnected
+	case db.reconnecting:
+		return ModeReconnecting
+	}
+	return ModeDummy
+}
+
+// ServesDummyData reports whether queries answer with generated readings
+// right now: IoTDB is not connected and DUMMY_MODE is on
+func (db *IoTDB) ServesDummyData() bool {
+	return db.Mode() != ModeConnected && db.dummyAllowed() == nil
+}
+
+// dummyAllowed returns ErrDummyDisabled when generated readings must not be
+// served instead of real ones
+func (db *IoTDB) dummyAllowed() error {
+	if db.config.DummyMode == "off" {
+		return ErrDummyDisabled
+	}
+	return nil
+}
+
+// OnModeChange registers fn to be called with the new mode whenever Mode
+// changes from then on (e.g. to broadcast a notice to dashboards). fn runs on
+// the goroutine that changed the mode and must not block.
+func (db *IoTDB) OnModeChange(fn func(mode string)) {
+	db.mu.Lock()
+	db.onModeChange = fn
+	db.mu.Unlock()
+}
+
+// modeChanged calls the OnModeChange callback if Mode differs from the last
+// reported one; must be called without db.mu held
+func (db *IoTDB) modeChanged() {
+	db.mu.Lock()
+	mode := db.modeLocked()
+	if mode == db.lastMode {
+		db.mu.Unlock()
+		return
+	}
+	previous := db.lastMode
+	db.lastMode = mode
+	fn := db.onModeChange
+	db.mu.Unlock()
+
+	db.logger.Info("data source mode changed", "from", previous, "to", mode)
+	if fn != nil {
+		fn(mode)
+	}
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Data disimpan per device: <root>.<device_id>.<measurement>, dengan root
+// dari IOTDB_ROOT_PATH (default root.wattwise), mis. root.tenantA.wattwise
+// untuk cluster IoTDB bersama
+const DefaultRootPath = "root.wattwise"
+
+var (
+	energyMeasurements = []string{"voltage", "current", "power", "energy", "frequency", "power_factor"}
+	// L1..L3 of 3-phase meters, voltage/current/power per phase in this
+	// order (see energyScanner)
+	phaseMeasurements = []string{
+		"voltage_l1", "current_l1", "power_l1",
+		"voltage_l2", "current_l2", "power_l2",
+		"voltage_l3", "current_l3", "power_l3",
+	}
+	plainNodeName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// Selected by every reading query. Phase series only exist for 3-phase
+	// devices; IoTDB leaves out the columns of series that do not exist.
+	selectReadings = "SELECT " + strings.Join(slices.Concat(energyMeasurements, phaseMeasurements), ", ")
+	// Hourly aggregates also carry how many readings they stand for
+	selectHourly = selectReadings + ", samples"
+)
+
+// devicePath returns the IoTDB device path for a device id. Ids that are not
+// plain identifiers (e.g. "ESP32-01") are backquoted.
+func (db *IoTDB) devicePath(deviceID string) string {
+	return db.root + "." + deviceNode(deviceID)
+}
+
+// DeviceDataPattern is the path pattern covering every series of one device
+// (raw readings and hourly aggregates), e.g. root.wattwise.ESP32_001.**
+func (db *IoTDB) DeviceDataPattern(deviceID string) string {
+	return db.devicePath(deviceID) + ".**"
+}
+
+func deviceNode(deviceID string) string {
+	if plainNodeName.MatchString(deviceID) {
+		return deviceID
+	}
+	return "`" + strings.ReplaceAll(deviceID, "`", "``") + "`"
+}
+
+// rollupRoot is the storage group of the hourly rollups next to the root,
+// e.g. root.wattwise_rollup
+func (db *IoTDB) rollupRoot() string {
+	return db.root + "_rollup"
+}
@@ -0,0 +1,207 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"wattwise/internal/config"
+
+	"github.com/apache/iotdb-client-go/client"
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+const (
+	defaultPoolSize     = 4
+	connectTimeoutMs    = 5000
+	getSessionTimeoutMs = 10000
+)
+
+// errPoolTimeout is returned by acquire when every session stayed borrowed
+// for getSessionTimeoutMs
+var errPoolTimeout = errors.New("get session timeout")
+
+// sessionPool lends at most size sessions at a time. client.SessionPool is
+// not used: in v1.3.4 a failed dial keeps its semaphore slot, so every
+// connection error shrinks that pool until all callers block. Here a slot is
+// held from acquire until release/discard, whatever the dial did.
+//
+// A pool swapped out by the reconnection manager is only closed once every
+// borrowed session has been handed back.
+type sessionPool struct {
+	dial         func() (session, error)
+	closeSession func(session)
+	waitTimeout  time.Duration
+
+	slots chan struct{} // one per borrowed session or dial in progress
+	idle  chan session  // open sessions ready for reuse
+
+	mu      sync.Mutex
+	inUse   int
+	closing bool
+}
+
+func newSessionPool(cfg config.IoTDBConfig) *sessionPool {
+	dial := func() (session, error) {
+		// Open mengisi default di config, jadi tiap session punya salinan
+		s := client.NewSession(&client.Config{
+			Host:     cfg.Host,
+			Port:     cfg.Port,
+			UserName: cfg.Username,
+			Password: cfg.Password,
+		})
+		if err := s.Open(false, connectTimeoutMs); err != nil {
+			return nil, err
+		}
+		return clientSession{&s}, nil
+	}
+	closeSession := func(s session) {
+		s.Close()
+	}
+	return newPool(cfg.PoolSize, dial, closeSession, getSessionTimeoutMs*time.Millisecond)
+}
+
+// newPool returns a pool of at most size (default defaultPoolSize) sessions
+// opened with dial
+func newPool(size int, dial func() (session, error), closeSession func(session), waitTimeout time.Duration) *sessionPool {
+	if size <= 0 {
+		size = defaultPoolSize
+	}
+	return &sessionPool{
+		dial:         dial,
+		closeSession: closeSession,
+		waitTimeout:  waitTimeout,
+		slots:        make(chan struct{}, size),
+		idle:         make(chan session, size),
+	}
+}
+
+// acquire borrows a session, reusing an idle one or dialing a new one; the
+// caller must hand it back with release or discard.
+func (p *sessionPool) acquire() (session, error) {
+	p.mu.Lock()
+	if p.closing {
+		p.mu.Unlock()
+		return nil, errNotConnected
+	}
+	p.inUse++
+	p.mu.Unlock()
+
+	timer := time.NewTimer(p.waitTimeout)
+	defer timer.Stop()
+	select {
+	case p.slots <- struct{}{}:
+	case <-timer.C:
+		p.done()
+		return nil, errPoolTimeout
+	}
+
+	select {
+	case session := <-p.idle:
+		return session, nil
+	default:
+	}
+
+	session, err := p.dial()
+	if err != nil {
+		// Slot dikembalikan, dial yang gagal tidak boleh mengecilkan pool
+		<-p.slots
+		p.done()
+		return nil, err
+	}
+	return session, nil
+}
+
+// release returns a session to the pool. A session that failed with a
+// connection-level error is closed so the next acquire dials a fresh one.
+func (p *sessionPool) release(session session, opErr error) {
+	if opErr != nil && isConnectionError(opErr) {
+		p.discard(session)
+		return
+	}
+	p.idle <- session // never blocks: at most size sessions exist
+	<-p.slots
+	p.done()
+}
+
+// discard closes a borrowed session instead of returning it (a hung or
+// broken connection) and frees its slot
+func (p *sessionPool) discard(session session) {
+	p.closeSession(session)
+	<-p.slots
+	p.done()
+}
+
+func (p *sessionPool) done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.inUse--
+	if p.closing && p.inUse == 0 {
+		p.closeIdle()
+	}
+}
+
+// close closes the pool now, or as soon as the last borrowed session is back.
+func (p *sessionPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closing {
+		return
+	}
+	p.closing = true
+	if p.inUse == 0 {
+		p.closeIdle()
+	}
+}
+
+func (p *sessionPool) closeIdle() {
+	for {
+		select {
+		case session := <-p.idle:
+			p.closeSession(session)
+		default:
+			return
+		}
+	}
+}
+
+// isPoolTimeout reports whether acquire gave up waiting for a free session
+func isPoolTimeout(err error) bool {
+	return errors.Is(err, errPoolTimeout)
+}
+
+// isConnectionError reports whether err means the session itself is unusable
+// (expired session id, dropped TCP connection) rather than a bad statement.
+// Transport and network errors are recognised by type; the client reports
+// server statuses only as text, so those are matched by message.
+func isConnectionError(err error) bool {
+	// Deadline pemanggil bukan koneksi rusak (context error juga net.Error)
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) || errors.Is(err, ErrQueryTimeout) {
+		return false
+	}
+	var transportErr thrift.TTransportException
+	var netErr net.Error
+	if errors.Is(err, io.EOF) || errors.As(err, &transportErr) || errors.As(err, &netErr) {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+
+	// The server answered with a status: the connection is fine unless the
+	// session itself was dropped. Bad statements must not be retried.
+	if strings.HasPrefix(msg, "error code:") {
+		return strings.Contains(msg, "session")
+	}
+
+	for _, marker := range []string{"doesn't exist", "session", "statement", "connection", "broken pipe", "eof", "timeout"} {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
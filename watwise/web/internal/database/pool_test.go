@@ -0,0 +1,280 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wattwise/internal/config"
+	"wattwise/internal/models"
+
+	"github.com/apache/iotdb-client-go/client"
+	"github.com/apache/iotdb-client-go/common"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// fakeDialer hands out sessions to server; the first `failures` dials fail
+// like an unreachable server
+type fakeDialer struct {
+	server   *fakeServer
+	failures atomic.Int64
+	dials    atomic.Int64
+	closed   atomic.Int64
+}
+
+var errRefused = errors.New("dial tcp 127.0.0.1:6667: connect: connection refused")
+
+func (d *fakeDialer) dial() (session, error) {
+	d.dials.Add(1)
+	if d.failures.Add(-1) >= 0 {
+		return nil, errRefused
+	}
+	return &fakeSession{server: d.server}, nil
+}
+
+func (d *fakeDialer) close(session) {
+	d.closed.Add(1)
+}
+
+// fakeServer keeps the readings inserted through its sessions per device path
+// and answers the SELECTs of GetLatestData and GetDataByTimeRange with them,
+// newest first. active counts the calls in progress over all sessions.
+type fakeServer struct {
+	mu      sync.Mutex
+	records map[string][]fakeRecord
+
+	active, maxActive atomic.Int64
+	failReads         atomic.Int64 // next SELECTs whose connection drops after the rows
+}
+
+type fakeRecord struct {
+	timestamp int64
+	values    map[string]interface{}
+}
+
+// enter marks a call in progress for a millisecond, so calls on different
+// sessions overlap; the returned func ends it
+func (s *fakeServer) enter() func() {
+	n := s.active.Add(1)
+	for {
+		peak := s.maxActive.Load()
+		if n <= peak || s.maxActive.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	return func() { s.active.Add(-1) }
+}
+
+type fakeSession struct {
+	server *fakeServer
+}
+
+// ExecuteStatement accepts every statement (CREATE TIMESERIES of the schema)
+func (s *fakeSession) ExecuteStatement(string) (*client.SessionDataSet, error) {
+	return nil, nil
+}
+
+func (s *fakeSession) ExecuteQueryStatement(sql string, _ *int64) (dataSet, error) {
+	defer s.server.enter()()
+
+	_, from, _ := strings.Cut(sql, " FROM ")
+	path, _, _ := strings.Cut(from, " ")
+	limit := -1
+	if _, n, ok := strings.Cut(sql, " LIMIT "); ok {
+		limit, _ = strconv.Atoi(n)
+	}
+
+	s.server.mu.Lock()
+	records := slices.Clone(s.server.records[path])
+	s.server.mu.Unlock()
+	slices.SortFunc(records, func(a, b fakeRecord) int { return cmp.Compare(b.timestamp, a.timestamp) })
+	if limit >= 0 && len(records) > limit {
+		records = records[:limit]
+	}
+
+	ds := &fakeDataSet{}
+	if s.server.failReads.Add(-1) >= 0 {
+		ds.err = io.EOF
+	}
+	for _, m := range energyMeasurements {
+		ds.columns = append(ds.columns, path+"."+m)
+	}
+	for _, r := range records {
+		row := make([]interface{}, len(energyMeasurements))
+		for i, m := range energyMeasurements {
+			row[i] = r.values[m]
+		}
+		ds.times = append(ds.times, r.timestamp)
+		ds.rows = append(ds.rows, row)
+	}
+	return ds, nil
+}
+
+func (s *fakeSession) InsertRecord(deviceID string, measurements []string, _ []client.TSDataType, values []interface{}, timestamp int64) (*common.TSStatus, error) {
+	defer s.server.enter()()
+
+	r := fakeRecord{timestamp: timestamp, values: make(map[string]interface{})}
+	for i, m := range measurements {
+		r.values[m] = values[i]
+	}
+	s.server.mu.Lock()
+	defer s.server.mu.Unlock()
+	if s.server.records == nil {
+		s.server.records = make(map[string][]fakeRecord)
+	}
+	s.server.records[deviceID] = append(s.server.records[deviceID], r)
+	return nil, nil
+}
+
+func (s *fakeSession) InsertRecordsOfOneDevice(deviceID string, timestamps []int64, measurementsSlice [][]string, dataTypesSlice [][]client.TSDataType, valuesSlice [][]interface{}, _ bool) (*common.TSStatus, error) {
+	for i, timestamp := range timestamps {
+		if _, err := s.InsertRecord(deviceID, measurementsSlice[i], dataTypesSlice[i], valuesSlice[i], timestamp); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (s *fakeSession) Close() error { return nil }
+
+func (d *fakeDialer) pool(size int) *sessionPool {
+	return newPool(size, d.dial, d.close, 100*time.Millisecond)
+}
+
+// newTestIoTDB is a connected IoTDB over pool
+func newTestIoTDB(pool *sessionPool, maxRetries int) *IoTDB {
+	db := NewIoTDB(config.IoTDBConfig{MaxRetries: maxRetries, QueryTimeout: 10 * time.Second}, discardLogger())
+	db.pool = pool
+	db.enabled = true
+	return db
+}
+
+func TestFailedDialKeepsPoolSize(t *testing.T) {
+	dialer := &fakeDialer{}
+	dialer.failures.Store(10)
+	pool := dialer.pool(2)
+
+	for range 10 {
+		if _, err := pool.acquire(); !errors.Is(err, errRefused) {
+			t.Fatalf("acquire = %v, want the dial error", err)
+		}
+	}
+
+	// Server kembali: kedua slot masih bisa dipakai bersamaan
+	first, err := pool.acquire()
+	if err != nil {
+		t.Fatalf("first acquire after the failed dials: %v", err)
+	}
+	second, err := pool.acquire()
+	if err != nil {
+		t.Fatalf("second acquire after the failed dials: %v", err)
+	}
+	if _, err := pool.acquire(); !isPoolTimeout(err) {
+		t.Errorf("third acquire = %v, want a pool timeout", err)
+	}
+	pool.release(first, nil)
+	pool.release(second, nil)
+
+	if _, err := pool.acquire(); err != nil {
+		t.Errorf("acquire after release: %v", err)
+	}
+	if dials := dialer.dials.Load(); dials != 12 {
+		t.Errorf("dials = %d, want 12 (released sessions are reused)", dials)
+	}
+}
+
+func TestPoolClosesAfterLastRelease(t *testing.T) {
+	dialer := &fakeDialer{}
+	pool := dialer.pool(2)
+
+	a, _ := pool.acquire()
+	b, _ := pool.acquire()
+	pool.release(a, nil)
+	pool.close()
+	if closed := dialer.closed.Load(); closed != 0 {
+		t.Fatalf("%d sessions closed while one is still borrowed", closed)
+	}
+	pool.release(b, nil)
+	if closed := dialer.closed.Load(); closed != 2 {
+		t.Errorf("%d sessions closed, want 2", closed)
+	}
+	if _, err := pool.acquire(); err != errNotConnected {
+		t.Errorf("acquire on a closed pool = %v, want errNotConnected", err)
+	}
+}
+
+// TestConcurrentSessionsRace runs InsertData and GetLatestData from many
+// goroutines over fake sessions while dials fail now and then; run with -race
+func TestConcurrentSessionsRace(t *testing.T) {
+	const size, devices, inserts = 4, 4, 100
+	server := &fakeServer{}
+	dialer := &fakeDialer{server: server}
+	dialer.failures.Store(3)
+	db := newTestIoTDB(dialer.pool(size), 5)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*inserts)
+	for i := range inserts {
+		deviceID := fmt.Sprintf("D%d", i%devices)
+		wg.Go(func() {
+			data := models.EnergyData{Timestamp: int64(i + 1), Voltage: 220, Current: float64(i), Power: 220 * float64(i)}
+			if err := db.InsertData(ctx, deviceID, data); err != nil {
+				errs <- err
+			}
+		})
+		wg.Go(func() {
+			rows, err := db.GetLatestData(ctx, deviceID, 10)
+			if err != nil {
+				errs <- err
+				return
+			}
+			for _, row := range rows {
+				if row.Power != 220*row.Current {
+					errs <- fmt.Errorf("%s: mixed-up reading %+v", deviceID, row)
+				}
+			}
+			_ = db.Status()
+		})
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	// Tiap insert tersimpan tepat sekali di device-nya
+	for d := range devices {
+		rows, err := db.GetLatestData(ctx, fmt.Sprintf("D%d", d), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != inserts/devices {
+			t.Errorf("D%d has %d readings, want %d", d, len(rows), inserts/devices)
+		}
+		for _, row := range rows {
+			if int(row.Current)%devices != d || row.Timestamp != int64(row.Current)+1 {
+				t.Errorf("D%d has reading %+v of another device", d, row)
+			}
+		}
+	}
+	if peak := server.maxActive.Load(); peak > size {
+		t.Errorf("%d sessions in use at once, pool size %d", peak, size)
+	}
+	if len(db.pool.slots) != 0 || db.pool.inUse != 0 {
+		t.Errorf("after all operations: %d slots held, %d in use", len(db.pool.slots), db.pool.inUse)
+	}
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"wattwise/internal/models"
+
+	"github.com/apache/iotdb-client-go/client"
+)
+
+// WritePredictions stores hourly forecasts in root.wattwise.<device>.prediction,
+// overwriting an earlier forecast for the same hour
+func (db *IoTDB) WritePredictions(ctx context.Context, deviceID string, points []models.PredictionPoint) error {
+	if !db.IsEnabled() {
+		db.logger.Debug("disabled, skipping prediction write", "points", len(points))
+		return nil
+	}
+	if len(points) == 0 {
+		return nil
+	}
+
+	timestamps := make([]int64, len(points))
+	measurementsSlice := make([][]string, len(points))
+	dataTypesSlice := make([][]client.TSDataType, len(points))
+	valuesSlice := make([][]interface{}, len(points))
+
+	for i, p := range points {
+		timestamps[i] = p.Timestamp
+		measurementsSlice[i] = []string{"prediction"}
+		dataTypesSlice[i] = []client.TSDataType{client.FLOAT}
+		valuesSlice[i] = []interface{}{float32(p.PredictedKWh)}
+	}
+
+	err := db.withSession(ctx, func(session session) error {
+		db.ensureDeviceSchema(session, deviceID)
+
+		status, err := session.InsertRecordsOfOneDevice(db.devicePath(deviceID), timestamps, measurementsSlice, dataTypesSlice, valuesSlice, true)
+		if err != nil {
+			return err
+		}
+		if status != nil && status.GetCode() != 200 {
+			return fmt.Errorf("prediction insert returned status %d: %s", status.GetCode(), status.GetMessage())
+		}
+		return nil
+	})
+	if err != nil {
+		db.logger.Error("prediction write failed", "device_id", deviceID, "points", len(points), "error", err)
+		return err
+	}
+
+	db.logger.Debug("wrote predictions", "device_id", deviceID, "points", len(points))
+	return nil
+}
+
+// GetPredictions returns the stored forecasts in [startTime, endTime], oldest first
+func (db *IoTDB) GetPredictions(ctx context.Context, deviceID string, startTime, endTime int64) ([]models.PredictionPoint, error) {
+	if !db.IsEnabled() {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf("SELECT prediction FROM %s WHERE time >= %d AND time <= %d ORDER BY time ASC", db.devicePath(deviceID), startTime, endTime)
+
+	var points []models.PredictionPoint
+	err := db.withSession(ctx, func(session session) error {
+		points = nil
+
+		dataSet, err := session.ExecuteQueryStatement(query, nil)
+		if err != nil {
+			return err
+		}
+		defer dataSet.Close()
+
+		for {
+			hasNext, err := dataSet.Next()
+			if err != nil {
+				return err
+			}
+			if !hasNext {
+				return nil
+			}
+
+			record, err := dataSet.GetRowRecord()
+			if err != nil {
+				return err
+			}
+			fields := record.GetFields()
+			if len(fields) == 0 || fields[0].IsNull() {
+				continue
+			}
+			points = append(points, models.PredictionPoint{
+				Timestamp:    record.GetTimestamp(),
+				PredictedKWh: fieldFloat(fields[0]),
+			})
+		}
+	})
+	if err != nil {
+		db.logger.Error("prediction query failed", "query", query, "error", err)
+		return nil, err
+	}
+	return points, nil
+}
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	reconnectInitialBackoff = 1 * time.Second
+	reconnectMaxBackoff     = 60 * time.Second
+)
+
+// Status describes the IoTDB connection state for /health
+type Status struct {
+	Mode         string     `json:"mode"`       // connected, dummy or reconnecting
+	DummyData    bool       `json:"dummy_data"` // queries answer with generated readings
+	Enabled      bool       `json:"enabled"`
+	Reconnecting bool       `json:"reconnecting"`
+	Attempts     int        `json:"attempts"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastErrorAt  *time.Time `json:"last_error_at,omitempty"`
+	NextRetryAt  *time.Time `json:"next_retry_at,omitempty"`
+	// LastSuccessAt is the last time a query or insert succeeded
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+}
+
+// Status returns a snapshot of the connection state
+func (db *IoTDB) Status() Status {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	status := Status{
+		Mode:         db.modeLocked(),
+		DummyData:    !db.enabled && db.dummyAllowed() == nil,
+		Enabled:      db.enabled,
+		Reconnecting: db.reconnecting,
+		Attempts:     db.attempts,
+		LastError:    db.lastError,
+	}
+	if !db.lastErrorAt.IsZero() {
+		t := db.lastErrorAt
+		status.LastErrorAt = &t
+	}
+	if db.reconnecting && !db.nextRetryAt.IsZero() {
+		t := db.nextRetryAt
+		status.NextRetryAt = &t
+	}
+	if ms := db.lastSuccess.Load(); ms > 0 {
+		t := time.UnixMilli(ms)
+		status.LastSuccessAt = &t
+	}
+
+	return status
+}
+
+// Ping runs a trivial statement on a pooled session and fails if it does not
+// answer within timeout. It does not retry and does not trigger reconnection.
+func (db *IoTDB) Ping(timeout time.Duration) error {
+	if !db.IsEnabled() {
+		return errNotConnected
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := db.trySession(ctx, func(session session) error {
+		dataSet, err := session.ExecuteQueryStatement("SHOW VERSION", nil)
+		if err != nil {
+			return err
+		}
+		return dataSet.Close()
+	})
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("IoTDB ping timed out after %s", timeout)
+	}
+	if err == nil {
+		db.lastSuccess.Store(time.Now().UnixMilli())
+	}
+	return err
+}
+
+// StartReconnect starts the background reconnection manager unless it is
+// already running. Data keeps being served in dummy mode (ModeReconnecting)
+// until it succeeds.
+func (db *IoTDB) StartReconnect() {
+	db.mu.Lock()
+	if db.reconnecting || db.closed {
+		db.mu.Unlock()
+		return
+	}
+	db.reconnecting = true
+	db.attempts = 0
+	db.mu.Unlock()
+
+	db.modeChanged()
+	go db.reconnectLoop()
+}
+
+// reconnectLoop probes the server with exponential backoff (1s → 60s with
+// jitter) until Connect succeeds or the database is closed.
+func (db *IoTDB) reconnectLoop() {
+	backoff := reconnectInitialBackoff
+
+	for {
+		delay := backoff + time.Duration(rand.Int63n(int64(backoff)/5+1))
+
+		db.mu.Lock()
+		db.nextRetryAt = time.Now().Add(delay)
+		db.mu.Unlock()
+
+		db.logger.Debug("scheduling reconnect", "in", delay.Round(time.Millisecond))
+
+		select {
+		case <-time.After(delay):
+		case <-db.stop:
+			return
+		}
+
+		db.mu.Lock()
+		db.attempts++
+		db.mu.Unlock()
+
+		if err := db.Connect(); err != nil {
+			db.logger.Warn("reconnect attempt failed", "error", err)
+			backoff *= 2
+			if backoff > reconnectMaxBackoff {
+				backoff = reconnectMaxBackoff
+			}
+			continue
+		}
+
+		db.mu.Lock()
+		db.reconnecting = false
+		db.mu.Unlock()
+		db.modeChanged()
+
+		db.logger.Info("reconnected to IoTDB")
+		return
+	}
+}
+
+// markConnectionLost switches to dummy mode after a connection failure and
+// hands recovery to the reconnection manager.
+func (db *IoTDB) markConnectionLost(err error) {
+	db.mu.Lock()
+	if !db.enabled {
+		db.mu.Unlock()
+		return
+	}
+	oldPool := db.pool
+	db.enabled = false
+	db.pool = nil
+	db.recordError(err)
+	db.mu.Unlock()
+
+	db.logger.Error("connection to IoTDB lost, switching to dummy mode", "error", err)
+
+	if oldPool != nil {
+		oldPool.close()
+	}
+	db.StartReconnect()
+}
+
+// recordError must be called with db.mu held
+func (db *IoTDB) recordError(err error) {
+	db.lastError = err.Error()
+	db.lastErrorAt = time.Now()
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultMaxRetries   = 3
+	retryInitialBackoff = 100 * time.Millisecond
+	retryMaxBackoff     = 2 * time.Second
+)
+
+// TransientError is returned when an operation kept failing with
+// connection-level errors until the retries ran out. The server may come back,
+// so callers should answer 503 rather than 500.
+type TransientError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *TransientError) Error() string {
+	return fmt.Sprintf("IoTDB unavailable after %d attempt(s): %v", e.Attempts, e.Err)
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// IsTransient reports whether err is a TransientError
+func IsTransient(err error) bool {
+	var transient *TransientError
+	return errors.As(err, &transient)
+}
+
+// IsUnavailable reports whether err means IoTDB could not be used: a
+// TransientError, or a write refused because it is not connected
+func IsUnavailable(err error) bool {
+	return IsTransient(err) || errors.Is(err, errNotConnected) || errors.Is(err, ErrDummyDisabled)
+}
+
+// retryable reports whether an attempt that failed with err is worth retrying
+// on a fresh session
+func retryable(err error) bool {
+	if errors.Is(err, errStreamStarted) || errors.Is(err, ErrQueryTimeout) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return err == errNotConnected || isPoolTimeout(err) || isConnectionError(err)
+}
+
+func (db *IoTDB) maxRetries() int {
+	if db.config.MaxRetries <= 0 {
+		return defaultMaxRetries
+	}
+	return db.config.MaxRetries
+}
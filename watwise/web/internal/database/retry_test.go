@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"wattwise/internal/models"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// failingOp fails its first failures calls with err, then succeeds
+func failingOp(failures int, err error, calls *int) func(session) error {
+	return func(session) error {
+		*calls++
+		if *calls <= failures {
+			return err
+		}
+		return nil
+	}
+}
+
+func TestRetryOnFreshSession(t *testing.T) {
+	dropped := thrift.NewTTransportExceptionFromError(io.EOF)
+
+	for _, failures := range []int{1, 2, 3} {
+		t.Run(fmt.Sprintf("%d failures", failures), func(t *testing.T) {
+			dialer := &fakeDialer{}
+			db := newTestIoTDB(dialer.pool(2), 4)
+
+			calls := 0
+			if err := db.withSession(context.Background(), failingOp(failures, dropped, &calls)); err != nil {
+				t.Fatalf("withSession = %v, want success after %d failures", err, failures)
+			}
+			if calls != failures+1 {
+				t.Errorf("calls = %d, want %d", calls, failures+1)
+			}
+			// Tiap session yang rusak ditutup, percobaan berikutnya dial baru
+			if closed := dialer.closed.Load(); closed != int64(failures) {
+				t.Errorf("closed sessions = %d, want %d", closed, failures)
+			}
+			if dials := dialer.dials.Load(); dials != int64(failures+1) {
+				t.Errorf("dials = %d, want %d", dials, failures+1)
+			}
+			if len(db.pool.slots) != 0 {
+				t.Errorf("%d slots still held", len(db.pool.slots))
+			}
+		})
+	}
+}
+
+func TestRetryAfterFailedDials(t *testing.T) {
+	dialer := &fakeDialer{}
+	dialer.failures.Store(2)
+	db := newTestIoTDB(dialer.pool(1), 3)
+
+	calls := 0
+	if err := db.withSession(context.Background(), failingOp(0, nil, &calls)); err != nil {
+		t.Fatalf("withSession = %v, want success on the third dial", err)
+	}
+	if calls != 1 || dialer.dials.Load() != 3 {
+		t.Errorf("calls = %d, dials = %d, want 1 and 3", calls, dialer.dials.Load())
+	}
+}
+
+func TestRetriesRunOut(t *testing.T) {
+	dialer := &fakeDialer{}
+	db := newTestIoTDB(dialer.pool(1), 2)
+
+	calls := 0
+	err := db.withSession(context.Background(), failingOp(5, io.EOF, &calls))
+	var transient *TransientError
+	if !errors.As(err, &transient) || transient.Attempts != 2 {
+		t.Fatalf("withSession = %v, want a TransientError after 2 attempts", err)
+	}
+	if db.IsEnabled() {
+		t.Error("still enabled after the retries ran out")
+	}
+	db.Close()
+}
+
+func TestBadStatementNotRetried(t *testing.T) {
+	dialer := &fakeDialer{}
+	db := newTestIoTDB(dialer.pool(1), 3)
+
+	calls := 0
+	bad := errors.New("error code: 700, msg: sql parse error")
+	if err := db.withSession(context.Background(), failingOp(1, bad, &calls)); err != bad {
+		t.Fatalf("withSession = %v, want the statement error", err)
+	}
+	if calls != 1 || dialer.closed.Load() != 0 {
+		t.Errorf("calls = %d, closed = %d, want 1 and 0", calls, dialer.closed.Load())
+	}
+}
+
+func TestRowErrorRetried(t *testing.T) {
+	server := &fakeServer{}
+	dialer := &fakeDialer{server: server}
+	db := newTestIoTDB(dialer.pool(1), 3)
+	ctx := context.Background()
+	for i := range 3 {
+		if err := db.InsertData(ctx, "A", models.EnergyData{Timestamp: int64(i + 1), Voltage: 220}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queries := map[string]func() ([]models.EnergyData, error){
+		"GetLatestData":      func() ([]models.EnergyData, error) { return db.GetLatestData(ctx, "A", 10) },
+		"GetDataByTimeRange": func() ([]models.EnergyData, error) { return db.GetDataByTimeRange(ctx, "A", 0, 10) },
+	}
+	for name, query := range queries {
+		t.Run(name, func(t *testing.T) {
+			// Koneksi putus setelah baris terakhir: hasilnya tidak boleh
+			// dianggap sukses, query diulang di session baru
+			closed := dialer.closed.Load()
+			server.failReads.Store(1)
+			rows, err := query()
+			if err != nil {
+				t.Fatalf("%s = %v, want success on the retry", name, err)
+			}
+			if len(rows) != 3 {
+				t.Errorf("%d rows, want 3 without duplicates from the failed read", len(rows))
+			}
+			if dialer.closed.Load() != closed+1 {
+				t.Error("the session that failed mid-read went back to the pool")
+			}
+		})
+	}
+}
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{io.EOF, true},
+		{fmt.Errorf("read: %w", io.EOF), true},
+		{thrift.NewTTransportException(thrift.NOT_OPEN, "transport not open"), true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{errors.New("error code: 301, msg: session id 12 doesn't exist"), true},
+		{errors.New("error code: 700, msg: sql parse error"), false},
+		{errors.New("error code: 508, msg: path does not exist"), false},
+		{context.DeadlineExceeded, false},
+		{fmt.Errorf("%w: %w", ErrQueryTimeout, context.DeadlineExceeded), false},
+	}
+	for _, tt := range tests {
+		if got := isConnectionError(tt.err); got != tt.want {
+			t.Errorf("isConnectionError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"wattwise/internal/models"
+
+	"github.com/apache/iotdb-client-go/client"
+)
+
+// Hourly rollups (see services.RollupJob) live in their own storage group,
+// <root>_rollup.<device>.hourly.<measurement> (root.wattwise_rollup by
+// default), next to the raw data they summarize. Unlike the downsampled
+// <root>.<device>.hourly rows they never replace raw readings.
+
+var rollupMeasurements = []string{
+	"power_min", "power_avg", "power_max",
+	"voltage_min", "voltage_avg", "voltage_max",
+	"current_min", "current_avg", "current_max",
+	"kwh", "samples",
+}
+
+func (db *IoTDB) rollupPath(deviceID string) string {
+	return db.rollupRoot() + "." + deviceNode(deviceID) + "." + hourlyNode
+}
+
+func (db *IoTDB) ensureRollupSchema(session session, deviceID string) {
+	if _, ok := db.knownRollups.Load(deviceID); ok {
+		return
+	}
+
+	path := db.rollupPath(deviceID)
+	for _, m := range rollupMeasurements {
+		dataType := "DOUBLE"
+		if m == "samples" {
+			dataType = "INT64"
+		}
+		ts := fmt.Sprintf("CREATE TIMESERIES %s.%s WITH DATATYPE=%s, ENCODING=GORILLA, COMPRESSOR=LZ4", path, m, dataType)
+		if _, err := session.ExecuteStatement(ts); err != nil {
+			db.logger.Debug("create timeseries", "statement", ts, "error", err)
+		}
+	}
+	db.knownRollups.Store(deviceID, true)
+}
+
+// WriteRollups stores hourly rollups, overwriting earlier rows for the same hours
+func (db *IoTDB) WriteRollups(ctx context.Context, deviceID string, rollups []models.HourlyRollup) error {
+	if !db.IsEnabled() {
+		return errNotConnected
+	}
+	if len(rollups) == 0 {
+		return nil
+	}
+
+	dataTypes := make([]client.TSDataType, len(rollupMeasurements))
+	for i, m := range rollupMeasurements {
+		dataTypes[i] = client.DOUBLE
+		if m == "samples" {
+			dataTypes[i] = client.INT64
+		}
+	}
+
+	timestamps := make([]int64, len(rollups))
+	measurementsSlice := make([][]string, len(rollups))
+	dataTypesSlice := make([][]client.TSDataType, len(rollups))
+	valuesSlice := make([][]interface{}, len(rollups))
+
+	for i, r := range rollups {
+		timestamps[i] = r.Hour
+		measurementsSlice[i] = rollupMeasurements
+		dataTypesSlice[i] = dataTypes
+		valuesSlice[i] = []interface{}{
+			r.PowerMin, r.PowerAvg, r.PowerMax,
+			r.VoltageMin, r.VoltageAvg, r.VoltageMax,
+			r.CurrentMin, r.CurrentAvg, r.CurrentMax,
+			r.KWh, r.Samples,
+		}
+	}
+
+	err := db.withSession(ctx, func(session session) error {
+		db.ensureRollupSchema(session, deviceID)
+
+		status, err := session.InsertRecordsOfOneDevice(db.rollupPath(deviceID), timestamps, measurementsSlice, dataTypesSlice, valuesSlice, true)
+		if err != nil {
+			return err
+		}
+		if status != nil && status.GetCode() != 200 {
+			return fmt.Errorf("rollup insert returned status %d: %s", status.GetCode(), status.GetMessage())
+		}
+		return nil
+	})
+	if err != nil {
+		db.logger.Error("rollup write failed", "device_id", deviceID, "hours", len(rollups), "error", err)
+		return err
+	}
+
+	db.logger.Debug("wrote rollups", "device_id", deviceID, "hours", len(rollups))
+	return nil
+}
+
+// GetRollups returns a device's rollups with startMs <= hour < endMs, oldest first
+func (db *IoTDB) GetRollups(ctx context.Context, deviceID string, startMs, endMs int64) ([]models.HourlyRollup, error) {
+	if !db.IsEnabled() {
+		return nil, errNotConnected
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE time >= %d AND time < %d ORDER BY time ASC",
+		strings.Join(rollupMeasurements, ", "), db.rollupPath(deviceID), startMs, endMs)
+
+	var rollups []models.HourlyRollup
+	err := db.withSession(ctx, func(session session) error {
+		rollups = nil
+
+		dataSet, err := session.ExecuteQueryStatement(query, nil)
+		if err != nil {
+			return err
+		}
+		defer dataSet.Close()
+
+		for {
+			hasNext, err := dataSet.Next()
+			if err != nil {
+				return err
+			}
+			if !hasNext {
+				return nil
+			}
+
+			record, err := dataSet.GetRowRecord()
+			if err != nil {
+				return err
+			}
+			fields := record.GetFields()
+			if len(fields) != len(rollupMeasurements) || fields[10].IsNull() {
+				continue
+			}
+
+			values := make([]float64, 10)
+			for i, f := range fields[:10] {
+				values[i] = fieldFloat(f)
+			}
+			rollups = append(rollups, models.HourlyRollup{
+				Hour:       record.GetTimestamp(),
+				PowerMin:   values[0],
+				PowerAvg:   values[1],
+				PowerMax:   values[2],
+				VoltageMin: values[3],
+				VoltageAvg: values[4],
+				VoltageMax: values[5],
+				CurrentMin: values[6],
+				CurrentAvg: values[7],
+				CurrentMax: values[8],
+				KWh:        values[9],
+				Samples:    fields[10].GetInt64(),
+			})
+		}
+	})
+	if err != nil {
+		// Device tanpa rollup belum punya timeseries, itu bukan error
+		if strings.Contains(strings.ToLower(err.Error()), "does not exist") {
+			return nil, nil
+		}
+		db.logger.Error("rollup query failed", "query", query, "error", err)
+		return nil, err
+	}
+	return rollups, nil
+}
+
+// LatestRollupHour returns the start (Unix ms) of a device's newest rollup,
+// or -1 when it has none
+func (db *IoTDB) LatestRollupHour(ctx context.Context, deviceID string) (int64, error) {
+	if !db.IsEnabled() {
+		return -1, errNotConnected
+	}
+
+	query := fmt.Sprintf("SELECT samples FROM %s ORDER BY time DESC LIMIT 1", db.rollupPath(deviceID))
+
+	latest := int64(-1)
+	err := db.withSession(ctx, func(session session) error {
+		dataSet, err := session.ExecuteQueryStatement(query, nil)
+		if err != nil {
+			return err
+		}
+		defer dataSet.Close()
+
+		hasNext, err := dataSet.Next()
+		if err != nil {
+			return err
+		}
+		if hasNext {
+			latest = dataSet.GetTimestamp()
+		}
+		return nil
+	})
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "does not exist") {
+		return -1, nil
+	}
+	return latest, err
+}
+
+// EarliestReading returns the timestamp (Unix ms) of a device's oldest raw
+// reading, or -1 when it has none
+func (db *IoTDB) EarliestReading(ctx context.Context, deviceID string) (int64, error) {
+	if !db.IsEnabled() {
+		return -1, errNotConnected
+	}
+	return db.earliestRawBefore(ctx, deviceID, time.Now().Add(24*time.Hour).UnixMilli())
+}
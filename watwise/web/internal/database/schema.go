@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+	"wattwise/internal/models"
+)
+
+// seriesSpec is one timeseries every device is expected to have
+type seriesSpec struct {
+	measurement string // below the device path, e.g. "power" or "hourly.power_max"
+	dataType    string
+	encoding    string
+	compressor  string
+}
+
+// create is the statement creating s below devicePath
+func (s seriesSpec) create(devicePath string) string {
+	return fmt.Sprintf("CREATE TIMESERIES %s.%s WITH DATATYPE=%s, ENCODING=%s, COMPRESSOR=%s",
+		devicePath, s.measurement, s.dataType, s.encoding, s.compressor)
+}
+
+// deviceSeries lists the timeseries of one device: the raw measurements, the
+// forecast and, with downsampling on, the hourly aggregates
+func (db *IoTDB) deviceSeries() []seriesSpec {
+	specs := make([]seriesSpec, 0, len(energyMeasurements)+1+len(hourlyMeasurements))
+	for _, m := range energyMeasurements {
+		specs = append(specs, seriesSpec{m, "DOUBLE", "GORILLA", "LZ4"})
+	}
+	specs = append(specs, seriesSpec{"prediction", "FLOAT", "RLE", "SNAPPY"})
+
+	if db.config.DownsampleAfterDays > 0 {
+		for _, m := range hourlyMeasurements {
+			dataType := "DOUBLE"
+			if m == "samples" {
+				dataType = "INT64"
+			}
+			specs = append(specs, seriesSpec{hourlyNode + "." + m, dataType, "GORILLA", "LZ4"})
+		}
+	}
+	return specs
+}
+
+// phaseSeries lists the L1..L3 timeseries of a 3-phase device. They are
+// created on its first 3-phase reading and not expected of other devices;
+// downsampling averages them into hourly phase series.
+func phaseSeries() []seriesSpec {
+	specs := make([]seriesSpec, 0, len(phaseMeasurements))
+	for _, m := range phaseMeasurements {
+		specs = append(specs, seriesSpec{m, "DOUBLE", "GORILLA", "LZ4"})
+	}
+	return specs
+}
+
+// VerifySchema compares SHOW TIMESERIES <root>.** with the timeseries
+// deviceSeries expects for each device (the default device is always
+// checked). With repair, missing timeseries are created; the report then
+// lists them under created, or failed when IoTDB refused.
+func (db *IoTDB) VerifySchema(ctx context.Context, deviceIDs []string, repair bool) (*models.SchemaReport, error) {
+	if !db.IsEnabled() {
+		return nil, errNotConnected
+	}
+
+	ids := append([]string{models.DefaultDeviceID}, deviceIDs...)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	report := &models.SchemaReport{OK: true, CheckedAt: time.Now()}
+	err := db.withSession(ctx, func(session session) error {
+		report.Devices = nil
+		report.OK = true
+
+		existing, err := db.showTimeseries(session)
+		if err != nil {
+			return err
+		}
+
+		for _, deviceID := range ids {
+			diff := models.DeviceSchemaDiff{DeviceID: deviceID, Missing: []string{}}
+			var missing []seriesSpec
+			for _, spec := range db.deviceSeries() {
+				if path := db.devicePath(deviceID) + "." + spec.measurement; !existing[path] {
+					diff.Missing = append(diff.Missing, path)
+					missing = append(missing, spec)
+				}
+			}
+
+			if repair {
+				for i, spec := range missing {
+					if _, err := session.ExecuteStatement(spec.create(db.devicePath(deviceID))); err != nil {
+						db.logger.Error("schema repair failed", "device_id", deviceID, "series", diff.Missing[i], "error", err)
+						diff.Failed = append(diff.Failed, diff.Missing[i])
+						continue
+					}
+					db.logger.Info("schema repaired, created timeseries", "device_id", deviceID, "series", diff.Missing[i])
+					diff.Created = append(diff.Created, diff.Missing[i])
+				}
+			}
+
+			if len(diff.Missing) > len(diff.Created) {
+				report.OK = false
+			}
+			report.Devices = append(report.Devices, diff)
+		}
+		return nil
+	})
+	if err != nil {
+		db.logger.Error("schema verification failed", "error", err)
+		return nil, err
+	}
+	return report, nil
+}
+
+// showTimeseries returns the full paths of all timeseries under the root
+func (db *IoTDB) showTimeseries(session session) (map[string]bool, error) {
+	dataSet, err := session.ExecuteQueryStatement("SHOW TIMESERIES "+db.root+".**", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer dataSet.Close()
+
+	paths := make(map[string]bool)
+	for {
+		hasNext, err := dataSet.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !hasNext {
+			return paths, nil
+		}
+		paths[dataSet.GetText("Timeseries")] = true
+	}
+}
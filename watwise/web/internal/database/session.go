@@ -0,0 +1,38 @@
+package database
+
+import (
+	"github.com/apache/iotdb-client-go/client"
+	"github.com/apache/iotdb-client-go/common"
+)
+
+// session is the part of client.Session the store uses, so the real queries
+// and inserts can run against a fake in tests
+type session interface {
+	ExecuteStatement(sql string) (*client.SessionDataSet, error)
+	ExecuteQueryStatement(sql string, timeoutMs *int64) (dataSet, error)
+	InsertRecord(deviceID string, measurements []string, dataTypes []client.TSDataType, values []interface{}, timestamp int64) (*common.TSStatus, error)
+	InsertRecordsOfOneDevice(deviceID string, timestamps []int64, measurementsSlice [][]string, dataTypesSlice [][]client.TSDataType, valuesSlice [][]interface{}, sorted bool) (*common.TSStatus, error)
+	Close() error
+}
+
+// dataSet is the part of *client.SessionDataSet the store reads
+type dataSet interface {
+	resultSet
+	GetText(columnName string) string
+	GetRowRecord() (*client.RowRecord, error)
+	Close() error
+}
+
+// clientSession adapts *client.Session to session
+type clientSession struct {
+	*client.Session
+}
+
+func (s clientSession) ExecuteQueryStatement(sql string, timeoutMs *int64) (dataSet, error) {
+	ds, err := s.Session.ExecuteQueryStatement(sql, timeoutMs)
+	if err != nil {
+		// Bukan interface berisi pointer nil
+		return nil, err
+	}
+	return ds, nil
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"time"
+	"wattwise/internal/models"
+)
+
+// Drivers selectable with DB_DRIVER
+const (
+	DriverIoTDB  = "iotdb"
+	DriverMemory = "memory"
+)
+
+// Store is the reading storage the services and handlers work with. *IoTDB
+// implements it against the server, MemoryStore in-process (DB_DRIVER=memory
+// and the generated readings of dummy mode).
+//
+// Insert is InsertData/InsertBatch, GetLatest is GetLatestData (and its
+// streaming variants), GetRange is GetDataByTimeRange, GetAggregated is
+// GetRollups and DeleteRange is DeleteDataByTimeRange. Maintenance (retention,
+// downsampling, rollup jobs, schema migration) is IoTDB specific and stays
+// on *IoTDB.
+type Store interface {
+	// IsEnabled reports whether reads hit real stored data
+	IsEnabled() bool
+	// ServesDummyData reports whether reads answer with generated readings
+	ServesDummyData() bool
+	Ping(timeout time.Duration) error
+
+	InsertData(ctx context.Context, deviceID string, data models.EnergyData) error
+	InsertBatch(ctx context.Context, deviceID string, dataList []models.EnergyData) error
+
+	// GetLatestData returns the newest readings first; limit <= 0 means all
+	GetLatestData(ctx context.Context, deviceID string, limit int) ([]models.EnergyData, error)
+	// GetDataByTimeRange returns the readings in [startTime, endTime], newest first
+	GetDataByTimeRange(ctx context.Context, deviceID string, startTime, endTime int64) ([]models.EnergyData, error)
+	StreamLatestData(ctx context.Context, deviceID string, limit int, fn func(models.EnergyData) error) error
+	StreamPage(ctx context.Context, deviceID string, ascending bool, offset, limit int, fn func(models.EnergyData) error) error
+	StreamDataByTimeRange(ctx context.Context, deviceID string, startTime, endTime int64, limit int, fn func(models.EnergyData) error) error
+	StreamRangeAscending(ctx context.Context, deviceID string, startTime, endTime int64, fn func(models.EnergyData) error) error
+	CountReadings(ctx context.Context, deviceID string) (int64, error)
+
+	// GetRollups returns precomputed hourly aggregates with startMs <= hour <
+	// endMs, oldest first
+	GetRollups(ctx context.Context, deviceID string, startMs, endMs int64) ([]models.HourlyRollup, error)
+
+	// DeleteDataByTimeRange deletes a device's readings with startMs <= time
+	// <= endMs and returns the number of series it was applied to
+	DeleteDataByTimeRange(ctx context.Context, deviceID string, startMs, endMs int64) (int, error)
+	// DeviceDataPattern names where a device's data lives, for responses
+	DeviceDataPattern(deviceID string) string
+
+	WritePredictions(ctx context.Context, deviceID string, points []models.PredictionPoint) error
+	GetPredictions(ctx context.Context, deviceID string, startTime, endTime int64) ([]models.PredictionPoint, error)
+}
+
+var (
+	_ Store = (*IoTDB)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
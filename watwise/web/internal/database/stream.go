@@ -0,0 +1,217 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"wattwise/internal/models"
+)
+
+// errStreamStarted marks a failure after rows were already handed to the
+// caller; retrying would send them twice, so withSession gives up instead
+var errStreamStarted = errors.New("stream already started")
+
+// StreamLatestData calls fn for a device's newest readings (newest first,
+// limit as in GetLatestData) while the result set is read, so the caller
+// never holds the whole result in memory. An error from fn stops the query
+// and is returned as-is.
+func (db *IoTDB) StreamLatestData(ctx context.Context, deviceID string, limit int, fn func(models.EnergyData) error) error {
+	if !db.IsEnabled() {
+		if err := db.dummyAllowed(); err != nil {
+			return err
+		}
+		return db.dummy.StreamLatestData(ctx, deviceID, limit, fn)
+	}
+
+	return db.streamQuery(ctx, db.latestQuery(deviceID, limit), fn)
+}
+
+// StreamPage calls fn for one page of a device's readings, ordered by time
+// (ascending or newest first) with ORDER BY/LIMIT/OFFSET done by IoTDB
+func (db *IoTDB) StreamPage(ctx context.Context, deviceID string, ascending bool, offset, limit int, fn func(models.EnergyData) error) error {
+	if !db.IsEnabled() {
+		if err := db.dummyAllowed(); err != nil {
+			return err
+		}
+		return db.dummy.StreamPage(ctx, deviceID, ascending, offset, limit, fn)
+	}
+
+	order := "DESC"
+	if ascending {
+		order = "ASC"
+	}
+	query := fmt.Sprintf("%s FROM %s ORDER BY time %s LIMIT %d OFFSET %d",
+		selectReadings, db.devicePath(deviceID), order, limit, offset)
+	return db.streamQuery(ctx, query, fn)
+}
+
+// CountReadings returns how many raw readings a device has (counted on
+// power); 0 for an unknown device
+func (db *IoTDB) CountReadings(ctx context.Context, deviceID string) (int64, error) {
+	if !db.IsEnabled() {
+		if err := db.dummyAllowed(); err != nil {
+			return 0, err
+		}
+		return db.dummy.CountReadings(ctx, deviceID)
+	}
+
+	query := fmt.Sprintf("SELECT count(power) FROM %s", db.devicePath(deviceID))
+	var count int64
+	err := db.withSession(ctx, func(session session) error {
+		dataSet, err := session.ExecuteQueryStatement(query, nil)
+		if err != nil {
+			return err
+		}
+		defer dataSet.Close()
+
+		hasNext, err := dataSet.Next()
+		if err != nil || !hasNext {
+			return err
+		}
+		record, err := dataSet.GetRowRecord()
+		if err != nil {
+			return err
+		}
+		if fields := record.GetFields(); len(fields) > 0 && !fields[0].IsNull() {
+			count = fields[0].GetInt64()
+		}
+		return nil
+	})
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "does not exist") {
+			return 0, nil
+		}
+		db.logger.Error("count query failed", "query", query, "error", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// StreamDataByTimeRange is GetDataByTimeRange for at most limit rows (<= 0 =
+// all), passed to fn newest first. Ranges reaching into downsampled data
+// need the raw and hourly series merged, so those are still read in full.
+func (db *IoTDB) StreamDataByTimeRange(ctx context.Context, deviceID string, startTime, endTime int64, limit int, fn func(models.EnergyData) error) error {
+	if !db.IsEnabled() || db.readsHourly(startTime) {
+		dataList, err := db.GetDataByTimeRange(ctx, deviceID, startTime, endTime)
+		if err != nil {
+			return err
+		}
+		if limit > 0 && len(dataList) > limit {
+			dataList = dataList[:limit]
+		}
+		for _, data := range dataList {
+			if err := fn(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	query := fmt.Sprintf("%s FROM %s WHERE time >= %d AND time <= %d ORDER BY time DESC", selectReadings, db.devicePath(deviceID), startTime, endTime)
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	return db.streamQuery(ctx, query, fn)
+}
+
+// StreamRangeAscending calls fn for every reading of [startTime, endTime],
+// oldest first, without a row limit. Hourly aggregates of a downsampled
+// start come before the raw rows, so the order holds across the cutoff.
+func (db *IoTDB) StreamRangeAscending(ctx context.Context, deviceID string, startTime, endTime int64, fn func(models.EnergyData) error) error {
+	if !db.IsEnabled() {
+		if err := db.dummyAllowed(); err != nil {
+			return err
+		}
+		return db.dummy.StreamRangeAscending(ctx, deviceID, startTime, endTime, fn)
+	}
+
+	rangeQuery := func(columns, path string, start, end int64) string {
+		return fmt.Sprintf("%s FROM %s WHERE time >= %d AND time <= %d ORDER BY time ASC", columns, path, start, end)
+	}
+	rawStart := startTime
+	if db.readsHourly(startTime) {
+		cutoff := db.downsampleCutoff(time.Now())
+		hourlyRows := 0
+		err := db.streamQuery(ctx, rangeQuery(selectHourly, db.hourlyPath(deviceID), startTime, min(endTime, cutoff-1)), func(data models.EnergyData) error {
+			hourlyRows++
+			return fn(data)
+		})
+		if err != nil && !strings.Contains(strings.ToLower(err.Error()), "does not exist") {
+			return err
+		}
+		// Raw rows before the cutoff that were not downsampled yet would
+		// break the order; they are covered by the hourly rows anyway
+		if hourlyRows > 0 {
+			rawStart = max(startTime, cutoff)
+		}
+	}
+	return db.streamQuery(ctx, rangeQuery(selectReadings, db.devicePath(deviceID), rawStart, endTime), fn)
+}
+
+// streamQuery runs query and passes the rows to fn. Once ctx is done fn is
+// never called again, even by a query withSession already gave up on, so the
+// caller may reuse whatever fn writes to as soon as streamQuery returns.
+func (db *IoTDB) streamQuery(ctx context.Context, query string, fn func(models.EnergyData) error) error {
+	db.logger.Debug("executing streaming query", "query", query)
+
+	ctx, cancel := db.queryContext(ctx)
+	defer cancel()
+
+	var mu sync.Mutex // held while fn runs
+	sent := 0
+	emit := func(data models.EnergyData) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if ctx.Err() != nil {
+			return abandoned(ctx)
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+		sent++
+		return nil
+	}
+
+	err := db.withSession(ctx, func(session session) error {
+		sessionDataSet, err := session.ExecuteQueryStatement(query, nil)
+		if err != nil {
+			return err
+		}
+		defer sessionDataSet.Close()
+
+		var emitErr error
+		err = readRows(sessionDataSet, func(data models.EnergyData) bool {
+			emitErr = emit(data)
+			return emitErr == nil
+		})
+		if err != nil {
+			return streamFailed(err, sent)
+		}
+		if emitErr != nil {
+			return fmt.Errorf("%w: %w", errStreamStarted, emitErr)
+		}
+		return nil
+	})
+
+	// Tunggu fn yang mungkin masih jalan di query yang ditinggalkan
+	mu.Lock()
+	defer mu.Unlock()
+	if err != nil {
+		db.logger.Error("streaming query failed", "query", query, "rows", sent, "error", err)
+		return err
+	}
+
+	db.logger.Debug("streaming query completed", "rows", sent)
+	return nil
+}
+
+// streamFailed makes a failure after the first row non-retryable
+func streamFailed(err error, sent int) error {
+	if sent == 0 {
+		return err
+	}
+	return fmt.Errorf("%w after %d rows: %w", errStreamStarted, sent, err)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"log"
+	"wattwise/internal/database"
+	"wattwise/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminHandler serves the /api/admin maintenance endpoints
+type AdminHandler struct {
+	db      *database.IoTDB
+	devices *services.DeviceService
+}
+
+func NewAdminHandler(db *database.IoTDB, devices *services.DeviceService) *AdminHandler {
+	return &AdminHandler{db: db, devices: devices}
+}
+
+// GetSchema compares the IoTDB timeseries with what every registered device
+// should have
+// Usage: GET /api/admin/schema
+func (h *AdminHandler) GetSchema(c *fiber.Ctx) error {
+	return h.verifySchema(c, false)
+}
+
+// RepairSchema creates the missing timeseries found by GetSchema
+// Usage: POST /api/admin/schema/repair
+func (h *AdminHandler) RepairSchema(c *fiber.Ctx) error {
+	return h.verifySchema(c, true)
+}
+
+func (h *AdminHandler) verifySchema(c *fiber.Ctx, repair bool) error {
+	if !h.db.IsEnabled() {
+		return iotdbUnavailable(c)
+	}
+
+	report, err := h.db.VerifySchema(c.UserContext(), h.devices.IDs(), repair)
+	if err != nil {
+		log.Printf("❌ Schema verification failed: %v", err)
+		return dbError(c, err, "Failed to verify IoTDB schema")
+	}
+
+	if repair {
+		created := 0
+		for _, d := range report.Devices {
+			created += len(d.Created)
+		}
+		log.Printf("🛠️  Schema repair created %d timeseries (ok=%v) by %v", created, report.OK, c.Locals("username"))
+	}
+
+	return c.JSON(report)
+}
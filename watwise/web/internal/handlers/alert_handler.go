@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"strings"
+	"wattwise/internal/models"
+	"wattwise/internal/repositories"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AlertHandler serves /api/energy/alerts
+type AlertHandler struct {
+	alerts *repositories.AlertRepository
+}
+
+func NewAlertHandler(alerts *repositories.AlertRepository) *AlertHandler {
+	return &AlertHandler{alerts: alerts}
+}
+
+// GetAlerts returns the most recent alerts, newest first
+// Usage: GET /api/energy/alerts?device_id=ESP32_001&severity=critical&limit=50
+func (h *AlertHandler) GetAlerts(c *fiber.Ctx) error {
+	q := newQueryParams(c)
+	severity := strings.TrimSpace(c.Query("severity"))
+	if severity != "" {
+		severity = q.oneOf("severity", "", models.Severities...)
+	}
+	limit := q.intRange("limit", 100, 1, repositories.DefaultMaxAlerts)
+	if err := q.err(); err != nil {
+		return badParam(c, err)
+	}
+
+	alerts := h.alerts.List(c.Query("device_id"), severity, limit)
+	return c.JSON(fiber.Map{
+		"count":  len(alerts),
+		"alerts": alerts,
+	})
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"wattwise/internal/models"
+	"wattwise/internal/repositories"
+	"wattwise/internal/services"
+	"wattwise/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// APIKeyHandler serves /api/apikeys
+type APIKeyHandler struct {
+	keys *services.APIKeyService
+}
+
+func NewAPIKeyHandler(keys *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys}
+}
+
+// CreateAPIKey generates a key; the response is the only place the full key
+// is shown
+// Body: {"name": "grafana", "scope": "read"}
+func (h *APIKeyHandler) CreateAPIKey(c *fiber.Ctx) error {
+	var input models.APIKeyInput
+	if err := c.BodyParser(&input); err != nil {
+		return utils.ErrorResponse(c, 400, "Invalid request body")
+	}
+
+	username, _ := c.Locals("username").(string)
+	key, err := h.keys.Create(input, username)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAPIKey) {
+			return utils.ErrorResponse(c, 400, err.Error())
+		}
+		return utils.ErrorResponse(c, 500, "Failed to generate API key")
+	}
+
+	log.Printf("🔑 API key %s (%s, %s) created by %s", key.Prefix, key.Name, key.Scope, username)
+	return c.Status(fiber.StatusCreated).JSON(key)
+}
+
+// ListAPIKeys returns the metadata of all keys, without the keys themselves
+func (h *APIKeyHandler) ListAPIKeys(c *fiber.Ctx) error {
+	keys := h.keys.List()
+
+	return c.JSON(fiber.Map{
+		"count":    len(keys),
+		"api_keys": keys,
+	})
+}
+
+// RevokeAPIKey deletes a key by id
+func (h *APIKeyHandler) RevokeAPIKey(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if err := h.keys.Revoke(id); err != nil {
+		if errors.Is(err, repositories.ErrAPIKeyNotFound) {
+			return utils.ErrorResponse(c, 404, err.Error())
+		}
+		log.Printf("ERROR: Revoke API key %s failed: %v", id, err)
+		return utils.ErrorResponse(c, 500, "Failed to revoke API key")
+	}
+
+	log.Printf("🔑 API key %s revoked by %v", id, c.Locals("username"))
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "API key revoked",
+	})
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"time"
+	"wattwise/internal/models"
+	"wattwise/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AuditHandler serves /api/admin/audit
+type AuditHandler struct {
+	audit *services.AuditService
+}
+
+func NewAuditHandler(audit *services.AuditService) *AuditHandler {
+	return &AuditHandler{audit: audit}
+}
+
+// ListAudit returns recorded events, newest first
+// start/end accept unix ms or RFC 3339
+// Usage: GET /api/admin/audit?start=2025-01-01T00:00:00Z&username=budi&type=login_failure&page=1&page_size=50
+func (h *AuditHandler) ListAudit(c *fiber.Ctx) error {
+	q := newQueryParams(c)
+	start := q.timestamp("start", 0)
+	end := q.timestamp("end", 0)
+	eventType := c.Query("type")
+	if eventType != "" {
+		eventType = q.oneOf("type", "", models.AuditEventTypes...)
+	}
+	page := q.intRange("page", 1, 1, 1<<20)
+	pageSize := q.intRange("page_size", 50, 1, 500)
+	if start > 0 && end > 0 && !q.failed("start") && !q.failed("end") {
+		q.add("end", checkRange("start", "end", start, end))
+	}
+	if err := q.err(); err != nil {
+		return badParam(c, err)
+	}
+
+	filter := models.AuditFilter{
+		Username: c.Query("username"),
+		Type:     eventType,
+		Page:     page,
+		PageSize: pageSize,
+	}
+	if start > 0 {
+		filter.From = time.UnixMilli(start)
+	}
+	if end > 0 {
+		filter.To = time.UnixMilli(end)
+	}
+	events, total := h.audit.List(filter)
+
+	return c.JSON(fiber.Map{
+		"events":    events,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// auditEvent starts an event for the current request: acting user, client IP
+// and user agent
+func auditEvent(c *fiber.Ctx, eventType, target string) models.AuditEvent {
+	username, _ := c.Locals("username").(string)
+	return models.AuditEvent{
+		Type:      eventType,
+		Username:  username,
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		Target:    target,
+	}
+}
@@ -2,13 +2,17 @@ package handlers
 
 import (
 	"log"
+	"strings"
+	"wattwise/internal/models"
+	"wattwise/internal/services"
 	"wattwise/internal/utils"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type AuthHandler struct {
-	users map[string]string
+	users *services.UserService
+	audit *services.AuditService
 }
 
 type LoginRequest struct {
@@ -17,24 +21,26 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	Token   string `json:"token,omitempty"`
-	User    *User  `json:"user,omitempty"`
+	Success      bool         `json:"success"`
+	Message      string       `json:"message"`
+	Token        string       `json:"token,omitempty"` // access token
+	RefreshToken string       `json:"refresh_token,omitempty"`
+	ExpiresIn    int          `json:"expires_in,omitempty"` // access token lifetime, seconds
+	User         *models.User `json:"user,omitempty"`
 }
 
-type User struct {
-	ID       int    `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+// RefreshRequest is the body of /api/auth/refresh and (optionally) logout
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
-func NewAuthHandler() *AuthHandler {
-	return &AuthHandler{
-		users: map[string]string{
-			"admin": "admin123",
-		},
-	}
+func NewAuthHandler(users *services.UserService) *AuthHandler {
+	return &AuthHandler{users: users}
+}
+
+// SetAudit records logins in the audit trail
+func (h *AuthHandler) SetAudit(audit *services.AuditService) {
+	h.audit = audit
 }
 
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
@@ -50,10 +56,11 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 
 	log.Printf("🔐 Login attempt: %s", req.Username)
 
-	// Validate credentials
-	password, exists := h.users[req.Username]
-	if !exists || password != req.Password {
+	// Validate credentials; unknown users get the same message
+	user, ok := h.users.Authenticate(req.Username, req.Password)
+	if !ok {
 		log.Printf("❌ Login failed: %s", req.Username)
+		h.recordLogin(c, models.AuditLoginFailure, req.Username)
 		return c.Status(fiber.StatusUnauthorized).JSON(LoginResponse{
 			Success: false,
 			Message: "Username atau password salah",
@@ -61,7 +68,7 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	}
 
 	// Generate JWT token - FIX: Handle error!
-	token, err := utils.GenerateToken(req.Username)
+	token, err := utils.GenerateToken(user.Username, user.Role)
 	if err != nil {
 		log.Printf("❌ Failed to generate token: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
@@ -69,26 +76,92 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 			Message: "Gagal membuat token autentikasi",
 		})
 	}
-
-	user := &User{
-		ID:       1,
-		Username: req.Username,
-		Email:    req.Username + "@wattwise.com",
+	refreshToken, err := utils.GenerateRefreshToken(user.Username)
+	if err != nil {
+		log.Printf("❌ Failed to generate token: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
+			Success: false,
+			Message: "Gagal membuat token autentikasi",
+		})
 	}
 
-	log.Printf("✅ Login successful: %s (token: %s...)", req.Username, token[:20])
+	log.Printf("✅ Login successful: %s as %s", user.Username, user.Role)
+	h.recordLogin(c, models.AuditLoginSuccess, user.Username)
 
 	return c.Status(fiber.StatusOK).JSON(LoginResponse{
-		Success: true,
-		Message: "Login berhasil",
-		User:    user,
-		Token:   token,
+		Success:      true,
+		Message:      "Login berhasil",
+		User:         &user,
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL().Seconds()),
 	})
 }
 
+// Refresh issues a new access token for a valid refresh token
+func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
+	var req RefreshRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(LoginResponse{
+			Success: false,
+			Message: "refresh_token is required",
+		})
+	}
+
+	username, err := utils.ValidateRefreshToken(req.RefreshToken)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(LoginResponse{
+			Success: false,
+			Message: "Invalid or expired refresh token",
+		})
+	}
+
+	// Role diambil ulang supaya perubahan role/hapus user berlaku saat refresh
+	user, err := h.users.Get(username)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(LoginResponse{
+			Success: false,
+			Message: "Invalid or expired refresh token",
+		})
+	}
+
+	token, err := utils.GenerateToken(user.Username, user.Role)
+	if err != nil {
+		log.Printf("❌ Failed to generate token: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(LoginResponse{
+			Success: false,
+			Message: "Gagal membuat token autentikasi",
+		})
+	}
+
+	return c.JSON(LoginResponse{
+		Success:   true,
+		Message:   "Token diperbarui",
+		Token:     token,
+		ExpiresIn: int(utils.AccessTokenTTL().Seconds()),
+	})
+}
+
+// Logout revokes the bearer access token and, if sent in the body, the
+// refresh token, so neither can be used again before it expires
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	if token, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer "); ok {
+		utils.RevokeToken(token)
+	}
+
+	var req RefreshRequest
+	if err := c.BodyParser(&req); err == nil && req.RefreshToken != "" {
+		utils.RevokeToken(req.RefreshToken)
+	}
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Logout berhasil",
 	})
 }
+
+func (h *AuthHandler) recordLogin(c *fiber.Ctx, eventType, username string) {
+	event := auditEvent(c, eventType, "")
+	event.Username = username
+	h.audit.Record(event)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"wattwise/internal/repositories"
+	"wattwise/internal/services"
+	"wattwise/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLoginThenRefresh(t *testing.T) {
+	utils.SetJWTSecret([]byte("test-secret"))
+	t.Cleanup(func() { utils.SetJWTSecret(nil) })
+
+	repo, _ := repositories.NewUserRepository("")
+	auth := NewAuthHandler(services.NewUserService(repo, discardLogger()))
+	app := fiber.New()
+	app.Post("/login", auth.Login)
+	app.Post("/refresh", auth.Refresh)
+
+	var login LoginResponse
+	if status := doJSON(t, app, "POST", "/login", `{"username":"admin","password":"admin123"}`, &login); status != 200 {
+		t.Fatalf("login: status %d", status)
+	}
+	username, err := utils.ValidateRefreshToken(login.RefreshToken)
+	if err != nil || username != login.User.Username {
+		t.Fatalf("refresh token for %q (%v), want %q", username, err, login.User.Username)
+	}
+
+	var refreshed LoginResponse
+	if status := doJSON(t, app, "POST", "/refresh", `{"refresh_token":"`+login.RefreshToken+`"}`, &refreshed); status != 200 {
+		t.Fatalf("refresh: status %d (%s)", status, refreshed.Message)
+	}
+	if _, role, err := utils.ValidateToken(refreshed.Token); err != nil || role != "admin" {
+		t.Errorf("refreshed token role %q (%v), want admin", role, err)
+	}
+}
+
+// doJSON sends body and decodes the JSON response into out (nil = ignore)
+func doJSON(t *testing.T, app *fiber.App, method, path, body string, out any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decode: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"time"
+	"wattwise/internal/database"
+	"wattwise/internal/models"
+	"wattwise/internal/repositories"
+	"wattwise/internal/services"
+	"wattwise/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BudgetHandler serves /api/settings/budget and /api/energy/budget-status
+type BudgetHandler struct {
+	db      database.Store
+	budgets *services.BudgetService
+}
+
+func NewBudgetHandler(db database.Store, budgets *services.BudgetService) *BudgetHandler {
+	return &BudgetHandler{db: db, budgets: budgets}
+}
+
+// GetBudget returns all budgets, or one with ?device_id= (?scope=global for
+// the global budget)
+func (h *BudgetHandler) GetBudget(c *fiber.Ctx) error {
+	deviceID := c.Query("device_id")
+	if deviceID == "" && c.Query("scope") != "global" {
+		budgets := h.budgets.List()
+		return c.JSON(fiber.Map{
+			"count":   len(budgets),
+			"budgets": budgets,
+		})
+	}
+
+	budget, err := h.budgets.Get(deviceID)
+	if err != nil {
+		return budgetError(c, err)
+	}
+	return c.JSON(budget)
+}
+
+// SetBudget creates or replaces a monthly budget; without device_id it is the
+// global budget over all registered devices
+// Body: {"device_id": "ESP32_001", "unit": "kwh", "limit": 150}
+func (h *BudgetHandler) SetBudget(c *fiber.Ctx) error {
+	var input models.BudgetInput
+	if err := c.BodyParser(&input); err != nil {
+		return utils.ErrorResponse(c, 400, "Invalid request body")
+	}
+
+	username, _ := c.Locals("username").(string)
+	budget, err := h.budgets.Set(input, username)
+	if err != nil {
+		return budgetError(c, err)
+	}
+
+	log.Printf("💰 Budget %s %.2f %s set by %s", budgetScope(budget.DeviceID), budget.Limit, budget.Unit, username)
+	return c.JSON(budget)
+}
+
+// DeleteBudget removes the budget of ?device_id= (empty = global)
+func (h *BudgetHandler) DeleteBudget(c *fiber.Ctx) error {
+	deviceID := c.Query("device_id")
+	if err := h.budgets.Delete(deviceID); err != nil {
+		return budgetError(c, err)
+	}
+
+	log.Printf("💰 Budget %s deleted by %v", budgetScope(deviceID), c.Locals("username"))
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Budget deleted",
+	})
+}
+
+// GetBudgetStatus returns month-to-date usage, percent used and the
+// end-of-month projection for ?device_id= (empty = global budget)
+func (h *BudgetHandler) GetBudgetStatus(c *fiber.Ctx) error {
+	if !h.db.IsEnabled() {
+		return iotdbUnavailable(c)
+	}
+
+	status, err := h.budgets.Status(c.UserContext(), c.Query("device_id"), time.Now())
+	if err != nil {
+		if errors.Is(err, repositories.ErrBudgetNotFound) {
+			return budgetError(c, err)
+		}
+		return dbError(c, err, "Failed to compute budget status")
+	}
+	return c.JSON(status)
+}
+
+func budgetScope(deviceID string) string {
+	if deviceID == "" {
+		return "global"
+	}
+	return deviceID
+}
+
+func budgetError(c *fiber.Ctx, err error) error {
+	status := 500
+	switch {
+	case errors.Is(err, services.ErrInvalidBudget):
+		status = 400
+	case errors.Is(err, repositories.ErrBudgetNotFound), errors.Is(err, repositories.ErrDeviceNotFound):
+		status = 404
+	}
+
+	return utils.ErrorResponse(c, status, err.Error())
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"wattwise/internal/models"
+	"wattwise/internal/mqtt"
+	"wattwise/internal/repositories"
+	"wattwise/internal/services"
+	"wattwise/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CommandPublisher sends commands and control messages to devices (*mqtt.Publisher)
+type CommandPublisher interface {
+	PublishCommand(deviceID string, command interface{}) error
+	PublishControlMessage(deviceID, action, requestID string, params map[string]interface{}) (string, error)
+}
+
+type DeviceHandler struct {
+	deviceService  *services.DeviceService
+	publisher      CommandPublisher
+	commandTracker *services.CommandTracker
+	audit          *services.AuditService
+}
+
+// publisher may be nil, then commands answer 503
+func NewDeviceHandler(deviceService *services.DeviceService, publisher CommandPublisher, commandTracker *services.CommandTracker) *DeviceHandler {
+	return &DeviceHandler{
+		deviceService:  deviceService,
+		publisher:      publisher,
+		commandTracker: commandTracker,
+	}
+}
+
+// SetAudit records sent commands and control actions in the audit trail
+func (h *DeviceHandler) SetAudit(audit *services.AuditService) {
+	h.audit = audit
+}
+
+func (h *DeviceHandler) recordCommand(c *fiber.Ctx, deviceID, command, requestID string) {
+	event := auditEvent(c, models.AuditDeviceCommand, deviceID)
+	event.Details = map[string]interface{}{"command": command, "request_id": requestID}
+	h.audit.Record(event)
+}
+
+// ListDevices returns all registered devices
+func (h *DeviceHandler) ListDevices(c *fiber.Ctx) error {
+	devices := h.deviceService.List()
+
+	return c.JSON(fiber.Map{
+		"count":   len(devices),
+		"devices": devices,
+	})
+}
+
+// GetDevice returns one device by id
+func (h *DeviceHandler) GetDevice(c *fiber.Ctx) error {
+	device, err := h.deviceService.Get(c.Params("id"))
+	if err != nil {
+		return deviceError(c, err)
+	}
+
+	return c.JSON(device)
+}
+
+// RegisterDevice registers a new device
+// Body: {"id": "ESP32_001", "name": "Rumah", "location": "Bandung", "max_power": 2200}
+func (h *DeviceHandler) RegisterDevice(c *fiber.Ctx) error {
+	var device models.Device
+	if err := c.BodyParser(&device); err != nil {
+		return utils.ErrorResponse(c, 400, "Invalid request body")
+	}
+
+	registered, err := h.deviceService.Register(device)
+	if err != nil {
+		return deviceError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(registered)
+}
+
+// UpdateDevice changes name, location and/or max_power of a device
+func (h *DeviceHandler) UpdateDevice(c *fiber.Ctx) error {
+	var update models.DeviceUpdate
+	if err := c.BodyParser(&update); err != nil {
+		return utils.ErrorResponse(c, 400, "Invalid request body")
+	}
+
+	device, err := h.deviceService.Update(c.Params("id"), update)
+	if err != nil {
+		return deviceError(c, err)
+	}
+
+	return c.JSON(device)
+}
+
+// DeviceCommand is the body of POST /api/devices/:id/command, published as-is
+// (with request_id) on wattwise/commands/<id>
+type DeviceCommand struct {
+	Command   string                 `json:"command"`
+	Params    map[string]interface{} `json:"params,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"` // correlation id, echoed in the ack
+
+	// Body lama {"action": "relay_on"} sebelum ada /control
+	Action string `json:"action,omitempty"`
+}
+
+// ControlRequest is the body of POST /api/devices/:id/control
+type ControlRequest struct {
+	Action    string                 `json:"action"`
+	Params    map[string]interface{} `json:"params"`
+	RequestID string                 `json:"request_id"` // optional correlation id
+}
+
+const (
+	maxCommandLength = 64
+
+	// ?wait=true&timeout=... dibatasi supaya request HTTP tidak menggantung
+	defaultCommandWait = 5 * time.Second
+	maxCommandWait     = 30 * time.Second
+)
+
+// SendCommand publishes a free-form command on wattwise/commands/<id>
+// Body: {"command": "set_interval", "params": {"seconds": 10}, "request_id": "optional"}
+func (h *DeviceHandler) SendCommand(c *fiber.Ctx) error {
+	deviceID := c.Params("id")
+	if _, err := h.deviceService.Get(deviceID); err != nil {
+		return deviceError(c, err)
+	}
+
+	var req DeviceCommand
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrorResponse(c, 400, "Invalid request body")
+	}
+
+	// Client lama mengirim {"action": ...} ke /command untuk relay
+	if req.Command == "" && req.Action != "" {
+		return h.publishControl(c, deviceID, ControlRequest{Action: req.Action, Params: req.Params, RequestID: req.RequestID})
+	}
+
+	if req.Command == "" || len(req.Command) > maxCommandLength {
+		return badParam(c, fieldError("command", "command is required (max %d characters)", maxCommandLength))
+	}
+
+	wait, err := commandWait(c)
+	if err != nil {
+		return badParam(c, err)
+	}
+
+	if h.publisher == nil {
+		return utils.ErrorResponse(c, fiber.StatusServiceUnavailable, "MQTT publisher not available")
+	}
+
+	req.RequestID = h.requestID(c, deviceID, req.RequestID)
+	req.Action = ""
+
+	// Track dulu, ack bisa datang sebelum Publish selesai
+	command := h.commandTracker.Track(deviceID, req.RequestID, req.Command)
+
+	if err := h.publisher.PublishCommand(deviceID, req); err != nil {
+		h.commandTracker.Forget(req.RequestID)
+		log.Printf("❌ Command %s to %s failed: %v", req.Command, deviceID, err)
+		return publishError(c, err)
+	}
+
+	log.Printf("📨 Command %s sent to %s by %v (request %s)", req.Command, deviceID, c.Locals("username"), req.RequestID)
+	h.recordCommand(c, deviceID, req.Command, req.RequestID)
+
+	if wait > 0 {
+		return h.respondAfterAck(c, deviceID, req.RequestID, wait)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"device_id":  deviceID,
+		"command":    req.Command,
+		"topic":      mqtt.CommandTopic(deviceID),
+		"request_id": req.RequestID,
+		"status":     command.Status,
+		"deadline":   command.Deadline,
+	})
+}
+
+// SendControl publishes a control action on wattwise/control/<id>
+// Body: {"action": "relay_off", "params": {}, "request_id": "optional"}
+func (h *DeviceHandler) SendControl(c *fiber.Ctx) error {
+	deviceID := c.Params("id")
+	if _, err := h.deviceService.Get(deviceID); err != nil {
+		return deviceError(c, err)
+	}
+
+	var req ControlRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrorResponse(c, 400, "Invalid request body")
+	}
+
+	return h.publishControl(c, deviceID, req)
+}
+
+func (h *DeviceHandler) publishControl(c *fiber.Ctx, deviceID string, req ControlRequest) error {
+	if err := services.ValidateCommandAction(req.Action); err != nil {
+		return badParam(c, fieldError("action", "%s", err.Error()))
+	}
+
+	wait, err := commandWait(c)
+	if err != nil {
+		return badParam(c, err)
+	}
+
+	if h.publisher == nil {
+		return utils.ErrorResponse(c, fiber.StatusServiceUnavailable, "MQTT publisher not available")
+	}
+
+	requestID := h.requestID(c, deviceID, req.RequestID)
+
+	// Track dulu, ack bisa datang sebelum Publish selesai
+	command := h.commandTracker.Track(deviceID, requestID, req.Action)
+
+	topic, err := h.publisher.PublishControlMessage(deviceID, req.Action, requestID, req.Params)
+	if err != nil {
+		h.commandTracker.Forget(requestID)
+		log.Printf("❌ Control %s to %s failed: %v", req.Action, deviceID, err)
+		return publishError(c, err)
+	}
+
+	log.Printf("📨 Control %s sent to %s by %v (request %s)", req.Action, deviceID, c.Locals("username"), requestID)
+	h.recordCommand(c, deviceID, req.Action, requestID)
+
+	if wait > 0 {
+		return h.respondAfterAck(c, deviceID, requestID, wait)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"device_id":  deviceID,
+		"action":     req.Action,
+		"topic":      topic,
+		"request_id": requestID,
+		"status":     command.Status,
+		"deadline":   command.Deadline,
+	})
+}
+
+// commandWait parses ?wait=true&timeout=5s; 0 means answer immediately
+func commandWait(c *fiber.Ctx) (time.Duration, error) {
+	if !c.QueryBool("wait") {
+		return 0, nil
+	}
+
+	wait := defaultCommandWait
+	if value := c.Query("timeout"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return 0, fieldError("timeout", "invalid timeout %q, use a duration like 5s", value)
+		}
+		wait = parsed
+	}
+	if wait > maxCommandWait {
+		wait = maxCommandWait
+	}
+	// Sisakan waktu untuk menjawab sebelum REQUEST_TIMEOUT
+	if deadline, ok := c.UserContext().Deadline(); ok {
+		wait = min(wait, time.Until(deadline)-time.Second)
+	}
+	return wait, nil
+}
+
+// respondAfterAck waits for the device's ack: 200 with the ack (and its
+// response payload) when the command finished, 202 when it is still pending
+func (h *DeviceHandler) respondAfterAck(c *fiber.Ctx, deviceID, requestID string, wait time.Duration) error {
+	command, err := h.commandTracker.Wait(deviceID, requestID, wait)
+	if err != nil {
+		return utils.ErrorResponse(c, 404, err.Error())
+	}
+
+	status := fiber.StatusOK
+	if command.Status == models.CommandPending {
+		status = fiber.StatusAccepted
+	}
+	return c.Status(status).JSON(command)
+}
+
+// requestID picks the correlation id: from the body, else X-Request-ID,
+// else generated
+func (h *DeviceHandler) requestID(c *fiber.Ctx, deviceID, fromBody string) string {
+	if fromBody != "" {
+		return fromBody
+	}
+	if requestID, _ := c.Locals("requestid").(string); requestID != "" {
+		return requestID
+	}
+	return fmt.Sprintf("%s-%d", deviceID, time.Now().UnixNano())
+}
+
+// publishError answers 504 when the broker did not confirm in time, else 503
+func publishError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusServiceUnavailable
+	if errors.Is(err, mqtt.ErrPublishTimeout) {
+		status = fiber.StatusGatewayTimeout
+	}
+	return utils.ErrorResponse(c, status, err.Error())
+}
+
+// GetCommandStatus returns pending/acked/failed/timeout for a sent command
+func (h *DeviceHandler) GetCommandStatus(c *fiber.Ctx) error {
+	command, err := h.commandTracker.Get(c.Params("id"), c.Params("reqid"))
+	if err != nil {
+		return utils.ErrorResponse(c, 404, err.Error())
+	}
+
+	return c.JSON(command)
+}
+
+func deviceError(c *fiber.Ctx, err error) error {
+	status := 500
+	switch {
+	case errors.Is(err, services.ErrInvalidDevice):
+		status = 400
+	case errors.Is(err, repositories.ErrDeviceNotFound):
+		status = 404
+	case errors.Is(err, repositories.ErrDeviceExists):
+		status = 409
+	}
+
+	return utils.ErrorResponse(c, status, err.Error())
+}
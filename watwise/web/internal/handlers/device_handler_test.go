@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"wattwise/internal/models"
+	"wattwise/internal/mqtt"
+	"wattwise/internal/repositories"
+	"wattwise/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// published is one message sent through fakePublisher
+type published struct {
+	topic     string
+	action    string // command or control action
+	requestID string
+	params    map[string]interface{}
+}
+
+// fakePublisher records commands instead of publishing them. err fails every
+// publish; ack, when set, is the device's answer to each published message.
+type fakePublisher struct {
+	tracker *services.CommandTracker
+	err     error
+	ack     string
+
+	mu   sync.Mutex
+	sent []published
+}
+
+func (p *fakePublisher) PublishCommand(deviceID string, command interface{}) error {
+	cmd := command.(DeviceCommand)
+	return p.publish(deviceID, published{topic: mqtt.CommandTopic(deviceID), action: cmd.Command, requestID: cmd.RequestID, params: cmd.Params})
+}
+
+func (p *fakePublisher) PublishControlMessage(deviceID, action, requestID string, params map[string]interface{}) (string, error) {
+	topic := mqtt.ControlTopic(deviceID)
+	return topic, p.publish(deviceID, published{topic: topic, action: action, requestID: requestID, params: params})
+}
+
+func (p *fakePublisher) publish(deviceID string, msg published) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.mu.Lock()
+	p.sent = append(p.sent, msg)
+	p.mu.Unlock()
+	if p.ack != "" {
+		// Ack datang lewat MQTT, di goroutine lain
+		go p.tracker.Ack(deviceID, models.CommandAck{RequestID: msg.requestID, Status: p.ack, Message: "done"})
+	}
+	return nil
+}
+
+func (p *fakePublisher) messages() []published {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]published(nil), p.sent...)
+}
+
+// newDeviceTestApp serves the device command routes like routes.setupRoutes
+// (no auth) for the registered device ESP32_001
+func newDeviceTestApp(t *testing.T, publisher *fakePublisher) *fiber.App {
+	t.Helper()
+	repo, err := repositories.NewDeviceRepository("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deviceService := services.NewDeviceService(repo, discardLogger())
+	if _, err := deviceService.Register(models.Device{ID: "ESP32_001"}); err != nil {
+		t.Fatal(err)
+	}
+	tracker := services.NewCommandTracker(time.Minute, discardLogger())
+
+	var handler *DeviceHandler
+	if publisher != nil {
+		publisher.tracker = tracker
+		handler = NewDeviceHandler(deviceService, publisher, tracker)
+	} else {
+		handler = NewDeviceHandler(deviceService, nil, tracker)
+	}
+
+	app := fiber.New()
+	app.Post("/api/devices/:id/control", handler.SendControl)
+	app.Post("/api/devices/:id/command", handler.SendCommand)
+	app.Get("/api/devices/:id/command/:reqid", handler.GetCommandStatus)
+	return app
+}
+
+func TestSendControl(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		body      string
+		publisher *fakePublisher
+		status    int
+		sent      string // action published, "" = nothing
+	}{
+		{"relay on", "/api/devices/ESP32_001/control", `{"action":"relay_on","request_id":"r1"}`, &fakePublisher{}, 202, "relay_on"},
+		{"legacy action on /command", "/api/devices/ESP32_001/command", `{"action":"relay_off"}`, &fakePublisher{}, 202, "relay_off"},
+		{"unknown action", "/api/devices/ESP32_001/control", `{"action":"self_destruct"}`, &fakePublisher{}, 400, ""},
+		{"missing action", "/api/devices/ESP32_001/control", `{}`, &fakePublisher{}, 400, ""},
+		{"invalid body", "/api/devices/ESP32_001/control", `{"action":`, &fakePublisher{}, 400, ""},
+		{"unknown device", "/api/devices/NOPE/control", `{"action":"relay_on"}`, &fakePublisher{}, 404, ""},
+		{"bad timeout", "/api/devices/ESP32_001/control?wait=true&timeout=soon", `{"action":"relay_on"}`, &fakePublisher{}, 400, ""},
+		{"broker down", "/api/devices/ESP32_001/control", `{"action":"relay_on"}`, &fakePublisher{err: errors.New("MQTT client not connected")}, 503, ""},
+		{"publish timeout", "/api/devices/ESP32_001/control", `{"action":"relay_on"}`, &fakePublisher{err: fmt.Errorf("failed to publish: %w", mqtt.ErrPublishTimeout)}, 504, ""},
+		{"no publisher", "/api/devices/ESP32_001/control", `{"action":"relay_on"}`, nil, 503, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newDeviceTestApp(t, tt.publisher)
+			var body struct {
+				RequestID string `json:"request_id"`
+				Topic     string `json:"topic"`
+				Status    string `json:"status"`
+			}
+			if status := doJSON(t, app, "POST", tt.url, tt.body, &body); status != tt.status {
+				t.Fatalf("status = %d, want %d", status, tt.status)
+			}
+			if tt.publisher == nil {
+				return
+			}
+
+			sent := tt.publisher.messages()
+			if tt.sent == "" {
+				if len(sent) != 0 {
+					t.Errorf("published %+v, want nothing", sent)
+				}
+				return
+			}
+			if len(sent) != 1 || sent[0].action != tt.sent || sent[0].topic != mqtt.ControlTopic("ESP32_001") {
+				t.Fatalf("published %+v, want %s on %s", sent, tt.sent, mqtt.ControlTopic("ESP32_001"))
+			}
+			if body.RequestID == "" || body.RequestID != sent[0].requestID || body.Status != models.CommandPending || body.Topic != sent[0].topic {
+				t.Errorf("response = %+v, want pending with the published request_id and topic", body)
+			}
+		})
+	}
+}
+
+func TestSendCommand(t *testing.T) {
+	publisher := &fakePublisher{}
+	app := newDeviceTestApp(t, publisher)
+
+	var body struct {
+		Command   string `json:"command"`
+		RequestID string `json:"request_id"`
+		Topic     string `json:"topic"`
+	}
+	status := doJSON(t, app, "POST", "/api/devices/ESP32_001/command", `{"command":"set_interval","params":{"seconds":10},"request_id":"abc"}`, &body)
+	if status != 202 {
+		t.Fatalf("status = %d, want 202", status)
+	}
+	sent := publisher.messages()
+	if len(sent) != 1 || sent[0].topic != mqtt.CommandTopic("ESP32_001") || sent[0].action != "set_interval" || sent[0].requestID != "abc" || sent[0].params["seconds"] != float64(10) {
+		t.Fatalf("published %+v, want set_interval {seconds: 10} as abc on %s", sent, mqtt.CommandTopic("ESP32_001"))
+	}
+	if body.Command != "set_interval" || body.RequestID != "abc" || body.Topic != sent[0].topic {
+		t.Errorf("response = %+v", body)
+	}
+
+	// Status bisa di-poll sampai device ack
+	var command models.CommandStatus
+	if status := doJSON(t, app, "GET", "/api/devices/ESP32_001/command/abc", "", &command); status != 200 || command.Status != models.CommandPending {
+		t.Errorf("GET status = %d %q, want 200 pending", status, command.Status)
+	}
+	if status := doJSON(t, app, "GET", "/api/devices/OTHER/command/abc", "", nil); status != 404 {
+		t.Errorf("status of another device's command = %d, want 404", status)
+	}
+
+	for _, invalid := range []string{`{}`, `{"command":""}`, `{"command":"` + strings.Repeat("x", maxCommandLength+1) + `"}`} {
+		if status := doJSON(t, app, "POST", "/api/devices/ESP32_001/command", invalid, nil); status != 400 {
+			t.Errorf("%s: status = %d, want 400", invalid, status)
+		}
+	}
+	if n := len(publisher.messages()); n != 1 {
+		t.Errorf("%d messages published, want 1", n)
+	}
+}
+
+func TestSendCommandPublishFailureForgotten(t *testing.T) {
+	app := newDeviceTestApp(t, &fakePublisher{err: errors.New("MQTT client not connected")})
+	if status := doJSON(t, app, "POST", "/api/devices/ESP32_001/control", `{"action":"relay_on","request_id":"lost"}`, nil); status != 503 {
+		t.Fatalf("status = %d, want 503", status)
+	}
+	// Command yang gagal dikirim tidak menunggu ack
+	if status := doJSON(t, app, "GET", "/api/devices/ESP32_001/command/lost", "", nil); status != 404 {
+		t.Errorf("status of the failed command = %d, want 404", status)
+	}
+}
+
+func TestSendControlWaitsForAck(t *testing.T) {
+	tests := []struct {
+		name   string
+		ack    string
+		query  string
+		status int
+		want   string
+	}{
+		{"acked", "ok", "?wait=true&timeout=5s", 200, models.CommandAcked},
+		{"device error", "error", "?wait=true&timeout=5s", 200, models.CommandFailed},
+		{"no ack in time", "", "?wait=true&timeout=50ms", 202, models.CommandPending},
+		{"no wait", "ok", "", 202, models.CommandPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &fakePublisher{ack: tt.ack}
+			app := newDeviceTestApp(t, publisher)
+
+			var command models.CommandStatus
+			if status := doJSON(t, app, "POST", "/api/devices/ESP32_001/control"+tt.query, `{"action":"reset_energy"}`, &command); status != tt.status {
+				t.Fatalf("status = %d, want %d", status, tt.status)
+			}
+			if command.Status != tt.want {
+				t.Errorf("command status = %q, want %q", command.Status, tt.want)
+			}
+			if tt.want != models.CommandPending && (command.Message != "done" || command.AckedAt == nil) {
+				t.Errorf("command = %+v, want the ack message and time", command)
+			}
+		})
+	}
+}
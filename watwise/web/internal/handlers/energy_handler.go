@@ -1,13 +1,20 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"path/filepath"
+	"slices"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
+	"wattwise/internal/config"
 	"wattwise/internal/database"
+	"wattwise/internal/middleware"
 	"wattwise/internal/models"
 	"wattwise/internal/services"
 	"wattwise/internal/utils"
@@ -16,15 +23,81 @@ import (
 )
 
 type EnergyHandler struct {
-	db            *database.IoTDB
+	db            database.Store
 	energyService *services.EnergyService
+	cfg           *config.Config
+	location      *time.Location // default zone for day buckets, see TIMEZONE
+
+	audit *services.AuditService
 }
 
-func NewEnergyHandler(db *database.IoTDB) *EnergyHandler {
+func NewEnergyHandler(db database.Store, energyService *services.EnergyService, cfg *config.Config) *EnergyHandler {
+	location := time.Local
+	if cfg.Server.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Server.Timezone)
+		if err != nil {
+			log.Printf("⚠️  Invalid TIMEZONE=%q, using server local time: %v", cfg.Server.Timezone, err)
+		} else {
+			location = loc
+		}
+	}
+
 	return &EnergyHandler{
 		db:            db,
-		energyService: services.NewEnergyService(db),
+		energyService: energyService,
+		cfg:           cfg,
+		location:      location,
+	}
+}
+
+// SetAudit records data deletions in the audit trail
+func (h *EnergyHandler) SetAudit(audit *services.AuditService) {
+	h.audit = audit
+}
+
+// dbErrorStatus maps a database error to an HTTP status: 503 when IoTDB is
+// temporarily unreachable (dashboard can retry), 504 when the query ran past
+// IOTDB_QUERY_TIMEOUT, 500 otherwise
+func dbErrorStatus(err error) int {
+	switch {
+	case database.IsUnavailable(err):
+		return fiber.StatusServiceUnavailable
+	case errors.Is(err, database.ErrQueryTimeout):
+		return fiber.StatusGatewayTimeout
+	}
+	return fiber.StatusInternalServerError
+}
+
+// dbError sends a database error with the status of dbErrorStatus and code
+// IOTDB_UNAVAILABLE, IOTDB_TIMEOUT or INTERNAL_ERROR
+func dbError(c *fiber.Ctx, err error, message string) error {
+	status := dbErrorStatus(err)
+	return utils.CodedErrorResponse(c, status, dbErrorCode(status), message, nil)
+}
+
+func dbErrorCode(status int) string {
+	switch status {
+	case fiber.StatusServiceUnavailable:
+		return utils.CodeIoTDBUnavailable
+	case fiber.StatusGatewayTimeout:
+		return utils.CodeIoTDBTimeout
 	}
+	return utils.CodeInternal
+}
+
+// dataSourceMeta is {"data_source": "dummy"} for a request answered from
+// generated readings (see middleware.DataSource), nil otherwise
+func dataSourceMeta(c *fiber.Ctx) fiber.Map {
+	if source, ok := c.Locals(middleware.DataSourceLocal).(string); ok {
+		return fiber.Map{"data_source": source}
+	}
+	return nil
+}
+
+// iotdbUnavailable answers 503 IOTDB_UNAVAILABLE for endpoints that need a
+// live connection
+func iotdbUnavailable(c *fiber.Ctx) error {
+	return utils.CodedErrorResponse(c, fiber.StatusServiceUnavailable, utils.CodeIoTDBUnavailable, "IoTDB is not connected", nil)
 }
 
 // GetLatestData gets the most recent energy reading for a device
@@ -32,35 +105,42 @@ func (h *EnergyHandler) GetLatestData(c *fiber.Ctx) error {
 	deviceID := c.Query("device_id")
 
 	if deviceID == "" {
-		dataList, err := h.db.GetLatestData(1)
-		if err != nil {
-			log.Printf("ERROR: GetLatestData failed: %v", err)
-			return utils.ErrorResponse(c, fiber.StatusInternalServerError,
-				"Failed to query latest data: "+err.Error())
-		}
+		data, age, cached := h.energyService.CachedLatest(models.DefaultDeviceID)
+		source := "cache"
+		if !cached {
+			dataList, err := h.db.GetLatestData(c.UserContext(), models.DefaultDeviceID, 1)
+			if err != nil {
+				log.Printf("ERROR: GetLatestData failed: %v", err)
+				return dbError(c, err, "Failed to query latest data")
+			}
 
-		if len(dataList) == 0 {
-			return utils.SuccessResponse(c, fiber.Map{})
+			if len(dataList) == 0 {
+				return utils.SuccessResponse(c, fiber.Map{}, dataSourceMeta(c))
+			}
+			data, source = dataList[0], "iotdb"
+			if dataSourceMeta(c) != nil {
+				source = "dummy"
+			}
+			age = max(time.Since(time.UnixMilli(data.Timestamp)), 0)
 		}
 
-		data := dataList[0]
 		response := fiber.Map{
-			"timestamp":  data.Timestamp,
-			"voltage":    data.Voltage,
-			"current":    data.Current,
-			"power":      data.Power,
-			"energy":     data.Energy,
-			"prediction": data.Prediction,
+			"timestamp":   data.Timestamp,
+			"voltage":     data.Voltage,
+			"current":     data.Current,
+			"power":       data.Power,
+			"energy":      data.Energy,
+			"prediction":  data.Prediction,
+			"age_seconds": age.Seconds(),
+			"source":      source,
 		}
 
-		return utils.SuccessResponse(c, response)
+		return utils.SuccessResponse(c, response, dataSourceMeta(c))
 	}
 
-	reading, err := h.energyService.GetLatestData(deviceID)
+	reading, err := h.energyService.GetLatestData(c.UserContext(), deviceID)
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return utils.ErrorResponse(c, 404, err.Error())
 	}
 
 	return c.JSON(reading)
@@ -68,63 +148,60 @@ func (h *EnergyHandler) GetLatestData(c *fiber.Ctx) error {
 
 // GetHistoricalData gets historical energy readings
 func (h *EnergyHandler) GetHistoricalData(c *fiber.Ctx) error {
-	deviceID := c.Query("device_id")
-	if deviceID == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "device_id is required",
-		})
-	}
-
-	limit, _ := strconv.Atoi(c.Query("limit", "100"))
-	if limit <= 0 || limit > 1000 {
-		limit = 100
+	req, err := parseHistoricalDataRequest(c)
+	if err != nil {
+		return badParam(c, err)
 	}
 
-	var startTime, endTime int64
-
-	if startTimeStr := c.Query("start_time"); startTimeStr != "" {
-		startTime, _ = strconv.ParseInt(startTimeStr, 10, 64)
-	} else {
-		startTime = time.Now().Add(-24 * time.Hour).UnixMilli()
-	}
+	// Body ditulis setelah handler selesai, c tidak boleh dipakai lagi di sana
+	return streamData(c, fiber.Map{"device_id": req.DeviceID}, func(ctx context.Context, emit func(interface{}) error) error {
+		return h.energyService.StreamHistoricalData(ctx, req.DeviceID, req.StartTime, req.EndTime, req.Limit,
+			func(reading models.EnergyReading) error { return emit(reading) })
+	})
+}
 
-	if endTimeStr := c.Query("end_time"); endTimeStr != "" {
-		endTime, _ = strconv.ParseInt(endTimeStr, 10, 64)
-	} else {
-		endTime = time.Now().UnixMilli()
+// GetRawData streams every reading of a range as NDJSON, one EnergyData per
+// line, oldest first, for data pipelines
+// start/end accept unix ms or RFC 3339, summary=true appends a count line
+// Usage: GET /api/energy/raw?device_id=ESP32_001&start=2025-01-01T00:00:00Z&end=2025-02-01T00:00:00Z
+// Default: 24 jam terakhir
+func (h *EnergyHandler) GetRawData(c *fiber.Ctx) error {
+	q := newQueryParams(c)
+	now := time.Now()
+	deviceID := q.required("device_id")
+	start := q.timestamp("start", now.Add(-24*time.Hour).UnixMilli())
+	end := q.timestamp("end", now.UnixMilli())
+	if !q.failed("start") && !q.failed("end") {
+		q.add("end", checkRange("start", "end", start, end))
 	}
-
-	readings, err := h.energyService.GetHistoricalData(deviceID, startTime, endTime, limit)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	if err := q.err(); err != nil {
+		return badParam(c, err)
 	}
 
-	return c.JSON(fiber.Map{
-		"device_id": deviceID,
-		"count":     len(readings),
-		"data":      readings,
+	return streamNDJSON(c, c.QueryBool("summary"), func(ctx context.Context, emit func(interface{}) error) error {
+		return h.db.StreamRangeAscending(ctx, deviceID, start, end,
+			func(data models.EnergyData) error { return emit(data) })
 	})
 }
 
 // ✅ FIXED: GetData returns latest N records with proper limit handling
+// Dengan order, page atau page_size hasilnya satu halaman, lihat getDataPage
 func (h *EnergyHandler) GetData(c *fiber.Ctx) error {
-	limitStr := c.Query("limit", "50")
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil {
-		log.Printf("⚠️ Invalid limit parameter: %s, using default 50", limitStr)
-		limit = 50
+	if c.Query("order") != "" || c.Query("page") != "" || c.Query("page_size") != "" {
+		return h.getDataPage(c)
+	}
+
+	q := newQueryParams(c)
+	limit := q.intRange("limit", 50, 0, math.MaxInt32)
+	if err := q.err(); err != nil {
+		return badParam(c, err)
 	}
-	
+
 	log.Printf("📊 GetData called with limit: %d", limit)
 
 	// ✅ Handle special limit values
 	if limit == 0 {
 		log.Printf("🔍 Request for ALL data detected (limit=0)")
-	} else if limit < 0 {
-		log.Printf("⚠️ Negative limit (%d), using default 50", limit)
-		limit = 50
 	} else if limit > 1000000 {
 		log.Printf("⚠️ Very large limit (%d), treating as 'fetch all'", limit)
 		limit = 0
@@ -135,112 +212,94 @@ func (h *EnergyHandler) GetData(c *fiber.Ctx) error {
 		return utils.SuccessResponse(c, []models.EnergyData{})
 	}
 
-	log.Printf("📥 Fetching records from IoTDB (limit=%d)...", limit)
-	
-	dataList, err := h.db.GetLatestData(limit)
+	log.Printf("📥 Streaming records from IoTDB (limit=%d)...", limit)
+
+	// Ditulis per baris selama result set dibaca, limit=0 tidak lagi
+	// menampung seluruh data di memory
+	deviceID := c.Query("device_id", models.DefaultDeviceID)
+	return streamData(c, nil, func(ctx context.Context, emit func(interface{}) error) error {
+		return h.db.StreamLatestData(ctx, deviceID, limit, func(data models.EnergyData) error { return emit(data) })
+	})
+}
+
+// getDataPage answers GET /api/energy/data?order=asc&page=2&page_size=100
+// with {"total", "page", "page_size", "order", "data"}; ordering and paging
+// run in IoTDB
+func (h *EnergyHandler) getDataPage(c *fiber.Ctx) error {
+	q := newQueryParams(c)
+	order := q.oneOf("order", "desc", "asc", "desc")
+	page := q.intRange("page", 1, 1, math.MaxInt32)
+	pageSize := q.intRange("page_size", 50, 1, 1000)
+	if err := q.err(); err != nil {
+		return badParam(c, err)
+	}
+
+	deviceID := c.Query("device_id", models.DefaultDeviceID)
+	total, err := h.db.CountReadings(c.UserContext(), deviceID)
 	if err != nil {
-		log.Printf("❌ ERROR in GetData: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"data":    []models.EnergyData{},
-			"error":   err.Error(),
-			"message": "Failed to fetch from IoTDB",
-		})
+		log.Printf("ERROR: CountReadings failed: %v", err)
+		return dbError(c, err, "Failed to count readings")
 	}
 
-	if len(dataList) == 0 {
-		log.Printf("⚠️ GetData returned 0 records")
-		return utils.SuccessResponse(c, []models.EnergyData{})
+	fields := fiber.Map{
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+		"order":     order,
+	}
+	offset := (page - 1) * pageSize
+	if int64(offset) >= total {
+		fields["data"] = []models.EnergyData{}
+		fields["count"] = 0
+		fields["success"] = true
+		return c.JSON(fields)
 	}
 
-	log.Printf("✅ GetData successful: returning %d records", len(dataList))
-	return utils.SuccessResponse(c, dataList)
+	return streamData(c, fields, func(ctx context.Context, emit func(interface{}) error) error {
+		return h.db.StreamPage(ctx, deviceID, order == "asc", offset, pageSize, func(data models.EnergyData) error { return emit(data) })
+	})
 }
 
 // GetFilteredData handles filtered energy data requests
 func (h *EnergyHandler) GetFilteredData(c *fiber.Ctx) error {
-	deviceID := c.Query("device_id")
-	filterType := c.Query("filter", "daily")
-	startDate := c.Query("startDate")
-	endDate := c.Query("endDate")
-	customDays := c.Query("days")
+	req, err := h.parseFilteredDataRequest(c)
+	if err != nil {
+		return badParam(c, err)
+	}
 
-	if deviceID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"error":   "device_id is required",
-		})
+	deviceID, loc := req.DeviceID, req.Location
+	var startDate, endDate string
+	if !req.StartDate.IsZero() && !req.EndDate.IsZero() {
+		startDate = req.StartDate.Format(dateLayout)
+		endDate = req.EndDate.Format(dateLayout)
 	}
 
 	var results []models.FilteredEnergyData
-	var err error
 
-	switch filterType {
+	switch req.Filter {
 	case "hourly":
-		if startDate == "" || endDate == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"success": false,
-				"error":   "startDate and endDate are required for hourly filter",
-			})
-		}
-		results, err = h.getHourlyData(deviceID, startDate, endDate)
-
+		results, err = h.getHourlyData(c.UserContext(), deviceID, startDate, endDate, loc)
 	case "daily":
-		if startDate == "" || endDate == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"success": false,
-				"error":   "startDate and endDate are required for daily filter",
-			})
-		}
-		results, err = h.getDailyData(deviceID, startDate, endDate)
-
+		results, err = h.getDailyData(c.UserContext(), deviceID, startDate, endDate, loc)
 	case "weekly":
-		if startDate == "" || endDate == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"success": false,
-				"error":   "startDate and endDate are required for weekly filter",
-			})
-		}
-		results, err = h.getWeeklyData(deviceID, startDate, endDate)
-
+		results, err = h.getWeeklyData(c.UserContext(), deviceID, startDate, endDate, loc)
 	case "monthly":
-		if startDate == "" {
-			startDate = time.Now().AddDate(0, 0, -30).Format("2006-01-02")
-		}
-		if endDate == "" {
-			endDate = time.Now().Format("2006-01-02")
-		}
-		results, err = h.getMonthlyData(deviceID, startDate, endDate)
-
+		results, err = h.getMonthlyData(c.UserContext(), deviceID, startDate, endDate, loc)
 	case "custom_days":
-		if customDays == "" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"success": false,
-				"error":   "days parameter required for custom_days filter",
-			})
-		}
-		results, err = h.getCustomDaysData(deviceID, customDays)
-
-	default:
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"error":   "Invalid filter type. Use: hourly, daily, weekly, monthly, or custom_days",
-		})
+		results, err = h.getCustomDaysData(c.UserContext(), deviceID, req.Days, loc)
 	}
 
 	if err != nil {
 		log.Printf("Error fetching filtered data: %v", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"error":   "Failed to fetch filtered data: " + err.Error(),
-		})
+		return dbError(c, err, "Failed to fetch filtered data")
 	}
 
 	response := models.FilteredResponse{
-		Success: true,
-		Filter:  filterType,
-		Count:   len(results),
-		Data:    results,
+		Success:  true,
+		Filter:   req.Filter,
+		Timezone: loc.String(),
+		Count:    len(results),
+		Data:     results,
 	}
 
 	if startDate != "" && endDate != "" {
@@ -254,21 +313,21 @@ func (h *EnergyHandler) GetFilteredData(c *fiber.Ctx) error {
 }
 
 // getHourlyData aggregates data by hour
-func (h *EnergyHandler) getHourlyData(deviceID, startDate, endDate string) ([]models.FilteredEnergyData, error) {
-	startTime, err := time.Parse("2006-01-02", startDate)
+func (h *EnergyHandler) getHourlyData(ctx context.Context, deviceID, startDate, endDate string, loc *time.Location) ([]models.FilteredEnergyData, error) {
+	startTime, err := time.ParseInLocation("2006-01-02", startDate, loc)
 	if err != nil {
 		return nil, err
 	}
-	endTime, err := time.Parse("2006-01-02", endDate)
+	endTime, err := time.ParseInLocation("2006-01-02", endDate, loc)
 	if err != nil {
 		return nil, err
 	}
-	endTime = endTime.Add(24 * time.Hour)
+	endTime = endTime.AddDate(0, 0, 1) // bukan +24 jam, hari DST bisa 23/25 jam
 
 	startTimestamp := startTime.UnixMilli()
 	endTimestamp := endTime.UnixMilli()
 
-	readings, err := h.energyService.GetHistoricalData(deviceID, startTimestamp, endTimestamp, 10000)
+	readings, err := h.energyService.GetHistoricalData(ctx, deviceID, startTimestamp, endTimestamp, 10000)
 	if err != nil {
 		return nil, err
 	}
@@ -276,8 +335,7 @@ func (h *EnergyHandler) getHourlyData(deviceID, startDate, endDate string) ([]mo
 	hourMap := make(map[string]*models.FilteredEnergyData)
 
 	for _, reading := range readings {
-		timestamp := reading.Timestamp.UnixMilli()
-		ts := time.UnixMilli(timestamp)
+		ts := reading.Timestamp.In(loc)
 		hourKey := ts.Format("2006-01-02 15:00:00")
 
 		if _, exists := hourMap[hourKey]; !exists {
@@ -285,23 +343,33 @@ func (h *EnergyHandler) getHourlyData(deviceID, startDate, endDate string) ([]mo
 				TimeGroup: hourKey,
 				Hour:      hourKey,
 				DataCount: 0,
+				// Min/max mulai dari reading pertama, 0W tetap minimum yang valid
+				MinPower: reading.Power,
+				MaxPower: reading.Power,
 			}
 		}
 
 		data := hourMap[hourKey]
-		data.TotalKWh += reading.Energy / 1000
-		data.AvgPower += reading.Power
-		data.AvgVoltage += reading.Voltage
-		data.AvgCurrent += reading.Current
+		w := float64(reading.Weight())
+		data.AvgPower += reading.Power * w
+		data.AvgVoltage += reading.Voltage * w
+		data.AvgCurrent += reading.Current * w
 
 		if reading.Power > data.MaxPower {
 			data.MaxPower = reading.Power
 		}
-		if data.MinPower == 0 || reading.Power < data.MinPower {
+		if reading.Power < data.MinPower {
 			data.MinPower = reading.Power
 		}
 
-		data.DataCount++
+		data.DataCount += reading.Weight()
+	}
+
+	// energy adalah counter kumulatif (kWh), konsumsi = kenaikan counter
+	for key, kwh := range services.ReadingsEnergyBy(readings, func(t time.Time) string { return t.In(loc).Format("2006-01-02 15:00:00") }) {
+		if data, ok := hourMap[key]; ok {
+			data.TotalKWh = kwh
+		}
 	}
 
 	var results []models.FilteredEnergyData
@@ -322,21 +390,25 @@ func (h *EnergyHandler) getHourlyData(deviceID, startDate, endDate string) ([]mo
 }
 
 // getDailyData aggregates data by day
-func (h *EnergyHandler) getDailyData(deviceID, startDate, endDate string) ([]models.FilteredEnergyData, error) {
-	startTime, err := time.Parse("2006-01-02", startDate)
+func (h *EnergyHandler) getDailyData(ctx context.Context, deviceID, startDate, endDate string, loc *time.Location) ([]models.FilteredEnergyData, error) {
+	startTime, err := time.ParseInLocation("2006-01-02", startDate, loc)
 	if err != nil {
 		return nil, err
 	}
-	endTime, err := time.Parse("2006-01-02", endDate)
+	endTime, err := time.ParseInLocation("2006-01-02", endDate, loc)
 	if err != nil {
 		return nil, err
 	}
-	endTime = endTime.Add(24 * time.Hour)
+	endTime = endTime.AddDate(0, 0, 1) // bukan +24 jam, hari DST bisa 23/25 jam
 
 	startTimestamp := startTime.UnixMilli()
 	endTimestamp := endTime.UnixMilli()
 
-	readings, err := h.energyService.GetHistoricalData(deviceID, startTimestamp, endTimestamp, 10000)
+	if results, ok, err := h.getRollupData(ctx, deviceID, startTimestamp, endTimestamp, loc, dailyBucket); ok || err != nil {
+		return results, err
+	}
+
+	readings, err := h.energyService.GetHistoricalData(ctx, deviceID, startTimestamp, endTimestamp, 10000)
 	if err != nil {
 		return nil, err
 	}
@@ -344,8 +416,7 @@ func (h *EnergyHandler) getDailyData(deviceID, startDate, endDate string) ([]mod
 	dayMap := make(map[string]*models.FilteredEnergyData)
 
 	for _, reading := range readings {
-		timestamp := reading.Timestamp.UnixMilli()
-		ts := time.UnixMilli(timestamp)
+		ts := reading.Timestamp.In(loc)
 		dayKey := ts.Format("2006-01-02")
 
 		if _, exists := dayMap[dayKey]; !exists {
@@ -353,23 +424,32 @@ func (h *EnergyHandler) getDailyData(deviceID, startDate, endDate string) ([]mod
 				TimeGroup: dayKey,
 				Date:      dayKey,
 				DataCount: 0,
+				MinPower:  reading.Power,
+				MaxPower:  reading.Power,
 			}
 		}
 
 		data := dayMap[dayKey]
-		data.TotalKWh += reading.Energy / 1000
-		data.AvgPower += reading.Power
-		data.AvgVoltage += reading.Voltage
-		data.AvgCurrent += reading.Current
+		w := float64(reading.Weight())
+		data.AvgPower += reading.Power * w
+		data.AvgVoltage += reading.Voltage * w
+		data.AvgCurrent += reading.Current * w
 
 		if reading.Power > data.MaxPower {
 			data.MaxPower = reading.Power
 		}
-		if data.MinPower == 0 || reading.Power < data.MinPower {
+		if reading.Power < data.MinPower {
 			data.MinPower = reading.Power
 		}
 
-		data.DataCount++
+		data.DataCount += reading.Weight()
+	}
+
+	// energy adalah counter kumulatif (kWh), konsumsi = kenaikan counter
+	for key, kwh := range services.ReadingsEnergyBy(readings, bucketKey(dailyBucket, loc)) {
+		if data, ok := dayMap[key]; ok {
+			data.TotalKWh = kwh
+		}
 	}
 
 	var results []models.FilteredEnergyData
@@ -390,21 +470,25 @@ func (h *EnergyHandler) getDailyData(deviceID, startDate, endDate string) ([]mod
 }
 
 // getWeeklyData aggregates data by week
-func (h *EnergyHandler) getWeeklyData(deviceID, startDate, endDate string) ([]models.FilteredEnergyData, error) {
-	startTime, err := time.Parse("2006-01-02", startDate)
+func (h *EnergyHandler) getWeeklyData(ctx context.Context, deviceID, startDate, endDate string, loc *time.Location) ([]models.FilteredEnergyData, error) {
+	startTime, err := time.ParseInLocation("2006-01-02", startDate, loc)
 	if err != nil {
 		return nil, err
 	}
-	endTime, err := time.Parse("2006-01-02", endDate)
+	endTime, err := time.ParseInLocation("2006-01-02", endDate, loc)
 	if err != nil {
 		return nil, err
 	}
-	endTime = endTime.Add(24 * time.Hour)
+	endTime = endTime.AddDate(0, 0, 1) // bukan +24 jam, hari DST bisa 23/25 jam
 
 	startTimestamp := startTime.UnixMilli()
 	endTimestamp := endTime.UnixMilli()
 
-	readings, err := h.energyService.GetHistoricalData(deviceID, startTimestamp, endTimestamp, 10000)
+	if results, ok, err := h.getRollupData(ctx, deviceID, startTimestamp, endTimestamp, loc, weeklyBucket); ok || err != nil {
+		return results, err
+	}
+
+	readings, err := h.energyService.GetHistoricalData(ctx, deviceID, startTimestamp, endTimestamp, 10000)
 	if err != nil {
 		return nil, err
 	}
@@ -412,8 +496,7 @@ func (h *EnergyHandler) getWeeklyData(deviceID, startDate, endDate string) ([]mo
 	weekMap := make(map[string]*models.FilteredEnergyData)
 
 	for _, reading := range readings {
-		timestamp := reading.Timestamp.UnixMilli()
-		ts := time.UnixMilli(timestamp)
+		ts := reading.Timestamp.In(loc)
 		year, week := ts.ISOWeek()
 		weekKey := fmt.Sprintf("%d-W%02d", year, week)
 
@@ -425,23 +508,32 @@ func (h *EnergyHandler) getWeeklyData(deviceID, startDate, endDate string) ([]mo
 				TimeGroup: weekStartStr,
 				Week:      weekKey,
 				DataCount: 0,
+				MinPower:  reading.Power,
+				MaxPower:  reading.Power,
 			}
 		}
 
 		data := weekMap[weekKey]
-		data.TotalKWh += reading.Energy / 1000
-		data.AvgPower += reading.Power
-		data.AvgVoltage += reading.Voltage
-		data.AvgCurrent += reading.Current
+		w := float64(reading.Weight())
+		data.AvgPower += reading.Power * w
+		data.AvgVoltage += reading.Voltage * w
+		data.AvgCurrent += reading.Current * w
 
 		if reading.Power > data.MaxPower {
 			data.MaxPower = reading.Power
 		}
-		if data.MinPower == 0 || reading.Power < data.MinPower {
+		if reading.Power < data.MinPower {
 			data.MinPower = reading.Power
 		}
 
-		data.DataCount++
+		data.DataCount += reading.Weight()
+	}
+
+	// energy adalah counter kumulatif (kWh), konsumsi = kenaikan counter
+	for key, kwh := range services.ReadingsEnergyBy(readings, bucketKey(weeklyBucket, loc)) {
+		if data, ok := weekMap[key]; ok {
+			data.TotalKWh = kwh
+		}
 	}
 
 	var results []models.FilteredEnergyData
@@ -462,21 +554,25 @@ func (h *EnergyHandler) getWeeklyData(deviceID, startDate, endDate string) ([]mo
 }
 
 // getMonthlyData aggregates data by month
-func (h *EnergyHandler) getMonthlyData(deviceID, startDate, endDate string) ([]models.FilteredEnergyData, error) {
-	startTime, err := time.Parse("2006-01-02", startDate)
+func (h *EnergyHandler) getMonthlyData(ctx context.Context, deviceID, startDate, endDate string, loc *time.Location) ([]models.FilteredEnergyData, error) {
+	startTime, err := time.ParseInLocation("2006-01-02", startDate, loc)
 	if err != nil {
 		return nil, err
 	}
-	endTime, err := time.Parse("2006-01-02", endDate)
+	endTime, err := time.ParseInLocation("2006-01-02", endDate, loc)
 	if err != nil {
 		return nil, err
 	}
-	endTime = endTime.Add(24 * time.Hour)
+	endTime = endTime.AddDate(0, 0, 1) // bukan +24 jam, hari DST bisa 23/25 jam
 
 	startTimestamp := startTime.UnixMilli()
 	endTimestamp := endTime.UnixMilli()
 
-	readings, err := h.energyService.GetHistoricalData(deviceID, startTimestamp, endTimestamp, 10000)
+	if results, ok, err := h.getRollupData(ctx, deviceID, startTimestamp, endTimestamp, loc, monthlyBucket); ok || err != nil {
+		return results, err
+	}
+
+	readings, err := h.energyService.GetHistoricalData(ctx, deviceID, startTimestamp, endTimestamp, 10000)
 	if err != nil {
 		return nil, err
 	}
@@ -484,8 +580,7 @@ func (h *EnergyHandler) getMonthlyData(deviceID, startDate, endDate string) ([]m
 	monthMap := make(map[string]*models.FilteredEnergyData)
 
 	for _, reading := range readings {
-		timestamp := reading.Timestamp.UnixMilli()
-		ts := time.UnixMilli(timestamp)
+		ts := reading.Timestamp.In(loc)
 		monthKey := ts.Format("2006-01")
 
 		if _, exists := monthMap[monthKey]; !exists {
@@ -493,23 +588,32 @@ func (h *EnergyHandler) getMonthlyData(deviceID, startDate, endDate string) ([]m
 				TimeGroup: monthKey + "-01",
 				Date:      monthKey + "-01",
 				DataCount: 0,
+				MinPower:  reading.Power,
+				MaxPower:  reading.Power,
 			}
 		}
 
 		data := monthMap[monthKey]
-		data.TotalKWh += reading.Energy / 1000
-		data.AvgPower += reading.Power
-		data.AvgVoltage += reading.Voltage
-		data.AvgCurrent += reading.Current
+		w := float64(reading.Weight())
+		data.AvgPower += reading.Power * w
+		data.AvgVoltage += reading.Voltage * w
+		data.AvgCurrent += reading.Current * w
 
 		if reading.Power > data.MaxPower {
 			data.MaxPower = reading.Power
 		}
-		if data.MinPower == 0 || reading.Power < data.MinPower {
+		if reading.Power < data.MinPower {
 			data.MinPower = reading.Power
 		}
 
-		data.DataCount++
+		data.DataCount += reading.Weight()
+	}
+
+	// energy adalah counter kumulatif (kWh), konsumsi = kenaikan counter
+	for key, kwh := range services.ReadingsEnergyBy(readings, bucketKey(monthlyBucket, loc)) {
+		if data, ok := monthMap[key]; ok {
+			data.TotalKWh = kwh
+		}
 	}
 
 	var results []models.FilteredEnergyData
@@ -530,45 +634,40 @@ func (h *EnergyHandler) getMonthlyData(deviceID, startDate, endDate string) ([]m
 }
 
 // getCustomDaysData gets data for specific selected days
-func (h *EnergyHandler) getCustomDaysData(deviceID, daysStr string) ([]models.FilteredEnergyData, error) {
-	days := strings.Split(daysStr, ",")
+func (h *EnergyHandler) getCustomDaysData(ctx context.Context, deviceID string, days []time.Time, loc *time.Location) ([]models.FilteredEnergyData, error) {
 	var allResults []models.FilteredEnergyData
 
-	for _, dayStr := range days {
-		dayStr = strings.TrimSpace(dayStr)
+	for _, dayTime := range days {
+		dayStr := dayTime.In(loc).Format(dateLayout)
 
-		dayTime, err := time.Parse("2006-01-02", dayStr)
-		if err != nil {
-			continue
-		}
-
-		nextDay := dayTime.Add(24 * time.Hour)
+		nextDay := dayTime.AddDate(0, 0, 1)
 		startTimestamp := dayTime.UnixMilli()
 		endTimestamp := nextDay.UnixMilli()
 
-		readings, err := h.energyService.GetHistoricalData(deviceID, startTimestamp, endTimestamp, 10000)
+		readings, err := h.energyService.GetHistoricalData(ctx, deviceID, startTimestamp, endTimestamp, 10000)
 		if err != nil {
 			continue
 		}
 
-		var totalKWh, sumPower, sumVoltage, sumCurrent float64
+		totalKWh := services.ReadingsEnergy(readings)
+		var sumPower, sumVoltage, sumCurrent float64
 		var maxPower, minPower float64
 		count := 0
 
 		for _, reading := range readings {
-			totalKWh += reading.Energy / 1000
-			sumPower += reading.Power
-			sumVoltage += reading.Voltage
-			sumCurrent += reading.Current
+			w := float64(reading.Weight())
+			sumPower += reading.Power * w
+			sumVoltage += reading.Voltage * w
+			sumCurrent += reading.Current * w
 
 			if reading.Power > maxPower {
 				maxPower = reading.Power
 			}
-			if minPower == 0 || reading.Power < minPower {
+			if count == 0 || reading.Power < minPower {
 				minPower = reading.Power
 			}
 
-			count++
+			count += reading.Weight()
 		}
 
 		if count > 0 {
@@ -596,32 +695,14 @@ func (h *EnergyHandler) getCustomDaysData(deviceID, daysStr string) ([]models.Fi
 
 // GetDailySummary gets daily energy summary
 func (h *EnergyHandler) GetDailySummary(c *fiber.Ctx) error {
-	deviceID := c.Query("device_id")
-	if deviceID == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "device_id is required",
-		})
-	}
-
-	dateStr := c.Query("date")
-	var date time.Time
-	if dateStr != "" {
-		parsedDate, err := time.Parse("2006-01-02", dateStr)
-		if err != nil {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "invalid date format, use YYYY-MM-DD",
-			})
-		}
-		date = parsedDate
-	} else {
-		date = time.Now()
+	req, err := h.parseSummaryRequest(c)
+	if err != nil {
+		return badParam(c, err)
 	}
 
-	summary, err := h.energyService.CalculateDailySummary(deviceID, date)
+	summary, err := h.energyService.CalculateDailySummary(c.UserContext(), req.DeviceID, req.Date)
 	if err != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return dbError(c, err, "Failed to compute daily summary")
 	}
 
 	return c.JSON(summary)
@@ -629,32 +710,17 @@ func (h *EnergyHandler) GetDailySummary(c *fiber.Ctx) error {
 
 // GetWeeklySummary gets weekly summary
 func (h *EnergyHandler) GetWeeklySummary(c *fiber.Ctx) error {
-	deviceID := c.Query("device_id")
-	if deviceID == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "device_id is required",
-		})
+	req, err := h.parseSummaryRequest(c)
+	if err != nil {
+		return badParam(c, err)
 	}
+	deviceID := req.DeviceID
 
-	summaries := make([]interface{}, 0, 7)
-	now := time.Now()
-
-	for i := 6; i >= 0; i-- {
-		date := now.AddDate(0, 0, -i)
-		summary, err := h.energyService.CalculateDailySummary(deviceID, date)
-		if err == nil {
-			summaries = append(summaries, summary)
-		} else {
-			summaries = append(summaries, fiber.Map{
-				"device_id":    deviceID,
-				"date":         date.Format("2006-01-02"),
-				"total_energy": 0,
-				"avg_power":    0,
-				"max_power":    0,
-				"min_power":    0,
-				"total_cost":   0,
-			})
-		}
+	// Satu query untuk 7 hari, dibagi per hari
+	now := startOfDay(time.Now(), req.Location)
+	summaries, err := h.energyService.CalculateDailySummaries(c.UserContext(), deviceID, now.AddDate(0, 0, -6), 7)
+	if err != nil {
+		return dbError(c, err, "Failed to compute weekly summary")
 	}
 
 	return c.JSON(fiber.Map{
@@ -666,76 +732,262 @@ func (h *EnergyHandler) GetWeeklySummary(c *fiber.Ctx) error {
 
 // GetMonthlySummary gets monthly summary
 func (h *EnergyHandler) GetMonthlySummary(c *fiber.Ctx) error {
-	deviceID := c.Query("device_id")
-	if deviceID == "" {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "device_id is required",
-		})
+	req, err := h.parseSummaryRequest(c)
+	if err != nil {
+		return badParam(c, err)
 	}
 
-	monthStr := c.Query("month")
-	var targetMonth time.Time
-	if monthStr != "" {
-		parsedMonth, err := time.Parse("2006-01", monthStr)
-		if err != nil {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "invalid month format, use YYYY-MM",
-			})
-		}
-		targetMonth = parsedMonth
-	} else {
-		targetMonth = time.Now()
+	// Bulan yang sudah lewat dari SummaryCache, bulan berjalan dengan TTL pendek
+	summary, err := h.energyService.GetMonthlySummary(c.UserContext(), req.DeviceID, req.Month)
+	if err != nil {
+		return dbError(c, err, "Failed to compute monthly summary")
 	}
 
-	startOfMonth := time.Date(targetMonth.Year(), targetMonth.Month(), 1, 0, 0, 0, 0, targetMonth.Location())
-	endOfMonth := startOfMonth.AddDate(0, 1, -1)
+	return c.JSON(summary)
+}
 
-	summaries := make([]interface{}, 0)
-	var totalEnergy, totalCost float64
+// GetComparison compares the current period total with the previous period.
+// With device_ids it compares several devices over the same buckets instead.
+func (h *EnergyHandler) GetComparison(c *fiber.Ctx) error {
+	if c.Query("device_ids") != "" {
+		return h.compareDevices(c)
+	}
+
+	q := newQueryParams(c)
+	deviceID := q.required("device_id")
+	period := q.oneOf("period", "weekly", "daily", "weekly", "monthly")
+	if err := q.err(); err != nil {
+		return badParam(c, err)
+	}
+
+	comparison, err := h.energyService.ComparePeriods(c.UserContext(), deviceID, period, time.Now().In(h.location))
+	if err != nil {
+		log.Printf("ERROR: ComparePeriods failed: %v", err)
+		return dbError(c, err, "Failed to compare periods")
+	}
+
+	return c.JSON(comparison)
+}
 
-	for d := startOfMonth; d.Before(endOfMonth.AddDate(0, 0, 1)); d = d.AddDate(0, 0, 1) {
-		summary, err := h.energyService.CalculateDailySummary(deviceID, d)
-		if err == nil {
-			summaries = append(summaries, summary)
-			totalEnergy += summary.TotalEnergy
-			totalCost += summary.TotalCost
+// compareDevices overlays several devices on the same time buckets
+// Usage: GET /api/energy/compare?device_ids=ESP32_001,ESP32_002&startDate=2025-01-01&endDate=2025-01-31&granularity=daily
+func (h *EnergyHandler) compareDevices(c *fiber.Ctx) error {
+	var deviceIDs []string
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(c.Query("device_ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" && !seen[id] {
+			seen[id] = true
+			deviceIDs = append(deviceIDs, id)
 		}
 	}
+	q := newQueryParams(c)
+	if len(deviceIDs) == 0 {
+		q.add("device_ids", requiredError("device_ids"))
+	}
+	if len(deviceIDs) > services.MaxCompareDevices {
+		q.add("device_ids", fieldError("device_ids", "at most %d devices can be compared", services.MaxCompareDevices))
+	}
+	granularity := q.oneOf("granularity", "daily", services.CompareGranularities...)
 
-	return c.JSON(fiber.Map{
-		"device_id":       deviceID,
-		"month":           targetMonth.Format("2006-01"),
-		"total_energy":    totalEnergy,
-		"total_cost":      totalCost,
-		"daily_summaries": summaries,
-	})
+	// Default: 7 hari terakhir sampai hari ini
+	startDate, endDate := q.dateRange("startDate", "endDate", 7, time.Local)
+	if granularity == "hourly" && endDate.Sub(startDate) > 31*24*time.Hour {
+		q.add("endDate", fieldError("endDate", "hourly comparison is limited to 31 days"))
+	}
+	if err := q.err(); err != nil {
+		return badParam(c, err)
+	}
+
+	comparison, err := h.energyService.CompareDevices(c.UserContext(), deviceIDs, startDate, endDate, granularity)
+	if err != nil {
+		log.Printf("ERROR: CompareDevices failed: %v", err)
+		return dbError(c, err, "Failed to compare devices")
+	}
+
+	return c.JSON(comparison)
 }
 
-// GetRealtimeStats gets real-time statistics
-func (h *EnergyHandler) GetRealtimeStats(c *fiber.Ctx) error {
-	stats, err := h.energyService.GetRealtimeStats()
+// GetPowerStats returns mean, median, p95, p99, min, max and stddev of power
+// Usage: GET /api/energy/stats?device_id=ESP32_001&start=2025-01-13&end=2025-01-19
+// Default: 7 hari terakhir sampai hari ini (end inklusif)
+func (h *EnergyHandler) GetPowerStats(c *fiber.Ctx) error {
+	q := newQueryParams(c)
+	deviceID := q.required("device_id")
+	startDate, endDate := q.dateRange("start", "end", 7, time.Local)
+	if err := q.err(); err != nil {
+		return badParam(c, err)
+	}
+
+	stats, err := h.energyService.GetPowerStats(c.UserContext(), deviceID, startDate, endDate.AddDate(0, 0, 1))
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		log.Printf("ERROR: GetPowerStats failed: %v", err)
+		return dbError(c, err, "Failed to compute power statistics")
 	}
 
 	return c.JSON(stats)
 }
 
-// GetDeviceList gets list of all devices
-func (h *EnergyHandler) GetDeviceList(c *fiber.Ctx) error {
-	devices, err := h.energyService.GetDeviceList()
+// GetAnomalies returns the readings whose power is unusual compared to the
+// readings just before them: rolling z-score over ANOMALY_WINDOW readings
+// (or window=), flagged above ANOMALY_ZSCORE (or z=)
+// Usage: GET /api/energy/anomalies?device_id=ESP32_001&start=2025-01-13&end=2025-01-19&z=2.5&window=60&tz=Asia/Jakarta
+// Default: hari ini
+func (h *EnergyHandler) GetAnomalies(c *fiber.Ctx) error {
+	q := newQueryParams(c)
+	deviceID := q.required("device_id")
+	window := q.intRange("window", 0, 2, 1440)
+	zScore := q.floatRange("z", 0, 0, 10)
+	loc := q.location("tz", h.location)
+	startDate, endDate := q.dateRange("start", "end", 1, loc)
+	if err := q.err(); err != nil {
+		return badParam(c, err)
+	}
+
+	report, err := h.energyService.FindPowerAnomalies(c.UserContext(), deviceID, startDate, endDate.AddDate(0, 0, 1), window, zScore)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		log.Printf("❌ Error scanning anomalies for %s: %v", deviceID, err)
+		return dbError(c, err, "Failed to scan for anomalies")
 	}
 
-	return c.JSON(fiber.Map{
-		"count":   len(devices),
-		"devices": devices,
-	})
+	return c.JSON(report)
+}
+
+// GetDataGaps returns the times a device stopped reporting: spacings between
+// readings above expected_interval (seconds; default the device's
+// expected_report_interval_seconds, else MQTT_REPORT_INTERVAL_SECONDS) times
+// tolerance (default GAP_TOLERANCE)
+// start/end accept unix ms or RFC 3339
+// Usage: GET /api/energy/gaps?device_id=ESP32_001&start=2025-01-13T00:00:00Z&end=2025-01-14T00:00:00Z&expected_interval=5
+// Default: 24 jam terakhir
+func (h *EnergyHandler) GetDataGaps(c *fiber.Ctx) error {
+	q := newQueryParams(c)
+	now := time.Now()
+	deviceID := q.required("device_id")
+	start := q.timestamp("start", now.Add(-24*time.Hour).UnixMilli())
+	end := q.timestamp("end", now.UnixMilli())
+	if !q.failed("start") && !q.failed("end") {
+		q.add("end", checkRange("start", "end", start, end))
+	}
+	interval := q.intRange("expected_interval", 0, 1, 86400)
+	tolerance := q.floatRange("tolerance", 0, 1, 100)
+	if err := q.err(); err != nil {
+		return badParam(c, err)
+	}
+
+	report, err := h.energyService.FindDataGaps(c.UserContext(), deviceID, time.UnixMilli(start), time.UnixMilli(end),
+		time.Duration(interval)*time.Second, tolerance)
+	if err != nil {
+		log.Printf("❌ Error scanning data gaps for %s: %v", deviceID, err)
+		return dbError(c, err, "Failed to scan for data gaps")
+	}
+
+	return c.JSON(report)
+}
+
+// GetStandbyPower estimates the always-on load from the night windows
+// (STANDBY_START_HOUR-STANDBY_END_HOUR) of the last days nights
+// Usage: GET /api/energy/standby?device_id=ESP32_001&days=7&tz=Asia/Jakarta
+func (h *EnergyHandler) GetStandbyPower(c *fiber.Ctx) error {
+	q := newQueryParams(c)
+	deviceID := q.required("device_id")
+	days := q.intRange("days", 7, 1, 90)
+	loc := q.location("tz", h.location)
+	if err := q.err(); err != nil {
+		return badParam(c, err)
+	}
+
+	report, err := h.energyService.ComputeStandbyPower(c.UserContext(), deviceID, days, time.Now().In(loc))
+	if err != nil {
+		log.Printf("ERROR: ComputeStandbyPower failed: %v", err)
+		return dbError(c, err, "Failed to compute standby power")
+	}
+
+	return c.JSON(report)
+}
+
+// GetPeakDemand returns the highest average power over a demand window
+// (DEMAND_WINDOW_MINUTES, or window=15|30|60) and the top 10 windows
+// Usage: GET /api/energy/peak-demand?device_id=ESP32_001&startDate=2025-01-01&endDate=2025-01-31&tz=Asia/Jakarta
+// Default: 7 hari terakhir sampai hari ini
+func (h *EnergyHandler) GetPeakDemand(c *fiber.Ctx) error {
+	q := newQueryParams(c)
+	deviceID := q.required("device_id")
+	window := q.intRange("window", 0, 0, 60)
+	if window != 0 && !slices.Contains(services.DemandWindowMinutes, window) {
+		q.add("window", fieldError("window", "invalid window %d, use: 15, 30 or 60", window))
+	}
+	loc := q.location("tz", h.location)
+	startDate, endDate := q.dateRange("startDate", "endDate", 7, loc)
+	if err := q.err(); err != nil {
+		return badParam(c, err)
+	}
+
+	report, err := h.energyService.ComputePeakDemand(c.UserContext(), deviceID, startDate, endDate.AddDate(0, 0, 1), window)
+	if err != nil {
+		log.Printf("❌ Error computing peak demand for %s: %v", deviceID, err)
+		return dbError(c, err, "Failed to compute peak demand")
+	}
+
+	return c.JSON(report)
+}
+
+// GetCostBreakdown returns kWh and cost per time-of-use block (peak/off-peak)
+// Usage: GET /api/energy/cost?device_id=ESP32_001&start=2025-01-01&end=2025-01-31&tz=Asia/Jakarta
+// Default: 7 hari terakhir sampai hari ini, jam peak dalam zona tz
+func (h *EnergyHandler) GetCostBreakdown(c *fiber.Ctx) error {
+	q := newQueryParams(c)
+	deviceID := q.required("device_id")
+	loc := q.location("tz", h.location)
+	startDate, endDate := q.dateRange("start", "end", 7, loc)
+	if err := q.err(); err != nil {
+		return badParam(c, err)
+	}
+
+	breakdown, err := h.energyService.GetCostBreakdown(c.UserContext(), deviceID, startDate, endDate.AddDate(0, 0, 1))
+	if err != nil {
+		log.Printf("❌ Error building cost breakdown for %s: %v", deviceID, err)
+		return dbError(c, err, "Failed to build cost breakdown")
+	}
+
+	return c.JSON(breakdown)
+}
+
+// GetHeatmap returns average power and kWh per weekday × hour
+// Usage: GET /api/energy/heatmap?device_id=ESP32_001&start=2025-01-13&end=2025-01-19
+// Default: 7 hari terakhir sampai hari ini
+func (h *EnergyHandler) GetHeatmap(c *fiber.Ctx) error {
+	q := newQueryParams(c)
+	deviceID := q.required("device_id")
+	startDate, endDate := q.dateRange("start", "end", 7, time.Local)
+	if err := q.err(); err != nil {
+		return badParam(c, err)
+	}
+
+	heatmap, err := h.energyService.GetHeatmap(c.UserContext(), deviceID, startDate, endDate)
+	if err != nil {
+		log.Printf("❌ Error building heatmap for %s: %v", deviceID, err)
+		return dbError(c, err, "Failed to build heatmap")
+	}
+
+	return c.JSON(heatmap)
+}
+
+// GetRealtimeStats gets real-time statistics for all devices
+// Usage: GET /api/energy/realtime-stats?window=1h (1h atau 24h, default 24h)
+func (h *EnergyHandler) GetRealtimeStats(c *fiber.Ctx) error {
+	q := newQueryParams(c)
+	window := q.oneOf("window", "24h", "1h", "24h")
+	if err := q.err(); err != nil {
+		return badParam(c, err)
+	}
+
+	stats, err := h.energyService.GetRealtimeStats(c.UserContext(), window, time.Now())
+	if err != nil {
+		log.Printf("ERROR: GetRealtimeStats failed: %v", err)
+		return dbError(c, err, "Failed to compute realtime statistics")
+	}
+
+	return c.JSON(stats)
 }
 
 // GetDeviceStatus gets status of devices
@@ -745,24 +997,164 @@ func (h *EnergyHandler) GetDeviceStatus(c *fiber.Ctx) error {
 	})
 }
 
+// GetDeviceDiagnostics returns the last WiFi RSSI, uptime, last-seen and the
+// recent rssi/uptime reports of a device
+// Usage: GET /api/devices/ESP32_001/diagnostics
+func (h *EnergyHandler) GetDeviceDiagnostics(c *fiber.Ctx) error {
+	diagnostics, ok := h.energyService.DeviceDiagnostics(c.Params("id"))
+	if !ok {
+		return utils.ErrorResponse(c, 404, "Device not seen since server start")
+	}
+
+	return c.JSON(diagnostics)
+}
+
 // InsertData inserts energy data
 func (h *EnergyHandler) InsertData(c *fiber.Ctx) error {
 	var data models.EnergyData
 	if err := c.BodyParser(&data); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return utils.ErrorResponse(c, 400, "Invalid request body")
 	}
 
 	deviceID := c.Query("device_id", "ESP32_001")
 
-	if err := h.energyService.SaveEnergyData(deviceID, &data); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	if err := h.energyService.SaveEnergyData(c.UserContext(), deviceID, &data); err != nil {
+		log.Printf("ERROR: SaveEnergyData failed: %v", err)
+		return dbError(c, err, "Failed to save energy data")
 	}
 
 	return c.JSON(fiber.Map{
 		"message": "Data inserted successfully",
 	})
-}
\ No newline at end of file
+}
+
+// InsertBulkData inserts a JSON array of readings in one batch (backfill)
+func (h *EnergyHandler) InsertBulkData(c *fiber.Ctx) error {
+	deviceID := c.Query("device_id")
+	if deviceID == "" {
+		return badParam(c, requiredError("device_id"))
+	}
+
+	var dataList []models.EnergyData
+	if err := c.BodyParser(&dataList); err != nil {
+		return utils.ErrorResponse(c, 400, "Invalid request body, expected a JSON array of readings")
+	}
+
+	if len(dataList) == 0 {
+		return utils.ErrorResponse(c, 400, "request body contains no readings")
+	}
+
+	if max := h.cfg.Server.BulkInsertMax; len(dataList) > max {
+		return utils.ErrorResponse(c, fiber.StatusRequestEntityTooLarge, fmt.Sprintf("too many readings: %d (max %d per request)", len(dataList), max))
+	}
+
+	result, err := h.energyService.SaveEnergyBatch(c.UserContext(), deviceID, dataList)
+	if err != nil {
+		log.Printf("ERROR: SaveEnergyBatch failed: %v", err)
+		return dbError(c, err, "Failed to save energy data")
+	}
+
+	return c.JSON(result)
+}
+
+// ImportData imports readings from an uploaded CSV or NDJSON file
+// Usage: POST /api/energy/import (multipart) file=<file> device_id=ESP32_001
+// format=csv|ndjson (default dari ekstensi) mapping={"volt":"voltage","ts":"timestamp"}
+func (h *EnergyHandler) ImportData(c *fiber.Ctx) error {
+	deviceID := c.FormValue("device_id", c.Query("device_id"))
+	if deviceID == "" {
+		return badParam(c, requiredError("device_id"))
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return utils.ErrorResponse(c, 400, "file is required (multipart field \"file\")")
+	}
+
+	if max := int64(h.cfg.Server.ImportMaxMB) << 20; file.Size > max {
+		return utils.ErrorResponse(c, fiber.StatusRequestEntityTooLarge, fmt.Sprintf("file too large: %d bytes (max %d MB)", file.Size, h.cfg.Server.ImportMaxMB))
+	}
+
+	format := strings.ToLower(c.FormValue("format"))
+	if format == "" {
+		format = "csv"
+		if ext := strings.ToLower(filepath.Ext(file.Filename)); ext == ".ndjson" || ext == ".jsonl" || ext == ".json" {
+			format = "ndjson"
+		}
+	}
+
+	var mapping map[string]string
+	if raw := c.FormValue("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			return utils.ErrorResponse(c, 400, "mapping must be a JSON object of source column to field")
+		}
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "failed to read uploaded file")
+	}
+	defer f.Close()
+
+	result, err := h.energyService.Import(c.UserContext(), deviceID, format, f, mapping)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidImport) {
+			return utils.ErrorResponse(c, 400, err.Error())
+		}
+		// Sebagian data mungkin sudah tersimpan sebelum error
+		status := dbErrorStatus(err)
+		return utils.CodedErrorResponse(c, status, dbErrorCode(status), err.Error(), fiber.Map{"result": result})
+	}
+
+	log.Printf("📥 Imported %s for %s: %d imported, %d skipped, %d errored", file.Filename, deviceID, result.Imported, result.Skipped, result.Errored)
+	return c.JSON(result)
+}
+
+// DeleteData removes a device's readings in an explicit time range (admin
+// only). confirm=true is required so a stray request cannot delete anything.
+// Usage: DELETE /api/energy/data?device_id=ESP32_001&start=<ms|RFC3339>&end=<ms|RFC3339>&confirm=true
+// start_time/end_time are accepted as well
+func (h *EnergyHandler) DeleteData(c *fiber.Ctx) error {
+	// Tidak ada default: range harus disebut eksplisit
+	q := newQueryParams(c)
+	deviceID := q.required("device_id")
+	startName, endName := "start", "end"
+	if c.Query("start_time") != "" || c.Query("end_time") != "" {
+		startName, endName = "start_time", "end_time"
+	}
+	q.required(startName)
+	q.required(endName)
+	startTime := q.timestamp(startName, 0)
+	endTime := q.timestamp(endName, 0)
+	if c.Query("confirm") != "true" {
+		q.add("confirm", fieldError("confirm", "confirm=true is required to delete data"))
+	}
+	if err := q.err(); err != nil {
+		return badParam(c, err)
+	}
+
+	series, err := h.energyService.DeleteData(c.UserContext(), deviceID, startTime, endTime)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidTimeRange) {
+			return utils.ErrorResponse(c, 400, err.Error())
+		}
+		if !h.db.IsEnabled() {
+			return iotdbUnavailable(c)
+		}
+		log.Printf("ERROR: DeleteData failed: %v", err)
+		return dbError(c, err, "Failed to delete data")
+	}
+
+	log.Printf("🗑️  Deleted data for %s between %d and %d (%d series) by %v", deviceID, startTime, endTime, series, c.Locals("username"))
+	event := auditEvent(c, models.AuditDataDeleted, deviceID)
+	event.Details = map[string]interface{}{"start_time": startTime, "end_time": endTime, "series": series}
+	h.audit.Record(event)
+
+	return c.JSON(fiber.Map{
+		"device_id":  deviceID,
+		"path":       h.db.DeviceDataPattern(deviceID),
+		"start_time": startTime,
+		"end_time":   endTime,
+		"series":     series,
+	})
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+	"wattwise/internal/models"
+)
+
+func TestFilteredMinPowerKeepsZero(t *testing.T) {
+	e := newEnergyTestApp(t)
+	at := func(hour, minute int) time.Time { return time.Date(2025, 1, 6, hour, minute, 0, 0, testLocation) }
+
+	// A: reading pertama 0W; B: 0W di tengah; C: selalu 0W
+	e.seed(t, "A", reading(at(8, 0), 0, 1.0), reading(at(8, 10), 100, 1.1), reading(at(8, 20), 50, 1.2))
+	e.seed(t, "B", reading(at(8, 0), 80, 1.0), reading(at(8, 10), 0, 1.1), reading(at(8, 20), 40, 1.2))
+	e.seed(t, "C", reading(at(8, 0), 0, 1.0), reading(at(8, 10), 0, 1.0))
+
+	want := map[string][2]float64{"A": {0, 100}, "B": {0, 80}, "C": {0, 0}}
+	filters := []string{
+		"filter=hourly&startDate=2025-01-06&endDate=2025-01-06",
+		"filter=daily&startDate=2025-01-06&endDate=2025-01-06",
+		"filter=weekly&startDate=2025-01-06&endDate=2025-01-06",
+		"filter=monthly&startDate=2025-01-01&endDate=2025-01-31",
+		"filter=custom_days&days=2025-01-06",
+	}
+	for device, minMax := range want {
+		for _, filter := range filters {
+			var body models.FilteredResponse
+			if status := doJSON(t, e.app, "GET", "/api/energy/filtered?device_id="+device+"&"+filter, "", &body); status != 200 {
+				t.Fatalf("%s %s: status %d", device, filter, status)
+			}
+			var rows []models.FilteredEnergyData
+			for _, row := range body.Data {
+				if row.DataCount > 0 {
+					rows = append(rows, row)
+				}
+			}
+			if len(rows) != 1 {
+				t.Fatalf("%s %s: %d buckets with data, want 1: %+v", device, filter, len(rows), body.Data)
+			}
+			if rows[0].MinPower != minMax[0] || rows[0].MaxPower != minMax[1] {
+				t.Errorf("%s %s: min/max = %v/%v, want %v/%v", device, filter, rows[0].MinPower, rows[0].MaxPower, minMax[0], minMax[1])
+			}
+		}
+	}
+}
+
+func TestIngestInfluxWrite(t *testing.T) {
+	e := newEnergyTestApp(t)
+
+	// Telegraf menulis ke <url>/write, dengan db=... yang diabaikan
+	for i, path := range []string{"/api/ingest/influx?precision=s", "/api/ingest/influx/write?db=telegraf&precision=s"} {
+		line := fmt.Sprintf("energy,device_id=A voltage=220,power=%d,energy=1.0 %d", 100+i, 1736900000+i)
+		if status := doJSON(t, e.app, "POST", path, line, nil); status != 204 {
+			t.Errorf("POST %s: status %d, want 204", path, status)
+		}
+	}
+	if latest, _ := e.store.GetLatestData(context.Background(), "A", 0); len(latest) != 2 {
+		t.Errorf("%d readings stored, want 2", len(latest))
+	}
+
+	if status := doJSON(t, e.app, "POST", "/api/ingest/influx/write", "energy,device_id=A power=x", nil); status != 400 {
+		t.Errorf("malformed line: status %d, want 400", status)
+	}
+}
+
+func TestDailySummaryMatchesFiltered(t *testing.T) {
+	e := newEnergyTestApp(t)
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, 1, day, hour, minute, 0, 0, testLocation)
+	}
+
+	// Counter kWh yang naik terus, reset di tengah hari, dan gap lewat tengah malam
+	e.seed(t, "steady", reading(at(6, 0, 0), 100, 10.0), reading(at(6, 12, 0), 100, 11.2), reading(at(6, 23, 59), 100, 12.4))
+	e.seed(t, "reset", reading(at(6, 8, 0), 500, 40.0), reading(at(6, 9, 0), 500, 40.5), reading(at(6, 9, 30), 0, 0.1), reading(at(6, 18, 0), 500, 2.6))
+	e.seed(t, "gap",
+		reading(at(6, 20, 0), 200, 5.0), reading(at(6, 22, 0), 200, 5.4),
+		reading(at(7, 6, 0), 200, 7.0), reading(at(7, 7, 0), 200, 7.2),
+		reading(at(8, 10, 0), 200, 9.0),
+	)
+
+	// Query yang sama: satu hari, dan seluruh bulan
+	for _, device := range []string{"steady", "reset", "gap"} {
+		for _, date := range []string{"2025-01-06", "2025-01-07", "2025-01-08"} {
+			var daily models.DailySummary
+			if status := doJSON(t, e.app, "GET", "/api/energy/summary/daily?device_id="+device+"&date="+date, "", &daily); status != 200 {
+				t.Fatalf("%s %s: daily status %d", device, date, status)
+			}
+			filtered := filteredDaily(t, e, device, date, date)
+			if math.Abs(daily.TotalEnergy-filtered[date]) > 1e-9 {
+				t.Errorf("%s %s: daily summary %v kWh, filtered daily %v kWh", device, date, daily.TotalEnergy, filtered[date])
+			}
+		}
+
+		var month models.MonthlySummary
+		if status := doJSON(t, e.app, "GET", "/api/energy/summary/monthly?device_id="+device+"&month=2025-01", "", &month); status != 200 {
+			t.Fatalf("%s: monthly status %d", device, status)
+		}
+		filtered := filteredDaily(t, e, device, "2025-01-01", "2025-01-31")
+		total := 0.0
+		for _, day := range month.DailySummaries {
+			total += filtered[day.Date]
+			if math.Abs(day.TotalEnergy-filtered[day.Date]) > 1e-9 {
+				t.Errorf("%s %s: monthly summary day %v kWh, filtered daily %v kWh", device, day.Date, day.TotalEnergy, filtered[day.Date])
+			}
+		}
+		if math.Abs(month.TotalEnergy-total) > 1e-9 {
+			t.Errorf("%s: monthly total %v kWh, filtered daily %v kWh", device, month.TotalEnergy, total)
+		}
+	}
+}
+
+// filteredDaily returns total_kwh per date of /filtered?filter=daily
+func filteredDaily(t *testing.T, e *energyTestApp, device, start, end string) map[string]float64 {
+	t.Helper()
+	var body models.FilteredResponse
+	if status := doJSON(t, e.app, "GET", "/api/energy/filtered?device_id="+device+"&filter=daily&startDate="+start+"&endDate="+end, "", &body); status != 200 {
+		t.Fatalf("%s %s..%s: filtered status %d", device, start, end, status)
+	}
+	byDate := make(map[string]float64)
+	for _, row := range body.Data {
+		byDate[row.Date] = row.TotalKWh
+	}
+	return byDate
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"wattwise/internal/config"
+	"wattwise/internal/database"
+	"wattwise/internal/models"
+	"wattwise/internal/services"
+	"wattwise/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// failingStore is a MemoryStore whose reads fail with err
+type failingStore struct {
+	*database.MemoryStore
+	err error
+}
+
+func (s failingStore) GetLatestData(ctx context.Context, deviceID string, limit int) ([]models.EnergyData, error) {
+	return nil, s.err
+}
+
+func (s failingStore) StreamDataByTimeRange(ctx context.Context, deviceID string, startTime, endTime int64, limit int, fn func(models.EnergyData) error) error {
+	return s.err
+}
+
+func TestSummaryDummyDisabled(t *testing.T) {
+	store := failingStore{MemoryStore: database.NewMemoryStore(), err: database.ErrDummyDisabled}
+	handler := NewEnergyHandler(store, services.NewEnergyService(store, services.NewTariffService(1444.70), discardLogger()), &config.Config{})
+	handler.location = testLocation
+	app := fiber.New()
+	app.Get("/summary/daily", handler.GetDailySummary)
+	app.Get("/summary/weekly", handler.GetWeeklySummary)
+	app.Get("/summary/monthly", handler.GetMonthlySummary)
+	app.Get("/compare", handler.GetComparison)
+
+	// DUMMY_MODE=off: 503, bukan summary berisi 0 kWh
+	for _, url := range []string{
+		"/summary/daily?device_id=A&date=2025-01-06",
+		"/summary/weekly?device_id=A",
+		"/summary/monthly?device_id=A&month=2025-01",
+		"/compare?device_id=A&period=monthly",
+	} {
+		var body utils.ErrorBody
+		if status := doJSON(t, app, "GET", url, "", &body); status != 503 {
+			t.Errorf("%s: status = %d, want 503", url, status)
+		}
+		if body.Code != utils.CodeIoTDBUnavailable {
+			t.Errorf("%s: code = %q, want %s", url, body.Code, utils.CodeIoTDBUnavailable)
+		}
+	}
+}
+
+func TestDatabaseErrorShape(t *testing.T) {
+	// Pesan internal (host, query) tidak boleh sampai ke client
+	internal := errors.New("dial tcp iotdb.internal:6667: connection refused")
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"transient", &database.TransientError{Attempts: 3, Err: internal}, 503, utils.CodeIoTDBUnavailable},
+		{"timeout", fmt.Errorf("%w: %w", database.ErrQueryTimeout, context.DeadlineExceeded), 504, utils.CodeIoTDBTimeout},
+		{"other", internal, 500, utils.CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := failingStore{MemoryStore: database.NewMemoryStore(), err: tt.err}
+			handler := NewEnergyHandler(store, services.NewEnergyService(store, services.NewTariffService(1444.70), discardLogger()), &config.Config{})
+			app := fiber.New()
+			app.Get("/latest", handler.GetLatestData)
+
+			var body utils.ErrorBody
+			if status := doJSON(t, app, "GET", "/latest", "", &body); status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+			if body.Success || body.Code != tt.code || body.Message == "" || body.Error != body.Message {
+				t.Errorf("body = %+v, want code %s", body, tt.code)
+			}
+			if strings.Contains(body.Message, "iotdb.internal") {
+				t.Errorf("message leaks the database error: %q", body.Message)
+			}
+		})
+	}
+}
+
+func TestDeviceIDRequiredShape(t *testing.T) {
+	e := newEnergyTestApp(t)
+
+	var body validationBody
+	if status := doJSON(t, e.app, "POST", "/api/energy/insert/bulk", `[]`, &body); status != 400 {
+		t.Fatalf("status = %d, want 400", status)
+	}
+	if body.Code != utils.CodeDeviceIDRequired || len(body.Errors) != 1 || body.Errors[0].Field != "device_id" {
+		t.Errorf("body = %+v", body)
+	}
+}
+
+func TestInsertWhileDisconnected(t *testing.T) {
+	for _, dummyMode := range []string{"on", "off"} {
+		t.Run("DUMMY_MODE="+dummyMode, func(t *testing.T) {
+			// IoTDB yang belum connect: write ditolak, bukan dibuang diam-diam
+			store := database.NewIoTDB(config.IoTDBConfig{DummyMode: dummyMode}, discardLogger())
+			service := services.NewEnergyService(store, services.NewTariffService(1444.70), discardLogger())
+			service.SetLatestCache(services.NewLatestCache(time.Minute))
+			cfg := &config.Config{}
+			cfg.Server.BulkInsertMax = 10
+			handler := NewEnergyHandler(store, service, cfg)
+			app := fiber.New()
+			app.Post("/insert", handler.InsertData)
+			app.Post("/insert/bulk", handler.InsertBulkData)
+
+			reading := fmt.Sprintf(`{"timestamp":%d,"voltage":220,"current":1,"power":220,"energy":1}`, time.Now().UnixMilli())
+			for path, body := range map[string]string{
+				"/insert?device_id=A":      reading,
+				"/insert/bulk?device_id=A": "[" + reading + "]",
+			} {
+				var resp utils.ErrorBody
+				if status := doJSON(t, app, "POST", path, body, &resp); status != 503 || resp.Code != utils.CodeIoTDBUnavailable {
+					t.Errorf("%s: %d %s, want 503 %s", path, status, resp.Code, utils.CodeIoTDBUnavailable)
+				}
+			}
+			if _, _, ok := service.CachedLatest("A"); ok {
+				t.Error("latest reading cached although nothing was stored")
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"log"
+	"sync"
+	"wattwise/internal/models"
+)
+
+// Event types published on the fan-out; SSE sends them as the "event:" name
+const (
+	EventReading      = "reading"
+	EventAlert        = "alert"
+	EventDeviceStatus = "device_status"
+	EventForecast     = "forecast"
+
+	EventSettingsChanged = "settings_changed"
+	EventSystem          = "system"
+)
+
+// defaultReplaySize is how many recent events are kept for Last-Event-ID
+const defaultReplaySize = 256
+
+// Event is one broadcast with a process-wide increasing id
+type Event struct {
+	ID      uint64
+	Type    string
+	Payload interface{}
+}
+
+// EventFanout is the event bus of the live transports: producers (MQTT
+// subscriber, settings, forecasts) publish through its Broadcast* methods
+// without knowing the transports, and it delivers every event to all
+// subscribers (the WebSocket hub and each SSE stream) and keeps the last few in a ring buffer
+// so a reconnecting SSE client can replay what it missed.
+type EventFanout struct {
+	mu     sync.Mutex
+	nextID uint64
+	ring   []Event // oldest first, at most replaySize
+	size   int
+	subs   map[*subscription]struct{}
+}
+
+type subscription struct {
+	ch chan Event
+	// evict closes a subscriber that falls behind instead of dropping
+	// events for it; an SSE client then reconnects with Last-Event-ID
+	evict bool
+}
+
+func NewEventFanout(replaySize int) *EventFanout {
+	if replaySize <= 0 {
+		replaySize = defaultReplaySize
+	}
+	return &EventFanout{
+		nextID: 1,
+		size:   replaySize,
+		subs:   make(map[*subscription]struct{}),
+	}
+}
+
+// Publish assigns the next id and hands the event to every subscriber without
+// blocking
+func (f *EventFanout) Publish(eventType string, payload interface{}) Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	event := Event{ID: f.nextID, Type: eventType, Payload: payload}
+	f.nextID++
+
+	if len(f.ring) >= f.size {
+		f.ring = append(f.ring[:0], f.ring[1:]...)
+	}
+	f.ring = append(f.ring, event)
+
+	for sub := range f.subs {
+		select {
+		case sub.ch <- event:
+		default:
+			if sub.evict {
+				delete(f.subs, sub)
+				close(sub.ch)
+			} else {
+				log.Printf("⚠️ Event subscriber full, dropping %s event %d", event.Type, event.ID)
+			}
+		}
+	}
+	return event
+}
+
+// Subscribe registers a subscriber with a channel of buffer events. With
+// evict, a subscriber whose buffer is full is closed rather than skipped.
+// Call cancel when done.
+func (f *EventFanout) Subscribe(buffer int, evict bool) (<-chan Event, func()) {
+	_, ch, cancel := f.SubscribeAfter(0, buffer, evict)
+	return ch, cancel
+}
+
+// SubscribeAfter is Subscribe that also returns the buffered events after
+// lastID, atomically, so nothing is missed or delivered twice. An id the
+// fan-out has not issued (e.g. from before a restart) replays the whole ring.
+func (f *EventFanout) SubscribeAfter(lastID uint64, buffer int, evict bool) ([]Event, <-chan Event, func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var replay []Event
+	if lastID > 0 {
+		if lastID >= f.nextID {
+			lastID = 0
+		}
+		for _, event := range f.ring {
+			if event.ID > lastID {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	sub := &subscription{ch: make(chan Event, buffer), evict: evict}
+	f.subs[sub] = struct{}{}
+
+	cancel := func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.subs[sub]; ok {
+			delete(f.subs, sub)
+			close(sub.ch)
+		}
+	}
+	return replay, sub.ch, cancel
+}
+
+// BroadcastRealtimeData publishes a reading from MQTT
+func (f *EventFanout) BroadcastRealtimeData(data models.RealtimeData) {
+	f.Publish(EventReading, data)
+}
+
+// BroadcastAlert publishes a raised alert
+func (f *EventFanout) BroadcastAlert(alert models.AlertData) {
+	f.Publish(EventAlert, alert)
+}
+
+// BroadcastForecast publishes a recomputed consumption forecast
+func (f *EventFanout) BroadcastForecast(summary models.ForecastSummary) {
+	f.Publish(EventForecast, summary)
+}
+
+// BroadcastDeviceStatus publishes an online/offline transition
+func (f *EventFanout) BroadcastDeviceStatus(event models.DeviceStatusEvent) {
+	f.Publish(EventDeviceStatus, event)
+}
+
+// BroadcastSettingsChanged publishes runtime settings changed by an admin or
+// a reload
+func (f *EventFanout) BroadcastSettingsChanged(event models.SettingsChangedEvent) {
+	f.Publish(EventSettingsChanged, event)
+}
+
+// BroadcastSystemNotice publishes a server state change such as IoTDB going
+// down (dummy data) or coming back
+func (f *EventFanout) BroadcastSystemNotice(notice models.SystemNotice) {
+	f.Publish(EventSystem, notice)
+}
+
+// Subscribers returns the number of active subscribers
+func (f *EventFanout) Subscribers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subs)
+}
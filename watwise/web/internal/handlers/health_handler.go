@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"time"
+	"wattwise/internal/database"
+	"wattwise/internal/models"
+	"wattwise/internal/mqtt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const readinessPingTimeout = 2 * time.Second
+
+// IoTDBHealth is the part of *database.IoTDB (or *database.MemoryStore with
+// DB_DRIVER=memory) the health checks need
+type IoTDBHealth interface {
+	Status() database.Status
+	Ping(timeout time.Duration) error
+	VerifySchema(ctx context.Context, deviceIDs []string, repair bool) (*models.SchemaReport, error)
+}
+
+// MQTTHealth is the part of *mqtt.Subscriber the health checks need
+type MQTTHealth interface {
+	Status() mqtt.Status
+}
+
+// WebSocketHealth reports connected WebSocket clients and the broadcast
+// buffer (*WebSocketHandler)
+type WebSocketHealth interface {
+	GetConnectedClients() int
+	BroadcastStats() BroadcastStats
+}
+
+type HealthHandler struct {
+	db        IoTDBHealth
+	mqtt      MQTTHealth
+	ws        WebSocketHealth
+	startedAt time.Time
+
+	// STRICT_HEALTH: /health answers 503 when IoTDB is down
+	strict bool
+
+	// Registered device ids for the schema check of /health/ready, see
+	// SetSchemaDevices
+	schemaDevices func() []string
+}
+
+func NewHealthHandler(db IoTDBHealth, mqtt MQTTHealth, ws WebSocketHealth) *HealthHandler {
+	return &HealthHandler{
+		db:        db,
+		mqtt:      mqtt,
+		ws:        ws,
+		startedAt: time.Now(),
+	}
+}
+
+// Live answers 200 as long as the process can serve requests
+func (h *HealthHandler) Live(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status":         "ok",
+		"uptime_seconds": int64(time.Since(h.startedAt).Seconds()),
+		"timestamp":      time.Now().Unix(),
+	})
+}
+
+// SetStrict makes /health answer 503 when IoTDB is down (STRICT_HEALTH)
+func (h *HealthHandler) SetStrict(strict bool) {
+	h.strict = strict
+}
+
+// SetSchemaDevices enables the schema check in /health/ready for the devices
+// returned by ids (plus the default device)
+func (h *HealthHandler) SetSchemaDevices(ids func() []string) {
+	h.schemaDevices = ids
+}
+
+// Ready answers 503 unless IoTDB answers a ping and MQTT is connected and
+// subscribed. Dummy mode counts as not ready. Schema drift (missing
+// timeseries) is reported under checks.schema but does not fail readiness.
+func (h *HealthHandler) Ready(c *fiber.Ctx) error {
+	report, iotdbUp, mqttUp := h.report()
+	if iotdbUp && h.schemaDevices != nil {
+		report["checks"].(fiber.Map)["schema"] = h.schemaCheck(c.UserContext())
+	}
+	code := fiber.StatusOK
+	report["status"] = "ready"
+	if !iotdbUp || !mqttUp {
+		code = fiber.StatusServiceUnavailable
+		report["status"] = "not_ready"
+	}
+	return c.Status(code).JSON(report)
+}
+
+// Health is the detailed /health report. It answers 200 even when something
+// is down, unless STRICT_HEALTH is set and IoTDB is down (503).
+func (h *HealthHandler) Health(c *fiber.Ctx) error {
+	report, iotdbUp, mqttUp := h.report()
+	code := fiber.StatusOK
+	switch {
+	case !iotdbUp && h.strict:
+		code = fiber.StatusServiceUnavailable
+		report["status"] = "down"
+	case !iotdbUp || !mqttUp:
+		report["status"] = "degraded"
+	default:
+		report["status"] = "ok"
+	}
+	return c.Status(code).JSON(report)
+}
+
+// schemaCheck runs VerifySchema without repair, bounded like the ping
+func (h *HealthHandler) schemaCheck(ctx context.Context) fiber.Map {
+	ctx, cancel := context.WithTimeout(ctx, readinessPingTimeout)
+	defer cancel()
+
+	schema, err := h.db.VerifySchema(ctx, h.schemaDevices(), false)
+	if err != nil {
+		return fiber.Map{"status": "unknown", "error": err.Error()}
+	}
+
+	// Hanya device yang kurang timeseries yang ditampilkan
+	var drift []models.DeviceSchemaDiff
+	for _, d := range schema.Devices {
+		if len(d.Missing) > 0 {
+			drift = append(drift, d)
+		}
+	}
+	if len(drift) > 0 {
+		return fiber.Map{"status": "drift", "missing": drift}
+	}
+	return fiber.Map{"status": "ok"}
+}
+
+// report runs the checks: one IoTDB ping (SHOW VERSION, timed) and
+// snapshots of the MQTT and WebSocket state, no data queries
+func (h *HealthHandler) report() (fiber.Map, bool, bool) {
+	iotdbCheck := fiber.Map{"status": "up"}
+	before := h.db.Status()
+	iotdbUp := before.Enabled
+	var latencyMs *float64
+	if !iotdbUp {
+		served := "serving dummy data"
+		if !before.DummyData {
+			served = "DUMMY_MODE=off"
+		}
+		iotdbCheck["error"] = "IoTDB not connected (" + before.Mode + "), " + served
+	} else {
+		start := time.Now()
+		err := h.db.Ping(readinessPingTimeout)
+		ms := float64(time.Since(start).Microseconds()) / 1000
+		latencyMs = &ms
+		iotdbCheck["latency_ms"] = ms
+		if err != nil {
+			iotdbUp = false
+			iotdbCheck["error"] = err.Error()
+		}
+	}
+	if !iotdbUp {
+		iotdbCheck["status"] = "down"
+	}
+	// Status diambil setelah ping supaya last_success_at terbaru
+	iotdbStatus := h.db.Status()
+	iotdbCheck["mode"] = iotdbStatus.Mode
+	iotdbCheck["detail"] = iotdbStatus
+
+	mqttStatus := h.mqtt.Status()
+	mqttUp := mqttStatus.Connected && mqttStatus.Subscribed
+	mqttCheck := fiber.Map{
+		"status": "up",
+		"detail": mqttStatus,
+	}
+	if !mqttUp {
+		mqttCheck["status"] = "down"
+	}
+
+	broadcast := h.ws.BroadcastStats()
+
+	return fiber.Map{
+		"service":        "Wattwise Energy Monitor",
+		"version":        "1.0.0",
+		"uptime_seconds": int64(time.Since(h.startedAt).Seconds()),
+		// connected, dummy, reconnecting atau memory; lihat iotdb.dummy_data
+		"mode": iotdbStatus.Mode,
+		"checks": fiber.Map{
+			"iotdb": iotdbCheck,
+			"mqtt":  mqttCheck,
+		},
+		// Field lama /health, tetap ada untuk kompatibilitas
+		"iotdb_enabled":  iotdbStatus.Enabled,
+		"iotdb":          iotdbStatus,
+		"mqtt_connected": mqttStatus.Connected,
+		"ws_clients":     h.ws.GetConnectedClients(),
+		"timestamp":      time.Now().Unix(),
+
+		"iotdb_latency_ms":      latencyMs,
+		"mqtt_subscribed":       mqttStatus.Subscribed,
+		"mqtt_topics":           mqttStatus.Topics,
+		"last_message_at":       mqttStatus.LastMessageAt,
+		"broadcast_backlog":     broadcast.Backlog,
+		"broadcast_backlog_cap": broadcast.BufferSize,
+		"broadcast":             broadcast,
+	}, iotdbUp, mqttUp
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"wattwise/internal/database"
+	"wattwise/internal/models"
+	"wattwise/internal/mqtt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeHealthDB reports a fixed IoTDB state
+type fakeHealthDB struct {
+	status    database.Status
+	pingErr   error
+	pings     int
+	missing   []string // timeseries VerifySchema reports missing for every device
+	schemaErr error
+}
+
+func (f *fakeHealthDB) Status() database.Status { return f.status }
+
+func (f *fakeHealthDB) Ping(timeout time.Duration) error {
+	f.pings++
+	return f.pingErr
+}
+
+func (f *fakeHealthDB) VerifySchema(ctx context.Context, deviceIDs []string, repair bool) (*models.SchemaReport, error) {
+	if f.schemaErr != nil {
+		return nil, f.schemaErr
+	}
+	report := &models.SchemaReport{OK: len(f.missing) == 0}
+	for _, id := range deviceIDs {
+		report.Devices = append(report.Devices, models.DeviceSchemaDiff{DeviceID: id, Missing: f.missing})
+	}
+	return report, nil
+}
+
+type fakeHealthMQTT struct{ status mqtt.Status }
+
+func (f fakeHealthMQTT) Status() mqtt.Status { return f.status }
+
+type fakeHealthWS struct{}
+
+func (fakeHealthWS) GetConnectedClients() int { return 2 }
+
+func (fakeHealthWS) BroadcastStats() BroadcastStats {
+	return BroadcastStats{Policy: "drop-oldest", BufferSize: 256, Backlog: 3}
+}
+
+// healthReport is the part of the /health and /health/ready body under test
+type healthReport struct {
+	Status string `json:"status"`
+	Mode   string `json:"mode"`
+	Checks struct {
+		IoTDB struct {
+			Status    string   `json:"status"`
+			Error     string   `json:"error"`
+			LatencyMs *float64 `json:"latency_ms"`
+		} `json:"iotdb"`
+		MQTT struct {
+			Status string `json:"status"`
+		} `json:"mqtt"`
+		Schema *struct {
+			Status  string                    `json:"status"`
+			Missing []models.DeviceSchemaDiff `json:"missing"`
+		} `json:"schema"`
+	} `json:"checks"`
+	WSClients        int `json:"ws_clients"`
+	BroadcastBacklog int `json:"broadcast_backlog"`
+}
+
+func TestHealthChecks(t *testing.T) {
+	connected := database.Status{Mode: "connected", Enabled: true}
+	dummy := database.Status{Mode: "dummy", DummyData: true}
+	off := database.Status{Mode: "reconnecting", Reconnecting: true}
+	subscribed := mqtt.Status{Connected: true, Subscribed: true, Topics: []string{"wattwise/+/data"}}
+
+	tests := []struct {
+		name   string
+		db     fakeHealthDB
+		mqtt   mqtt.Status
+		strict bool
+
+		readyCode     int
+		ready         string
+		health        string
+		healthCode    int
+		iotdb, broker string
+	}{
+		{"all up", fakeHealthDB{status: connected}, subscribed, false, 200, "ready", "ok", 200, "up", "up"},
+		{"ping fails", fakeHealthDB{status: connected, pingErr: errors.New("ping timeout")}, subscribed, false, 503, "not_ready", "degraded", 200, "down", "up"},
+		{"dummy data", fakeHealthDB{status: dummy}, subscribed, false, 503, "not_ready", "degraded", 200, "down", "up"},
+		{"dummy data strict", fakeHealthDB{status: dummy}, subscribed, true, 503, "not_ready", "down", 503, "down", "up"},
+		{"DUMMY_MODE=off strict", fakeHealthDB{status: off}, subscribed, true, 503, "not_ready", "down", 503, "down", "up"},
+		{"broker down", fakeHealthDB{status: connected}, mqtt.Status{}, false, 503, "not_ready", "degraded", 200, "up", "down"},
+		{"broker down strict", fakeHealthDB{status: connected}, mqtt.Status{}, true, 503, "not_ready", "degraded", 200, "up", "down"},
+		{"not subscribed", fakeHealthDB{status: connected}, mqtt.Status{Connected: true}, false, 503, "not_ready", "degraded", 200, "up", "down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := tt.db
+			handler := NewHealthHandler(&db, fakeHealthMQTT{tt.mqtt}, fakeHealthWS{})
+			handler.SetStrict(tt.strict)
+			app := fiber.New()
+			app.Get("/health", handler.Health)
+			app.Get("/health/ready", handler.Ready)
+
+			var ready healthReport
+			if code := doJSON(t, app, "GET", "/health/ready", "", &ready); code != tt.readyCode || ready.Status != tt.ready {
+				t.Errorf("/health/ready = %d %q, want %d %q", code, ready.Status, tt.readyCode, tt.ready)
+			}
+			var health healthReport
+			if code := doJSON(t, app, "GET", "/health", "", &health); code != tt.healthCode || health.Status != tt.health {
+				t.Errorf("/health = %d %q, want %d %q", code, health.Status, tt.healthCode, tt.health)
+			}
+
+			for _, report := range []healthReport{ready, health} {
+				if report.Checks.IoTDB.Status != tt.iotdb || report.Checks.MQTT.Status != tt.broker {
+					t.Errorf("checks iotdb/mqtt = %s/%s, want %s/%s", report.Checks.IoTDB.Status, report.Checks.MQTT.Status, tt.iotdb, tt.broker)
+				}
+				if tt.iotdb == "down" && report.Checks.IoTDB.Error == "" {
+					t.Error("iotdb down without an error")
+				}
+				if report.Mode != db.status.Mode {
+					t.Errorf("mode = %q, want %q", report.Mode, db.status.Mode)
+				}
+				if report.WSClients != 2 || report.BroadcastBacklog != 3 {
+					t.Errorf("ws_clients/broadcast_backlog = %d/%d, want 2/3", report.WSClients, report.BroadcastBacklog)
+				}
+			}
+
+			// Tanpa koneksi tidak ada ping (dan tidak ada latency)
+			if !db.status.Enabled {
+				if db.pings != 0 {
+					t.Errorf("%d pings while disconnected, want 0", db.pings)
+				}
+				if health.Checks.IoTDB.LatencyMs != nil {
+					t.Error("latency_ms reported while disconnected")
+				}
+			} else if health.Checks.IoTDB.LatencyMs == nil {
+				t.Error("latency_ms missing after a ping")
+			}
+		})
+	}
+}
+
+func TestReadySchemaCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		db     fakeHealthDB
+		schema string // "" = no schema check
+	}{
+		{"complete", fakeHealthDB{}, "ok"},
+		{"drift", fakeHealthDB{missing: []string{"frequency"}}, "drift"},
+		{"query fails", fakeHealthDB{schemaErr: errors.New("statement failed")}, "unknown"},
+		{"iotdb down", fakeHealthDB{pingErr: errors.New("ping timeout")}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := tt.db
+			db.status = database.Status{Mode: "connected", Enabled: true}
+			handler := NewHealthHandler(&db, fakeHealthMQTT{mqtt.Status{Connected: true, Subscribed: true}}, fakeHealthWS{})
+			handler.SetSchemaDevices(func() []string { return []string{"ESP32_001"} })
+			app := fiber.New()
+			app.Get("/health/ready", handler.Ready)
+
+			var report healthReport
+			code := doJSON(t, app, "GET", "/health/ready", "", &report)
+			if tt.schema == "" {
+				if report.Checks.Schema != nil {
+					t.Errorf("schema check ran while IoTDB is down: %+v", report.Checks.Schema)
+				}
+				return
+			}
+			// Drift dilaporkan tapi tidak menggagalkan readiness
+			if code != 200 {
+				t.Errorf("status = %d, want 200", code)
+			}
+			if report.Checks.Schema == nil || report.Checks.Schema.Status != tt.schema {
+				t.Fatalf("checks.schema = %+v, want status %q", report.Checks.Schema, tt.schema)
+			}
+			if tt.schema == "drift" && (len(report.Checks.Schema.Missing) != 1 || report.Checks.Schema.Missing[0].DeviceID != "ESP32_001") {
+				t.Errorf("checks.schema.missing = %+v, want ESP32_001", report.Checks.Schema.Missing)
+			}
+		})
+	}
+}
+
+func TestLive(t *testing.T) {
+	// Live tidak menyentuh IoTDB maupun MQTT
+	db := &fakeHealthDB{status: database.Status{Mode: "reconnecting"}, pingErr: errors.New("down")}
+	handler := NewHealthHandler(db, fakeHealthMQTT{}, fakeHealthWS{})
+	app := fiber.New()
+	app.Get("/health/live", handler.Live)
+
+	var body struct {
+		Status string `json:"status"`
+	}
+	if code := doJSON(t, app, "GET", "/health/live", "", &body); code != 200 || body.Status != "ok" {
+		t.Errorf("/health/live = %d %q, want 200 ok", code, body.Status)
+	}
+	if db.pings != 0 {
+		t.Errorf("%d pings, want 0", db.pings)
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+	"wattwise/internal/config"
+	"wattwise/internal/database"
+	"wattwise/internal/models"
+	"wattwise/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// testLocation is the TIMEZONE of the handlers under test
+var testLocation = time.FixedZone("WIB", 7*3600)
+
+// energyTestApp serves the energy handlers under /api/energy like
+// routes.setupRoutes, backed by a MemoryStore (no auth)
+type energyTestApp struct {
+	app     *fiber.App
+	store   *database.MemoryStore
+	service *services.EnergyService
+	handler *EnergyHandler
+}
+
+func newEnergyTestApp(t testing.TB) *energyTestApp {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Server.Timezone = "Asia/Jakarta"
+	cfg.Server.BulkInsertMax = 1000
+	cfg.Server.BodyLimitMB = 4
+	cfg.Server.ImportMaxMB = 4
+
+	store := database.NewMemoryStore()
+	service := services.NewEnergyService(store, services.NewTariffService(1444.70), discardLogger())
+	handler := NewEnergyHandler(store, service, cfg)
+	handler.location = testLocation
+
+	app := fiber.New()
+	energy := app.Group("/api/energy")
+	energy.Get("/latest", handler.GetLatestData)
+	energy.Get("/history", handler.GetHistoricalData)
+	energy.Get("/data", handler.GetData)
+	energy.Get("/raw", handler.GetRawData)
+	energy.Get("/filtered", handler.GetFilteredData)
+	energy.Get("/summary/daily", handler.GetDailySummary)
+	energy.Get("/summary/weekly", handler.GetWeeklySummary)
+	energy.Get("/summary/monthly", handler.GetMonthlySummary)
+	energy.Get("/gaps", handler.GetDataGaps)
+	energy.Get("/compare", handler.GetComparison)
+	energy.Get("/peak-demand", handler.GetPeakDemand)
+	energy.Post("/insert", handler.InsertData)
+	energy.Post("/insert/bulk", handler.InsertBulkData)
+	energy.Delete("/data", handler.DeleteData)
+	app.Post("/api/ingest/influx", handler.IngestInflux)
+	app.Post("/api/ingest/influx/write", handler.IngestInflux)
+
+	return &energyTestApp{app: app, store: store, service: service, handler: handler}
+}
+
+// seed stores readings for deviceID
+func (e *energyTestApp) seed(t testing.TB, deviceID string, readings ...models.EnergyData) {
+	t.Helper()
+	if err := e.store.InsertBatch(context.Background(), deviceID, readings); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// reading is a reading at t with power watts and the energy counter at kwh
+func reading(t time.Time, power, kwh float64) models.EnergyData {
+	return models.EnergyData{
+		Timestamp:   t.UnixMilli(),
+		Voltage:     220,
+		Current:     power / 220,
+		Power:       power,
+		Energy:      kwh,
+		Frequency:   50,
+		PowerFactor: 1,
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"wattwise/internal/services"
+	"wattwise/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// IngestInflux accepts InfluxDB line protocol, so Telegraf's influxdb output
+// can write to WattWise directly. 204 when every line was saved; otherwise 400
+// with the rejected lines in details (the valid ones are saved anyway).
+// Usage: POST /api/ingest/influx?precision=ns&device_id=ESP32_001
+// body: energy,device_id=ESP32_001 voltage=220.5,current=2.1,power=463 1736900000000000000
+// Content-Encoding: gzip didukung
+func (h *EnergyHandler) IngestInflux(c *fiber.Ctx) error {
+	// c.Body() juga decode gzip, tapi tanpa batas ukuran hasil decode
+	body := c.Request().Body()
+	if encoding := strings.TrimSpace(c.Get(fiber.HeaderContentEncoding)); encoding != "" && encoding != "identity" {
+		if !strings.EqualFold(encoding, "gzip") {
+			return utils.ErrorResponse(c, fiber.StatusUnsupportedMediaType, fmt.Sprintf("unsupported Content-Encoding %q, use gzip", encoding))
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return utils.CodedErrorResponse(c, 400, utils.CodeInvalidLineProtocol, "invalid gzip body: "+err.Error(), nil)
+		}
+		defer zr.Close()
+
+		limit := int64(h.cfg.Server.BodyLimitMB) << 20
+		body, err = io.ReadAll(io.LimitReader(zr, limit+1))
+		if err != nil {
+			return utils.CodedErrorResponse(c, 400, utils.CodeInvalidLineProtocol, "invalid gzip body: "+err.Error(), nil)
+		}
+		if int64(len(body)) > limit {
+			return utils.ErrorResponse(c, fiber.StatusRequestEntityTooLarge, fmt.Sprintf("decompressed body too large (max %d MB)", h.cfg.Server.BodyLimitMB))
+		}
+	}
+
+	result, err := h.energyService.IngestLineProtocol(c.UserContext(), bytes.NewReader(body), c.Query("precision"), c.Query("device_id"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidLineProtocol) {
+			return utils.CodedErrorResponse(c, 400, utils.CodeInvalidLineProtocol, err.Error(), nil)
+		}
+		log.Printf("❌ Line protocol write failed after %d points: %v", result.Imported, err)
+		return dbError(c, err, "Failed to write line protocol points")
+	}
+
+	if result.Errored > 0 {
+		message := fmt.Sprintf("partial write: %d lines rejected, %d points written", result.Errored, result.Imported)
+		if result.Imported == 0 {
+			message = fmt.Sprintf("no points written: %d lines rejected", result.Errored)
+		}
+		if len(result.Errors) > 0 {
+			message += fmt.Sprintf(" (line %d: %s)", result.Errors[0].Index, result.Errors[0].Reason)
+		}
+		return utils.CodedErrorResponse(c, 400, utils.CodeInvalidLineProtocol, message, result)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"wattwise/internal/services"
+	"wattwise/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// NotificationHandler serves /api/admin/notifications
+type NotificationHandler struct {
+	notifications *services.NotificationService
+}
+
+func NewNotificationHandler(notifications *services.NotificationService) *NotificationHandler {
+	return &NotificationHandler{notifications: notifications}
+}
+
+// TestNotifications sends a test message to every configured channel, or
+// only to "channel", and reports each result; 502 when one failed
+// Body (optional): {"channel": "email"}
+func (h *NotificationHandler) TestNotifications(c *fiber.Ctx) error {
+	var input struct {
+		Channel string `json:"channel"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return utils.ErrorResponse(c, 400, "Invalid request body")
+		}
+	}
+	channel := strings.ToLower(strings.TrimSpace(input.Channel))
+
+	results, err := h.notifications.Test(c.UserContext(), channel)
+	if errors.Is(err, services.ErrUnknownChannel) {
+		configured := h.notifications.Channels()
+		if len(configured) == 0 {
+			return utils.ErrorResponse(c, 400, "No notification channel configured (SMTP_HOST, NOTIFY_WEBHOOK_URL)")
+		}
+		return utils.ErrorResponse(c, 400, fmt.Sprintf("Channel %q not configured, use: %s", channel, strings.Join(configured, ", ")))
+	}
+
+	success := true
+	for _, result := range results {
+		success = success && result.Success
+	}
+	log.Printf("🔔 Test notification (%d channels, success=%v) by %v", len(results), success, c.Locals("username"))
+
+	status := fiber.StatusOK
+	if !success {
+		status = fiber.StatusBadGateway
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"success": success,
+		"results": results,
+	})
+}
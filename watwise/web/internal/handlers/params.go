@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"wattwise/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Query param helpers. Handlers used to drop parse errors with `_`, so a typo
+// silently fell back to the default window; these return a ValidationErrors
+// naming the param, to be sent back as a 400 by badParam.
+
+const dateLayout = "2006-01-02"
+
+// queryDate parses a YYYY-MM-DD param in local time. A missing param returns
+// def; an invalid one (including 2025-13-40) returns an error.
+func queryDate(c *fiber.Ctx, name string, def time.Time) (time.Time, error) {
+	return queryDateIn(c, name, def, time.Local)
+}
+
+// queryDateIn is queryDate with the day starting at midnight in loc
+func queryDateIn(c *fiber.Ctx, name string, def time.Time, loc *time.Location) (time.Time, error) {
+	value := strings.TrimSpace(c.Query(name))
+	if value == "" {
+		return def, nil
+	}
+	t, err := time.ParseInLocation(dateLayout, value, loc)
+	if err != nil {
+		return time.Time{}, fieldError(name, "invalid %s %q, use format YYYY-MM-DD", name, value)
+	}
+	return t, nil
+}
+
+// queryTimestamp parses a unix-millisecond param; RFC 3339 is accepted too
+// and converted to milliseconds. A missing param returns def.
+func queryTimestamp(c *fiber.Ctx, name string, def int64) (int64, error) {
+	value := strings.TrimSpace(c.Query(name))
+	if value == "" {
+		return def, nil
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil && ms >= 0 {
+		return ms, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UnixMilli(), nil
+	}
+	return 0, fieldError(name, "invalid %s %q, use unix milliseconds or RFC 3339", name, value)
+}
+
+// queryLocation parses an IANA zone name param (tz=Asia/Jakarta). A missing
+// param returns def.
+func queryLocation(c *fiber.Ctx, name string, def *time.Location) (*time.Location, error) {
+	value := strings.TrimSpace(c.Query(name))
+	if value == "" {
+		return def, nil
+	}
+	loc, err := time.LoadLocation(value)
+	if err != nil || strings.EqualFold(value, "local") {
+		return nil, fieldError(name, "invalid %s %q, use an IANA time zone like Asia/Jakarta", name, value)
+	}
+	return loc, nil
+}
+
+// startOfDay returns midnight of t's day in loc
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// checkRange rejects an end before start
+func checkRange(startName, endName string, start, end int64) error {
+	if end < start {
+		return fieldError(endName, "%s must not be before %s", endName, startName)
+	}
+	return nil
+}
+
+// badParam sends a param error as 400, with the per-field envelope for
+// ValidationErrors
+func badParam(c *fiber.Ctx, err error) error {
+	var errs ValidationErrors
+	if errors.As(err, &errs) {
+		return utils.ValidationErrorResponse(c, errs)
+	}
+	return utils.ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"log"
+	"time"
+	"wattwise/internal/models"
+	"wattwise/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PredictionHandler struct {
+	predictionService *services.PredictionService
+}
+
+func NewPredictionHandler(predictionService *services.PredictionService) *PredictionHandler {
+	return &PredictionHandler{predictionService: predictionService}
+}
+
+// GetPrediction returns the consumption forecast plus actuals for the same
+// number of past hours, so the UI can chart both
+// Usage: GET /api/energy/prediction?device_id=ESP32_001&hours=24
+func (h *PredictionHandler) GetPrediction(c *fiber.Ctx) error {
+	deviceID := c.Query("device_id", models.DefaultDeviceID)
+
+	q := newQueryParams(c)
+	hours := q.intRange("hours", 24, 1, 168)
+	if err := q.err(); err != nil {
+		return badParam(c, err)
+	}
+
+	prediction, err := h.predictionService.Compare(c.UserContext(), deviceID, hours, time.Now())
+	if err != nil {
+		log.Printf("❌ Error getting prediction for %s: %v", deviceID, err)
+		return dbError(c, err, "Failed to get prediction")
+	}
+
+	return c.JSON(prediction)
+}
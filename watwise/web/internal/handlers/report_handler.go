@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"time"
+	"wattwise/internal/models"
+	"wattwise/internal/reports"
+	"wattwise/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ReportHandler serves /api/reports
+type ReportHandler struct {
+	reports  *services.ReportService
+	location *time.Location // default zone of the month, see TIMEZONE
+}
+
+func NewReportHandler(reports *services.ReportService, location *time.Location) *ReportHandler {
+	return &ReportHandler{reports: reports, location: location}
+}
+
+// reportFormats: format query value -> content type and renderer
+var reportFormats = map[string]struct {
+	contentType string
+	render      func(io.Writer, *models.MonthlyReport) error
+}{
+	"pdf":  {reports.ContentTypePDF, reports.PDF},
+	"xlsx": {reports.ContentTypeXLSX, reports.XLSX},
+}
+
+// GetMonthlyReport renders the monthly summary, daily table, peak demand,
+// cost and carbon figures of a device as a PDF (with a daily consumption
+// chart) or an XLSX workbook, sent as an attachment
+// Usage: GET /api/reports/monthly?device_id=ESP32_001&month=2025-01&format=pdf&tz=Asia/Jakarta
+// Default: bulan ini, format pdf
+func (h *ReportHandler) GetMonthlyReport(c *fiber.Ctx) error {
+	q := newQueryParams(c)
+	deviceID := q.required("device_id")
+	loc := q.location("tz", h.location)
+	now := time.Now().In(loc)
+	month := q.month("month", time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc), loc)
+	format := q.oneOf("format", "pdf", "pdf", "xlsx")
+	if err := q.err(); err != nil {
+		return badParam(c, err)
+	}
+
+	// Assembling queries IoTDB and runs under the request timeout; the
+	// rendered file is small, rendering happens while the body is streamed
+	report, err := h.reports.MonthlyReport(c.UserContext(), deviceID, month)
+	if err != nil {
+		log.Printf("❌ Error assembling monthly report for %s: %v", deviceID, err)
+		return dbError(c, err, "Failed to assemble monthly report")
+	}
+
+	output := reportFormats[format]
+	c.Attachment(fmt.Sprintf("wattwise-%s-%s.%s", deviceID, report.Month, format))
+	c.Set(fiber.HeaderContentType, output.contentType)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := output.render(w, report); err != nil {
+			log.Printf("❌ Error rendering %s report for %s: %v", format, deviceID, err)
+			return
+		}
+		if err := w.Flush(); err != nil {
+			log.Printf("⚠️  Monthly report for %s not fully sent: %v", deviceID, err)
+		}
+	})
+
+	log.Printf("📄 Monthly %s report %s for %s requested by %v", format, report.Month, deviceID, c.Locals("username"))
+	return nil
+}
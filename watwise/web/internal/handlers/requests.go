@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Typed query params of the energy endpoints. Each parse function validates
+// every field and returns all problems at once as ValidationErrors.
+
+// HistoricalDataRequest: GET /api/energy/history
+type HistoricalDataRequest struct {
+	DeviceID  string
+	StartTime int64 // unix ms, default 24 hours ago
+	EndTime   int64 // unix ms, default now
+	Limit     int   // 1-100000, default 100
+}
+
+func parseHistoricalDataRequest(c *fiber.Ctx) (HistoricalDataRequest, error) {
+	q := newQueryParams(c)
+	now := time.Now()
+
+	req := HistoricalDataRequest{
+		DeviceID:  q.required("device_id"),
+		Limit:     q.intRange("limit", 100, 1, 100000),
+		StartTime: q.timestamp("start_time", now.Add(-24*time.Hour).UnixMilli()),
+		EndTime:   q.timestamp("end_time", now.UnixMilli()),
+	}
+	if !q.failed("start_time") && !q.failed("end_time") {
+		q.add("end_time", checkRange("start_time", "end_time", req.StartTime, req.EndTime))
+	}
+	return req, q.err()
+}
+
+var filterTypes = []string{"hourly", "daily", "weekly", "monthly", "custom_days"}
+
+// FilteredDataRequest: GET /api/energy/filtered
+type FilteredDataRequest struct {
+	DeviceID  string
+	Filter    string      // one of filterTypes, default daily
+	StartDate time.Time   // midnight in Location; monthly defaults to 30 days ago
+	EndDate   time.Time   // inclusive; monthly defaults to today
+	Days      []time.Time // custom_days only
+	Location  *time.Location
+}
+
+func (h *EnergyHandler) parseFilteredDataRequest(c *fiber.Ctx) (FilteredDataRequest, error) {
+	q := newQueryParams(c)
+
+	req := FilteredDataRequest{
+		DeviceID: q.required("device_id"),
+		Filter:   q.oneOf("filter", "daily", filterTypes...),
+		Location: q.location("tz", h.location),
+	}
+	req.StartDate = q.date("startDate", time.Time{}, req.Location)
+	req.EndDate = q.date("endDate", time.Time{}, req.Location)
+
+	switch req.Filter {
+	case "hourly", "daily", "weekly":
+		if req.StartDate.IsZero() && !q.failed("startDate") {
+			q.add("startDate", fieldError("startDate", "startDate is required for %s filter", req.Filter))
+		}
+		if req.EndDate.IsZero() && !q.failed("endDate") {
+			q.add("endDate", fieldError("endDate", "endDate is required for %s filter", req.Filter))
+		}
+	case "monthly":
+		today := startOfDay(time.Now(), req.Location)
+		if req.StartDate.IsZero() {
+			req.StartDate = today.AddDate(0, 0, -30)
+		}
+		if req.EndDate.IsZero() {
+			req.EndDate = today
+		}
+	case "custom_days":
+		days := strings.TrimSpace(c.Query("days"))
+		if days == "" {
+			q.add("days", fieldError("days", "days is required for custom_days filter"))
+		}
+		for _, day := range strings.Split(days, ",") {
+			day = strings.TrimSpace(day)
+			if day == "" {
+				continue
+			}
+			t, err := time.ParseInLocation(dateLayout, day, req.Location)
+			if err != nil {
+				q.add("days", fieldError("days", "invalid day %q in days, use format YYYY-MM-DD", day))
+				continue
+			}
+			req.Days = append(req.Days, t)
+		}
+	}
+
+	if !req.StartDate.IsZero() && !req.EndDate.IsZero() {
+		q.add("endDate", checkRange("startDate", "endDate", req.StartDate.UnixMilli(), req.EndDate.UnixMilli()))
+	}
+	return req, q.err()
+}
+
+// SummaryRequest: GET /api/energy/summary/{daily,weekly,monthly}
+type SummaryRequest struct {
+	DeviceID string
+	Date     time.Time // daily: the day, default today
+	Month    time.Time // monthly: first day of the month, default this month
+	Location *time.Location
+}
+
+func (h *EnergyHandler) parseSummaryRequest(c *fiber.Ctx) (SummaryRequest, error) {
+	q := newQueryParams(c)
+
+	req := SummaryRequest{
+		DeviceID: q.required("device_id"),
+		Location: q.location("tz", h.location),
+	}
+	today := startOfDay(time.Now(), req.Location)
+	req.Date = q.date("date", today, req.Location)
+
+	req.Month = q.month("month", time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, req.Location), req.Location)
+	return req, q.err()
+}
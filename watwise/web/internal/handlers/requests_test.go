@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"wattwise/internal/utils"
+)
+
+// validationBody is the JSON of utils.ValidationErrorResponse
+type validationBody struct {
+	Success bool               `json:"success"`
+	Code    string             `json:"code"`
+	Message string             `json:"message"`
+	Errors  []utils.FieldError `json:"errors"`
+}
+
+func TestInvalidEnergyParams(t *testing.T) {
+	e := newEnergyTestApp(t)
+
+	tests := []struct {
+		name   string
+		url    string
+		fields []string // fields reported, in order
+		code   string
+	}{
+		{"history without device_id", "/api/energy/history", []string{"device_id"}, utils.CodeDeviceIDRequired},
+		{"history limit not a number", "/api/energy/history?device_id=A&limit=abc", []string{"limit"}, utils.CodeValidationFailed},
+		{"history limit zero", "/api/energy/history?device_id=A&limit=0", []string{"limit"}, utils.CodeValidationFailed},
+		{"history limit too large", "/api/energy/history?device_id=A&limit=100001", []string{"limit"}, utils.CodeValidationFailed},
+		{"history bad start_time", "/api/energy/history?device_id=A&start_time=yesterday", []string{"start_time"}, utils.CodeValidationFailed},
+		{"history end before start", "/api/energy/history?device_id=A&start_time=2000&end_time=1000", []string{"end_time"}, utils.CodeValidationFailed},
+		{"history every bad field at once", "/api/energy/history?limit=-1&end_time=x", []string{"device_id", "limit", "end_time"}, utils.CodeValidationFailed},
+		{"filtered unknown filter", "/api/energy/filtered?device_id=A&filter=yearly", []string{"filter"}, utils.CodeValidationFailed},
+		{"filtered daily without dates", "/api/energy/filtered?device_id=A&filter=daily", []string{"startDate", "endDate"}, utils.CodeValidationFailed},
+		{"filtered bad date format", "/api/energy/filtered?device_id=A&filter=daily&startDate=01/02/2025&endDate=2025-01-03", []string{"startDate"}, utils.CodeValidationFailed},
+		{"filtered hourly impossible startDate", "/api/energy/filtered?device_id=A&filter=hourly&startDate=2025-13-40&endDate=2025-01-03", []string{"startDate"}, utils.CodeValidationFailed},
+		{"filtered daily impossible startDate", "/api/energy/filtered?device_id=A&filter=daily&startDate=2025-13-40&endDate=2025-01-03", []string{"startDate"}, utils.CodeValidationFailed},
+		{"filtered weekly impossible startDate", "/api/energy/filtered?device_id=A&filter=weekly&startDate=2025-13-40&endDate=2025-01-03", []string{"startDate"}, utils.CodeValidationFailed},
+		{"filtered monthly impossible startDate", "/api/energy/filtered?device_id=A&filter=monthly&startDate=2025-13-40", []string{"startDate"}, utils.CodeValidationFailed},
+		{"filtered impossible endDate", "/api/energy/filtered?device_id=A&filter=daily&startDate=2025-01-01&endDate=2025-02-30", []string{"endDate"}, utils.CodeValidationFailed},
+		{"compare devices impossible startDate", "/api/energy/compare?device_ids=A,B&startDate=2025-13-40", []string{"startDate"}, utils.CodeValidationFailed},
+		{"peak demand impossible startDate", "/api/energy/peak-demand?device_id=A&startDate=2025-13-40", []string{"startDate"}, utils.CodeValidationFailed},
+		{"filtered end before start", "/api/energy/filtered?device_id=A&filter=daily&startDate=2025-01-03&endDate=2025-01-01", []string{"endDate"}, utils.CodeValidationFailed},
+		{"filtered custom_days without days", "/api/energy/filtered?device_id=A&filter=custom_days", []string{"days"}, utils.CodeValidationFailed},
+		{"filtered custom_days bad day", "/api/energy/filtered?device_id=A&filter=custom_days&days=2025-01-01,2025-01-xx", []string{"days"}, utils.CodeValidationFailed},
+		{"filtered unknown tz", "/api/energy/filtered?device_id=A&filter=monthly&tz=Mars/Olympus", []string{"tz"}, utils.CodeValidationFailed},
+		{"daily summary bad date", "/api/energy/summary/daily?device_id=A&date=2025-02-30", []string{"date"}, utils.CodeValidationFailed},
+		{"monthly summary bad month", "/api/energy/summary/monthly?device_id=A&month=2025-13", []string{"month"}, utils.CodeValidationFailed},
+		{"weekly summary without device_id", "/api/energy/summary/weekly", []string{"device_id"}, utils.CodeDeviceIDRequired},
+		{"data negative limit", "/api/energy/data?limit=-5", []string{"limit"}, utils.CodeValidationFailed},
+		{"gaps tolerance too small", "/api/energy/gaps?device_id=A&tolerance=1", []string{"tolerance"}, utils.CodeValidationFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body validationBody
+			if status := doJSON(t, e.app, "GET", tt.url, "", &body); status != 400 {
+				t.Fatalf("status = %d, want 400", status)
+			}
+			if body.Success || body.Code != tt.code || body.Message == "" {
+				t.Errorf("body = %+v, want success=false code=%s and a message", body, tt.code)
+			}
+			var fields []string
+			for _, fe := range body.Errors {
+				fields = append(fields, fe.Field)
+				if fe.Message == "" {
+					t.Errorf("field %s without message", fe.Field)
+				}
+			}
+			if !slices.Equal(fields, tt.fields) {
+				t.Errorf("fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestValidEnergyParams(t *testing.T) {
+	e := newEnergyTestApp(t)
+
+	for _, url := range []string{
+		"/api/energy/history?device_id=A&limit=10&start_time=2025-01-01T00:00:00Z&end_time=2025-01-02T00:00:00Z",
+		"/api/energy/filtered?device_id=A&filter=daily&startDate=2025-01-01&endDate=2025-01-03",
+		"/api/energy/filtered?device_id=A&filter=custom_days&days=2025-01-01,2025-01-05",
+		"/api/energy/summary/monthly?device_id=A&month=2025-01&tz=UTC",
+	} {
+		resp, err := e.app.Test(httptest.NewRequest("GET", url, nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 200 {
+			t.Errorf("%s: status %d, want 200", url, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"log"
+	"slices"
+	"strings"
+	"time"
+	"wattwise/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// cacheRange tells the response cache which device and local time range a
+// request covers, so a new reading inside it can invalidate the response.
+// ok=false means the request is not cached (invalid params, let the handler
+// answer with the error).
+type cacheRange func(c *fiber.Ctx) (deviceID string, from, to time.Time, ok bool)
+
+// cached serves successful JSON responses from the EnergyService response
+// cache and sets an ETag; a matching If-None-Match gets 304 without a body.
+// Without a cache (RESPONSE_CACHE_TTL_SECONDS=0) it only calls the handler.
+func (h *EnergyHandler) cached(rangeOf cacheRange) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		cache := h.energyService.ResponseCache()
+		if cache == nil {
+			return c.Next()
+		}
+		deviceID, from, to, ok := rangeOf(c)
+		if !ok {
+			return c.Next()
+		}
+
+		key := cacheKey(c)
+		if entry, hit := cache.Get(key); hit {
+			c.Set("X-Cache", "HIT")
+			return sendCached(c, entry.ETag, entry.Body)
+		}
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+		if c.Response().StatusCode() != fiber.StatusOK {
+			return nil
+		}
+
+		// Ditambah 1 hari di kedua sisi: sebagian filter memakai UTC,
+		// sebagian waktu lokal
+		body := slices.Clone(c.Response().Body())
+		entry := cache.Set(key, strings.Clone(deviceID), from.AddDate(0, 0, -1), to.AddDate(0, 0, 1), body)
+		c.Set("X-Cache", "MISS")
+		return sendCached(c, entry.ETag, body)
+	}
+}
+
+func sendCached(c *fiber.Ctx, etag string, body []byte) error {
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	if etagMatches(c.Get(fiber.HeaderIfNoneMatch), etag) {
+		c.Response().ResetBody()
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Status(fiber.StatusOK).Send(body)
+}
+
+// etagMatches checks an If-None-Match header, which may list several tags or *
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheKey is the path plus the query params in sorted order, so
+// ?a=1&b=2 and ?b=2&a=1 share an entry
+func cacheKey(c *fiber.Ctx) string {
+	queries := c.Queries()
+	names := make([]string, 0, len(queries))
+	for name := range queries {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	b.WriteString(c.Path())
+	for i, name := range names {
+		if i == 0 {
+			b.WriteByte('?')
+		} else {
+			b.WriteByte('&')
+		}
+		b.WriteString(name + "=" + queries[name])
+	}
+	return b.String()
+}
+
+// CacheDailySummary caches GET /api/energy/summary/daily
+func (h *EnergyHandler) CacheDailySummary() fiber.Handler {
+	return h.cached(h.dailySummaryRange)
+}
+
+// CacheFiltered caches GET /api/energy/filtered
+func (h *EnergyHandler) CacheFiltered() fiber.Handler {
+	return h.cached(h.filteredRange)
+}
+
+func (h *EnergyHandler) dailySummaryRange(c *fiber.Ctx) (string, time.Time, time.Time, bool) {
+	req, err := h.parseSummaryRequest(c)
+	if err != nil {
+		return "", time.Time{}, time.Time{}, false
+	}
+	return req.DeviceID, req.Date, req.Date.AddDate(0, 0, 1), true
+}
+
+func (h *EnergyHandler) filteredRange(c *fiber.Ctx) (string, time.Time, time.Time, bool) {
+	req, err := h.parseFilteredDataRequest(c)
+	if err != nil {
+		return "", time.Time{}, time.Time{}, false
+	}
+
+	from, to := req.StartDate, req.EndDate
+	for _, day := range req.Days {
+		if from.IsZero() || day.Before(from) {
+			from = day
+		}
+		if day.After(to) {
+			to = day
+		}
+	}
+	return req.DeviceID, from, to.AddDate(0, 0, 1), true
+}
+
+// cacheStatsResponse keeps the response cache stats at the top level (older
+// clients) and adds the monthly summary cache
+type cacheStatsResponse struct {
+	services.CacheStats
+	MonthlySummaries services.CacheStats `json:"monthly_summaries"`
+}
+
+// GetCacheStats reports response and monthly summary cache hits, misses and
+// size (admin)
+func (h *EnergyHandler) GetCacheStats(c *fiber.Ctx) error {
+	return c.JSON(cacheStatsResponse{
+		CacheStats:       h.energyService.ResponseCache().Stats(),
+		MonthlySummaries: h.energyService.SummaryCache().Stats(),
+	})
+}
+
+// FlushCache drops every cached response and monthly summary (admin)
+func (h *EnergyHandler) FlushCache(c *fiber.Ctx) error {
+	flushed := 0
+	if cache := h.energyService.ResponseCache(); cache != nil {
+		flushed = cache.Flush()
+	}
+	summaries := h.energyService.SummaryCache().Flush()
+	log.Printf("🧹 Cache flushed: %d responses, %d monthly summaries", flushed, summaries)
+	return c.JSON(fiber.Map{"flushed": flushed, "flushed_summaries": summaries})
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"wattwise/internal/models"
+	"wattwise/internal/services"
+	"wattwise/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// rollupBucket returns the filter group of an hour: its sort key and the row
+// it is summed into
+type rollupBucket func(hour time.Time) (string, models.FilteredEnergyData)
+
+func dailyBucket(hour time.Time) (string, models.FilteredEnergyData) {
+	key := hour.Format(dateLayout)
+	return key, models.FilteredEnergyData{TimeGroup: key, Date: key}
+}
+
+func weeklyBucket(hour time.Time) (string, models.FilteredEnergyData) {
+	year, week := hour.ISOWeek()
+	key := fmt.Sprintf("%d-W%02d", year, week)
+	weekStart := hour.AddDate(0, 0, -int(hour.Weekday())+1)
+	return key, models.FilteredEnergyData{TimeGroup: weekStart.Format(dateLayout), Week: key}
+}
+
+func monthlyBucket(hour time.Time) (string, models.FilteredEnergyData) {
+	key := hour.Format("2006-01")
+	return key, models.FilteredEnergyData{TimeGroup: key + "-01", Date: key + "-01"}
+}
+
+// bucketKey returns the group key of a bucket for services.ReadingsEnergyBy
+func bucketKey(bucket rollupBucket, loc *time.Location) func(time.Time) string {
+	return func(t time.Time) string {
+		key, _ := bucket(t.In(loc))
+		return key
+	}
+}
+
+// getRollupData builds the daily/weekly/monthly filter from hourly rollups
+// (services.EnergyService.GetHourlyRollups). ok is false when the device has
+// no rollups for the range yet and the caller has to use raw readings.
+// Rollups are whole UTC hours, so zones with a half-hour offset put up to
+// 30 minutes into the neighbouring day.
+func (h *EnergyHandler) getRollupData(ctx context.Context, deviceID string, startMs, endMs int64, loc *time.Location, bucket rollupBucket) ([]models.FilteredEnergyData, bool, error) {
+	rollups, ok, err := h.energyService.GetHourlyRollups(ctx, deviceID, startMs, endMs)
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+
+	groups := make(map[string]*models.FilteredEnergyData)
+	for _, r := range rollups {
+		key, row := bucket(time.UnixMilli(r.Hour).In(loc))
+
+		data, exists := groups[key]
+		if !exists {
+			row.MinPower = r.PowerMin
+			row.MaxPower = r.PowerMax
+			data = &row
+			groups[key] = data
+		}
+
+		// Rata-rata per jam ditimbang dengan jumlah sample-nya
+		n := float64(r.Samples)
+		data.TotalKWh += r.KWh
+		data.AvgPower += r.PowerAvg * n
+		data.AvgVoltage += r.VoltageAvg * n
+		data.AvgCurrent += r.CurrentAvg * n
+		data.MaxPower = max(data.MaxPower, r.PowerMax)
+		data.MinPower = min(data.MinPower, r.PowerMin)
+		data.DataCount += int(r.Samples)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+
+	results := make([]models.FilteredEnergyData, 0, len(keys))
+	for _, key := range keys {
+		data := groups[key]
+		if data.DataCount > 0 {
+			data.AvgPower /= float64(data.DataCount)
+			data.AvgVoltage /= float64(data.DataCount)
+			data.AvgCurrent /= float64(data.DataCount)
+		}
+		results = append(results, *data)
+	}
+	return results, true, nil
+}
+
+// BackfillRollups handles POST /api/admin/rollup/backfill: recomputes the
+// hourly rollups of [start_date, end_date] in the background, for one device
+// or (without device_id) all of them
+func (h *EnergyHandler) BackfillRollups(c *fiber.Ctx) error {
+	q := newQueryParams(c)
+	deviceID := strings.TrimSpace(c.Query("device_id"))
+	q.required("start_date")
+	q.required("end_date")
+	loc := q.location("tz", h.location)
+	start, end := q.dateRange("start_date", "end_date", 1, loc)
+	if err := q.err(); err != nil {
+		return badParam(c, err)
+	}
+
+	rollups := h.energyService.Rollups()
+	if !rollups.Enabled() {
+		return utils.ErrorResponse(c, fiber.StatusServiceUnavailable, "Hourly rollups are disabled (ROLLUP_INTERVAL_MINUTES=0)")
+	}
+	if !h.db.IsEnabled() {
+		return iotdbUnavailable(c)
+	}
+
+	var devices []string
+	if deviceID != "" {
+		devices = []string{deviceID}
+	}
+	end = end.AddDate(0, 0, 1) // bukan +24 jam, hari DST bisa 23/25 jam
+
+	devices, err := rollups.Backfill(devices, start, end)
+	if err != nil {
+		if errors.Is(err, services.ErrBackfillRunning) {
+			return utils.ErrorResponse(c, fiber.StatusConflict, err.Error())
+		}
+		log.Printf("ERROR: Rollup backfill failed: %v", err)
+		return dbError(c, err, "Failed to backfill rollups")
+	}
+
+	log.Printf("🧮 Rollup backfill started for %d device(s) from %s to %s by %v", len(devices), start.Format(time.RFC3339), end.Format(time.RFC3339), c.Locals("username"))
+
+	return c.Status(fiber.StatusAccepted).JSON(models.RollupBackfill{
+		Devices: devices,
+		From:    start,
+		To:      end,
+		Status:  "started",
+	})
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"wattwise/internal/models"
+	"wattwise/internal/services"
+	"wattwise/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SettingsHandler serves /api/admin/settings
+type SettingsHandler struct {
+	settings *services.SettingsManager
+	audit    *services.AuditService
+}
+
+func NewSettingsHandler(settings *services.SettingsManager) *SettingsHandler {
+	return &SettingsHandler{settings: settings}
+}
+
+// SetAudit records settings changes in the audit trail
+func (h *SettingsHandler) SetAudit(audit *services.AuditService) {
+	h.audit = audit
+}
+
+// GetSettings returns the effective runtime settings and which of them are
+// overridden through the API
+func (h *SettingsHandler) GetSettings(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"settings":  h.settings.Current(),
+		"overrides": h.settings.Overrides(),
+	})
+}
+
+// UpdateSettings changes runtime settings without a restart; a null value
+// removes the override so the .env value applies again
+// Body: {"tariff_per_kwh": 1500, "anomaly_alerts": false, "log_level": null}
+func (h *SettingsHandler) UpdateSettings(c *fiber.Ctx) error {
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &patch); err != nil || len(patch) == 0 {
+		return utils.ErrorResponse(c, 400, "Invalid request body")
+	}
+
+	username, _ := c.Locals("username").(string)
+	settings, changes, err := h.settings.Update(patch, username)
+	if errors.Is(err, services.ErrInvalidSettings) {
+		return utils.ErrorResponse(c, 400, err.Error())
+	}
+	if err != nil {
+		log.Printf("❌ Failed to update settings: %v", err)
+		return utils.ErrorResponse(c, 500, "Failed to update settings")
+	}
+
+	log.Printf("⚙️ Settings updated by %s: %d change(s)", username, len(changes))
+	if len(changes) > 0 {
+		event := auditEvent(c, models.AuditSettingsChanged, "settings")
+		event.Details = map[string]interface{}{"changes": changes}
+		h.audit.Record(event)
+	}
+	return c.JSON(fiber.Map{
+		"settings": settings,
+		"changes":  changes,
+	})
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	sseHeartbeat = 15 * time.Second
+	sseBuffer    = 64
+)
+
+// SSEHandler serves GET /api/energy/stream and /api/energy/events, a
+// Server-Sent Events fallback for clients behind proxies that drop WebSocket
+// upgrades. It reads the same EventFanout as the WebSocket hub, without the
+// hub's coalescing.
+type SSEHandler struct {
+	events *EventFanout
+	types  []string // event types sent, empty = all
+}
+
+// NewSSEHandler streams the given event types, or every type when none given
+func NewSSEHandler(events *EventFanout, types ...string) *SSEHandler {
+	return &SSEHandler{events: events, types: types}
+}
+
+func (h *SSEHandler) sends(event Event) bool {
+	return len(h.types) == 0 || slices.Contains(h.types, event.Type)
+}
+
+// Stream sends every fan-out event of the handler's types as
+//
+//	id: <id>
+//	event: reading | alert | device_status | forecast
+//	data: <json>
+//
+// A reconnecting client (Last-Event-ID header or last_event_id query) first
+// gets the buffered events after that id. A ": heartbeat" comment goes out
+// every 15 s; the first failed write ends the stream and unsubscribes.
+func (h *SSEHandler) Stream(c *fiber.Ctx) error {
+	lastID := c.Get("Last-Event-ID", c.Query("last_event_id"))
+	var after uint64
+	if lastID != "" {
+		id, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			return badParam(c, fieldError("last_event_id", "invalid Last-Event-ID %q, expected an event id", lastID))
+		}
+		after = id
+	}
+
+	replay, events, cancel := h.events.SubscribeAfter(after, sseBuffer, true)
+	client := fmt.Sprintf("%s (%v)", c.IP(), c.Locals("username"))
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // nginx: jangan buffer stream
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		log.Printf("📡 SSE client connected: %s %s, replaying up to %d event(s)", client, c.Path(), len(replay))
+		defer log.Printf("📡 SSE client disconnected: %s", client)
+
+		// Jeda reconnect EventSource
+		fmt.Fprint(w, "retry: 3000\n\n")
+		for _, event := range replay {
+			if !h.sends(event) {
+				continue
+			}
+			if writeSSE(w, event) != nil {
+				return
+			}
+		}
+		if w.Flush() != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(sseHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					// Terlalu lambat dan dikeluarkan dari fan-out; client
+					// reconnect dengan Last-Event-ID
+					log.Printf("⚠️ SSE client %s fell behind, closing stream", client)
+					return
+				}
+				if !h.sends(event) {
+					continue
+				}
+				if writeSSE(w, event) != nil || w.Flush() != nil {
+					return
+				}
+
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+				if w.Flush() != nil {
+					return
+				}
+			}
+		}
+	})
+	return nil
+}
+
+func writeSSE(w *bufio.Writer, event Event) error {
+	data, err := json.Marshal(event.Payload)
+	if err != nil {
+		log.Printf("❌ Failed to encode %s event %d: %v", event.Type, event.ID, err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+	"wattwise/internal/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Rows written between flushes of a streamed response
+const streamFlushRows = 500
+
+// streamData sends {<fields>, "data": [...], "count": n, "success": true},
+// with the rows emitted one by one by produce while it reads the database,
+// so a large result is never held in memory. The body is written after the
+// handler returns: an error from produce can no longer change the status,
+// it ends the object with "success": false and "error" instead. produce's ctx
+// is bounded by the request's timeout budget (middleware.Timeout), counted
+// from when the body starts.
+func streamData(c *fiber.Ctx, fields fiber.Map, produce func(ctx context.Context, emit func(row interface{}) error) error) error {
+	if fields == nil {
+		fields = fiber.Map{}
+	}
+	prefix, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	path := c.Path()
+	budget, _ := c.Locals(middleware.TimeoutLocal).(time.Duration)
+	base := c.Context() // c tidak boleh dipakai lagi di stream writer
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// {"a":1} -> {"a":1,"data":[
+		w.Write(prefix[:len(prefix)-1])
+		if len(fields) > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(`"data":[`)
+
+		ctx, cancel := budgetContext(base, budget)
+		defer cancel()
+
+		count := 0
+		err := produce(ctx, func(row interface{}) error {
+			b, err := json.Marshal(row)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				w.WriteByte(',')
+			}
+			w.Write(b)
+			count++
+			if count%streamFlushRows == 0 {
+				return w.Flush() // gagal kalau client sudah disconnect
+			}
+			return nil
+		})
+
+		tail := fiber.Map{"count": count, "success": err == nil}
+		if err != nil {
+			log.Printf("❌ Streaming %s stopped after %d rows: %v", path, count, err)
+			tail["error"] = err.Error()
+		}
+		b, _ := json.Marshal(tail)
+		w.WriteString("],")
+		w.Write(b[1:])
+		w.Flush()
+	})
+	return nil
+}
+
+// streamNDJSON writes each row emitted by produce as one JSON object per line
+// (application/x-ndjson), flushed every streamFlushRows rows. With summary a
+// last line {"count": n, "success": bool, "error": "..."} tells the client
+// whether the stream is complete; without it a failed stream simply ends.
+// produce's ctx is budgeted as in streamData.
+func streamNDJSON(c *fiber.Ctx, summary bool, produce func(ctx context.Context, emit func(row interface{}) error) error) error {
+	path := c.Path()
+	budget, _ := c.Locals(middleware.TimeoutLocal).(time.Duration)
+	base := c.Context() // c tidak boleh dipakai lagi di stream writer
+
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := budgetContext(base, budget)
+		defer cancel()
+
+		count := 0
+		err := produce(ctx, func(row interface{}) error {
+			b, err := json.Marshal(row)
+			if err != nil {
+				return err
+			}
+			w.Write(b)
+			w.WriteByte('\n')
+			count++
+			if count%streamFlushRows == 0 {
+				return w.Flush() // gagal kalau client sudah disconnect
+			}
+			return nil
+		})
+
+		if err != nil {
+			log.Printf("❌ Streaming %s stopped after %d rows: %v", path, count, err)
+		}
+		if summary {
+			tail := fiber.Map{"count": count, "success": err == nil}
+			if err != nil {
+				tail["error"] = err.Error()
+			}
+			b, _ := json.Marshal(tail)
+			w.Write(b)
+			w.WriteByte('\n')
+		}
+		w.Flush()
+	})
+	return nil
+}
+
+// budgetContext bounds parent to budget, 0 = no limit
+func budgetContext(parent context.Context, budget time.Duration) (context.Context, context.CancelFunc) {
+	if budget <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, budget)
+}
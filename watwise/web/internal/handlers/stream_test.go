@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"wattwise/internal/models"
+)
+
+const benchRows = 100_000
+
+// newBenchApp is an energyTestApp holding benchRows readings of device A,
+// one every 10 s from start
+func newBenchApp(b *testing.B) (*energyTestApp, time.Time) {
+	b.Helper()
+	e := newEnergyTestApp(b)
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, testLocation)
+	readings := make([]models.EnergyData, benchRows)
+	for i := range readings {
+		readings[i] = reading(start.Add(time.Duration(i)*10*time.Second), 100+float64(i%50), float64(i)*0.001)
+	}
+	e.seed(b, "A", readings...)
+	return e, start
+}
+
+// benchGet requests url b.N times, checking the body once for want
+func benchGet(b *testing.B, e *energyTestApp, url, want string) {
+	b.Helper()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := e.app.Test(httptest.NewRequest("GET", url, nil), -1)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if i == 0 {
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != 200 || !strings.Contains(string(body), want) {
+				b.Fatalf("status %d, body without %s: ...%s", resp.StatusCode, want, body[max(0, len(body)-200):])
+			}
+		} else {
+			io.Copy(io.Discard, resp.Body)
+		}
+		resp.Body.Close()
+	}
+	b.ReportMetric(float64(benchRows)*float64(b.N)/b.Elapsed().Seconds(), "rows/s")
+}
+
+func BenchmarkStreamHistory(b *testing.B) {
+	e, start := newBenchApp(b)
+	url := fmt.Sprintf("/api/energy/history?device_id=A&limit=%d&start_time=%d&end_time=%d",
+		benchRows, start.UnixMilli(), start.AddDate(0, 1, 0).UnixMilli())
+	benchGet(b, e, url, fmt.Sprintf(`"count":%d,"success":true`, benchRows))
+}
+
+func BenchmarkStreamRaw(b *testing.B) {
+	e, start := newBenchApp(b)
+	url := fmt.Sprintf("/api/energy/raw?device_id=A&summary=true&start=%d&end=%d",
+		start.UnixMilli(), start.AddDate(0, 1, 0).UnixMilli())
+	benchGet(b, e, url, fmt.Sprintf(`{"count":%d,"success":true}`, benchRows))
+}
+
+// Summary bulanan: satu streaming query, diagregasi per hari tanpa
+// menyimpan reading
+func BenchmarkMonthlySummary(b *testing.B) {
+	e, _ := newBenchApp(b)
+	benchGet(b, e, "/api/energy/summary/monthly?device_id=A&month=2025-01", `"month":"2025-01"`)
+}
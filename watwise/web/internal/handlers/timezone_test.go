@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+	"wattwise/internal/models"
+)
+
+func TestFilteredAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no tz database: %v", err)
+	}
+	e := newEnergyTestApp(t)
+
+	// Satu reading per jam nyata dari 8 Maret dan 1 November (waktu New York)
+	for _, first := range []time.Time{time.Date(2025, 3, 8, 0, 0, 0, 0, loc), time.Date(2025, 11, 1, 0, 0, 0, 0, loc)} {
+		kwh := 0.0
+		for ts := first; ts.Before(first.AddDate(0, 0, 3)); ts = ts.Add(time.Hour) {
+			e.seed(t, "A", reading(ts.Add(30*time.Minute), 100, kwh))
+			kwh += 0.1
+		}
+	}
+
+	filtered := func(query string) []models.FilteredEnergyData {
+		t.Helper()
+		var body models.FilteredResponse
+		if status := doJSON(t, e.app, "GET", "/api/energy/filtered?device_id=A&tz=America/New_York&"+query, "", &body); status != 200 {
+			t.Fatalf("%s: status %d", query, status)
+		}
+		return body.Data
+	}
+
+	for query, want := range map[string][]int{
+		"filter=daily&startDate=2025-03-08&endDate=2025-03-10": {24, 23, 24},
+		"filter=daily&startDate=2025-11-01&endDate=2025-11-03": {24, 25, 24},
+	} {
+		rows := filtered(query)
+		if len(rows) != len(want) {
+			t.Fatalf("%s: %d days, want %d", query, len(rows), len(want))
+		}
+		for i, row := range rows {
+			if row.DataCount != want[i] {
+				t.Errorf("%s: %s has %d readings, want %d", query, row.TimeGroup, row.DataCount, want[i])
+			}
+		}
+	}
+
+	// 23 jam: 02:00 tidak ada
+	spring := filtered("filter=hourly&startDate=2025-03-09&endDate=2025-03-09")
+	if len(spring) != 23 {
+		t.Errorf("2025-03-09: %d hours, want 23", len(spring))
+	}
+	for _, row := range spring {
+		if row.TimeGroup == "2025-03-09 02:00:00" {
+			t.Errorf("2025-03-09 has a 02:00 bucket")
+		}
+	}
+
+	// 25 jam: 01:00 terjadi dua kali dan jatuh di bucket yang sama
+	fall := filtered("filter=hourly&startDate=2025-11-02&endDate=2025-11-02")
+	total := 0
+	for _, row := range fall {
+		total += row.DataCount
+		if want := map[bool]int{true: 2, false: 1}[row.TimeGroup == "2025-11-02 01:00:00"]; row.DataCount != want {
+			t.Errorf("%s: %d readings, want %d", row.TimeGroup, row.DataCount, want)
+		}
+	}
+	if len(fall) != 24 || total != 25 {
+		t.Errorf("2025-11-02: %d buckets with %d readings, want 24 with 25", len(fall), total)
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"wattwise/internal/models"
+	"wattwise/internal/repositories"
+	"wattwise/internal/services"
+	"wattwise/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// UserHandler serves /api/admin/users
+type UserHandler struct {
+	users *services.UserService
+	audit *services.AuditService
+}
+
+func NewUserHandler(users *services.UserService) *UserHandler {
+	return &UserHandler{users: users}
+}
+
+// SetAudit records account creation and deletion in the audit trail
+func (h *UserHandler) SetAudit(audit *services.AuditService) {
+	h.audit = audit
+}
+
+// ListUsers returns all accounts (without passwords)
+func (h *UserHandler) ListUsers(c *fiber.Ctx) error {
+	users := h.users.List()
+
+	return c.JSON(fiber.Map{
+		"count": len(users),
+		"users": users,
+	})
+}
+
+// CreateUser adds an account
+// Body: {"username": "budi", "password": "...", "email": "budi@rumah.id", "role": "viewer"}
+func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
+	var input models.UserInput
+	if err := c.BodyParser(&input); err != nil {
+		return utils.ErrorResponse(c, 400, "Invalid request body")
+	}
+
+	user, err := h.users.Create(input)
+	if err != nil {
+		return userError(c, err)
+	}
+
+	log.Printf("👤 User %s created with role %s by %v", user.Username, user.Role, c.Locals("username"))
+	event := auditEvent(c, models.AuditUserCreated, user.Username)
+	event.Details = map[string]interface{}{"role": user.Role}
+	h.audit.Record(event)
+	return c.Status(fiber.StatusCreated).JSON(user)
+}
+
+// UpdateUser changes email, password and/or role of an account. A new role
+// takes effect at the user's next login or token refresh.
+// Body: {"role": "admin"}
+func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
+	var input models.UserInput
+	if err := c.BodyParser(&input); err != nil {
+		return utils.ErrorResponse(c, 400, "Invalid request body")
+	}
+
+	user, err := h.users.Update(c.Params("username"), input)
+	if err != nil {
+		return userError(c, err)
+	}
+
+	log.Printf("👤 User %s updated (role %s) by %v", user.Username, user.Role, c.Locals("username"))
+	return c.JSON(user)
+}
+
+// DeleteUser removes an account; its refresh tokens stop working
+func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
+	username := c.Params("username")
+	if err := h.users.Delete(username); err != nil {
+		return userError(c, err)
+	}
+
+	log.Printf("👤 User %s deleted by %v", username, c.Locals("username"))
+	h.audit.Record(auditEvent(c, models.AuditUserDeleted, username))
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "User deleted",
+	})
+}
+
+func userError(c *fiber.Ctx, err error) error {
+	status := 500
+	switch {
+	case errors.Is(err, services.ErrInvalidUser):
+		status = 400
+	case errors.Is(err, repositories.ErrUserNotFound):
+		status = 404
+	case errors.Is(err, repositories.ErrUserExists), errors.Is(err, services.ErrLastAdmin):
+		status = 409
+	default:
+		log.Printf("❌ User store error: %v", err)
+		return utils.ErrorResponse(c, status, "Failed to save user")
+	}
+
+	return utils.ErrorResponse(c, status, err.Error())
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"wattwise/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ValidationErrors lists every invalid field of a request. badParam sends it
+// with 400 via utils.ValidationErrorResponse.
+type ValidationErrors []utils.FieldError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// fieldError returns a ValidationErrors with one entry
+func fieldError(field, format string, args ...interface{}) error {
+	return ValidationErrors{{Field: field, Message: fmt.Sprintf(format, args...)}}
+}
+
+// requiredError reports a missing field, with code e.g. DEVICE_ID_REQUIRED
+func requiredError(field string) error {
+	return ValidationErrors{{Field: field, Message: field + " is required", Code: utils.RequiredCode(field)}}
+}
+
+// queryParams reads query params and collects every error instead of
+// stopping at the first, so a client sees all bad fields at once:
+//
+//	q := newQueryParams(c)
+//	deviceID := q.required("device_id")
+//	limit := q.intRange("limit", 100, 1, 1000)
+//	if err := q.err(); err != nil {
+//		return badParam(c, err)
+//	}
+type queryParams struct {
+	c    *fiber.Ctx
+	errs ValidationErrors
+}
+
+func newQueryParams(c *fiber.Ctx) *queryParams {
+	return &queryParams{c: c}
+}
+
+// add records err; non-validation errors are attributed to field
+func (q *queryParams) add(field string, err error) {
+	if err == nil {
+		return
+	}
+	var errs ValidationErrors
+	if errors.As(err, &errs) {
+		q.errs = append(q.errs, errs...)
+		return
+	}
+	q.errs = append(q.errs, utils.FieldError{Field: field, Message: err.Error()})
+}
+
+func (q *queryParams) failed(field string) bool {
+	return slices.ContainsFunc(q.errs, func(fe utils.FieldError) bool { return fe.Field == field })
+}
+
+func (q *queryParams) err() error {
+	if len(q.errs) == 0 {
+		return nil
+	}
+	return q.errs
+}
+
+func (q *queryParams) required(name string) string {
+	value := strings.TrimSpace(q.c.Query(name))
+	if value == "" {
+		q.add(name, requiredError(name))
+	}
+	return value
+}
+
+func (q *queryParams) oneOf(name, def string, allowed ...string) string {
+	value := strings.TrimSpace(q.c.Query(name, def))
+	if !slices.Contains(allowed, value) {
+		q.add(name, fieldError(name, "invalid %s %q, use: %s", name, value, strings.Join(allowed, ", ")))
+	}
+	return value
+}
+
+func (q *queryParams) intRange(name string, def, min, max int) int {
+	value := strings.TrimSpace(q.c.Query(name))
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		q.add(name, fieldError(name, "%s must be a number between %d and %d", name, min, max))
+		return def
+	}
+	return n
+}
+
+// floatRange reads a number in (min, max]
+func (q *queryParams) floatRange(name string, def, min, max float64) float64 {
+	value := strings.TrimSpace(q.c.Query(name))
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || !(f > min && f <= max) {
+		q.add(name, fieldError(name, "%s must be a number above %g and at most %g", name, min, max))
+		return def
+	}
+	return f
+}
+
+func (q *queryParams) date(name string, def time.Time, loc *time.Location) time.Time {
+	t, err := queryDateIn(q.c, name, def, loc)
+	q.add(name, err)
+	return t
+}
+
+// month reads YYYY-MM as the first day of that month in loc
+func (q *queryParams) month(name string, def time.Time, loc *time.Location) time.Time {
+	value := strings.TrimSpace(q.c.Query(name))
+	if value == "" {
+		return def
+	}
+	month, err := time.ParseInLocation("2006-01", value, loc)
+	if err != nil {
+		q.add(name, fieldError(name, "invalid month %q, use format YYYY-MM", value))
+		return def
+	}
+	return month
+}
+
+func (q *queryParams) timestamp(name string, def int64) int64 {
+	ms, err := queryTimestamp(q.c, name, def)
+	q.add(name, err)
+	return ms
+}
+
+func (q *queryParams) location(name string, def *time.Location) *time.Location {
+	loc, err := queryLocation(q.c, name, def)
+	if err != nil {
+		q.add(name, err)
+		return def
+	}
+	return loc
+}
+
+// dateRange reads an inclusive YYYY-MM-DD range; by default the last days
+// days up to today
+func (q *queryParams) dateRange(startName, endName string, days int, loc *time.Location) (time.Time, time.Time) {
+	end := q.date(endName, startOfDay(time.Now(), loc), loc)
+	start := q.date(startName, end.AddDate(0, 0, -(days-1)), loc)
+	if !q.failed(startName) && !q.failed(endName) {
+		q.add(endName, checkRange(startName, endName, start.UnixMilli(), end.UnixMilli()))
+	}
+	return start, end
+}
@@ -1,39 +1,149 @@
 package handlers
 
 import (
+	"cmp"
+	"context"
+	"encoding/json"
 	"log"
+	"log/slog"
+	"slices"
 	"sync"
 	"time"
 	"wattwise/internal/database"
 	"wattwise/internal/models"
 
+	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
 )
 
+// Readings sent as the "history" frame on connect, see SetHistorySize
+const (
+	defaultHistorySize = 100
+	maxHistorySize     = 1000
+)
+
+// What the hub does when the broadcast buffer is full, see SetBroadcastBuffer
+const (
+	// BroadcastDropOldest drops the oldest pending message; a realtime
+	// reading or forecast replaces the pending one of the same device
+	BroadcastDropOldest = "drop-oldest"
+	// BroadcastDropNewest drops the message being broadcast
+	BroadcastDropNewest = "drop-newest"
+
+	defaultBroadcastBuffer = 100
+	defaultFlushInterval   = 250 * time.Millisecond
+)
+
+// maxHistoryRange is the widest range a client may ask for with the
+// "history" command
+const maxHistoryRange = 7 * 24 * time.Hour
+
+// clientCommand is a text frame sent by a client, e.g.
+// {"action":"history","device_id":"ESP32_001","start":1735689600000,"end":1735693200000}
+type clientCommand struct {
+	Action   string `json:"action"`
+	DeviceID string `json:"device_id"`
+	Start    int64  `json:"start"` // unix ms
+	End      int64  `json:"end"`   // unix ms, default now
+}
+
 type WebSocketHandler struct {
-	db           *database.IoTDB
+	db     database.Store
+	logger *slog.Logger
+	// Broadcast* publish here; the hub and SSE streams subscribe
+	events       *EventFanout
+	historySize  int
 	clients      map[*websocket.Conn]bool
 	clientsMutex sync.RWMutex
-	broadcast    chan interface{}
 	register     chan *websocket.Conn
-	unregister   chan *websocket.Conn
+	unregister   chan unregisterRequest
+
+	// Pending broadcasts, drained by the hub when notify fires
+	queueMutex      sync.Mutex
+	queue           []broadcastMessage
+	bufferSize      int
+	policy          string
+	notify          chan struct{}
+	droppedOldest   int64
+	droppedNewest   int64
+	coalesced       int64
+	broadcastsTotal int64
+
+	// Realtime readings wait here, latest per device, until the next flush
+	// tick (see SetFlushInterval); 0 = broadcast every reading right away
+	flushInterval   time.Duration
+	flushTicker     *time.Ticker
+	pendingRealtime map[string]models.RealtimeData
+
+	// Write bare objects instead of models.WSMessage, see SetLegacyFormat
+	legacyFormat bool
 }
 
-func NewWebSocketHandler(db *database.IoTDB) *WebSocketHandler {
+// broadcastMessage is a pending broadcast; messages with the same non-empty
+// key are coalesced under BroadcastDropOldest
+type broadcastMessage struct {
+	key     string
+	payload models.WSMessage
+}
+
+// BroadcastStats is reported on /health under "broadcast"
+type BroadcastStats struct {
+	Policy     string `json:"policy"`
+	BufferSize int    `json:"buffer_size"`
+	Backlog    int    `json:"backlog"`
+	Queued     int64  `json:"queued_total"`
+	// Drops per policy: drop-oldest evicts a pending message, drop-newest
+	// rejects the incoming one
+	DroppedOldest int64 `json:"dropped_oldest"`
+	DroppedNewest int64 `json:"dropped_newest"`
+	// Pending readings replaced by a newer one of the same device
+	Coalesced       int64 `json:"coalesced"`
+	FlushIntervalMs int64 `json:"flush_interval_ms"`
+}
+
+// RealtimeBatch is the legacy (WS_LEGACY_FORMAT) frame of a "reading_batch":
+// the readings of several devices flushed together
+type RealtimeBatch struct {
+	Type string                `json:"type"` // "realtime_batch"
+	Data []models.RealtimeData `json:"data"`
+}
+
+func NewWebSocketHandler(db database.Store, logger *slog.Logger) *WebSocketHandler {
 	handler := &WebSocketHandler{
-		db:         db,
-		clients:    make(map[*websocket.Conn]bool),
-		broadcast:  make(chan interface{}, 100),
-		register:   make(chan *websocket.Conn),
-		unregister: make(chan *websocket.Conn),
+		db:          db,
+		logger:      logger.With("component", "websocket"),
+		events:      NewEventFanout(defaultReplaySize),
+		historySize: defaultHistorySize,
+		clients:     make(map[*websocket.Conn]bool),
+		register:    make(chan *websocket.Conn),
+		unregister:  make(chan unregisterRequest),
+		bufferSize:  defaultBroadcastBuffer,
+		policy:      BroadcastDropOldest,
+		notify:      make(chan struct{}, 1),
+
+		flushInterval:   defaultFlushInterval,
+		flushTicker:     time.NewTicker(defaultFlushInterval),
+		pendingRealtime: make(map[string]models.RealtimeData),
 	}
 
 	// Start hub untuk manage connections dan broadcasting
 	go handler.runHub()
 
+	// Hub membaca fan-out lewat goroutine sendiri; enqueue tidak pernah lama
+	// memblok, jadi event hampir tidak pernah di-drop di sini
+	events, _ := handler.events.Subscribe(1024, false)
+	go handler.consumeEvents(events)
+
 	return handler
 }
 
+// unregisterRequest removes a client; the hub closes done once it will not
+// touch conn again, since gofiber reuses the Conn after the handler returns
+type unregisterRequest struct {
+	conn *websocket.Conn
+	done chan struct{}
+}
+
 // runHub manages WebSocket connections dan broadcasting
 func (h *WebSocketHandler) runHub() {
 	ticker := time.NewTicker(30 * time.Second)
@@ -44,34 +154,21 @@ func (h *WebSocketHandler) runHub() {
 		case conn := <-h.register:
 			h.clientsMutex.Lock()
 			h.clients[conn] = true
-			h.clientsMutex.Unlock()
 			log.Printf("🔌 Client registered. Total clients: %d", len(h.clients))
-
-		case conn := <-h.unregister:
-			h.clientsMutex.Lock()
-			if _, ok := h.clients[conn]; ok {
-				delete(h.clients, conn)
-				conn.Close()
-			}
 			h.clientsMutex.Unlock()
-			log.Printf("🔌 Client unregistered. Total clients: %d", len(h.clients))
 
-		case message := <-h.broadcast:
-			h.clientsMutex.RLock()
-			clientCount := len(h.clients)
-			for conn := range h.clients {
-				err := conn.WriteJSON(message)
-				if err != nil {
-					log.Printf("❌ Error sending to client: %v", err)
-					go func(c *websocket.Conn) {
-						h.unregister <- c
-					}(conn)
-				}
+		case req := <-h.unregister:
+			h.drop(req.conn)
+			close(req.done)
+
+		case <-h.notify:
+			for _, message := range h.takeQueue() {
+				h.writeAll(message.payload)
 			}
-			h.clientsMutex.RUnlock()
 
-			if clientCount > 0 {
-				log.Printf("✅ Broadcasted to %d client(s)", clientCount)
+		case <-h.flushTicker.C:
+			if frame, ok := h.takeRealtime(); ok {
+				h.writeAll(frame)
 			}
 
 		case <-ticker.C:
@@ -87,40 +184,324 @@ func (h *WebSocketHandler) runHub() {
 	}
 }
 
-// BroadcastRealtimeData broadcasts data dari MQTT ke semua clients
-func (h *WebSocketHandler) BroadcastRealtimeData(data models.RealtimeData) {
+// writeAll sends one frame to every client; only the hub calls it
+func (h *WebSocketHandler) writeAll(message models.WSMessage) {
+	frame := h.frame(message)
+
 	h.clientsMutex.RLock()
 	clientCount := len(h.clients)
+	var failed []*websocket.Conn
+	for conn := range h.clients {
+		err := conn.WriteJSON(frame)
+		if err != nil {
+			log.Printf("❌ Error sending to client: %v", err)
+			failed = append(failed, conn)
+		}
+	}
 	h.clientsMutex.RUnlock()
 
-	if clientCount == 0 {
-		log.Printf("⚠️ No WebSocket clients connected, skipping broadcast")
-		return
+	// Koneksi masih milik HandleConnection (unregister-nya menunggu hub),
+	// jadi aman ditutup di sini; ReadMessage-nya lalu gagal
+	for _, conn := range failed {
+		h.drop(conn)
 	}
 
-	select {
-	case h.broadcast <- data:
-		log.Printf("📤 Broadcasting realtime data: %s to %d client(s)", data.DeviceID, clientCount)
+	if clientCount > 0 {
+		h.logger.Debug("broadcast sent", "type", message.Type, "clients", clientCount)
+	}
+}
+
+// drop removes and closes a registered client; only the hub calls it
+func (h *WebSocketHandler) drop(conn *websocket.Conn) {
+	h.clientsMutex.Lock()
+	defer h.clientsMutex.Unlock()
+	if _, ok := h.clients[conn]; ok {
+		delete(h.clients, conn)
+		conn.Close()
+		log.Printf("🔌 Client unregistered. Total clients: %d", len(h.clients))
+	}
+}
+
+// SetFlushInterval sets how often buffered realtime readings are sent; only
+// the latest reading per device since the last flush goes out. 0 sends every
+// reading as soon as it arrives. Alerts and other events are never buffered.
+func (h *WebSocketHandler) SetFlushInterval(d time.Duration) {
+	h.queueMutex.Lock()
+	defer h.queueMutex.Unlock()
+
+	if d <= 0 {
+		h.flushTicker.Stop()
+		d = 0
+	} else {
+		h.flushTicker.Reset(d)
+	}
+	h.flushInterval = d
+}
+
+// takeRealtime empties the realtime buffer into one frame: "reading" for a
+// single device, "reading_batch" for several; false when empty
+func (h *WebSocketHandler) takeRealtime() (models.WSMessage, bool) {
+	h.queueMutex.Lock()
+	defer h.queueMutex.Unlock()
+
+	switch len(h.pendingRealtime) {
+	case 0:
+		return models.WSMessage{}, false
+	case 1:
+		for deviceID, data := range h.pendingRealtime {
+			delete(h.pendingRealtime, deviceID)
+			return models.NewReadingMessage(data), true
+		}
+	}
+
+	batch := make([]models.RealtimeData, 0, len(h.pendingRealtime))
+	for _, data := range h.pendingRealtime {
+		batch = append(batch, data)
+	}
+	slices.SortFunc(batch, func(a, b models.RealtimeData) int { return cmp.Compare(a.DeviceID, b.DeviceID) })
+	clear(h.pendingRealtime)
+	return models.NewReadingBatchMessage(batch), true
+}
+
+// SetLegacyFormat writes the bare objects sent before the models.WSMessage
+// envelope (WS_LEGACY_FORMAT), for clients not updated yet. Set before
+// serving.
+func (h *WebSocketHandler) SetLegacyFormat(legacy bool) {
+	h.legacyFormat = legacy
+}
+
+// frame is what gets written for message
+func (h *WebSocketHandler) frame(message models.WSMessage) interface{} {
+	if !h.legacyFormat {
+		return message
+	}
+	return legacyFrame(message)
+}
+
+// legacyFrame turns an envelope back into the pre-envelope frame
+func legacyFrame(message models.WSMessage) interface{} {
+	switch data := message.Data.(type) {
+	case []models.RealtimeData:
+		return RealtimeBatch{Type: "realtime_batch", Data: data}
+	case models.WSHistory:
+		frame := fiber.Map{"type": "history", "device_id": data.DeviceID, "data": data.Readings}
+		if data.Start != 0 {
+			frame["start"], frame["end"] = data.Start, data.End
+		}
+		return frame
+	case models.WSWelcome:
+		return fiber.Map{"type": "connected", "message": data.Message, "server": data.Server, "time": data.Time}
+	case models.WSError:
+		return fiber.Map{"type": "error", "action": data.Action, "message": data.Message}
 	default:
-		log.Printf("⚠️ Broadcast channel full, dropping message")
+		// RealtimeData, AlertData dan event lain dikirim apa adanya
+		return message.Data
 	}
 }
 
-// BroadcastAlert broadcasts alert ke semua clients
-func (h *WebSocketHandler) BroadcastAlert(alert models.AlertData) {
-	h.clientsMutex.RLock()
-	clientCount := len(h.clients)
-	h.clientsMutex.RUnlock()
+// bufferRealtime keeps data as the latest reading of its device until the
+// next flush; false when flushing is off and data has to be queued
+func (h *WebSocketHandler) bufferRealtime(data models.RealtimeData) bool {
+	h.queueMutex.Lock()
+	defer h.queueMutex.Unlock()
 
-	if clientCount == 0 {
-		return
+	if h.flushInterval <= 0 {
+		return false
+	}
+	h.broadcastsTotal++
+	if _, ok := h.pendingRealtime[data.DeviceID]; ok {
+		h.coalesced++
 	}
+	h.pendingRealtime[data.DeviceID] = data
+	return true
+}
+
+// SetHistorySize sets how many recent readings a new client receives
+// (0 = none, capped at maxHistorySize)
+func (h *WebSocketHandler) SetHistorySize(n int) {
+	if n < 0 {
+		n = 0
+	}
+	if n > maxHistorySize {
+		n = maxHistorySize
+	}
+	h.historySize = n
+}
+
+// SetBroadcastBuffer sets how many broadcasts may wait for the hub and what
+// happens when that many are pending (BroadcastDropOldest or
+// BroadcastDropNewest; anything else keeps the current policy)
+func (h *WebSocketHandler) SetBroadcastBuffer(size int, policy string) {
+	h.queueMutex.Lock()
+	defer h.queueMutex.Unlock()
+
+	if size > 0 {
+		h.bufferSize = size
+	}
+	if policy == BroadcastDropOldest || policy == BroadcastDropNewest {
+		h.policy = policy
+	}
+}
+
+// enqueue adds a broadcast for the hub; false when it was dropped
+func (h *WebSocketHandler) enqueue(key string, payload models.WSMessage) bool {
+	h.queueMutex.Lock()
+	accepted := h.enqueueLocked(broadcastMessage{key: key, payload: payload})
+	h.queueMutex.Unlock()
 
 	select {
-	case h.broadcast <- alert:
-		log.Printf("⚠️ Broadcasting alert: %s - %s to %d client(s)", alert.AlertType, alert.Message, clientCount)
+	case h.notify <- struct{}{}:
 	default:
-		log.Printf("⚠️ Broadcast channel full, dropping alert")
+		// Hub sudah dibangunkan dan akan mengambil seluruh antrean
+	}
+	return accepted
+}
+
+func (h *WebSocketHandler) enqueueLocked(message broadcastMessage) bool {
+	h.broadcastsTotal++
+
+	if h.policy == BroadcastDropNewest {
+		if len(h.queue) >= h.bufferSize {
+			h.droppedNewest++
+			return false
+		}
+		h.queue = append(h.queue, message)
+		return true
+	}
+
+	// drop-oldest: reading yang masih antre diganti yang terbaru
+	if message.key != "" {
+		for i := range h.queue {
+			if h.queue[i].key == message.key {
+				h.queue[i].payload = message.payload
+				h.coalesced++
+				return true
+			}
+		}
+	}
+	if len(h.queue) >= h.bufferSize {
+		drop := len(h.queue) - h.bufferSize + 1
+		h.queue = slices.Delete(h.queue, 0, drop)
+		h.droppedOldest += int64(drop)
+		h.logger.Debug("broadcast buffer full, dropped oldest", "dropped", drop, "buffer_size", h.bufferSize)
+	}
+	h.queue = append(h.queue, message)
+	return true
+}
+
+// takeQueue empties the queue for the hub
+func (h *WebSocketHandler) takeQueue() []broadcastMessage {
+	h.queueMutex.Lock()
+	defer h.queueMutex.Unlock()
+
+	queue := h.queue
+	h.queue = nil
+	return queue
+}
+
+// Events returns the fan-out the Broadcast* methods publish to
+func (h *WebSocketHandler) Events() *EventFanout {
+	return h.events
+}
+
+// The Broadcast* methods are kept for callers holding the handler; they
+// publish to Events like the fan-out's own methods.
+
+// BroadcastRealtimeData broadcasts data dari MQTT ke semua clients
+func (h *WebSocketHandler) BroadcastRealtimeData(data models.RealtimeData) {
+	h.events.BroadcastRealtimeData(data)
+}
+
+// BroadcastAlert broadcasts alert ke semua clients
+func (h *WebSocketHandler) BroadcastAlert(alert models.AlertData) {
+	h.events.BroadcastAlert(alert)
+}
+
+// BroadcastForecast broadcasts a recomputed consumption forecast
+func (h *WebSocketHandler) BroadcastForecast(summary models.ForecastSummary) {
+	h.events.BroadcastForecast(summary)
+}
+
+// BroadcastDeviceStatus broadcasts an online/offline transition
+func (h *WebSocketHandler) BroadcastDeviceStatus(event models.DeviceStatusEvent) {
+	h.events.BroadcastDeviceStatus(event)
+}
+
+// BroadcastSettingsChanged announces runtime settings changed by an admin or
+// a reload
+func (h *WebSocketHandler) BroadcastSettingsChanged(event models.SettingsChangedEvent) {
+	h.events.BroadcastSettingsChanged(event)
+}
+
+// BroadcastSystemNotice announces server state changes such as IoTDB going
+// down (dummy data) or coming back
+func (h *WebSocketHandler) BroadcastSystemNotice(notice models.SystemNotice) {
+	h.events.BroadcastSystemNotice(notice)
+}
+
+// consumeEvents moves fan-out events into the WebSocket broadcast queue
+// (realtime readings into the flush buffer) while clients are connected.
+// Per-event logs are debug: they fire for every reading.
+func (h *WebSocketHandler) consumeEvents(events <-chan Event) {
+	for event := range events {
+		h.clientsMutex.RLock()
+		clientCount := len(h.clients)
+		h.clientsMutex.RUnlock()
+
+		if clientCount == 0 {
+			if event.Type == EventReading {
+				h.logger.Debug("no websocket clients, skipping broadcast", "event", event.Type)
+			}
+			continue
+		}
+
+		switch payload := event.Payload.(type) {
+		case models.RealtimeData:
+			if h.bufferRealtime(payload) {
+				h.logger.Debug("buffering realtime data", "device_id", payload.DeviceID, "clients", clientCount)
+			} else if h.enqueue("realtime:"+payload.DeviceID, models.NewReadingMessage(payload)) {
+				h.logger.Debug("broadcasting realtime data", "device_id", payload.DeviceID, "clients", clientCount)
+			} else {
+				h.logger.Debug("broadcast buffer full, dropping reading", "device_id", payload.DeviceID)
+			}
+
+		case models.AlertData:
+			if h.enqueue("", models.NewAlertMessage(payload)) {
+				h.logger.Debug("broadcasting alert", "device_id", payload.DeviceID, "alert_type", payload.AlertType,
+					"severity", payload.Severity, "message", payload.Message, "clients", clientCount)
+			} else {
+				h.logger.Debug("broadcast buffer full, dropping alert", "device_id", payload.DeviceID, "alert_type", payload.AlertType)
+			}
+
+		case models.ForecastSummary:
+			if h.enqueue("forecast:"+payload.DeviceID, models.NewWSMessage(models.WSTypeForecast, payload)) {
+				h.logger.Debug("broadcasting forecast", "device_id", payload.DeviceID, "total_kwh", payload.TotalKWh, "clients", clientCount)
+			} else {
+				h.logger.Debug("broadcast buffer full, dropping forecast", "device_id", payload.DeviceID)
+			}
+
+		case models.DeviceStatusEvent:
+			if h.enqueue("", models.NewWSMessage(models.WSTypeDeviceStatus, payload)) {
+				h.logger.Debug("broadcasting device status", "device_id", payload.DeviceID, "status", payload.Status,
+					"source", payload.Source, "clients", clientCount)
+			} else {
+				h.logger.Debug("broadcast buffer full, dropping device status", "device_id", payload.DeviceID)
+			}
+
+		case models.SettingsChangedEvent:
+			if h.enqueue("", models.NewWSMessage(models.WSTypeSettingsChanged, payload)) {
+				h.logger.Debug("broadcasting settings change", "settings", len(payload.Changes), "clients", clientCount)
+			} else {
+				h.logger.Debug("broadcast buffer full, dropping settings change")
+			}
+
+		case models.SystemNotice:
+			if h.enqueue("", models.NewWSMessage(models.WSTypeSystem, payload)) {
+				h.logger.Debug("broadcasting system notice", "event", payload.Event, "mode", payload.Mode, "clients", clientCount)
+			} else {
+				h.logger.Debug("broadcast buffer full, dropping system notice", "event", payload.Event)
+			}
+		}
 	}
 }
 
@@ -129,23 +510,14 @@ func (h *WebSocketHandler) HandleConnection(c *websocket.Conn) {
 	clientID := c.RemoteAddr().String()
 	log.Printf("📡 WebSocket client connected: %s", clientID)
 
-	// Register client
-	h.register <- c
-
-	defer func() {
-		h.unregister <- c
-		log.Printf("📡 WebSocket client disconnected: %s", clientID)
-	}()
-
 	// Send welcome message (bukan dummy data)
-	welcomeMsg := map[string]interface{}{
-		"type":    "connected",
-		"message": "WebSocket connected successfully",
-		"server":  "Wattwise Energy Monitor",
-		"time":    time.Now().Format(time.RFC3339),
-	}
+	welcomeMsg := models.NewWSMessage(models.WSTypeConnected, models.WSWelcome{
+		Message: "WebSocket connected successfully",
+		Server:  "Wattwise Energy Monitor",
+		Time:    time.Now().Format(time.RFC3339),
+	})
 
-	err := c.WriteJSON(welcomeMsg)
+	err := c.WriteJSON(h.frame(welcomeMsg))
 	if err != nil {
 		log.Printf("❌ Failed to send welcome message: %v", err)
 		return
@@ -153,6 +525,24 @@ func (h *WebSocketHandler) HandleConnection(c *websocket.Conn) {
 
 	log.Printf("✅ Welcome message sent to %s", clientID)
 
+	// History dikirim dari goroutine koneksi ini, bukan dari hub
+	if err := h.sendHistory(c, c.Query("device_id", models.DefaultDeviceID)); err != nil {
+		log.Printf("❌ Failed to send history to %s: %v", clientID, err)
+		return
+	}
+
+	// Register setelah frame awal terkirim, supaya hub tidak menulis ke
+	// koneksi yang sama secara bersamaan
+	h.register <- c
+
+	defer func() {
+		// Tunggu hub selesai dengan c sebelum gofiber memakainya ulang
+		done := make(chan struct{})
+		h.unregister <- unregisterRequest{conn: c, done: done}
+		<-done
+		log.Printf("📡 WebSocket client disconnected: %s", clientID)
+	}()
+
 	// Listen for messages from client (optional - untuk control)
 	for {
 		messageType, message, err := c.ReadMessage()
@@ -165,15 +555,131 @@ func (h *WebSocketHandler) HandleConnection(c *websocket.Conn) {
 
 		if messageType == websocket.TextMessage {
 			log.Printf("📨 Received from %s: %s", clientID, string(message))
-			// Handle client commands here if needed
-			// h.handleClientCommand(c, message)
+			if err := h.handleClientCommand(c, message); err != nil {
+				log.Printf("❌ Failed to reply to %s: %v", clientID, err)
+				break
+			}
 		}
 	}
 }
 
+// handleClientCommand answers a command frame; unknown or invalid commands
+// get an "error" frame. The error is from writing the reply.
+func (h *WebSocketHandler) handleClientCommand(c *websocket.Conn, message []byte) error {
+	var cmd clientCommand
+	if err := json.Unmarshal(message, &cmd); err != nil {
+		return h.writeClient(c, models.NewErrorMessage("", "Invalid command, expected JSON"))
+	}
+
+	switch cmd.Action {
+	case "history":
+		if !wsViewer(c) {
+			return h.writeClient(c, models.NewErrorMessage(cmd.Action, "Authentication required"))
+		}
+		return h.sendHistoryRange(c, cmd)
+	default:
+		return h.writeClient(c, models.NewErrorMessage(cmd.Action, "Unknown action"))
+	}
+}
+
+// sendHistoryRange replies to {"action":"history"} with the readings of
+// [start, end], oldest first, in the same frame as the connect history
+func (h *WebSocketHandler) sendHistoryRange(c *websocket.Conn, cmd clientCommand) error {
+	if cmd.DeviceID == "" {
+		cmd.DeviceID = models.DefaultDeviceID
+	}
+	if cmd.End == 0 {
+		cmd.End = time.Now().UnixMilli()
+	}
+	switch {
+	case cmd.Start <= 0:
+		return h.writeClient(c, models.NewErrorMessage(cmd.Action, "start is required (unix ms)"))
+	case cmd.Start >= cmd.End:
+		return h.writeClient(c, models.NewErrorMessage(cmd.Action, "start must be before end"))
+	case time.Duration(cmd.End-cmd.Start)*time.Millisecond > maxHistoryRange:
+		return h.writeClient(c, models.NewErrorMessage(cmd.Action, "range too large, max "+maxHistoryRange.String()))
+	}
+
+	readings, err := h.db.GetDataByTimeRange(context.Background(), cmd.DeviceID, cmd.Start, cmd.End)
+	if err != nil {
+		log.Printf("⚠️ Failed to fetch history for %s: %v", cmd.DeviceID, err)
+		return h.writeClient(c, models.NewErrorMessage(cmd.Action, "Failed to fetch history"))
+	}
+	slices.SortFunc(readings, func(a, b models.EnergyData) int { return cmp.Compare(a.Timestamp, b.Timestamp) })
+
+	return h.writeClient(c, models.NewHistoryMessage(models.WSHistory{
+		DeviceID: cmd.DeviceID,
+		Start:    cmd.Start,
+		End:      cmd.End,
+		Readings: readings,
+	}))
+}
+
+// wsViewer reports whether the upgrade was authenticated with at least the
+// viewer role (middleware.WebSocketAuth and RequireViewer on /ws)
+func wsViewer(c *websocket.Conn) bool {
+	role, _ := c.Locals("role").(string)
+	return models.ValidRole(role)
+}
+
+// writeClient writes a reply to one registered client; the exclusive lock
+// keeps the hub (writeAll) from writing to it at the same time
+func (h *WebSocketHandler) writeClient(c *websocket.Conn, message models.WSMessage) error {
+	h.clientsMutex.Lock()
+	defer h.clientsMutex.Unlock()
+	return c.WriteJSON(h.frame(message))
+}
+
+// sendHistory sends the last historySize readings of deviceID, oldest first,
+// as a "history" frame. Dummy mode and unauthenticated connections get
+// nothing.
+func (h *WebSocketHandler) sendHistory(c *websocket.Conn, deviceID string) error {
+	if h.historySize == 0 || !h.db.IsEnabled() || !wsViewer(c) {
+		return nil
+	}
+
+	readings, err := h.db.GetLatestData(context.Background(), deviceID, h.historySize)
+	if err != nil {
+		// Chart tetap bisa jalan dari data realtime
+		log.Printf("⚠️ Failed to fetch history for %s: %v", deviceID, err)
+		return nil
+	}
+	slices.SortFunc(readings, func(a, b models.EnergyData) int { return cmp.Compare(a.Timestamp, b.Timestamp) })
+
+	return c.WriteJSON(h.frame(models.NewHistoryMessage(models.WSHistory{
+		DeviceID: deviceID,
+		Readings: readings,
+	})))
+}
+
 // GetConnectedClients returns jumlah clients yang terkoneksi
 func (h *WebSocketHandler) GetConnectedClients() int {
 	h.clientsMutex.RLock()
 	defer h.clientsMutex.RUnlock()
 	return len(h.clients)
 }
+
+// BroadcastBacklog returns how many messages wait for the hub and the buffer
+// size; what a full buffer drops depends on the policy
+func (h *WebSocketHandler) BroadcastBacklog() (int, int) {
+	h.queueMutex.Lock()
+	defer h.queueMutex.Unlock()
+	return len(h.queue), h.bufferSize
+}
+
+// BroadcastStats returns the buffer state and drop counters
+func (h *WebSocketHandler) BroadcastStats() BroadcastStats {
+	h.queueMutex.Lock()
+	defer h.queueMutex.Unlock()
+	return BroadcastStats{
+		Policy:        h.policy,
+		BufferSize:    h.bufferSize,
+		Backlog:       len(h.queue),
+		Queued:        h.broadcastsTotal,
+		DroppedOldest: h.droppedOldest,
+		DroppedNewest: h.droppedNewest,
+		Coalesced:     h.coalesced,
+
+		FlushIntervalMs: h.flushInterval.Milliseconds(),
+	}
+}
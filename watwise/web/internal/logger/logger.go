@@ -0,0 +1,47 @@
+package logger
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+	"wattwise/internal/config"
+)
+
+// level is shared by every logger from New so SetLevel applies at runtime
+var level = new(slog.LevelVar)
+
+// New builds the application logger from LOG_LEVEL / LOG_FORMAT.
+// Level defaults to info so production stays quiet; per-message MQTT and
+// query logs are emitted at debug.
+func New(cfg config.LogConfig) *slog.Logger {
+	level.Set(ParseLevel(cfg.Level))
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if strings.EqualFold(cfg.Format, "json") {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	}
+
+	return slog.New(handler)
+}
+
+// SetLevel changes the level of the loggers from New (settings hot reload)
+func SetLevel(name string) {
+	level.Set(ParseLevel(name))
+}
+
+// ParseLevel converts a LOG_LEVEL value to a slog.Level, falling back to info
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"slices"
+	"wattwise/internal/models"
+	"wattwise/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireRole allows only users whose token role is one of roles. Must run
+// after AuthMiddleware.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		if !slices.Contains(roles, role) {
+			message := "Insufficient role"
+			if len(roles) == 1 && roles[0] == models.RoleAdmin {
+				message = "Admin access required"
+			}
+			return utils.ErrorResponse(c, fiber.StatusForbidden, message)
+		}
+		return c.Next()
+	}
+}
+
+// RequireAdmin is RequireRole(models.RoleAdmin): writes, device control and
+// /api/admin
+func RequireAdmin() fiber.Handler {
+	return RequireRole(models.RoleAdmin)
+}
+
+// RequireViewer allows every known role; read-only routes use it
+func RequireViewer() fiber.Handler {
+	return RequireRole(models.RoleViewer, models.RoleAdmin)
+}
+
+// RequireWrite allows admins and API keys with scope read-write; used for
+// the energy insert/import routes
+func RequireWrite() fiber.Handler {
+	admin := RequireAdmin()
+	return func(c *fiber.Ctx) error {
+		if scope, _ := c.Locals("scope").(string); scope == models.ScopeReadWrite {
+			return c.Next()
+		}
+		return admin(c)
+	}
+}
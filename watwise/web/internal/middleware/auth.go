@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"strings"
+	"wattwise/internal/models"
 	"wattwise/internal/utils"
 
 	"github.com/gofiber/fiber/v2"
@@ -12,33 +13,76 @@ func AuthMiddleware() fiber.Handler {
 		// Get token from Authorization header
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"success": false,
-				"message": "Missing authorization header",
-			})
+			return utils.ErrorResponse(c, fiber.StatusUnauthorized, "Missing authorization header")
 		}
 
 		// Extract token (format: "Bearer <token>")
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		if tokenString == authHeader {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"success": false,
-				"message": "Invalid authorization format",
-			})
+			return utils.ErrorResponse(c, fiber.StatusUnauthorized, "Invalid authorization format")
 		}
 
 		// Validate token
-		username, err := utils.ValidateToken(tokenString)
+		username, role, err := utils.ValidateToken(tokenString)
 		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"success": false,
-				"message": "Invalid or expired token",
-			})
+			return utils.ErrorResponse(c, fiber.StatusUnauthorized, "Invalid or expired token")
 		}
 
-		// Store username in context
+		// Store username and role in context
 		c.Locals("username", username)
+		c.Locals("role", role)
 
 		return c.Next()
 	}
 }
+
+// WebSocketAuth is AuthMiddleware for /ws. Browsers cannot set headers on
+// new WebSocket(), so the token may also come as ?token=<jwt>; it is checked
+// before the upgrade, an unauthenticated client gets 401 instead of a socket.
+func WebSocketAuth() fiber.Handler {
+	bearer := AuthMiddleware()
+	return func(c *fiber.Ctx) error {
+		tokenString := c.Query("token")
+		if tokenString == "" {
+			return bearer(c)
+		}
+
+		username, role, err := utils.ValidateToken(tokenString)
+		if err != nil {
+			return utils.ErrorResponse(c, fiber.StatusUnauthorized, "Invalid or expired token")
+		}
+
+		c.Locals("username", username)
+		c.Locals("role", role)
+		return c.Next()
+	}
+}
+
+// APIKeyAuthenticator resolves an X-API-Key header (*services.APIKeyService)
+type APIKeyAuthenticator interface {
+	Authenticate(key string) (models.APIKey, error)
+}
+
+// AuthOrAPIKey is AuthMiddleware that also accepts an X-API-Key header. A
+// key authenticates as role viewer with its scope in Locals("scope"), so it
+// passes RequireViewer and, with scope read-write, RequireWrite but never
+// RequireAdmin.
+func AuthOrAPIKey(keys APIKeyAuthenticator) fiber.Handler {
+	bearer := AuthMiddleware()
+	return func(c *fiber.Ctx) error {
+		key := c.Get("X-API-Key")
+		if key == "" {
+			return bearer(c)
+		}
+
+		apiKey, err := keys.Authenticate(key)
+		if err != nil {
+			return utils.ErrorResponse(c, fiber.StatusUnauthorized, "Invalid or revoked API key")
+		}
+
+		c.Locals("username", "apikey:"+apiKey.Name)
+		c.Locals("role", models.RoleViewer)
+		c.Locals("scope", apiKey.Scope)
+		return c.Next()
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+	"wattwise/internal/models"
+	"wattwise/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRoleChecks(t *testing.T) {
+	utils.SetJWTSecret([]byte("test-secret"))
+	t.Cleanup(func() { utils.SetJWTSecret(nil) })
+
+	app := fiber.New()
+	app.Get("/admin", AuthMiddleware(), RequireAdmin(), func(c *fiber.Ctx) error { return c.SendString("ok") })
+	app.Get("/viewer", AuthMiddleware(), RequireViewer(), func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	admin, _ := utils.GenerateToken("alice", models.RoleAdmin)
+	viewer, _ := utils.GenerateToken("bob", models.RoleViewer)
+	now := time.Now()
+	noRole, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, utils.Claims{
+		Username:         "carol",
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute))},
+	}).SignedString([]byte("test-secret"))
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, utils.Claims{
+		Username:         "mallory",
+		Role:             models.RoleAdmin,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute))},
+	}).SignedString([]byte("wattwise-secret-key-change-in-production"))
+
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		want  int
+	}{
+		{"admin on admin route", "/admin", admin, 200},
+		{"viewer on admin route", "/admin", viewer, 403},
+		{"missing role on admin route", "/admin", noRole, 403},
+		{"missing role on viewer route", "/viewer", noRole, 200},
+		{"forged admin claim", "/admin", forged, 401},
+		{"no token", "/viewer", "", 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
+)
+
+// Compress gzip/brotli-compresses responses per Accept-Encoding at level
+// (COMPRESS_LEVEL, -1..2). Body < 200 byte tidak dikompres dan response yang
+// sudah punya Content-Encoding (mis. export CSV .gz) tidak dikompres dua kali
+// - keduanya sudah ditangani fasthttp.
+func Compress(level int) fiber.Handler {
+	return compress.New(compress.Config{
+		Level: compress.Level(level),
+		Next:  skipCompression,
+	})
+}
+
+// skipCompression: WebSocket upgrade (compression-nya per frame, bukan HTTP),
+// SSE (kompresi menahan event sampai buffer penuh) dan health check yang
+// sering dipanggil load balancer. Report PDF/XLSX sudah terkompresi.
+func skipCompression(c *fiber.Ctx) bool {
+	path := c.Path()
+	return strings.HasPrefix(path, "/ws") ||
+		path == "/api/energy/stream" ||
+		path == "/api/energy/events" ||
+		strings.HasPrefix(path, "/api/reports") ||
+		strings.HasPrefix(path, "/health") ||
+		path == "/api/health"
+}
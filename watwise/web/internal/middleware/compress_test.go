@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCompress(t *testing.T) {
+	large := `{"data":[` + strings.Repeat(`{"voltage":220.5,"current":2.1,"power":463},`, 100) + `{}]}`
+	gzipped := func() []byte {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write([]byte(large))
+		w.Close()
+		return buf.Bytes()
+	}()
+
+	app := fiber.New()
+	app.Use(Compress(1))
+	send := func(body string) fiber.Handler {
+		return func(c *fiber.Ctx) error {
+			c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			return c.SendString(body)
+		}
+	}
+	app.Get("/api/energy/history", send(large))
+	app.Get("/api/energy/latest", send(`{"power":1}`))
+	app.Get("/health", send(large))
+	app.Get("/api/energy/export", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentEncoding, "gzip")
+		return c.Send(gzipped)
+	})
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		encoding       string // Content-Encoding of the response
+	}{
+		{"gzip", "/api/energy/history", "gzip", "gzip"},
+		{"gzip among others", "/api/energy/history", "deflate, gzip", "gzip"},
+		{"not accepted", "/api/energy/history", "", ""},
+		{"small body", "/api/energy/latest", "gzip", ""},
+		{"health check skipped", "/health", "gzip", ""},
+		{"already compressed", "/api/energy/export", "gzip", "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set(fiber.HeaderAcceptEncoding, tt.acceptEncoding)
+			}
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if got := resp.Header.Get(fiber.HeaderContentEncoding); got != tt.encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.encoding)
+			}
+			var body io.Reader = resp.Body
+			if tt.encoding == "gzip" {
+				gz, err := gzip.NewReader(resp.Body)
+				if err != nil {
+					t.Fatalf("body is not gzip: %v", err)
+				}
+				body = gz
+			}
+			decoded, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			// Sekali decode sudah JSON aslinya, tidak dikompres dua kali
+			if want := map[string]string{"/api/energy/latest": `{"power":1}`}[tt.path]; want != "" {
+				if string(decoded) != want {
+					t.Errorf("body = %q, want %q", decoded, want)
+				}
+			} else if string(decoded) != large {
+				t.Errorf("decoded body differs from the response (%d bytes, want %d)", len(decoded), len(large))
+			}
+			if tt.encoding == "gzip" && tt.path == "/api/energy/history" && resp.ContentLength >= int64(len(large)) {
+				t.Errorf("compressed body is %d bytes, original %d", resp.ContentLength, len(large))
+			}
+		})
+	}
+}
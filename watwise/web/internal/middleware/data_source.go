@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DataSourceLocal is the c.Locals key set to "dummy" while the request is
+// answered from generated readings
+const DataSourceLocal = "data_source"
+
+// DummySource reports whether queries currently answer with generated
+// readings (database.Store)
+type DummySource interface {
+	ServesDummyData() bool
+}
+
+// DataSource makes dummy data visible: while IoTDB is not connected and
+// DUMMY_MODE is on, responses get the header X-Data-Source: dummy and JSON
+// object bodies a top level "data_source": "dummy" (unless the handler set
+// one). Streamed bodies only get the header.
+func DataSource(db DummySource) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !db.ServesDummyData() {
+			return c.Next()
+		}
+		c.Locals(DataSourceLocal, "dummy")
+		c.Set("X-Data-Source", "dummy")
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+		markDummyBody(c.Response())
+		return nil
+	}
+}
+
+func markDummyBody(resp *fiber.Response) {
+	if resp.IsBodyStream() || resp.StatusCode() >= fiber.StatusBadRequest ||
+		!strings.HasPrefix(string(resp.Header.ContentType()), fiber.MIMEApplicationJSON) {
+		return
+	}
+	body := bytes.TrimSpace(resp.Body())
+	var fields map[string]json.RawMessage
+	if len(body) == 0 || body[0] != '{' || json.Unmarshal(body, &fields) != nil {
+		return
+	}
+	if _, ok := fields["data_source"]; ok {
+		return
+	}
+
+	marked := []byte(`{"data_source":"dummy"`)
+	if len(fields) > 0 {
+		marked = append(marked, ',')
+	}
+	resp.SetBodyRaw(append(marked, body[1:]...))
+}
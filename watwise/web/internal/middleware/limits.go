@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	"wattwise/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TimeoutLocal is the c.Locals key holding the request's time budget, for
+// handlers that keep working after they return (streamed responses)
+const TimeoutLocal = "timeout"
+
+// BodyLimit rejects request bodies over limit bytes with 413. exemptPaths
+// (e.g. the file import) are only bound by the app-wide fiber BodyLimit.
+func BodyLimit(limit int, exemptPaths ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if limit <= 0 || slices.Contains(exemptPaths, routePath(c)) {
+			return c.Next()
+		}
+		if size := len(c.Request().Body()); size > limit {
+			return utils.ErrorResponse(c, fiber.StatusRequestEntityTooLarge, fmt.Sprintf("request body too large: %d bytes (max %d)", size, limit))
+		}
+		return c.Next()
+	}
+}
+
+// Timeout cancels the handler's UserContext after timeout (long for
+// longPaths) and answers 503 REQUEST_TIMEOUT when the deadline passed.
+// Handlers must pass c.UserContext() to the database for the query to stop;
+// streamed bodies run after the handler returns and take their budget from
+// c.Locals(TimeoutLocal) instead. 0 = no limit.
+func Timeout(timeout, long time.Duration, longPaths ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		budget := timeout
+		if slices.Contains(longPaths, routePath(c)) {
+			budget = long
+		}
+		c.Locals(TimeoutLocal, budget)
+		if budget <= 0 {
+			return c.Next()
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), budget)
+		defer cancel()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.Printf("⏱️  %s %s timed out after %s", c.Method(), c.Path(), budget)
+			return utils.CodedErrorResponse(c, fiber.StatusServiceUnavailable, utils.CodeRequestTimeout,
+				fmt.Sprintf("request timed out after %s", budget), nil)
+		}
+		return err
+	}
+}
+
+// routePath is the request path as routes match it: case-insensitive,
+// trailing slash ignored
+func routePath(c *fiber.Ctx) string {
+	path := strings.ToLower(c.Path())
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path
+}
@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"wattwise/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errorCode is the status and ErrorBody code of resp ("" for a non-error body)
+func errorCode(t *testing.T, resp *http.Response) (int, string) {
+	t.Helper()
+	defer resp.Body.Close()
+	var body utils.ErrorBody
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body.Code
+}
+
+func TestBodyLimit(t *testing.T) {
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusCreated) }
+
+	tests := []struct {
+		name   string
+		limit  int
+		path   string
+		size   int
+		status int
+	}{
+		{"under the limit", 16, "/api/energy/insert", 15, 201},
+		{"at the limit", 16, "/api/energy/insert", 16, 201},
+		{"over the limit", 16, "/api/energy/insert", 17, 413},
+		{"far over the limit", 16, "/api/energy/insert", 1 << 20, 413},
+		{"empty body", 16, "/api/energy/insert", 0, 201},
+		{"exempt path", 16, "/api/energy/import", 1 << 20, 201},
+		{"exempt path, other case and slash", 16, "/API/Energy/Import/", 1 << 20, 201},
+		{"no limit", 0, "/api/energy/insert", 1 << 20, 201},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{BodyLimit: 4 << 20})
+			app.Use(BodyLimit(tt.limit, "/api/energy/import"))
+			app.Post("/api/energy/insert", ok)
+			app.Post("/api/energy/import", ok)
+
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(strings.Repeat("x", tt.size)))
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			status, code := errorCode(t, resp)
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d", status, tt.status)
+			}
+			if status == 413 && code != utils.CodePayloadTooLarge {
+				t.Errorf("code = %q, want %s", code, utils.CodePayloadTooLarge)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	const timeout, long = 50 * time.Millisecond, time.Second
+
+	// cancelled melaporkan apakah handler melihat context-nya dibatalkan
+	cancelled := make(chan bool, 1)
+	app := fiber.New()
+	app.Use(Timeout(timeout, long, "/api/energy/history"))
+	sleep := func(c *fiber.Ctx) error {
+		d, _ := time.ParseDuration(c.Query("sleep"))
+		select {
+		case <-c.UserContext().Done():
+			cancelled <- true
+			return c.UserContext().Err()
+		case <-time.After(d):
+			cancelled <- false
+		}
+		return c.SendString("done")
+	}
+	app.Get("/api/energy/summary", sleep)
+	app.Get("/api/energy/history", sleep)
+	// Handler yang tidak memakai context tetap dijawab 503 setelah selesai
+	app.Get("/api/energy/blocking", func(c *fiber.Ctx) error {
+		time.Sleep(2 * timeout)
+		return c.SendString("too late")
+	})
+	app.Get("/api/energy/budget", func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals(TimeoutLocal).(time.Duration).String())
+	})
+
+	tests := []struct {
+		name      string
+		path      string
+		status    int
+		cancelled bool
+	}{
+		{"fast handler", "/api/energy/summary?sleep=1ms", 200, false},
+		{"handler sleeps past the timeout", "/api/energy/summary?sleep=5s", 503, true},
+		{"streamed route gets the long budget", "/api/energy/history?sleep=100ms", 200, false},
+		{"streamed route past the long budget", "/api/energy/history?sleep=5s", 503, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := time.Now()
+			resp, err := app.Test(httptest.NewRequest("GET", tt.path, nil), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			status, code := errorCode(t, resp)
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d", status, tt.status)
+			}
+			if status == 503 && code != utils.CodeRequestTimeout {
+				t.Errorf("code = %q, want %s", code, utils.CodeRequestTimeout)
+			}
+			if got := <-cancelled; got != tt.cancelled {
+				t.Errorf("handler context cancelled = %v, want %v", got, tt.cancelled)
+			}
+			if elapsed := time.Since(started); elapsed > 3*time.Second {
+				t.Errorf("took %v, the handler was not cancelled", elapsed)
+			}
+		})
+	}
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/energy/blocking", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, code := errorCode(t, resp); status != 503 || code != utils.CodeRequestTimeout {
+		t.Errorf("blocking handler: %d %s, want 503 %s", status, code, utils.CodeRequestTimeout)
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/api/energy/budget", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	budget, err := io.ReadAll(resp.Body)
+	if err != nil || string(budget) != timeout.String() {
+		t.Errorf("%s = %q (%v), want %s", TimeoutLocal, budget, err, timeout)
+	}
+}
+
+func TestTimeoutDisabled(t *testing.T) {
+	app := fiber.New()
+	app.Use(Timeout(0, 0))
+	app.Get("/", func(c *fiber.Ctx) error {
+		if _, ok := c.UserContext().Deadline(); ok {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		return c.SendString("no deadline")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("status = %d, want 200 without a deadline", resp.StatusCode)
+	}
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"wattwise/internal/config"
+	"wattwise/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// LoginRateLimit limits login attempts per IP and per username (token bucket)
+// and locks a key out with exponential backoff after LockoutThreshold
+// consecutive failures. Blocked requests get 429 with Retry-After; the
+// message is the same whether or not the username exists.
+func LoginRateLimit(store LoginAttemptStore, cfg config.LoginConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req struct {
+			Username string `json:"username"`
+		}
+		_ = c.BodyParser(&req)
+
+		now := time.Now()
+		keys := []string{"ip:" + c.IP()}
+		if username := strings.ToLower(strings.TrimSpace(req.Username)); username != "" {
+			keys = append(keys, "user:"+username)
+		}
+
+		for _, key := range keys {
+			if wait := store.LockedFor(key, now); wait > 0 {
+				return tooManyAttempts(c, wait)
+			}
+		}
+		for _, key := range keys {
+			if ok, wait := store.Allow(key, cfg.AttemptsPerMinute, now); !ok {
+				return tooManyAttempts(c, wait)
+			}
+		}
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		switch c.Response().StatusCode() {
+		case fiber.StatusOK:
+			for _, key := range keys {
+				store.Reset(key)
+			}
+		case fiber.StatusUnauthorized:
+			for _, key := range keys {
+				failures := store.RecordFailure(key, now)
+				if failures < cfg.LockoutThreshold {
+					continue
+				}
+				lockout := lockoutDuration(failures-cfg.LockoutThreshold, cfg)
+				store.Lock(key, lockout, now)
+				log.Printf("🔒 Login locked for %s after %d failures (%s)", key, failures, lockout)
+			}
+		}
+		return nil
+	}
+}
+
+// RefreshRateLimit limits token refreshes per IP with the same token bucket
+// as LoginRateLimit, in buckets of their own ("refresh:ip:"). A successful
+// refresh resets nothing, so refreshing cannot clear a login lockout. There
+// is no lockout: a refresh token is a signed JWT that cannot be guessed.
+func RefreshRateLimit(store LoginAttemptStore, cfg config.LoginConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if ok, wait := store.Allow("refresh:ip:"+c.IP(), cfg.AttemptsPerMinute, time.Now()); !ok {
+			return tooManyAttempts(c, wait)
+		}
+		return c.Next()
+	}
+}
+
+// lockoutDuration doubles the base lockout for every failure past the threshold
+func lockoutDuration(extraFailures int, cfg config.LoginConfig) time.Duration {
+	base := time.Duration(cfg.LockoutBaseSeconds) * time.Second
+	max := time.Duration(cfg.LockoutMaxSeconds) * time.Second
+
+	d := time.Duration(float64(base) * math.Pow(2, float64(extraFailures)))
+	if d > max || d <= 0 {
+		d = max
+	}
+	return d
+}
+
+func tooManyAttempts(c *fiber.Ctx, wait time.Duration) error {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return utils.ErrorResponse(c, fiber.StatusTooManyRequests, "Terlalu banyak percobaan login, coba lagi nanti")
+}
@@ -0,0 +1,216 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"wattwise/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// loginApp serves /login (200 for password "ok", else 401) and /refresh
+// (200 for token "ok", else 401) behind the limiters
+func loginApp(store LoginAttemptStore, cfg config.LoginConfig) *fiber.App {
+	app := fiber.New()
+	app.Post("/login", LoginRateLimit(store, cfg), func(c *fiber.Ctx) error {
+		var req struct {
+			Password string `json:"password"`
+		}
+		_ = c.BodyParser(&req)
+		if req.Password != "ok" {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+	app.Post("/refresh", RefreshRateLimit(store, cfg), func(c *fiber.Ctx) error {
+		var req struct {
+			Token string `json:"refresh_token"`
+		}
+		_ = c.BodyParser(&req)
+		if req.Token != "ok" {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		return c.SendStatus(fiber.StatusOK)
+	})
+	return app
+}
+
+func post(t *testing.T, app *fiber.App, path, body string) int {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestRefreshDoesNotResetLoginLockout(t *testing.T) {
+	store := NewMemoryLoginStore(0)
+	t.Cleanup(store.Close)
+	app := loginApp(store, config.LoginConfig{AttemptsPerMinute: 100, LockoutThreshold: 3, LockoutBaseSeconds: 60, LockoutMaxSeconds: 900})
+
+	for i := 0; i < 2; i++ {
+		if status := post(t, app, "/login", `{"username":"admin","password":"guess"}`); status != 401 {
+			t.Fatalf("failure %d: status %d, want 401", i+1, status)
+		}
+		if status := post(t, app, "/refresh", `{"refresh_token":"ok"}`); status != 200 {
+			t.Fatalf("refresh: status %d, want 200", status)
+		}
+	}
+	// Kegagalan ketiga tetap mengunci walau ada refresh yang sukses di antaranya
+	if status := post(t, app, "/login", `{"username":"admin","password":"guess"}`); status != 401 {
+		t.Fatalf("third failure: status %d, want 401", status)
+	}
+	if status := post(t, app, "/login", `{"username":"admin","password":"ok"}`); status != 429 {
+		t.Errorf("login after lockout: status %d, want 429", status)
+	}
+}
+
+func TestRefreshRateLimit(t *testing.T) {
+	store := NewMemoryLoginStore(0)
+	t.Cleanup(store.Close)
+	app := loginApp(store, config.LoginConfig{AttemptsPerMinute: 2, LockoutThreshold: 5, LockoutBaseSeconds: 60, LockoutMaxSeconds: 900})
+
+	for i := 0; i < 2; i++ {
+		if status := post(t, app, "/refresh", `{"refresh_token":"ok"}`); status != 200 {
+			t.Fatalf("refresh %d: status %d, want 200", i+1, status)
+		}
+	}
+	if status := post(t, app, "/refresh", `{"refresh_token":"ok"}`); status != 429 {
+		t.Errorf("third refresh: status %d, want 429", status)
+	}
+	// Bucket refresh terpisah dari bucket login
+	if status := post(t, app, "/login", `{"username":"admin","password":"ok"}`); status != 200 {
+		t.Errorf("login after refresh limit: status %d, want 200", status)
+	}
+}
+
+func TestLoginBucketPerUsername(t *testing.T) {
+	store := NewMemoryLoginStore(0)
+	t.Cleanup(store.Close)
+	app := loginApp(store, config.LoginConfig{AttemptsPerMinute: 2, LockoutThreshold: 100, LockoutBaseSeconds: 60, LockoutMaxSeconds: 900})
+
+	// Bucket IP (2/menit) habis oleh dua username berbeda
+	post(t, app, "/login", `{"username":"alice","password":"x"}`)
+	post(t, app, "/login", `{"username":"bob","password":"x"}`)
+	if status := post(t, app, "/login", `{"username":"carol","password":"ok"}`); status != 429 {
+		t.Errorf("third attempt from one IP: status %d, want 429", status)
+	}
+}
+
+func TestLoginBucketsAreSeparate(t *testing.T) {
+	store := NewMemoryLoginStore(0)
+	t.Cleanup(store.Close)
+	cfg := config.LoginConfig{AttemptsPerMinute: 2}
+	now := time.Now()
+
+	for _, key := range []string{"ip:10.0.0.1", "user:alice"} {
+		for i := 0; i < 2; i++ {
+			if ok, _ := store.Allow(key, cfg.AttemptsPerMinute, now); !ok {
+				t.Fatalf("%s attempt %d refused", key, i+1)
+			}
+		}
+		ok, wait := store.Allow(key, cfg.AttemptsPerMinute, now)
+		if ok || wait <= 0 || wait > 30*time.Second {
+			t.Errorf("%s: Allow = %v, %v; want refused with a wait up to 30s", key, ok, wait)
+		}
+	}
+	// IP lain dan user lain masih punya token
+	for _, key := range []string{"ip:10.0.0.2", "user:bob"} {
+		if ok, _ := store.Allow(key, cfg.AttemptsPerMinute, now); !ok {
+			t.Errorf("%s refused by another key's bucket", key)
+		}
+	}
+	// Bucket terisi lagi 1 token per 30 detik
+	if ok, _ := store.Allow("ip:10.0.0.1", cfg.AttemptsPerMinute, now.Add(30*time.Second)); !ok {
+		t.Error("bucket not refilled after 30s")
+	}
+}
+
+func TestLockoutDurationDoubles(t *testing.T) {
+	cfg := config.LoginConfig{LockoutBaseSeconds: 30, LockoutMaxSeconds: 900}
+	tests := []struct {
+		extra int
+		want  time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{5, 15 * time.Minute}, // 16 menit dibatasi max
+		{200, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := lockoutDuration(tt.extra, cfg); got != tt.want {
+			t.Errorf("lockoutDuration(%d) = %s, want %s", tt.extra, got, tt.want)
+		}
+	}
+}
+
+func TestLoginLockoutAndResetOnSuccess(t *testing.T) {
+	store := NewMemoryLoginStore(0)
+	t.Cleanup(store.Close)
+	app := loginApp(store, config.LoginConfig{AttemptsPerMinute: 100, LockoutThreshold: 3, LockoutBaseSeconds: 30, LockoutMaxSeconds: 900})
+
+	for i := 0; i < 3; i++ {
+		if status := post(t, app, "/login", `{"username":"Alice","password":"x"}`); status != 401 {
+			t.Fatalf("failure %d: status %d, want 401", i+1, status)
+		}
+	}
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(`{"username":" alice ","password":"ok"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ := app.Test(req)
+	if resp.StatusCode != 429 {
+		t.Fatalf("login while locked: status %d, want 429", resp.StatusCode)
+	}
+	if retry := resp.Header.Get(fiber.HeaderRetryAfter); retry == "" || retry == "0" {
+		t.Errorf("Retry-After = %q", retry)
+	}
+
+	// Lockout berikutnya dua kali lebih lama
+	now := time.Now()
+	for _, key := range []string{"ip:0.0.0.0", "user:alice"} {
+		if wait := store.LockedFor(key, now); wait <= 0 || wait > 30*time.Second {
+			t.Errorf("%s locked for %s, want up to 30s", key, wait)
+		}
+	}
+	if failures := store.RecordFailure("user:alice", now); failures != 4 {
+		t.Errorf("failures = %d, want 4", failures)
+	}
+	store.Lock("user:alice", lockoutDuration(4-3, config.LoginConfig{LockoutBaseSeconds: 30, LockoutMaxSeconds: 900}), now)
+	if wait := store.LockedFor("user:alice", now); wait != time.Minute {
+		t.Errorf("second lockout = %s, want 1m", wait)
+	}
+
+	// Setelah lockout habis, login sukses mereset hitungan gagal
+	later := now.Add(2 * time.Minute)
+	if wait := store.LockedFor("user:alice", later); wait != 0 {
+		t.Fatalf("still locked after 2m: %s", wait)
+	}
+	store.Reset("user:alice")
+	store.Reset("ip:0.0.0.0")
+	if failures := store.RecordFailure("user:alice", later); failures != 1 {
+		t.Errorf("failures after reset = %d, want 1", failures)
+	}
+}
+
+func TestLoginSuccessResetsFailures(t *testing.T) {
+	store := NewMemoryLoginStore(0)
+	t.Cleanup(store.Close)
+	app := loginApp(store, config.LoginConfig{AttemptsPerMinute: 100, LockoutThreshold: 3, LockoutBaseSeconds: 30, LockoutMaxSeconds: 900})
+
+	// 2 gagal, sukses, 2 gagal: tidak pernah 3 berturut-turut
+	for _, password := range []string{"x", "x", "ok", "x", "x", "ok"} {
+		want := 401
+		if password == "ok" {
+			want = 200
+		}
+		if status := post(t, app, "/login", `{"username":"alice","password":"`+password+`"}`); status != want {
+			t.Fatalf("password %q: status %d, want %d", password, status, want)
+		}
+	}
+}
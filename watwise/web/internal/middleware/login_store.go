@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+)
+
+// LoginAttemptStore keeps rate-limit and lockout state per key (IP or
+// username). The in-memory implementation can be swapped for a shared one
+// (e.g. Redis) when running more than one instance.
+type LoginAttemptStore interface {
+	// Allow takes one attempt from key's token bucket. When the bucket is
+	// empty it returns false and how long until the next token.
+	Allow(key string, ratePerMinute int, now time.Time) (bool, time.Duration)
+	// LockedFor returns how long key is still locked out (0 = not locked)
+	LockedFor(key string, now time.Time) time.Duration
+	// RecordFailure counts a failed login and returns the consecutive failures
+	RecordFailure(key string, now time.Time) int
+	// Lock locks key out until now+d
+	Lock(key string, d time.Duration, now time.Time)
+	// Reset clears failures, lockout and the token bucket after a
+	// successful login
+	Reset(key string)
+}
+
+type loginEntry struct {
+	tokens      float64
+	lastRefill  time.Time
+	failures    int
+	lockedUntil time.Time
+	lastSeen    time.Time
+}
+
+// MemoryLoginStore is an in-memory LoginAttemptStore. Entries idle for longer
+// than ttl are removed by a background janitor.
+type MemoryLoginStore struct {
+	mu      sync.Mutex
+	entries map[string]*loginEntry
+	ttl     time.Duration
+	stop    chan struct{}
+}
+
+func NewMemoryLoginStore(ttl time.Duration) *MemoryLoginStore {
+	s := &MemoryLoginStore{
+		entries: make(map[string]*loginEntry),
+		ttl:     ttl,
+		stop:    make(chan struct{}),
+	}
+	go s.janitor()
+	return s
+}
+
+// Close stops the janitor
+func (s *MemoryLoginStore) Close() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+}
+
+func (s *MemoryLoginStore) janitor() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.cleanup(now)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *MemoryLoginStore) cleanup(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, e := range s.entries {
+		if now.Sub(e.lastSeen) > s.ttl && now.After(e.lockedUntil) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// entry must be called with s.mu held
+func (s *MemoryLoginStore) entry(key string, ratePerMinute int, now time.Time) *loginEntry {
+	e, ok := s.entries[key]
+	if !ok {
+		e = &loginEntry{tokens: float64(ratePerMinute), lastRefill: now}
+		s.entries[key] = e
+	}
+	e.lastSeen = now
+	return e
+}
+
+func (s *MemoryLoginStore) Allow(key string, ratePerMinute int, now time.Time) (bool, time.Duration) {
+	if ratePerMinute <= 0 {
+		return true, 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.entry(key, ratePerMinute, now)
+
+	// Refill: ratePerMinute token per menit, maksimal ratePerMinute
+	perSecond := float64(ratePerMinute) / 60
+	e.tokens += now.Sub(e.lastRefill).Seconds() * perSecond
+	if e.tokens > float64(ratePerMinute) {
+		e.tokens = float64(ratePerMinute)
+	}
+	e.lastRefill = now
+
+	if e.tokens < 1 {
+		wait := time.Duration((1 - e.tokens) / perSecond * float64(time.Second))
+		return false, wait
+	}
+	e.tokens--
+	return true, 0
+}
+
+func (s *MemoryLoginStore) LockedFor(key string, now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || !now.Before(e.lockedUntil) {
+		return 0
+	}
+	return e.lockedUntil.Sub(now)
+}
+
+func (s *MemoryLoginStore) RecordFailure(key string, now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.entry(key, 0, now)
+	e.failures++
+	return e.failures
+}
+
+func (s *MemoryLoginStore) Lock(key string, d time.Duration, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := s.entry(key, 0, now)
+	e.lockedUntil = now.Add(d)
+}
+
+func (s *MemoryLoginStore) Reset(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Entry baru dibuat lagi dengan bucket penuh pada attempt berikutnya
+	delete(s.entries, key)
+}
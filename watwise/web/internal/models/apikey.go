@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// API key scopes: read boleh GET endpoint energy, read-write juga insert,
+// bulk insert dan import
+const (
+	ScopeRead      = "read"
+	ScopeReadWrite = "read-write"
+)
+
+// ValidScope reports whether scope is ScopeRead or ScopeReadWrite
+func ValidScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeReadWrite
+}
+
+// APIKey is a key for machine clients (Grafana, scripts), sent as X-API-Key.
+// Only a hash of the key is stored; Prefix identifies it in listings.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	Prefix     string     `json:"prefix"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// APIKeyInput is the body of POST /api/apikeys
+type APIKeyInput struct {
+	Name  string `json:"name"`
+	Scope string `json:"scope"`
+}
+
+// NewAPIKey is returned once by POST /api/apikeys; Key cannot be retrieved
+// again afterwards
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
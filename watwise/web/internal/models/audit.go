@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Audit event types
+const (
+	AuditLoginSuccess    = "login_success"
+	AuditLoginFailure    = "login_failure"
+	AuditUserCreated     = "user_created"
+	AuditUserDeleted     = "user_deleted"
+	AuditSettingsChanged = "settings_changed"
+	AuditDataDeleted     = "data_deleted"
+	AuditDeviceCommand   = "device_command"
+)
+
+// AuditEventTypes lists every audit event type
+var AuditEventTypes = []string{
+	AuditLoginSuccess, AuditLoginFailure, AuditUserCreated, AuditUserDeleted,
+	AuditSettingsChanged, AuditDataDeleted, AuditDeviceCommand,
+}
+
+// AuditEvent records who did what, from where
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Username  string    `json:"username,omitempty"` // for logins: the name tried
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	// What was acted on: user, device or data range
+	Target  string                 `json:"target,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// AuditFilter selects events for GET /api/admin/audit; zero fields match all
+type AuditFilter struct {
+	From     time.Time
+	To       time.Time
+	Username string
+	Type     string
+	Page     int // 1-based
+	PageSize int
+}
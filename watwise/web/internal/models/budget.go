@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Budget units: kwh membatasi konsumsi, cost membatasi biaya (tarif flat)
+const (
+	BudgetUnitKWh  = "kwh"
+	BudgetUnitCost = "cost"
+)
+
+// ValidBudgetUnit reports whether unit is BudgetUnitKWh or BudgetUnitCost
+func ValidBudgetUnit(unit string) bool {
+	return unit == BudgetUnitKWh || unit == BudgetUnitCost
+}
+
+// Budget is a monthly limit for one device, or for all registered devices
+// together when DeviceID is empty
+type Budget struct {
+	DeviceID  string    `json:"device_id,omitempty"`
+	Unit      string    `json:"unit"`
+	Limit     float64   `json:"limit"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+}
+
+// BudgetInput is the body of PUT /api/settings/budget
+type BudgetInput struct {
+	DeviceID string  `json:"device_id"`
+	Unit     string  `json:"unit"` // default kwh
+	Limit    float64 `json:"limit"`
+}
+
+// BudgetStatus is the month-to-date progress against a Budget. Used, Average
+// and Projected are in the budget's unit; the projection extrapolates the
+// daily average so far to the whole month.
+type BudgetStatus struct {
+	Budget           Budget  `json:"budget"`
+	Month            string  `json:"month"` // 2025-01
+	Timezone         string  `json:"timezone"`
+	MonthToDateKWh   float64 `json:"month_to_date_kwh"`
+	MonthToDateCost  float64 `json:"month_to_date_cost"`
+	Used             float64 `json:"used"`
+	PercentUsed      float64 `json:"percent_used"`
+	DailyAverage     float64 `json:"daily_average"`
+	Projected        float64 `json:"projected"`
+	ProjectedPercent float64 `json:"projected_percent"`
+	DaysInMonth      int     `json:"days_in_month"`
+	DaysRemaining    int     `json:"days_remaining"` // full days after today
+}
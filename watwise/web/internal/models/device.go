@@ -0,0 +1,90 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Device adalah metadata device yang terdaftar
+type Device struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Location  string    `json:"location"`
+	MaxPower  float64   `json:"max_power"` // rated capacity in Watts, 0 = unknown
+	CreatedAt time.Time `json:"created_at"`
+
+	// Anomaly detection overrides, 0 = pakai default dari config
+	AnomalySigma      float64 `json:"anomaly_sigma,omitempty"`
+	AnomalyWarmupDays int     `json:"anomaly_warmup_days,omitempty"`
+
+	// Power quality alert overrides, 0 = pakai ALERT_MIN_POWER_FACTOR,
+	// ALERT_MIN_FREQUENCY dan ALERT_MAX_FREQUENCY
+	MinPowerFactor float64 `json:"min_power_factor,omitempty"`
+	MinFrequency   float64 `json:"min_frequency,omitempty"`
+	MaxFrequency   float64 `json:"max_frequency,omitempty"`
+
+	// Store at most one MQTT reading per this many seconds, 0 = pakai
+	// MQTT_STORE_INTERVAL_SECONDS
+	StoreIntervalSeconds int `json:"store_interval_seconds,omitempty"`
+
+	// How often the device reports, 0 = pakai MQTT_REPORT_INTERVAL_SECONDS.
+	// Offline after MQTT_OFFLINE_MISSED_REPORTS intervals without data; also
+	// the spacing completeness (demand window coverage) is measured against.
+	ExpectedReportIntervalSeconds int `json:"expected_report_interval_seconds,omitempty"`
+}
+
+// StoredInterval is the expected spacing of the device's stored readings:
+// its report interval, or the store interval when readings are throttled
+// more. 0 = unknown.
+func (d Device) StoredInterval() time.Duration {
+	return time.Duration(max(d.ExpectedReportIntervalSeconds, d.StoreIntervalSeconds)) * time.Second
+}
+
+// DeviceUpdate berisi field yang boleh diubah lewat PUT /api/devices/:id.
+// Field yang nil tidak diubah.
+type DeviceUpdate struct {
+	Name     *string  `json:"name"`
+	Location *string  `json:"location"`
+	MaxPower *float64 `json:"max_power"`
+
+	AnomalySigma      *float64 `json:"anomaly_sigma"`
+	AnomalyWarmupDays *int     `json:"anomaly_warmup_days"`
+
+	MinPowerFactor *float64 `json:"min_power_factor"`
+	MinFrequency   *float64 `json:"min_frequency"`
+	MaxFrequency   *float64 `json:"max_frequency"`
+
+	StoreIntervalSeconds *int `json:"store_interval_seconds"`
+
+	ExpectedReportIntervalSeconds *int `json:"expected_report_interval_seconds"`
+}
+
+// Status command yang dikirim ke device
+const (
+	CommandPending = "pending"
+	CommandAcked   = "acked"
+	CommandFailed  = "failed"  // device membalas dengan error
+	CommandTimeout = "timeout" // tidak ada ack dalam batas waktu
+)
+
+// CommandStatus melacak satu command dari publish sampai ack/timeout
+type CommandStatus struct {
+	RequestID string          `json:"request_id"`
+	DeviceID  string          `json:"device_id"`
+	Action    string          `json:"action"`
+	Status    string          `json:"status"`
+	Message   string          `json:"message,omitempty"`  // dari ack device
+	Response  json.RawMessage `json:"response,omitempty"` // ack payload "response", as sent by the device
+	SentAt    time.Time       `json:"sent_at"`
+	AckedAt   *time.Time      `json:"acked_at,omitempty"`
+	Deadline  time.Time       `json:"deadline"`
+}
+
+// CommandAck adalah payload di wattwise/ack/<device_id>
+type CommandAck struct {
+	RequestID string `json:"request_id"`
+	Status    string `json:"status"` // "ok" atau "error"
+	Message   string `json:"message"`
+
+	Response json.RawMessage `json:"response,omitempty"` // optional device-specific result
+}
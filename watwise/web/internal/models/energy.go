@@ -1,29 +1,189 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
 
-// EnergyData digunakan untuk data yang disimpan di IoTDB
+// DefaultDeviceID dipakai kalau payload/request tidak menyebut device
+const DefaultDeviceID = "ESP32_PZEM"
+
+// EnergyData digunakan untuk data yang disimpan di IoTDB.
+//
+// Units: voltage in V, current in A, power in W, frequency in Hz. Energy is
+// the PZEM's cumulative counter in kWh, exactly as the device sends it: it is
+// NOT the consumption of one reading and NOT in Wh. Consumption over a period
+// is the increase of the counter (services.IntervalEnergy); read the counter
+// through ReadingKWh instead of scaling Energy by hand.
 type EnergyData struct {
 	Timestamp   int64   `json:"timestamp"` // Unix Millisecond
 	Voltage     float64 `json:"voltage"`
 	Current     float64 `json:"current"`
 	Power       float64 `json:"power"`
-	Energy      float64 `json:"energy"`
+	Energy      float64 `json:"energy"` // cumulative counter, kWh
 	Frequency   float64 `json:"frequency"`
 	PowerFactor float64 `json:"power_factor"`
 	Prediction  float64 `json:"prediction,omitempty"`
+
+	// L1..L3 of a 3-phase meter, nil for single-phase readings (their
+	// voltage/current/power are phase 1). With phases, Power and Current
+	// are the sums and Voltage the mean, see SumPhases.
+	Phases []PhaseReading `json:"phases,omitempty"`
+
+	// Measurements IoTDB returned NULL for (the device did not report
+	// them); they read as 0 here and are left out of the JSON
+	Missing MeasurementMask `json:"-"`
+
+	// Readings an hourly aggregate of downsampled data stands for (its
+	// voltage/current/power are their means), 0 for a raw reading
+	Samples int64 `json:"samples,omitempty"`
+}
+
+// Weight is how many readings d counts for in averages and counts:
+// Samples for an hourly aggregate, 1 for a raw reading
+func (d EnergyData) Weight() int {
+	if d.Samples > 0 {
+		return int(d.Samples)
+	}
+	return 1
+}
+
+// MaxPhases is the number of phases a reading can carry (L1..L3)
+const MaxPhases = 3
+
+// PhaseReading is one phase of a 3-phase reading, same units as EnergyData
+type PhaseReading struct {
+	Voltage float64 `json:"voltage"`
+	Current float64 `json:"current"`
+	Power   float64 `json:"power"`
 }
 
-// EnergyReading untuk response API dengan format time.Time
+// ValidatePhases checks the phases of a 3-phase reading
+func ValidatePhases(phases []PhaseReading) error {
+	if len(phases) > MaxPhases {
+		return fmt.Errorf("at most %d phases, got %d", MaxPhases, len(phases))
+	}
+	for i, p := range phases {
+		if p.Voltage < 0 || p.Current < 0 || p.Power < 0 {
+			return fmt.Errorf("phase L%d: voltage, current and power must be >= 0", i+1)
+		}
+	}
+	return nil
+}
+
+// SumPhases returns the totals of a 3-phase reading: the mean voltage and
+// the summed current and power
+func SumPhases(phases []PhaseReading) (voltage, current, power float64) {
+	for _, p := range phases {
+		voltage += p.Voltage
+		current += p.Current
+		power += p.Power
+	}
+	if len(phases) > 0 {
+		voltage /= float64(len(phases))
+	}
+	return voltage, current, power
+}
+
+// MeasurementMask flags EnergyData measurements, see EnergyData.Missing
+type MeasurementMask uint8
+
+const (
+	MissingVoltage MeasurementMask = 1 << iota
+	MissingCurrent
+	MissingPower
+	MissingEnergy
+	MissingFrequency
+	MissingPowerFactor
+)
+
+// Has reports whether every flag of m2 is set
+func (m MeasurementMask) Has(m2 MeasurementMask) bool {
+	return m&m2 == m2
+}
+
+// energyJSON is EnergyData with the missing measurements omitted
+type energyJSON struct {
+	Timestamp   int64    `json:"timestamp"`
+	Voltage     *float64 `json:"voltage,omitempty"`
+	Current     *float64 `json:"current,omitempty"`
+	Power       *float64 `json:"power,omitempty"`
+	Energy      *float64 `json:"energy,omitempty"`
+	Frequency   *float64 `json:"frequency,omitempty"`
+	PowerFactor *float64 `json:"power_factor,omitempty"`
+	Prediction  float64  `json:"prediction,omitempty"`
+
+	Phases []PhaseReading `json:"phases,omitempty"`
+}
+
+// MarshalJSON leaves out the measurements flagged in Missing, so a NULL is
+// not mistaken for a real 0
+func (d EnergyData) MarshalJSON() ([]byte, error) {
+	type plain EnergyData
+	if d.Missing == 0 {
+		return json.Marshal(plain(d))
+	}
+
+	present := func(v float64, flag MeasurementMask) *float64 {
+		if d.Missing.Has(flag) {
+			return nil
+		}
+		return &v
+	}
+	return json.Marshal(energyJSON{
+		Timestamp:   d.Timestamp,
+		Voltage:     present(d.Voltage, MissingVoltage),
+		Current:     present(d.Current, MissingCurrent),
+		Power:       present(d.Power, MissingPower),
+		Energy:      present(d.Energy, MissingEnergy),
+		Frequency:   present(d.Frequency, MissingFrequency),
+		PowerFactor: present(d.PowerFactor, MissingPowerFactor),
+		Prediction:  d.Prediction,
+		Phases:      d.Phases,
+	})
+}
+
+// ReadingKWh returns the energy counter in kWh
+func (d EnergyData) ReadingKWh() float64 {
+	return d.Energy
+}
+
+// EnergyReading untuk response API dengan format time.Time, same units as
+// EnergyData
 type EnergyReading struct {
 	DeviceID    string    `json:"device_id"`
 	Voltage     float64   `json:"voltage"`
 	Current     float64   `json:"current"`
 	Power       float64   `json:"power"`
-	Energy      float64   `json:"energy"`
+	Energy      float64   `json:"energy"` // cumulative counter, kWh
 	Frequency   float64   `json:"frequency"`
 	PowerFactor float64   `json:"power_factor"`
 	Timestamp   time.Time `json:"timestamp"`
+
+	Phases  []PhaseReading `json:"phases,omitempty"`  // 3-phase meters only
+	Samples int64          `json:"samples,omitempty"` // hourly aggregates only, see EnergyData.Samples
+}
+
+// Weight is how many readings r counts for, see EnergyData.Weight
+func (r EnergyReading) Weight() int {
+	if r.Samples > 0 {
+		return int(r.Samples)
+	}
+	return 1
+}
+
+// ReadingKWh returns the energy counter in kWh
+func (r EnergyReading) ReadingKWh() float64 {
+	return r.Energy
+}
+
+// LatestReading is the response of GET /api/energy/latest?device_id=
+type LatestReading struct {
+	EnergyReading
+	AgeSeconds float64 `json:"age_seconds"` // how old the reading is, for "as of"
+	Source     string  `json:"source"`      // cache, iotdb
 }
 
 // MQTTMessage represents incoming MQTT message from ESP32
@@ -31,16 +191,52 @@ type EnergyReading struct {
 type MQTTMessage struct {
 	DeviceID string `json:"device_id"`
 	// Timestamp bisa berupa string format "2025-10-20 00:55:31" atau int64
-	TimestampStr string  `json:"timestamp,omitempty"` // Jika string
-	Timestamp    int64   `json:"timestamp,omitempty"` // Jika int64
-	Voltage      float64 `json:"voltage"`
-	Current      float64 `json:"current"`
-	Power        float64 `json:"power"`
-	Energy       float64 `json:"energy"`
-	Frequency    float64 `json:"frequency"`
-	PowerFactor  float64 `json:"pf"` // ✅ FIXED: Match dengan MQTT payload "pf"
-	Rssi         int     `json:"rssi,omitempty"`
-	Uptime       int     `json:"uptime,omitempty"`
+	Timestamp   DeviceTimestamp `json:"timestamp,omitempty"`
+	Voltage     float64         `json:"voltage"`
+	Current     float64         `json:"current"`
+	Power       float64         `json:"power"`
+	Energy      float64         `json:"energy"`
+	Frequency   float64         `json:"frequency"`
+	PowerFactor float64         `json:"pf"` // ✅ FIXED: Match dengan MQTT payload "pf"
+	Rssi        int             `json:"rssi,omitempty"`
+	Uptime      int             `json:"uptime,omitempty"`
+
+	// 3-phase meters: [{"voltage":..,"current":..,"power":..}, ...] for
+	// L1..L3; voltage/current/power may then be left out, they are
+	// derived with SumPhases
+	Phases []PhaseReading `json:"phases,omitempty"`
+}
+
+// ErrInvalidTimestamp means a payload timestamp is in none of the formats
+// DeviceTimestamp accepts
+var ErrInvalidTimestamp = errors.New("invalid device timestamp")
+
+// DeviceTimestamp adalah timestamp Unix millisecond dari device.
+// Menerima angka atau string "2006-01-02 15:04:05" (waktu lokal server);
+// null atau "" berarti tidak ada (0). Format lain ditolak dengan
+// ErrInvalidTimestamp, bukan diam-diam jadi 0.
+type DeviceTimestamp int64
+
+func (t *DeviceTimestamp) UnmarshalJSON(b []byte) error {
+	var ms int64
+	if err := json.Unmarshal(b, &ms); err == nil {
+		*t = DeviceTimestamp(ms)
+		return nil
+	}
+
+	var str string
+	if err := json.Unmarshal(b, &str); err == nil {
+		if str == "" {
+			*t = 0
+			return nil
+		}
+		if parsed, err := time.ParseInLocation("2006-01-02 15:04:05", str, time.Local); err == nil {
+			*t = DeviceTimestamp(parsed.UnixMilli())
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrInvalidTimestamp, b)
 }
 
 // RealtimeData for WebSocket broadcasting
@@ -55,6 +251,8 @@ type RealtimeData struct {
 	PowerFactor float64 `json:"power_factor"`
 	Status      string  `json:"status"`
 	Timestamp   int64   `json:"timestamp"` // Unix millisecond
+
+	Phases []PhaseReading `json:"phases,omitempty"` // 3-phase meters only
 }
 
 // DeviceStatus untuk tracking device online/offline
@@ -63,6 +261,46 @@ type DeviceStatus struct {
 	DeviceName string `json:"device_name"`
 	Status     string `json:"status"` // online, offline
 	LastSeen   int64  `json:"last_seen"`
+
+	// Last WiFi signal (dBm) and uptime (s) the firmware reported, 0 = never
+	RSSI   int `json:"rssi,omitempty"`
+	Uptime int `json:"uptime,omitempty"`
+}
+
+// LinkSample is one rssi/uptime report of a device
+type LinkSample struct {
+	Timestamp int64 `json:"timestamp"` // Unix millisecond
+	RSSI      int   `json:"rssi"`
+	Uptime    int   `json:"uptime"`
+}
+
+// DeviceDiagnostics: GET /api/devices/:id/diagnostics
+type DeviceDiagnostics struct {
+	DeviceID string `json:"device_id"`
+	Status   string `json:"status"`
+	LastSeen int64  `json:"last_seen"`
+	RSSI     int    `json:"rssi"`
+	Uptime   int    `json:"uptime"`
+	// Uptime going down between reports means the device restarted
+	Restarts int          `json:"restarts"`
+	History  []LinkSample `json:"history"` // oldest first
+}
+
+// Sumber perubahan status device
+const (
+	StatusSourceLWT       = "lwt"       // wattwise/status/<id>, retained or broker LWT
+	StatusSourceHeartbeat = "heartbeat" // no data for 60s
+	StatusSourceData      = "data"      // energy reading received
+)
+
+// DeviceStatusEvent is broadcast over WebSocket when a device goes online or offline
+type DeviceStatusEvent struct {
+	Type      string `json:"type"` // "device_status"
+	DeviceID  string `json:"device_id"`
+	Status    string `json:"status"`             // online, offline
+	Previous  string `json:"previous,omitempty"` // empty when the device was unknown
+	Source    string `json:"source"`
+	Timestamp int64  `json:"timestamp"`
 }
 
 // DailySummary untuk summary harian
@@ -74,6 +312,83 @@ type DailySummary struct {
 	MaxPower    float64 `json:"max_power"`
 	MinPower    float64 `json:"min_power"`
 	TotalCost   float64 `json:"total_cost"`
+
+	TotalCostMoney Money `json:"total_cost_money"`
+}
+
+// BatchInsertResult hasil bulk insert
+type BatchInsertResult struct {
+	Inserted   int           `json:"inserted"`
+	Rejected   []RejectedRow `json:"rejected"`
+	DurationMs int64         `json:"duration_ms"`
+}
+
+// ImportResult ringkasan POST /api/energy/import
+type ImportResult struct {
+	Imported   int           `json:"imported"`
+	Skipped    int           `json:"skipped"` // baris kosong
+	Errored    int           `json:"errored"`
+	Errors     []RejectedRow `json:"errors"` // first MaxImportErrors only, Index = line number
+	DurationMs int64         `json:"duration_ms"`
+}
+
+// MaxImportErrors caps ImportResult.Errors
+const MaxImportErrors = 50
+
+// AddError counts a failed row and keeps its details while under the cap
+func (r *ImportResult) AddError(line int, reason string) {
+	r.Errored++
+	if len(r.Errors) < MaxImportErrors {
+		r.Errors = append(r.Errors, RejectedRow{Index: line, Reason: reason})
+	}
+}
+
+// RejectedRow baris yang ditolak saat bulk insert
+type RejectedRow struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// MonthlySummary untuk /api/energy/summary/monthly: total bulan dan summary
+// per hari
+type MonthlySummary struct {
+	DeviceID       string          `json:"device_id"`
+	Month          string          `json:"month"` // 2025-01
+	TotalEnergy    float64         `json:"total_energy"`
+	TotalCost      float64         `json:"total_cost"`
+	DailySummaries []*DailySummary `json:"daily_summaries"`
+
+	TotalCostMoney Money `json:"total_cost_money"`
+
+	// Standby power from the month's night windows (see StandbyReport) and
+	// the kWh it adds up to over the whole month
+	StandbyPower  float64 `json:"standby_power"`
+	StandbyNights int     `json:"standby_nights"` // nights with enough samples
+	StandbyEnergy float64 `json:"standby_energy"`
+}
+
+// PeriodTotal total energi dan biaya untuk satu periode
+type PeriodTotal struct {
+	StartDate   string  `json:"start_date"`
+	EndDate     string  `json:"end_date"`
+	TotalEnergy float64 `json:"total_energy"`
+	TotalCost   float64 `json:"total_cost"`
+
+	TotalCostMoney Money `json:"total_cost_money"`
+
+	// Windows ending mid-day (ComparePeriods) count readings before Until,
+	// RFC3339; empty for whole days
+	Until string `json:"until,omitempty"`
+}
+
+// PeriodComparison untuk perbandingan periode sekarang vs periode sebelumnya
+type PeriodComparison struct {
+	DeviceID      string      `json:"device_id"`
+	Period        string      `json:"period"`
+	Current       PeriodTotal `json:"current"`
+	Previous      PeriodTotal `json:"previous"`
+	ChangeEnergy  float64     `json:"change_energy"`
+	ChangePercent *float64    `json:"change_percent"` // null kalau periode sebelumnya kosong
 }
 
 // AlertData untuk notifikasi
@@ -84,6 +399,10 @@ type AlertData struct {
 	Threshold   float64 `json:"threshold"`
 	ActualValue float64 `json:"actual_value"`
 	Timestamp   int64   `json:"timestamp"`
+
+	// info, warning or critical; threshold alerts grade it by how far the
+	// bound is exceeded, other types use AlertSeverity
+	Severity string `json:"severity"`
 }
 
 // FilteredEnergyData untuk response data yang sudah diagregasi
@@ -106,6 +425,7 @@ type FilteredResponse struct {
 	Success   bool                 `json:"success"`
 	Filter    string               `json:"filter"`
 	DateRange map[string]string    `json:"date_range,omitempty"`
+	Timezone  string               `json:"timezone"`
 	Count     int                  `json:"count"`
 	Data      []FilteredEnergyData `json:"data"`
 }
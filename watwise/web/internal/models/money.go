@@ -0,0 +1,62 @@
+package models
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Currency describes how cost amounts are labelled and formatted
+// (CURRENCY_CODE, CURRENCY_SYMBOL, CURRENCY_DECIMALS)
+type Currency struct {
+	Code     string `json:"code"` // ISO 4217, e.g. IDR
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+}
+
+// DefaultCurrency is Rupiah, matching the default PLN tariff
+var DefaultCurrency = Currency{Code: "IDR", Symbol: "Rp", Decimals: 0}
+
+// Money is a cost together with its currency. Responses keep the raw float
+// fields (total_cost, cost, ...) for charts next to it.
+type Money struct {
+	Amount    float64  `json:"amount"`
+	Currency  Currency `json:"currency"`
+	Formatted string   `json:"formatted"` // e.g. "Rp 12,345"
+}
+
+// Money wraps amount, rounded to the currency's decimals
+func (c Currency) Money(amount float64) Money {
+	scale := math.Pow10(c.Decimals)
+	return Money{
+		Amount:    math.Round(amount*scale) / scale,
+		Currency:  c,
+		Formatted: c.Format(amount),
+	}
+}
+
+// Format renders amount as "<symbol> 1,234.50" with thousands separators
+func (c Currency) Format(amount float64) string {
+	digits := strconv.FormatFloat(math.Abs(amount), 'f', c.Decimals, 64)
+	whole, frac, _ := strings.Cut(digits, ".")
+
+	var b strings.Builder
+	if amount < 0 && strings.Trim(digits, "0.") != "" {
+		b.WriteByte('-')
+	}
+	if c.Symbol != "" {
+		b.WriteString(c.Symbol)
+		b.WriteByte(' ')
+	}
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	if frac != "" {
+		b.WriteByte('.')
+		b.WriteString(frac)
+	}
+	return b.String()
+}
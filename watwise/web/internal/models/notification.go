@@ -0,0 +1,95 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Alert severities, lowest first
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Severities lists every severity, lowest first
+var Severities = []string{SeverityInfo, SeverityWarning, SeverityCritical}
+
+// alertSeverities: alert_type -> severity of alerts raised without one
+// (and of alerts stored before severities); types not listed are warnings
+var alertSeverities = map[string]string{
+	"offline":             SeverityCritical,
+	"low_power_factor":    SeverityInfo,
+	"frequency_deviation": SeverityInfo,
+}
+
+// AlertSeverity returns the default severity of an alert type
+func AlertSeverity(alertType string) string {
+	if severity, ok := alertSeverities[alertType]; ok {
+		return severity
+	}
+	return SeverityWarning
+}
+
+// SeverityOrDefault is Severity, or AlertSeverity of the type when unset
+func (a AlertData) SeverityOrDefault() string {
+	if a.Severity != "" {
+		return a.Severity
+	}
+	return AlertSeverity(a.AlertType)
+}
+
+// SeverityAtLeast reports whether severity is min or higher; an unknown min
+// lets everything through
+func SeverityAtLeast(severity, min string) bool {
+	return slices.Index(Severities, severity) >= slices.Index(Severities, min)
+}
+
+// Notification kinds
+const (
+	NotificationAlert  = "alert"
+	NotificationDigest = "digest" // alerts collapsed by the rate limit
+	NotificationTest   = "test"
+)
+
+// Notification is one message to a channel: a single alert, a digest of
+// several or a test. Webhooks receive it as the JSON body.
+type Notification struct {
+	Kind    string      `json:"kind"`
+	Subject string      `json:"subject"`
+	Text    string      `json:"text"`
+	Alerts  []AlertData `json:"alerts"`
+	Time    time.Time   `json:"time"`
+}
+
+// NotificationFilter selects the alerts a channel receives; empty Types =
+// every type
+type NotificationFilter struct {
+	Types       []string `json:"types"`
+	MinSeverity string   `json:"min_severity"`
+}
+
+// Match reports whether alert passes the filter
+func (f NotificationFilter) Match(alert AlertData) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, alert.AlertType) {
+		return false
+	}
+	return SeverityAtLeast(alert.SeverityOrDefault(), f.MinSeverity)
+}
+
+// NotificationResult: one channel's outcome of POST /api/admin/notifications/test
+type NotificationResult struct {
+	Channel string `json:"channel"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DeadLetter is a notification given up on after every retry failed, kept in
+// data/notifications_dead.jsonl
+type DeadLetter struct {
+	Time         time.Time    `json:"time"`
+	Channel      string       `json:"channel"`
+	Attempts     int          `json:"attempts"`
+	Error        string       `json:"error"`
+	Notification Notification `json:"notification"`
+}
@@ -0,0 +1,37 @@
+package models
+
+// PredictionPoint is the forecast consumption (kWh) for the hour starting at Timestamp
+type PredictionPoint struct {
+	Timestamp    int64   `json:"timestamp"` // Unix millisecond, awal jam
+	PredictedKWh float64 `json:"predicted_kwh"`
+}
+
+// PredictionComparison puts a past hour's forecast next to what was consumed.
+// PredictedKWh is nil when no forecast was stored for that hour.
+type PredictionComparison struct {
+	Timestamp    int64    `json:"timestamp"`
+	PredictedKWh *float64 `json:"predicted_kwh"`
+	ActualKWh    float64  `json:"actual_kwh"`
+}
+
+// PredictionResponse untuk GET /api/energy/prediction
+type PredictionResponse struct {
+	DeviceID          string                 `json:"device_id"`
+	Hours             int                    `json:"hours"`
+	Forecast          []PredictionPoint      `json:"forecast"`
+	TotalPredictedKWh float64                `json:"total_predicted_kwh"`
+	Actuals           []PredictionComparison `json:"actuals"` // the same number of hours before now
+	TotalActualKWh    float64                `json:"total_actual_kwh"`
+}
+
+// ForecastSummary is broadcast over WebSocket after the forecast is recomputed
+type ForecastSummary struct {
+	Type          string  `json:"type"` // "forecast"
+	DeviceID      string  `json:"device_id"`
+	Hours         int     `json:"hours"`
+	TotalKWh      float64 `json:"total_kwh"`
+	EstimatedCost float64 `json:"estimated_cost"`
+	PeakHour      int64   `json:"peak_hour"` // Unix millisecond
+	PeakKWh       float64 `json:"peak_kwh"`
+	GeneratedAt   int64   `json:"generated_at"`
+}
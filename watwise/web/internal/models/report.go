@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// MonthlyReport is everything GET /api/reports/monthly renders, assembled
+// by services.ReportService
+type MonthlyReport struct {
+	DeviceID    string    `json:"device_id"`
+	DeviceName  string    `json:"device_name"`
+	Month       string    `json:"month"` // 2025-01
+	Timezone    string    `json:"timezone"`
+	GeneratedAt time.Time `json:"generated_at"`
+
+	TotalEnergy    float64 `json:"total_energy"` // kWh
+	AvgDailyEnergy float64 `json:"avg_daily_energy"`
+	TotalCost      Money   `json:"total_cost"`
+	// Days with readings; the daily average is over these
+	DaysWithData int `json:"days_with_data"`
+
+	CarbonKg       float64 `json:"carbon_kg"`
+	CarbonKgPerKWh float64 `json:"carbon_kg_per_kwh"`
+
+	StandbyPower  float64 `json:"standby_power"` // W
+	StandbyEnergy float64 `json:"standby_energy"`
+
+	// Nil when no demand window had enough readings
+	PeakDemand          *DemandWindow `json:"peak_demand"`
+	DemandWindowMinutes int           `json:"demand_window_minutes"`
+
+	Daily      []*DailySummary `json:"daily"`
+	CostBlocks []CostBlock     `json:"cost_blocks"` // time-of-use split
+}
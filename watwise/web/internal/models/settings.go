@@ -0,0 +1,43 @@
+package models
+
+// RuntimeSettings are the settings that can change without a restart: from
+// .env on SIGHUP, or PUT /api/admin/settings (persisted as overrides)
+type RuntimeSettings struct {
+	LogLevel string `json:"log_level"` // debug, info, warn, error
+
+	TariffPerKWh        float64 `json:"tariff_per_kwh"`
+	TariffPeakPerKWh    float64 `json:"tariff_peak_per_kwh"` // 0 = flat rate
+	TariffPeakStartHour int     `json:"tariff_peak_start_hour"`
+	TariffPeakEndHour   int     `json:"tariff_peak_end_hour"`
+
+	// Default alert bounds; device overrides still apply on top
+	AlertMaxPower          float64 `json:"alert_max_power"`
+	AlertMaxCurrent        float64 `json:"alert_max_current"`
+	AlertMinVoltage        float64 `json:"alert_min_voltage"`
+	AlertMaxVoltage        float64 `json:"alert_max_voltage"`
+	AlertMinPowerFactor    float64 `json:"alert_min_power_factor"`
+	AlertMinFrequency      float64 `json:"alert_min_frequency"`
+	AlertMaxFrequency      float64 `json:"alert_max_frequency"`
+	AlertSustainedReadings int     `json:"alert_sustained_readings"`
+
+	ThresholdAlerts bool `json:"threshold_alerts"`
+	QualityAlerts   bool `json:"quality_alerts"`
+	AnomalyAlerts   bool `json:"anomaly_alerts"`
+	BudgetAlerts    bool `json:"budget_alerts"`
+}
+
+// SettingChange is one setting that changed, by its JSON name
+type SettingChange struct {
+	Key string      `json:"key"`
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// SettingsChangedEvent is broadcast over WebSocket/SSE after settings changed
+type SettingsChangedEvent struct {
+	Type      string          `json:"type"`   // "settings_changed"
+	Source    string          `json:"source"` // api, reload
+	By        string          `json:"by,omitempty"`
+	Changes   []SettingChange `json:"changes"`
+	Timestamp int64           `json:"timestamp"`
+}
@@ -0,0 +1,270 @@
+package models
+
+import "time"
+
+// DeviceRealtimeStats adalah statistik satu device dalam window
+type DeviceRealtimeStats struct {
+	DeviceID     string     `json:"device_id"`
+	Name         string     `json:"name"`
+	Online       bool       `json:"online"`
+	LastSeen     *time.Time `json:"last_seen,omitempty"`
+	CurrentPower float64    `json:"current_power"` // W, 0 when offline
+	EnergyKWh    float64    `json:"energy_kwh"`    // consumed within the window
+	Cost         float64    `json:"cost"`
+	CostMoney    Money      `json:"cost_money"`
+	HasData      bool       `json:"has_data"` // false: no readings in the window
+
+	// Highest demand window since local midnight, from live MQTT readings
+	PeakDemandToday *DemandWindow `json:"peak_demand_today,omitempty"`
+}
+
+// RealtimeStats adalah ringkasan semua device untuk /api/energy/realtime-stats
+type RealtimeStats struct {
+	Window string    `json:"window"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+
+	TotalDevices  int     `json:"total_devices"`
+	OnlineDevices int     `json:"online_devices"`
+	TotalPower    float64 `json:"total_power"`    // W, online devices only
+	TotalEnergy   float64 `json:"total_energy"`   // kWh within the window
+	EstimatedCost float64 `json:"estimated_cost"` // cost of TotalEnergy
+	// EstimatedDailyCost extrapolates the window's consumption to 24h
+	EstimatedDailyCost float64 `json:"estimated_daily_cost"`
+
+	EstimatedCostMoney      Money `json:"estimated_cost_money"`
+	EstimatedDailyCostMoney Money `json:"estimated_daily_cost_money"`
+
+	Devices []DeviceRealtimeStats `json:"devices"`
+}
+
+// DeviceSeries adalah series teragregasi satu device untuk perbandingan
+type DeviceSeries struct {
+	DeviceID string               `json:"device_id"`
+	Data     []FilteredEnergyData `json:"data"` // one entry per bucket, zeros when empty
+}
+
+// DeviceRanking adalah total satu device dalam periode perbandingan
+type DeviceRanking struct {
+	Rank      int     `json:"rank"` // 1 = highest kWh
+	DeviceID  string  `json:"device_id"`
+	TotalKWh  float64 `json:"total_kwh"`
+	Cost      float64 `json:"cost"`
+	CostMoney Money   `json:"cost_money"`
+}
+
+// DeviceComparison untuk GET /api/energy/compare?device_ids=...
+type DeviceComparison struct {
+	Granularity string          `json:"granularity"`
+	StartDate   string          `json:"start_date"`
+	EndDate     string          `json:"end_date"`
+	Buckets     []string        `json:"buckets"`
+	Series      []DeviceSeries  `json:"series"`
+	Totals      []DeviceRanking `json:"totals"`
+}
+
+// PowerStats adalah distribusi power (W) dalam satu range, untuk
+// /api/energy/stats. All values are 0 when Count is 0.
+//
+// Percentiles use linear interpolation between the two closest ranks of the
+// sorted readings (p = (n-1)·q); Median is the 50th percentile. StdDev is the
+// population standard deviation.
+type PowerStats struct {
+	DeviceID string    `json:"device_id"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Count    int       `json:"count"`
+
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	P95    float64 `json:"p95"`
+	P99    float64 `json:"p99"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	StdDev float64 `json:"stddev"`
+}
+
+// PowerAnomalyReport is the response of GET /api/energy/anomalies. Each
+// reading is scored against the mean and population stddev of the Window
+// readings before it; the first Window readings of the range (WarmupPoints)
+// and readings after a flat window (stddev 0) have no z-score.
+type PowerAnomalyReport struct {
+	DeviceID  string    `json:"device_id"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Window    int       `json:"window"`
+	Threshold float64   `json:"threshold"` // |z| above this is an anomaly
+
+	Points       int  `json:"points"`        // readings in the range
+	WarmupPoints int  `json:"warmup_points"` // readings without a full window before them
+	Truncated    bool `json:"truncated"`     // more anomalies than returned
+
+	Anomalies []PowerAnomaly `json:"anomalies"`
+}
+
+// PowerAnomaly is one reading whose power is unusual for its window
+type PowerAnomaly struct {
+	Timestamp int64   `json:"timestamp"` // Unix ms
+	Power     float64 `json:"power"`
+	Mean      float64 `json:"mean"`
+	StdDev    float64 `json:"stddev"`
+	ZScore    float64 `json:"z_score"` // positive above the mean, negative below
+}
+
+// DataGapReport lists the data gaps of GET /api/energy/gaps: spacings
+// between consecutive readings above ExpectedInterval * Tolerance, and the
+// time after the last reading when it is that long (Open).
+type DataGapReport struct {
+	DeviceID                string    `json:"device_id"`
+	Start                   time.Time `json:"start"`
+	End                     time.Time `json:"end"`
+	ExpectedIntervalSeconds float64   `json:"expected_interval_seconds"`
+	Tolerance               float64   `json:"tolerance"`
+	ThresholdSeconds        float64   `json:"threshold_seconds"` // spacing above this is a gap
+
+	Points          int     `json:"points"` // readings in the range
+	GapCount        int     `json:"gap_count"`
+	TotalGapSeconds float64 `json:"total_gap_seconds"`
+	Truncated       bool    `json:"truncated"` // more gaps than returned
+
+	Gaps []DataGap `json:"gaps"`
+}
+
+// DataGap is a time without readings, from the reading before it to the
+// one after it
+type DataGap struct {
+	Start           int64   `json:"start"` // Unix ms
+	End             int64   `json:"end"`   // Unix ms
+	DurationSeconds float64 `json:"duration_seconds"`
+	MissedReadings  int     `json:"missed_readings"` // expected readings that never came
+	// No reading after it yet: End is the end of the range (or now)
+	Open bool `json:"open,omitempty"`
+}
+
+// HourlyRollup aggregates one device-hour of raw readings, stored under
+// root.wattwise_rollup.<device>.hourly
+type HourlyRollup struct {
+	Hour int64 `json:"hour"` // Unix ms of the start of the hour
+
+	PowerMin   float64 `json:"power_min"`
+	PowerAvg   float64 `json:"power_avg"`
+	PowerMax   float64 `json:"power_max"`
+	VoltageMin float64 `json:"voltage_min"`
+	VoltageAvg float64 `json:"voltage_avg"`
+	VoltageMax float64 `json:"voltage_max"`
+	CurrentMin float64 `json:"current_min"`
+	CurrentAvg float64 `json:"current_avg"`
+	CurrentMax float64 `json:"current_max"`
+
+	KWh     float64 `json:"kwh"`     // increase of the energy counter within the hour
+	Samples int64   `json:"samples"` // raw readings in the hour
+}
+
+// RollupBackfill is the result of POST /api/admin/rollup/backfill
+type RollupBackfill struct {
+	Devices []string  `json:"devices"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Status  string    `json:"status"` // "started"
+}
+
+// SchemaReport is the result of IoTDB.VerifySchema
+type SchemaReport struct {
+	OK        bool               `json:"ok"` // nothing is (still) missing
+	CheckedAt time.Time          `json:"checked_at"`
+	Devices   []DeviceSchemaDiff `json:"devices"`
+	// Single-device series (root.wattwise.power) moved to the default device
+	LegacyMoved []string `json:"legacy_moved,omitempty"`
+}
+
+// DeviceSchemaDiff lists the expected timeseries a device is missing
+type DeviceSchemaDiff struct {
+	DeviceID string   `json:"device_id"`
+	Missing  []string `json:"missing"`
+	Created  []string `json:"created,omitempty"` // repaired
+	Failed   []string `json:"failed,omitempty"`  // repair refused by IoTDB
+}
+
+// CostBlock is the consumption and cost of one time-of-use block
+// (services.BlockPeak or BlockOffPeak)
+type CostBlock struct {
+	Block      string  `json:"block"`
+	Hours      string  `json:"hours"` // e.g. "17:00-22:00"
+	RatePerKWh float64 `json:"rate_per_kwh"`
+	KWh        float64 `json:"kwh"`
+	Cost       float64 `json:"cost"`
+	CostMoney  Money   `json:"cost_money"`
+}
+
+// CostBreakdown splits the consumption of [Start, End) into time-of-use
+// blocks. Each reading's energy delta is counted in the block of the reading
+// that closes the interval.
+type CostBreakdown struct {
+	DeviceID  string      `json:"device_id"`
+	Start     time.Time   `json:"start"`
+	End       time.Time   `json:"end"`
+	Timezone  string      `json:"timezone"`
+	Blocks    []CostBlock `json:"blocks"`
+	TotalKWh  float64     `json:"total_kwh"`
+	TotalCost float64     `json:"total_cost"`
+
+	TotalCostMoney Money `json:"total_cost_money"`
+}
+
+// StandbyNight is one night window of a standby report. Nights with fewer
+// readings than the minimum are excluded from the figure.
+type StandbyNight struct {
+	Date         string    `json:"date"` // day the window starts
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	Samples      int       `json:"samples"`
+	StandbyPower float64   `json:"standby_power"` // W, 5th percentile of this night
+	Excluded     bool      `json:"excluded"`
+	Reason       string    `json:"reason,omitempty"`
+}
+
+// StandbyReport estimates the always-on (phantom) load: the 5th percentile of
+// power over the night windows, when "nothing" is on
+type StandbyReport struct {
+	DeviceID        string `json:"device_id"`
+	Days            int    `json:"days"`
+	WindowStartHour int    `json:"window_start_hour"`
+	WindowEndHour   int    `json:"window_end_hour"`
+	MinSamples      int    `json:"min_samples"` // per night
+
+	StandbyPower float64 `json:"standby_power"` // W, 0 when no night qualified
+	Samples      int     `json:"samples"`
+	NightsUsed   int     `json:"nights_used"`
+
+	// Standby running for a 30-day month
+	MonthlyKWh       float64 `json:"monthly_kwh"`
+	MonthlyCost      float64 `json:"monthly_cost"`
+	MonthlyCostMoney Money   `json:"monthly_cost_money"`
+
+	Nights []StandbyNight `json:"nights"`
+}
+
+// DemandWindow is the average power over one demand window
+type DemandWindow struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	AverageKW float64   `json:"average_kw"`
+	Samples   int       `json:"samples"`
+	Coverage  float64   `json:"coverage"` // 0-1, share of the window with readings
+}
+
+// PeakDemandReport: GET /api/energy/peak-demand. Peak is nil when no window
+// had enough readings.
+type PeakDemandReport struct {
+	DeviceID      string    `json:"device_id"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	WindowMinutes int       `json:"window_minutes"`
+	MinCoverage   float64   `json:"min_coverage"`
+
+	Peak *DemandWindow `json:"peak"`
+	// Highest non-overlapping windows, highest first
+	TopWindows []DemandWindow `json:"top_windows"`
+	// Windows skipped for missing readings
+	WindowsExcluded int `json:"windows_excluded"`
+}
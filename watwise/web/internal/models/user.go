@@ -1,9 +1,31 @@
 package models
 
+// Roles: admin boleh menulis data, mengontrol device dan memakai
+// /api/admin; viewer hanya membaca
+const (
+	RoleAdmin  = "admin"
+	RoleViewer = "viewer"
+)
+
+// ValidRole reports whether role is RoleAdmin or RoleViewer
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleViewer
+}
+
 type User struct {
 	ID       int    `json:"id"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
+	Role     string `json:"role"`
+}
+
+// UserInput is the body of POST/PUT /api/admin/users. On update empty fields
+// keep their current value.
+type UserInput struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
 }
 
 type LoginRequest struct {
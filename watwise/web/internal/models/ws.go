@@ -0,0 +1,104 @@
+package models
+
+import "time"
+
+// Frame types of WSMessage
+const (
+	WSTypeReading         = "reading"
+	WSTypeReadingBatch    = "reading_batch" // data: []RealtimeData
+	WSTypeAlert           = "alert"
+	WSTypeDeviceStatus    = "device_status"
+	WSTypeForecast        = "forecast"
+	WSTypeSettingsChanged = "settings_changed"
+	WSTypeSystem          = "system"
+	WSTypeHistory         = "history"
+	WSTypeConnected       = "connected"
+	WSTypeError           = "error"
+)
+
+// WSMessage is the envelope of every WebSocket frame, so clients switch on
+// type instead of sniffing fields:
+// {"type":"reading","ts":1735689600000,"data":{...}}
+type WSMessage struct {
+	Type string      `json:"type"`
+	TS   int64       `json:"ts"` // Unix millisecond the frame was created
+	Data interface{} `json:"data"`
+}
+
+// WSHistory is the data of a "history" frame: the readings sent on connect
+// (no range) or for a "history" command
+type WSHistory struct {
+	DeviceID string       `json:"device_id"`
+	Start    int64        `json:"start,omitempty"` // unix ms
+	End      int64        `json:"end,omitempty"`
+	Readings []EnergyData `json:"readings"` // oldest first
+}
+
+// WSWelcome is the data of the "connected" frame
+type WSWelcome struct {
+	Message string `json:"message"`
+	Server  string `json:"server"`
+	Time    string `json:"time"` // RFC 3339
+}
+
+// SystemNotice is the data of a "system" frame, e.g. when IoTDB disconnects
+// and readings come from generated dummy data until it is back
+type SystemNotice struct {
+	Event      string `json:"event"`       // data_source_changed
+	Mode       string `json:"mode"`        // connected, dummy, reconnecting
+	DataSource string `json:"data_source"` // iotdb, dummy or none (DUMMY_MODE=off)
+	Message    string `json:"message"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+// NewDataSourceNotice describes an IoTDB mode change; dummyData tells
+// whether queries now answer with generated readings
+func NewDataSourceNotice(mode string, dummyData bool) SystemNotice {
+	notice := SystemNotice{Event: "data_source_changed", Mode: mode, Timestamp: time.Now().UnixMilli()}
+	switch {
+	case mode == "connected":
+		notice.DataSource = "iotdb"
+		notice.Message = "IoTDB connected, showing measured data"
+	case dummyData:
+		notice.DataSource = "dummy"
+		notice.Message = "IoTDB not connected, showing generated dummy data"
+	default:
+		notice.DataSource = "none"
+		notice.Message = "IoTDB not connected, data unavailable"
+	}
+	return notice
+}
+
+// WSError is the data of an "error" frame answering a client command
+type WSError struct {
+	Action  string `json:"action"`
+	Message string `json:"message"`
+}
+
+// NewWSMessage wraps data in an envelope stamped with the current time
+func NewWSMessage(msgType string, data interface{}) WSMessage {
+	return WSMessage{Type: msgType, TS: time.Now().UnixMilli(), Data: data}
+}
+
+func NewReadingMessage(data RealtimeData) WSMessage {
+	return NewWSMessage(WSTypeReading, data)
+}
+
+func NewReadingBatchMessage(data []RealtimeData) WSMessage {
+	return NewWSMessage(WSTypeReadingBatch, data)
+}
+
+func NewAlertMessage(alert AlertData) WSMessage {
+	return NewWSMessage(WSTypeAlert, alert)
+}
+
+func NewHistoryMessage(history WSHistory) WSMessage {
+	if history.Readings == nil {
+		history.Readings = []EnergyData{}
+	}
+	return NewWSMessage(WSTypeHistory, history)
+}
+
+func NewErrorMessage(action, message string) WSMessage {
+	return NewWSMessage(WSTypeError, WSError{Action: action, Message: message})
+}
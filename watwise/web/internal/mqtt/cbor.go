@@ -0,0 +1,348 @@
+package mqtt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Minimal CBOR (RFC 8949) for device payloads: maps, arrays, strings,
+// integers, floats, booleans and null. Tags are skipped, byte strings are
+// read as strings. Values decode like encoding/json into interface{}:
+// map[string]interface{}, []interface{}, string, int64/uint64, float64,
+// bool, nil.
+
+var errTruncated = errors.New("payload truncated")
+
+const cborBreak = 0xff
+
+type cborDecoder struct {
+	b     []byte
+	pos   int
+	depth int
+}
+
+func decodeCBOR(b []byte) (interface{}, error) {
+	d := &cborDecoder{b: b}
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(b) {
+		return nil, fmt.Errorf("%d trailing bytes after CBOR value", len(b)-d.pos)
+	}
+	return v, nil
+}
+
+func (d *cborDecoder) readByte() (byte, error) {
+	if d.pos >= len(d.b) {
+		return 0, errTruncated
+	}
+	c := d.b[d.pos]
+	d.pos++
+	return c, nil
+}
+
+func (d *cborDecoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.b)-d.pos) {
+		return nil, errTruncated
+	}
+	b := d.b[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// argument reads the length/value that follows the initial byte;
+// indefinite is true for additional info 31
+func (d *cborDecoder) argument(info byte) (n uint64, indefinite bool, err error) {
+	switch {
+	case info < 24:
+		return uint64(info), false, nil
+	case info == 31:
+		return 0, true, nil
+	case info > 27:
+		return 0, false, fmt.Errorf("invalid CBOR additional info %d", info)
+	}
+	b, err := d.read(1 << (info - 24))
+	if err != nil {
+		return 0, false, err
+	}
+	switch len(b) {
+	case 1:
+		return uint64(b[0]), false, nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), false, nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), false, nil
+	}
+	return binary.BigEndian.Uint64(b), false, nil
+}
+
+func (d *cborDecoder) value() (interface{}, error) {
+	if d.depth > maxPayloadDepth {
+		return nil, errors.New("payload nested too deeply")
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+
+	initial, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	major, info := initial>>5, initial&0x1f
+
+	if major == 7 {
+		return d.simple(info)
+	}
+
+	n, indefinite, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case 1:
+		if n > math.MaxInt64 {
+			return nil, errors.New("CBOR negative integer out of range")
+		}
+		return -1 - int64(n), nil
+	case 2, 3:
+		return d.text(major, n, indefinite)
+	case 4:
+		return d.array(n, indefinite)
+	case 5:
+		return d.object(n, indefinite)
+	}
+	// major 6: tag, nilainya langsung dipakai
+	return d.value()
+}
+
+func (d *cborDecoder) simple(info byte) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		b, err := d.read(2)
+		if err != nil {
+			return nil, err
+		}
+		return float16(binary.BigEndian.Uint16(b)), nil
+	case 26:
+		b, err := d.read(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case 27:
+		b, err := d.read(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	}
+	return nil, fmt.Errorf("unsupported CBOR simple value %d", info)
+}
+
+func (d *cborDecoder) text(major byte, n uint64, indefinite bool) (interface{}, error) {
+	if !indefinite {
+		b, err := d.read(n)
+		return string(b), err
+	}
+
+	// Indefinite: potongan dengan major type yang sama sampai break
+	var s []byte
+	for {
+		if d.pos < len(d.b) && d.b[d.pos] == cborBreak {
+			d.pos++
+			return string(s), nil
+		}
+		initial, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		if initial>>5 != major {
+			return nil, errors.New("invalid chunk in indefinite CBOR string")
+		}
+		n, indefinite, err := d.argument(initial & 0x1f)
+		if err != nil {
+			return nil, err
+		}
+		if indefinite {
+			return nil, errors.New("nested indefinite CBOR string")
+		}
+		chunk, err := d.read(n)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, chunk...)
+	}
+}
+
+// more reports whether another item follows: up to n items, or until the
+// break byte of an indefinite container
+func (d *cborDecoder) more(i int, n uint64, indefinite bool) (bool, error) {
+	if !indefinite {
+		return uint64(i) < n, nil
+	}
+	if d.pos >= len(d.b) {
+		return false, errTruncated
+	}
+	if d.b[d.pos] == cborBreak {
+		d.pos++
+		return false, nil
+	}
+	return true, nil
+}
+
+func (d *cborDecoder) array(n uint64, indefinite bool) (interface{}, error) {
+	if !indefinite && n > uint64(len(d.b)-d.pos) {
+		return nil, errTruncated
+	}
+	list := []interface{}{}
+	for i := 0; ; i++ {
+		more, err := d.more(i, n, indefinite)
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			return list, nil
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+}
+
+func (d *cborDecoder) object(n uint64, indefinite bool) (interface{}, error) {
+	if !indefinite && n > uint64(len(d.b)-d.pos) {
+		return nil, errTruncated
+	}
+	m := make(map[string]interface{})
+	for i := 0; ; i++ {
+		more, err := d.more(i, n, indefinite)
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			return m, nil
+		}
+		key, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		m[fmt.Sprint(key)] = v
+	}
+}
+
+// float16 converts an IEEE 754 half-precision value
+func float16(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac == 0 {
+			return math.Inf(int(sign))
+		}
+		return math.NaN()
+	}
+	return sign * math.Ldexp(frac+1024, exp-25)
+}
+
+func encodeCBOR(v interface{}) ([]byte, error) {
+	var buf []byte
+	return appendCBOR(buf, v)
+}
+
+func appendCBORHead(buf []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(buf, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(buf, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, major|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, major|27), n)
+}
+
+func appendCBOR(buf []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(buf, 0xf6), nil
+	case bool:
+		if v {
+			return append(buf, 0xf5), nil
+		}
+		return append(buf, 0xf4), nil
+	case int64:
+		if v < 0 {
+			return appendCBORHead(buf, 1, uint64(-1-v)), nil
+		}
+		return appendCBORHead(buf, 0, uint64(v)), nil
+	case uint64:
+		return appendCBORHead(buf, 0, v), nil
+	case float64:
+		if f := float32(v); float64(f) == v {
+			return binary.BigEndian.AppendUint32(append(buf, 0xfa), math.Float32bits(f)), nil
+		}
+		return binary.BigEndian.AppendUint64(append(buf, 0xfb), math.Float64bits(v)), nil
+	case string:
+		return append(appendCBORHead(buf, 3, uint64(len(v))), v...), nil
+	case []interface{}:
+		buf = appendCBORHead(buf, 4, uint64(len(v)))
+		for _, item := range v {
+			var err error
+			if buf, err = appendCBOR(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]interface{}:
+		buf = appendCBORHead(buf, 5, uint64(len(v)))
+		for _, key := range sortedKeys(v) {
+			buf = append(appendCBORHead(buf, 3, uint64(len(key))), key...)
+			var err error
+			if buf, err = appendCBOR(buf, v[key]); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	return nil, fmt.Errorf("cannot encode %T as CBOR", v)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
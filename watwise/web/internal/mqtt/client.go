@@ -12,6 +12,8 @@ type Client struct {
 	client   mqtt.Client
 	broker   string
 	clientID string
+	username string
+	password string
 }
 
 // NewClient creates a new MQTT client
@@ -22,13 +24,19 @@ func NewClient(broker, clientID string) *Client {
 	}
 }
 
+// SetCredentials sets username/password used by Connect
+func (c *Client) SetCredentials(username, password string) {
+	c.username = username
+	c.password = password
+}
+
 // Connect establishes connection to MQTT broker
 func (c *Client) Connect() error {
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(c.broker)
 	opts.SetClientID(c.clientID)
-	opts.SetUsername("") // Add username if needed
-	opts.SetPassword("") // Add password if needed
+	opts.SetUsername(c.username)
+	opts.SetPassword(c.password)
 	opts.SetKeepAlive(60 * time.Second)
 	opts.SetPingTimeout(10 * time.Second)
 	opts.SetAutoReconnect(true)
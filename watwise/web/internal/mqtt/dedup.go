@@ -0,0 +1,78 @@
+package mqtt
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+	"wattwise/internal/models"
+)
+
+// dedupCache remembers recently seen readings so republished messages (e.g.
+// after an MQTT reconnect) are not stored twice. Small LRU: the oldest key is
+// evicted when full, and keys older than window count as unseen.
+type dedupCache struct {
+	mu      sync.Mutex
+	window  time.Duration
+	size    int
+	order   *list.List // front = most recent
+	entries map[string]*list.Element
+}
+
+type dedupEntry struct {
+	key    string
+	seenAt time.Time
+}
+
+func newDedupCache(window time.Duration, size int) *dedupCache {
+	if size <= 0 {
+		size = 1024
+	}
+	return &dedupCache{
+		window:  window,
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// seen records key and reports whether it was already seen within the window
+func (c *dedupCache) seen(key string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*dedupEntry)
+		if now.Sub(entry.seenAt) < c.window {
+			return true
+		}
+		entry.seenAt = now
+		c.order.MoveToFront(el)
+		return false
+	}
+
+	c.entries[key] = c.order.PushFront(&dedupEntry{key: key, seenAt: now})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*dedupEntry).key)
+	}
+	return false
+}
+
+// dedupKey identifies a reading by (device, device timestamp). ESP32 firmware
+// without a clock sends no timestamp; the raw payload is hashed instead: a
+// redelivery is byte-identical, a new reading is not. Uptime is not a key,
+// it has second granularity and restarts from 0 after a reboot.
+func dedupKey(msg *models.MQTTMessage, payload []byte) string {
+	switch {
+	case msg.Timestamp > 0:
+		return fmt.Sprintf("%s|%d", msg.DeviceID, msg.Timestamp)
+	case len(payload) > 0:
+		sum := sha256.Sum256(payload)
+		return fmt.Sprintf("%s|sha256:%s", msg.DeviceID, hex.EncodeToString(sum[:16]))
+	}
+	return ""
+}
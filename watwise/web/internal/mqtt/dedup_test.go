@@ -0,0 +1,81 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+	"wattwise/internal/database"
+)
+
+func TestDedupReplayStoresOnce(t *testing.T) {
+	tests := []struct {
+		name     string
+		payloads []string
+		inserts  int64
+	}{
+		{"redelivered with device timestamp", []string{
+			`{"device_id":"A","timestamp":1735689600000,"voltage":220,"current":1,"power":220,"energy":1.5}`,
+			`{"device_id":"A","timestamp":1735689600000,"voltage":220,"current":1,"power":220,"energy":1.5}`,
+			`{"device_id":"A","timestamp":1735689600000,"voltage":220,"current":1,"power":220,"energy":1.5}`,
+		}, 1},
+		{"redelivered without timestamp", []string{
+			`{"device_id":"A","voltage":220,"current":1,"power":220,"energy":1.5,"uptime":42}`,
+			`{"device_id":"A","voltage":220,"current":1,"power":220,"energy":1.5,"uptime":42}`,
+			`{"device_id":"A","voltage":220,"current":1,"power":220,"energy":1.5,"uptime":42}`,
+		}, 1},
+		// Uptime per detik: dua reading dalam detik yang sama bukan duplikat
+		{"new readings within the same uptime second", []string{
+			`{"device_id":"A","voltage":220,"current":1,"power":220,"energy":1.5,"uptime":42}`,
+			`{"device_id":"A","voltage":221,"current":1.1,"power":243,"energy":1.5,"uptime":42}`,
+		}, 2},
+		{"same uptime after a reboot", []string{
+			`{"device_id":"A","voltage":220,"current":1,"power":220,"energy":1.5,"uptime":5}`,
+			`{"device_id":"A","voltage":220,"current":2,"power":440,"energy":3.2,"uptime":5}`,
+		}, 2},
+		{"same payload from two devices", []string{
+			`{"device_id":"A","voltage":220,"current":1,"power":220,"energy":1.5}`,
+			`{"device_id":"B","voltage":220,"current":1,"power":220,"energy":1.5}`,
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &countingStore{MemoryStore: database.NewMemoryStore()}
+			s, broadcaster := newTestSubscriber(t, store)
+			s.EnableDedup(5*time.Minute, 0)
+
+			for _, payload := range tt.payloads {
+				s.handleEnergyMessage(nil, fakeMessage{topic: "esp32", payload: []byte(payload)})
+			}
+			if got := store.inserts.Load(); got != tt.inserts {
+				t.Errorf("inserts = %d, want %d", got, tt.inserts)
+			}
+			if got := broadcaster.readingCount(); int64(got) != tt.inserts {
+				t.Errorf("broadcasts = %d, want %d", got, tt.inserts)
+			}
+			if got := s.duplicatesDropped.Load(); got != uint64(len(tt.payloads))-uint64(tt.inserts) {
+				t.Errorf("duplicates dropped = %d, want %d", got, int64(len(tt.payloads))-tt.inserts)
+			}
+		})
+	}
+}
+
+func TestDedupWindowExpires(t *testing.T) {
+	cache := newDedupCache(time.Minute, 2)
+	now := time.Now()
+
+	if cache.seen("a", now) {
+		t.Fatal("first sighting reported as seen")
+	}
+	if !cache.seen("a", now.Add(30*time.Second)) {
+		t.Error("repeat within the window not reported")
+	}
+	if cache.seen("a", now.Add(2*time.Minute)) {
+		t.Error("repeat after the window reported as seen")
+	}
+
+	// LRU: "a" terdesak oleh dua key baru
+	cache.seen("b", now)
+	cache.seen("c", now)
+	if cache.seen("a", now) {
+		t.Error("evicted key reported as seen")
+	}
+}
@@ -0,0 +1,86 @@
+package mqtt
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"wattwise/internal/database"
+	"wattwise/internal/models"
+	"wattwise/internal/repositories"
+	"wattwise/internal/services"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// fakeMessage is an mqtt.Message as the broker delivers it
+type fakeMessage struct {
+	topic   string
+	payload []byte
+}
+
+func (m fakeMessage) Duplicate() bool   { return false }
+func (m fakeMessage) Qos() byte         { return 1 }
+func (m fakeMessage) Retained() bool    { return false }
+func (m fakeMessage) Topic() string     { return m.topic }
+func (m fakeMessage) MessageID() uint16 { return 0 }
+func (m fakeMessage) Payload() []byte   { return m.payload }
+func (m fakeMessage) Ack()              {}
+
+// countingStore is a MemoryStore that counts InsertData calls; the
+// MemoryStore itself keeps one reading per timestamp
+type countingStore struct {
+	*database.MemoryStore
+	inserts atomic.Int64
+}
+
+func (s *countingStore) InsertData(ctx context.Context, deviceID string, data models.EnergyData) error {
+	s.inserts.Add(1)
+	return s.MemoryStore.InsertData(ctx, deviceID, data)
+}
+
+// fakeBroadcaster records what the subscriber publishes
+type fakeBroadcaster struct {
+	mu       sync.Mutex
+	readings []models.RealtimeData
+	alerts   []models.AlertData
+}
+
+func (b *fakeBroadcaster) BroadcastRealtimeData(data models.RealtimeData) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.readings = append(b.readings, data)
+}
+
+func (b *fakeBroadcaster) BroadcastAlert(alert models.AlertData) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.alerts = append(b.alerts, alert)
+}
+
+func (b *fakeBroadcaster) BroadcastDeviceStatus(event models.DeviceStatusEvent) {}
+
+func (b *fakeBroadcaster) readingCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.readings)
+}
+
+// newTestSubscriber is a Subscriber without an MQTT client, storing into
+// store and publishing to the returned broadcaster
+func newTestSubscriber(t *testing.T, store database.Store) (*Subscriber, *fakeBroadcaster) {
+	t.Helper()
+	repo, err := repositories.NewDeviceRepository("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	energy := services.NewEnergyService(store, services.NewTariffService(1444.70), discardLogger())
+	s := NewSubscriber(nil, energy, services.NewDeviceService(repo, discardLogger()), discardLogger())
+	broadcaster := &fakeBroadcaster{}
+	s.SetBroadcaster(broadcaster)
+	t.Cleanup(s.Stop)
+	return s, broadcaster
+}
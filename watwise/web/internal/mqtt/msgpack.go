@@ -0,0 +1,271 @@
+package mqtt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Minimal MessagePack for device payloads, decoding to the same values as
+// decodeCBOR. Ext types are not supported, bin is read as a string.
+
+type msgpackDecoder struct {
+	b     []byte
+	pos   int
+	depth int
+}
+
+func decodeMsgpack(b []byte) (interface{}, error) {
+	d := &msgpackDecoder{b: b}
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(b) {
+		return nil, fmt.Errorf("%d trailing bytes after MessagePack value", len(b)-d.pos)
+	}
+	return v, nil
+}
+
+func (d *msgpackDecoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.b)-d.pos) {
+		return nil, errTruncated
+	}
+	b := d.b[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// uint reads a big-endian unsigned integer of size bytes
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	b, err := d.read(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func (d *msgpackDecoder) value() (interface{}, error) {
+	if d.depth > maxPayloadDepth {
+		return nil, errors.New("payload nested too deeply")
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+
+	b, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.object(uint64(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return d.array(uint64(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return d.text(uint64(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xd9:
+		return d.sizedText(1)
+	case 0xc5, 0xda:
+		return d.sizedText(2)
+	case 0xc6, 0xdb:
+		return d.sizedText(4)
+	case 0xca:
+		n, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := d.uint(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := d.uint(1 << (c - 0xcc))
+		if err != nil || n > math.MaxInt64 {
+			return n, err
+		}
+		return int64(n), nil
+	case 0xd0:
+		n, err := d.uint(1)
+		return int64(int8(n)), err
+	case 0xd1:
+		n, err := d.uint(2)
+		return int64(int16(n)), err
+	case 0xd2:
+		n, err := d.uint(4)
+		return int64(int32(n)), err
+	case 0xd3:
+		n, err := d.uint(8)
+		return int64(n), err
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(n)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.object(n)
+	}
+	return nil, fmt.Errorf("unsupported MessagePack type 0x%02x", c)
+}
+
+func (d *msgpackDecoder) sizedText(size int) (interface{}, error) {
+	n, err := d.uint(size)
+	if err != nil {
+		return nil, err
+	}
+	return d.text(n)
+}
+
+func (d *msgpackDecoder) text(n uint64) (interface{}, error) {
+	b, err := d.read(n)
+	return string(b), err
+}
+
+func (d *msgpackDecoder) array(n uint64) (interface{}, error) {
+	if n > uint64(len(d.b)-d.pos) {
+		return nil, errTruncated
+	}
+	list := make([]interface{}, 0, n)
+	for i := uint64(0); i < n; i++ {
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+func (d *msgpackDecoder) object(n uint64) (interface{}, error) {
+	if n > uint64(len(d.b)-d.pos) {
+		return nil, errTruncated
+	}
+	m := make(map[string]interface{}, n)
+	for i := uint64(0); i < n; i++ {
+		key, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		m[fmt.Sprint(key)] = v
+	}
+	return m, nil
+}
+
+func encodeMsgpack(v interface{}) ([]byte, error) {
+	var buf []byte
+	return appendMsgpack(buf, v)
+}
+
+func appendMsgpackLength(buf []byte, n int, fix, base byte, fixMax int) []byte {
+	switch {
+	case n <= fixMax:
+		return append(buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, base), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(buf, base+1), uint32(n))
+}
+
+func appendMsgpack(buf []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(buf, 0xc0), nil
+	case bool:
+		if v {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case int64:
+		switch {
+		case v >= 0:
+			return appendMsgpack(buf, uint64(v))
+		case v >= -32:
+			return append(buf, byte(int8(v))), nil
+		case v >= math.MinInt8:
+			return append(buf, 0xd0, byte(int8(v))), nil
+		case v >= math.MinInt16:
+			return binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(int16(v))), nil
+		case v >= math.MinInt32:
+			return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(int32(v))), nil
+		}
+		return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(v)), nil
+	case uint64:
+		switch {
+		case v <= 0x7f:
+			return append(buf, byte(v)), nil
+		case v <= math.MaxUint8:
+			return append(buf, 0xcc, byte(v)), nil
+		case v <= math.MaxUint16:
+			return binary.BigEndian.AppendUint16(append(buf, 0xcd), uint16(v)), nil
+		case v <= math.MaxUint32:
+			return binary.BigEndian.AppendUint32(append(buf, 0xce), uint32(v)), nil
+		}
+		return binary.BigEndian.AppendUint64(append(buf, 0xcf), v), nil
+	case float64:
+		if f := float32(v); float64(f) == v {
+			return binary.BigEndian.AppendUint32(append(buf, 0xca), math.Float32bits(f)), nil
+		}
+		return binary.BigEndian.AppendUint64(append(buf, 0xcb), math.Float64bits(v)), nil
+	case string:
+		switch {
+		case len(v) <= 31:
+			buf = append(buf, 0xa0|byte(len(v)))
+		case len(v) <= math.MaxUint8:
+			buf = append(buf, 0xd9, byte(len(v)))
+		default:
+			buf = appendMsgpackLength(buf, len(v), 0, 0xda, -1)
+		}
+		return append(buf, v...), nil
+	case []interface{}:
+		buf = appendMsgpackLength(buf, len(v), 0x90, 0xdc, 15)
+		for _, item := range v {
+			var err error
+			if buf, err = appendMsgpack(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]interface{}:
+		buf = appendMsgpackLength(buf, len(v), 0x80, 0xde, 15)
+		for _, key := range sortedKeys(v) {
+			var err error
+			if buf, err = appendMsgpack(buf, key); err != nil {
+				return nil, err
+			}
+			if buf, err = appendMsgpack(buf, v[key]); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	return nil, fmt.Errorf("cannot encode %T as MessagePack", v)
+}
@@ -0,0 +1,165 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"wattwise/internal/models"
+)
+
+// PayloadDecoder turns a raw MQTT payload into a reading. The subscriber
+// picks one per topic, see Subscriber.RegisterPayloadDecoder.
+type PayloadDecoder interface {
+	Decode(payload []byte, msg *models.MQTTMessage) error
+}
+
+// PayloadDecoderFunc adapts a function to PayloadDecoder
+type PayloadDecoderFunc func(payload []byte, msg *models.MQTTMessage) error
+
+func (f PayloadDecoderFunc) Decode(payload []byte, msg *models.MQTTMessage) error {
+	return f(payload, msg)
+}
+
+// Payload formats for MQTT_PAYLOAD_FORMAT(S)
+const (
+	FormatAuto    = "auto"
+	FormatJSON    = "json"
+	FormatCBOR    = "cbor"
+	FormatMsgpack = "msgpack"
+)
+
+// Nesting limit of binary payloads; a reading is a flat map
+const maxPayloadDepth = 32
+
+var (
+	// JSONDecoder reads the ESP32 JSON payload
+	JSONDecoder PayloadDecoder = PayloadDecoderFunc(func(payload []byte, msg *models.MQTTMessage) error {
+		return json.Unmarshal(payload, msg)
+	})
+	// CBORDecoder reads a CBOR map with the same keys as the JSON payload
+	CBORDecoder PayloadDecoder = binaryDecoder(FormatCBOR, decodeCBOR)
+	// MsgpackDecoder reads a MessagePack map with the same keys as the JSON payload
+	MsgpackDecoder PayloadDecoder = binaryDecoder(FormatMsgpack, decodeMsgpack)
+	// AutoDecoder reads JSON when the payload starts with '{', otherwise
+	// tries CBOR and then MessagePack
+	AutoDecoder PayloadDecoder = PayloadDecoderFunc(decodeAuto)
+)
+
+// NewPayloadDecoder returns the built-in decoder for a format name
+func NewPayloadDecoder(format string) (PayloadDecoder, error) {
+	switch format {
+	case FormatAuto, "":
+		return AutoDecoder, nil
+	case FormatJSON:
+		return JSONDecoder, nil
+	case FormatCBOR:
+		return CBORDecoder, nil
+	case FormatMsgpack:
+		return MsgpackDecoder, nil
+	}
+	return nil, fmt.Errorf("unknown payload format %q, use: auto, json, cbor, msgpack", format)
+}
+
+func decodeAuto(payload []byte, msg *models.MQTTMessage) error {
+	if trimmed := bytes.TrimSpace(payload); len(trimmed) > 0 && trimmed[0] == '{' {
+		return JSONDecoder.Decode(payload, msg)
+	}
+
+	// Map MessagePack (0x80-0x8f) terbaca sebagai array di CBOR, map CBOR
+	// (0xa0-0xbf) sebagai string di MessagePack; binaryDecoder hanya
+	// menerima map yang habis dibaca, jadi format yang salah selalu gagal
+	cborErr := CBORDecoder.Decode(payload, msg)
+	if cborErr == nil {
+		return nil
+	}
+	*msg = models.MQTTMessage{}
+	msgpackErr := MsgpackDecoder.Decode(payload, msg)
+	if msgpackErr == nil {
+		return nil
+	}
+	return fmt.Errorf("payload is neither JSON, CBOR (%v) nor MessagePack (%v)", cborErr, msgpackErr)
+}
+
+// binaryDecoder decodes a generic map and maps it onto MQTTMessage through
+// its JSON tags, so aliases like "pf" and string timestamps work the same as
+// in JSON payloads
+func binaryDecoder(format string, decode func([]byte) (interface{}, error)) PayloadDecoder {
+	return PayloadDecoderFunc(func(payload []byte, msg *models.MQTTMessage) error {
+		value, err := decode(payload)
+		if err != nil {
+			return err
+		}
+		if _, ok := value.(map[string]interface{}); !ok {
+			return fmt.Errorf("%s payload is not a map", format)
+		}
+
+		b, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("%s payload: %w", format, err)
+		}
+		return json.Unmarshal(b, msg)
+	})
+}
+
+// EncodePayload encodes v (e.g. a models.MQTTMessage) in a payload format
+// using its JSON field names. Used by the device simulator.
+func EncodePayload(format string, v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatJSON, FormatAuto, "":
+		return b, nil
+	case FormatCBOR, FormatMsgpack:
+	default:
+		return nil, fmt.Errorf("unknown payload format %q, use: json, cbor, msgpack", format)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	generic, err = fromJSONNumbers(generic)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == FormatCBOR {
+		return encodeCBOR(generic)
+	}
+	return encodeMsgpack(generic)
+}
+
+// fromJSONNumbers replaces json.Number with int64 (whole numbers, so
+// timestamps stay exact) or float64
+func fromJSONNumbers(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return n, nil
+		}
+		return v.Float64()
+	case []interface{}:
+		for i, item := range v {
+			converted, err := fromJSONNumbers(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			converted, err := fromJSONNumbers(item)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = converted
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,232 @@
+package mqtt
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"wattwise/internal/models"
+)
+
+func TestPayloadRoundTrip(t *testing.T) {
+	messages := []models.MQTTMessage{
+		{DeviceID: "ESP32_001", Timestamp: 1736900000123, Voltage: 220.5, Current: 2.1, Power: 463.05, Energy: 12.345, Frequency: 50, PowerFactor: 0.95, Rssi: -67, Uptime: 86400},
+		{DeviceID: "ESP32_002", Voltage: 0.1, Current: 1e-3, Power: -5.5},
+		{DeviceID: "3P", Phases: []models.PhaseReading{{Voltage: 230, Current: 1, Power: 230}, {Voltage: 231.5, Current: 2, Power: 463}, {Voltage: 229, Current: 0, Power: 0}}},
+		{DeviceID: strings.Repeat("x", 300), Energy: math.MaxFloat32 * 2},
+	}
+	for _, format := range []string{FormatJSON, FormatCBOR, FormatMsgpack} {
+		decoder, err := NewPayloadDecoder(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range messages {
+			payload, err := EncodePayload(format, want)
+			if err != nil {
+				t.Fatalf("%s: encode %s: %v", format, want.DeviceID, err)
+			}
+			// Decoder format yang dikonfigurasi dan auto harus sama hasilnya
+			for name, d := range map[string]PayloadDecoder{format: decoder, FormatAuto: AutoDecoder} {
+				var got models.MQTTMessage
+				if err := d.Decode(payload, &got); err != nil {
+					t.Errorf("%s payload, %s decoder: %v", format, name, err)
+					continue
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s payload, %s decoder:\n got %+v\nwant %+v", format, name, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestBinaryValuesRoundTrip(t *testing.T) {
+	values := []interface{}{
+		nil, true, false,
+		int64(0), int64(23), int64(24), int64(127), int64(128), int64(255), int64(256), int64(65535), int64(65536),
+		int64(math.MaxUint32), int64(math.MaxUint32 + 1), int64(math.MaxInt64),
+		int64(-1), int64(-24), int64(-25), int64(-32), int64(-33), int64(-128), int64(-129), int64(-32768), int64(-32769),
+		int64(math.MinInt32), int64(math.MinInt32 - 1), int64(math.MinInt64),
+		uint64(math.MaxUint64),
+		0.5, -220.25, 0.1, math.MaxFloat64, math.SmallestNonzeroFloat64,
+		"", "a", strings.Repeat("s", 31), strings.Repeat("s", 32), strings.Repeat("s", 256), strings.Repeat("s", 65536), "äöü ⚡",
+		[]interface{}{}, []interface{}{int64(1), "two", 3.5, nil},
+		make([]interface{}, 16),
+		map[string]interface{}{},
+		map[string]interface{}{"voltage": 220.5, "phases": []interface{}{map[string]interface{}{"power": int64(1)}}},
+	}
+	big := make(map[string]interface{})
+	for i := 0; i < 20; i++ {
+		big[strings.Repeat("k", i+1)] = int64(i)
+	}
+	values = append(values, big)
+
+	codecs := []struct {
+		name   string
+		encode func(interface{}) ([]byte, error)
+		decode func([]byte) (interface{}, error)
+	}{
+		{FormatCBOR, encodeCBOR, decodeCBOR},
+		{FormatMsgpack, encodeMsgpack, decodeMsgpack},
+	}
+	for _, codec := range codecs {
+		for _, want := range values {
+			b, err := codec.encode(want)
+			if err != nil {
+				t.Fatalf("%s: encode %#v: %v", codec.name, want, err)
+			}
+			got, err := codec.decode(b)
+			if err != nil {
+				t.Errorf("%s: decode %#v: %v", codec.name, want, err)
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: round trip of %.40v = %.40v (%T)", codec.name, want, got, got)
+			}
+		}
+	}
+}
+
+func TestDecodeForeignEncodings(t *testing.T) {
+	// Bentuk yang tidak dihasilkan EncodePayload tapi dipakai library device
+	tests := []struct {
+		name    string
+		decode  func([]byte) (interface{}, error)
+		payload []byte
+		want    interface{}
+	}{
+		{"cbor float16", decodeCBOR, []byte{0xf9, 0x3c, 0x00}, 1.0},
+		{"cbor float16 subnormal", decodeCBOR, []byte{0xf9, 0x00, 0x01}, math.Ldexp(1, -24)},
+		{"cbor float16 negative", decodeCBOR, []byte{0xf9, 0xc4, 0x00}, -4.0},
+		{"cbor float64", decodeCBOR, []byte{0xfb, 0x3f, 0xb9, 0x99, 0x99, 0x99, 0x99, 0x99, 0x9a}, 0.1},
+		{"cbor undefined", decodeCBOR, []byte{0xf7}, nil},
+		{"cbor tag skipped", decodeCBOR, []byte{0xc1, 0x1a, 0x67, 0x87, 0x42, 0xa0}, int64(1736917664)},
+		{"cbor byte string", decodeCBOR, []byte{0x42, 'h', 'i'}, "hi"},
+		{"cbor indefinite string", decodeCBOR, []byte{0x7f, 0x62, 'a', 'b', 0x61, 'c', 0xff}, "abc"},
+		{"cbor indefinite array", decodeCBOR, []byte{0x9f, 0x01, 0x02, 0xff}, []interface{}{int64(1), int64(2)}},
+		{"cbor indefinite map", decodeCBOR, []byte{0xbf, 0x61, 'p', 0x18, 0x64, 0xff}, map[string]interface{}{"p": int64(100)}},
+		{"cbor integer key", decodeCBOR, []byte{0xa1, 0x01, 0xf5}, map[string]interface{}{"1": true}},
+		{"cbor 64-bit length", decodeCBOR, []byte{0x7b, 0, 0, 0, 0, 0, 0, 0, 1, 'z'}, "z"},
+		{"msgpack uint8", decodeMsgpack, []byte{0xcc, 0x05}, int64(5)},
+		{"msgpack int64", decodeMsgpack, []byte{0xd3, 0, 0, 0, 0, 0, 0, 0, 7}, int64(7)},
+		{"msgpack str8", decodeMsgpack, []byte{0xd9, 0x02, 'o', 'k'}, "ok"},
+		{"msgpack bin", decodeMsgpack, []byte{0xc4, 0x02, 'o', 'k'}, "ok"},
+		{"msgpack array16", decodeMsgpack, []byte{0xdc, 0x00, 0x01, 0xc0}, []interface{}{nil}},
+		{"msgpack map32", decodeMsgpack, []byte{0xdf, 0, 0, 0, 1, 0xa1, 'p', 0xca, 0x42, 0xc8, 0, 0}, map[string]interface{}{"p": 100.0}},
+		{"msgpack integer key", decodeMsgpack, []byte{0x81, 0x01, 0xc3}, map[string]interface{}{"1": true}},
+	}
+	for _, tt := range tests {
+		got, err := tt.decode(tt.payload)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeMalformedPayload(t *testing.T) {
+	deep := func(open, value byte) []byte {
+		b := bytes.Repeat([]byte{open}, maxPayloadDepth+2)
+		return append(b, value)
+	}
+	tests := []struct {
+		name    string
+		decoder PayloadDecoder
+		payload []byte
+		err     string
+	}{
+		{"cbor empty", CBORDecoder, nil, "truncated"},
+		{"cbor truncated string", CBORDecoder, []byte{0xa1, 0x65, 'p', 'o'}, "truncated"},
+		{"cbor map length past the end", CBORDecoder, []byte{0xba, 0xff, 0xff, 0xff, 0xff}, "truncated"},
+		{"cbor unterminated map", CBORDecoder, []byte{0xbf, 0x61, 'p', 0x01}, "truncated"},
+		{"cbor trailing bytes", CBORDecoder, []byte{0xa0, 0x00}, "trailing bytes"},
+		{"cbor not a map", CBORDecoder, []byte{0x82, 0x01, 0x02}, "not a map"},
+		{"cbor invalid additional info", CBORDecoder, []byte{0x1c}, "additional info"},
+		{"cbor bad string chunk", CBORDecoder, []byte{0x7f, 0x41, 'a', 0xff}, "invalid chunk"},
+		{"cbor nested indefinite string", CBORDecoder, []byte{0x7f, 0x7f, 0xff, 0xff}, "nested indefinite"},
+		{"cbor negative out of range", CBORDecoder, []byte{0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "out of range"},
+		{"cbor too deep", CBORDecoder, deep(0x81, 0xa0), "nested too deeply"},
+		{"msgpack empty", MsgpackDecoder, nil, "truncated"},
+		{"msgpack truncated float", MsgpackDecoder, []byte{0x81, 0xa1, 'p', 0xcb, 0x40}, "truncated"},
+		{"msgpack map length past the end", MsgpackDecoder, []byte{0xdf, 0xff, 0xff, 0xff, 0xff}, "truncated"},
+		{"msgpack trailing bytes", MsgpackDecoder, []byte{0x80, 0xc0}, "trailing bytes"},
+		{"msgpack not a map", MsgpackDecoder, []byte{0x92, 0x01, 0x02}, "not a map"},
+		{"msgpack ext", MsgpackDecoder, []byte{0xd4, 0x01, 0x00}, "unsupported MessagePack type"},
+		{"msgpack too deep", MsgpackDecoder, deep(0x91, 0x80), "nested too deeply"},
+		{"auto garbage", AutoDecoder, []byte{0xc1}, "neither JSON"},
+		{"auto invalid json", AutoDecoder, []byte(`{"power":`), "unexpected end"},
+	}
+	for _, tt := range tests {
+		var msg models.MQTTMessage
+		err := tt.decoder.Decode(tt.payload, &msg)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestDecodeTimestamp(t *testing.T) {
+	local := time.Date(2025, 10, 20, 0, 55, 31, 0, time.Local).UnixMilli()
+	tests := []struct {
+		timestamp string
+		want      models.DeviceTimestamp
+		invalid   bool
+	}{
+		{`1736900000123`, 1736900000123, false},
+		{`"2025-10-20 00:55:31"`, models.DeviceTimestamp(local), false},
+		{`null`, 0, false},
+		{`""`, 0, false},
+		// Format lain ditolak, bukan jadi waktu nol
+		{`"2025-10-20T00:55:31Z"`, 0, true},
+		{`"20/10/2025 00:55"`, 0, true},
+		{`1736900000.5`, 0, true},
+		{`true`, 0, true},
+	}
+	for _, tt := range tests {
+		var msg models.MQTTMessage
+		err := JSONDecoder.Decode([]byte(`{"device_id":"A","timestamp":`+tt.timestamp+`,"voltage":220}`), &msg)
+		if tt.invalid {
+			if !errors.Is(err, models.ErrInvalidTimestamp) {
+				t.Errorf("%s: err = %v, want ErrInvalidTimestamp", tt.timestamp, err)
+			}
+			continue
+		}
+		if err != nil || msg.Timestamp != tt.want {
+			t.Errorf("%s: timestamp = %d (%v), want %d", tt.timestamp, msg.Timestamp, err, tt.want)
+		}
+	}
+}
+
+func TestAutoDecoderPicksFormat(t *testing.T) {
+	want := models.MQTTMessage{DeviceID: "A", Power: 100, PowerFactor: 0.9}
+	for _, format := range []string{FormatJSON, FormatCBOR, FormatMsgpack} {
+		payload, err := EncodePayload(format, want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format == FormatJSON {
+			payload = append([]byte(" \n"), payload...)
+		}
+		var got models.MQTTMessage
+		if err := AutoDecoder.Decode(payload, &got); err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", format, got, want)
+		}
+	}
+
+	if _, err := NewPayloadDecoder("protobuf"); err == nil {
+		t.Error("NewPayloadDecoder(protobuf) = nil error")
+	}
+	if _, err := EncodePayload("protobuf", want); err == nil {
+		t.Error("EncodePayload(protobuf) = nil error")
+	}
+}
@@ -2,12 +2,20 @@ package mqtt
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
+// publishTimeout bounds how long a publish waits for the broker (QoS 1 PUBACK)
+const publishTimeout = 5 * time.Second
+
+// ErrPublishTimeout is returned when the broker did not confirm a publish in time
+var ErrPublishTimeout = errors.New("MQTT publish timed out")
+
 type Publisher struct {
 	client mqtt.Client
 }
@@ -18,45 +26,72 @@ func NewPublisher(client mqtt.Client) *Publisher {
 	}
 }
 
+// CommandTopic returns the topic a device listens on for commands
+func CommandTopic(deviceID string) string {
+	return fmt.Sprintf("wattwise/commands/%s", deviceID)
+}
+
 // PublishCommand publishes a command to device
 func (p *Publisher) PublishCommand(deviceID string, command interface{}) error {
-	topic := fmt.Sprintf("wattwise/commands/%s", deviceID)
+	topic := CommandTopic(deviceID)
+
+	if !p.client.IsConnected() {
+		return fmt.Errorf("MQTT client not connected")
+	}
 
 	payload, err := json.Marshal(command)
 	if err != nil {
 		return fmt.Errorf("failed to marshal command: %v", err)
 	}
 
-	token := p.client.Publish(topic, 1, false, payload)
-	if token.Wait() && token.Error() != nil {
-		return fmt.Errorf("failed to publish command: %v", token.Error())
+	if err := p.publish(topic, payload); err != nil {
+		return fmt.Errorf("failed to publish command: %w", err)
 	}
 
 	log.Printf("✅ Published command to device %s", deviceID)
 	return nil
 }
 
-// PublishControlMessage publishes control message to device
-func (p *Publisher) PublishControlMessage(deviceID, action string, params map[string]interface{}) error {
-	topic := fmt.Sprintf("wattwise/control/%s", deviceID)
+// ControlTopic returns the topic a device listens on for control messages
+func ControlTopic(deviceID string) string {
+	return fmt.Sprintf("wattwise/control/%s", deviceID)
+}
+
+// PublishControlMessage publishes control message to device and returns the
+// topic it was published on. requestID is echoed so the device can ack it.
+func (p *Publisher) PublishControlMessage(deviceID, action, requestID string, params map[string]interface{}) (string, error) {
+	topic := ControlTopic(deviceID)
+
+	if !p.client.IsConnected() {
+		return topic, fmt.Errorf("MQTT client not connected")
+	}
 
 	message := map[string]interface{}{
-		"action": action,
-		"params": params,
+		"action":     action,
+		"params":     params,
+		"request_id": requestID,
 	}
 
 	payload, err := json.Marshal(message)
 	if err != nil {
-		return fmt.Errorf("failed to marshal control message: %v", err)
+		return topic, fmt.Errorf("failed to marshal control message: %v", err)
 	}
 
-	token := p.client.Publish(topic, 1, false, payload)
-	if token.Wait() && token.Error() != nil {
-		return fmt.Errorf("failed to publish control message: %v", token.Error())
+	if err := p.publish(topic, payload); err != nil {
+		return topic, fmt.Errorf("failed to publish control message: %w", err)
 	}
 
-	log.Printf("✅ Published control message to device %s: %s", deviceID, action)
-	return nil
+	log.Printf("✅ Published control message to device %s: %s (request %s)", deviceID, action, requestID)
+	return topic, nil
+}
+
+// publish sends payload with QoS 1 and waits at most publishTimeout
+func (p *Publisher) publish(topic string, payload []byte) error {
+	token := p.client.Publish(topic, 1, false, payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return ErrPublishTimeout
+	}
+	return token.Error()
 }
 
 // BroadcastMessage broadcasts message to all devices
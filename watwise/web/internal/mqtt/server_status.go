@@ -0,0 +1,42 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// ServerStatus is the retained message on MQTT_SERVER_STATUS_TOPIC: "online"
+// after connecting, "offline" on shutdown or, as Last Will, from the broker
+// when the server dies without disconnecting
+type ServerStatus struct {
+	ClientID  string `json:"client_id"`
+	Status    string `json:"status"`
+	Timestamp int64  `json:"timestamp"` // Unix ms, 0 in the Last Will
+}
+
+func serverStatusPayload(clientID, status string, now time.Time) []byte {
+	msg := ServerStatus{ClientID: clientID, Status: status}
+	if !now.IsZero() {
+		msg.Timestamp = now.UnixMilli()
+	}
+	payload, _ := json.Marshal(msg)
+	return payload
+}
+
+// SetServerWill registers the retained "offline" Last Will on opts; call
+// before creating the client
+func SetServerWill(opts *mqtt.ClientOptions, topic, clientID string, qos byte) {
+	opts.SetBinaryWill(topic, serverStatusPayload(clientID, "offline", time.Time{}), qos, true)
+}
+
+// PublishServerStatus publishes a retained ServerStatus. A clean disconnect
+// does not trigger the Last Will, so shutdown publishes "offline" itself.
+func PublishServerStatus(client mqtt.Client, topic, clientID, status string, qos byte) error {
+	token := client.Publish(topic, qos, true, serverStatusPayload(clientID, status, time.Now()))
+	if !token.WaitTimeout(publishTimeout) {
+		return ErrPublishTimeout
+	}
+	return token.Error()
+}
@@ -2,42 +2,308 @@
 package mqtt
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"wattwise/internal/database"
 	"wattwise/internal/models"
 	"wattwise/internal/services"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
-type WebSocketBroadcaster interface {
+// Broadcaster publishes readings, alerts and status changes to the live
+// clients (*handlers.EventFanout, read by the WebSocket hub and every SSE
+// stream)
+type Broadcaster interface {
 	BroadcastRealtimeData(data models.RealtimeData)
 	BroadcastAlert(alert models.AlertData)
+	BroadcastDeviceStatus(event models.DeviceStatusEvent)
+}
+
+// AlertStore persists alerts (*repositories.AlertRepository)
+type AlertStore interface {
+	Add(alert models.AlertData) error
+}
+
+// AlertNotifier sends alerts by email/webhook (*services.NotificationService);
+// Notify must not block
+type AlertNotifier interface {
+	Notify(alert models.AlertData)
+}
+
+const (
+	ackTopicPrefix = "wattwise/ack/"
+	ackTopicFilter = ackTopicPrefix + "+"
+
+	// Firmware publishes retained {"status":"online"} here on connect and
+	// sets {"status":"offline"} as its Last Will
+	statusTopicPrefix = "wattwise/status/"
+	statusTopicFilter = statusTopicPrefix + "+"
+
+	// Fallback untuk firmware tanpa LWT: offline setelah sekian laporan
+	// terlewat, lihat SetHeartbeat
+	defaultReportInterval = 20 * time.Second
+	defaultMissedReports  = 3
+	statusCheckInterval   = 10 * time.Second
+
+	// rssi/uptime reports kept per device for diagnostics
+	linkHistorySize = 60
+)
+
+// DefaultTopics are the energy topics used when MQTT_TOPICS is not set
+var DefaultTopics = []string{
+	"esp32", // ← Topic utama dari ESP32
+	"test",  // Topic untuk testing
 }
 
 type Subscriber struct {
 	client        mqtt.Client
 	energyService *services.EnergyService
-	wsBroadcaster WebSocketBroadcaster
+	deviceService *services.DeviceService
+	broadcaster   Broadcaster
+	commandAcks   *services.CommandTracker
+	anomalies     *services.AnomalyDetector
+	alertStore    AlertStore
+	notifier      AlertNotifier
 	deviceStatus  map[string]*models.DeviceStatus
+	linkHistory   map[string][]models.LinkSample
+	energyTopics  []string
+	qos           byte
 	statusMutex   sync.RWMutex
+	logger        *slog.Logger
+
+	// Subscription state for /health/ready
+	healthMu      sync.Mutex
+	topics        []string
+	subscriptions map[string]*Subscription
+	lastMessageAt time.Time
+	lastError     string
+	lastErrorAt   time.Time
+
+	// Offline checker, see SetHeartbeat; started by the first
+	// SubscribeToEnergyData, ended with the throttle loop by Stop
+	statusCheckOnce sync.Once
+	reportInterval  time.Duration
+	missedReports   int
+	stop            chan struct{}
+	stopOnce        sync.Once
+
+	// Optional duplicate filter, see EnableDedup
+	dedup             *dedupCache
+	duplicatesDropped atomic.Uint64
+
+	// Payload decoders per topic filter, see RegisterPayloadDecoder
+	payloadDecoders []topicDecoder
+	defaultDecoder  PayloadDecoder
+	decodeFailures  atomic.Uint64
+
+	// Optional insert throttle, see EnableThrottle
+	throttle          *insertThrottle
+	storeInterval     time.Duration
+	throttledReadings atomic.Uint64
+}
+
+type topicDecoder struct {
+	filter  string
+	decoder PayloadDecoder
 }
 
-func NewSubscriber(client mqtt.Client, energyService *services.EnergyService) *Subscriber {
+func NewSubscriber(client mqtt.Client, energyService *services.EnergyService, deviceService *services.DeviceService, logger *slog.Logger) *Subscriber {
 	return &Subscriber{
-		client:        client,
-		energyService: energyService,
-		deviceStatus:  make(map[string]*models.DeviceStatus),
+		client:         client,
+		energyService:  energyService,
+		deviceService:  deviceService,
+		deviceStatus:   make(map[string]*models.DeviceStatus),
+		linkHistory:    make(map[string][]models.LinkSample),
+		subscriptions:  make(map[string]*Subscription),
+		energyTopics:   DefaultTopics,
+		qos:            1,
+		defaultDecoder: AutoDecoder,
+		reportInterval: defaultReportInterval,
+		missedReports:  defaultMissedReports,
+		stop:           make(chan struct{}),
+		logger:         logger.With("component", "mqtt_subscriber"),
+	}
+}
+
+// SetBroadcaster sets the event bus readings, alerts and status changes are
+// published to
+func (s *Subscriber) SetBroadcaster(broadcaster Broadcaster) {
+	s.broadcaster = broadcaster
+}
+
+// SetCommandTracker enables the wattwise/ack/+ subscription and raises a
+// "command_timeout" alert for commands that never get an ack
+func (s *Subscriber) SetCommandTracker(tracker *services.CommandTracker) {
+	s.commandAcks = tracker
+	tracker.SetTimeoutHandler(s.commandTimedOut)
+}
+
+func (s *Subscriber) commandTimedOut(cmd models.CommandStatus) {
+	s.raiseAlert(s.logger.With("device_id", cmd.DeviceID, "request_id", cmd.RequestID), models.AlertData{
+		DeviceID:  cmd.DeviceID,
+		AlertType: "command_timeout",
+		Message:   fmt.Sprintf("Device %s did not acknowledge %s (request %s)", cmd.DeviceID, cmd.Action, cmd.RequestID),
+		Timestamp: time.Now().UnixMilli(),
+	})
+}
+
+// SetAnomalyDetector enables "anomaly" alerts next to the fixed thresholds
+func (s *Subscriber) SetAnomalyDetector(detector *services.AnomalyDetector) {
+	s.anomalies = detector
+}
+
+// SetAlertStore persists every alert before it is broadcast
+func (s *Subscriber) SetAlertStore(store AlertStore) {
+	s.alertStore = store
+}
+
+// SetNotifier hands every alert to email/webhook notifications as well
+func (s *Subscriber) SetNotifier(notifier AlertNotifier) {
+	s.notifier = notifier
+}
+
+// SetTopics replaces the energy topics (wildcards allowed) and the QoS used for
+// every subscription. An empty list keeps DefaultTopics; QoS above 2 is capped.
+func (s *Subscriber) SetTopics(topics []string, qos int) {
+	if len(topics) > 0 {
+		s.energyTopics = topics
+	}
+	if qos < 0 {
+		qos = 0
+	}
+	if qos > 2 {
+		qos = 2
+	}
+	s.qos = byte(qos)
+}
+
+// EnableDedup drops readings whose (device, timestamp) - or payload hash when
+// the device sends no timestamp - was already seen within window. Dropped
+// readings are neither stored nor broadcast. Disabled when window <= 0.
+func (s *Subscriber) EnableDedup(window time.Duration, cacheSize int) {
+	if window <= 0 {
+		s.dedup = nil
+		return
+	}
+	s.dedup = newDedupCache(window, cacheSize)
+}
+
+// EnableThrottle stores at most one reading per device and interval (the
+// latest of each window) while every reading is still checked for alerts and
+// broadcast. A device's store_interval_seconds overrides defaultInterval;
+// 0 stores every reading.
+func (s *Subscriber) EnableThrottle(defaultInterval time.Duration) {
+	s.storeInterval = max(defaultInterval, 0)
+	s.throttle = newInsertThrottle(s.deviceStoreInterval)
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				for deviceID, data := range s.throttle.flushDue(now) {
+					s.store(s.logger.With("device_id", deviceID), deviceID, data)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// SetHeartbeat sets when a device without LWT counts as offline: after
+// missedReports report intervals without data. A device's
+// expected_report_interval_seconds overrides reportInterval.
+func (s *Subscriber) SetHeartbeat(reportInterval time.Duration, missedReports int) {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+
+	if reportInterval > 0 {
+		s.reportInterval = reportInterval
+	}
+	if missedReports > 0 {
+		s.missedReports = missedReports
+	}
+}
+
+// offlineAfter is how long deviceID may stay silent before it is marked
+// offline; must be called with statusMutex held
+func (s *Subscriber) offlineAfter(deviceID string) time.Duration {
+	interval := s.reportInterval
+	if device, err := s.deviceService.Get(deviceID); err == nil && device.ExpectedReportIntervalSeconds > 0 {
+		interval = time.Duration(device.ExpectedReportIntervalSeconds) * time.Second
 	}
+	return interval * time.Duration(s.missedReports)
 }
 
-// SetWebSocketBroadcaster sets the WebSocket handler untuk broadcasting
-func (s *Subscriber) SetWebSocketBroadcaster(broadcaster WebSocketBroadcaster) {
-	s.wsBroadcaster = broadcaster
-	log.Println("✅ WebSocket broadcaster connected to MQTT subscriber")
+// Stop ends the offline checker and the throttle loop; call FlushThrottled
+// afterwards to store what the throttle still holds
+func (s *Subscriber) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// FlushThrottled stores the readings the throttle still holds (shutdown)
+func (s *Subscriber) FlushThrottled() {
+	if s.throttle == nil {
+		return
+	}
+	for deviceID, data := range s.throttle.drain() {
+		s.store(s.logger.With("device_id", deviceID), deviceID, data)
+	}
+}
+
+func (s *Subscriber) deviceStoreInterval(deviceID string) time.Duration {
+	if device, err := s.deviceService.Get(deviceID); err == nil && device.StoreIntervalSeconds > 0 {
+		return time.Duration(device.StoreIntervalSeconds) * time.Second
+	}
+	return s.storeInterval
+}
+
+// store saves one reading to IoTDB
+func (s *Subscriber) store(logger *slog.Logger, deviceID string, data models.EnergyData) {
+	if err := s.energyService.SaveEnergyData(context.Background(), deviceID, &data); err != nil {
+		// Selama IoTDB putus setiap reading gagal; mode-nya sudah dilaporkan
+		// oleh reconnection manager
+		if database.IsUnavailable(err) {
+			logger.Debug("IoTDB not connected, reading not saved", "error", err)
+			return
+		}
+		logger.Warn("failed to save reading, broadcasting anyway", "error", err)
+	}
+}
+
+// SetPayloadDecoder sets the decoder for energy topics without a registered
+// one (default AutoDecoder)
+func (s *Subscriber) SetPayloadDecoder(decoder PayloadDecoder) {
+	if decoder != nil {
+		s.defaultDecoder = decoder
+	}
+}
+
+// RegisterPayloadDecoder decodes payloads on topics matching filter (MQTT
+// wildcards allowed) with decoder. The first matching registration wins.
+// Call before SubscribeToEnergyData.
+func (s *Subscriber) RegisterPayloadDecoder(filter string, decoder PayloadDecoder) {
+	s.payloadDecoders = append(s.payloadDecoders, topicDecoder{filter: filter, decoder: decoder})
+}
+
+func (s *Subscriber) payloadDecoder(topic string) PayloadDecoder {
+	for _, td := range s.payloadDecoders {
+		if topicMatches(td.filter, topic) {
+			return td.decoder
+		}
+	}
+	return s.defaultDecoder
 }
 
 // ✅ FIXED: Subscribe ke topic esp32 (sesuai saran teman)
@@ -46,83 +312,269 @@ func (s *Subscriber) SubscribeToEnergyData() error {
 		return fmt.Errorf("MQTT client not connected")
 	}
 
-	// ✅ Topic sesuai perintah: mosquitto_pub -t esp32
-	topics := []string{
-		"esp32",  // ← Topic utama dari ESP32
-		"test",   // Topic untuk testing
+	var subscribed, failed []string
+	var lastErr error
+	subscribe := func(topic string, handler mqtt.MessageHandler) {
+		token := s.client.Subscribe(topic, s.qos, handler)
+		if token.Wait() && token.Error() != nil {
+			s.logger.Warn("subscribe failed", "topic", topic, "qos", s.qos, "error", token.Error())
+			lastErr = token.Error()
+			failed = append(failed, topic)
+			s.recordSubscription(topic, token.Error())
+			return
+		}
+
+		s.logger.Info("subscribed", "topic", topic, "qos", s.qos)
+		subscribed = append(subscribed, topic)
+		s.recordSubscription(topic, nil)
 	}
 
-	for _, topic := range topics {
-		log.Printf("🔔 Attempting to subscribe to topic: %s", topic)
+	// ✅ Topic sesuai perintah: mosquitto_pub -t esp32 (atau MQTT_TOPICS)
+	for _, topic := range s.energyTopics {
+		subscribe(topic, s.handleEnergyMessage)
+	}
+	if s.commandAcks != nil {
+		subscribe(ackTopicFilter, s.handleAckMessage)
+	}
+	subscribe(statusTopicFilter, s.handleStatusMessage)
 
-		token := s.client.Subscribe(topic, 1, s.handleEnergyMessage)
-		if token.Wait() && token.Error() != nil {
-			log.Printf("⚠️ Failed to subscribe to %s: %v", topic, token.Error())
-			continue
-		}
+	if len(failed) > 0 {
+		s.logger.Warn("some topics could not be subscribed, check MQTT_TOPICS", "subscribed", subscribed, "failed", failed)
+	} else {
+		s.logger.Info("subscription complete", "topics", subscribed)
+	}
 
-		log.Printf("✅ Successfully subscribed to: %s", topic)
+	s.healthMu.Lock()
+	s.topics = subscribed
+	if lastErr != nil {
+		s.lastError = lastErr.Error()
+		s.lastErrorAt = time.Now()
 	}
+	s.healthMu.Unlock()
 
-	go s.checkDeviceStatus()
+	if len(subscribed) == 0 {
+		return fmt.Errorf("no topics subscribed: %v", lastErr)
+	}
+
+	s.statusCheckOnce.Do(func() { go s.checkDeviceStatus() })
 	return nil
 }
 
+// handleAckMessage handles wattwise/ack/<device_id>
+func (s *Subscriber) handleAckMessage(client mqtt.Client, msg mqtt.Message) {
+	deviceID := strings.TrimPrefix(msg.Topic(), ackTopicPrefix)
+	logger := s.logger.With("topic", msg.Topic(), "device_id", deviceID)
+
+	var ack models.CommandAck
+	if err := json.Unmarshal(msg.Payload(), &ack); err != nil || ack.RequestID == "" {
+		logger.Warn("invalid ack payload", "error", err, "payload", string(msg.Payload()))
+		return
+	}
+
+	s.commandAcks.Ack(deviceID, ack)
+}
+
+// Subscription is the state of one topic filter, for /health
+type Subscription struct {
+	Topic         string     `json:"topic"`
+	QoS           byte       `json:"qos"`
+	Subscribed    bool       `json:"subscribed"`
+	LastAttemptAt time.Time  `json:"last_attempt_at"`
+	SubscribedAt  *time.Time `json:"subscribed_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+func (s *Subscriber) recordSubscription(topic string, err error) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+
+	now := time.Now()
+	sub, ok := s.subscriptions[topic]
+	if !ok {
+		sub = &Subscription{Topic: topic}
+		s.subscriptions[topic] = sub
+	}
+	sub.QoS = s.qos
+	sub.LastAttemptAt = now
+	sub.Subscribed = err == nil
+	if err != nil {
+		sub.LastError = err.Error()
+		return
+	}
+	sub.SubscribedAt = &now
+	sub.LastError = ""
+}
+
+// Subscriptions returns the per-topic subscribe results, sorted by topic
+func (s *Subscriber) Subscriptions() []Subscription {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	return s.subscriptionsLocked()
+}
+
+func (s *Subscriber) subscriptionsLocked() []Subscription {
+	subs := make([]Subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		subs = append(subs, *sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].Topic < subs[j].Topic })
+	return subs
+}
+
+// HandleConnectionLost clears the subscription state. Dipanggil dari
+// OnConnectionLost; clean session berarti subscription hilang.
+func (s *Subscriber) HandleConnectionLost(err error) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+
+	s.topics = nil
+	for _, sub := range s.subscriptions {
+		sub.Subscribed = false
+	}
+	s.lastError = err.Error()
+	s.lastErrorAt = time.Now()
+}
+
+// HandleReconnect subscribes to every configured topic after the client
+// (re)connected. Dipanggil dari OnConnect, jadi subscription kembali setelah
+// broker restart tanpa retry manual.
+func (s *Subscriber) HandleReconnect() {
+	go func() {
+		if err := s.SubscribeToEnergyData(); err != nil {
+			s.logger.Error("resubscribe after reconnect failed", "error", err)
+		}
+	}()
+}
+
+// Status describes the MQTT side for /health/ready
+type Status struct {
+	Connected     bool           `json:"connected"`
+	Subscribed    bool           `json:"subscribed"`
+	Topics        []string       `json:"topics"`
+	Subscriptions []Subscription `json:"subscriptions"`
+	LastMessageAt *time.Time     `json:"last_message_at,omitempty"`
+	LastError     string         `json:"last_error,omitempty"`
+	LastErrorAt   *time.Time     `json:"last_error_at,omitempty"`
+
+	DuplicatesDropped  uint64 `json:"duplicates_dropped"`
+	DedupWindowSeconds int    `json:"dedup_window_seconds"` // 0 = dedup off
+	DecodeFailures     uint64 `json:"decode_failures"`      // payloads no decoder could read
+
+	// Readings held back by the insert throttle (stored once per interval)
+	StoreIntervalSeconds int    `json:"store_interval_seconds"` // default, 0 = every reading
+	ThrottledReadings    uint64 `json:"throttled_readings"`
+}
+
+// Status returns a snapshot of the connection and subscription state
+func (s *Subscriber) Status() Status {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+
+	connected := s.client.IsConnected()
+	status := Status{
+		Connected:  connected,
+		Subscribed: connected && len(s.topics) > 0,
+		Topics:     append([]string{}, s.topics...),
+
+		Subscriptions: s.subscriptionsLocked(),
+		LastError:     s.lastError,
+
+		DuplicatesDropped: s.duplicatesDropped.Load(),
+		DecodeFailures:    s.decodeFailures.Load(),
+
+		StoreIntervalSeconds: int(s.storeInterval / time.Second),
+		ThrottledReadings:    s.throttledReadings.Load(),
+	}
+	if s.dedup != nil {
+		status.DedupWindowSeconds = int(s.dedup.window / time.Second)
+	}
+	if !s.lastMessageAt.IsZero() {
+		t := s.lastMessageAt
+		status.LastMessageAt = &t
+	}
+	if !s.lastErrorAt.IsZero() {
+		t := s.lastErrorAt
+		status.LastErrorAt = &t
+	}
+	return status
+}
+
 // ✅ FIXED: Handle message dengan format JSON dari ESP32
 func (s *Subscriber) handleEnergyMessage(client mqtt.Client, msg mqtt.Message) {
-	log.Printf("\n📨 ========== MQTT MESSAGE RECEIVED ==========")
-	log.Printf("   Topic: %s", msg.Topic())
-	log.Printf("   Payload size: %d bytes", len(msg.Payload()))
-	log.Printf("   Raw payload: %s", string(msg.Payload()))
+	logger := s.logger.With("topic", msg.Topic())
 
-	// ===== PARSE JSON PAYLOAD =====
+	// ===== DECODE PAYLOAD (JSON, CBOR atau MessagePack) =====
 	var mqttMsg models.MQTTMessage
-	if err := json.Unmarshal(msg.Payload(), &mqttMsg); err != nil {
-		log.Printf("❌ ERROR: Failed to unmarshal JSON: %v", err)
-		log.Printf("   Please check JSON format in ESP32 payload")
+	if err := s.payloadDecoder(msg.Topic()).Decode(msg.Payload(), &mqttMsg); err != nil {
+		// Dihitung di Status, bukan log per pesan
+		s.decodeFailures.Add(1)
+		if errors.Is(err, models.ErrInvalidTimestamp) {
+			// Firmware dengan format waktu lain harus kelihatan di log
+			logger.Warn("rejected reading with unparseable timestamp", "error", err)
+			return
+		}
+		logger.Debug("failed to decode payload", "error", err, "bytes", len(msg.Payload()))
 		return
 	}
 
-	log.Printf("\n📊 ========== PARSED MQTT MESSAGE ==========")
-
-	// Set device ID jika kosong
+	// Set device ID jika kosong: dari topic (wattwise/energy/<id>), lalu default
+	if mqttMsg.DeviceID == "" {
+		mqttMsg.DeviceID = deviceFromTopic(msg.Topic(), s.energyTopics)
+	}
 	if mqttMsg.DeviceID == "" {
-		mqttMsg.DeviceID = "ESP32_PZEM"
-		log.Printf("⚠️ Device ID was empty, set to: ESP32_PZEM")
+		mqttMsg.DeviceID = models.DefaultDeviceID
 	}
+	logger = logger.With("device_id", mqttMsg.DeviceID)
 
-	log.Printf("   Device ID: %s", mqttMsg.DeviceID)
-	log.Printf("   Voltage: %.2f V", mqttMsg.Voltage)
-	log.Printf("   Current: %.3f A", mqttMsg.Current)
-	log.Printf("   Power: %.2f W", mqttMsg.Power)
-	log.Printf("   Energy: %.4f kWh", mqttMsg.Energy)
-	log.Printf("   Frequency: %.1f Hz", mqttMsg.Frequency)
-	log.Printf("   Power Factor: %.3f", mqttMsg.PowerFactor)
+	s.healthMu.Lock()
+	s.lastMessageAt = time.Now()
+	s.healthMu.Unlock()
 
-	// ===== VALIDATE DATA =====
-	log.Printf("\n✓ ========== VALIDATING DATA ==========")
-	if mqttMsg.Voltage <= 0 {
-		log.Printf("❌ INVALID: Voltage is %.2f (must be > 0)", mqttMsg.Voltage)
+	// ===== 3-PHASE: totals dari L1..L3 =====
+	if err := models.ValidatePhases(mqttMsg.Phases); err != nil {
+		logger.Warn("rejected invalid phase reading", "error", err)
 		return
 	}
-	if mqttMsg.Current < 0 {
-		log.Printf("❌ INVALID: Current is %.3f (must be >= 0)", mqttMsg.Current)
-		return
+	if len(mqttMsg.Phases) > 0 {
+		mqttMsg.Voltage, mqttMsg.Current, mqttMsg.Power = models.SumPhases(mqttMsg.Phases)
 	}
-	if mqttMsg.Power < 0 {
-		log.Printf("❌ INVALID: Power is %.2f (must be >= 0)", mqttMsg.Power)
+
+	// ===== VALIDATE DATA =====
+	if mqttMsg.Voltage <= 0 || mqttMsg.Current < 0 || mqttMsg.Power < 0 {
+		logger.Warn("rejected invalid reading",
+			"voltage", mqttMsg.Voltage,
+			"current", mqttMsg.Current,
+			"power", mqttMsg.Power)
 		return
 	}
-	log.Printf("✅ Data validation passed")
 
-	// ===== TIMESTAMP GENERATION =====
+	// ===== DROP DUPLICATES =====
+	if s.dedup != nil {
+		if key := dedupKey(&mqttMsg, msg.Payload()); key != "" && s.dedup.seen(key, time.Now()) {
+			s.duplicatesDropped.Add(1)
+			logger.Debug("dropped duplicate reading", "key", key)
+			return
+		}
+	}
+
+	// Device baru otomatis didaftarkan saat pesan pertama masuk
+	if err := s.deviceService.EnsureRegistered(mqttMsg.DeviceID); err != nil {
+		logger.Warn("failed to auto-register device", "error", err)
+	}
+
 	// ✅ ESP32 tidak mengirim timestamp, generate di server
-	log.Printf("\n⏱️ ========== TIMESTAMP GENERATION ==========")
 	timestampMs := time.Now().UnixMilli()
-	log.Printf("✅ Generated server timestamp: %d ms", timestampMs)
 
-	// ===== CONVERT TO ENERGYDATA MODEL =====
-	log.Printf("\n🔄 ========== CONVERTING TO ENERGYDATA ==========")
+	logger.Debug("energy message received",
+		"timestamp", timestampMs,
+		"voltage", mqttMsg.Voltage,
+		"current", mqttMsg.Current,
+		"power", mqttMsg.Power,
+		"energy", mqttMsg.Energy,
+		"frequency", mqttMsg.Frequency,
+		"power_factor", mqttMsg.PowerFactor,
+		"phases", len(mqttMsg.Phases))
+
 	energyData := &models.EnergyData{
 		Timestamp:   timestampMs,
 		Voltage:     mqttMsg.Voltage,
@@ -131,47 +583,44 @@ func (s *Subscriber) handleEnergyMessage(client mqtt.Client, msg mqtt.Message) {
 		Energy:      mqttMsg.Energy,
 		Frequency:   mqttMsg.Frequency,
 		PowerFactor: mqttMsg.PowerFactor,
+		Phases:      mqttMsg.Phases,
 	}
 
-	log.Printf("✅ Converted EnergyData:")
-	log.Printf("   Timestamp: %d ms", energyData.Timestamp)
-	log.Printf("   Voltage: %.2f V", energyData.Voltage)
-	log.Printf("   Current: %.3f A", energyData.Current)
-	log.Printf("   Power: %.2f W", energyData.Power)
-	log.Printf("   Energy: %.4f kWh", energyData.Energy)
-
 	// ===== SAVE TO IOTDB =====
-	log.Printf("\n💾 ========== SAVING TO IOTDB ==========")
-	if err := s.energyService.SaveEnergyData(mqttMsg.DeviceID, energyData); err != nil {
-		log.Printf("⚠️ WARNING: Failed to save to IoTDB: %v", err)
-		log.Printf("   Continuing to broadcast to WebSocket anyway...")
+	// Tetap broadcast ke WebSocket walaupun gagal simpan
+	if s.throttle == nil {
+		s.store(logger, mqttMsg.DeviceID, *energyData)
 	} else {
-		log.Printf("✅ Successfully saved to IoTDB")
+		store, held := s.throttle.offer(mqttMsg.DeviceID, *energyData)
+		for _, data := range store {
+			s.store(logger, mqttMsg.DeviceID, data)
+		}
+		if held {
+			// Belum disimpan, tapi /latest tetap menampilkan nilai terbaru
+			s.throttledReadings.Add(1)
+			s.energyService.RecordLatest(mqttMsg.DeviceID, *energyData)
+		}
 	}
 
-	// ===== UPDATE DEVICE STATUS =====
-	log.Printf("\n📡 ========== UPDATING DEVICE STATUS ==========")
-	s.updateDeviceStatus(mqttMsg.DeviceID, "online")
-	log.Printf("✅ Device status updated to: online")
-
-	// ===== CHECK THRESHOLD ALERTS =====
-	log.Printf("\n⚠️ ========== CHECKING THRESHOLD ALERTS ==========")
-	if alert := s.energyService.CheckThresholdAlert(mqttMsg.DeviceID, energyData); alert != nil {
-		log.Printf("⚠️ ALERT TRIGGERED: %s", alert.AlertType)
-		log.Printf("   Message: %s", alert.Message)
-		log.Printf("   Threshold: %.2f | Actual: %.2f", alert.Threshold, alert.ActualValue)
+	s.updateDeviceStatus(mqttMsg.DeviceID, "online", models.StatusSourceData, mqttMsg.Rssi, mqttMsg.Uptime)
 
-		// Broadcast alert ke WebSocket clients
-		if s.wsBroadcaster != nil {
-			s.wsBroadcaster.BroadcastAlert(*alert)
-			log.Printf("✅ Alert broadcasted to WebSocket clients")
+	// ===== CHECK ALERTS =====
+	alerts := []*models.AlertData{s.energyService.CheckThresholdAlert(mqttMsg.DeviceID, energyData)}
+	alerts = append(alerts, s.energyService.CheckQualityAlerts(mqttMsg.DeviceID, energyData)...)
+	alerts = append(alerts, s.energyService.CheckDemandPeak(mqttMsg.DeviceID, energyData))
+	if s.anomalies != nil {
+		// Baseline tetap belajar walaupun alert anomaly dimatikan
+		if anomaly := s.anomalies.Check(mqttMsg.DeviceID, energyData); s.energyService.Toggles().Anomaly {
+			alerts = append(alerts, anomaly)
+		}
+	}
+	for _, alert := range alerts {
+		if alert != nil {
+			s.raiseAlert(logger, *alert)
 		}
-	} else {
-		log.Printf("✅ All values within acceptable thresholds")
 	}
 
-	// ===== PREPARE REALTIME DATA UNTUK WEBSOCKET =====
-	log.Printf("\n📤 ========== PREPARING WEBSOCKET BROADCAST ==========")
+	// ===== BROADCAST TO WEBSOCKET CLIENTS =====
 	realtimeData := models.RealtimeData{
 		DeviceID:    mqttMsg.DeviceID,
 		DeviceName:  mqttMsg.DeviceID,
@@ -183,74 +632,179 @@ func (s *Subscriber) handleEnergyMessage(client mqtt.Client, msg mqtt.Message) {
 		PowerFactor: mqttMsg.PowerFactor,
 		Status:      "online",
 		Timestamp:   timestampMs,
+		Phases:      mqttMsg.Phases,
 	}
 
-	log.Printf("✅ RealtimeData prepared:")
-	log.Printf("   Device: %s", realtimeData.DeviceID)
-	log.Printf("   V: %.2f | I: %.3f | P: %.2f | E: %.4f",
-		realtimeData.Voltage, realtimeData.Current, realtimeData.Power, realtimeData.Energy)
-
-	// ===== BROADCAST TO WEBSOCKET CLIENTS =====
-	log.Printf("\n🔊 ========== BROADCASTING TO WEBSOCKET ==========")
-	if s.wsBroadcaster != nil {
-		s.wsBroadcaster.BroadcastRealtimeData(realtimeData)
-		log.Printf("✅ Data broadcasted to WebSocket clients")
+	if s.broadcaster != nil {
+		s.broadcaster.BroadcastRealtimeData(realtimeData)
 	} else {
-		log.Printf("❌ ERROR: WebSocket broadcaster not set!")
+		logger.Error("broadcaster not set")
 	}
+}
+
+// RaiseAlert stores and broadcasts an alert raised outside the MQTT pipeline
+// (budget projections), see services.AlertSink
+func (s *Subscriber) RaiseAlert(alert models.AlertData) {
+	s.raiseAlert(s.logger.With("device_id", alert.DeviceID), alert)
+}
 
-	log.Printf("\n✅ ========== MQTT MESSAGE PROCESSING COMPLETE ==========\n")
+// raiseAlert stores, broadcasts and notifies an alert
+func (s *Subscriber) raiseAlert(logger *slog.Logger, alert models.AlertData) {
+	alert.Severity = alert.SeverityOrDefault()
+	logger.Warn("alert raised",
+		"alert_type", alert.AlertType,
+		"severity", alert.Severity,
+		"threshold", alert.Threshold,
+		"actual", alert.ActualValue)
+
+	if s.alertStore != nil {
+		if err := s.alertStore.Add(alert); err != nil {
+			logger.Error("failed to persist alert", "alert_type", alert.AlertType, "error", err)
+		}
+	}
+	if s.broadcaster != nil {
+		s.broadcaster.BroadcastAlert(alert)
+	}
+	if s.notifier != nil {
+		s.notifier.Notify(alert)
+	}
 }
 
-// handleStatusMessage processes device status messages
+// handleStatusMessage handles wattwise/status/<device_id>: {"status":"online"}
+// from the device on connect, {"status":"offline"} from the broker (LWT)
 func (s *Subscriber) handleStatusMessage(client mqtt.Client, msg mqtt.Message) {
-	log.Printf("📊 Status message: %s - %s", msg.Topic(), string(msg.Payload()))
+	logger := s.logger.With("topic", msg.Topic())
+	logger.Debug("status message received", "payload", string(msg.Payload()), "retained", msg.Retained())
 
-	var statusMsg map[string]interface{}
+	var statusMsg struct {
+		DeviceID string `json:"device_id"`
+		Status   string `json:"status"`
+	}
 	if err := json.Unmarshal(msg.Payload(), &statusMsg); err != nil {
-		log.Printf("❌ Error unmarshaling status message: %v", err)
+		logger.Warn("failed to unmarshal status message", "error", err)
 		return
 	}
 
-	if deviceID, ok := statusMsg["device_id"].(string); ok {
-		if status, ok := statusMsg["status"].(string); ok {
-			s.updateDeviceStatus(deviceID, status)
-		}
+	deviceID := statusMsg.DeviceID
+	if deviceID == "" {
+		deviceID = strings.TrimPrefix(msg.Topic(), statusTopicPrefix)
+	}
+	status := strings.ToLower(statusMsg.Status)
+	if status != "online" && status != "offline" {
+		logger.Warn("invalid device status", "device_id", deviceID, "status", statusMsg.Status)
+		return
+	}
+
+	if err := s.deviceService.EnsureRegistered(deviceID); err != nil {
+		logger.Warn("failed to auto-register device", "device_id", deviceID, "error", err)
+		return
 	}
+
+	s.updateDeviceStatus(deviceID, status, models.StatusSourceLWT, 0, 0)
 }
 
-// updateDeviceStatus updates device status in memory
-func (s *Subscriber) updateDeviceStatus(deviceID, status string) {
-	s.statusMutex.Lock()
-	defer s.statusMutex.Unlock()
+// updateDeviceStatus records a device's status and, on a transition,
+// broadcasts it (and raises an "offline" alert). rssi and uptime are 0 when
+// the message did not carry them; the last reported values are kept then.
+func (s *Subscriber) updateDeviceStatus(deviceID, status, source string, rssi, uptime int) {
+	now := time.Now().UnixMilli()
 
-	s.deviceStatus[deviceID] = &models.DeviceStatus{
+	s.statusMutex.Lock()
+	previous := ""
+	current, ok := s.deviceStatus[deviceID]
+	if ok {
+		previous = current.Status
+	}
+	lastSeen := now
+	if status == "offline" && previous != "" {
+		lastSeen = current.LastSeen
+	}
+	next := &models.DeviceStatus{
 		DeviceID:   deviceID,
 		DeviceName: deviceID,
 		Status:     status,
-		LastSeen:   time.Now().UnixMilli(),
+		LastSeen:   lastSeen,
+	}
+	if ok {
+		next.RSSI, next.Uptime = current.RSSI, current.Uptime
 	}
+	if rssi != 0 || uptime != 0 {
+		next.RSSI, next.Uptime = rssi, uptime
+		history := append(s.linkHistory[deviceID], models.LinkSample{Timestamp: now, RSSI: rssi, Uptime: uptime})
+		if len(history) > linkHistorySize {
+			history = history[len(history)-linkHistorySize:]
+		}
+		s.linkHistory[deviceID] = history
+	}
+	s.deviceStatus[deviceID] = next
+	s.statusMutex.Unlock()
 
-	log.Printf("📊 Device status updated: %s -> %s", deviceID, status)
+	if previous != status {
+		s.statusChanged(deviceID, previous, status, source, now)
+	}
 }
 
-// checkDeviceStatus checks if devices are still online
+func (s *Subscriber) statusChanged(deviceID, previous, status, source string, now int64) {
+	logger := s.logger.With("device_id", deviceID)
+	logger.Info("device status changed", "previous", previous, "status", status, "source", source)
+
+	if s.broadcaster != nil {
+		s.broadcaster.BroadcastDeviceStatus(models.DeviceStatusEvent{
+			Type:      "device_status",
+			DeviceID:  deviceID,
+			Status:    status,
+			Previous:  previous,
+			Source:    source,
+			Timestamp: now,
+		})
+	}
+
+	// Retained "offline" untuk device yang belum pernah terlihat bukan transisi
+	if status == "offline" && previous == "online" {
+		message := fmt.Sprintf("Device %s went offline", deviceID)
+		if source == models.StatusSourceHeartbeat {
+			s.statusMutex.RLock()
+			timeout := s.offlineAfter(deviceID)
+			s.statusMutex.RUnlock()
+			message = fmt.Sprintf("Device %s went offline (no data for %s)", deviceID, timeout)
+		}
+		s.raiseAlert(logger, models.AlertData{
+			DeviceID:  deviceID,
+			AlertType: "offline",
+			Message:   message,
+			Timestamp: now,
+		})
+	}
+}
+
+// checkDeviceStatus marks devices offline after offlineAfter without data,
+// for firmwares that do not publish an LWT. Runs until Stop.
 func (s *Subscriber) checkDeviceStatus() {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(statusCheckInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+
+		var stale []string
+
 		s.statusMutex.Lock()
 		now := time.Now().UnixMilli()
-
 		for deviceID, status := range s.deviceStatus {
-			// Jika tidak ada data dalam 60 detik, tandai offline
-			if now-status.LastSeen > 60000 && status.Status == "online" {
+			if status.Status == "online" && now-status.LastSeen > s.offlineAfter(deviceID).Milliseconds() {
 				status.Status = "offline"
-				log.Printf("⚠️ Device %s is now OFFLINE (no data for 60s)", deviceID)
+				stale = append(stale, deviceID)
 			}
 		}
 		s.statusMutex.Unlock()
+
+		for _, deviceID := range stale {
+			s.statusChanged(deviceID, "online", "offline", models.StatusSourceHeartbeat, now)
+		}
 	}
 }
 
@@ -262,6 +816,33 @@ func (s *Subscriber) GetDeviceStatus(deviceID string) *models.DeviceStatus {
 	return s.deviceStatus[deviceID]
 }
 
+// GetDeviceDiagnostics returns the last rssi/uptime of a device with the
+// recent reports; false when the device was never seen
+func (s *Subscriber) GetDeviceDiagnostics(deviceID string) (*models.DeviceDiagnostics, bool) {
+	s.statusMutex.RLock()
+	defer s.statusMutex.RUnlock()
+
+	status, ok := s.deviceStatus[deviceID]
+	if !ok {
+		return nil, false
+	}
+
+	diagnostics := &models.DeviceDiagnostics{
+		DeviceID: deviceID,
+		Status:   status.Status,
+		LastSeen: status.LastSeen,
+		RSSI:     status.RSSI,
+		Uptime:   status.Uptime,
+		History:  append([]models.LinkSample{}, s.linkHistory[deviceID]...),
+	}
+	for i := 1; i < len(diagnostics.History); i++ {
+		if diagnostics.History[i].Uptime < diagnostics.History[i-1].Uptime {
+			diagnostics.Restarts++
+		}
+	}
+	return diagnostics, true
+}
+
 // GetAllDeviceStatus returns status of all devices
 func (s *Subscriber) GetAllDeviceStatus() []*models.DeviceStatus {
 	s.statusMutex.RLock()
@@ -273,4 +854,4 @@ func (s *Subscriber) GetAllDeviceStatus() []*models.DeviceStatus {
 	}
 
 	return statuses
-}
\ No newline at end of file
+}
@@ -0,0 +1,84 @@
+package mqtt
+
+import (
+	"sync"
+	"time"
+	"wattwise/internal/models"
+)
+
+// insertThrottle keeps at most one reading per device and interval for
+// IoTDB. Intervals are aligned to the clock (a 60s interval stores one
+// reading per minute): the latest reading of a window is held and stored
+// when the next window starts, or by flushDue once the window has ended.
+type insertThrottle struct {
+	interval func(deviceID string) time.Duration
+
+	mu      sync.Mutex
+	pending map[string]throttledReading
+}
+
+type throttledReading struct {
+	windowEnd int64 // unix ms
+	data      models.EnergyData
+}
+
+func newInsertThrottle(interval func(deviceID string) time.Duration) *insertThrottle {
+	return &insertThrottle{
+		interval: interval,
+		pending:  make(map[string]throttledReading),
+	}
+}
+
+// offer returns the readings to store now; held is true when data waits for
+// the end of its window instead
+func (t *insertThrottle) offer(deviceID string, data models.EnergyData) (store []models.EnergyData, held bool) {
+	interval := t.interval(deviceID).Milliseconds()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	previous, ok := t.pending[deviceID]
+	if ok && (interval <= 0 || data.Timestamp >= previous.windowEnd) {
+		store = append(store, previous.data)
+		delete(t.pending, deviceID)
+	}
+	if interval <= 0 {
+		return append(store, data), false
+	}
+
+	windowEnd := data.Timestamp - data.Timestamp%interval + interval
+	if ok && windowEnd < previous.windowEnd {
+		// Reading dari window yang sudah lewat (jam device mundur), simpan langsung
+		return append(store, data), false
+	}
+	t.pending[deviceID] = throttledReading{windowEnd: windowEnd, data: data}
+	return store, true
+}
+
+// flushDue removes and returns the held readings whose window ended by now
+func (t *insertThrottle) flushDue(now time.Time) map[string]models.EnergyData {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	due := make(map[string]models.EnergyData)
+	for deviceID, reading := range t.pending {
+		if reading.windowEnd <= now.UnixMilli() {
+			due[deviceID] = reading.data
+			delete(t.pending, deviceID)
+		}
+	}
+	return due
+}
+
+// drain removes and returns every held reading (shutdown)
+func (t *insertThrottle) drain() map[string]models.EnergyData {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	held := make(map[string]models.EnergyData, len(t.pending))
+	for deviceID, reading := range t.pending {
+		held[deviceID] = reading.data
+	}
+	clear(t.pending)
+	return held
+}
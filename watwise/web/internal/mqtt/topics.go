@@ -0,0 +1,40 @@
+package mqtt
+
+import "strings"
+
+// deviceFromTopic returns the last level of topic when it arrived through a
+// wildcard filter, e.g. "kitchen" for wattwise/energy/kitchen on
+// wattwise/energy/+. Topics matched by a plain filter ("esp32") carry no id,
+// nor do topics a trailing # matched with no levels (wattwise/energy on
+// wattwise/energy/#).
+func deviceFromTopic(topic string, filters []string) string {
+	for _, filter := range filters {
+		if !strings.ContainsAny(filter, "+#") || !topicMatches(filter, topic) {
+			continue
+		}
+		if strings.HasSuffix(filter, "/#") && strings.Count(topic, "/") < strings.Count(filter, "/") {
+			return ""
+		}
+		return topic[strings.LastIndex(topic, "/")+1:]
+	}
+	return ""
+}
+
+// topicMatches reports whether topic matches an MQTT filter with + and #
+func topicMatches(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+		if i >= len(t) {
+			return false
+		}
+		if level != "+" && level != t[i] {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
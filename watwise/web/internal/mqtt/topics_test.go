@@ -0,0 +1,58 @@
+package mqtt
+
+import "testing"
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"wattwise/energy", "wattwise/energy", true},
+		{"wattwise/energy", "wattwise/energy/kitchen", false},
+		{"wattwise/energy", "wattwise/Energy", false},
+		{"wattwise/energy/+", "wattwise/energy/kitchen", true},
+		{"wattwise/energy/+", "wattwise/energy", false},
+		{"wattwise/energy/+", "wattwise/energy/kitchen/plug", false},
+		{"wattwise/energy/+", "wattwise/energy/", true}, // level kosong tetap level
+		{"wattwise/+/data", "wattwise/kitchen/data", true},
+		{"wattwise/+/data", "wattwise/kitchen/status", false},
+		{"+/+", "/energy", true},
+		{"wattwise/energy/#", "wattwise/energy/kitchen", true},
+		{"wattwise/energy/#", "wattwise/energy/kitchen/plug", true},
+		{"wattwise/energy/#", "wattwise/energy", true}, // # juga cocok dengan parent
+		{"wattwise/energy/#", "wattwise/other/kitchen", false},
+		{"#", "wattwise/energy/kitchen", true},
+		{"+", "esp32", true},
+		{"+", "wattwise/energy", false},
+	}
+	for _, tt := range tests {
+		if got := topicMatches(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("topicMatches(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestDeviceFromTopic(t *testing.T) {
+	tests := []struct {
+		name    string
+		topic   string
+		filters []string
+		want    string
+	}{
+		{"kitchen on +", "wattwise/energy/kitchen", []string{"wattwise/energy/+"}, "kitchen"},
+		{"kitchen on #", "wattwise/energy/kitchen", []string{"wattwise/energy/#"}, "kitchen"},
+		{"deepest level on #", "wattwise/energy/kitchen/plug", []string{"wattwise/energy/#"}, "plug"},
+		{"# matching no level", "wattwise/energy", []string{"wattwise/energy/#"}, ""},
+		{"plain filter carries no id", "esp32", []string{"esp32"}, ""},
+		{"plain filter before a wildcard one", "wattwise/energy/kitchen", []string{"esp32", "wattwise/energy/+"}, "kitchen"},
+		{"plain filter of the same topic", "wattwise/energy", []string{"wattwise/energy", "wattwise/energy/+"}, ""},
+		{"no filter matches", "other/kitchen", []string{"wattwise/energy/+"}, ""},
+		{"single-level wildcard", "kitchen", []string{"+"}, "kitchen"},
+		{"no filters", "wattwise/energy/kitchen", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := deviceFromTopic(tt.topic, tt.filters); got != tt.want {
+			t.Errorf("%s: deviceFromTopic(%q, %q) = %q, want %q", tt.name, tt.topic, tt.filters, got, tt.want)
+		}
+	}
+}
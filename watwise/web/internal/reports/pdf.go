@@ -0,0 +1,343 @@
+// Package reports renders a models.MonthlyReport as PDF or XLSX. Both writers
+// are hand-rolled on the standard library instead of gofpdf (archived, no
+// longer maintained) and excelize (a large dependency tree for three plain
+// sheets): the report only needs text, lines, a bar chart and inline-string
+// cells. reports_test.go checks that the output parses as a valid file.
+package reports
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"wattwise/internal/models"
+)
+
+// ContentTypePDF is the media type of PDF
+const ContentTypePDF = "application/pdf"
+
+// A4 in points
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+	margin     = 50.0
+)
+
+// Fonts: the standard Helvetica pair, no embedding needed
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+)
+
+// PDF writes report as a two-page A4 document: summary, daily consumption
+// chart and cost blocks on the first page, the daily table on the second
+func PDF(w io.Writer, report *models.MonthlyReport) error {
+	pages := []*pdfPage{summaryPage(report), dailyPage(report)}
+	return writePDF(w, pages)
+}
+
+func summaryPage(r *models.MonthlyReport) *pdfPage {
+	p := &pdfPage{}
+	y := pageHeight - margin - 2
+	p.text(fontBold, 18, margin, y, "Wattwise - Monthly Energy Report")
+	y -= 22
+	p.text(fontRegular, 10, margin, y, fmt.Sprintf("Device: %s (%s)    Month: %s    Timezone: %s", r.DeviceName, r.DeviceID, r.Month, r.Timezone))
+	y -= 14
+	p.text(fontRegular, 10, margin, y, "Generated: "+r.GeneratedAt.Format("2006-01-02 15:04"))
+
+	peak := "not enough readings"
+	if r.PeakDemand != nil {
+		peak = fmt.Sprintf("%s kW at %s", formatNumber(r.PeakDemand.AverageKW, 3),
+			r.PeakDemand.Start.In(r.GeneratedAt.Location()).Format("2006-01-02 15:04"))
+	}
+	rows := [][2]string{
+		{"Total energy", formatNumber(r.TotalEnergy, 3) + " kWh"},
+		{"Average per day", fmt.Sprintf("%s kWh (%d days with data)", formatNumber(r.AvgDailyEnergy, 3), r.DaysWithData)},
+		{"Total cost", r.TotalCost.Formatted},
+		{"Carbon emissions", fmt.Sprintf("%s kg CO2 (%s kg/kWh)", formatNumber(r.CarbonKg, 2), formatNumber(r.CarbonKgPerKWh, 3))},
+		{fmt.Sprintf("Peak demand (%d min)", r.DemandWindowMinutes), peak},
+		{"Standby", fmt.Sprintf("%s W, %s kWh", formatNumber(r.StandbyPower, 1), formatNumber(r.StandbyEnergy, 3))},
+	}
+	y -= 34
+	for _, row := range rows {
+		p.text(fontBold, 11, margin, y, row[0])
+		p.text(fontRegular, 11, margin+160, y, row[1])
+		y -= 17
+	}
+
+	y -= 20
+	p.text(fontBold, 12, margin, y, "Daily consumption (kWh)")
+	chartTop := y - 14
+	p.barChart(margin+30, chartTop-240, pageWidth-2*margin-30, 240, r.Daily)
+
+	y = chartTop - 240 - 40
+	p.text(fontBold, 12, margin, y, "Cost by time of use")
+	y -= 18
+	columns := []float64{margin, margin + 100, margin + 300, margin + 390, pageWidth - margin}
+	p.text(fontBold, 10, columns[0], y, "Block")
+	p.text(fontBold, 10, columns[1], y, "Hours")
+	p.textRight(fontBold, 10, columns[2], y, "Rate/kWh")
+	p.textRight(fontBold, 10, columns[3], y, "kWh")
+	p.textRight(fontBold, 10, columns[4], y, "Cost")
+	p.line(margin, y-4, pageWidth-margin, y-4, 0.5)
+	for _, block := range r.CostBlocks {
+		y -= 15
+		p.text(fontRegular, 10, columns[0], y, block.Block)
+		p.text(fontRegular, 10, columns[1], y, block.Hours)
+		p.textRight(fontRegular, 10, columns[2], y, formatNumber(block.RatePerKWh, 2))
+		p.textRight(fontRegular, 10, columns[3], y, formatNumber(block.KWh, 3))
+		p.textRight(fontRegular, 10, columns[4], y, block.CostMoney.Formatted)
+	}
+	return p
+}
+
+func dailyPage(r *models.MonthlyReport) *pdfPage {
+	p := &pdfPage{}
+	y := pageHeight - margin - 2
+	p.text(fontBold, 14, margin, y, fmt.Sprintf("Daily breakdown - %s, %s", r.DeviceName, r.Month))
+	y -= 28
+
+	columns := []float64{margin, margin + 150, margin + 230, margin + 310, margin + 390, pageWidth - margin}
+	p.text(fontBold, 10, columns[0], y, "Date")
+	for i, name := range []string{"kWh", "Avg W", "Max W", "Min W", "Cost"} {
+		p.textRight(fontBold, 10, columns[i+1], y, name)
+	}
+	p.line(margin, y-4, pageWidth-margin, y-4, 0.5)
+	for _, day := range r.Daily {
+		y -= 15
+		p.text(fontRegular, 10, columns[0], y, day.Date)
+		p.textRight(fontRegular, 10, columns[1], y, formatNumber(day.TotalEnergy, 3))
+		p.textRight(fontRegular, 10, columns[2], y, formatNumber(day.AvgPower, 1))
+		p.textRight(fontRegular, 10, columns[3], y, formatNumber(day.MaxPower, 1))
+		p.textRight(fontRegular, 10, columns[4], y, formatNumber(day.MinPower, 1))
+		p.textRight(fontRegular, 10, columns[5], y, day.TotalCostMoney.Formatted)
+	}
+	p.line(margin, y-6, pageWidth-margin, y-6, 0.5)
+	y -= 20
+	p.text(fontBold, 10, columns[0], y, "Total")
+	p.textRight(fontBold, 10, columns[1], y, formatNumber(r.TotalEnergy, 3))
+	p.textRight(fontBold, 10, columns[5], y, r.TotalCost.Formatted)
+	return p
+}
+
+// pdfPage collects the content stream of one page
+type pdfPage struct {
+	content bytes.Buffer
+}
+
+func (p *pdfPage) text(font string, size, x, y float64, s string) {
+	fmt.Fprintf(&p.content, "BT /%s %g Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfString(s))
+}
+
+// textRight ends s at x; widths are Helvetica's, close enough for the bold
+// face and the digits/labels used here
+func (p *pdfPage) textRight(font string, size, x, y float64, s string) {
+	p.text(font, size, x-textWidth(s, size), y, s)
+}
+
+func (p *pdfPage) line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%g w %.2f %.2f m %.2f %.2f l S\n", width, x1, y1, x2, y2)
+}
+
+// barChart draws one bar per day into the box (x, y, w, h), with a scale of
+// four gridlines on the left and the day of month under each bar
+func (p *pdfPage) barChart(x, y, w, h float64, days []*models.DailySummary) {
+	maxKWh := 0.0
+	for _, day := range days {
+		maxKWh = math.Max(maxKWh, day.TotalEnergy)
+	}
+	top := niceCeil(maxKWh)
+
+	p.content.WriteString("0.85 G\n")
+	for i := 1; i <= 4; i++ {
+		gy := y + h*float64(i)/4
+		p.line(x, gy, x+w, gy, 0.4)
+	}
+	p.content.WriteString("0 G\n")
+	p.line(x, y, x+w, y, 0.8)
+	p.line(x, y, x, y+h, 0.8)
+	for i := 0; i <= 4; i++ {
+		value := top * float64(i) / 4
+		p.textRight(fontRegular, 7, x-4, y+h*float64(i)/4-2, formatNumber(value, decimalsFor(top)))
+	}
+
+	if len(days) == 0 {
+		p.text(fontRegular, 10, x+w/2-40, y+h/2, "No readings")
+		return
+	}
+	slot := w / float64(len(days))
+	barWidth := slot * 0.7
+	p.content.WriteString("0.18 0.49 0.84 rg\n")
+	for i, day := range days {
+		bx := x + float64(i)*slot + (slot-barWidth)/2
+		if bh := h * day.TotalEnergy / top; bh > 0 {
+			fmt.Fprintf(&p.content, "%.2f %.2f %.2f %.2f re f\n", bx, y, barWidth, bh)
+		}
+	}
+	p.content.WriteString("0 g\n")
+	for i, day := range days {
+		label := day.Date
+		if len(label) >= 2 {
+			label = strings.TrimPrefix(label[len(label)-2:], "0")
+		}
+		p.text(fontRegular, 6, x+float64(i)*slot+slot/2-textWidth(label, 6)/2, y-9, label)
+	}
+}
+
+// writePDF lays out catalog, page tree, fonts and one page + content stream
+// object per page, followed by the xref table
+func writePDF(w io.Writer, pages []*pdfPage) error {
+	out := &countingWriter{w: w}
+	var offsets []int64
+	object := func(body string) {
+		offsets = append(offsets, out.n)
+		fmt.Fprintf(out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	fmt.Fprint(out, "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %g %g] /Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fontRegular, fontBold, 6+2*i))
+
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(page.content.Bytes()); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		offsets = append(offsets, out.n)
+		fmt.Fprintf(out, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", len(offsets), compressed.Len())
+		out.Write(compressed.Bytes())
+		fmt.Fprint(out, "\nendstream\nendobj\n")
+	}
+
+	xref := out.n
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.err
+}
+
+// countingWriter tracks the byte offsets the xref table needs and keeps the
+// first write error so writePDF can check once at the end
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
+
+// pdfString escapes s for a literal string in WinAnsiEncoding; runes outside
+// Latin-1 become '?'
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20:
+			b.WriteByte(' ')
+		case r < 0x80:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// textWidth estimates the width of s in Helvetica at size points
+func textWidth(s string, size float64) float64 {
+	units := 0
+	for _, r := range s {
+		switch {
+		case r == '.' || r == ',' || r == ' ' || r == 'i' || r == 'l' || r == '/':
+			units += 278
+		case r == '-' || r == '(' || r == ')':
+			units += 333
+		case r == 'W' || r == 'M' || r == 'm':
+			units += 833
+		case r >= 'A' && r <= 'Z':
+			units += 667
+		default:
+			units += 556
+		}
+	}
+	return float64(units) * size / 1000
+}
+
+// niceCeil rounds v up to 1, 2, 2.5 or 5 times a power of ten so the chart
+// scale reads well; 0 gives 1
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	exp := math.Pow10(int(math.Floor(math.Log10(v))))
+	for _, step := range []float64{1, 2, 2.5, 5, 10} {
+		if v <= step*exp {
+			return step * exp
+		}
+	}
+	return 10 * exp
+}
+
+func decimalsFor(top float64) int {
+	switch {
+	case top >= 10:
+		return 0
+	case top >= 1:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// formatNumber formats v with thousands separators, e.g. 12,345.678
+func formatNumber(v float64, decimals int) string {
+	s := strconv.FormatFloat(math.Abs(v), 'f', decimals, 64)
+	intPart, frac, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	if v < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, d := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	if frac != "" {
+		b.WriteByte('.')
+		b.WriteString(frac)
+	}
+	return b.String()
+}
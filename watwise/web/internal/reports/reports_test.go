@@ -0,0 +1,296 @@
+package reports
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"wattwise/internal/models"
+)
+
+// dummyReport is a January report with days daily rows, one of them with a
+// name outside Latin-1 to exercise escaping
+func dummyReport(days int) *models.MonthlyReport {
+	wib := time.FixedZone("WIB", 7*3600)
+	idr := models.Currency{Code: "IDR"}
+	r := &models.MonthlyReport{
+		DeviceID:    "A",
+		DeviceName:  `Panel <utama> & "dapur" (lt. 2) ⚡`,
+		Month:       "2025-01",
+		Timezone:    "Asia/Jakarta",
+		GeneratedAt: time.Date(2025, 2, 1, 8, 0, 0, 0, wib),
+
+		TotalEnergy:  123.456,
+		TotalCost:    idr.Money(178354.5),
+		DaysWithData: days,
+
+		CarbonKg:       97.53,
+		CarbonKgPerKWh: 0.79,
+
+		PeakDemand:          &models.DemandWindow{Start: time.Date(2025, 1, 14, 18, 0, 0, 0, wib), AverageKW: 2.5},
+		DemandWindowMinutes: 15,
+
+		CostBlocks: []models.CostBlock{
+			{Block: "off-peak", Hours: "22:00-17:00", RatePerKWh: 1444.7, KWh: 100, CostMoney: idr.Money(144470)},
+			{Block: "peak", Hours: "17:00-22:00", RatePerKWh: 1444.7, KWh: 23.456, CostMoney: idr.Money(33884.5)},
+		},
+	}
+	for day := 1; day <= days; day++ {
+		r.Daily = append(r.Daily, &models.DailySummary{
+			DeviceID:       "A",
+			Date:           fmt.Sprintf("2025-01-%02d", day),
+			TotalEnergy:    float64(day) * 0.5,
+			AvgPower:       200,
+			MaxPower:       1500,
+			MinPower:       10,
+			TotalCostMoney: idr.Money(float64(day) * 722.35),
+		})
+	}
+	if days > 0 {
+		r.AvgDailyEnergy = r.TotalEnergy / float64(days)
+	}
+	return r
+}
+
+var pdfObject = regexp.MustCompile(`^(\d+) 0 obj\n`)
+
+// parsePDF checks the structure a reader relies on — header, xref table
+// offsets, trailer, stream lengths — and returns the decompressed content
+// streams
+func parsePDF(t *testing.T, b []byte) (catalog string, contents []string) {
+	t.Helper()
+	if !bytes.HasPrefix(b, []byte("%PDF-1.")) {
+		t.Fatalf("no PDF header: %q", b[:min(len(b), 16)])
+	}
+	if !bytes.HasSuffix(b, []byte("%%EOF\n")) {
+		t.Fatalf("no %%%%EOF at the end: %q", b[max(0, len(b)-16):])
+	}
+
+	i := bytes.LastIndex(b, []byte("startxref\n"))
+	if i < 0 {
+		t.Fatal("no startxref")
+	}
+	xref, err := strconv.Atoi(strings.Fields(string(b[i+len("startxref\n"):]))[0])
+	if err != nil || xref >= len(b) || !bytes.HasPrefix(b[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table (%v)", xref, err)
+	}
+
+	lines := strings.Split(string(b[xref:]), "\n")
+	var first, count int
+	if _, err := fmt.Sscanf(lines[1], "%d %d", &first, &count); err != nil || first != 0 {
+		t.Fatalf("xref subsection %q: %v", lines[1], err)
+	}
+	if !strings.Contains(string(b[xref:]), fmt.Sprintf("/Size %d /Root 1 0 R", count)) {
+		t.Errorf("trailer does not match %d xref entries", count)
+	}
+	// Entri xref panjangnya tepat 20 byte termasuk "\r\n" atau " \n"
+	for n := 1; n < count; n++ {
+		entry := lines[2+n]
+		if len(entry)+1 != 20 || !strings.HasSuffix(entry, " n ") {
+			t.Fatalf("xref entry %d = %q, want 20 bytes in use", n, entry)
+		}
+		offset, _ := strconv.Atoi(entry[:10])
+		m := pdfObject.FindSubmatch(b[offset:])
+		if m == nil || string(m[1]) != strconv.Itoa(n) {
+			t.Fatalf("xref entry %d points at %q", n, b[offset:min(len(b), offset+12)])
+		}
+		end := bytes.Index(b[offset:], []byte("\nendobj\n"))
+		body := string(b[offset+len(m[0]) : offset+end])
+		if n == 1 {
+			catalog = body
+		}
+
+		var length int
+		if _, err := fmt.Sscanf(body, "<< /Length %d /Filter /FlateDecode >>\nstream\n", &length); err != nil {
+			continue
+		}
+		start := strings.Index(body, "stream\n") + len("stream\n")
+		if !strings.HasPrefix(body[start+length:], "\nendstream") {
+			t.Fatalf("object %d: /Length %d does not end at endstream", n, length)
+		}
+		zr, err := zlib.NewReader(strings.NewReader(body[start : start+length]))
+		if err != nil {
+			t.Fatalf("object %d: %v", n, err)
+		}
+		content, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("object %d: %v", n, err)
+		}
+		contents = append(contents, string(content))
+	}
+	return catalog, contents
+}
+
+func TestPDF(t *testing.T) {
+	for _, days := range []int{31, 0} {
+		t.Run(fmt.Sprintf("%d days", days), func(t *testing.T) {
+			report := dummyReport(days)
+			if days == 0 {
+				report.PeakDemand = nil
+			}
+			var b bytes.Buffer
+			if err := PDF(&b, report); err != nil {
+				t.Fatal(err)
+			}
+
+			catalog, contents := parsePDF(t, b.Bytes())
+			if catalog != "<< /Type /Catalog /Pages 2 0 R >>" {
+				t.Errorf("object 1 = %q, want the catalog", catalog)
+			}
+			if !bytes.Contains(b.Bytes(), []byte("/Count 2 >>")) || len(contents) != 2 {
+				t.Fatalf("%d content streams, want 2 pages", len(contents))
+			}
+			summary, daily := contents[0], contents[1]
+			for _, want := range []string{"(Total energy)", "(123.456 kWh)", "(Cost by time of use)", `Panel <utama> & "dapur" \(lt. 2\) ? \(A\)`} {
+				if !strings.Contains(summary, want) {
+					t.Errorf("summary page has no %s", want)
+				}
+			}
+			if strings.Count(daily, "(2025-01-") != days {
+				t.Errorf("daily page has %d date rows, want %d", strings.Count(daily, "(2025-01-"), days)
+			}
+			if days == 0 && !strings.Contains(summary, "(not enough readings)") {
+				t.Error("summary page does not say the peak demand is missing")
+			}
+		})
+	}
+}
+
+// readXLSX opens b as a zip and parses every part as XML
+func readXLSX(t *testing.T, b []byte) map[string][]byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+		}
+		parts[f.Name] = content
+	}
+	return parts
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R      string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// cells maps the cell references of a worksheet to their values
+func cells(t *testing.T, part []byte) (map[string]string, int) {
+	t.Helper()
+	var sheet xlsxWorksheet
+	if err := xml.Unmarshal(part, &sheet); err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{}
+	for i, row := range sheet.Rows {
+		if row.R != i+1 {
+			t.Fatalf("row %d has r=%d", i+1, row.R)
+		}
+		for _, c := range row.Cells {
+			if c.Type == "inlineStr" {
+				values[c.R] = c.Inline
+			} else {
+				values[c.R] = c.Value
+			}
+		}
+	}
+	return values, len(sheet.Rows)
+}
+
+func TestXLSX(t *testing.T) {
+	report := dummyReport(31)
+	var b bytes.Buffer
+	if err := XLSX(&b, report); err != nil {
+		t.Fatal(err)
+	}
+	parts := readXLSX(t, b.Bytes())
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml",
+		"xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml", "xl/worksheets/sheet3.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("no %s in the workbook", name)
+		}
+		// Setiap part selain content types harus terdaftar di sana
+		if strings.HasPrefix(name, "xl/") && !strings.Contains(name, "_rels") &&
+			!bytes.Contains(parts["[Content_Types].xml"], []byte(`PartName="/`+name+`"`)) {
+			t.Errorf("%s has no content type override", name)
+		}
+	}
+
+	var wb struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(parts["xl/workbook.xml"], &wb); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"Summary", "Daily", "Cost"} {
+		if i >= len(wb.Sheets) || wb.Sheets[i].Name != want {
+			t.Fatalf("sheets = %+v, want Summary, Daily, Cost", wb.Sheets)
+		}
+		rel := fmt.Sprintf(`Id="%s" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"`, wb.Sheets[i].RID, i+1)
+		if !bytes.Contains(parts["xl/_rels/workbook.xml.rels"], []byte(rel)) {
+			t.Errorf("sheet %s: relationship %s does not point at sheet%d.xml", want, wb.Sheets[i].RID, i+1)
+		}
+	}
+
+	summary, _ := cells(t, parts["xl/worksheets/sheet1.xml"])
+	if summary["B3"] != report.DeviceName || summary["A9"] != "Total energy" || summary["B9"] != "123.456" || summary["C12"] != "IDR" {
+		t.Errorf("summary cells = %v", summary)
+	}
+
+	daily, rows := cells(t, parts["xl/worksheets/sheet2.xml"])
+	if rows != 1+len(report.Daily) {
+		t.Fatalf("daily sheet has %d rows, want a header and %d days", rows, len(report.Daily))
+	}
+	if daily["A1"] != "Date" || daily["F1"] != "Cost (IDR)" || daily["A32"] != "2025-01-31" || daily["B32"] != "15.5" {
+		t.Errorf("daily cells = A1 %q F1 %q A32 %q B32 %q", daily["A1"], daily["F1"], daily["A32"], daily["B32"])
+	}
+
+	cost, rows := cells(t, parts["xl/worksheets/sheet3.xml"])
+	if rows != 3 || cost["A3"] != "peak" || cost["D3"] != "23.456" {
+		t.Errorf("cost sheet = %d rows %v, want a header and 2 blocks", rows, cost)
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 5: "F", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) = %s, want %s", i, got, want)
+		}
+	}
+}
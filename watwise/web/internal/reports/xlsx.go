@@ -0,0 +1,230 @@
+package reports
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"wattwise/internal/models"
+)
+
+// ContentTypeXLSX is the media type of XLSX
+const ContentTypeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// Cell styles of styles.xml
+const (
+	styleDefault = iota
+	styleBold
+	styleNumber2 // #,##0.00
+	styleNumber3 // #,##0.000
+)
+
+type xlsxCell struct {
+	value interface{} // string, float64 or int
+	style int
+}
+
+type xlsxSheet struct {
+	name   string
+	widths []float64
+	rows   [][]xlsxCell
+}
+
+func (s *xlsxSheet) row(cells ...xlsxCell) {
+	s.rows = append(s.rows, cells)
+}
+
+func text(v string) xlsxCell { return xlsxCell{value: v} }
+func bold(v string) xlsxCell { return xlsxCell{value: v, style: styleBold} }
+func num(v float64) xlsxCell { return xlsxCell{value: v, style: styleNumber2} }
+func kwh(v float64) xlsxCell { return xlsxCell{value: v, style: styleNumber3} }
+func integer(v int) xlsxCell { return xlsxCell{value: v} }
+
+func header(names ...string) []xlsxCell {
+	cells := make([]xlsxCell, len(names))
+	for i, name := range names {
+		cells[i] = bold(name)
+	}
+	return cells
+}
+
+// XLSX writes report as a workbook with the sheets Summary, Daily and Cost
+func XLSX(w io.Writer, report *models.MonthlyReport) error {
+	sheets := []*xlsxSheet{summarySheet(report), dailySheet(report), costSheet(report)}
+
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{"[Content_Types].xml", contentTypes(len(sheets))},
+		{"_rels/.rels", []byte(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`)},
+		{"xl/workbook.xml", workbook(sheets)},
+		{"xl/_rels/workbook.xml.rels", workbookRels(len(sheets))},
+		{"xl/styles.xml", []byte(stylesXML)},
+	}
+	for i, sheet := range sheets {
+		files = append(files, struct {
+			name    string
+			content []byte
+		}{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), sheet.xml()})
+	}
+
+	for _, file := range files {
+		f, err := zw.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(file.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func summarySheet(r *models.MonthlyReport) *xlsxSheet {
+	s := &xlsxSheet{name: "Summary", widths: []float64{28, 24, 10}}
+	s.row(bold("Wattwise monthly energy report"))
+	s.row()
+	s.row(text("Device"), text(r.DeviceName))
+	s.row(text("Device ID"), text(r.DeviceID))
+	s.row(text("Month"), text(r.Month))
+	s.row(text("Timezone"), text(r.Timezone))
+	s.row(text("Generated"), text(r.GeneratedAt.Format("2006-01-02 15:04")))
+	s.row()
+	s.row(text("Total energy"), kwh(r.TotalEnergy), text("kWh"))
+	s.row(text("Average per day"), kwh(r.AvgDailyEnergy), text("kWh"))
+	s.row(text("Days with data"), integer(r.DaysWithData))
+	s.row(text("Total cost"), num(r.TotalCost.Amount), text(r.TotalCost.Currency.Code))
+	s.row(text("Carbon emissions"), num(r.CarbonKg), text("kg CO2"))
+	s.row(text("Emission factor"), kwh(r.CarbonKgPerKWh), text("kg/kWh"))
+	s.row(text("Standby power"), num(r.StandbyPower), text("W"))
+	s.row(text("Standby energy"), kwh(r.StandbyEnergy), text("kWh"))
+	if r.PeakDemand != nil {
+		s.row(text(fmt.Sprintf("Peak demand (%d min)", r.DemandWindowMinutes)), kwh(r.PeakDemand.AverageKW), text("kW"))
+		s.row(text("Peak demand at"), text(r.PeakDemand.Start.In(r.GeneratedAt.Location()).Format("2006-01-02 15:04")))
+	} else {
+		s.row(text(fmt.Sprintf("Peak demand (%d min)", r.DemandWindowMinutes)), text("not enough readings"))
+	}
+	return s
+}
+
+func dailySheet(r *models.MonthlyReport) *xlsxSheet {
+	s := &xlsxSheet{name: "Daily", widths: []float64{12, 14, 14, 14, 14, 16}}
+	s.row(header("Date", "Energy (kWh)", "Avg power (W)", "Max power (W)", "Min power (W)", "Cost ("+r.TotalCost.Currency.Code+")")...)
+	for _, day := range r.Daily {
+		s.row(text(day.Date), kwh(day.TotalEnergy), num(day.AvgPower), num(day.MaxPower), num(day.MinPower), num(day.TotalCostMoney.Amount))
+	}
+	return s
+}
+
+func costSheet(r *models.MonthlyReport) *xlsxSheet {
+	s := &xlsxSheet{name: "Cost", widths: []float64{14, 14, 14, 14, 16}}
+	s.row(header("Block", "Hours", "Rate per kWh", "Energy (kWh)", "Cost ("+r.TotalCost.Currency.Code+")")...)
+	for _, block := range r.CostBlocks {
+		s.row(text(block.Block), text(block.Hours), num(block.RatePerKWh), kwh(block.KWh), num(block.CostMoney.Amount))
+	}
+	return s
+}
+
+func (s *xlsxSheet) xml() []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if len(s.widths) > 0 {
+		b.WriteString("<cols>")
+		for i, width := range s.widths {
+			fmt.Fprintf(&b, `<col min="%d" max="%d" width="%g" customWidth="1"/>`, i+1, i+1, width)
+		}
+		b.WriteString("</cols>")
+	}
+	b.WriteString("<sheetData>")
+	for i, row := range s.rows {
+		fmt.Fprintf(&b, `<row r="%d">`, i+1)
+		for j, cell := range row {
+			ref := columnName(j) + strconv.Itoa(i+1)
+			switch v := cell.value.(type) {
+			case string:
+				fmt.Fprintf(&b, `<c r="%s" t="inlineStr" s="%d"><is><t>`, ref, cell.style)
+				xml.EscapeText(&b, []byte(v))
+				b.WriteString("</t></is></c>")
+			case float64:
+				fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, cell.style, strconv.FormatFloat(v, 'f', -1, 64))
+			case int:
+				fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%d</v></c>`, ref, cell.style, v)
+			}
+		}
+		b.WriteString("</row>")
+	}
+	b.WriteString("</sheetData></worksheet>")
+	return b.Bytes()
+}
+
+// columnName: 0 -> A, 25 -> Z, 26 -> AA
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func contentTypes(sheets int) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	b.WriteString(`</Types>`)
+	return b.Bytes()
+}
+
+func workbook(sheets []*xlsxSheet) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, sheet := range sheets {
+		b.WriteString(`<sheet name="`)
+		xml.EscapeText(&b, []byte(sheet.name))
+		fmt.Fprintf(&b, `" sheetId="%d" r:id="rId%d"/>`, i+1, i+1)
+	}
+	b.WriteString(`</sheets></workbook>`)
+	return b.Bytes()
+}
+
+func workbookRels(sheets int) []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, sheets+1)
+	b.WriteString(`</Relationships>`)
+	return b.Bytes()
+}
+
+// Order of cellXfs matches the style* constants
+const stylesXML = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="#,##0.000"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="4">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
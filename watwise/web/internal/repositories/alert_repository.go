@@ -0,0 +1,110 @@
+package repositories
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"wattwise/internal/models"
+)
+
+// DefaultMaxAlerts is how many alerts AlertRepository keeps; older ones are dropped
+const DefaultMaxAlerts = 1000
+
+// AlertRepository keeps the most recent alerts, persisted to a JSON file like
+// DeviceRepository. An empty path keeps everything in memory only.
+type AlertRepository struct {
+	path   string
+	max    int
+	mu     sync.RWMutex
+	alerts []models.AlertData // oldest first
+}
+
+func NewAlertRepository(path string, max int) (*AlertRepository, error) {
+	if max <= 0 {
+		max = DefaultMaxAlerts
+	}
+	repo := &AlertRepository{path: path, max: max}
+	if path == "" {
+		return repo, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return repo, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(raw, &repo.alerts); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	repo.trim()
+	return repo, nil
+}
+
+// Add appends an alert, dropping the oldest when the store is full
+func (r *AlertRepository) Add(alert models.AlertData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.alerts = append(r.alerts, alert)
+	r.trim()
+	return r.save()
+}
+
+// List returns up to limit alerts, newest first. An empty deviceID matches all
+// devices and an empty severity all severities; limit <= 0 returns
+// everything. Alerts stored without a severity get their type's default.
+func (r *AlertRepository) List(deviceID, severity string, limit int) []models.AlertData {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []models.AlertData{}
+	for i := len(r.alerts) - 1; i >= 0; i-- {
+		alert := r.alerts[i]
+		if deviceID != "" && alert.DeviceID != deviceID {
+			continue
+		}
+		alert.Severity = alert.SeverityOrDefault()
+		if severity != "" && alert.Severity != severity {
+			continue
+		}
+		result = append(result, alert)
+		if limit > 0 && len(result) == limit {
+			break
+		}
+	}
+	return result
+}
+
+func (r *AlertRepository) trim() {
+	if extra := len(r.alerts) - r.max; extra > 0 {
+		r.alerts = append([]models.AlertData(nil), r.alerts[extra:]...)
+	}
+}
+
+// save writes the whole store atomically; must be called with r.mu held
+func (r *AlertRepository) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	raw, err := json.Marshal(r.alerts)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
@@ -0,0 +1,165 @@
+package repositories
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"wattwise/internal/models"
+)
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// lastUsedSaveInterval: Use writes last_used_at to disk at most this often
+// per key, not on every authenticated request
+const lastUsedSaveInterval = time.Minute
+
+// apiKeyRecord is a key as stored on disk: its metadata and the SHA-256
+// hash of the key, never the key itself
+type apiKeyRecord struct {
+	models.APIKey
+	Hash string `json:"hash"`
+}
+
+// APIKeyRepository keeps API keys indexed by the SHA-256 hash of the key,
+// persisted to a JSON file like UserRepository. An empty path keeps
+// everything in memory only.
+type APIKeyRepository struct {
+	path   string
+	mu     sync.RWMutex
+	byHash map[string]*models.APIKey
+	byID   map[string]string // id -> hash
+}
+
+func NewAPIKeyRepository(path string) (*APIKeyRepository, error) {
+	repo := &APIKeyRepository{
+		path:   path,
+		byHash: make(map[string]*models.APIKey),
+		byID:   make(map[string]string),
+	}
+	if path == "" {
+		return repo, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return repo, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	var records []apiKeyRecord
+	if err := json.Unmarshal(raw, &records); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, record := range records {
+		if record.ID == "" || record.Hash == "" {
+			return nil, fmt.Errorf("parse %s: key without id or hash", path)
+		}
+		key := record.APIKey
+		repo.byHash[record.Hash] = &key
+		repo.byID[key.ID] = record.Hash
+	}
+	return repo, nil
+}
+
+// List returns all keys, newest first
+func (r *APIKeyRepository) List() []models.APIKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]models.APIKey, 0, len(r.byHash))
+	for _, k := range r.byHash {
+		keys = append(keys, *k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys
+}
+
+func (r *APIKeyRepository) Create(key models.APIKey, hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.byHash[hash] = &key
+	r.byID[key.ID] = hash
+
+	if err := r.save(); err != nil {
+		delete(r.byHash, hash)
+		delete(r.byID, key.ID)
+		return err
+	}
+	return nil
+}
+
+// Use looks a key up by hash and records now as its last use. The last use
+// is written to disk at most every lastUsedSaveInterval; a failed write only
+// loses that timestamp and does not fail the lookup.
+func (r *APIKeyRepository) Use(hash string, now time.Time) (models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.byHash[hash]
+	if !ok {
+		return models.APIKey{}, ErrAPIKeyNotFound
+	}
+	stale := key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedSaveInterval
+	if stale {
+		key.LastUsedAt = &now
+		_ = r.save()
+	}
+	return *key, nil
+}
+
+func (r *APIKeyRepository) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hash, ok := r.byID[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	key := r.byHash[hash]
+	delete(r.byHash, hash)
+	delete(r.byID, id)
+
+	if err := r.save(); err != nil {
+		r.byHash[hash] = key
+		r.byID[id] = hash
+		return err
+	}
+	return nil
+}
+
+// save writes all keys atomically; must be called with r.mu held. The file
+// holds key hashes, so it is only readable by the owner.
+func (r *APIKeyRepository) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	records := make([]apiKeyRecord, 0, len(r.byHash))
+	for hash, key := range r.byHash {
+		records = append(records, apiKeyRecord{APIKey: *key, Hash: hash})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].CreatedAt.Before(records[j].CreatedAt) })
+
+	raw, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
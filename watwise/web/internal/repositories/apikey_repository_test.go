@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"wattwise/internal/models"
+)
+
+func TestAPIKeyRepositoryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apikeys.json")
+	repo, err := NewAPIKeyRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Now().Truncate(time.Second)
+	if err := repo.Create(models.APIKey{ID: "k1", Name: "grafana", Scope: models.ScopeRead, CreatedAt: created}, "hash1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Create(models.APIKey{ID: "k2", Name: "script", Scope: models.ScopeReadWrite, CreatedAt: created.Add(time.Second)}, "hash2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete("k2"); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := os.ReadFile(path)
+	if strings.Contains(string(raw), "ww_") {
+		t.Errorf("file contains a plain key: %s", raw)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("file mode = %v (%v), want 0600", info.Mode().Perm(), err)
+	}
+
+	// Setelah restart key lama tetap berlaku
+	reloaded, err := NewAPIKeyRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := reloaded.Use("hash1", created.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Use after reload: %v", err)
+	}
+	if key.Name != "grafana" || key.Scope != models.ScopeRead || !key.CreatedAt.Equal(created) {
+		t.Errorf("reloaded key = %+v", key)
+	}
+	if _, err := reloaded.Use("hash2", created); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("revoked key: err = %v, want ErrAPIKeyNotFound", err)
+	}
+
+	// last_used_at ikut tersimpan
+	again, _ := NewAPIKeyRepository(path)
+	if keys := again.List(); len(keys) != 1 || keys[0].LastUsedAt == nil || !keys[0].LastUsedAt.Equal(created.Add(time.Hour)) {
+		t.Errorf("last_used_at not persisted: %+v", keys)
+	}
+}
+
+func TestAPIKeyRepositoryInMemory(t *testing.T) {
+	repo, err := NewAPIKeyRepository("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Create(models.APIKey{ID: "k1", Name: "grafana"}, "hash1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Use("hash1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+}
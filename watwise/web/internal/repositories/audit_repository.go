@@ -0,0 +1,174 @@
+package repositories
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"wattwise/internal/models"
+)
+
+// DefaultMaxAuditEvents is how many events AuditRepository keeps at most
+const DefaultMaxAuditEvents = 10000
+
+// AuditRepository is an append-only audit trail: every event is appended to a
+// JSON lines file, which is only rewritten by Trim. An empty path keeps
+// everything in memory only.
+type AuditRepository struct {
+	path   string
+	max    int
+	mu     sync.RWMutex
+	events []models.AuditEvent // oldest first
+	// The file still holds events dropped for max, see Trim
+	stale bool
+}
+
+func NewAuditRepository(path string, max int) (*AuditRepository, error) {
+	if max <= 0 {
+		max = DefaultMaxAuditEvents
+	}
+	repo := &AuditRepository{path: path, max: max}
+	if path == "" {
+		return repo, nil
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return repo, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event models.AuditEvent
+		// Baris terakhir bisa terpotong kalau proses mati saat menulis
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		repo.events = append(repo.events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	if extra := len(repo.events) - repo.max; extra > 0 {
+		repo.events = append([]models.AuditEvent(nil), repo.events[extra:]...)
+		repo.stale = true
+	}
+	return repo, nil
+}
+
+// Append records event; beyond max the oldest are dropped from memory, and
+// from the file on the next Trim
+func (r *AuditRepository) Append(event models.AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event)
+	if len(r.events) > r.max {
+		r.events = r.events[1:]
+		r.stale = true
+	}
+	if r.path == "" {
+		return nil
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Trim drops events older than before and rewrites the file when it holds
+// dropped events; it returns how many events were dropped
+func (r *AuditRepository) Trim(before time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keep := 0
+	for keep < len(r.events) && r.events[keep].Time.Before(before) {
+		keep++
+	}
+	if keep == 0 && !r.stale {
+		return 0, nil
+	}
+	r.events = append([]models.AuditEvent(nil), r.events[keep:]...)
+	if err := r.save(); err != nil {
+		return keep, err
+	}
+	r.stale = false
+	return keep, nil
+}
+
+// List returns the page of events matching filter, newest first, and how many
+// matched in total
+func (r *AuditRepository) List(filter models.AuditFilter) ([]models.AuditEvent, int) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	offset := (max(filter.Page, 1) - 1) * filter.PageSize
+	page := []models.AuditEvent{}
+	total := 0
+	for i := len(r.events) - 1; i >= 0; i-- {
+		event := r.events[i]
+		switch {
+		case !filter.From.IsZero() && event.Time.Before(filter.From),
+			!filter.To.IsZero() && event.Time.After(filter.To),
+			filter.Username != "" && event.Username != filter.Username,
+			filter.Type != "" && event.Type != filter.Type:
+			continue
+		}
+
+		if total >= offset && len(page) < filter.PageSize {
+			page = append(page, event)
+		}
+		total++
+	}
+	return page, total
+}
+
+// save rewrites the file atomically; must be called with r.mu held
+func (r *AuditRepository) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	var buf []byte
+	for _, event := range r.events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
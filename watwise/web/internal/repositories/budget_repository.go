@@ -0,0 +1,197 @@
+package repositories
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"wattwise/internal/models"
+)
+
+var ErrBudgetNotFound = errors.New("budget not found")
+
+// BudgetAlertState is the highest projected-usage threshold (percent) that
+// already alerted for a budget in Month
+type BudgetAlertState struct {
+	Month   string `json:"month"`
+	Percent int    `json:"percent"`
+}
+
+// budgetFile is the on-disk layout; alert state is kept next to the budgets
+// so a restart does not repeat this month's alerts
+type budgetFile struct {
+	Budgets []models.Budget             `json:"budgets"`
+	Alerts  map[string]BudgetAlertState `json:"alerts,omitempty"`
+}
+
+// BudgetRepository keeps monthly budgets keyed by device id ("" = global),
+// persisted to a JSON file like DeviceRepository. An empty path keeps
+// everything in memory only.
+type BudgetRepository struct {
+	path    string
+	mu      sync.RWMutex
+	budgets map[string]models.Budget
+	alerts  map[string]BudgetAlertState
+}
+
+func NewBudgetRepository(path string) (*BudgetRepository, error) {
+	repo := &BudgetRepository{
+		path:    path,
+		budgets: make(map[string]models.Budget),
+		alerts:  make(map[string]BudgetAlertState),
+	}
+	if path == "" {
+		return repo, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return repo, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	var file budgetFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, budget := range file.Budgets {
+		repo.budgets[budget.DeviceID] = budget
+	}
+	for deviceID, state := range file.Alerts {
+		repo.alerts[deviceID] = state
+	}
+	return repo, nil
+}
+
+// List returns all budgets, the global one first
+func (r *BudgetRepository) List() []models.Budget {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.sorted()
+}
+
+func (r *BudgetRepository) Get(deviceID string) (models.Budget, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	budget, ok := r.budgets[deviceID]
+	if !ok {
+		return models.Budget{}, ErrBudgetNotFound
+	}
+	return budget, nil
+}
+
+// Set creates or replaces the budget for budget.DeviceID. A changed unit or
+// limit clears the alert state so the new limit can alert this month.
+func (r *BudgetRepository) Set(budget models.Budget) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, existed := r.budgets[budget.DeviceID]
+	oldState, hadState := r.alerts[budget.DeviceID]
+	r.budgets[budget.DeviceID] = budget
+	if !existed || old.Unit != budget.Unit || old.Limit != budget.Limit {
+		delete(r.alerts, budget.DeviceID)
+	}
+
+	if err := r.save(); err != nil {
+		if existed {
+			r.budgets[budget.DeviceID] = old
+		} else {
+			delete(r.budgets, budget.DeviceID)
+		}
+		if hadState {
+			r.alerts[budget.DeviceID] = oldState
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes a budget together with its alert state
+func (r *BudgetRepository) Delete(deviceID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.budgets[deviceID]
+	if !ok {
+		return ErrBudgetNotFound
+	}
+	oldState, hadState := r.alerts[deviceID]
+	delete(r.budgets, deviceID)
+	delete(r.alerts, deviceID)
+
+	if err := r.save(); err != nil {
+		r.budgets[deviceID] = old
+		if hadState {
+			r.alerts[deviceID] = oldState
+		}
+		return err
+	}
+	return nil
+}
+
+// AlertState returns the last alerted threshold for a budget (zero if none)
+func (r *BudgetRepository) AlertState(deviceID string) BudgetAlertState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.alerts[deviceID]
+}
+
+// SetAlertState records that a budget alerted at state.Percent in state.Month
+func (r *BudgetRepository) SetAlertState(deviceID string, state BudgetAlertState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, existed := r.alerts[deviceID]
+	r.alerts[deviceID] = state
+
+	if err := r.save(); err != nil {
+		if existed {
+			r.alerts[deviceID] = old
+		} else {
+			delete(r.alerts, deviceID)
+		}
+		return err
+	}
+	return nil
+}
+
+// sorted must be called with r.mu held
+func (r *BudgetRepository) sorted() []models.Budget {
+	budgets := make([]models.Budget, 0, len(r.budgets))
+	for _, budget := range r.budgets {
+		budgets = append(budgets, budget)
+	}
+	sort.Slice(budgets, func(i, j int) bool { return budgets[i].DeviceID < budgets[j].DeviceID })
+	return budgets
+}
+
+// save writes the whole store atomically; must be called with r.mu held
+func (r *BudgetRepository) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	raw, err := json.MarshalIndent(budgetFile{Budgets: r.sorted(), Alerts: r.alerts}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"wattwise/internal/models"
+)
+
+// DeadLetterRepository appends notifications that could not be delivered to
+// a JSON lines file, for an operator to inspect or replay by hand. An empty
+// path drops them (the failure is still logged by the caller).
+type DeadLetterRepository struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewDeadLetterRepository(path string) *DeadLetterRepository {
+	return &DeadLetterRepository{path: path}
+}
+
+// Append writes letter as one line
+func (r *DeadLetterRepository) Append(letter models.DeadLetter) error {
+	if r.path == "" {
+		return nil
+	}
+	line, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	// Isi alert bisa memuat nama device/lokasi, jangan world-readable
+	file, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,137 @@
+package repositories
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"wattwise/internal/models"
+)
+
+var (
+	ErrDeviceNotFound = errors.New("device not found")
+	ErrDeviceExists   = errors.New("device already registered")
+)
+
+// DeviceRepository keeps device metadata in memory and persists it to a JSON
+// file. An empty path keeps everything in memory only.
+type DeviceRepository struct {
+	path    string
+	mu      sync.RWMutex
+	devices map[string]models.Device
+}
+
+func NewDeviceRepository(path string) (*DeviceRepository, error) {
+	repo := &DeviceRepository{
+		path:    path,
+		devices: make(map[string]models.Device),
+	}
+	if path == "" {
+		return repo, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return repo, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	var devices []models.Device
+	if err := json.Unmarshal(raw, &devices); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, device := range devices {
+		repo.devices[device.ID] = device
+	}
+	return repo, nil
+}
+
+// List returns all devices sorted by id
+func (r *DeviceRepository) List() []models.Device {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	devices := make([]models.Device, 0, len(r.devices))
+	for _, device := range r.devices {
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	return devices
+}
+
+func (r *DeviceRepository) Get(id string) (models.Device, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	device, ok := r.devices[id]
+	if !ok {
+		return models.Device{}, ErrDeviceNotFound
+	}
+	return device, nil
+}
+
+func (r *DeviceRepository) Create(device models.Device) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.devices[device.ID]; ok {
+		return ErrDeviceExists
+	}
+	r.devices[device.ID] = device
+
+	if err := r.save(); err != nil {
+		delete(r.devices, device.ID)
+		return err
+	}
+	return nil
+}
+
+func (r *DeviceRepository) Update(device models.Device) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.devices[device.ID]
+	if !ok {
+		return ErrDeviceNotFound
+	}
+	r.devices[device.ID] = device
+
+	if err := r.save(); err != nil {
+		r.devices[device.ID] = old
+		return err
+	}
+	return nil
+}
+
+// save writes the whole store atomically; must be called with r.mu held
+func (r *DeviceRepository) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	devices := make([]models.Device, 0, len(r.devices))
+	for _, device := range r.devices {
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+
+	raw, err := json.MarshalIndent(devices, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// SettingsRepository persists runtime setting overrides (PUT
+// /api/admin/settings) as a JSON object of setting name to value. Settings
+// without an override follow .env. An empty path keeps everything in memory
+// only.
+type SettingsRepository struct {
+	path      string
+	mu        sync.Mutex
+	overrides map[string]json.RawMessage
+}
+
+func NewSettingsRepository(path string) (*SettingsRepository, error) {
+	repo := &SettingsRepository{path: path, overrides: make(map[string]json.RawMessage)}
+	if err := repo.Load(); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// Load re-reads the file; a missing file means no overrides
+func (r *SettingsRepository) Load() error {
+	if r.path == "" {
+		return nil
+	}
+
+	raw, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) {
+		r.mu.Lock()
+		r.overrides = make(map[string]json.RawMessage)
+		r.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", r.path, err)
+	}
+
+	overrides := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(raw, &overrides); err != nil {
+		return fmt.Errorf("parse %s: %w", r.path, err)
+	}
+
+	r.mu.Lock()
+	r.overrides = overrides
+	r.mu.Unlock()
+	return nil
+}
+
+// Overrides returns a copy of the stored overrides
+func (r *SettingsRepository) Overrides() map[string]json.RawMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	overrides := make(map[string]json.RawMessage, len(r.overrides))
+	for key, value := range r.overrides {
+		overrides[key] = value
+	}
+	return overrides
+}
+
+// Replace stores overrides as the new set
+func (r *SettingsRepository) Replace(overrides map[string]json.RawMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.save(overrides); err != nil {
+		return err
+	}
+	r.overrides = overrides
+	return nil
+}
+
+// save writes overrides atomically; must be called with r.mu held
+func (r *SettingsRepository) save(overrides map[string]json.RawMessage) error {
+	if r.path == "" {
+		return nil
+	}
+
+	raw, err := json.MarshalIndent(overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
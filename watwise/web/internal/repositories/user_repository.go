@@ -0,0 +1,190 @@
+package repositories
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"wattwise/internal/models"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserExists   = errors.New("user already exists")
+)
+
+// UserRepository keeps accounts with their password hashes (see
+// utils.HashPassword), persisted to a JSON file readable by the owner only.
+// An empty path keeps everything in memory only.
+type UserRepository struct {
+	path   string
+	mu     sync.RWMutex
+	users  map[string]storedUser
+	nextID int
+}
+
+type storedUser struct {
+	user         models.User
+	passwordHash string
+}
+
+// userFile is the on-disk layout
+type userFile struct {
+	NextID int              `json:"next_id"`
+	Users  []userFileRecord `json:"users"`
+}
+
+type userFileRecord struct {
+	models.User
+	PasswordHash string `json:"password_hash"`
+}
+
+func NewUserRepository(path string) (*UserRepository, error) {
+	repo := &UserRepository{path: path, users: make(map[string]storedUser), nextID: 1}
+	if path == "" {
+		return repo, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return repo, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	var file userFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for _, record := range file.Users {
+		repo.users[record.Username] = storedUser{user: record.User, passwordHash: record.PasswordHash}
+		repo.nextID = max(repo.nextID, record.ID+1)
+	}
+	repo.nextID = max(repo.nextID, file.NextID)
+	return repo, nil
+}
+
+// List returns all users sorted by username
+func (r *UserRepository) List() []models.User {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]models.User, 0, len(r.users))
+	for _, u := range r.users {
+		users = append(users, u.user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users
+}
+
+func (r *UserRepository) Get(username string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[username]
+	if !ok {
+		return models.User{}, ErrUserNotFound
+	}
+	return u.user, nil
+}
+
+// PasswordHash returns a user together with the stored password hash
+func (r *UserRepository) PasswordHash(username string) (models.User, string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[username]
+	if !ok {
+		return models.User{}, "", ErrUserNotFound
+	}
+	return u.user, u.passwordHash, nil
+}
+
+// Create stores a new user and assigns its id
+func (r *UserRepository) Create(user models.User, passwordHash string) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[user.Username]; ok {
+		return models.User{}, ErrUserExists
+	}
+	user.ID = r.nextID
+	r.nextID++
+	r.users[user.Username] = storedUser{user: user, passwordHash: passwordHash}
+	if err := r.save(); err != nil {
+		delete(r.users, user.Username)
+		r.nextID--
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// Update replaces a user's data; an empty passwordHash keeps the current one
+func (r *UserRepository) Update(user models.User, passwordHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.users[user.Username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.ID = current.user.ID
+	if passwordHash == "" {
+		passwordHash = current.passwordHash
+	}
+	r.users[user.Username] = storedUser{user: user, passwordHash: passwordHash}
+	if err := r.save(); err != nil {
+		r.users[user.Username] = current
+		return err
+	}
+	return nil
+}
+
+func (r *UserRepository) Delete(username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	delete(r.users, username)
+	if err := r.save(); err != nil {
+		r.users[username] = current
+		return err
+	}
+	return nil
+}
+
+// save rewrites the file atomically; must be called with r.mu held. The
+// file holds password hashes, so only the owner may read it.
+func (r *UserRepository) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	file := userFile{NextID: r.nextID, Users: make([]userFileRecord, 0, len(r.users))}
+	for _, u := range r.users {
+		file.Users = append(file.Users, userFileRecord{User: u.user, PasswordHash: u.passwordHash})
+	}
+	sort.Slice(file.Users, func(i, j int) bool { return file.Users[i].Username < file.Users[j].Username })
+
+	raw, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
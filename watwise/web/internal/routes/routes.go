@@ -1,40 +1,153 @@
 package routes
 
 import (
+	"log/slog"
+	"time"
+	"wattwise/internal/config"
 	"wattwise/internal/database"
+	"wattwise/internal/docs"
 	"wattwise/internal/handlers"
 	"wattwise/internal/middleware"
+	"wattwise/internal/models"
+	"wattwise/internal/mqtt"
+	"wattwise/internal/repositories"
+	"wattwise/internal/services"
+	"wattwise/internal/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
 )
 
 // Setup - Original function (backward compatible)
+// Device registry, budget dan akun hanya di memory, tidak disimpan ke file.
 func Setup(app *fiber.App, db *database.IoTDB) {
-	authHandler := handlers.NewAuthHandler()
-	energyHandler := handlers.NewEnergyHandler(db)
-	wsHandler := handlers.NewWebSocketHandler(db)
+	cfg := config.Load()
+	utils.SetJWTSecret([]byte(cfg.JWT.Secret))
+	utils.SetTokenTTL(time.Duration(cfg.JWT.AccessTTLMinutes)*time.Minute, time.Duration(cfg.JWT.RefreshTTLHours)*time.Hour)
+	var store database.Store = db
+	if cfg.IoTDB.Driver == database.DriverMemory {
+		store = database.NewMemoryStore()
+	}
+	userRepo, _ := repositories.NewUserRepository("")
+	users := services.NewUserService(userRepo, slog.Default())
+	authHandler := handlers.NewAuthHandler(users)
+	userHandler := handlers.NewUserHandler(users)
+	apiKeyRepo, _ := repositories.NewAPIKeyRepository("")
+	apiKeys := services.NewAPIKeyService(apiKeyRepo, slog.Default())
+	tariff := services.NewTariffService(cfg.Tariff.PerKWh)
+	tariff.SetCurrency(cfg.Tariff.CurrencyCode, cfg.Tariff.CurrencySymbol, cfg.Tariff.CurrencyDecimals)
+	energyService := services.NewEnergyService(store, tariff, slog.Default())
+	energyService.SetStandbyWindow(cfg.Standby.StartHour, cfg.Standby.EndHour, cfg.Standby.MinSamples)
+	energyService.SetDemandWindow(cfg.Demand.WindowMinutes, cfg.Location())
+	energyService.SetSeverityBands(cfg.Severity.WarningPercent, cfg.Severity.CriticalPercent, time.Duration(cfg.Severity.EscalateMinutes)*time.Minute)
+	energyService.SetAnomalyScan(cfg.Anomaly.Window, cfg.Anomaly.ZScore)
+	energyService.SetGapDetection(time.Duration(cfg.MQTT.ReportIntervalSeconds)*time.Second, cfg.Gap.Tolerance)
+	energyHandler := handlers.NewEnergyHandler(store, energyService, cfg)
+	deviceRepo, _ := repositories.NewDeviceRepository("")
+	deviceService := services.NewDeviceService(deviceRepo, slog.Default())
+	budgetRepo, _ := repositories.NewBudgetRepository("")
+	budgetHandler := handlers.NewBudgetHandler(store, services.NewBudgetService(budgetRepo, energyService, deviceService, 0, slog.Default()))
+	deviceHandler := handlers.NewDeviceHandler(deviceService, nil, services.NewCommandTracker(0, slog.Default()))
+	predictionHandler := handlers.NewPredictionHandler(services.NewPredictionService(store, deviceService, tariff, cfg.Prediction.LookbackDays, 0, cfg.Prediction.Smoothing, slog.Default()))
+	wsHandler := handlers.NewWebSocketHandler(store, slog.Default())
+	adminHandler := handlers.NewAdminHandler(db, deviceService)
+	settingsRepo, _ := repositories.NewSettingsRepository("")
+	settingsManager, _ := services.NewSettingsManager(settingsRepo, cfg.RuntimeSettings(), cfg.RuntimeSettings, tariff, energyService, slog.Default())
+	settingsManager.SetBroadcaster(wsHandler.Events())
+	settingsHandler := handlers.NewSettingsHandler(settingsManager)
+	auditRepo, _ := repositories.NewAuditRepository("", cfg.Audit.MaxEvents)
+	audit := services.NewAuditService(auditRepo, cfg.Audit.RetentionDays, slog.Default())
+	reportHandler := handlers.NewReportHandler(services.NewReportService(energyService, deviceService, cfg.Report.CarbonKgPerKWh, slog.Default()), cfg.Location())
+	notifications := NewNotificationService(cfg, "", slog.Default())
+	alertRepo, _ := repositories.NewAlertRepository("", repositories.DefaultMaxAlerts)
+	alertHandler := handlers.NewAlertHandler(alertRepo)
 
-	setupRoutes(app, authHandler, energyHandler, wsHandler)
+	loginStore := middleware.NewMemoryLoginStore(time.Hour)
+	app.Hooks().OnShutdown(func() error {
+		loginStore.Close()
+		return nil
+	})
+
+	setupRoutes(app, store, loginStore, authHandler, energyHandler, deviceHandler, predictionHandler, wsHandler, adminHandler, userHandler, apiKeys, budgetHandler, settingsHandler, reportHandler, alertHandler, audit, notifications, cfg)
 }
 
 // SetupWithWebSocket - New function dengan integrated WebSocket handler
-func SetupWithWebSocket(app *fiber.App, db *database.IoTDB, wsHandler *handlers.WebSocketHandler) {
-	authHandler := handlers.NewAuthHandler()
-	energyHandler := handlers.NewEnergyHandler(db)
+func SetupWithWebSocket(app *fiber.App, cfg *config.Config, db *database.IoTDB, store database.Store, energyService *services.EnergyService, deviceService *services.DeviceService, publisher *mqtt.Publisher, commandTracker *services.CommandTracker, predictionService *services.PredictionService, budgetService *services.BudgetService, settingsManager *services.SettingsManager, wsHandler *handlers.WebSocketHandler, audit *services.AuditService, users *services.UserService, apiKeys *services.APIKeyService, notifications *services.NotificationService, alerts *repositories.AlertRepository, loginStore middleware.LoginAttemptStore) {
+	authHandler := handlers.NewAuthHandler(users)
+	userHandler := handlers.NewUserHandler(users)
+	energyHandler := handlers.NewEnergyHandler(store, energyService, cfg)
+	deviceHandler := handlers.NewDeviceHandler(deviceService, publisher, commandTracker)
+	predictionHandler := handlers.NewPredictionHandler(predictionService)
+	adminHandler := handlers.NewAdminHandler(db, deviceService)
+	budgetHandler := handlers.NewBudgetHandler(store, budgetService)
+	settingsHandler := handlers.NewSettingsHandler(settingsManager)
+	reportHandler := handlers.NewReportHandler(services.NewReportService(energyService, deviceService, cfg.Report.CarbonKgPerKWh, slog.Default()), cfg.Location())
+	alertHandler := handlers.NewAlertHandler(alerts)
+
+	setupRoutes(app, store, loginStore, authHandler, energyHandler, deviceHandler, predictionHandler, wsHandler, adminHandler, userHandler, apiKeys, budgetHandler, settingsHandler, reportHandler, alertHandler, audit, notifications, cfg)
+}
+
+// NewNotificationService sets up the email/webhook channels configured in
+// cfg.Notification; undeliverable notifications are appended to
+// deadLetterPath (empty = only logged). Start is left to the caller.
+func NewNotificationService(cfg *config.Config, deadLetterPath string, logger *slog.Logger) *services.NotificationService {
+	n := cfg.Notification
+	notifications := services.NewNotificationService(repositories.NewDeadLetterRepository(deadLetterPath), services.NotificationOptions{
+		MaxAttempts:     n.MaxAttempts,
+		RetryDelay:      n.RetryDelay,
+		DigestThreshold: n.DigestThreshold,
+		DigestWindow:    n.DigestWindow,
+	}, logger)
 
-	setupRoutes(app, authHandler, energyHandler, wsHandler)
+	if n.SMTPHost != "" {
+		notifications.AddChannel(services.NewEmailChannel(services.SMTPSettings{
+			Host:     n.SMTPHost,
+			Port:     n.SMTPPort,
+			Username: n.SMTPUsername,
+			Password: n.SMTPPassword,
+			From:     n.SMTPFrom,
+			To:       n.EmailTo,
+		}), models.NotificationFilter{Types: n.EmailTypes, MinSeverity: n.EmailMinSeverity})
+	}
+	if n.WebhookURL != "" {
+		notifications.AddChannel(services.NewWebhookChannel(n.WebhookURL, n.WebhookSecret),
+			models.NotificationFilter{Types: n.WebhookTypes, MinSeverity: n.WebhookMinSeverity})
+	}
+	return notifications
 }
 
-func setupRoutes(app *fiber.App, authHandler *handlers.AuthHandler, energyHandler *handlers.EnergyHandler, wsHandler *handlers.WebSocketHandler) {
+func setupRoutes(app *fiber.App, store database.Store, loginStore middleware.LoginAttemptStore, authHandler *handlers.AuthHandler, energyHandler *handlers.EnergyHandler, deviceHandler *handlers.DeviceHandler, predictionHandler *handlers.PredictionHandler, wsHandler *handlers.WebSocketHandler, adminHandler *handlers.AdminHandler, userHandler *handlers.UserHandler, apiKeys *services.APIKeyService, budgetHandler *handlers.BudgetHandler, settingsHandler *handlers.SettingsHandler, reportHandler *handlers.ReportHandler, alertHandler *handlers.AlertHandler, audit *services.AuditService, notifications *services.NotificationService, cfg *config.Config) {
+	// Login, akun, settings, hapus data dan command device dicatat ke audit log
+	authHandler.SetAudit(audit)
+	userHandler.SetAudit(audit)
+	settingsHandler.SetAudit(audit)
+	energyHandler.SetAudit(audit)
+	deviceHandler.SetAudit(audit)
+
 	// Auth routes (public)
 	api := app.Group("/api")
 	auth := api.Group("/auth")
-	auth.Post("/login", authHandler.Login)
+	// Refresh punya bucket sendiri: refresh yang sukses tidak boleh mereset lockout login
+	auth.Post("/login", middleware.LoginRateLimit(loginStore, cfg.Login), authHandler.Login)
+	auth.Post("/refresh", middleware.RefreshRateLimit(loginStore, cfg.Login), authHandler.Refresh)
 	auth.Post("/logout", authHandler.Logout)
 
-	// Energy routes (protected)
-	energy := api.Group("/energy", middleware.AuthMiddleware())
+	// API docs (public)
+	api.Get("/openapi.json", docs.OpenAPI)
+	api.Get("/docs", docs.UI)
+
+	// Energy routes (protected). Viewer boleh membaca, menulis/menghapus data
+	// hanya admin. Selain Bearer JWT, X-API-Key juga diterima (Grafana, script).
+	// Request yang menggantung dibatalkan (503) setelah REQUEST_TIMEOUT;
+	// history/data/raw yang di-stream dan import dapat STREAM_TIMEOUT
+	requestTimeout := middleware.Timeout(cfg.Server.RequestTimeout, cfg.Server.StreamTimeout,
+		"/api/energy/history", "/api/energy/data", "/api/energy/raw", "/api/energy/import")
+
+	// Selama IoTDB belum terhubung (dummy mode) response ditandai
+	// "data_source": "dummy" dan header X-Data-Source
+	dataSource := middleware.DataSource(store)
+
+	energy := api.Group("/energy", middleware.AuthOrAPIKey(apiKeys), middleware.RequireViewer(), requestTimeout, dataSource)
 
 	// ===== REAL-TIME & LATEST DATA =====
 	energy.Get("/latest", energyHandler.GetLatestData)
@@ -44,6 +157,11 @@ func setupRoutes(app *fiber.App, authHandler *handlers.AuthHandler, energyHandle
 	energy.Get("/history", energyHandler.GetHistoricalData)
 	energy.Get("/data", energyHandler.GetData) // Backward compatible
 
+	// Semua reading dalam range sebagai NDJSON (satu objek per baris, urut
+	// waktu) untuk data pipeline; summary=true menambah baris count di akhir
+	// Usage: GET /api/energy/raw?device_id=ESP32_001&start=<ms|RFC3339>&end=<ms|RFC3339>
+	energy.Get("/raw", energyHandler.GetRawData)
+
 	// ===== NEW: FILTER ENDPOINTS DENGAN SUPPORT BERBAGAI FILTER WAKTU =====
 	// Usage: GET /api/energy/filtered?device_id=ESP32_001&filter=daily&startDate=2025-01-15&endDate=2025-01-15
 	// Filter types: hourly, daily, weekly, monthly, custom_days
@@ -52,30 +170,194 @@ func setupRoutes(app *fiber.App, authHandler *handlers.AuthHandler, energyHandle
 	//   Weekly: /api/energy/filtered?device_id=ESP32_001&filter=weekly&startDate=2025-01-15&endDate=2025-01-21
 	//   Monthly: /api/energy/filtered?device_id=ESP32_001&filter=monthly
 	//   Custom Days: /api/energy/filtered?device_id=ESP32_001&filter=custom_days&days=2025-01-15,2025-01-16,2025-01-17
-	energy.Get("/filtered", energyHandler.GetFilteredData)
+	energy.Get("/filtered", energyHandler.CacheFiltered(), energyHandler.GetFilteredData)
 
 	// ===== SUMMARY ENDPOINTS =====
-	energy.Get("/summary/daily", energyHandler.GetDailySummary)
+	energy.Get("/summary/daily", energyHandler.CacheDailySummary(), energyHandler.GetDailySummary)
 	energy.Get("/summary/weekly", energyHandler.GetWeeklySummary)
 	energy.Get("/summary/monthly", energyHandler.GetMonthlySummary)
 
-	// ===== INSERT DATA =====
+	// ===== POWER DISTRIBUTION =====
+	// Mean, median, p95, p99, min, max, stddev power, default 7 hari terakhir
+	// Usage: GET /api/energy/stats?device_id=ESP32_001&start=2025-01-13&end=2025-01-19
+	energy.Get("/stats", energyHandler.GetPowerStats)
+	// Pembacaan dengan |z-score| di atas ANOMALY_ZSCORE terhadap rata-rata
+	// bergulir ANOMALY_WINDOW pembacaan sebelumnya, default hari ini
+	// Usage: GET /api/energy/anomalies?device_id=ESP32_001&start=2025-01-13&end=2025-01-19&z=2.5
+	energy.Get("/anomalies", energyHandler.GetAnomalies)
+	// Data gap: jarak antar pembacaan di atas expected_interval x GAP_TOLERANCE,
+	// default 24 jam terakhir
+	// Usage: GET /api/energy/gaps?device_id=ESP32_001&start=<ms|RFC3339>&end=<ms|RFC3339>&expected_interval=5
+	energy.Get("/gaps", energyHandler.GetDataGaps)
+
+	// ===== STANDBY / PHANTOM LOAD =====
+	// Persentil ke-5 daya malam hari (STANDBY_START_HOUR-STANDBY_END_HOUR)
+	// Usage: GET /api/energy/standby?device_id=ESP32_001&days=7
+	energy.Get("/standby", energyHandler.GetStandbyPower)
+	// Peak demand: rata-rata daya tertinggi per window 15/30/60 menit
+	// Usage: GET /api/energy/peak-demand?device_id=ESP32_001&startDate=2025-01-01&endDate=2025-01-31
+	energy.Get("/peak-demand", energyHandler.GetPeakDemand)
+
+	// ===== COST PER TIME-OF-USE BLOCK =====
+	// kWh dan biaya peak/off-peak (TARIFF_PEAK_*), default 7 hari terakhir
+	// Usage: GET /api/energy/cost?device_id=ESP32_001&start=2025-01-01&end=2025-01-31
+	energy.Get("/cost", energyHandler.GetCostBreakdown)
+
+	// ===== ALERTS =====
+	// Alert terakhir (threshold, quality, anomaly, budget), terbaru dulu
+	// Usage: GET /api/energy/alerts?device_id=ESP32_001&severity=critical&limit=50
+	energy.Get("/alerts", alertHandler.GetAlerts)
+
+	// ===== MONTHLY BUDGET =====
+	// Konsumsi bulan berjalan vs budget (/api/settings/budget) dan proyeksi akhir bulan
+	// Usage: GET /api/energy/budget-status?device_id=ESP32_001 (tanpa device_id = budget global)
+	energy.Get("/budget-status", budgetHandler.GetBudgetStatus)
+
+	// ===== HEATMAP =====
+	// Grid 7 hari × 24 jam, default minggu terakhir
+	// Usage: GET /api/energy/heatmap?device_id=ESP32_001&start=2025-01-13&end=2025-01-19
+	energy.Get("/heatmap", energyHandler.GetHeatmap)
+
+	// ===== PERIOD COMPARISON =====
+	// Usage: GET /api/energy/compare?device_id=ESP32_001&period=weekly
+	// Period: daily (hari ini vs kemarin), weekly (7 hari vs 7 hari sebelumnya), monthly (bulan ini vs bulan lalu)
+	energy.Get("/compare", energyHandler.GetComparison)
+
+	// ===== PREDICTION =====
+	// Forecast per jam + actual untuk periode yang sama sebelumnya
+	// Usage: GET /api/energy/prediction?device_id=ESP32_001&hours=24
+	energy.Get("/prediction", predictionHandler.GetPrediction)
+
+	// ===== SERVER-SENT EVENTS =====
+	// Fallback /ws untuk proxy yang memblok WebSocket; event: reading, alert,
+	// device_status, forecast. Reconnect dengan Last-Event-ID me-replay event
+	// yang terlewat dari ring buffer.
+	energy.Get("/stream", handlers.NewSSEHandler(wsHandler.Events()).Stream)
+	// Hanya RealtimeData (event: reading), untuk dashboard yang cukup data live
+	// Usage: GET /api/energy/events
+	energy.Get("/events", handlers.NewSSEHandler(wsHandler.Events(), handlers.EventReading).Stream)
+
+	// ===== INSERT DATA (admin atau API key read-write) =====
 	// Untuk testing atau manual input
-	energy.Post("/insert", energyHandler.InsertData)
+	energy.Post("/insert", middleware.RequireWrite(), energyHandler.InsertData)
+
+	// Bulk insert untuk backfill: body berupa JSON array EnergyData, timestamp wajib
+	// Usage: POST /api/energy/insert/bulk?device_id=ESP32_001
+	energy.Post("/insert/bulk", middleware.RequireWrite(), energyHandler.InsertBulkData)
+
+	// Import file CSV/NDJSON dari logger lain (multipart)
+	// Usage: POST /api/energy/import file=<file> device_id=ESP32_001 mapping={"volt":"voltage","ts":"timestamp"}
+	energy.Post("/import", middleware.RequireWrite(), energyHandler.ImportData)
+
+	// ===== DELETE DATA (admin) =====
+	// Usage: DELETE /api/energy/data?device_id=ESP32_001&start=<ms>&end=<ms>&confirm=true
+	energy.Delete("/data", middleware.RequireAdmin(), energyHandler.DeleteData)
+
+	// ===== RESPONSE CACHE (admin) =====
+	// Cache /summary/daily dan /filtered, TTL dari RESPONSE_CACHE_TTL_SECONDS
+	// GET: hit/miss counter, DELETE: kosongkan cache
+	energy.Get("/cache", middleware.RequireAdmin(), energyHandler.GetCacheStats)
+	energy.Delete("/cache", middleware.RequireAdmin(), energyHandler.FlushCache)
+
+	// ===== MONTHLY REPORT =====
+	// Ringkasan bulanan, tabel harian, peak demand, biaya dan emisi karbon
+	// (CARBON_KG_PER_KWH) sebagai file PDF (dengan grafik) atau XLSX
+	// Usage: GET /api/reports/monthly?device_id=ESP32_001&month=2025-01&format=pdf|xlsx
+	reports := api.Group("/reports", middleware.AuthOrAPIKey(apiKeys), middleware.RequireViewer(), requestTimeout, dataSource)
+	reports.Get("/monthly", reportHandler.GetMonthlyReport)
+
+	// ===== INGEST (API key read-write) =====
+	// InfluxDB line protocol. Telegraf outputs.influxdb menulis ke <url>/write:
+	// urls = ["http://host/api/ingest/influx"], skip_database_creation = true,
+	// http_headers = {"X-API-Key" = "..."}. 204 kalau semua baris tersimpan, 400 dengan error per baris
+	// Usage: POST /api/ingest/influx?precision=ns|us|ms|s&device_id=<default tanpa tag device_id>
+	ingest := api.Group("/ingest", middleware.AuthOrAPIKey(apiKeys), middleware.RequireViewer(), requestTimeout)
+	ingest.Post("/influx", middleware.RequireWrite(), energyHandler.IngestInflux)
+	ingest.Post("/influx/write", middleware.RequireWrite(), energyHandler.IngestInflux)
+
+	// ===== ADMIN =====
+	admin := api.Group("/admin", middleware.AuthMiddleware(), middleware.RequireAdmin())
+
+	// Hitung ulang rollup per jam (background), tanpa device_id = semua device
+	// Usage: POST /api/admin/rollup/backfill?device_id=ESP32_001&start_date=2025-01-01&end_date=2025-01-31
+	admin.Post("/rollup/backfill", energyHandler.BackfillRollups)
+
+	// Bandingkan timeseries IoTDB dengan yang seharusnya dimiliki tiap device
+	// yang terdaftar; repair membuat yang hilang
+	admin.Get("/schema", adminHandler.GetSchema)
+	admin.Post("/schema/repair", adminHandler.RepairSchema)
+
+	// Kelola akun dan role (admin/viewer)
+	admin.Get("/users", userHandler.ListUsers)
+	admin.Post("/users", userHandler.CreateUser)
+	admin.Put("/users/:username", userHandler.UpdateUser)
+	admin.Delete("/users/:username", userHandler.DeleteUser)
+
+	// Alias dari POST /api/admin/users
+	api.Post("/users", middleware.AuthMiddleware(), middleware.RequireAdmin(), userHandler.CreateUser)
+
+	// Runtime settings (tarif, batas alert, log level, alert on/off) tanpa
+	// restart; disimpan ke data/settings.json di atas nilai .env
+	admin.Get("/settings", settingsHandler.GetSettings)
+	admin.Put("/settings", settingsHandler.UpdateSettings)
+
+	// Audit log: login, akun, settings, hapus data, command device
+	// Usage: GET /api/admin/audit?start=<ms|RFC3339>&end=...&username=budi&type=login_failure&page=1&page_size=50
+	auditHandler := handlers.NewAuditHandler(audit)
+	admin.Get("/audit", auditHandler.ListAudit)
+
+	// Kirim pesan test ke channel notifikasi (email/webhook) untuk cek konfigurasi
+	// Usage: POST /api/admin/notifications/test {"channel": "email"} (tanpa body = semua channel)
+	admin.Post("/notifications/test", handlers.NewNotificationHandler(notifications).TestNotifications)
+
+	// ===== API KEYS (admin) =====
+	// Key untuk client mesin, dikirim sebagai header X-API-Key ke /api/energy.
+	// Key lengkap hanya ditampilkan sekali saat dibuat.
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeys)
+	apikeys := api.Group("/apikeys", middleware.AuthMiddleware(), middleware.RequireAdmin())
+	apikeys.Post("/", apiKeyHandler.CreateAPIKey)
+	apikeys.Get("/", apiKeyHandler.ListAPIKeys)
+	apikeys.Delete("/:id", apiKeyHandler.RevokeAPIKey)
+
+	// ===== SETTINGS =====
+	// Budget bulanan per device (device_id) atau global (tanpa device_id),
+	// unit kwh atau cost. Viewer boleh membaca, mengubah hanya admin.
+	settings := api.Group("/settings", middleware.AuthMiddleware(), middleware.RequireViewer())
+	settings.Get("/budget", budgetHandler.GetBudget)
+	settings.Put("/budget", middleware.RequireAdmin(), budgetHandler.SetBudget)
+	settings.Delete("/budget", middleware.RequireAdmin(), budgetHandler.DeleteBudget)
 
 	// ===== DEVICE MANAGEMENT =====
-	devices := api.Group("/devices", middleware.AuthMiddleware())
-	devices.Get("/", energyHandler.GetDeviceList)
+	devices := api.Group("/devices", middleware.AuthMiddleware(), middleware.RequireViewer(), requestTimeout)
+	devices.Get("/", deviceHandler.ListDevices)
+	devices.Post("/", middleware.RequireAdmin(), deviceHandler.RegisterDevice)
 	devices.Get("/status", energyHandler.GetDeviceStatus)
+	devices.Get("/:id", deviceHandler.GetDevice)
+	devices.Put("/:id", middleware.RequireAdmin(), deviceHandler.UpdateDevice)
+
+	// RSSI WiFi, uptime, last seen dan riwayat singkat (diagnosa koneksi)
+	devices.Get("/:id/diagnostics", energyHandler.GetDeviceDiagnostics)
+	devices.Get("/:id/uptime", energyHandler.GetDeviceDiagnostics)
+
+	// Kirim ke device via MQTT (admin only)
+	// control: wattwise/control/<id>, body {"action": "relay_on" | "relay_off" | "reset_energy", "params": {}}
+	// command: wattwise/commands/<id>, body {"command": "...", "params": {}}
+	devices.Post("/:id/control", middleware.RequireAdmin(), deviceHandler.SendControl)
+	devices.Post("/:id/command", middleware.RequireAdmin(), deviceHandler.SendCommand)
+	// Poll status command: pending, acked, failed (device error) atau timeout
+	devices.Get("/:id/command/:reqid", deviceHandler.GetCommandStatus)
+	devices.Get("/:id/commands/:reqid", deviceHandler.GetCommandStatus)
 
 	// ===== WEBSOCKET =====
+	// Readings dan command history hanya untuk user login (viewer ke atas);
+	// token lewat ?token= karena browser tidak bisa set header WebSocket
 	app.Use("/ws", func(c *fiber.Ctx) error {
 		if websocket.IsWebSocketUpgrade(c) {
 			c.Locals("allowed", true)
 			return c.Next()
 		}
 		return fiber.ErrUpgradeRequired
-	})
+	}, middleware.WebSocketAuth(), middleware.RequireViewer())
 
 	app.Get("/ws", websocket.New(wsHandler.HandleConnection))
 
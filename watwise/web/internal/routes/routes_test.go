@@ -0,0 +1,99 @@
+package routes
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"wattwise/internal/docs"
+	"wattwise/internal/models"
+	"wattwise/internal/utils"
+
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// newTestApp is the app of Setup with DB_DRIVER=memory
+func newTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	t.Setenv("DB_DRIVER", "memory")
+	t.Setenv("JWT_SECRET", "routes-test-secret-0123456789abcdef")
+	t.Cleanup(func() { utils.SetJWTSecret(nil) })
+
+	app := fiber.New()
+	Setup(app, nil)
+	return app
+}
+
+// serve runs app on a free local port and returns its host:port
+func serve(t *testing.T, app *fiber.App) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+	return ln.Addr().String()
+}
+
+func TestWebSocketRequiresToken(t *testing.T) {
+	addr := serve(t, newTestApp(t))
+	viewer, err := utils.GenerateToken("viewer", models.RoleViewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		header http.Header
+		status int
+	}{
+		{"no token", "", nil, http.StatusUnauthorized},
+		{"invalid token", "?token=not-a-jwt", nil, http.StatusUnauthorized},
+		{"refresh token instead of access token", "?token=" + mustRefreshToken(t), nil, http.StatusUnauthorized},
+		{"viewer token in query", "?token=" + viewer, nil, http.StatusSwitchingProtocols},
+		{"viewer token in header", "", http.Header{"Authorization": {"Bearer " + viewer}}, http.StatusSwitchingProtocols},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, resp, err := websocket.DefaultDialer.Dial("ws://"+addr+"/ws"+tt.query, tt.header)
+			if resp == nil {
+				t.Fatalf("no handshake response: %v", err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if conn == nil {
+				return
+			}
+			defer conn.Close()
+
+			var welcome models.WSMessage
+			if err := conn.ReadJSON(&welcome); err != nil || welcome.Type != models.WSTypeConnected {
+				t.Errorf("first frame %+v (%v), want %s", welcome, err, models.WSTypeConnected)
+			}
+		})
+	}
+}
+
+func mustRefreshToken(t *testing.T) string {
+	t.Helper()
+	token, err := utils.GenerateRefreshToken("viewer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRoutesDocumented(t *testing.T) {
+	app := newTestApp(t)
+	missing, err := docs.Undocumented(app.GetRoutes(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) > 0 {
+		t.Errorf("routes missing from internal/docs/openapi.json:\n%s", strings.Join(missing, "\n"))
+	}
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"time"
+	"wattwise/internal/models"
+)
+
+// Severity bands of threshold alerts, see SetSeverityBands
+const (
+	DefaultWarningPercent  = 10
+	DefaultCriticalPercent = 25
+	DefaultEscalateMinutes = 10
+)
+
+// severityBands grade a threshold alert by how far, in percent of the bound,
+// the reading exceeds it
+type severityBands struct {
+	warning       float64
+	critical      float64
+	escalateAfter time.Duration // 0 = no escalation
+}
+
+// ongoingAlert is the threshold alert type a device keeps raising and the
+// reading time (ms) it started
+type ongoingAlert struct {
+	alertType string
+	since     int64
+}
+
+// SetSeverityBands sets the percentages over the bound from which a threshold
+// alert is a warning or critical (info below), and how long a warning may
+// last before it is escalated to critical (0 = never). Invalid bands fall back
+// to the defaults.
+func (s *EnergyService) SetSeverityBands(warningPercent, criticalPercent float64, escalateAfter time.Duration) {
+	if warningPercent < 0 || criticalPercent < warningPercent {
+		warningPercent, criticalPercent = DefaultWarningPercent, DefaultCriticalPercent
+	}
+	s.settingsMu.Lock()
+	s.severity = severityBands{
+		warning:       warningPercent,
+		critical:      criticalPercent,
+		escalateAfter: max(escalateAfter, 0),
+	}
+	s.settingsMu.Unlock()
+}
+
+func (s *EnergyService) severityBands() severityBands {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.severity
+}
+
+// grade returns the severity of a reading exceedPercent over its bound;
+// a value exactly on a band's edge stays in the lower band
+func (b severityBands) grade(exceedPercent float64) string {
+	switch {
+	case exceedPercent > b.critical:
+		return models.SeverityCritical
+	case exceedPercent > b.warning:
+		return models.SeverityWarning
+	default:
+		return models.SeverityInfo
+	}
+}
+
+// exceedPercent is how far actual lies beyond threshold, in percent of it.
+// Below a lower bound (undervoltage) counts the same way as above an upper one.
+// Rounded to 1e-9 so a reading on a band edge (17.6 A over 16 A is 10%) is
+// not pushed past it by float error.
+func exceedPercent(actual, threshold float64) float64 {
+	if threshold <= 0 {
+		return 0
+	}
+	diff := math.Abs(actual - threshold)
+	return math.Round(diff/threshold*100*1e9) / 1e9
+}
+
+// gradeAlert sets the severity of a threshold alert and escalates a warning
+// the device has been raising for longer than escalateAfter
+func (s *EnergyService) gradeAlert(alert *models.AlertData) {
+	bands := s.severityBands()
+	alert.Severity = bands.grade(exceedPercent(alert.ActualValue, alert.Threshold))
+
+	at := alert.Timestamp
+	if at == 0 {
+		at = time.Now().UnixMilli()
+	}
+
+	s.escalationMu.Lock()
+	ongoing, ok := s.ongoing[alert.DeviceID]
+	if !ok || ongoing.alertType != alert.AlertType || at < ongoing.since {
+		ongoing = ongoingAlert{alertType: alert.AlertType, since: at}
+		s.ongoing[alert.DeviceID] = ongoing
+	}
+	s.escalationMu.Unlock()
+
+	lasting := time.Duration(at-ongoing.since) * time.Millisecond
+	if alert.Severity == models.SeverityWarning && bands.escalateAfter > 0 && lasting > bands.escalateAfter {
+		alert.Severity = models.SeverityCritical
+		alert.Message += fmt.Sprintf(" (escalated, ongoing for %s)", lasting.Round(time.Second))
+	}
+}
+
+// endAlert forgets a device's ongoing threshold alert once a reading is back
+// within bounds
+func (s *EnergyService) endAlert(deviceID string) {
+	s.escalationMu.Lock()
+	delete(s.ongoing, deviceID)
+	s.escalationMu.Unlock()
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"wattwise/internal/database"
+	"wattwise/internal/models"
+)
+
+// newSeverityService grades alerts against round bounds plus a 16 A breaker,
+// whose 10% edge (17.6 A) is not exact in float
+func newSeverityService() *EnergyService {
+	service := newTestService(database.NewMemoryStore())
+	service.SetAlertThresholds(AlertThresholds{MaxPower: 2200, MaxCurrent: 16, MinVoltage: 200, MaxVoltage: 240})
+	return service
+}
+
+func TestSeverityBandEdges(t *testing.T) {
+	normal := models.EnergyData{Voltage: 220, Current: 1, Power: 220}
+	power := func(v float64) models.EnergyData { d := normal; d.Power = v; return d }
+	current := func(v float64) models.EnergyData { d := normal; d.Current = v; return d }
+	voltage := func(v float64) models.EnergyData { d := normal; d.Voltage = v; return d }
+
+	// Default: info sampai 10%, warning sampai 25%, critical di atasnya;
+	// nilai tepat di tepi band tetap di band bawah
+	tests := []struct {
+		name     string
+		data     models.EnergyData
+		severity string // "" = no alert
+	}{
+		{"power at the bound", power(2200), ""},
+		{"power just over the bound", power(2200.01), models.SeverityInfo},
+		{"power at 10%", power(2420), models.SeverityInfo},
+		{"power just over 10%", power(2420.01), models.SeverityWarning},
+		{"power at 25%", power(2750), models.SeverityWarning},
+		{"power just over 25%", power(2750.01), models.SeverityCritical},
+
+		{"current at the bound", current(16), ""},
+		{"current at 10%", current(17.6), models.SeverityInfo},
+		{"current just over 10%", current(17.61), models.SeverityWarning},
+		{"current at 25%", current(20), models.SeverityWarning},
+		{"current just over 25%", current(20.01), models.SeverityCritical},
+
+		{"voltage at the upper bound", voltage(240), ""},
+		{"voltage at 10% over", voltage(264), models.SeverityInfo},
+		{"voltage just over 10% over", voltage(264.1), models.SeverityWarning},
+		{"voltage at 25% over", voltage(300), models.SeverityWarning},
+		{"voltage just over 25% over", voltage(300.1), models.SeverityCritical},
+
+		{"voltage at the lower bound", voltage(200), ""},
+		{"voltage at 10% under", voltage(180), models.SeverityInfo},
+		{"voltage just over 10% under", voltage(179.9), models.SeverityWarning},
+		{"voltage at 25% under", voltage(150), models.SeverityWarning},
+		{"voltage just over 25% under", voltage(149.9), models.SeverityCritical},
+	}
+	service := newSeverityService()
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.data
+			alert := service.CheckThresholdAlert(fmt.Sprintf("D%d", i), &data)
+			if tt.severity == "" {
+				if alert != nil {
+					t.Fatalf("alert %+v on the bound, want none", alert)
+				}
+				return
+			}
+			if alert == nil {
+				t.Fatal("no alert")
+			}
+			if alert.Severity != tt.severity {
+				t.Errorf("severity = %s at %v over %v (%.12g%%), want %s", alert.Severity,
+					alert.ActualValue, alert.Threshold, exceedPercent(alert.ActualValue, alert.Threshold), tt.severity)
+			}
+		})
+	}
+}
+
+func TestSeverityCustomBands(t *testing.T) {
+	tests := []struct {
+		name              string
+		warning, critical float64
+		power             float64
+		severity          string
+	}{
+		{"at the warning edge", 5, 50, 2310, models.SeverityInfo},
+		{"over the warning edge", 5, 50, 2310.01, models.SeverityWarning},
+		{"at the critical edge", 5, 50, 3300, models.SeverityWarning},
+		{"over the critical edge", 5, 50, 3300.01, models.SeverityCritical},
+		// Band warning kosong: langsung dari info ke critical
+		{"equal bands, at the edge", 5, 5, 2310, models.SeverityInfo},
+		{"equal bands, over the edge", 5, 5, 2310.01, models.SeverityCritical},
+		{"zero warning band, any excess", 0, 25, 2200.01, models.SeverityWarning},
+		// Band tidak valid kembali ke default 10/25
+		{"critical below warning", 30, 20, 2420.01, models.SeverityWarning},
+		{"negative warning", -1, 25, 2420, models.SeverityInfo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newSeverityService()
+			service.SetSeverityBands(tt.warning, tt.critical, 0)
+			data := models.EnergyData{Voltage: 220, Current: 1, Power: tt.power}
+			alert := service.CheckThresholdAlert("A", &data)
+			if alert == nil || alert.Severity != tt.severity {
+				t.Errorf("alert = %+v, want %s", alert, tt.severity)
+			}
+		})
+	}
+}
+
+func TestSeverityEscalationEdge(t *testing.T) {
+	start := time.Date(2025, 1, 1, 8, 0, 0, 0, testLocation)
+	check := func(service *EnergyService, at time.Time, power float64) *models.AlertData {
+		t.Helper()
+		data := models.EnergyData{Timestamp: at.UnixMilli(), Voltage: 220, Current: 1, Power: power}
+		return service.CheckThresholdAlert("A", &data)
+	}
+
+	service := newSeverityService()
+	service.SetSeverityBands(10, 25, 10*time.Minute)
+	if alert := check(service, start, 2500); alert.Severity != models.SeverityWarning {
+		t.Fatalf("first warning = %s", alert.Severity)
+	}
+	// Tepat 10 menit belum dieskalasi, 1 ms sesudahnya sudah
+	if alert := check(service, start.Add(10*time.Minute), 2500); alert.Severity != models.SeverityWarning {
+		t.Errorf("after exactly 10 minutes: %s, want warning", alert.Severity)
+	}
+	alert := check(service, start.Add(10*time.Minute+time.Millisecond), 2500)
+	if alert.Severity != models.SeverityCritical || !strings.Contains(alert.Message, "escalated") {
+		t.Errorf("after 10 minutes and 1 ms: %s %q, want escalated to critical", alert.Severity, alert.Message)
+	}
+	// Info tidak dieskalasi, berapa lama pun
+	if alert := check(service, start.Add(time.Hour), 2300); alert.Severity != models.SeverityInfo {
+		t.Errorf("lasting info: %s, want info", alert.Severity)
+	}
+
+	// Kembali normal mengakhiri alert: warning berikutnya mulai dari awal
+	if alert := check(service, start.Add(61*time.Minute), 1000); alert != nil {
+		t.Fatalf("alert %+v within bounds", alert)
+	}
+	if alert := check(service, start.Add(62*time.Minute), 2500); alert.Severity != models.SeverityWarning {
+		t.Errorf("warning after recovery: %s, want warning", alert.Severity)
+	}
+
+	// Tipe alert lain juga memulai dari awal
+	data := models.EnergyData{Timestamp: start.Add(80 * time.Minute).UnixMilli(), Voltage: 270, Current: 1, Power: 1000}
+	if alert := service.CheckThresholdAlert("A", &data); alert.AlertType != "voltage_abnormal" || alert.Severity != models.SeverityWarning {
+		t.Errorf("voltage alert after a power alert: %s %s, want a fresh warning", alert.AlertType, alert.Severity)
+	}
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+	"wattwise/internal/database"
+	"wattwise/internal/models"
+)
+
+const (
+	anomalyBaselineDays = 14
+	// A bucket needs this many readings before its stddev means anything
+	anomalyMinSamples = 30
+)
+
+// AnomalyDetector flags power readings that are more than sigma standard
+// deviations away from the device's baseline for the same hour of day. The
+// baseline is a rolling window of the last 14 days, kept as per-day sums so
+// old days can be dropped. Devices are not checked until they have been
+// observed for their warm-up period.
+type AnomalyDetector struct {
+	db         database.Store
+	devices    *DeviceService
+	sigma      float64
+	warmupDays int
+	logger     *slog.Logger
+
+	mu        sync.Mutex
+	baselines map[string]*powerBaseline
+}
+
+type powerBaseline struct {
+	firstSeen time.Time
+	// hours[h][day] for hour-of-day h, day = days since Unix epoch (local)
+	hours [24]map[int64]*moments
+}
+
+type moments struct {
+	n, sum, sumSq float64
+}
+
+func NewAnomalyDetector(db database.Store, devices *DeviceService, sigma float64, warmupDays int, logger *slog.Logger) *AnomalyDetector {
+	return &AnomalyDetector{
+		db:         db,
+		devices:    devices,
+		sigma:      sigma,
+		warmupDays: warmupDays,
+		logger:     logger.With("component", "anomaly"),
+		baselines:  make(map[string]*powerBaseline),
+	}
+}
+
+// Seed loads the last 14 days of readings for every registered device, so
+// the detector does not start cold after a restart
+func (d *AnomalyDetector) Seed(now time.Time) {
+	if !d.db.IsEnabled() {
+		d.logger.Warn("IoTDB not connected, anomaly baseline starts empty")
+		return
+	}
+
+	ctx := context.Background()
+	from := now.AddDate(0, 0, -anomalyBaselineDays)
+	for _, device := range d.devices.List() {
+		readings, err := d.db.GetDataByTimeRange(ctx, device.ID, from.UnixMilli(), now.UnixMilli())
+		if err != nil {
+			d.logger.Warn("failed to seed anomaly baseline", "device_id", device.ID, "error", err)
+			continue
+		}
+
+		d.mu.Lock()
+		for _, r := range readings {
+			d.observe(device.ID, time.UnixMilli(r.Timestamp), r.Power)
+		}
+		d.mu.Unlock()
+
+		d.logger.Info("anomaly baseline seeded", "device_id", device.ID, "readings", len(readings))
+	}
+}
+
+// Check compares a reading with the baseline, then adds it to the baseline.
+// It returns an "anomaly" alert, or nil when the reading is normal, the
+// device is still warming up, or detection is disabled for it (sigma 0).
+func (d *AnomalyDetector) Check(deviceID string, data *models.EnergyData) *models.AlertData {
+	sigma, warmup := d.settings(deviceID)
+	at := time.UnixMilli(data.Timestamp)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	baseline := d.baselines[deviceID]
+	var alert *models.AlertData
+	if sigma > 0 && baseline != nil && at.Sub(baseline.firstSeen) >= warmup {
+		alert = baseline.check(deviceID, at, data.Power, sigma)
+	}
+
+	d.observe(deviceID, at, data.Power)
+	return alert
+}
+
+// settings returns the device's sigma and warm-up, falling back to the defaults
+func (d *AnomalyDetector) settings(deviceID string) (float64, time.Duration) {
+	sigma, warmupDays := d.sigma, d.warmupDays
+	if device, err := d.devices.Get(deviceID); err == nil {
+		if device.AnomalySigma > 0 {
+			sigma = device.AnomalySigma
+		}
+		if device.AnomalyWarmupDays > 0 {
+			warmupDays = device.AnomalyWarmupDays
+		}
+	}
+	return sigma, time.Duration(warmupDays) * 24 * time.Hour
+}
+
+// observe adds a reading to the baseline; must be called with d.mu held
+func (d *AnomalyDetector) observe(deviceID string, at time.Time, power float64) {
+	baseline, ok := d.baselines[deviceID]
+	if !ok {
+		baseline = &powerBaseline{firstSeen: at}
+		for h := range baseline.hours {
+			baseline.hours[h] = make(map[int64]*moments)
+		}
+		d.baselines[deviceID] = baseline
+	}
+	if at.Before(baseline.firstSeen) {
+		baseline.firstSeen = at
+	}
+
+	day := localDay(at)
+	bucket := baseline.hours[at.Hour()]
+	m, ok := bucket[day]
+	if !ok {
+		m = &moments{}
+		bucket[day] = m
+		// Hari baru: buang hari di luar window
+		for old := range bucket {
+			if old <= day-anomalyBaselineDays {
+				delete(bucket, old)
+			}
+		}
+	}
+	m.n++
+	m.sum += power
+	m.sumSq += power * power
+}
+
+func (b *powerBaseline) check(deviceID string, at time.Time, power, sigma float64) *models.AlertData {
+	day := localDay(at)
+
+	var total moments
+	for d, m := range b.hours[at.Hour()] {
+		if d <= day-anomalyBaselineDays {
+			continue
+		}
+		total.n += m.n
+		total.sum += m.sum
+		total.sumSq += m.sumSq
+	}
+	if total.n < anomalyMinSamples {
+		return nil
+	}
+
+	mean := total.sum / total.n
+	stddev := math.Sqrt(math.Max(total.sumSq/total.n-mean*mean, 0))
+	if stddev == 0 {
+		return nil
+	}
+
+	deviation := (power - mean) / stddev
+	if math.Abs(deviation) <= sigma {
+		return nil
+	}
+
+	return &models.AlertData{
+		DeviceID:  deviceID,
+		AlertType: "anomaly",
+		Message: fmt.Sprintf("Unusual power: %.2fW (normal %.2f ± %.2fW at %02d:00, %.1fσ)",
+			power, mean, stddev, at.Hour(), deviation),
+		Threshold:   mean + math.Copysign(sigma*stddev, deviation),
+		ActualValue: power,
+		Timestamp:   at.UnixMilli(),
+	}
+}
+
+func localDay(t time.Time) int64 {
+	_, offset := t.Zone()
+	return (t.Unix() + int64(offset)) / 86400
+}
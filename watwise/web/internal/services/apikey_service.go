@@ -0,0 +1,105 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"wattwise/internal/models"
+	"wattwise/internal/repositories"
+)
+
+// apiKeyPrefix marks wattwise keys, e.g. in secret scanners
+const apiKeyPrefix = "ww_"
+
+// ErrInvalidAPIKey wraps validation errors from Create, and is returned by
+// Authenticate for unknown or revoked keys
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+type APIKeyService struct {
+	repo   *repositories.APIKeyRepository
+	logger *slog.Logger
+}
+
+func NewAPIKeyService(repo *repositories.APIKeyRepository, logger *slog.Logger) *APIKeyService {
+	return &APIKeyService{
+		repo:   repo,
+		logger: logger.With("component", "apikey_service"),
+	}
+}
+
+// Create generates a key ("ww_" + 32 random bytes as hex). The full key is
+// only in the result; the repository keeps its SHA-256 hash.
+func (s *APIKeyService) Create(input models.APIKeyInput, createdBy string) (*models.NewAPIKey, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidAPIKey)
+	}
+	if input.Scope == "" {
+		input.Scope = models.ScopeRead
+	}
+	if !models.ValidScope(input.Scope) {
+		return nil, fmt.Errorf("%w: scope must be %q or %q, got %q", ErrInvalidAPIKey, models.ScopeRead, models.ScopeReadWrite, input.Scope)
+	}
+
+	secret := make([]byte, 32)
+	id := make([]byte, 8)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(secret)
+
+	apiKey := models.APIKey{
+		ID:        hex.EncodeToString(id),
+		Name:      input.Name,
+		Scope:     input.Scope,
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.Create(apiKey, hashAPIKey(key)); err != nil {
+		s.logger.Error("failed to save api key", "name", apiKey.Name, "error", err)
+		return nil, err
+	}
+
+	s.logger.Info("api key created", "id", apiKey.ID, "name", apiKey.Name, "scope", apiKey.Scope, "created_by", createdBy)
+	return &models.NewAPIKey{APIKey: apiKey, Key: key}, nil
+}
+
+func (s *APIKeyService) List() []models.APIKey {
+	return s.repo.List()
+}
+
+// Revoke deletes a key; requests using it fail from then on
+func (s *APIKeyService) Revoke(id string) error {
+	if err := s.repo.Delete(id); err != nil {
+		return err
+	}
+	s.logger.Info("api key revoked", "id", id)
+	return nil
+}
+
+// Authenticate returns the key's metadata and records its use. Lookup is by
+// hash, so no timing-safe comparison is needed.
+func (s *APIKeyService) Authenticate(key string) (models.APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return models.APIKey{}, ErrInvalidAPIKey
+	}
+	apiKey, err := s.repo.Use(hashAPIKey(key), time.Now())
+	if err != nil {
+		return models.APIKey{}, ErrInvalidAPIKey
+	}
+	return apiKey, nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
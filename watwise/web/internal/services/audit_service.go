@@ -0,0 +1,95 @@
+package services
+
+import (
+	"log/slog"
+	"time"
+	"wattwise/internal/models"
+	"wattwise/internal/repositories"
+)
+
+// auditTrimEvery is how often events past the retention are dropped
+const auditTrimEvery = time.Hour
+
+// AuditService records logins and admin actions. A nil *AuditService records
+// nothing, so handlers can call Record without checking.
+type AuditService struct {
+	repo      *repositories.AuditRepository
+	retention time.Duration
+	logger    *slog.Logger
+	stop      chan struct{}
+}
+
+// retentionDays <= 0 keeps events until the repository's max is reached
+func NewAuditService(repo *repositories.AuditRepository, retentionDays int, logger *slog.Logger) *AuditService {
+	return &AuditService{
+		repo:      repo,
+		retention: time.Duration(retentionDays) * 24 * time.Hour,
+		logger:    logger.With("component", "audit"),
+		stop:      make(chan struct{}),
+	}
+}
+
+// Record stores event, stamped now when it has no time. A failed write is
+// logged, never returned: auditing must not fail the action itself.
+func (s *AuditService) Record(event models.AuditEvent) {
+	if s == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	if err := s.repo.Append(event); err != nil {
+		s.logger.Error("failed to record audit event", "type", event.Type, "username", event.Username, "error", err)
+	}
+}
+
+// List returns a page of events, newest first, and the total matching
+func (s *AuditService) List(filter models.AuditFilter) ([]models.AuditEvent, int) {
+	return s.repo.List(filter)
+}
+
+// Start drops events older than the retention (and those beyond the
+// repository's max from the file) every hour
+func (s *AuditService) Start() {
+	go s.loop()
+}
+
+func (s *AuditService) Stop() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+}
+
+func (s *AuditService) loop() {
+	ticker := time.NewTicker(auditTrimEvery)
+	defer ticker.Stop()
+
+	for {
+		s.Trim(time.Now())
+
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Trim drops events older than the retention before now
+func (s *AuditService) Trim(now time.Time) {
+	var before time.Time
+	if s.retention > 0 {
+		before = now.Add(-s.retention)
+	}
+	dropped, err := s.repo.Trim(before)
+	if err != nil {
+		s.logger.Error("audit trim failed", "error", err)
+		return
+	}
+	if dropped > 0 {
+		s.logger.Info("audit events trimmed", "dropped", dropped, "retention", s.retention)
+	}
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+	"wattwise/internal/models"
+	"wattwise/internal/repositories"
+)
+
+// ErrInvalidBudget wraps validation errors from BudgetService.Set
+var ErrInvalidBudget = errors.New("invalid budget")
+
+// BudgetAlertPercents are the projected-usage thresholds that raise a
+// "budget_projection" alert, each at most once per budget per month
+var BudgetAlertPercents = []int{80, 100}
+
+// AlertSink stores and broadcasts alerts raised outside the MQTT pipeline
+// (*mqtt.Subscriber)
+type AlertSink interface {
+	RaiseAlert(alert models.AlertData)
+}
+
+// BudgetService tracks month-to-date consumption against monthly budgets and
+// periodically alerts when the projected month total crosses a threshold.
+// Months follow the server's local time zone.
+type BudgetService struct {
+	repo    *repositories.BudgetRepository
+	energy  *EnergyService
+	devices *DeviceService
+	every   time.Duration
+	logger  *slog.Logger
+	stop    chan struct{}
+
+	// Optional, see SetAlertSink
+	alerts AlertSink
+}
+
+// checkMinutes <= 0 disables the scheduled alert check
+func NewBudgetService(repo *repositories.BudgetRepository, energy *EnergyService, devices *DeviceService, checkMinutes int, logger *slog.Logger) *BudgetService {
+	return &BudgetService{
+		repo:    repo,
+		energy:  energy,
+		devices: devices,
+		every:   time.Duration(checkMinutes) * time.Minute,
+		logger:  logger.With("component", "budget"),
+		stop:    make(chan struct{}),
+	}
+}
+
+// SetAlertSink routes budget alerts into the alert store and WebSocket
+func (s *BudgetService) SetAlertSink(sink AlertSink) {
+	s.alerts = sink
+}
+
+func (s *BudgetService) List() []models.Budget {
+	return s.repo.List()
+}
+
+// Get returns the budget of deviceID, "" for the global budget
+func (s *BudgetService) Get(deviceID string) (models.Budget, error) {
+	return s.repo.Get(deviceID)
+}
+
+// Set creates or replaces a budget. An empty device_id sets the global
+// budget, which covers all registered devices together.
+func (s *BudgetService) Set(input models.BudgetInput, username string) (models.Budget, error) {
+	if input.Unit == "" {
+		input.Unit = models.BudgetUnitKWh
+	}
+	if !models.ValidBudgetUnit(input.Unit) {
+		return models.Budget{}, fmt.Errorf("%w: unit must be %q or %q", ErrInvalidBudget, models.BudgetUnitKWh, models.BudgetUnitCost)
+	}
+	if input.Limit <= 0 {
+		return models.Budget{}, fmt.Errorf("%w: limit must be greater than 0", ErrInvalidBudget)
+	}
+	if input.DeviceID != "" {
+		if _, err := s.devices.Get(input.DeviceID); err != nil {
+			return models.Budget{}, err
+		}
+	}
+
+	budget := models.Budget{
+		DeviceID:  input.DeviceID,
+		Unit:      input.Unit,
+		Limit:     input.Limit,
+		UpdatedAt: time.Now(),
+		UpdatedBy: username,
+	}
+	if err := s.repo.Set(budget); err != nil {
+		return models.Budget{}, err
+	}
+
+	s.logger.Info("budget set", "device_id", budget.DeviceID, "unit", budget.Unit, "limit", budget.Limit, "by", username)
+	return budget, nil
+}
+
+func (s *BudgetService) Delete(deviceID string) error {
+	if err := s.repo.Delete(deviceID); err != nil {
+		return err
+	}
+	s.logger.Info("budget deleted", "device_id", deviceID)
+	return nil
+}
+
+// Status computes the budget of deviceID ("" = global) for the month that
+// contains now
+func (s *BudgetService) Status(ctx context.Context, deviceID string, now time.Time) (*models.BudgetStatus, error) {
+	budget, err := s.repo.Get(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	deviceIDs := []string{deviceID}
+	if deviceID == "" {
+		deviceIDs = s.devices.IDs()
+	}
+
+	status := &models.BudgetStatus{
+		Budget:      budget,
+		Month:       monthStart.Format("2006-01"),
+		Timezone:    now.Location().String(),
+		DaysInMonth: monthStart.AddDate(0, 1, -1).Day(),
+	}
+	for _, id := range deviceIDs {
+		total, err := s.energy.CalculatePeriodTotal(ctx, id, monthStart, today)
+		if err != nil {
+			return nil, err
+		}
+		status.MonthToDateKWh += total.TotalEnergy
+		status.MonthToDateCost += total.TotalCost
+	}
+
+	status.Used = status.MonthToDateKWh
+	if budget.Unit == models.BudgetUnitCost {
+		status.Used = status.MonthToDateCost
+	}
+
+	// Minimal satu hari, supaya proyeksi di jam-jam pertama bulan tidak meledak
+	elapsedDays := max(now.Sub(monthStart).Hours()/24, 1)
+	status.DailyAverage = status.Used / elapsedDays
+	status.Projected = status.DailyAverage * float64(status.DaysInMonth)
+	status.DaysRemaining = status.DaysInMonth - now.Day()
+	status.PercentUsed = status.Used / budget.Limit * 100
+	status.ProjectedPercent = status.Projected / budget.Limit * 100
+	return status, nil
+}
+
+// Start runs the alert check in the background every checkMinutes
+func (s *BudgetService) Start() {
+	if s.every <= 0 {
+		s.logger.Info("budget alerts disabled (BUDGET_CHECK_MINUTES=0)")
+		return
+	}
+
+	s.logger.Info("budget alerts enabled", "every", s.every, "percents", BudgetAlertPercents)
+	go s.loop()
+}
+
+func (s *BudgetService) Stop() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+}
+
+func (s *BudgetService) loop() {
+	ticker := time.NewTicker(s.every)
+	defer ticker.Stop()
+
+	for {
+		s.RunOnce(time.Now())
+
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// RunOnce checks every budget and alerts for the highest threshold the
+// projection crossed that has not alerted yet this month. Alert state is kept
+// per month, so a new month starts over.
+func (s *BudgetService) RunOnce(now time.Time) {
+	if !s.energy.db.IsEnabled() {
+		s.logger.Warn("IoTDB not connected, skipping budget check")
+		return
+	}
+	if !s.energy.Toggles().Budget {
+		s.logger.Debug("budget alerts switched off, skipping budget check")
+		return
+	}
+
+	ctx := context.Background()
+	for _, budget := range s.repo.List() {
+		logger := s.logger.With("device_id", budget.DeviceID)
+
+		status, err := s.Status(ctx, budget.DeviceID, now)
+		if err != nil {
+			logger.Error("budget status failed", "error", err)
+			continue
+		}
+
+		state := s.repo.AlertState(budget.DeviceID)
+		if state.Month != status.Month {
+			if state.Month != "" {
+				logger.Info("budget month rolled over", "from", state.Month, "to", status.Month)
+			}
+			state = repositories.BudgetAlertState{Month: status.Month}
+		}
+
+		crossed := 0
+		for _, percent := range BudgetAlertPercents {
+			if status.ProjectedPercent >= float64(percent) && percent > state.Percent {
+				crossed = percent
+			}
+		}
+		if crossed == 0 {
+			continue
+		}
+
+		state.Percent = crossed
+		if err := s.repo.SetAlertState(budget.DeviceID, state); err != nil {
+			logger.Error("failed to persist budget alert state", "error", err)
+			continue
+		}
+		s.raise(budget, status, crossed, now)
+	}
+}
+
+func (s *BudgetService) raise(budget models.Budget, status *models.BudgetStatus, percent int, now time.Time) {
+	scope := budget.DeviceID
+	if scope == "" {
+		scope = "all devices"
+	}
+	alert := models.AlertData{
+		DeviceID:  budget.DeviceID,
+		AlertType: "budget_projection",
+		Message: fmt.Sprintf("Projected %s usage for %s is %.0f%% of the %s budget (%.2f of %.2f %s)",
+			status.Month, scope, status.ProjectedPercent, budget.Unit, status.Projected, budget.Limit, budget.Unit),
+		Threshold:   budget.Limit * float64(percent) / 100,
+		ActualValue: status.Projected,
+		Timestamp:   now.UnixMilli(),
+	}
+
+	if s.alerts == nil {
+		s.logger.Warn("budget alert without alert sink", "device_id", budget.DeviceID, "percent", percent)
+		return
+	}
+	s.alerts.RaiseAlert(alert)
+}
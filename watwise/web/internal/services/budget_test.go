@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+	"wattwise/internal/database"
+	"wattwise/internal/models"
+	"wattwise/internal/repositories"
+)
+
+// alertRecorder is an AlertSink that keeps the raised alerts
+type alertRecorder struct {
+	alerts []models.AlertData
+}
+
+func (r *alertRecorder) RaiseAlert(alert models.AlertData) {
+	r.alerts = append(r.alerts, alert)
+}
+
+// newTestBudget is a BudgetService over store for the registered device A
+// with a kWh budget of limit
+func newTestBudget(t *testing.T, store database.Store, limit float64) (*BudgetService, *alertRecorder) {
+	t.Helper()
+	deviceRepo, err := repositories.NewDeviceRepository("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices := NewDeviceService(deviceRepo, discardLogger())
+	if _, err := devices.Register(models.Device{ID: "A"}); err != nil {
+		t.Fatal(err)
+	}
+	budgetRepo, err := repositories.NewBudgetRepository("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewBudgetService(budgetRepo, newTestService(store), devices, 0, discardLogger())
+	if _, err := service.Set(models.BudgetInput{DeviceID: "A", Limit: limit}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	recorder := &alertRecorder{}
+	service.SetAlertSink(recorder)
+	return service, recorder
+}
+
+func TestBudgetStatusMonthEdges(t *testing.T) {
+	at := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, testLocation)
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+
+		month         string
+		daysInMonth   int
+		daysRemaining int
+		used          float64 // kWh
+		elapsedDays   float64 // divisor of the daily average
+	}{
+		// Hari pertama: rata-rata dibagi minimal satu hari
+		{"first minutes of the month", at(2025, 1, 1, 0, 45), "2025-01", 31, 30, 0, 1},
+		{"first day", at(2025, 1, 1, 12, 0), "2025-01", 31, 30, 1.1, 1},
+		{"second day", at(2025, 1, 2, 12, 0), "2025-01", 31, 29, 3.5, 1.5},
+		{"last day", at(2025, 1, 31, 23, 45), "2025-01", 31, 0, 74.3, 30 + 23.75/24},
+		// Reading Januari tidak ikut ke Februari
+		{"after rollover", at(2025, 2, 1, 0, 45), "2025-02", 28, 27, 0, 1},
+		{"last day of February", at(2025, 2, 28, 23, 45), "2025-02", 28, 0, 67.1, 27 + 23.75/24},
+		{"leap day", at(2024, 2, 29, 23, 45), "2024-02", 29, 0, 69.5, 28 + 23.75/24},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := database.NewMemoryStore()
+			// Satu reading per jam (xx:30, +0.1 kWh) dari sehari sebelum
+			// awal bulan sampai now
+			monthStart := time.Date(tt.now.Year(), tt.now.Month(), 1, 0, 0, 0, 0, testLocation)
+			seed(t, store, "A", hourlyReadings(monthStart.AddDate(0, 0, -1), tt.now.Add(-30*time.Minute))...)
+			service, _ := newTestBudget(t, store, 50)
+
+			status, err := service.Status(context.Background(), "A", tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.Month != tt.month || status.DaysInMonth != tt.daysInMonth || status.DaysRemaining != tt.daysRemaining {
+				t.Errorf("month %s, %d days, %d remaining; want %s, %d, %d", status.Month, status.DaysInMonth, status.DaysRemaining, tt.month, tt.daysInMonth, tt.daysRemaining)
+			}
+			if math.Abs(status.Used-tt.used) > 1e-6 || math.Abs(status.MonthToDateKWh-tt.used) > 1e-6 {
+				t.Errorf("used = %v kWh, want %v", status.Used, tt.used)
+			}
+
+			projected := tt.used / tt.elapsedDays * float64(tt.daysInMonth)
+			if math.Abs(status.Projected-projected) > 1e-6 {
+				t.Errorf("projected = %v kWh, want %v", status.Projected, projected)
+			}
+			if math.Abs(status.PercentUsed-tt.used/50*100) > 1e-6 || math.Abs(status.ProjectedPercent-projected/50*100) > 1e-6 {
+				t.Errorf("percent used/projected = %v/%v", status.PercentUsed, status.ProjectedPercent)
+			}
+		})
+	}
+}
+
+func TestBudgetAlertsAcrossMonths(t *testing.T) {
+	store := database.NewMemoryStore()
+	jan31 := time.Date(2025, 1, 31, 23, 45, 0, 0, testLocation)
+	feb1 := time.Date(2025, 2, 1, 12, 0, 0, 0, testLocation)
+	seed(t, store, "A", hourlyReadings(time.Date(2025, 1, 1, 0, 0, 0, 0, testLocation), feb1.Add(-30*time.Minute))...)
+
+	// 74.3 kWh di Januari; 1.1 kWh di 12 jam pertama Februari = proyeksi 30.8
+	service, recorder := newTestBudget(t, store, 35)
+
+	steps := []struct {
+		now     time.Time
+		percent int // threshold alerted, 0 = none
+	}{
+		{jan31, 100},
+		{jan31.Add(10 * time.Minute), 0}, // sekali per threshold per bulan
+		{feb1, 80},                       // bulan baru mulai dari awal
+		{feb1.Add(10 * time.Minute), 0},
+	}
+	for _, step := range steps {
+		before := len(recorder.alerts)
+		service.RunOnce(step.now)
+		raised := recorder.alerts[before:]
+
+		if step.percent == 0 {
+			if len(raised) != 0 {
+				t.Errorf("%v: alerts %+v, want none", step.now, raised)
+			}
+			continue
+		}
+		if len(raised) != 1 {
+			t.Fatalf("%v: %d alerts, want the %d%% alert", step.now, len(raised), step.percent)
+		}
+		if want := 35 * float64(step.percent) / 100; raised[0].AlertType != "budget_projection" || raised[0].Threshold != want || raised[0].DeviceID != "A" {
+			t.Errorf("%v: alert = %+v, want budget_projection at %v kWh", step.now, raised[0], want)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+	"wattwise/internal/models"
+)
+
+// Finished commands are kept this long so clients can still poll them
+const commandHistoryTTL = time.Hour
+
+var ErrCommandNotFound = errors.New("command not found")
+
+// CommandTracker correlates published commands with device acks. It is used
+// concurrently by HTTP handlers (Track/Get) and the MQTT subscriber (Ack).
+type CommandTracker struct {
+	timeout time.Duration
+	logger  *slog.Logger
+
+	mu       sync.Mutex
+	commands map[string]*models.CommandStatus // by request id
+	done     map[string]chan struct{}         // closed when the command finishes
+
+	onTimeout func(models.CommandStatus)
+
+	stop chan struct{}
+}
+
+func NewCommandTracker(timeout time.Duration, logger *slog.Logger) *CommandTracker {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &CommandTracker{
+		timeout:  timeout,
+		logger:   logger.With("component", "command_tracker"),
+		commands: make(map[string]*models.CommandStatus),
+		done:     make(map[string]chan struct{}),
+		stop:     make(chan struct{}),
+	}
+}
+
+// SetTimeoutHandler is called (outside the lock) for every command that
+// times out without an ack
+func (t *CommandTracker) SetTimeoutHandler(handler func(models.CommandStatus)) {
+	t.onTimeout = handler
+}
+
+// Start runs the sweeper that times out pending commands
+func (t *CommandTracker) Start() {
+	go t.loop()
+}
+
+func (t *CommandTracker) Stop() {
+	select {
+	case <-t.stop:
+	default:
+		close(t.stop)
+	}
+}
+
+func (t *CommandTracker) loop() {
+	interval := t.timeout / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			t.sweep(now)
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+func (t *CommandTracker) sweep(now time.Time) {
+	var expired []models.CommandStatus
+
+	t.mu.Lock()
+	for id, cmd := range t.commands {
+		if t.expire(cmd, now) {
+			expired = append(expired, *cmd)
+		}
+		if cmd.Status != models.CommandPending && now.Sub(cmd.SentAt) > commandHistoryTTL {
+			delete(t.commands, id)
+		}
+	}
+	t.mu.Unlock()
+
+	t.timedOut(expired...)
+}
+
+// expire marks a pending command past its deadline as timed out and reports
+// whether it did. Must be called with t.mu held.
+func (t *CommandTracker) expire(cmd *models.CommandStatus, now time.Time) bool {
+	if cmd.Status != models.CommandPending || !now.After(cmd.Deadline) {
+		return false
+	}
+	cmd.Status = models.CommandTimeout
+	t.finish(cmd.RequestID)
+	t.logger.Warn("command timed out", "device_id", cmd.DeviceID, "request_id", cmd.RequestID, "action", cmd.Action)
+	return true
+}
+
+// finish wakes up Wait callers. Must be called with t.mu held.
+func (t *CommandTracker) finish(requestID string) {
+	if done, ok := t.done[requestID]; ok {
+		close(done)
+		delete(t.done, requestID)
+	}
+}
+
+func (t *CommandTracker) timedOut(commands ...models.CommandStatus) {
+	if t.onTimeout == nil {
+		return
+	}
+	for _, cmd := range commands {
+		t.onTimeout(cmd)
+	}
+}
+
+// Track registers a command as pending. Call it before publishing so an early
+// ack cannot arrive for an unknown request id.
+func (t *CommandTracker) Track(deviceID, requestID, action string) models.CommandStatus {
+	now := time.Now()
+	cmd := &models.CommandStatus{
+		RequestID: requestID,
+		DeviceID:  deviceID,
+		Action:    action,
+		Status:    models.CommandPending,
+		SentAt:    now,
+		Deadline:  now.Add(t.timeout),
+	}
+
+	t.mu.Lock()
+	t.finish(requestID) // request id dipakai ulang
+	t.commands[requestID] = cmd
+	t.done[requestID] = make(chan struct{})
+	t.mu.Unlock()
+
+	return *cmd
+}
+
+// Forget drops a command whose publish failed
+func (t *CommandTracker) Forget(requestID string) {
+	t.mu.Lock()
+	delete(t.commands, requestID)
+	t.finish(requestID)
+	t.mu.Unlock()
+}
+
+// Wait blocks until the command is acked, failed or timed out, or until
+// maxWait has passed, and returns its status at that point (possibly still
+// pending).
+func (t *CommandTracker) Wait(deviceID, requestID string, maxWait time.Duration) (*models.CommandStatus, error) {
+	t.mu.Lock()
+	cmd, ok := t.commands[requestID]
+	if !ok || cmd.DeviceID != deviceID {
+		t.mu.Unlock()
+		return nil, ErrCommandNotFound
+	}
+	done := t.done[requestID]
+	if untilDeadline := time.Until(cmd.Deadline); untilDeadline < maxWait {
+		maxWait = untilDeadline
+	}
+	t.mu.Unlock()
+
+	if done != nil {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+
+		select {
+		case <-done:
+		case <-timer.C:
+		}
+	}
+	return t.Get(deviceID, requestID)
+}
+
+// Ack records a device's acknowledgement. Acks for unknown, other-device or
+// already finished commands are ignored.
+func (t *CommandTracker) Ack(deviceID string, ack models.CommandAck) bool {
+	now := time.Now()
+
+	t.mu.Lock()
+	cmd, ok := t.commands[ack.RequestID]
+	if !ok || cmd.DeviceID != deviceID {
+		t.mu.Unlock()
+		t.logger.Warn("ack for unknown command", "device_id", deviceID, "request_id", ack.RequestID)
+		return false
+	}
+
+	if t.expire(cmd, now) {
+		expired := *cmd
+		t.mu.Unlock()
+		t.timedOut(expired)
+		t.logger.Warn("late ack ignored", "device_id", deviceID, "request_id", ack.RequestID, "status", expired.Status)
+		return false
+	}
+	if status := cmd.Status; status != models.CommandPending {
+		t.mu.Unlock()
+		t.logger.Warn("late ack ignored", "device_id", deviceID, "request_id", ack.RequestID, "status", status)
+		return false
+	}
+
+	cmd.Status = models.CommandAcked
+	if ack.Status == "error" {
+		cmd.Status = models.CommandFailed
+	}
+	cmd.Message = ack.Message
+	cmd.Response = ack.Response
+	cmd.AckedAt = &now
+	t.finish(ack.RequestID)
+	status := cmd.Status
+	t.mu.Unlock()
+
+	t.logger.Info("command acknowledged", "device_id", deviceID, "request_id", ack.RequestID, "status", status)
+	return true
+}
+
+// Get returns a copy of the command's current status
+func (t *CommandTracker) Get(deviceID, requestID string) (*models.CommandStatus, error) {
+	t.mu.Lock()
+	cmd, ok := t.commands[requestID]
+	if !ok || cmd.DeviceID != deviceID {
+		t.mu.Unlock()
+		return nil, ErrCommandNotFound
+	}
+
+	expired := t.expire(cmd, time.Now())
+	status := *cmd
+	t.mu.Unlock()
+
+	if expired {
+		t.timedOut(status)
+	}
+	return &status, nil
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+	"wattwise/internal/database"
+)
+
+func TestComparePeriodsEqualWindows(t *testing.T) {
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2025, month, day, hour, minute, 0, 0, testLocation)
+	}
+
+	tests := []struct {
+		period string
+		now    time.Time
+
+		curStart, prevStart, prevEnd string // start_date, start_date, end_date
+		prevUntil                    string
+	}{
+		{"daily", at(3, 15, 10, 30), "2025-03-15", "2025-03-14", "2025-03-14", "2025-03-14T10:30:00+07:00"},
+		{"weekly", at(3, 15, 10, 30), "2025-03-09", "2025-03-02", "2025-03-08", "2025-03-08T10:30:00+07:00"},
+		{"monthly", at(3, 15, 10, 30), "2025-03-01", "2025-02-01", "2025-02-15", "2025-02-15T10:30:00+07:00"},
+		// Februari tidak punya tanggal 31, bulan lalu dihitung penuh
+		{"monthly", at(3, 31, 10, 30), "2025-03-01", "2025-02-01", "2025-02-28", "2025-03-01T00:00:00+07:00"},
+		{"monthly", at(1, 1, 0, 30), "2025-01-01", "2024-12-01", "2024-12-01", "2024-12-01T00:30:00+07:00"},
+	}
+	for _, tt := range tests {
+		service := newTestService(database.NewMemoryStore())
+		comparison, err := service.ComparePeriods(context.Background(), "A", tt.period, tt.now)
+		if err != nil {
+			t.Fatalf("%s %v: %v", tt.period, tt.now, err)
+		}
+		cur, prev := comparison.Current, comparison.Previous
+		if cur.StartDate != tt.curStart || cur.EndDate != tt.now.Format("2006-01-02") || cur.Until != tt.now.Format(time.RFC3339) {
+			t.Errorf("%s %v: current = %s..%s until %s, want %s..%s until now", tt.period, tt.now, cur.StartDate, cur.EndDate, cur.Until, tt.curStart, tt.now.Format("2006-01-02"))
+		}
+		if prev.StartDate != tt.prevStart || prev.EndDate != tt.prevEnd || prev.Until != tt.prevUntil {
+			t.Errorf("%s %v: previous = %s..%s until %s, want %s..%s until %s", tt.period, tt.now, prev.StartDate, prev.EndDate, prev.Until, tt.prevStart, tt.prevEnd, tt.prevUntil)
+		}
+	}
+}
+
+func TestComparePeriodsSameHourYesterday(t *testing.T) {
+	store := database.NewMemoryStore()
+	service := newTestService(store)
+	at := func(day, hour int) time.Time { return time.Date(2025, 3, day, hour, 0, 0, 0, testLocation) }
+
+	// Kemarin 0.5 kWh sampai jam 10, lalu 1.5 kWh lagi malamnya
+	seed(t, store, "A",
+		reading(at(14, 8), 100, 1.0), reading(at(14, 10), 100, 1.5), reading(at(14, 20), 100, 3.0),
+		reading(at(15, 8), 100, 5.0), reading(at(15, 10), 100, 5.6),
+	)
+
+	comparison, err := service.ComparePeriods(context.Background(), "A", "daily", at(15, 10).Add(30*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := comparison.Previous.TotalEnergy; got != 0.5 {
+		t.Errorf("previous = %v kWh, want 0.5 (yesterday up to 10:30, not the whole day)", got)
+	}
+	if got := comparison.Current.TotalEnergy; got < 0.6-1e-9 || got > 0.6+1e-9 {
+		t.Errorf("current = %v kWh, want 0.6", got)
+	}
+	if comparison.ChangePercent == nil || *comparison.ChangePercent < 19.99 || *comparison.ChangePercent > 20.01 {
+		t.Errorf("change_percent = %v, want 20", comparison.ChangePercent)
+	}
+	if want := service.tariff.Cost(comparison.Previous.TotalEnergy); comparison.Previous.TotalCost != want {
+		t.Errorf("previous cost = %v, want %v", comparison.Previous.TotalCost, want)
+	}
+}
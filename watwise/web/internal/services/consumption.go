@@ -0,0 +1,80 @@
+package services
+
+import (
+	"sort"
+	"time"
+	"wattwise/internal/models"
+)
+
+// IntervalEnergy returns the kWh consumed over readings of a cumulative energy
+// counter (PZEM "energy"): the sum of increases between consecutive readings.
+// A drop means the counter was reset, so the new value itself counts as
+// consumption since the reset. Readings may be in any order.
+func IntervalEnergy(readings []models.EnergyData) float64 {
+	sorted := sortedByTime(readings)
+
+	total := 0.0
+	for i := 1; i < len(sorted); i++ {
+		total += energyDelta(sorted[i-1], sorted[i])
+	}
+	return total
+}
+
+// HourlyEnergy splits IntervalEnergy into hours: each increase is counted in
+// the hour (Unix millisecond of its start) of the later reading
+func HourlyEnergy(readings []models.EnergyData) map[int64]float64 {
+	sorted := sortedByTime(readings)
+
+	hourly := make(map[int64]float64)
+	for i := 1; i < len(sorted); i++ {
+		hour := truncateHour(sorted[i].Timestamp)
+		hourly[hour] += energyDelta(sorted[i-1], sorted[i])
+	}
+	return hourly
+}
+
+func energyDelta(prev, next models.EnergyData) float64 {
+	delta := next.ReadingKWh() - prev.ReadingKWh()
+	if delta < 0 {
+		// Counter reset (reset_energy / device restart)
+		delta = next.ReadingKWh()
+	}
+	return delta
+}
+
+func sortedByTime(readings []models.EnergyData) []models.EnergyData {
+	if len(readings) < 2 {
+		return nil
+	}
+	sorted := make([]models.EnergyData, len(readings))
+	copy(sorted, readings)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
+	return sorted
+}
+
+// ReadingsEnergy is IntervalEnergy for the EnergyReading form returned by
+// GetHistoricalData
+func ReadingsEnergy(readings []models.EnergyReading) float64 {
+	return IntervalEnergy(readingsData(readings))
+}
+
+// ReadingsEnergyBy splits ReadingsEnergy into groups (day, week, ...): like
+// HourlyEnergy, each increase is counted in the group of the later reading
+func ReadingsEnergyBy(readings []models.EnergyReading, group func(time.Time) string) map[string]float64 {
+	sorted := sortedByTime(readingsData(readings))
+
+	grouped := make(map[string]float64)
+	for i := 1; i < len(sorted); i++ {
+		key := group(time.UnixMilli(sorted[i].Timestamp))
+		grouped[key] += energyDelta(sorted[i-1], sorted[i])
+	}
+	return grouped
+}
+
+func readingsData(readings []models.EnergyReading) []models.EnergyData {
+	data := make([]models.EnergyData, len(readings))
+	for i, r := range readings {
+		data[i] = models.EnergyData{Timestamp: r.Timestamp.UnixMilli(), Energy: r.ReadingKWh()}
+	}
+	return data
+}
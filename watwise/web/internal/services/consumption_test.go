@@ -0,0 +1,74 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+	"wattwise/internal/models"
+)
+
+func TestEnergyDelta(t *testing.T) {
+	tests := []struct {
+		name       string
+		prev, next float64
+		want       float64
+	}{
+		{"increase", 1.25, 1.75, 0.5},
+		{"unchanged", 3.0, 3.0, 0},
+		{"from zero", 0, 0.2, 0.2},
+		// Counter turun: reset_energy atau device restart, nilai baru
+		// dihitung sebagai konsumsi sejak reset
+		{"reset to zero", 12.5, 0, 0},
+		{"reset then consumed", 12.5, 0.3, 0.3},
+		{"drop below previous", 5.0, 4.0, 4.0},
+		{"wrap of a large counter", 9999.99, 0.01, 0.01},
+	}
+	for _, tt := range tests {
+		got := energyDelta(models.EnergyData{Energy: tt.prev}, models.EnergyData{Energy: tt.next})
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: energyDelta(%v, %v) = %v, want %v", tt.name, tt.prev, tt.next, got, tt.want)
+		}
+		if got < 0 {
+			t.Errorf("%s: negative delta %v", tt.name, got)
+		}
+	}
+}
+
+func TestIntervalEnergy(t *testing.T) {
+	base := time.Date(2025, 1, 6, 8, 0, 0, 0, time.UTC)
+	at := func(minutes int, kwh float64) models.EnergyData {
+		return models.EnergyData{Timestamp: base.Add(time.Duration(minutes) * time.Minute).UnixMilli(), Energy: kwh}
+	}
+
+	tests := []struct {
+		name     string
+		readings []models.EnergyData
+		want     float64
+		hourly   map[int]float64 // hour offset from base -> kWh
+	}{
+		{"empty", nil, 0, map[int]float64{}},
+		{"single reading", []models.EnergyData{at(0, 5)}, 0, map[int]float64{}},
+		{"steady", []models.EnergyData{at(0, 1.0), at(30, 1.5), at(60, 2.0)}, 1.0, map[int]float64{0: 0.5, 1: 0.5}},
+		{"newest first", []models.EnergyData{at(60, 2.0), at(30, 1.5), at(0, 1.0)}, 1.0, map[int]float64{0: 0.5, 1: 0.5}},
+		{"reset in between", []models.EnergyData{at(0, 10.0), at(10, 10.4), at(20, 0.1), at(30, 0.3)}, 0.7, map[int]float64{0: 0.7}},
+		// Gap 3 jam tanpa data: kenaikan dihitung di jam reading berikutnya
+		{"gap", []models.EnergyData{at(0, 1.0), at(10, 1.1), at(190, 2.6), at(200, 2.7)}, 1.7, map[int]float64{0: 0.1, 3: 1.6}},
+		{"reset across a gap", []models.EnergyData{at(0, 7.0), at(240, 0.5)}, 0.5, map[int]float64{4: 0.5}},
+	}
+	for _, tt := range tests {
+		if got := IntervalEnergy(tt.readings); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: IntervalEnergy = %v, want %v", tt.name, got, tt.want)
+		}
+		hourly := HourlyEnergy(tt.readings)
+		if len(hourly) != len(tt.hourly) {
+			t.Errorf("%s: HourlyEnergy = %v, want %v", tt.name, hourly, tt.hourly)
+			continue
+		}
+		for offset, want := range tt.hourly {
+			hour := base.Add(time.Duration(offset) * time.Hour).UnixMilli()
+			if math.Abs(hourly[hour]-want) > 1e-9 {
+				t.Errorf("%s: hour +%d = %v, want %v", tt.name, offset, hourly[hour], want)
+			}
+		}
+	}
+}
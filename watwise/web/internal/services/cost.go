@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"wattwise/internal/models"
+)
+
+// GetCostBreakdown splits deviceID's consumption in [start, end) into peak
+// and off-peak blocks. start and end carry the zone the peak hours are
+// interpreted in. Without a peak rate everything is off-peak.
+func (s *EnergyService) GetCostBreakdown(ctx context.Context, deviceID string, start, end time.Time) (*models.CostBreakdown, error) {
+	// Satu jam sebelumnya ikut dibaca untuk delta energi reading pertama
+	readings, err := s.db.GetDataByTimeRange(ctx, deviceID, start.UnixMilli()-hourMs, end.UnixMilli()-1)
+	if err != nil {
+		s.logger.Error("cost breakdown query failed", "device_id", deviceID, "error", err)
+		return nil, err
+	}
+
+	loc := start.Location()
+	kwh := make(map[string]float64)
+	sorted := sortedByTime(readings)
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Timestamp < start.UnixMilli() {
+			continue
+		}
+		block := s.tariffBlock(time.UnixMilli(sorted[i].Timestamp).In(loc))
+		kwh[block] += energyDelta(sorted[i-1], sorted[i])
+	}
+
+	breakdown := &models.CostBreakdown{
+		DeviceID: deviceID,
+		Start:    start,
+		End:      end,
+		Timezone: loc.String(),
+	}
+	peakStart, peakEnd := s.tariff.PeakHours()
+	blocks := []models.CostBlock{{Block: BlockOffPeak, Hours: "00:00-24:00"}}
+	if s.tariff.TimeOfUse() {
+		blocks = []models.CostBlock{
+			{Block: BlockPeak, Hours: fmt.Sprintf("%02d:00-%02d:00", peakStart, peakEnd)},
+			{Block: BlockOffPeak, Hours: fmt.Sprintf("%02d:00-%02d:00", peakEnd, peakStart)},
+		}
+	}
+	for _, b := range blocks {
+		b.RatePerKWh = s.tariff.BlockRate(b.Block)
+		b.KWh = kwh[b.Block]
+		b.Cost = b.KWh * b.RatePerKWh
+		b.CostMoney = s.tariff.Money(b.Cost)
+		breakdown.TotalKWh += b.KWh
+		breakdown.TotalCost += b.Cost
+		breakdown.Blocks = append(breakdown.Blocks, b)
+	}
+	breakdown.TotalCostMoney = s.tariff.Money(breakdown.TotalCost)
+	return breakdown, nil
+}
+
+// tariffBlock classifies a local time as peak or off-peak. The peak window
+// [start, end) wraps past midnight when end < start.
+func (s *EnergyService) tariffBlock(t time.Time) string {
+	if !s.tariff.TimeOfUse() {
+		return BlockOffPeak
+	}
+	start, end := s.tariff.PeakHours()
+	hour := t.Hour()
+	peak := hour >= start && hour < end
+	if end < start {
+		peak = hour >= start || hour < end
+	}
+	if peak {
+		return BlockPeak
+	}
+	return BlockOffPeak
+}
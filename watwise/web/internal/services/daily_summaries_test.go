@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+	"wattwise/internal/database"
+	"wattwise/internal/models"
+)
+
+// roundTripStore adds a fixed delay to every range query, like the round
+// trip to IoTDB that a MemoryStore does not have
+type roundTripStore struct {
+	*database.MemoryStore
+	delay time.Duration
+}
+
+func (s *roundTripStore) StreamDataByTimeRange(ctx context.Context, deviceID string, startTime, endTime int64, limit int, fn func(models.EnergyData) error) error {
+	time.Sleep(s.delay)
+	return s.MemoryStore.StreamDataByTimeRange(ctx, deviceID, startTime, endTime, limit, fn)
+}
+
+// BenchmarkDailySummaries compares the single-pass month (one query, as
+// GetMonthlySummary does) with one CalculateDailySummary per day, over 30
+// days of 1-minute readings
+func BenchmarkDailySummaries(b *testing.B) {
+	const days = 30
+	first := time.Date(2025, 1, 1, 0, 0, 0, 0, testLocation)
+	readings := make([]models.EnergyData, days*24*60)
+	for i := range readings {
+		readings[i] = reading(first.Add(time.Duration(i)*time.Minute), 100+float64(i%60), float64(i)*0.002)
+	}
+
+	for _, delay := range []time.Duration{0, time.Millisecond} {
+		store := &roundTripStore{MemoryStore: database.NewMemoryStore(), delay: delay}
+		seed(b, store, "A", readings...)
+		service := newTestService(store)
+
+		b.Run(fmt.Sprintf("one query/round trip %v", delay), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				summaries, err := service.CalculateDailySummaries(context.Background(), "A", first, days)
+				if err != nil || len(summaries) != days {
+					b.Fatalf("%d summaries, %v", len(summaries), err)
+				}
+			}
+			b.ReportMetric(float64(len(readings))*float64(b.N)/b.Elapsed().Seconds(), "rows/s")
+		})
+
+		b.Run(fmt.Sprintf("query per day/round trip %v", delay), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for day := 0; day < days; day++ {
+					if _, err := service.CalculateDailySummary(context.Background(), "A", first.AddDate(0, 0, day)); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.ReportMetric(float64(len(readings))*float64(b.N)/b.Elapsed().Seconds(), "rows/s")
+		})
+	}
+}
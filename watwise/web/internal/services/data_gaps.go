@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"time"
+	"wattwise/internal/models"
+)
+
+// Gap scan of GET /api/energy/gaps, see SetGapDetection
+const (
+	DefaultGapInterval  = 20 * time.Second // MQTT_REPORT_INTERVAL_SECONDS
+	DefaultGapTolerance = 2.0
+
+	// Gaps returned per request; the rest are only counted
+	maxDataGaps = 1000
+)
+
+// SetGapDetection sets the report interval FindDataGaps expects from devices
+// without expected_report_interval_seconds, and the multiple of it above
+// which a spacing between readings is a gap
+func (s *EnergyService) SetGapDetection(interval time.Duration, tolerance float64) {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	if interval > 0 {
+		s.gapInterval = interval
+	}
+	if tolerance > 1 {
+		s.gapTolerance = tolerance
+	}
+}
+
+// GapDetection returns the interval and tolerance set by SetGapDetection
+func (s *EnergyService) GapDetection() (interval time.Duration, tolerance float64) {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.gapInterval, s.gapTolerance
+}
+
+// FindDataGaps returns the gaps in deviceID's readings of [start, end],
+// oldest first: every spacing between consecutive readings longer than
+// interval * tolerance, and the time from the last reading (or start, when
+// there is none) up to end or now, whichever is earlier, when that is as
+// long. interval <= 0 is the device's stored interval, else the
+// SetGapDetection one; tolerance <= 0 is the SetGapDetection one.
+func (s *EnergyService) FindDataGaps(ctx context.Context, deviceID string, start, end time.Time, interval time.Duration, tolerance float64) (*models.DataGapReport, error) {
+	defaultInterval, defaultTolerance := s.GapDetection()
+	if interval <= 0 {
+		interval = s.storedInterval(deviceID)
+	}
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	if tolerance <= 0 {
+		tolerance = defaultTolerance
+	}
+	threshold := int64(float64(interval.Milliseconds()) * tolerance)
+
+	report := &models.DataGapReport{
+		DeviceID:                deviceID,
+		Start:                   start,
+		End:                     end,
+		ExpectedIntervalSeconds: interval.Seconds(),
+		Tolerance:               tolerance,
+		ThresholdSeconds:        float64(threshold) / 1000,
+		Gaps:                    []models.DataGap{},
+	}
+
+	addGap := func(from, to int64, open bool) {
+		report.GapCount++
+		report.TotalGapSeconds += float64(to-from) / 1000
+		if len(report.Gaps) == maxDataGaps {
+			report.Truncated = true
+			return
+		}
+		report.Gaps = append(report.Gaps, models.DataGap{
+			Start:           from,
+			End:             to,
+			DurationSeconds: float64(to-from) / 1000,
+			MissedReadings:  max(int((to-from)/interval.Milliseconds())-1, 0),
+			Open:            open,
+		})
+	}
+
+	last := int64(0)
+	err := s.db.StreamRangeAscending(ctx, deviceID, start.UnixMilli(), end.UnixMilli(), func(r models.EnergyData) error {
+		report.Points++
+		if last > 0 && r.Timestamp-last > threshold {
+			addGap(last, r.Timestamp, false)
+		}
+		last = r.Timestamp
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("gap scan failed", "device_id", deviceID, "error", err)
+		return nil, err
+	}
+
+	// Device yang diam sampai sekarang: gap terbuka setelah reading terakhir
+	if last == 0 {
+		last = start.UnixMilli()
+	}
+	if tail := min(end.UnixMilli(), time.Now().UnixMilli()); tail-last > threshold {
+		addGap(last, tail, true)
+	}
+
+	s.logger.Debug("gap scan completed", "device_id", deviceID, "points", report.Points, "gaps", report.GapCount, "interval", interval)
+	return report, nil
+}
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+	"wattwise/internal/models"
+)
+
+// Demand window (rata-rata daya untuk tarif berbasis peak demand), see
+// SetDemandWindow
+const (
+	DefaultDemandWindowMinutes = 15
+
+	// Windows with readings for less than this share of their span are skipped
+	demandMinCoverage = 0.8
+	demandTopWindows  = 10
+	// Recent gaps used to estimate a live device's reporting interval
+	demandIntervalGaps = 15
+)
+
+// DemandWindowMinutes are the accepted window lengths
+var DemandWindowMinutes = []int{15, 30, 60}
+
+// SetDemandWindow sets the demand window length and the zone whose midnight
+// and month start reset the running peaks. Running peaks are cleared.
+func (s *EnergyService) SetDemandWindow(minutes int, loc *time.Location) {
+	if !slices.Contains(DemandWindowMinutes, minutes) {
+		minutes = DefaultDemandWindowMinutes
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+
+	s.settingsMu.Lock()
+	s.demandWindow, s.demandLoc = time.Duration(minutes)*time.Minute, loc
+	s.settingsMu.Unlock()
+
+	s.demand.reset()
+}
+
+func (s *EnergyService) demandSettings() (time.Duration, *time.Location) {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.demandWindow, s.demandLoc
+}
+
+// ComputePeakDemand finds the highest average power over any window of
+// windowMinutes (0 = configured) between start and end. Windows start at each
+// reading; the top list holds non-overlapping windows only.
+func (s *EnergyService) ComputePeakDemand(ctx context.Context, deviceID string, start, end time.Time, windowMinutes int) (*models.PeakDemandReport, error) {
+	window, _ := s.demandSettings()
+	if windowMinutes > 0 {
+		window = time.Duration(windowMinutes) * time.Minute
+	}
+
+	readings, err := s.db.GetDataByTimeRange(ctx, deviceID, start.UnixMilli(), end.UnixMilli()-1)
+	if err != nil {
+		s.logger.Error("peak demand query failed", "device_id", deviceID, "error", err)
+		return nil, err
+	}
+
+	windows, excluded := demandWindows(readings, window, s.storedInterval(deviceID))
+	report := &models.PeakDemandReport{
+		DeviceID:        deviceID,
+		Start:           start,
+		End:             end,
+		WindowMinutes:   int(window / time.Minute),
+		MinCoverage:     demandMinCoverage,
+		TopWindows:      topDemandWindows(windows, demandTopWindows),
+		WindowsExcluded: excluded,
+	}
+	if len(report.TopWindows) > 0 {
+		peak := report.TopWindows[0]
+		report.Peak = &peak
+	}
+	return report, nil
+}
+
+// demandWindows averages power over [t, t+window) for every reading time t.
+// Windows covered by readings for less than demandMinCoverage are counted as
+// excluded. Coverage counts readings of expected spacing each, estimated from
+// the data when expected is 0.
+func demandWindows(readings []models.EnergyData, window, expected time.Duration) ([]models.DemandWindow, int) {
+	sorted := slices.Clone(readings)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
+
+	interval := expected.Milliseconds()
+	if interval <= 0 {
+		var gaps []int64
+		for i := 1; i < len(sorted); i++ {
+			if gap := sorted[i].Timestamp - sorted[i-1].Timestamp; gap > 0 {
+				gaps = append(gaps, gap)
+			}
+		}
+		interval = medianGap(gaps)
+	}
+	if interval <= 0 {
+		return nil, len(sorted)
+	}
+
+	// sums[i] = total power of sorted[:i]
+	sums := make([]float64, len(sorted)+1)
+	for i, r := range sorted {
+		sums[i+1] = sums[i] + r.Power
+	}
+
+	var windows []models.DemandWindow
+	excluded := 0
+	j := 0
+	for i, r := range sorted {
+		end := r.Timestamp + window.Milliseconds()
+		for j < len(sorted) && sorted[j].Timestamp < end {
+			j++
+		}
+
+		n := j - i
+		coverage := demandCoverage(n, interval, window)
+		if coverage < demandMinCoverage {
+			excluded++
+			continue
+		}
+		windows = append(windows, models.DemandWindow{
+			Start:     time.UnixMilli(r.Timestamp),
+			End:       time.UnixMilli(end),
+			AverageKW: (sums[j] - sums[i]) / float64(n) / 1000,
+			Samples:   n,
+			Coverage:  coverage,
+		})
+	}
+	return windows, excluded
+}
+
+// topDemandWindows returns up to n non-overlapping windows, highest first
+func topDemandWindows(windows []models.DemandWindow, n int) []models.DemandWindow {
+	ranked := slices.Clone(windows)
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].AverageKW > ranked[j].AverageKW })
+
+	top := []models.DemandWindow{}
+	for _, w := range ranked {
+		if len(top) == n {
+			break
+		}
+		overlaps := slices.ContainsFunc(top, func(t models.DemandWindow) bool {
+			return w.Start.Before(t.End) && t.Start.Before(w.End)
+		})
+		if !overlaps {
+			top = append(top, w)
+		}
+	}
+	return top
+}
+
+// demandCoverage is the share of window covered by samples readings taken
+// every interval ms
+func demandCoverage(samples int, interval int64, window time.Duration) float64 {
+	return min(float64(int64(samples)*interval)/float64(window.Milliseconds()), 1)
+}
+
+// medianGap is the typical spacing between readings, 0 without gaps
+func medianGap(gaps []int64) int64 {
+	if len(gaps) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(gaps)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// storedInterval is the configured spacing of deviceID's stored readings
+// (models.Device.StoredInterval), 0 = unknown
+func (s *EnergyService) storedInterval(deviceID string) time.Duration {
+	if s.devices == nil {
+		return 0
+	}
+	device, err := s.devices.Get(deviceID)
+	if err != nil {
+		return 0
+	}
+	return device.StoredInterval()
+}
+
+// reportInterval is deviceID's expected_report_interval_seconds, the spacing
+// of its live readings; 0 = unknown
+func (s *EnergyService) reportInterval(deviceID string) time.Duration {
+	if s.devices == nil {
+		return 0
+	}
+	device, err := s.devices.Get(deviceID)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(device.ExpectedReportIntervalSeconds) * time.Second
+}
+
+// CheckDemandPeak feeds a live reading into the device's running demand
+// window and raises "demand_peak" when the window sets a new monthly maximum,
+// at most once per window length. The first window of a month only sets the
+// baseline. Peaks live in memory, so they restart empty with the server.
+// Switched with the threshold alerts.
+func (s *EnergyService) CheckDemandPeak(deviceID string, data *models.EnergyData) *models.AlertData {
+	window, loc := s.demandSettings()
+	current, previous, isNew := s.demand.observe(deviceID, *data, window, s.reportInterval(deviceID), loc)
+	if !isNew || !s.Toggles().Threshold {
+		return nil
+	}
+
+	return &models.AlertData{
+		DeviceID:    deviceID,
+		AlertType:   "demand_peak",
+		Message:     fmt.Sprintf("New monthly peak demand: %.2f kW over %d min (previous %.2f kW)", current.AverageKW, int(window/time.Minute), previous),
+		Threshold:   previous,
+		ActualValue: current.AverageKW,
+		Timestamp:   data.Timestamp,
+	}
+}
+
+// TodayPeakDemand returns the highest live demand window of deviceID since
+// midnight of now's day
+func (s *EnergyService) TodayPeakDemand(deviceID string, now time.Time) (models.DemandWindow, bool) {
+	_, loc := s.demandSettings()
+	return s.demand.today(deviceID, now.In(loc).Format("2006-01-02"))
+}
+
+// demandTracker keeps each device's running demand window from live readings
+type demandTracker struct {
+	mu      sync.Mutex
+	devices map[string]*deviceDemand
+}
+
+type deviceDemand struct {
+	samples []models.EnergyData // within the window, ascending
+	sum     float64             // power of samples
+	gaps    []int64             // last demandIntervalGaps gaps, ms
+
+	day       string
+	dayPeak   models.DemandWindow
+	month     string
+	monthPeak models.DemandWindow
+	lastAlert int64
+}
+
+func newDemandTracker() *demandTracker {
+	return &demandTracker{devices: make(map[string]*deviceDemand)}
+}
+
+func (t *demandTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.devices = make(map[string]*deviceDemand)
+}
+
+// observe adds data and returns the window ending at it; isNew reports a new
+// monthly maximum worth alerting, previous is the maximum it replaced.
+// expected is the device's report interval, 0 = estimate from recent gaps.
+func (t *demandTracker) observe(deviceID string, data models.EnergyData, window, expected time.Duration, loc *time.Location) (current models.DemandWindow, previous float64, isNew bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	d, ok := t.devices[deviceID]
+	if !ok {
+		d = &deviceDemand{}
+		t.devices[deviceID] = d
+	}
+
+	// Data lama (backfill/out of order) tidak mengubah window berjalan
+	if n := len(d.samples); n > 0 {
+		gap := data.Timestamp - d.samples[n-1].Timestamp
+		if gap <= 0 {
+			return current, 0, false
+		}
+		d.gaps = append(d.gaps, gap)
+		if len(d.gaps) > demandIntervalGaps {
+			d.gaps = d.gaps[1:]
+		}
+	}
+
+	d.samples = append(d.samples, data)
+	d.sum += data.Power
+	start := data.Timestamp - window.Milliseconds()
+	for len(d.samples) > 0 && d.samples[0].Timestamp <= start {
+		d.sum -= d.samples[0].Power
+		d.samples = d.samples[1:]
+	}
+
+	interval := expected.Milliseconds()
+	if interval <= 0 {
+		interval = medianGap(d.gaps)
+	}
+	coverage := demandCoverage(len(d.samples), interval, window)
+	if interval <= 0 || coverage < demandMinCoverage {
+		return current, 0, false
+	}
+	current = models.DemandWindow{
+		Start:     time.UnixMilli(start),
+		End:       time.UnixMilli(data.Timestamp),
+		AverageKW: d.sum / float64(len(d.samples)) / 1000,
+		Samples:   len(d.samples),
+		Coverage:  coverage,
+	}
+
+	local := current.End.In(loc)
+	if day := local.Format("2006-01-02"); day != d.day {
+		d.day, d.dayPeak = day, models.DemandWindow{}
+	}
+	if current.AverageKW > d.dayPeak.AverageKW || d.dayPeak.Samples == 0 {
+		d.dayPeak = current
+	}
+
+	if month := local.Format("2006-01"); month != d.month {
+		d.month, d.monthPeak = month, current
+		return current, 0, false
+	}
+	if current.AverageKW <= d.monthPeak.AverageKW {
+		return current, 0, false
+	}
+
+	previous = d.monthPeak.AverageKW
+	d.monthPeak = current
+	if data.Timestamp-d.lastAlert < window.Milliseconds() {
+		return current, previous, false
+	}
+	d.lastAlert = data.Timestamp
+	return current, previous, true
+}
+
+func (t *demandTracker) today(deviceID, day string) (models.DemandWindow, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	d, ok := t.devices[deviceID]
+	if !ok || d.day != day || d.dayPeak.Samples == 0 {
+		return models.DemandWindow{}, false
+	}
+	return d.dayPeak, true
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"wattwise/internal/models"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// MaxCompareDevices caps device_ids per comparison request
+	MaxCompareDevices = 10
+	// Query IoTDB untuk beberapa device sekaligus, tapi tidak semuanya
+	compareConcurrency = 4
+)
+
+// CompareGranularities are the bucket sizes accepted by CompareDevices
+var CompareGranularities = []string{"hourly", "daily", "weekly", "monthly"}
+
+// CompareDevices aggregates each device's readings from startDate to endDate
+// (inclusive) into the same buckets, so the series can be overlaid, and
+// ranks the devices by kWh. Buckets without readings are explicit zeros.
+func (s *EnergyService) CompareDevices(ctx context.Context, deviceIDs []string, startDate, endDate time.Time, granularity string) (*models.DeviceComparison, error) {
+	if len(deviceIDs) == 0 || len(deviceIDs) > MaxCompareDevices {
+		return nil, fmt.Errorf("compare 1 to %d devices, got %d", MaxCompareDevices, len(deviceIDs))
+	}
+	bucketOf, err := bucketFunc(granularity)
+	if err != nil {
+		return nil, err
+	}
+
+	from := startDate
+	to := endDate.AddDate(0, 0, 1)
+	buckets := bucketRange(from, to, granularity, bucketOf)
+
+	readings := make([][]models.EnergyData, len(deviceIDs))
+	var g errgroup.Group
+	g.SetLimit(compareConcurrency)
+	for i, deviceID := range deviceIDs {
+		g.Go(func() error {
+			data, err := s.db.GetDataByTimeRange(ctx, deviceID, from.UnixMilli(), to.UnixMilli()-1)
+			if err != nil {
+				return fmt.Errorf("%s: %w", deviceID, err)
+			}
+			readings[i] = data
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		s.logger.Error("device comparison query failed", "devices", deviceIDs, "error", err)
+		return nil, err
+	}
+
+	comparison := &models.DeviceComparison{
+		Granularity: granularity,
+		StartDate:   startDate.Format("2006-01-02"),
+		EndDate:     endDate.Format("2006-01-02"),
+		Buckets:     buckets,
+	}
+	for i, deviceID := range deviceIDs {
+		series := aggregateBuckets(readings[i], buckets, bucketOf)
+
+		total := 0.0
+		for _, b := range series {
+			total += b.TotalKWh
+		}
+
+		comparison.Series = append(comparison.Series, models.DeviceSeries{DeviceID: deviceID, Data: series})
+		cost := s.tariff.Cost(total)
+		comparison.Totals = append(comparison.Totals, models.DeviceRanking{
+			DeviceID:  deviceID,
+			TotalKWh:  total,
+			Cost:      cost,
+			CostMoney: s.tariff.Money(cost),
+		})
+	}
+
+	sort.SliceStable(comparison.Totals, func(i, j int) bool {
+		return comparison.Totals[i].TotalKWh > comparison.Totals[j].TotalKWh
+	})
+	for i := range comparison.Totals {
+		comparison.Totals[i].Rank = i + 1
+	}
+	return comparison, nil
+}
+
+func bucketFunc(granularity string) (func(time.Time) string, error) {
+	switch granularity {
+	case "hourly":
+		return func(t time.Time) string { return t.Format("2006-01-02 15:00") }, nil
+	case "daily":
+		return func(t time.Time) string { return t.Format("2006-01-02") }, nil
+	case "weekly":
+		return func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}, nil
+	case "monthly":
+		return func(t time.Time) string { return t.Format("2006-01") }, nil
+	}
+	return nil, fmt.Errorf("invalid granularity %q, use: hourly, daily, weekly, monthly", granularity)
+}
+
+// bucketRange lists every bucket key in [from, to)
+func bucketRange(from, to time.Time, granularity string, bucketOf func(time.Time) string) []string {
+	step := func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	if granularity == "hourly" {
+		step = func(t time.Time) time.Time { return t.Add(time.Hour) }
+	}
+
+	var buckets []string
+	seen := make(map[string]bool)
+	for t := from; t.Before(to); t = step(t) {
+		if key := bucketOf(t); !seen[key] {
+			seen[key] = true
+			buckets = append(buckets, key)
+		}
+	}
+	return buckets
+}
+
+// aggregateBuckets returns one FilteredEnergyData per bucket. kWh is the
+// increase of the energy counter, counted in the bucket of the later reading.
+func aggregateBuckets(readings []models.EnergyData, buckets []string, bucketOf func(time.Time) string) []models.FilteredEnergyData {
+	index := make(map[string]int, len(buckets))
+	result := make([]models.FilteredEnergyData, len(buckets))
+	for i, key := range buckets {
+		index[key] = i
+		result[i] = models.FilteredEnergyData{TimeGroup: key}
+	}
+
+	sorted := readings
+	if len(readings) > 1 {
+		sorted = sortedByTime(readings)
+	}
+	for i, r := range sorted {
+		b, ok := index[bucketOf(time.UnixMilli(r.Timestamp))]
+		if !ok {
+			continue
+		}
+		data := &result[b]
+
+		if data.DataCount == 0 || r.Power < data.MinPower {
+			data.MinPower = r.Power
+		}
+		if data.DataCount == 0 || r.Power > data.MaxPower {
+			data.MaxPower = r.Power
+		}
+		w := float64(r.Weight())
+		data.AvgPower += r.Power * w
+		data.AvgVoltage += r.Voltage * w
+		data.AvgCurrent += r.Current * w
+		data.DataCount += r.Weight()
+
+		if i > 0 {
+			data.TotalKWh += energyDelta(sorted[i-1], r)
+		}
+	}
+
+	for i := range result {
+		if n := result[i].DataCount; n > 0 {
+			result[i].AvgPower /= float64(n)
+			result[i].AvgVoltage /= float64(n)
+			result[i].AvgCurrent /= float64(n)
+		}
+	}
+	return result
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+	"wattwise/internal/models"
+	"wattwise/internal/repositories"
+)
+
+// Device id dipakai sebagai node path di IoTDB dan topic MQTT
+var validDeviceID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ErrInvalidDevice wraps validation errors from Register/Update
+var ErrInvalidDevice = errors.New("invalid device")
+
+// CommandActions adalah action yang boleh dikirim ke device lewat MQTT
+var CommandActions = []string{"relay_on", "relay_off", "reset_energy"}
+
+// ValidateCommandAction checks action against CommandActions
+func ValidateCommandAction(action string) error {
+	for _, allowed := range CommandActions {
+		if action == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid action %q, use: %s", action, strings.Join(CommandActions, ", "))
+}
+
+type DeviceService struct {
+	repo   *repositories.DeviceRepository
+	logger *slog.Logger
+}
+
+func NewDeviceService(repo *repositories.DeviceRepository, logger *slog.Logger) *DeviceService {
+	return &DeviceService{
+		repo:   repo,
+		logger: logger.With("component", "device_service"),
+	}
+}
+
+// ValidateDeviceID checks that id is usable as an IoTDB node name
+func ValidateDeviceID(id string) error {
+	if !validDeviceID.MatchString(id) {
+		return fmt.Errorf("%w: id %q must be 1-64 letters, digits, '_' or '-'", ErrInvalidDevice, id)
+	}
+	return nil
+}
+
+// Register menyimpan device baru. Name default ke id.
+func (s *DeviceService) Register(device models.Device) (*models.Device, error) {
+	device.ID = strings.TrimSpace(device.ID)
+	if err := ValidateDeviceID(device.ID); err != nil {
+		return nil, err
+	}
+	if device.MaxPower < 0 {
+		return nil, fmt.Errorf("%w: max_power must be >= 0, got %.2f", ErrInvalidDevice, device.MaxPower)
+	}
+	if device.MinPowerFactor < 0 || device.MinPowerFactor > 1 {
+		return nil, fmt.Errorf("%w: min_power_factor must be between 0 and 1, got %.2f", ErrInvalidDevice, device.MinPowerFactor)
+	}
+	if device.ExpectedReportIntervalSeconds < 0 {
+		return nil, fmt.Errorf("%w: expected_report_interval_seconds must be >= 0, got %d", ErrInvalidDevice, device.ExpectedReportIntervalSeconds)
+	}
+	if device.Name == "" {
+		device.Name = device.ID
+	}
+	device.CreatedAt = time.Now()
+
+	if err := s.repo.Create(device); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("device registered", "device_id", device.ID, "name", device.Name)
+	return &device, nil
+}
+
+// EnsureRegistered registers deviceID with default metadata if it is unknown.
+// Dipanggil untuk setiap pesan MQTT, jadi jalur "sudah terdaftar" harus murah.
+func (s *DeviceService) EnsureRegistered(deviceID string) error {
+	if _, err := s.repo.Get(deviceID); err == nil {
+		return nil
+	}
+
+	_, err := s.Register(models.Device{ID: deviceID})
+	if errors.Is(err, repositories.ErrDeviceExists) {
+		return nil
+	}
+	return err
+}
+
+func (s *DeviceService) List() []models.Device {
+	return s.repo.List()
+}
+
+// IDs returns the ids of all registered devices
+func (s *DeviceService) IDs() []string {
+	devices := s.repo.List()
+	ids := make([]string, len(devices))
+	for i, d := range devices {
+		ids[i] = d.ID
+	}
+	return ids
+}
+
+func (s *DeviceService) Get(deviceID string) (*models.Device, error) {
+	device, err := s.repo.Get(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+func (s *DeviceService) Update(deviceID string, update models.DeviceUpdate) (*models.Device, error) {
+	device, err := s.repo.Get(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Name != nil {
+		if *update.Name == "" {
+			return nil, fmt.Errorf("%w: name must not be empty", ErrInvalidDevice)
+		}
+		device.Name = *update.Name
+	}
+	if update.Location != nil {
+		device.Location = *update.Location
+	}
+	if update.MaxPower != nil {
+		if *update.MaxPower < 0 {
+			return nil, fmt.Errorf("%w: max_power must be >= 0, got %.2f", ErrInvalidDevice, *update.MaxPower)
+		}
+		device.MaxPower = *update.MaxPower
+	}
+	if update.AnomalySigma != nil {
+		if *update.AnomalySigma < 0 {
+			return nil, fmt.Errorf("%w: anomaly_sigma must be >= 0, got %.2f", ErrInvalidDevice, *update.AnomalySigma)
+		}
+		device.AnomalySigma = *update.AnomalySigma
+	}
+	if update.AnomalyWarmupDays != nil {
+		if *update.AnomalyWarmupDays < 0 {
+			return nil, fmt.Errorf("%w: anomaly_warmup_days must be >= 0, got %d", ErrInvalidDevice, *update.AnomalyWarmupDays)
+		}
+		device.AnomalyWarmupDays = *update.AnomalyWarmupDays
+	}
+	if update.MinPowerFactor != nil {
+		if *update.MinPowerFactor < 0 || *update.MinPowerFactor > 1 {
+			return nil, fmt.Errorf("%w: min_power_factor must be between 0 and 1, got %.2f", ErrInvalidDevice, *update.MinPowerFactor)
+		}
+		device.MinPowerFactor = *update.MinPowerFactor
+	}
+	if update.MinFrequency != nil {
+		if *update.MinFrequency < 0 {
+			return nil, fmt.Errorf("%w: min_frequency must be >= 0, got %.2f", ErrInvalidDevice, *update.MinFrequency)
+		}
+		device.MinFrequency = *update.MinFrequency
+	}
+	if update.MaxFrequency != nil {
+		if *update.MaxFrequency < 0 {
+			return nil, fmt.Errorf("%w: max_frequency must be >= 0, got %.2f", ErrInvalidDevice, *update.MaxFrequency)
+		}
+		device.MaxFrequency = *update.MaxFrequency
+	}
+	if update.StoreIntervalSeconds != nil {
+		if *update.StoreIntervalSeconds < 0 {
+			return nil, fmt.Errorf("%w: store_interval_seconds must be >= 0, got %d", ErrInvalidDevice, *update.StoreIntervalSeconds)
+		}
+		device.StoreIntervalSeconds = *update.StoreIntervalSeconds
+	}
+	if update.ExpectedReportIntervalSeconds != nil {
+		if *update.ExpectedReportIntervalSeconds < 0 {
+			return nil, fmt.Errorf("%w: expected_report_interval_seconds must be >= 0, got %d", ErrInvalidDevice, *update.ExpectedReportIntervalSeconds)
+		}
+		device.ExpectedReportIntervalSeconds = *update.ExpectedReportIntervalSeconds
+	}
+	if device.MinFrequency > 0 && device.MaxFrequency > 0 && device.MinFrequency >= device.MaxFrequency {
+		return nil, fmt.Errorf("%w: min_frequency (%.2f) must be below max_frequency (%.2f)", ErrInvalidDevice, device.MinFrequency, device.MaxFrequency)
+	}
+
+	if err := s.repo.Update(device); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("device updated", "device_id", device.ID)
+	return &device, nil
+}
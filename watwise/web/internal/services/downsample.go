@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"wattwise/internal/database"
+)
+
+// DownsampleJob periodically replaces raw readings older than afterDays with
+// hourly aggregates (see database.DownsampleBefore)
+type DownsampleJob struct {
+	db        *database.IoTDB
+	afterDays int
+	every     time.Duration
+	logger    *slog.Logger
+	stop      chan struct{}
+}
+
+func NewDownsampleJob(db *database.IoTDB, afterDays, intervalMinutes int, logger *slog.Logger) *DownsampleJob {
+	if intervalMinutes <= 0 {
+		intervalMinutes = 60
+	}
+	return &DownsampleJob{
+		db:        db,
+		afterDays: afterDays,
+		every:     time.Duration(intervalMinutes) * time.Minute,
+		logger:    logger.With("component", "downsample"),
+		stop:      make(chan struct{}),
+	}
+}
+
+// Start runs the job in the background. afterDays <= 0 disables it.
+func (j *DownsampleJob) Start() {
+	if j.afterDays <= 0 {
+		j.logger.Info("downsampling disabled (IOTDB_DOWNSAMPLE_AFTER_DAYS=0)")
+		return
+	}
+
+	j.logger.Info("downsampling enabled", "after_days", j.afterDays, "every", j.every)
+	go j.loop()
+}
+
+func (j *DownsampleJob) Stop() {
+	select {
+	case <-j.stop:
+	default:
+		close(j.stop)
+	}
+}
+
+func (j *DownsampleJob) loop() {
+	ticker := time.NewTicker(j.every)
+	defer ticker.Stop()
+
+	for {
+		j.RunOnce(time.Now())
+
+		select {
+		case <-ticker.C:
+		case <-j.stop:
+			return
+		}
+	}
+}
+
+// RunOnce downsamples every device's raw data older than now - afterDays
+func (j *DownsampleJob) RunOnce(now time.Time) {
+	if !j.db.IsEnabled() {
+		j.logger.Debug("IoTDB not connected, skipping downsample run")
+		return
+	}
+
+	ctx := context.Background()
+	devices, err := j.db.ListDeviceIDs(ctx)
+	if err != nil {
+		j.logger.Error("failed to list devices", "error", err)
+		return
+	}
+
+	cutoff := now.AddDate(0, 0, -j.afterDays)
+	total := 0
+	for _, deviceID := range devices {
+		rows, err := j.db.DownsampleBefore(ctx, deviceID, cutoff.UnixMilli())
+		if err != nil {
+			// Device lain tetap diproses, device ini dicoba lagi di run berikutnya
+			j.logger.Error("downsample failed", "device_id", deviceID, "error", err)
+			continue
+		}
+		total += rows
+	}
+
+	j.logger.Info("downsample run completed", "devices", len(devices), "cutoff", cutoff, "hourly_rows", total)
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+	"wattwise/internal/database"
+)
+
+// Setelah downsampling satu baris per jam mewakili banyak pembacaan mentah,
+// rata-rata harus memberi bobot sesuai jumlah sampelnya
+func TestHourlyAggregatesWeightedBySamples(t *testing.T) {
+	store := database.NewMemoryStore()
+	service := newTestService(store)
+
+	day := time.Date(2025, 1, 1, 0, 0, 0, 0, testLocation)
+	hourly := reading(day.Add(8*time.Hour), 100, 1.0)
+	hourly.Samples = 59
+	raw := reading(day.Add(9*time.Hour), 400, 1.5)
+	seed(t, store, "A", hourly, raw)
+
+	summaries, err := service.CalculateDailySummaries(context.Background(), "A", day, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// (59×100 + 400) / 60, bukan (100 + 400) / 2
+	if got := summaries[0].AvgPower; got != 105 {
+		t.Errorf("daily summary AvgPower = %v, want 105", got)
+	}
+	if got := summaries[0].TotalEnergy; got != 0.5 {
+		t.Errorf("daily summary TotalEnergy = %v, want 0.5", got)
+	}
+
+	readings, err := store.GetDataByTimeRange(context.Background(), "A", day.UnixMilli(), day.AddDate(0, 0, 1).UnixMilli())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := service.calculateDailyStats(readings, "2025-01-01")
+	if stats.AvgPower != 105 || stats.Count != 60 {
+		t.Errorf("daily stats AvgPower = %v over %d readings, want 105 over 60", stats.AvgPower, stats.Count)
+	}
+
+	heatmap := service.AggregateHeatmap(readings)
+	total := 0
+	for _, hours := range heatmap.Count {
+		for _, n := range hours {
+			total += n
+		}
+	}
+	if total != 60 {
+		t.Errorf("heatmap counts %d readings, want 60", total)
+	}
+}
@@ -1,25 +1,287 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 	"wattwise/internal/database"
 	"wattwise/internal/models"
 )
 
+// DeviceStatusProvider reports online/offline state per device (*mqtt.Subscriber)
+type DeviceStatusProvider interface {
+	GetAllDeviceStatus() []*models.DeviceStatus
+	GetDeviceDiagnostics(deviceID string) (*models.DeviceDiagnostics, bool)
+}
+
 type EnergyService struct {
-	db *database.IoTDB
+	db     database.Store
+	tariff *TariffService
+	logger *slog.Logger
+
+	// Optional, set by SetDeviceSources; used by GetRealtimeStats
+	devices  *DeviceService
+	statuses DeviceStatusProvider
+
+	// Replaced at runtime by SettingsManager, read through Thresholds and
+	// Toggles
+	settingsMu sync.RWMutex
+	thresholds AlertThresholds
+	toggles    AlertToggles
+
+	// Night window for ComputeStandbyPower, see SetStandbyWindow
+	standbyStart      int
+	standbyEnd        int
+	standbyMinSamples int
+
+	// Demand window for ComputePeakDemand and the live peaks, see
+	// SetDemandWindow
+	demandWindow time.Duration
+	demandLoc    *time.Location
+	demand       *demandTracker
+
+	// Rolling z-score scan of FindPowerAnomalies, see SetAnomalyScan
+	anomalyWindow int
+	anomalyZScore float64
+
+	// Data gap scan of FindDataGaps, see SetGapDetection
+	gapInterval  time.Duration
+	gapTolerance float64
+
+	// Severity bands of threshold alerts (under settingsMu), see
+	// SetSeverityBands, and each device's ongoing alert for escalation
+	severity     severityBands
+	escalationMu sync.Mutex
+	ongoing      map[string]ongoingAlert
+
+	// Consecutive power factor / frequency violations per device
+	qualityMu sync.Mutex
+	quality   map[string]*qualityStreak
+
+	// Optional, see SetResponseCache, SetSummaryCache and SetLatestCache
+	cache     *ResponseCache
+	summaries *SummaryCache
+	latest    *LatestCache
+
+	// Optional, see SetRollups
+	rollups *RollupJob
+}
+
+// AlertThresholds are the fixed bounds checked by CheckThresholdAlert and
+// CheckQualityAlerts. A zero MinPowerFactor or frequency bound disables that
+// check.
+type AlertThresholds struct {
+	MaxPower       float64 // W
+	MaxCurrent     float64 // A
+	MinVoltage     float64 // V
+	MaxVoltage     float64 // V
+	MinPowerFactor float64 // < 0.8 biasanya beban reaktif bermasalah
+	MinFrequency   float64 // Hz
+	MaxFrequency   float64 // Hz
+
+	SustainedReadings int // consecutive readings before a quality alert
+}
+
+// AlertToggles switch alert kinds on and off without touching their bounds
+type AlertToggles struct {
+	Threshold bool // high_power, high_current, voltage_abnormal
+	Quality   bool // low_power_factor, frequency_deviation
+	Anomaly   bool
+	Budget    bool // budget_projection
+}
+
+// DefaultAlertToggles enables every alert
+var DefaultAlertToggles = AlertToggles{Threshold: true, Quality: true, Anomaly: true, Budget: true}
+
+// DefaultAlertThresholds untuk listrik PLN 220V/50Hz
+var DefaultAlertThresholds = AlertThresholds{
+	MaxPower:       2200,
+	MaxCurrent:     10,
+	MinVoltage:     200,
+	MaxVoltage:     240,
+	MinPowerFactor: 0.8,
+	MinFrequency:   49.5,
+	MaxFrequency:   50.5,
+
+	SustainedReadings: 3,
 }
 
-func NewEnergyService(db *database.IoTDB) *EnergyService {
+func NewEnergyService(db database.Store, tariff *TariffService, logger *slog.Logger) *EnergyService {
 	return &EnergyService{
-		db: db,
+		db:         db,
+		tariff:     tariff,
+		logger:     logger.With("component", "energy_service"),
+		thresholds: DefaultAlertThresholds,
+		toggles:    DefaultAlertToggles,
+		quality:    make(map[string]*qualityStreak),
+		ongoing:    make(map[string]ongoingAlert),
+		severity: severityBands{
+			warning:       DefaultWarningPercent,
+			critical:      DefaultCriticalPercent,
+			escalateAfter: DefaultEscalateMinutes * time.Minute,
+		},
+
+		standbyStart:      DefaultStandbyStartHour,
+		standbyEnd:        DefaultStandbyEndHour,
+		standbyMinSamples: DefaultStandbyMinSamples,
+
+		demandWindow: DefaultDemandWindowMinutes * time.Minute,
+		demandLoc:    time.Local,
+		demand:       newDemandTracker(),
+
+		anomalyWindow: DefaultAnomalyWindow,
+		anomalyZScore: DefaultAnomalyZScore,
+
+		gapInterval:  DefaultGapInterval,
+		gapTolerance: DefaultGapTolerance,
 	}
 }
 
+// SetResponseCache lets saves and deletes invalidate cached responses
+func (s *EnergyService) SetResponseCache(cache *ResponseCache) {
+	s.cache = cache
+}
+
+// ResponseCache returns the cache set by SetResponseCache (nil = off)
+func (s *EnergyService) ResponseCache() *ResponseCache {
+	return s.cache
+}
+
+// SetSummaryCache lets GetMonthlySummary reuse computed months
+func (s *EnergyService) SetSummaryCache(cache *SummaryCache) {
+	s.summaries = cache
+}
+
+// SummaryCache returns the cache set by SetSummaryCache (nil = off)
+func (s *EnergyService) SummaryCache() *SummaryCache {
+	return s.summaries
+}
+
+// SetLatestCache lets GetLatestData answer from the newest saved reading
+func (s *EnergyService) SetLatestCache(cache *LatestCache) {
+	s.latest = cache
+}
+
+// CachedLatest returns the newest saved reading of deviceID and its age, if
+// it is fresh enough to skip IoTDB
+func (s *EnergyService) CachedLatest(deviceID string) (models.EnergyData, time.Duration, bool) {
+	return s.latest.Get(deviceID, time.Now())
+}
+
+// RecordLatest caches a reading that is not stored yet (MQTT insert
+// throttle), so /latest still shows it
+func (s *EnergyService) RecordLatest(deviceID string, data models.EnergyData) {
+	s.latest.Update(deviceID, data)
+}
+
+// invalidate drops cached responses, months and latest readings overlapping
+// [fromMs, toMs)
+func (s *EnergyService) invalidate(deviceID string, fromMs, toMs int64) {
+	s.cache.InvalidateRange(deviceID, fromMs, toMs)
+	s.summaries.InvalidateRange(deviceID, fromMs, toMs)
+	s.latest.InvalidateRange(deviceID, fromMs, toMs)
+}
+
+// SetAlertThresholds replaces DefaultAlertThresholds
+func (s *EnergyService) SetAlertThresholds(thresholds AlertThresholds) {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	s.thresholds = thresholds
+}
+
+// Thresholds returns the current alert bounds
+func (s *EnergyService) Thresholds() AlertThresholds {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.thresholds
+}
+
+// SetAlertToggles replaces DefaultAlertToggles
+func (s *EnergyService) SetAlertToggles(toggles AlertToggles) {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	s.toggles = toggles
+}
+
+// Toggles returns which alert kinds are enabled
+func (s *EnergyService) Toggles() AlertToggles {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.toggles
+}
+
+// SetDeviceSources connects the device registry and the live status map
+// (the MQTT subscriber is created after the service).
+func (s *EnergyService) SetDeviceSources(devices *DeviceService, statuses DeviceStatusProvider) {
+	s.devices = devices
+	s.statuses = statuses
+}
+
+// DeviceDiagnostics returns the link diagnostics of deviceID; false when the
+// device was not seen since startup
+func (s *EnergyService) DeviceDiagnostics(deviceID string) (*models.DeviceDiagnostics, bool) {
+	if s.statuses == nil {
+		return nil, false
+	}
+	return s.statuses.GetDeviceDiagnostics(deviceID)
+}
+
+// SetRollups lets GetHourlyRollups read precomputed hourly rollups
+func (s *EnergyService) SetRollups(job *RollupJob) {
+	s.rollups = job
+}
+
+// Money wraps a cost in the tariff's currency
+func (s *EnergyService) Money(amount float64) models.Money {
+	return s.tariff.Money(amount)
+}
+
+// Rollups returns the job set by SetRollups (nil = off)
+func (s *EnergyService) Rollups() *RollupJob {
+	return s.rollups
+}
+
+// GetHourlyRollups returns a device's hourly rollups in [startMs, endMs),
+// oldest first. Hours past the rollup high-water mark (the current hour, or a
+// job that is behind) are computed from raw readings. ok is false when no
+// rollups cover startMs, callers then aggregate raw readings themselves.
+func (s *EnergyService) GetHourlyRollups(ctx context.Context, deviceID string, startMs, endMs int64) (rollups []models.HourlyRollup, ok bool, err error) {
+	if !s.rollups.Enabled() || !s.db.IsEnabled() {
+		return nil, false, nil
+	}
+
+	coveredUntil, err := s.rollups.Coverage(ctx, deviceID)
+	if err != nil {
+		s.logger.Warn("rollup coverage unavailable, using raw data", "device_id", deviceID, "error", err)
+		return nil, false, nil
+	}
+	if coveredUntil <= startMs {
+		return nil, false, nil
+	}
+
+	split := min(coveredUntil, endMs)
+	rollups, err = s.db.GetRollups(ctx, deviceID, startMs, split)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if split < endMs {
+		readings, err := s.db.GetDataByTimeRange(ctx, deviceID, split-hourMs, endMs-1)
+		if err != nil {
+			return nil, false, err
+		}
+		rollups = append(rollups, BuildHourlyRollups(readings, split, endMs)...)
+	}
+
+	s.logger.Debug("hourly rollups read", "device_id", deviceID, "covered_until", coveredUntil, "hours", len(rollups))
+	return rollups, true, nil
+}
+
 // ===== AGGREGATION STRUCTURES =====
 type DailyAggregation struct {
 	Date     string  `json:"date"`
@@ -55,41 +317,154 @@ type MonthlyAggregation struct {
 	Daily    []DailyAggregation `json:"daily_breakdown"`
 }
 
+// HeatmapAggregation is a weekday × hour grid, indexed [time.Weekday][hour]
+// (Sunday = 0). Cells without readings stay zero.
+type HeatmapAggregation struct {
+	DeviceID  string         `json:"device_id"`
+	StartDate string         `json:"start_date"`
+	EndDate   string         `json:"end_date"`
+	Weekdays  [7]string      `json:"weekdays"`
+	AvgPower  [7][24]float64 `json:"avg_power"` // W
+	TotalKWh  [7][24]float64 `json:"total_kwh"` // over the whole range
+	Count     [7][24]int     `json:"count"`
+}
+
 // ===== FUNCTIONS =====
 
 // ✅ FIX: SaveEnergyData - ACTUALLY save ke IoTDB (bukan hanya TODO)
-func (s *EnergyService) SaveEnergyData(deviceID string, data *models.EnergyData) error {
-	log.Printf("💾 SaveEnergyData called for device: %s", deviceID)
-	log.Printf("   Data: V=%.2f | I=%.3f | P=%.2f | E=%.4f | F=%.1f | PF=%.3f",
-		data.Voltage, data.Current, data.Power, data.Energy, data.Frequency, data.PowerFactor)
-
+func (s *EnergyService) SaveEnergyData(ctx context.Context, deviceID string, data *models.EnergyData) error {
 	// Validasi data
+	if err := applyPhases(data); err != nil {
+		s.logger.Warn("rejected reading with invalid phases", "device_id", deviceID, "error", err)
+		return err
+	}
 	if data.Voltage <= 0 {
-		log.Printf("❌ Invalid voltage: %.2f (must be > 0)", data.Voltage)
+		s.logger.Warn("rejected reading with invalid voltage", "device_id", deviceID, "voltage", data.Voltage)
 		return fmt.Errorf("invalid voltage value")
 	}
 
 	if data.Timestamp == 0 {
 		data.Timestamp = time.Now().UnixMilli()
-		log.Printf("⚠️ Timestamp is 0, setting to current time: %d", data.Timestamp)
 	}
 
 	// ✅ ACTUALLY insert ke IoTDB
-	if err := s.db.InsertData(*data); err != nil {
-		log.Printf("❌ Failed to insert data to IoTDB: %v", err)
+	if err := s.db.InsertData(ctx, deviceID, *data); err != nil {
+		s.logger.Error("failed to save reading", "device_id", deviceID, "error", err)
 		return fmt.Errorf("failed to save to IoTDB: %w", err)
 	}
 
-	log.Printf("✅ Data successfully saved to IoTDB (timestamp: %d)", data.Timestamp)
+	s.invalidate(deviceID, data.Timestamp, data.Timestamp+1)
+	s.latest.Update(deviceID, *data)
+
+	s.logger.Debug("reading saved", "device_id", deviceID, "timestamp", data.Timestamp)
+	return nil
+}
+
+// ValidateReading cek nilai reading masuk akal (tanpa cek timestamp).
+// Reading 3-phase mendapat voltage/current/power dari phases-nya.
+func ValidateReading(data *models.EnergyData) error {
+	if err := applyPhases(data); err != nil {
+		return err
+	}
+	if data.Voltage <= 0 {
+		return fmt.Errorf("voltage must be > 0, got %.2f", data.Voltage)
+	}
+	if data.Current < 0 {
+		return fmt.Errorf("current must be >= 0, got %.3f", data.Current)
+	}
+	if data.Power < 0 {
+		return fmt.Errorf("power must be >= 0, got %.2f", data.Power)
+	}
+	return nil
+}
+
+// applyPhases checks the phases of a 3-phase reading and sets its totals
+// (models.SumPhases); single-phase readings are left as they are
+func applyPhases(data *models.EnergyData) error {
+	if len(data.Phases) == 0 {
+		return nil
+	}
+	if err := models.ValidatePhases(data.Phases); err != nil {
+		return err
+	}
+	data.Voltage, data.Current, data.Power = models.SumPhases(data.Phases)
 	return nil
 }
 
-// GetLatestData mendapatkan data terbaru dari device
-func (s *EnergyService) GetLatestData(deviceID string) (*models.EnergyReading, error) {
-	log.Printf("Getting latest data for device: %s", deviceID)
+// SaveEnergyBatch validasi dan simpan banyak reading sekaligus (backfill).
+// Reading tanpa timestamp ditolak, tidak di-stamp dengan waktu sekarang.
+func (s *EnergyService) SaveEnergyBatch(ctx context.Context, deviceID string, dataList []models.EnergyData) (*models.BatchInsertResult, error) {
+	start := time.Now()
+	result := &models.BatchInsertResult{Rejected: []models.RejectedRow{}}
+
+	valid := make([]models.EnergyData, 0, len(dataList))
+	for i := range dataList {
+		data := dataList[i]
+		if data.Timestamp <= 0 {
+			result.Rejected = append(result.Rejected, models.RejectedRow{Index: i, Reason: "timestamp is required"})
+			continue
+		}
+		if err := ValidateReading(&data); err != nil {
+			result.Rejected = append(result.Rejected, models.RejectedRow{Index: i, Reason: err.Error()})
+			continue
+		}
+		valid = append(valid, data)
+	}
+
+	if err := s.db.InsertBatch(ctx, deviceID, valid); err != nil {
+		s.logger.Error("failed to save batch", "device_id", deviceID, "records", len(valid), "error", err)
+		return nil, fmt.Errorf("failed to save batch to IoTDB: %w", err)
+	}
+
+	result.Inserted = len(valid)
+	result.DurationMs = time.Since(start).Milliseconds()
+
+	if len(valid) > 0 {
+		newest := valid[0]
+		from, to := valid[0].Timestamp, valid[0].Timestamp
+		for _, data := range valid {
+			from = min(from, data.Timestamp)
+			to = max(to, data.Timestamp)
+			if data.Timestamp > newest.Timestamp {
+				newest = data
+			}
+		}
+		s.invalidate(deviceID, from, to+1)
+		s.latest.Update(deviceID, newest)
+	}
+
+	s.logger.Info("batch saved",
+		"device_id", deviceID,
+		"inserted", result.Inserted,
+		"rejected", len(result.Rejected),
+		"duration_ms", result.DurationMs)
+	return result, nil
+}
+
+// DeleteData menghapus reading device dalam range waktu (ms). Range wajib
+// eksplisit, lihat database.ErrInvalidTimeRange.
+func (s *EnergyService) DeleteData(ctx context.Context, deviceID string, startTime, endTime int64) (int, error) {
+	series, err := s.db.DeleteDataByTimeRange(ctx, deviceID, startTime, endTime)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete data: %w", err)
+	}
+
+	s.invalidate(deviceID, startTime, endTime+1)
+
+	s.logger.Info("data deleted", "device_id", deviceID, "start", startTime, "end", endTime, "series", series)
+	return series, nil
+}
+
+// GetLatestData mendapatkan data terbaru dari device; dari LatestCache
+// selama masih fresh, selain itu dari IoTDB
+func (s *EnergyService) GetLatestData(ctx context.Context, deviceID string) (*models.LatestReading, error) {
+	now := time.Now()
+	if data, age, ok := s.latest.Get(deviceID, now); ok {
+		return latestReading(deviceID, data, age, "cache"), nil
+	}
 
 	// Query latest data
-	readings, err := s.db.GetLatestData(1)
+	readings, err := s.db.GetLatestData(ctx, deviceID, 1)
 	if err != nil {
 		return nil, err
 	}
@@ -99,25 +474,33 @@ func (s *EnergyService) GetLatestData(deviceID string) (*models.EnergyReading, e
 	}
 
 	latest := readings[0]
-	return &models.EnergyReading{
-		DeviceID:    deviceID,
-		Voltage:     latest.Voltage,
-		Current:     latest.Current,
-		Power:       latest.Power,
-		Energy:      latest.Energy,
-		Frequency:   latest.Frequency,
-		PowerFactor: latest.PowerFactor,
-		Timestamp:   time.UnixMilli(latest.Timestamp),
-	}, nil
+	s.latest.Update(deviceID, latest)
+	return latestReading(deviceID, latest, max(now.Sub(time.UnixMilli(latest.Timestamp)), 0), "iotdb"), nil
 }
 
-// GetHistoricalData mendapatkan data historis dengan range waktu
-func (s *EnergyService) GetHistoricalData(deviceID string, startTime, endTime int64, limit int) ([]models.EnergyReading, error) {
-	log.Printf("Getting historical data for device: %s (range: %d to %d)", deviceID, startTime, endTime)
+func latestReading(deviceID string, data models.EnergyData, age time.Duration, source string) *models.LatestReading {
+	return &models.LatestReading{
+		EnergyReading: models.EnergyReading{
+			DeviceID:    deviceID,
+			Voltage:     data.Voltage,
+			Current:     data.Current,
+			Power:       data.Power,
+			Energy:      data.Energy,
+			Frequency:   data.Frequency,
+			PowerFactor: data.PowerFactor,
+			Timestamp:   time.UnixMilli(data.Timestamp),
+			Phases:      data.Phases,
+		},
+		AgeSeconds: age.Seconds(),
+		Source:     source,
+	}
+}
 
-	readings, err := s.db.GetDataByTimeRange(startTime, endTime)
+// GetHistoricalData mendapatkan data historis dengan range waktu
+func (s *EnergyService) GetHistoricalData(ctx context.Context, deviceID string, startTime, endTime int64, limit int) ([]models.EnergyReading, error) {
+	readings, err := s.db.GetDataByTimeRange(ctx, deviceID, startTime, endTime)
 	if err != nil {
-		log.Printf("❌ Error querying historical data: %v", err)
+		s.logger.Error("historical query failed", "device_id", deviceID, "start", startTime, "end", endTime, "error", err)
 		return nil, err
 	}
 
@@ -133,143 +516,347 @@ func (s *EnergyService) GetHistoricalData(deviceID string, startTime, endTime in
 			Frequency:   r.Frequency,
 			PowerFactor: r.PowerFactor,
 			Timestamp:   time.UnixMilli(r.Timestamp),
+			Phases:      r.Phases,
+			Samples:     r.Samples,
 		})
 	}
 
-	log.Printf("✅ Retrieved %d records from historical data", len(result))
+	s.logger.Debug("historical query completed", "device_id", deviceID, "records", len(result))
 	return result, nil
 }
 
-// CalculateDailySummary menghitung summary harian
-func (s *EnergyService) CalculateDailySummary(deviceID string, date time.Time) (*models.DailySummary, error) {
-	startOfDay := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
-	endOfDay := startOfDay.Add(24 * time.Hour)
+// StreamHistoricalData passes at most limit readings of the range to fn,
+// newest first, without collecting them (GET /api/energy/history)
+func (s *EnergyService) StreamHistoricalData(ctx context.Context, deviceID string, startTime, endTime int64, limit int, fn func(models.EnergyReading) error) error {
+	err := s.db.StreamDataByTimeRange(ctx, deviceID, startTime, endTime, limit, func(r models.EnergyData) error {
+		return fn(models.EnergyReading{
+			DeviceID:    deviceID,
+			Voltage:     r.Voltage,
+			Current:     r.Current,
+			Power:       r.Power,
+			Energy:      r.Energy,
+			Frequency:   r.Frequency,
+			PowerFactor: r.PowerFactor,
+			Timestamp:   time.UnixMilli(r.Timestamp),
+			Phases:      r.Phases,
+			Samples:     r.Samples,
+		})
+	})
+	if err != nil {
+		s.logger.Error("historical stream failed", "device_id", deviceID, "start", startTime, "end", endTime, "error", err)
+	}
+	return err
+}
 
-	readings, err := s.GetHistoricalData(deviceID, startOfDay.UnixMilli(), endOfDay.UnixMilli(), 10000)
+// CalculateDailySummary menghitung summary harian.
+// TotalEnergy is the increase of the cumulative PZEM counter within the day
+// (see IntervalEnergy); a drop is treated as a counter reset. With
+// CalculateDailySummaries the increase since the previous day's last
+// reading counts too, like the daily filter.
+func (s *EnergyService) CalculateDailySummary(ctx context.Context, deviceID string, date time.Time) (*models.DailySummary, error) {
+	summaries, err := s.CalculateDailySummaries(ctx, deviceID, date, 1)
 	if err != nil {
-		log.Printf("⚠️ Error calculating daily summary: %v", err)
-		// Return empty summary instead of error
-		return &models.DailySummary{
-			DeviceID:    deviceID,
-			Date:        date.Format("2006-01-02"),
-			TotalEnergy: 0,
-			AvgPower:    0,
-			MaxPower:    0,
-			MinPower:    0,
-			TotalCost:   0,
-		}, nil
+		return nil, err
 	}
+	return summaries[0], nil
+}
 
-	if len(readings) == 0 {
-		return &models.DailySummary{
-			DeviceID:    deviceID,
-			Date:        date.Format("2006-01-02"),
-			TotalEnergy: 0,
-			AvgPower:    0,
-			MaxPower:    0,
-			MinPower:    0,
-			TotalCost:   0,
-		}, nil
+// dailyAccumulator collects one day of CalculateDailySummaries
+type dailyAccumulator struct {
+	count    int
+	sum      float64
+	min, max float64
+	energy   float64
+	previous models.EnergyData // last streamed reading of the day
+
+	first, last models.EnergyData // earliest and latest reading of the day
+}
+
+// add counts r. Store mengirim terbaru dulu, urutan terlama dulu tetap
+// ditangani.
+func (acc *dailyAccumulator) add(r models.EnergyData) {
+	switch {
+	case acc.count == 0:
+		acc.min, acc.max = r.Power, r.Power
+	case r.Timestamp < acc.previous.Timestamp:
+		acc.energy += energyDelta(r, acc.previous)
+	default:
+		acc.energy += energyDelta(acc.previous, r)
+	}
+	if acc.count == 0 || r.Timestamp < acc.first.Timestamp {
+		acc.first = r
 	}
+	if acc.count == 0 || r.Timestamp > acc.last.Timestamp {
+		acc.last = r
+	}
+	acc.previous = r
+	acc.count += r.Weight()
+	acc.sum += r.Power * float64(r.Weight())
+	acc.min = min(acc.min, r.Power)
+	acc.max = max(acc.max, r.Power)
+}
 
-	var totalEnergy, totalPower float64
-	maxPower := readings[0].Power
-	minPower := readings[0].Power
+// CalculateDailySummaries is CalculateDailySummary for days consecutive days
+// from date's day, read with one streaming query instead of one per day.
+// date's location decides the day boundaries.
+func (s *EnergyService) CalculateDailySummaries(ctx context.Context, deviceID string, date time.Time, days int) ([]*models.DailySummary, error) {
+	first := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	// starts[i] = awal hari ke-i; 23 atau 25 jam saat pergantian DST
+	starts := make([]int64, days+1)
+	for i := range starts {
+		starts[i] = first.AddDate(0, 0, i).UnixMilli()
+	}
 
-	for _, r := range readings {
-		totalEnergy += r.Energy
-		totalPower += r.Power
-		if r.Power > maxPower {
-			maxPower = r.Power
+	accs := make([]dailyAccumulator, days)
+	err := s.db.StreamDataByTimeRange(ctx, deviceID, starts[0], starts[days]-1, 0, func(r models.EnergyData) error {
+		i := sort.Search(days, func(i int) bool { return starts[i+1] > r.Timestamp })
+		if i == days || r.Timestamp < starts[0] {
+			return nil
 		}
-		if r.Power < minPower {
-			minPower = r.Power
+
+		accs[i].add(r)
+		return nil
+	})
+	if err != nil {
+		// DUMMY_MODE=off tanpa koneksi bukan kegagalan query, handler menjawab 503
+		if !errors.Is(err, database.ErrDummyDisabled) {
+			s.logger.Error("daily summary query failed", "device_id", deviceID, "days", days, "error", err)
 		}
+		return nil, err
 	}
 
-	avgPower := totalPower / float64(len(readings))
+	// Kenaikan antara reading terakhir satu hari dan reading pertama hari
+	// berikutnya dihitung di hari berikutnya, sama seperti ReadingsEnergyBy
+	var last *models.EnergyData
+	for i := range accs {
+		if accs[i].count == 0 {
+			continue
+		}
+		if last != nil {
+			accs[i].energy += energyDelta(*last, accs[i].first)
+		}
+		last = &accs[i].last
+	}
 
-	return &models.DailySummary{
-		DeviceID:    deviceID,
-		Date:        date.Format("2006-01-02"),
-		TotalEnergy: totalEnergy,
-		AvgPower:    avgPower,
-		MaxPower:    maxPower,
-		MinPower:    minPower,
-		TotalCost:   totalEnergy * 1450.0, // Rp 1450 per kWh
-	}, nil
+	summaries := make([]*models.DailySummary, days)
+	for i, acc := range accs {
+		summary := &models.DailySummary{
+			DeviceID:       deviceID,
+			Date:           first.AddDate(0, 0, i).Format("2006-01-02"),
+			TotalCostMoney: s.tariff.Money(0),
+		}
+		if acc.count > 0 {
+			summary.TotalEnergy = acc.energy
+			summary.AvgPower = acc.sum / float64(acc.count)
+			summary.MaxPower = acc.max
+			summary.MinPower = acc.min
+			summary.TotalCost = s.tariff.Cost(acc.energy)
+			summary.TotalCostMoney = s.tariff.Money(summary.TotalCost)
+		}
+		summaries[i] = summary
+	}
+	return summaries, nil
 }
 
-// CheckThresholdAlert cek apakah data melebihi threshold
+// GetMonthlySummary menjumlahkan summary harian satu bulan. month may be any
+// time in the month; its location decides the day boundaries. Results come
+// from the summary cache when set.
+func (s *EnergyService) GetMonthlySummary(ctx context.Context, deviceID string, month time.Time) (*models.MonthlySummary, error) {
+	monthStart := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, month.Location())
+	if summary, ok := s.summaries.Get(deviceID, monthStart); ok {
+		return summary, nil
+	}
+
+	summary := &models.MonthlySummary{
+		DeviceID:       deviceID,
+		Month:          monthStart.Format("2006-01"),
+		DailySummaries: []*models.DailySummary{},
+	}
+	dailies, err := s.CalculateDailySummaries(ctx, deviceID, monthStart, monthStart.AddDate(0, 1, -1).Day())
+	if err != nil {
+		return nil, err
+	}
+	for _, daily := range dailies {
+		summary.DailySummaries = append(summary.DailySummaries, daily)
+		summary.TotalEnergy += daily.TotalEnergy
+		summary.TotalCost += daily.TotalCost
+	}
+	summary.TotalCostMoney = s.tariff.Money(summary.TotalCost)
+
+	// Standby dari malam-malam bulan ini yang sudah lewat
+	standby, err := s.standbyReport(ctx, deviceID, monthStart, monthStart.AddDate(0, 1, -1), time.Now().In(monthStart.Location()))
+	if err != nil {
+		return nil, err
+	}
+	summary.StandbyPower = standby.StandbyPower
+	summary.StandbyNights = standby.NightsUsed
+	summary.StandbyEnergy = standby.StandbyPower * 24 * float64(monthStart.AddDate(0, 1, -1).Day()) / 1000
+
+	// Hanya bulan yang seluruh query-nya berhasil; error di atas tidak di-cache
+	s.summaries.Set(deviceID, monthStart, summary)
+	return summary, nil
+}
+
+// CalculatePeriodTotal menjumlahkan summary harian dari startDate sampai endDate (inklusif)
+func (s *EnergyService) CalculatePeriodTotal(ctx context.Context, deviceID string, startDate, endDate time.Time) (*models.PeriodTotal, error) {
+	total := &models.PeriodTotal{
+		StartDate: startDate.Format("2006-01-02"),
+		EndDate:   endDate.Format("2006-01-02"),
+	}
+
+	days := 0
+	for d := startDate; !d.After(endDate); d = d.AddDate(0, 0, 1) {
+		days++
+	}
+	if days == 0 {
+		total.TotalCostMoney = s.tariff.Money(0)
+		return total, nil
+	}
+
+	summaries, err := s.CalculateDailySummaries(ctx, deviceID, startDate, days)
+	if err != nil {
+		return nil, err
+	}
+	for _, summary := range summaries {
+		total.TotalEnergy += summary.TotalEnergy
+		total.TotalCost += summary.TotalCost
+	}
+	total.TotalCostMoney = s.tariff.Money(total.TotalCost)
+
+	return total, nil
+}
+
+// CalculateRangeTotal is the consumption and cost of the readings in
+// [start, end), read with one streaming query. Unlike CalculatePeriodTotal
+// the window may end mid-day; Until records where it ends.
+func (s *EnergyService) CalculateRangeTotal(ctx context.Context, deviceID string, start, end time.Time) (*models.PeriodTotal, error) {
+	var acc dailyAccumulator
+	err := s.db.StreamDataByTimeRange(ctx, deviceID, start.UnixMilli(), end.UnixMilli()-1, 0, func(r models.EnergyData) error {
+		acc.add(r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	total := &models.PeriodTotal{
+		StartDate:   start.Format("2006-01-02"),
+		EndDate:     end.Add(-time.Millisecond).Format("2006-01-02"),
+		Until:       end.Format(time.RFC3339),
+		TotalEnergy: acc.energy,
+		TotalCost:   s.tariff.Cost(acc.energy),
+	}
+	total.TotalCostMoney = s.tariff.Money(total.TotalCost)
+	return total, nil
+}
+
+// ComparePeriods membandingkan periode sekarang dengan periode sebelumnya,
+// sama panjang: daily: hari ini sampai now vs kemarin sampai jam yang sama,
+// weekly: 7 hari terakhir vs 7 hari sebelumnya, monthly: bulan ini sampai
+// now vs bulan lalu sampai tanggal dan jam yang sama (paling lambat akhir
+// bulan lalu).
+func (s *EnergyService) ComparePeriods(ctx context.Context, deviceID, period string, now time.Time) (*models.PeriodComparison, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var curStart, prevStart, prevEnd time.Time
+	switch period {
+	case "daily":
+		curStart = today
+		prevStart, prevEnd = today.AddDate(0, 0, -1), now.AddDate(0, 0, -1)
+	case "weekly":
+		curStart = today.AddDate(0, 0, -6)
+		prevStart, prevEnd = today.AddDate(0, 0, -13), now.AddDate(0, 0, -7)
+	case "monthly":
+		curStart = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		prevStart = curStart.AddDate(0, -1, 0)
+		// 31 Maret vs Februari: time.Date menggeser ke Maret, jadi dibatasi
+		prevEnd = time.Date(prevStart.Year(), prevStart.Month(), now.Day(), now.Hour(), now.Minute(), now.Second(), now.Nanosecond(), now.Location())
+		if prevEnd.After(curStart) {
+			prevEnd = curStart
+		}
+	default:
+		return nil, fmt.Errorf("invalid period %q, use: daily, weekly, or monthly", period)
+	}
+
+	current, err := s.CalculateRangeTotal(ctx, deviceID, curStart, now)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := s.CalculateRangeTotal(ctx, deviceID, prevStart, prevEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &models.PeriodComparison{
+		DeviceID:     deviceID,
+		Period:       period,
+		Current:      *current,
+		Previous:     *previous,
+		ChangeEnergy: current.TotalEnergy - previous.TotalEnergy,
+	}
+
+	// Hindari division by zero kalau periode sebelumnya belum ada data
+	if previous.TotalEnergy != 0 {
+		percent := comparison.ChangeEnergy / previous.TotalEnergy * 100
+		comparison.ChangePercent = &percent
+	}
+
+	return comparison, nil
+}
+
+// CheckThresholdAlert cek apakah data melebihi threshold power, current dan
+// voltage. Power factor dan frequency dicek oleh CheckQualityAlerts. The
+// alert's severity depends on how far the bound is exceeded and how long the
+// device has been out of bounds, see SetSeverityBands.
 func (s *EnergyService) CheckThresholdAlert(deviceID string, data *models.EnergyData) *models.AlertData {
-	const (
-		maxPower   = 2200.0
-		maxCurrent = 10.0
-		minVoltage = 200.0
-		maxVoltage = 240.0
-	)
-
-	if data.Power > maxPower {
-		return &models.AlertData{
+	if !s.Toggles().Threshold {
+		s.endAlert(deviceID)
+		return nil
+	}
+	t := s.Thresholds()
+
+	var alert *models.AlertData
+	switch {
+	case data.Power > t.MaxPower:
+		alert = &models.AlertData{
 			DeviceID:    deviceID,
 			AlertType:   "high_power",
 			Message:     fmt.Sprintf("Power exceeded: %.2fW", data.Power),
-			Threshold:   maxPower,
+			Threshold:   t.MaxPower,
 			ActualValue: data.Power,
 			Timestamp:   data.Timestamp,
 		}
-	}
-
-	if data.Current > maxCurrent {
-		return &models.AlertData{
+	case data.Current > t.MaxCurrent:
+		alert = &models.AlertData{
 			DeviceID:    deviceID,
 			AlertType:   "high_current",
 			Message:     fmt.Sprintf("Current exceeded: %.2fA", data.Current),
-			Threshold:   maxCurrent,
+			Threshold:   t.MaxCurrent,
 			ActualValue: data.Current,
 			Timestamp:   data.Timestamp,
 		}
-	}
-
-	if data.Voltage < minVoltage || data.Voltage > maxVoltage {
-		return &models.AlertData{
+	case data.Voltage < t.MinVoltage || data.Voltage > t.MaxVoltage:
+		// Threshold adalah batas yang dilanggar
+		threshold := t.MinVoltage
+		if data.Voltage > t.MaxVoltage {
+			threshold = t.MaxVoltage
+		}
+		alert = &models.AlertData{
 			DeviceID:    deviceID,
 			AlertType:   "voltage_abnormal",
 			Message:     fmt.Sprintf("Voltage abnormal: %.2fV", data.Voltage),
-			Threshold:   minVoltage,
+			Threshold:   threshold,
 			ActualValue: data.Voltage,
 			Timestamp:   data.Timestamp,
 		}
 	}
 
-	return nil
-}
-
-// GetDeviceList mendapatkan daftar device yang terdaftar
-func (s *EnergyService) GetDeviceList() ([]string, error) {
-	return []string{"ESP32_PZEM"}, nil
-}
-
-// GetRealtimeStats mendapatkan statistik real-time semua device
-func (s *EnergyService) GetRealtimeStats() (map[string]interface{}, error) {
-	latest, err := s.GetLatestData("ESP32_PZEM")
-	if err != nil {
-		return map[string]interface{}{
-			"total_devices":  1,
-			"online_devices": 0,
-			"total_power":    0,
-			"total_energy":   0,
-			"estimated_cost": 0,
-		}, nil
+	if alert == nil {
+		s.endAlert(deviceID)
+		return nil
 	}
-
-	return map[string]interface{}{
-		"total_devices":  1,
-		"online_devices": 1,
-		"total_power":    latest.Power,
-		"total_energy":   latest.Energy,
-		"estimated_cost": latest.Energy * 1450.0,
-	}, nil
+	s.gradeAlert(alert)
+	return alert
 }
 
 // ===== NEW FILTER FUNCTIONS =====
@@ -297,16 +884,14 @@ func convertTimestamp(ts interface{}) time.Time {
 }
 
 // GetDataByDateRange query data berdasarkan date range
-func (s *EnergyService) GetDataByDateRange(deviceID string, startDate, endDate time.Time) ([]models.EnergyData, error) {
+func (s *EnergyService) GetDataByDateRange(ctx context.Context, deviceID string, startDate, endDate time.Time) ([]models.EnergyData, error) {
 	startTime := startDate.UnixMilli()
 	endTime := endDate.UnixMilli()
 
-	log.Printf("Querying data for device %s from %s to %s", deviceID, startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
-
 	// Query menggunakan method baru GetDataByTimeRange
-	readings, err := s.db.GetDataByTimeRange(startTime, endTime)
+	readings, err := s.db.GetDataByTimeRange(ctx, deviceID, startTime, endTime)
 	if err != nil {
-		log.Printf("Error querying data by date range: %v", err)
+		s.logger.Error("date range query failed", "device_id", deviceID, "start", startDate, "end", endDate, "error", err)
 		return nil, err
 	}
 
@@ -315,43 +900,31 @@ func (s *EnergyService) GetDataByDateRange(deviceID string, startDate, endDate t
 
 // GetDataBySpecificDays query data untuk specific days
 // Format: "2025-01-15,2025-01-16,2025-01-17"
-func (s *EnergyService) GetDataBySpecificDays(deviceID string, daysParam string) ([]models.EnergyData, error) {
+func (s *EnergyService) GetDataBySpecificDays(ctx context.Context, deviceID string, daysParam string) ([]models.EnergyData, error) {
 	days := strings.Split(daysParam, ",")
 	var allReadings []models.EnergyData
 
-	// Get all data
-	readings, err := s.db.GetLatestData(10000)
-	if err != nil {
-		log.Printf("Error querying data: %v", err)
-		return nil, err
-	}
-
-	// Parse target dates
-	var targetDates []time.Time
+	// Query per hari, supaya hari lama ikut membaca data hourly hasil downsample
 	for _, dayStr := range days {
 		dayStr = strings.TrimSpace(dayStr)
-		date, err := time.Parse("2006-01-02", dayStr)
+		date, err := time.ParseInLocation("2006-01-02", dayStr, time.Local)
 		if err != nil {
-			log.Printf("Invalid date format: %s", dayStr)
+			s.logger.Warn("skipping invalid date", "date", dayStr)
 			continue
 		}
-		targetDates = append(targetDates, date)
-	}
 
-	// Filter readings by specific dates
-	for _, reading := range readings {
-		ts := convertTimestamp(reading.Timestamp)
-		readingDate := ts.Format("2006-01-02")
+		startTime := date.UnixMilli()
+		endTime := date.AddDate(0, 0, 1).UnixMilli() - 1
 
-		for _, targetDate := range targetDates {
-			if readingDate == targetDate.Format("2006-01-02") {
-				allReadings = append(allReadings, reading)
-				break
-			}
+		readings, err := s.db.GetDataByTimeRange(ctx, deviceID, startTime, endTime)
+		if err != nil {
+			s.logger.Error("specific days query failed", "device_id", deviceID, "date", dayStr, "error", err)
+			return nil, err
 		}
+		allReadings = append(allReadings, readings...)
 	}
 
-	log.Printf("Retrieved %d readings for %d specific days", len(allReadings), len(days))
+	s.logger.Debug("specific days query completed", "device_id", deviceID, "records", len(allReadings), "days", len(days))
 	return allReadings, nil
 }
 
@@ -492,21 +1065,68 @@ func (s *EnergyService) AggregateMonthlyData(readings []models.EnergyData) Month
 	}
 }
 
+// GetHeatmap aggregates a device's readings from startDate to endDate
+// (inclusive, server local time) into a weekday × hour grid
+func (s *EnergyService) GetHeatmap(ctx context.Context, deviceID string, startDate, endDate time.Time) (*HeatmapAggregation, error) {
+	readings, err := s.GetDataByDateRange(ctx, deviceID, startDate, endDate.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	heatmap := s.AggregateHeatmap(readings)
+	heatmap.DeviceID = deviceID
+	heatmap.StartDate = startDate.Format("2006-01-02")
+	heatmap.EndDate = endDate.Format("2006-01-02")
+	return &heatmap, nil
+}
+
+// AggregateHeatmap buckets readings by (weekday, hour)
+func (s *EnergyService) AggregateHeatmap(readings []models.EnergyData) HeatmapAggregation {
+	var heatmap HeatmapAggregation
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		heatmap.Weekdays[d] = d.String()
+	}
+
+	var sumPower [7][24]float64
+	for _, reading := range readings {
+		ts := convertTimestamp(reading.Timestamp)
+		sumPower[ts.Weekday()][ts.Hour()] += reading.Power * float64(reading.Weight())
+		heatmap.Count[ts.Weekday()][ts.Hour()] += reading.Weight()
+	}
+
+	for hour, kwh := range HourlyEnergy(readings) {
+		ts := time.UnixMilli(hour)
+		heatmap.TotalKWh[ts.Weekday()][ts.Hour()] += kwh
+	}
+
+	for d := range sumPower {
+		for h := range sumPower[d] {
+			if n := heatmap.Count[d][h]; n > 0 {
+				heatmap.AvgPower[d][h] = sumPower[d][h] / float64(n)
+			}
+		}
+	}
+	return heatmap
+}
+
 // ===== HELPER FUNCTIONS =====
 
+// calculateDailyStats and calculateHourlyStats expect readings of one bucket;
+// TotalKWh is delta-based like CalculateDailySummary.
 func (s *EnergyService) calculateDailyStats(readings []models.EnergyData, date string) DailyAggregation {
 	if len(readings) == 0 {
 		return DailyAggregation{Date: date}
 	}
 
-	totalKwh := float64(0)
+	totalKwh := IntervalEnergy(readings)
 	totalPower := float64(0)
+	count := 0
 	maxPower := readings[0].Power
 	minPower := readings[0].Power
 
 	for _, r := range readings {
-		totalKwh += r.Energy
-		totalPower += r.Power
+		totalPower += r.Power * float64(r.Weight())
+		count += r.Weight()
 		if r.Power > maxPower {
 			maxPower = r.Power
 		}
@@ -518,10 +1138,10 @@ func (s *EnergyService) calculateDailyStats(readings []models.EnergyData, date s
 	return DailyAggregation{
 		Date:     date,
 		TotalKWh: totalKwh,
-		AvgPower: totalPower / float64(len(readings)),
+		AvgPower: totalPower / float64(count),
 		MaxPower: maxPower,
 		MinPower: minPower,
-		Count:    len(readings),
+		Count:    count,
 	}
 }
 
@@ -530,14 +1150,15 @@ func (s *EnergyService) calculateHourlyStats(readings []models.EnergyData, hour
 		return HourlyAggregation{Hour: hour}
 	}
 
-	totalKwh := float64(0)
+	totalKwh := IntervalEnergy(readings)
 	totalPower := float64(0)
+	count := 0
 	maxPower := readings[0].Power
 	minPower := readings[0].Power
 
 	for _, r := range readings {
-		totalKwh += r.Energy
-		totalPower += r.Power
+		totalPower += r.Power * float64(r.Weight())
+		count += r.Weight()
 		if r.Power > maxPower {
 			maxPower = r.Power
 		}
@@ -549,9 +1170,9 @@ func (s *EnergyService) calculateHourlyStats(readings []models.EnergyData, hour
 	return HourlyAggregation{
 		Hour:     hour,
 		TotalKWh: totalKwh,
-		AvgPower: totalPower / float64(len(readings)),
+		AvgPower: totalPower / float64(count),
 		MaxPower: maxPower,
 		MinPower: minPower,
-		Count:    len(readings),
+		Count:    count,
 	}
 }
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+	"wattwise/internal/database"
+	"wattwise/internal/models"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// testLocation is the zone of the day boundaries under test
+var testLocation = time.FixedZone("WIB", 7*3600)
+
+// flakyStore is a MemoryStore whose range reads fail with err while it is set
+type flakyStore struct {
+	*database.MemoryStore
+	err error
+}
+
+func (s *flakyStore) StreamDataByTimeRange(ctx context.Context, deviceID string, startTime, endTime int64, limit int, fn func(models.EnergyData) error) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.MemoryStore.StreamDataByTimeRange(ctx, deviceID, startTime, endTime, limit, fn)
+}
+
+func (s *flakyStore) GetDataByTimeRange(ctx context.Context, deviceID string, startTime, endTime int64) ([]models.EnergyData, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.MemoryStore.GetDataByTimeRange(ctx, deviceID, startTime, endTime)
+}
+
+// newTestService is an EnergyService over store with the default tariff
+func newTestService(store database.Store) *EnergyService {
+	return NewEnergyService(store, NewTariffService(1444.70), discardLogger())
+}
+
+// seed stores readings for deviceID
+func seed(t testing.TB, store database.Store, deviceID string, readings ...models.EnergyData) {
+	t.Helper()
+	if err := store.InsertBatch(context.Background(), deviceID, readings); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// reading is a reading at t with power watts and the energy counter at kwh
+func reading(t time.Time, power, kwh float64) models.EnergyData {
+	return models.EnergyData{
+		Timestamp:   t.UnixMilli(),
+		Voltage:     220,
+		Current:     power / 220,
+		Power:       power,
+		Energy:      kwh,
+		Frequency:   50,
+		PowerFactor: 1,
+	}
+}
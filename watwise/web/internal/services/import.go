@@ -0,0 +1,285 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"wattwise/internal/models"
+)
+
+const importBatchSize = 1000
+
+// ImportFormats are the file formats accepted by Import
+var ImportFormats = []string{"csv", "ndjson"}
+
+// importFields are the columns Import understands after mapping
+var importFields = map[string]bool{
+	"timestamp": true, "voltage": true, "current": true, "power": true,
+	"energy": true, "frequency": true, "power_factor": true,
+}
+
+var importTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006/01/02 15:04:05",
+	"02/01/2006 15:04:05", // format Indonesia, hari dulu
+	"02-01-2006 15:04:05",
+}
+
+// ErrInvalidImport is returned for problems with the file as a whole (bad
+// header, unknown format, bad mapping); row problems end up in the result
+var ErrInvalidImport = errors.New("invalid import")
+
+// Import reads a CSV (with header row) or NDJSON file row by row and writes
+// valid readings in batches through SaveEnergyBatch. mapping renames source
+// columns, e.g. {"volt": "voltage", "ts": "timestamp"}; columns that already
+// use the field names (or "pf") need no mapping, others are ignored.
+func (s *EnergyService) Import(ctx context.Context, deviceID, format string, r io.Reader, mapping map[string]string) (*models.ImportResult, error) {
+	start := time.Now()
+	result := &models.ImportResult{Errors: []models.RejectedRow{}}
+
+	columns, err := importColumns(mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		batch []models.EnergyData
+		lines []int // line number of each batch entry
+	)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		saved, err := s.SaveEnergyBatch(ctx, deviceID, batch)
+		if err != nil {
+			return err
+		}
+		result.Imported += saved.Inserted
+		for _, rejected := range saved.Rejected {
+			result.AddError(lines[rejected.Index], rejected.Reason)
+		}
+		batch, lines = batch[:0], lines[:0]
+		return nil
+	}
+
+	row := func(line int, values map[string]string) error {
+		if isBlankRow(values) {
+			result.Skipped++
+			return nil
+		}
+
+		data, err := parseImportRow(values)
+		if err != nil {
+			result.AddError(line, err.Error())
+			return nil
+		}
+		if err := ValidateReading(&data); err != nil {
+			result.AddError(line, err.Error())
+			return nil
+		}
+
+		batch = append(batch, data)
+		lines = append(lines, line)
+		if len(batch) == importBatchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	switch format {
+	case "csv":
+		err = readCSV(r, columns, row)
+	case "ndjson":
+		err = readNDJSON(r, columns, row)
+	default:
+		err = fmt.Errorf("%w: unknown format %q, use: %s", ErrInvalidImport, format, strings.Join(ImportFormats, ", "))
+	}
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		s.logger.Warn("import stopped", "device_id", deviceID, "imported", result.Imported, "error", err)
+		return result, err
+	}
+
+	result.DurationMs = time.Since(start).Milliseconds()
+	s.logger.Info("import completed",
+		"device_id", deviceID,
+		"format", format,
+		"imported", result.Imported,
+		"skipped", result.Skipped,
+		"errored", result.Errored,
+		"duration_ms", result.DurationMs)
+	return result, nil
+}
+
+// importColumns returns source column (lower case) -> field
+func importColumns(mapping map[string]string) (map[string]string, error) {
+	columns := map[string]string{"pf": "power_factor"}
+	for field := range importFields {
+		columns[field] = field
+	}
+	for source, field := range mapping {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !importFields[field] {
+			return nil, fmt.Errorf("%w: mapping %q -> %q, target must be one of timestamp, voltage, current, power, energy, frequency, power_factor",
+				ErrInvalidImport, source, field)
+		}
+		columns[strings.ToLower(strings.TrimSpace(source))] = field
+	}
+	return columns, nil
+}
+
+func readCSV(r io.Reader, columns map[string]string, row func(int, map[string]string) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return fmt.Errorf("%w: file is empty", ErrInvalidImport)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: header: %v", ErrInvalidImport, err)
+	}
+
+	fields := make([]string, len(header))
+	hasTimestamp := false
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\uFEFF")))
+		fields[i] = columns[name]
+		hasTimestamp = hasTimestamp || fields[i] == "timestamp"
+	}
+	if !hasTimestamp {
+		return fmt.Errorf("%w: no timestamp column in header %v (map it with the mapping field)", ErrInvalidImport, header)
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		values := make(map[string]string, len(fields))
+		if err == nil {
+			line, _ = reader.FieldPos(0) // baris kosong dilewati csv.Reader
+			for i, value := range record {
+				if i < len(fields) && fields[i] != "" {
+					values[fields[i]] = strings.TrimSpace(value)
+				}
+			}
+		} else if !errors.Is(err, csv.ErrFieldCount) {
+			values["_error"] = err.Error()
+		}
+
+		if err := row(line, values); err != nil {
+			return err
+		}
+	}
+}
+
+func readNDJSON(r io.Reader, columns map[string]string, row func(int, map[string]string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		values := make(map[string]string)
+
+		text := strings.TrimSpace(scanner.Text())
+		if text != "" {
+			var object map[string]interface{}
+			if err := json.Unmarshal([]byte(text), &object); err != nil {
+				values["_error"] = "invalid JSON: " + err.Error()
+			}
+			for key, value := range object {
+				if field := columns[strings.ToLower(key)]; field != "" && value != nil {
+					values[field] = fmt.Sprint(value)
+				}
+			}
+			if len(values) == 0 {
+				values["_error"] = "no known fields in object"
+			}
+		}
+
+		if err := row(line, values); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	return nil
+}
+
+func isBlankRow(values map[string]string) bool {
+	for _, v := range values {
+		if v != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func parseImportRow(values map[string]string) (models.EnergyData, error) {
+	var data models.EnergyData
+	if msg, ok := values["_error"]; ok {
+		return data, errors.New(msg)
+	}
+
+	ts, err := parseImportTime(values["timestamp"])
+	if err != nil {
+		return data, err
+	}
+	data.Timestamp = ts
+
+	targets := map[string]*float64{
+		"voltage": &data.Voltage, "current": &data.Current, "power": &data.Power,
+		"energy": &data.Energy, "frequency": &data.Frequency, "power_factor": &data.PowerFactor,
+	}
+	for field, target := range targets {
+		value := values[field]
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64)
+		if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+			return data, fmt.Errorf("invalid %s %q", field, value)
+		}
+		*target = parsed
+	}
+	return data, nil
+}
+
+// parseImportTime accepts Unix seconds or milliseconds, and the layouts in
+// importTimeLayouts (local time when no zone is given)
+func parseImportTime(value string) (int64, error) {
+	if value == "" {
+		return 0, errors.New("timestamp is required")
+	}
+
+	if n, err := strconv.ParseFloat(value, 64); err == nil {
+		if n > 1e12 {
+			return int64(n), nil // sudah millisecond
+		}
+		return int64(n * 1000), nil
+	}
+
+	for _, layout := range importTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t.UnixMilli(), nil
+		}
+	}
+	return 0, fmt.Errorf("unrecognised timestamp %q", value)
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"wattwise/internal/models"
+)
+
+// InfluxMeasurement is the only measurement IngestLineProtocol accepts
+const InfluxMeasurement = "energy"
+
+// InfluxPrecisions are the timestamp units of ?precision=, like the InfluxDB
+// v1 write API. Default ns.
+var InfluxPrecisions = []string{"ns", "us", "ms", "s"}
+
+// ErrInvalidLineProtocol is returned for problems with the request as a whole
+// (bad precision, unreadable body); line problems end up in the result
+var ErrInvalidLineProtocol = errors.New("invalid line protocol")
+
+// influxFields maps line protocol field keys to reading fields. Other fields
+// (Telegraf may add its own) are ignored.
+var influxFields = map[string]func(*models.EnergyData) *float64{
+	"voltage":      func(d *models.EnergyData) *float64 { return &d.Voltage },
+	"current":      func(d *models.EnergyData) *float64 { return &d.Current },
+	"power":        func(d *models.EnergyData) *float64 { return &d.Power },
+	"energy":       func(d *models.EnergyData) *float64 { return &d.Energy },
+	"frequency":    func(d *models.EnergyData) *float64 { return &d.Frequency },
+	"power_factor": func(d *models.EnergyData) *float64 { return &d.PowerFactor },
+}
+
+// influxBooleans are the boolean field values of line protocol
+var influxBooleans = map[string]bool{
+	"t": true, "T": true, "true": true, "True": true, "TRUE": true,
+	"f": true, "F": true, "false": true, "False": true, "FALSE": true,
+}
+
+// influxPoint is one parsed line
+type influxPoint struct {
+	deviceID string
+	data     models.EnergyData
+}
+
+// IngestLineProtocol parses InfluxDB line protocol (Telegraf's influxdb
+// output) and saves the points per device through SaveEnergyBatch:
+//
+//	energy,device_id=ESP32_001 voltage=220.5,current=2.1,power=463i 1736900000000000000
+//
+// The device comes from the device_id tag, else defaultDevice. Lines without
+// a timestamp get the time of the request. Invalid lines are counted in the
+// result with their line number, the valid ones are saved anyway (partial
+// write, like InfluxDB).
+func (s *EnergyService) IngestLineProtocol(ctx context.Context, r io.Reader, precision, defaultDevice string) (*models.ImportResult, error) {
+	start := time.Now()
+	result := &models.ImportResult{Errors: []models.RejectedRow{}}
+
+	toMillis, err := influxPrecision(precision)
+	if err != nil {
+		return result, err
+	}
+
+	batches := make(map[string][]models.EnergyData)
+	lines := make(map[string][]int)
+	var devices []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			result.Skipped++
+			continue
+		}
+
+		point, err := parseInfluxLine(text, toMillis, start)
+		if err == nil && point.deviceID == "" {
+			point.deviceID = defaultDevice
+			if point.deviceID == "" {
+				err = errors.New("device_id tag is required")
+			}
+		}
+		if err != nil {
+			result.AddError(line, err.Error())
+			continue
+		}
+
+		if _, ok := batches[point.deviceID]; !ok {
+			devices = append(devices, point.deviceID)
+		}
+		batches[point.deviceID] = append(batches[point.deviceID], point.data)
+		lines[point.deviceID] = append(lines[point.deviceID], line)
+	}
+	if err := scanner.Err(); err != nil {
+		return result, fmt.Errorf("%w: %v", ErrInvalidLineProtocol, err)
+	}
+
+	for _, deviceID := range devices {
+		saved, err := s.SaveEnergyBatch(ctx, deviceID, batches[deviceID])
+		if err != nil {
+			s.logger.Warn("line protocol write stopped", "device_id", deviceID, "written", result.Imported, "error", err)
+			return result, err
+		}
+		for _, rejected := range saved.Rejected {
+			result.AddError(lines[deviceID][rejected.Index], rejected.Reason)
+		}
+		result.Imported += saved.Inserted
+	}
+
+	result.DurationMs = time.Since(start).Milliseconds()
+	s.logger.Info("line protocol written",
+		"devices", len(devices),
+		"written", result.Imported,
+		"errored", result.Errored,
+		"duration_ms", result.DurationMs)
+	return result, nil
+}
+
+// influxPrecision returns the conversion of a timestamp in precision to Unix ms
+func influxPrecision(precision string) (func(int64) int64, error) {
+	switch precision {
+	case "", "ns", "n":
+		return func(ts int64) int64 { return ts / int64(time.Millisecond) }, nil
+	case "us", "u":
+		return func(ts int64) int64 { return ts / 1000 }, nil
+	case "ms":
+		return func(ts int64) int64 { return ts }, nil
+	case "s":
+		return func(ts int64) int64 { return ts * 1000 }, nil
+	}
+	return nil, fmt.Errorf("%w: unknown precision %q, use: %s", ErrInvalidLineProtocol, precision, strings.Join(InfluxPrecisions, ", "))
+}
+
+// parseInfluxLine parses "measurement[,tag=value...] field=value[,...] [timestamp]"
+func parseInfluxLine(text string, toMillis func(int64) int64, now time.Time) (influxPoint, error) {
+	var point influxPoint
+
+	key, rest := cutUnescaped(text, ' ', false)
+	fields, timestamp := cutUnescaped(strings.TrimLeft(rest, " "), ' ', true)
+	timestamp = strings.TrimSpace(timestamp)
+	if fields == "" {
+		return point, errors.New("missing fields")
+	}
+
+	parts := splitUnescaped(key, ',', false)
+	if measurement := unescapeInflux(parts[0]); measurement != InfluxMeasurement {
+		return point, fmt.Errorf("unsupported measurement %q, use %q", measurement, InfluxMeasurement)
+	}
+	for _, tag := range parts[1:] {
+		name, value := cutUnescaped(tag, '=', false)
+		if name == "" || value == "" {
+			return point, fmt.Errorf("invalid tag %q", tag)
+		}
+		if unescapeInflux(name) == "device_id" {
+			point.deviceID = unescapeInflux(value)
+		}
+	}
+
+	known := 0
+	for _, field := range splitUnescaped(fields, ',', true) {
+		name, value := cutUnescaped(field, '=', false)
+		name = unescapeInflux(name)
+		if name == "" || value == "" {
+			return point, fmt.Errorf("invalid field %q", field)
+		}
+		target, ok := influxFields[name]
+		if !ok {
+			continue
+		}
+		parsed, err := parseInfluxNumber(value)
+		if err != nil {
+			return point, fmt.Errorf("field %s: %v", name, err)
+		}
+		*target(&point.data) = parsed
+		known++
+	}
+	if known == 0 {
+		return point, errors.New("no known fields (voltage, current, power, energy, frequency, power_factor)")
+	}
+
+	if timestamp == "" {
+		point.data.Timestamp = now.UnixMilli()
+		return point, nil
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return point, fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	point.data.Timestamp = toMillis(ts)
+	return point, nil
+}
+
+// parseInfluxNumber parses a float, integer (5i) or unsigned (5u) field value.
+// Strings and booleans are rejected, the reading fields are numeric.
+func parseInfluxNumber(value string) (float64, error) {
+	var parsed float64
+	var err error
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return 0, errors.New("must be numeric, got a string")
+	case strings.HasSuffix(value, "i"):
+		var n int64
+		n, err = strconv.ParseInt(strings.TrimSuffix(value, "i"), 10, 64)
+		parsed = float64(n)
+	case strings.HasSuffix(value, "u"):
+		var n uint64
+		n, err = strconv.ParseUint(strings.TrimSuffix(value, "u"), 10, 64)
+		parsed = float64(n)
+	default:
+		parsed, err = strconv.ParseFloat(value, 64)
+		if err != nil && influxBooleans[value] {
+			return 0, errors.New("must be numeric, got a boolean")
+		}
+	}
+	if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+	return parsed, nil
+}
+
+// cutUnescaped splits s around the first sep not escaped with a backslash
+// (nor inside a double-quoted string when quotes is set)
+func cutUnescaped(s string, sep byte, quotes bool) (before, after string) {
+	if i := indexUnescaped(s, sep, quotes); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// splitUnescaped splits s around every sep, see cutUnescaped
+func splitUnescaped(s string, sep byte, quotes bool) []string {
+	var parts []string
+	for {
+		i := indexUnescaped(s, sep, quotes)
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+}
+
+func indexUnescaped(s string, sep byte, quotes bool) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++ // karakter berikutnya di-escape
+		case quotes && s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			return i
+		}
+	}
+	return -1
+}
+
+// unescapeInflux removes the backslashes of escaped commas, spaces and
+// equals signs in measurement names, tags and field keys
+func unescapeInflux(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	return strings.NewReplacer(`\,`, ",", `\ `, " ", `\=`, "=", `\\`, `\`).Replace(s)
+}
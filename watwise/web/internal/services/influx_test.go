@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"wattwise/internal/database"
+	"wattwise/internal/models"
+)
+
+func TestParseInfluxLine(t *testing.T) {
+	now := time.Date(2025, 1, 15, 8, 0, 0, 0, time.UTC)
+	const ms = int64(1736900000000)
+
+	tests := []struct {
+		name      string
+		line      string
+		precision string
+		device    string
+		data      models.EnergyData
+	}{
+		{"all fields", `energy,device_id=ESP32_001 voltage=220.5,current=2.1,power=463i,energy=1.5,frequency=50u,power_factor=0.95 1736900000000000000`, "ns", "ESP32_001",
+			models.EnergyData{Timestamp: ms, Voltage: 220.5, Current: 2.1, Power: 463, Energy: 1.5, Frequency: 50, PowerFactor: 0.95}},
+		{"unknown fields and tags ignored", `energy,host=pi,device_id=A,site=home power=100,temp=21.5 1736900000000000000`, "", "A",
+			models.EnergyData{Timestamp: ms, Power: 100}},
+		{"escaped tag value", `energy,device_id=ESP\ 32\,01 power=1 1736900000000000000`, "ns", "ESP 32,01",
+			models.EnergyData{Timestamp: ms, Power: 1}},
+		{"escaped equals and backslash", `energy,device_id=a\=b\\c power=1 1736900000000000000`, "ns", `a=b\c`,
+			models.EnergyData{Timestamp: ms, Power: 1}},
+		{"escaped field key", `energy,device_id=A power\ factor=0.5,power=2 1736900000000000000`, "ns", "A",
+			models.EnergyData{Timestamp: ms, Power: 2}},
+		{"quoted string field with separators", `energy,device_id=A note="on, off=x y",power=3 1736900000000000000`, "ns", "A",
+			models.EnergyData{Timestamp: ms, Power: 3}},
+		{"no device tag", `energy power=4 1736900000000000000`, "ns", "",
+			models.EnergyData{Timestamp: ms, Power: 4}},
+		{"precision n", `energy power=1 1736900000000000000`, "n", "", models.EnergyData{Timestamp: ms, Power: 1}},
+		{"precision us", `energy power=1 1736900000000000`, "us", "", models.EnergyData{Timestamp: ms, Power: 1}},
+		{"precision u", `energy power=1 1736900000000000`, "u", "", models.EnergyData{Timestamp: ms, Power: 1}},
+		{"precision ms", `energy power=1 1736900000000`, "ms", "", models.EnergyData{Timestamp: ms, Power: 1}},
+		{"precision s", `energy power=1 1736900000`, "s", "", models.EnergyData{Timestamp: ms, Power: 1}},
+		{"sub-millisecond truncated", `energy power=1 1736900000000999999`, "ns", "", models.EnergyData{Timestamp: ms, Power: 1}},
+		{"no timestamp", `energy,device_id=A power=5`, "ns", "A", models.EnergyData{Timestamp: now.UnixMilli(), Power: 5}},
+		{"negative and exponent", `energy power=-1.5e2,current=2E-1`, "ns", "", models.EnergyData{Timestamp: now.UnixMilli(), Power: -150, Current: 0.2}},
+	}
+	for _, tt := range tests {
+		toMillis, err := influxPrecision(tt.precision)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		point, err := parseInfluxLine(tt.line, toMillis, now)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if point.deviceID != tt.device {
+			t.Errorf("%s: device = %q, want %q", tt.name, point.deviceID, tt.device)
+		}
+		if point.data.Timestamp != tt.data.Timestamp || point.data.Voltage != tt.data.Voltage || point.data.Current != tt.data.Current ||
+			point.data.Power != tt.data.Power || point.data.Energy != tt.data.Energy || point.data.Frequency != tt.data.Frequency ||
+			point.data.PowerFactor != tt.data.PowerFactor {
+			t.Errorf("%s: data = %+v, want %+v", tt.name, point.data, tt.data)
+		}
+	}
+}
+
+func TestParseInfluxLineMalformed(t *testing.T) {
+	toMillis, _ := influxPrecision("ns")
+	tests := []struct {
+		line string
+		err  string
+	}{
+		{`energy,device_id=A`, "missing fields"},
+		{`energy,device_id=A `, "missing fields"},
+		{`power,device_id=A power=1`, "unsupported measurement"},
+		{`energy,device_id power=1`, "invalid tag"},
+		{`energy,device_id= power=1`, "invalid tag"},
+		{`energy power`, "invalid field"},
+		{`energy power=`, "invalid field"},
+		{`energy =1`, "invalid field"},
+		{`energy power="100"`, "got a string"},
+		{`energy power=true`, "got a boolean"},
+		{`energy power=t`, "got a boolean"},
+		{`energy power=1.2.3`, "invalid number"},
+		{`energy power=NaN`, "invalid number"},
+		{`energy power=+Inf`, "invalid number"},
+		{`energy power=-1u`, "invalid number"},
+		{`energy power=1.5i`, "invalid number"},
+		{`energy temp=20`, "no known fields"},
+		{`energy power=1 soon`, "invalid timestamp"},
+		{`energy power=1 1.5`, "invalid timestamp"},
+	}
+	for _, tt := range tests {
+		_, err := parseInfluxLine(tt.line, toMillis, time.Now())
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: err = %v, want %q", tt.line, err, tt.err)
+		}
+	}
+
+	if _, err := influxPrecision("h"); !errors.Is(err, ErrInvalidLineProtocol) {
+		t.Errorf("precision h: err = %v, want ErrInvalidLineProtocol", err)
+	}
+}
+
+func TestIngestLineProtocolPartialWrite(t *testing.T) {
+	store := database.NewMemoryStore()
+	service := newTestService(store)
+
+	body := strings.Join([]string{
+		`# telegraf`,
+		`energy,device_id=A voltage=220,power=100,energy=1.0 1736900000`,
+		``,
+		`energy voltage=220,power=200,energy=2.0 1736900060`,
+		`energy,device_id=A power=oops 1736900120`,
+		`energy,device_id=B voltage=220,power=300,energy=3.0 1736900180`,
+		`cpu,host=pi usage=5 1736900240`,
+	}, "\n")
+	result, err := service.IngestLineProtocol(context.Background(), strings.NewReader(body), "s", "DEFAULT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 3 || result.Skipped != 2 || result.Errored != 2 {
+		t.Errorf("imported/skipped/errored = %d/%d/%d, want 3/2/2", result.Imported, result.Skipped, result.Errored)
+	}
+	if len(result.Errors) != 2 || result.Errors[0].Index != 5 || result.Errors[1].Index != 7 {
+		t.Errorf("errors = %+v, want lines 5 and 7", result.Errors)
+	}
+
+	for device, want := range map[string]float64{"A": 100, "DEFAULT": 200, "B": 300} {
+		latest, err := store.GetLatestData(context.Background(), device, 1)
+		if err != nil || len(latest) != 1 || latest[0].Power != want {
+			t.Errorf("%s: latest = %+v (%v), want power %v", device, latest, err, want)
+		}
+	}
+
+	// Tanpa device_id tag dan tanpa default, baris ditolak
+	result, err = service.IngestLineProtocol(context.Background(), strings.NewReader(`energy power=1`), "ns", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Imported != 0 || len(result.Errors) != 1 || !strings.Contains(result.Errors[0].Reason, "device_id") {
+		t.Errorf("result = %+v, want the line rejected for its device_id", result)
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"sync"
+	"time"
+	"wattwise/internal/models"
+)
+
+// LatestCache keeps the newest reading of every device as it is saved, so
+// GET /api/energy/latest does not query IoTDB on every dashboard poll. A
+// reading older than maxAge is stale and the caller falls back to IoTDB.
+type LatestCache struct {
+	maxAge time.Duration
+
+	mu       sync.RWMutex
+	readings map[string]models.EnergyData
+}
+
+// NewLatestCache returns a cache, or nil (caching off) when maxAge <= 0
+func NewLatestCache(maxAge time.Duration) *LatestCache {
+	if maxAge <= 0 {
+		return nil
+	}
+	return &LatestCache{maxAge: maxAge, readings: make(map[string]models.EnergyData)}
+}
+
+// Update stores data unless a newer reading of the device is cached already
+// (backfills do not replace the live value). Safe on a nil cache.
+func (c *LatestCache) Update(deviceID string, data models.EnergyData) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.readings[deviceID]; ok && cached.Timestamp > data.Timestamp {
+		return
+	}
+	c.readings[deviceID] = data
+}
+
+// Get returns the cached reading and its age at now, if it is fresh
+func (c *LatestCache) Get(deviceID string, now time.Time) (models.EnergyData, time.Duration, bool) {
+	if c == nil {
+		return models.EnergyData{}, 0, false
+	}
+
+	c.mu.RLock()
+	data, ok := c.readings[deviceID]
+	c.mu.RUnlock()
+	if !ok {
+		return data, 0, false
+	}
+
+	age := now.Sub(time.UnixMilli(data.Timestamp))
+	if age > c.maxAge {
+		return data, age, false
+	}
+	return data, max(age, 0), true
+}
+
+// InvalidateRange drops the cached reading when it falls in [fromMs, toMs)
+func (c *LatestCache) InvalidateRange(deviceID string, fromMs, toMs int64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if data, ok := c.readings[deviceID]; ok && data.Timestamp >= fromMs && data.Timestamp < toMs {
+		delete(c.readings, deviceID)
+	}
+}
+
+// Forget drops everything cached for deviceID
+func (c *LatestCache) Forget(deviceID string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.readings, deviceID)
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+	"wattwise/internal/database"
+	"wattwise/internal/models"
+)
+
+// Jalankan dengan -race: update, read dan invalidate dari banyak goroutine
+func TestLatestCacheConcurrent(t *testing.T) {
+	const (
+		devices = 4
+		writers = 4
+		updates = 500
+	)
+	cache := NewLatestCache(time.Hour)
+	base := time.Now().UnixMilli()
+
+	var wg sync.WaitGroup
+	for d := 0; d < devices; d++ {
+		deviceID := fmt.Sprintf("D%d", d)
+		// Writer menulis timestamp yang saling menyela, tidak berurutan
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < updates; i++ {
+					ts := base + int64(i*writers+w)
+					cache.Update(deviceID, models.EnergyData{Timestamp: ts, Power: float64(ts - base)})
+				}
+			}()
+		}
+
+		// Reader tidak boleh melihat reading yang lebih lama dari yang
+		// sudah pernah dilihatnya
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			seen := int64(0)
+			for i := 0; i < updates*writers; i++ {
+				data, age, ok := cache.Get(deviceID, time.UnixMilli(base+int64(updates*writers)))
+				if !ok {
+					continue
+				}
+				if data.Timestamp < seen {
+					t.Errorf("%s: read %d after %d", deviceID, data.Timestamp, seen)
+					return
+				}
+				if data.Power != float64(data.Timestamp-base) || age < 0 {
+					t.Errorf("%s: inconsistent reading %+v, age %v", deviceID, data, age)
+					return
+				}
+				seen = data.Timestamp
+			}
+		}()
+	}
+
+	// Device lain di-invalidate dan dilupakan sambil ditulis
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < updates; i++ {
+			cache.Update("X", models.EnergyData{Timestamp: base + int64(i)})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < updates; i++ {
+			cache.InvalidateRange("X", base, base+int64(i))
+			if i%10 == 0 {
+				cache.Forget("X")
+			}
+			cache.Get("X", time.UnixMilli(base))
+		}
+	}()
+	wg.Wait()
+
+	// Hasil akhir selalu reading terbaru, apa pun urutan writer-nya
+	want := base + int64(updates*writers-1)
+	for d := 0; d < devices; d++ {
+		deviceID := fmt.Sprintf("D%d", d)
+		data, _, ok := cache.Get(deviceID, time.UnixMilli(want))
+		if !ok || data.Timestamp != want {
+			t.Errorf("%s: cached %d (%v), want %d", deviceID, data.Timestamp, ok, want)
+		}
+	}
+}
+
+func TestLatestDataConcurrentSaveAndRead(t *testing.T) {
+	store := database.NewMemoryStore()
+	service := newTestService(store)
+	service.SetLatestCache(NewLatestCache(30 * time.Second))
+	base := time.Now().Add(-time.Second).UnixMilli()
+	seed(t, store, "A", models.EnergyData{Timestamp: base, Voltage: 220, Power: 0})
+
+	const saves = 300
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= saves; i++ {
+			data := models.EnergyData{Timestamp: base + int64(i), Voltage: 220, Power: float64(i)}
+			if err := service.SaveEnergyData(context.Background(), "A", &data); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	// Reader kadang kena cache miss (Forget) dan mengisi cache dari store
+	// bersamaan dengan SaveEnergyData
+	go func() {
+		defer wg.Done()
+		for i := 0; i < saves; i++ {
+			if i%7 == 0 {
+				service.latest.Forget("A")
+			}
+			latest, err := service.GetLatestData(context.Background(), "A")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if latest.Power != float64(latest.Timestamp.UnixMilli()-base) {
+				t.Errorf("power %v does not belong to the reading at %d", latest.Power, latest.Timestamp.UnixMilli())
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	latest, err := service.GetLatestData(context.Background(), "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Power != saves || latest.Source != "cache" {
+		t.Errorf("latest = power %v from %s, want %d from cache", latest.Power, latest.Source, saves)
+	}
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"wattwise/internal/models"
+)
+
+// NotificationChannel delivers a notification somewhere (email, webhook).
+// Send must give up when ctx is done.
+type NotificationChannel interface {
+	Name() string
+	Send(ctx context.Context, n models.Notification) error
+}
+
+// SMTPSettings is the mail server and the recipients of EmailChannel
+type SMTPSettings struct {
+	Host     string
+	Port     int    // 465 = implicit TLS, otherwise STARTTLS when the server offers it
+	Username string // empty = no AUTH
+	Password string
+	From     string
+	To       []string
+}
+
+// EmailChannel sends notifications as plain text mail
+type EmailChannel struct {
+	smtp SMTPSettings
+}
+
+func NewEmailChannel(settings SMTPSettings) *EmailChannel {
+	return &EmailChannel{smtp: settings}
+}
+
+func (e *EmailChannel) Name() string { return "email" }
+
+func (e *EmailChannel) Send(ctx context.Context, n models.Notification) error {
+	addr := net.JoinHostPort(e.smtp.Host, strconv.Itoa(e.smtp.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("smtp connect %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	tlsConfig := &tls.Config{ServerName: e.smtp.Host}
+	if e.smtp.Port == 465 {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, e.smtp.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && e.smtp.Port != 465 {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+	if e.smtp.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.smtp.Username, e.smtp.Password, e.smtp.Host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := client.Mail(e.smtp.From); err != nil {
+		return fmt.Errorf("smtp MAIL FROM: %w", err)
+	}
+	for _, to := range e.smtp.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if _, err := w.Write(e.message(n)); err != nil {
+		w.Close()
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	return client.Quit()
+}
+
+func (e *EmailChannel) message(n models.Notification) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", e.smtp.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.smtp.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", n.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(n.Text, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// WebhookChannel POSTs the notification as JSON. With a secret the body is
+// signed: X-Wattwise-Signature: sha256=<hex HMAC-SHA256 of the body>.
+type WebhookChannel struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewWebhookChannel(endpoint, secret string) *WebhookChannel {
+	return &WebhookChannel{url: endpoint, secret: secret, client: &http.Client{}}
+}
+
+func (wh *WebhookChannel) Name() string { return "webhook" }
+
+func (wh *WebhookChannel) Send(ctx context.Context, n models.Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "wattwise-notifier")
+	if wh.secret != "" {
+		mac := hmac.New(sha256.New, []byte(wh.secret))
+		mac.Write(body)
+		req.Header.Set("X-Wattwise-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		// URL bisa memuat token, jangan ikut ke log/dead letter
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
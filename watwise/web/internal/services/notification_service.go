@@ -0,0 +1,348 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"wattwise/internal/models"
+	"wattwise/internal/repositories"
+)
+
+const (
+	// Queued notifications per channel; beyond that they are dead-lettered
+	notifyQueueSize = 100
+	// Time one Send may take, per attempt
+	notifySendTimeout = 30 * time.Second
+	// How often collapsed alerts are checked for a due digest
+	notifyDigestCheck = 30 * time.Second
+)
+
+// ErrUnknownChannel: POST /api/admin/notifications/test for a channel that
+// is not configured
+var ErrUnknownChannel = errors.New("notification channel not configured")
+
+// NotificationOptions are retry and rate limit of every channel
+type NotificationOptions struct {
+	MaxAttempts int           // per notification, at least 1
+	RetryDelay  time.Duration // before the 2nd attempt, doubled after each
+	// More than DigestThreshold alerts in DigestWindow on a channel are held
+	// back and sent as one digest when the window ends; 0 = no limit
+	DigestThreshold int
+	DigestWindow    time.Duration
+}
+
+// NotificationService sends alerts to email/webhook channels. Notify never
+// blocks the MQTT pipeline: every channel has its own queue and worker, so a
+// slow or failing webhook does not hold back email. Notifications still
+// failing after MaxAttempts go to the dead letter file.
+type NotificationService struct {
+	channels    []*notifyChannel
+	deadLetters *repositories.DeadLetterRepository
+	opts        NotificationOptions
+	logger      *slog.Logger
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// notifyChannel is a channel with its filter, queue and rate limit state
+type notifyChannel struct {
+	channel NotificationChannel
+	filter  models.NotificationFilter
+	queue   chan models.Notification
+
+	mu      sync.Mutex
+	sent    []time.Time        // alerts sent one by one within the window
+	pending []models.AlertData // held back for the next digest
+	since   time.Time          // first pending alert
+}
+
+func NewNotificationService(deadLetters *repositories.DeadLetterRepository, opts NotificationOptions, logger *slog.Logger) *NotificationService {
+	opts.MaxAttempts = max(opts.MaxAttempts, 1)
+	return &NotificationService{
+		deadLetters: deadLetters,
+		opts:        opts,
+		logger:      logger.With("component", "notifier"),
+		stop:        make(chan struct{}),
+	}
+}
+
+// AddChannel registers a channel receiving the alerts that match filter.
+// Call before Start.
+func (s *NotificationService) AddChannel(channel NotificationChannel, filter models.NotificationFilter) {
+	s.channels = append(s.channels, &notifyChannel{
+		channel: channel,
+		filter:  filter,
+		queue:   make(chan models.Notification, notifyQueueSize),
+	})
+}
+
+// Channels returns the names of the configured channels
+func (s *NotificationService) Channels() []string {
+	names := make([]string, len(s.channels))
+	for i, ch := range s.channels {
+		names[i] = ch.channel.Name()
+	}
+	return names
+}
+
+// Notify queues alert for every channel whose filter matches it, or holds it
+// back for a digest when the channel is over its rate limit. A nil service
+// does nothing.
+func (s *NotificationService) Notify(alert models.AlertData) {
+	if s == nil {
+		return
+	}
+	alert.Severity = alert.SeverityOrDefault()
+	now := time.Now()
+
+	for _, ch := range s.channels {
+		if !ch.filter.Match(alert) {
+			continue
+		}
+		if !ch.allow(alert, now, s.opts) {
+			s.logger.Debug("alert held for digest", "channel", ch.channel.Name(), "alert_type", alert.AlertType, "device_id", alert.DeviceID)
+			continue
+		}
+		s.enqueue(ch, alertNotification(alert, now))
+	}
+}
+
+// allow records an alert sent now, or adds it to the pending digest when the
+// channel already sent DigestThreshold alerts within DigestWindow (or a
+// digest is being collected)
+func (ch *notifyChannel) allow(alert models.AlertData, now time.Time, opts NotificationOptions) bool {
+	if opts.DigestThreshold <= 0 {
+		return true
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	cutoff := now.Add(-opts.DigestWindow)
+	keep := 0
+	for keep < len(ch.sent) && ch.sent[keep].Before(cutoff) {
+		keep++
+	}
+	ch.sent = ch.sent[keep:]
+
+	if len(ch.pending) == 0 && len(ch.sent) < opts.DigestThreshold {
+		ch.sent = append(ch.sent, now)
+		return true
+	}
+	if len(ch.pending) == 0 {
+		ch.since = now
+	}
+	ch.pending = append(ch.pending, alert)
+	return false
+}
+
+// dueDigest takes the pending alerts once DigestWindow passed since the
+// first of them
+func (ch *notifyChannel) dueDigest(now time.Time, window time.Duration) []models.AlertData {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if len(ch.pending) == 0 || now.Sub(ch.since) < window {
+		return nil
+	}
+	alerts := ch.pending
+	ch.pending = nil
+	return alerts
+}
+
+func (s *NotificationService) enqueue(ch *notifyChannel, n models.Notification) {
+	select {
+	case ch.queue <- n:
+	default:
+		s.deadLetter(ch, n, 0, errors.New("queue full"))
+	}
+}
+
+// Test sends a test notification to channel (all when empty) right away,
+// without filter, rate limit or retry, and reports each channel's result
+func (s *NotificationService) Test(ctx context.Context, channel string) ([]models.NotificationResult, error) {
+	var targets []*notifyChannel
+	for _, ch := range s.channels {
+		if channel == "" || ch.channel.Name() == channel {
+			targets = append(targets, ch)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, ErrUnknownChannel
+	}
+
+	now := time.Now()
+	n := models.Notification{
+		Kind:    models.NotificationTest,
+		Subject: "[WattWise] Test notification",
+		Text:    "This is a test notification from WattWise, sent " + now.Format(time.RFC1123) + ".\nAlerts will arrive on this channel.",
+		Alerts:  []models.AlertData{},
+		Time:    now,
+	}
+	results := make([]models.NotificationResult, len(targets))
+	for i, ch := range targets {
+		sendCtx, cancel := context.WithTimeout(ctx, notifySendTimeout)
+		err := ch.channel.Send(sendCtx, n)
+		cancel()
+
+		results[i] = models.NotificationResult{Channel: ch.channel.Name(), Success: err == nil}
+		if err != nil {
+			results[i].Error = err.Error()
+			s.logger.Warn("test notification failed", "channel", ch.channel.Name(), "error", err)
+		}
+	}
+	return results, nil
+}
+
+// Start runs one sender per channel and the digest check
+func (s *NotificationService) Start() {
+	for _, ch := range s.channels {
+		s.wg.Add(1)
+		go s.worker(ch)
+	}
+	if s.opts.DigestThreshold > 0 && len(s.channels) > 0 {
+		s.wg.Add(1)
+		go s.digestLoop()
+	}
+	if len(s.channels) > 0 {
+		s.logger.Info("notifications enabled", "channels", s.Channels(), "digest_threshold", s.opts.DigestThreshold, "digest_window", s.opts.DigestWindow)
+	}
+}
+
+// Stop ends the workers after the notification in flight; what is still
+// queued or held for a digest goes to the dead letter file
+func (s *NotificationService) Stop() {
+	select {
+	case <-s.stop:
+		return
+	default:
+		close(s.stop)
+	}
+	s.wg.Wait()
+
+	shutdown := errors.New("not sent before shutdown")
+	for _, ch := range s.channels {
+		for len(ch.queue) > 0 {
+			s.deadLetter(ch, <-ch.queue, 0, shutdown)
+		}
+		if alerts := ch.dueDigest(time.Now(), 0); len(alerts) > 0 {
+			s.deadLetter(ch, digestNotification(alerts, s.opts.DigestWindow, time.Now()), 0, shutdown)
+		}
+	}
+}
+
+func (s *NotificationService) worker(ch *notifyChannel) {
+	defer s.wg.Done()
+	for {
+		select {
+		case n := <-ch.queue:
+			s.deliver(ch, n)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *NotificationService) digestLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(notifyDigestCheck)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, ch := range s.channels {
+				if alerts := ch.dueDigest(now, s.opts.DigestWindow); len(alerts) > 0 {
+					s.enqueue(ch, digestNotification(alerts, s.opts.DigestWindow, now))
+				}
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// deliver sends n with up to MaxAttempts attempts, waiting RetryDelay,
+// 2×RetryDelay, ... in between
+func (s *NotificationService) deliver(ch *notifyChannel, n models.Notification) {
+	logger := s.logger.With("channel", ch.channel.Name(), "kind", n.Kind)
+	delay := s.opts.RetryDelay
+
+	var err error
+	for attempt := 1; attempt <= s.opts.MaxAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), notifySendTimeout)
+		err = ch.channel.Send(ctx, n)
+		cancel()
+		if err == nil {
+			logger.Debug("notification sent", "alerts", len(n.Alerts), "attempt", attempt)
+			return
+		}
+		if attempt == s.opts.MaxAttempts {
+			break
+		}
+		logger.Warn("notification failed, retrying", "attempt", attempt, "retry_in", delay, "error", err)
+
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-s.stop:
+			s.deadLetter(ch, n, attempt, fmt.Errorf("shutdown while retrying: %w", err))
+			return
+		}
+	}
+	s.deadLetter(ch, n, s.opts.MaxAttempts, err)
+}
+
+func (s *NotificationService) deadLetter(ch *notifyChannel, n models.Notification, attempts int, cause error) {
+	s.logger.Error("notification dropped", "channel", ch.channel.Name(), "kind", n.Kind, "alerts", len(n.Alerts), "attempts", attempts, "error", cause)
+	letter := models.DeadLetter{
+		Time:         time.Now(),
+		Channel:      ch.channel.Name(),
+		Attempts:     attempts,
+		Error:        cause.Error(),
+		Notification: n,
+	}
+	if err := s.deadLetters.Append(letter); err != nil {
+		s.logger.Error("failed to write dead letter", "channel", ch.channel.Name(), "error", err)
+	}
+}
+
+func alertNotification(alert models.AlertData, now time.Time) models.Notification {
+	return models.Notification{
+		Kind:    models.NotificationAlert,
+		Subject: fmt.Sprintf("[WattWise] %s: %s on %s", strings.ToUpper(alert.Severity), alert.AlertType, alert.DeviceID),
+		Text:    alertText(alert),
+		Alerts:  []models.AlertData{alert},
+		Time:    now,
+	}
+}
+
+func digestNotification(alerts []models.AlertData, window time.Duration, now time.Time) models.Notification {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d alerts were collapsed into this digest (more than the limit within %s).\n", len(alerts), window)
+	for _, alert := range alerts {
+		b.WriteString("\n")
+		b.WriteString(alertText(alert))
+	}
+	return models.Notification{
+		Kind:    models.NotificationDigest,
+		Subject: fmt.Sprintf("[WattWise] %d alerts (digest)", len(alerts)),
+		Text:    b.String(),
+		Alerts:  alerts,
+		Time:    now,
+	}
+}
+
+func alertText(alert models.AlertData) string {
+	at := time.UnixMilli(alert.Timestamp)
+	if alert.Timestamp == 0 {
+		at = time.Now()
+	}
+	return fmt.Sprintf("[%s] %s %s - %s\n  %s (threshold %g, actual %g)\n",
+		at.Format("2006-01-02 15:04:05"), alert.DeviceID, alert.AlertType, alert.Severity,
+		alert.Message, alert.Threshold, alert.ActualValue)
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"math"
+	"time"
+	"wattwise/internal/models"
+)
+
+// Rolling z-score scan of GET /api/energy/anomalies, see SetAnomalyScan
+const (
+	DefaultAnomalyZScore = 3.0
+	DefaultAnomalyWindow = 30
+
+	// Anomalies returned per request; the rest only set Truncated
+	maxPowerAnomalies = 1000
+)
+
+// SetAnomalyScan sets how many preceding readings FindPowerAnomalies scores a
+// reading against and the |z-score| above which it is reported
+func (s *EnergyService) SetAnomalyScan(window int, zScore float64) {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	s.anomalyWindow = max(window, 2)
+	if zScore > 0 {
+		s.anomalyZScore = zScore
+	}
+}
+
+// AnomalyScan returns the window and threshold set by SetAnomalyScan
+func (s *EnergyService) AnomalyScan() (window int, zScore float64) {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.anomalyWindow, s.anomalyZScore
+}
+
+// FindPowerAnomalies scores every reading of [start, end) against the
+// rolling mean and stddev of the window readings before it and returns
+// those with |z| > zScore, oldest first. window <= 0 and zScore <= 0 use
+// the SetAnomalyScan values.
+func (s *EnergyService) FindPowerAnomalies(ctx context.Context, deviceID string, start, end time.Time, window int, zScore float64) (*models.PowerAnomalyReport, error) {
+	defaultWindow, defaultZScore := s.AnomalyScan()
+	if window <= 0 {
+		window = defaultWindow
+	}
+	if zScore <= 0 {
+		zScore = defaultZScore
+	}
+
+	report := &models.PowerAnomalyReport{
+		DeviceID:  deviceID,
+		Start:     start,
+		End:       end,
+		Window:    window,
+		Threshold: zScore,
+		Anomalies: []models.PowerAnomaly{},
+	}
+
+	rolling := newRollingWindow(window)
+	err := s.db.StreamRangeAscending(ctx, deviceID, start.UnixMilli(), end.UnixMilli()-1, func(r models.EnergyData) error {
+		if r.Missing.Has(models.MissingPower) {
+			return nil
+		}
+		report.Points++
+
+		mean, stddev, ok := rolling.stats()
+		rolling.push(r.Power)
+		if !ok {
+			report.WarmupPoints++
+			return nil
+		}
+		// Window datar: stddev 0, z-score tidak terdefinisi
+		if stddev == 0 {
+			return nil
+		}
+
+		z := (r.Power - mean) / stddev
+		if math.Abs(z) <= zScore {
+			return nil
+		}
+		if len(report.Anomalies) >= maxPowerAnomalies {
+			report.Truncated = true
+			return nil
+		}
+		report.Anomalies = append(report.Anomalies, models.PowerAnomaly{
+			Timestamp: r.Timestamp,
+			Power:     r.Power,
+			Mean:      mean,
+			StdDev:    stddev,
+			ZScore:    z,
+		})
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("anomaly scan failed", "device_id", deviceID, "error", err)
+		return nil, err
+	}
+
+	s.logger.Debug("anomaly scan completed", "device_id", deviceID, "points", report.Points, "anomalies", len(report.Anomalies))
+	return report, nil
+}
+
+// rollingWindow keeps the last size values. stats recomputes mean and
+// stddev in two passes: windows are small, and running sums of squares lose
+// precision on a nearly flat load.
+type rollingWindow struct {
+	values []float64 // ring buffer
+	next   int
+	full   bool
+}
+
+func newRollingWindow(size int) *rollingWindow {
+	return &rollingWindow{values: make([]float64, size)}
+}
+
+func (w *rollingWindow) push(v float64) {
+	w.values[w.next] = v
+	w.next++
+	if w.next == len(w.values) {
+		w.next = 0
+		w.full = true
+	}
+}
+
+// stats returns the mean and population stddev of the window; ok is false
+// until the window is full (warm-up)
+func (w *rollingWindow) stats() (mean, stddev float64, ok bool) {
+	if !w.full {
+		return 0, 0, false
+	}
+	n := float64(len(w.values))
+	for _, v := range w.values {
+		mean += v
+	}
+	mean /= n
+
+	variance := 0.0
+	for _, v := range w.values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / n), true
+}
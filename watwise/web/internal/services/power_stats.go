@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+	"wattwise/internal/models"
+)
+
+// GetPowerStats computes the power distribution of deviceID's readings in
+// [start, end). An empty range returns Count 0 rather than an error.
+func (s *EnergyService) GetPowerStats(ctx context.Context, deviceID string, start, end time.Time) (*models.PowerStats, error) {
+	readings, err := s.db.GetDataByTimeRange(ctx, deviceID, start.UnixMilli(), end.UnixMilli()-1)
+	if err != nil {
+		s.logger.Error("power stats query failed", "device_id", deviceID, "error", err)
+		return nil, err
+	}
+
+	powers := make([]float64, len(readings))
+	for i, r := range readings {
+		powers[i] = r.Power
+	}
+
+	stats := powerStats(powers)
+	stats.DeviceID = deviceID
+	stats.Start = start
+	stats.End = end
+	return &stats, nil
+}
+
+func powerStats(values []float64) models.PowerStats {
+	n := len(values)
+	if n == 0 {
+		return models.PowerStats{}
+	}
+
+	sorted := make([]float64, n)
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	mean := sum / float64(n)
+
+	variance := 0.0
+	for _, v := range sorted {
+		variance += (v - mean) * (v - mean)
+	}
+	variance /= float64(n)
+
+	return models.PowerStats{
+		Count:  n,
+		Mean:   mean,
+		Median: percentile(sorted, 0.50),
+		P95:    percentile(sorted, 0.95),
+		P99:    percentile(sorted, 0.99),
+		Min:    sorted[0],
+		Max:    sorted[n-1],
+		StdDev: math.Sqrt(variance),
+	}
+}
+
+// percentile interpolates linearly between the closest ranks of sorted
+func percentile(sorted []float64, q float64) float64 {
+	rank := q * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
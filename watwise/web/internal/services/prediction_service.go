@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"wattwise/internal/database"
+	"wattwise/internal/models"
+)
+
+const (
+	forecastHours  = 24
+	maxPredictHour = 7 * 24
+)
+
+// ForecastBroadcaster receives the forecast summary after each recompute
+// (*handlers.WebSocketHandler)
+type ForecastBroadcaster interface {
+	BroadcastForecast(summary models.ForecastSummary)
+}
+
+// PredictionService forecasts hourly consumption from the last lookbackDays:
+// for each future hour it takes the same hour-of-week in earlier weeks
+// (same hour-of-day when there is less than a week of history) and applies
+// exponential smoothing, oldest to newest. Forecasts are written to the
+// device's prediction series.
+type PredictionService struct {
+	db           database.Store
+	devices      *DeviceService
+	tariff       *TariffService
+	lookbackDays int
+	alpha        float64
+	every        time.Duration
+	broadcaster  ForecastBroadcaster
+	logger       *slog.Logger
+	stop         chan struct{}
+}
+
+func NewPredictionService(db database.Store, devices *DeviceService, tariff *TariffService, lookbackDays, intervalMinutes int, alpha float64, logger *slog.Logger) *PredictionService {
+	if lookbackDays <= 0 {
+		lookbackDays = 28
+	}
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.5
+	}
+	return &PredictionService{
+		db:           db,
+		devices:      devices,
+		tariff:       tariff,
+		lookbackDays: lookbackDays,
+		alpha:        alpha,
+		every:        time.Duration(intervalMinutes) * time.Minute,
+		logger:       logger.With("component", "prediction"),
+		stop:         make(chan struct{}),
+	}
+}
+
+// SetBroadcaster sets where forecast summaries are sent after a recompute
+func (s *PredictionService) SetBroadcaster(broadcaster ForecastBroadcaster) {
+	s.broadcaster = broadcaster
+}
+
+// Start recomputes the forecast every interval. intervalMinutes <= 0 disables
+// the schedule; GET /api/energy/prediction still computes on demand.
+func (s *PredictionService) Start() {
+	if s.every <= 0 {
+		s.logger.Info("scheduled prediction disabled (PREDICTION_INTERVAL_MINUTES=0)")
+		return
+	}
+
+	s.logger.Info("prediction enabled", "lookback_days", s.lookbackDays, "alpha", s.alpha, "every", s.every)
+	go s.loop()
+}
+
+func (s *PredictionService) Stop() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+}
+
+func (s *PredictionService) loop() {
+	ticker := time.NewTicker(s.every)
+	defer ticker.Stop()
+
+	for {
+		s.RunOnce(time.Now())
+
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// RunOnce recomputes and stores the next-24h forecast for every device
+func (s *PredictionService) RunOnce(now time.Time) {
+	if !s.db.IsEnabled() {
+		s.logger.Warn("IoTDB not connected, skipping prediction run")
+		return
+	}
+
+	ctx := context.Background()
+	for _, deviceID := range s.deviceIDs() {
+		forecast, err := s.Forecast(ctx, deviceID, forecastHours, now)
+		if err != nil {
+			s.logger.Error("forecast failed", "device_id", deviceID, "error", err)
+			continue
+		}
+		if err := s.db.WritePredictions(ctx, deviceID, forecast); err != nil {
+			continue
+		}
+
+		summary := s.summarize(deviceID, forecast, now)
+		s.logger.Info("forecast updated", "device_id", deviceID, "total_kwh", summary.TotalKWh)
+
+		if s.broadcaster != nil {
+			s.broadcaster.BroadcastForecast(summary)
+		}
+	}
+}
+
+// Forecast computes predictions for the next hours, starting at the current hour
+func (s *PredictionService) Forecast(ctx context.Context, deviceID string, hours int, now time.Time) ([]models.PredictionPoint, error) {
+	hourStart := now.Truncate(time.Hour)
+	from := hourStart.AddDate(0, 0, -s.lookbackDays)
+
+	readings, err := s.db.GetDataByTimeRange(ctx, deviceID, from.UnixMilli(), hourStart.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	history := HourlyEnergy(readings)
+
+	step := 7 * 24 * time.Hour
+	if hourStart.Sub(from) < step || len(history) < 7*24/2 {
+		// Belum cukup data seminggu, pakai jam yang sama di hari sebelumnya
+		step = 24 * time.Hour
+	}
+
+	points := make([]models.PredictionPoint, 0, hours)
+	for k := 0; k < hours; k++ {
+		target := hourStart.Add(time.Duration(k) * time.Hour)
+		points = append(points, models.PredictionPoint{
+			Timestamp:    target.UnixMilli(),
+			PredictedKWh: s.smooth(history, target, step, from, hourStart),
+		})
+	}
+	return points, nil
+}
+
+// smooth applies exponential smoothing to the history values at target - n*step
+func (s *PredictionService) smooth(history map[int64]float64, target time.Time, step time.Duration, from, until time.Time) float64 {
+	// Sample paling lama dulu
+	oldest := target
+	for oldest.Add(-step).Compare(from) >= 0 {
+		oldest = oldest.Add(-step)
+	}
+
+	var (
+		value float64
+		seen  bool
+	)
+	for t := oldest; t.Before(until); t = t.Add(step) {
+		x, ok := history[t.UnixMilli()]
+		if !ok {
+			continue // jam tanpa data, bukan berarti 0 kWh
+		}
+		if !seen {
+			value, seen = x, true
+			continue
+		}
+		value = s.alpha*x + (1-s.alpha)*value
+	}
+	return value
+}
+
+// Compare returns the forecast for the next hours (stored if complete, else
+// computed now) and, for the same number of hours before now, actual
+// consumption next to the forecast stored for those hours
+func (s *PredictionService) Compare(ctx context.Context, deviceID string, hours int, now time.Time) (*models.PredictionResponse, error) {
+	if hours <= 0 || hours > maxPredictHour {
+		hours = forecastHours
+	}
+	hourStart := now.Truncate(time.Hour)
+	pastStart := hourStart.Add(-time.Duration(hours) * time.Hour)
+	futureEnd := hourStart.Add(time.Duration(hours) * time.Hour)
+
+	forecast, err := s.db.GetPredictions(ctx, deviceID, hourStart.UnixMilli(), futureEnd.UnixMilli()-1)
+	if err != nil {
+		return nil, err
+	}
+	if len(forecast) < hours {
+		if forecast, err = s.Forecast(ctx, deviceID, hours, now); err != nil {
+			return nil, err
+		}
+	}
+
+	past, err := s.db.GetPredictions(ctx, deviceID, pastStart.UnixMilli(), hourStart.UnixMilli()-1)
+	if err != nil {
+		return nil, err
+	}
+	predicted := make(map[int64]float64, len(past))
+	for _, p := range past {
+		predicted[p.Timestamp] = p.PredictedKWh
+	}
+
+	readings, err := s.db.GetDataByTimeRange(ctx, deviceID, pastStart.UnixMilli(), hourStart.UnixMilli()-1)
+	if err != nil {
+		return nil, err
+	}
+	actual := HourlyEnergy(readings)
+
+	response := &models.PredictionResponse{
+		DeviceID: deviceID,
+		Hours:    hours,
+		Forecast: forecast,
+		Actuals:  make([]models.PredictionComparison, 0, hours),
+	}
+	for _, p := range forecast {
+		response.TotalPredictedKWh += p.PredictedKWh
+	}
+	for t := pastStart; t.Before(hourStart); t = t.Add(time.Hour) {
+		ts := t.UnixMilli()
+		point := models.PredictionComparison{Timestamp: ts, ActualKWh: actual[ts]}
+		if p, ok := predicted[ts]; ok {
+			point.PredictedKWh = &p
+		}
+		response.TotalActualKWh += point.ActualKWh
+		response.Actuals = append(response.Actuals, point)
+	}
+	return response, nil
+}
+
+func (s *PredictionService) summarize(deviceID string, forecast []models.PredictionPoint, now time.Time) models.ForecastSummary {
+	summary := models.ForecastSummary{
+		Type:        "forecast",
+		DeviceID:    deviceID,
+		Hours:       len(forecast),
+		GeneratedAt: now.UnixMilli(),
+	}
+	for _, p := range forecast {
+		summary.TotalKWh += p.PredictedKWh
+		if p.PredictedKWh > summary.PeakKWh || summary.PeakHour == 0 {
+			summary.PeakHour, summary.PeakKWh = p.Timestamp, p.PredictedKWh
+		}
+	}
+	summary.EstimatedCost = s.tariff.Cost(summary.TotalKWh)
+	return summary
+}
+
+func (s *PredictionService) deviceIDs() []string {
+	var ids []string
+	if s.devices != nil {
+		for _, device := range s.devices.List() {
+			ids = append(ids, device.ID)
+		}
+	}
+	if len(ids) == 0 {
+		ids = append(ids, models.DefaultDeviceID)
+	}
+	return ids
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"fmt"
+	"wattwise/internal/models"
+)
+
+// qualityStreak counts a device's consecutive out-of-range readings
+type qualityStreak struct {
+	lowPowerFactor int
+	frequency      int
+}
+
+// CheckQualityAlerts raises "low_power_factor" and "frequency_deviation"
+// once a device has been out of range for SustainedReadings readings in a
+// row, so a single noisy reading does not alarm. Each alerts once per streak;
+// an in-range reading ends it. Device overrides (min_power_factor,
+// min_frequency, max_frequency) replace the configured bounds.
+func (s *EnergyService) CheckQualityAlerts(deviceID string, data *models.EnergyData) []*models.AlertData {
+	if !s.Toggles().Quality {
+		return nil
+	}
+	t := s.deviceThresholds(deviceID)
+	sustained := max(t.SustainedReadings, 1)
+
+	// PZEM mengirim power factor 0 tanpa beban, jadi hanya dicek saat ada daya
+	lowPF := t.MinPowerFactor > 0 && data.Power > 0 && data.PowerFactor < t.MinPowerFactor
+	// Frequency 0 berarti field tidak dikirim
+	freqLow := data.Frequency > 0 && t.MinFrequency > 0 && data.Frequency < t.MinFrequency
+	freqHigh := data.Frequency > 0 && t.MaxFrequency > 0 && data.Frequency > t.MaxFrequency
+
+	s.qualityMu.Lock()
+	streak, ok := s.quality[deviceID]
+	if !ok {
+		streak = &qualityStreak{}
+		s.quality[deviceID] = streak
+	}
+	streak.lowPowerFactor = nextStreak(streak.lowPowerFactor, lowPF)
+	streak.frequency = nextStreak(streak.frequency, freqLow || freqHigh)
+	pfCount, freqCount := streak.lowPowerFactor, streak.frequency
+	s.qualityMu.Unlock()
+
+	var alerts []*models.AlertData
+	if pfCount == sustained {
+		alerts = append(alerts, &models.AlertData{
+			DeviceID:    deviceID,
+			AlertType:   "low_power_factor",
+			Message:     fmt.Sprintf("Power factor low: %.2f for %d readings", data.PowerFactor, sustained),
+			Threshold:   t.MinPowerFactor,
+			ActualValue: data.PowerFactor,
+			Timestamp:   data.Timestamp,
+		})
+	}
+	if freqCount == sustained {
+		threshold := t.MinFrequency
+		if freqHigh {
+			threshold = t.MaxFrequency
+		}
+		alerts = append(alerts, &models.AlertData{
+			DeviceID:    deviceID,
+			AlertType:   "frequency_deviation",
+			Message:     fmt.Sprintf("Frequency out of range: %.2fHz for %d readings", data.Frequency, sustained),
+			Threshold:   threshold,
+			ActualValue: data.Frequency,
+			Timestamp:   data.Timestamp,
+		})
+	}
+	return alerts
+}
+
+func nextStreak(count int, violated bool) int {
+	if !violated {
+		return 0
+	}
+	return count + 1
+}
+
+// deviceThresholds applies a registered device's quality overrides
+func (s *EnergyService) deviceThresholds(deviceID string) AlertThresholds {
+	t := s.Thresholds()
+	if s.devices == nil {
+		return t
+	}
+	if device, err := s.devices.Get(deviceID); err == nil {
+		if device.MinPowerFactor > 0 {
+			t.MinPowerFactor = device.MinPowerFactor
+		}
+		if device.MinFrequency > 0 {
+			t.MinFrequency = device.MinFrequency
+		}
+		if device.MaxFrequency > 0 {
+			t.MaxFrequency = device.MaxFrequency
+		}
+	}
+	return t
+}
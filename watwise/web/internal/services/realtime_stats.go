@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"wattwise/internal/models"
+)
+
+// RealtimeWindows are the spans accepted by GetRealtimeStats
+var RealtimeWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+}
+
+// GetRealtimeStats sums current power over online devices and consumption
+// over the window for every known device (registry + devices seen on MQTT).
+// Devices without data in the window are reported with zeros.
+func (s *EnergyService) GetRealtimeStats(ctx context.Context, window string, now time.Time) (*models.RealtimeStats, error) {
+	span, ok := RealtimeWindows[window]
+	if !ok {
+		return nil, fmt.Errorf("invalid window %q, use: 1h or 24h", window)
+	}
+
+	from := now.Add(-span)
+	stats := &models.RealtimeStats{
+		Window:  window,
+		From:    from,
+		To:      now,
+		Devices: []models.DeviceRealtimeStats{},
+	}
+
+	for _, device := range s.knownDevices() {
+		ds := device
+		readings, err := s.db.GetDataByTimeRange(ctx, ds.DeviceID, from.UnixMilli(), now.UnixMilli())
+		if err != nil {
+			// Device lain tetap dihitung
+			s.logger.Warn("realtime stats query failed", "device_id", ds.DeviceID, "error", err)
+			readings = nil
+		}
+
+		if len(readings) > 0 {
+			ds.HasData = true
+			ds.EnergyKWh = IntervalEnergy(readings)
+			ds.Cost = s.tariff.Cost(ds.EnergyKWh)
+
+			if ds.Online {
+				// GetDataByTimeRange: terbaru di depan
+				latest := readings[0]
+				for _, r := range readings {
+					if r.Timestamp > latest.Timestamp {
+						latest = r
+					}
+				}
+				ds.CurrentPower = latest.Power
+			}
+		}
+		ds.CostMoney = s.tariff.Money(ds.Cost)
+		if peak, ok := s.TodayPeakDemand(ds.DeviceID, now); ok {
+			ds.PeakDemandToday = &peak
+		}
+
+		stats.TotalDevices++
+		if ds.Online {
+			stats.OnlineDevices++
+		}
+		stats.TotalPower += ds.CurrentPower
+		stats.TotalEnergy += ds.EnergyKWh
+		stats.Devices = append(stats.Devices, ds)
+	}
+
+	stats.EstimatedCost = s.tariff.Cost(stats.TotalEnergy)
+	stats.EstimatedDailyCost = stats.EstimatedCost * float64(24*time.Hour) / float64(span)
+	stats.EstimatedCostMoney = s.tariff.Money(stats.EstimatedCost)
+	stats.EstimatedDailyCostMoney = s.tariff.Money(stats.EstimatedDailyCost)
+
+	return stats, nil
+}
+
+// knownDevices merges the registry with the live MQTT status map. Without
+// either source only the default device is reported.
+func (s *EnergyService) knownDevices() []models.DeviceRealtimeStats {
+	var result []models.DeviceRealtimeStats
+	index := make(map[string]int)
+
+	if s.devices != nil {
+		for _, device := range s.devices.List() {
+			index[device.ID] = len(result)
+			result = append(result, models.DeviceRealtimeStats{DeviceID: device.ID, Name: device.Name})
+		}
+	}
+
+	if s.statuses != nil {
+		for _, status := range s.statuses.GetAllDeviceStatus() {
+			i, ok := index[status.DeviceID]
+			if !ok {
+				i = len(result)
+				index[status.DeviceID] = i
+				result = append(result, models.DeviceRealtimeStats{DeviceID: status.DeviceID, Name: status.DeviceName})
+			}
+
+			lastSeen := time.UnixMilli(status.LastSeen)
+			result[i].LastSeen = &lastSeen
+			result[i].Online = status.Status == "online"
+		}
+	}
+
+	if len(result) == 0 {
+		result = append(result, models.DeviceRealtimeStats{DeviceID: models.DefaultDeviceID, Name: models.DefaultDeviceID})
+	}
+	return result
+}
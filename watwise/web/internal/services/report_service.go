@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"wattwise/internal/models"
+)
+
+// ReportService assembles the monthly report from the summary, peak demand
+// and cost figures; rendering to PDF/XLSX lives in package reports
+type ReportService struct {
+	energy  *EnergyService
+	devices *DeviceService
+	// kg CO2 per kWh
+	carbonFactor float64
+	logger       *slog.Logger
+}
+
+func NewReportService(energy *EnergyService, devices *DeviceService, carbonKgPerKWh float64, logger *slog.Logger) *ReportService {
+	return &ReportService{
+		energy:       energy,
+		devices:      devices,
+		carbonFactor: carbonKgPerKWh,
+		logger:       logger.With("component", "report"),
+	}
+}
+
+// MonthlyReport assembles the report of deviceID for the month containing
+// month, in month's zone
+func (s *ReportService) MonthlyReport(ctx context.Context, deviceID string, month time.Time) (*models.MonthlyReport, error) {
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, month.Location())
+	end := start.AddDate(0, 1, 0)
+
+	summary, err := s.energy.GetMonthlySummary(ctx, deviceID, start)
+	if err != nil {
+		return nil, err
+	}
+	demand, err := s.energy.ComputePeakDemand(ctx, deviceID, start, end, 0)
+	if err != nil {
+		return nil, err
+	}
+	cost, err := s.energy.GetCostBreakdown(ctx, deviceID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.MonthlyReport{
+		DeviceID:    deviceID,
+		DeviceName:  deviceID,
+		Month:       summary.Month,
+		Timezone:    start.Location().String(),
+		GeneratedAt: time.Now().In(start.Location()),
+
+		TotalEnergy: summary.TotalEnergy,
+		TotalCost:   summary.TotalCostMoney,
+
+		CarbonKg:       summary.TotalEnergy * s.carbonFactor,
+		CarbonKgPerKWh: s.carbonFactor,
+
+		StandbyPower:  summary.StandbyPower,
+		StandbyEnergy: summary.StandbyEnergy,
+
+		PeakDemand:          demand.Peak,
+		DemandWindowMinutes: demand.WindowMinutes,
+
+		Daily:      summary.DailySummaries,
+		CostBlocks: cost.Blocks,
+	}
+	if device, err := s.devices.Get(deviceID); err == nil && device.Name != "" {
+		report.DeviceName = device.Name
+	}
+
+	for _, day := range summary.DailySummaries {
+		if day.TotalEnergy > 0 || day.MaxPower > 0 {
+			report.DaysWithData++
+		}
+	}
+	if report.DaysWithData > 0 {
+		report.AvgDailyEnergy = report.TotalEnergy / float64(report.DaysWithData)
+	}
+
+	s.logger.Debug("monthly report assembled", "device_id", deviceID, "month", report.Month, "days_with_data", report.DaysWithData)
+	return report, nil
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+	"wattwise/internal/database"
+	"wattwise/internal/models"
+	"wattwise/internal/repositories"
+)
+
+// newTestReport is a ReportService over store with device A registered as
+// "Panel utama" and 0.8 kg CO2/kWh
+func newTestReport(t *testing.T, store database.Store) *ReportService {
+	t.Helper()
+	deviceRepo, err := repositories.NewDeviceRepository("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices := NewDeviceService(deviceRepo, discardLogger())
+	if _, err := devices.Register(models.Device{ID: "A", Name: "Panel utama"}); err != nil {
+		t.Fatal(err)
+	}
+	return NewReportService(newTestService(store), devices, 0.8, discardLogger())
+}
+
+// hourAt is a reading per minute for the hour from start at power watts,
+// with the counter starting at kwh
+func hourAt(start time.Time, power, kwh float64) []models.EnergyData {
+	readings := make([]models.EnergyData, 61)
+	for i := range readings {
+		readings[i] = reading(start.Add(time.Duration(i)*time.Minute), power, kwh+power/1000*float64(i)/60)
+	}
+	return readings
+}
+
+func TestMonthlyReport(t *testing.T) {
+	store := database.NewMemoryStore()
+	jan2 := time.Date(2025, 1, 2, 9, 0, 0, 0, testLocation)
+	jan20 := time.Date(2025, 1, 20, 9, 0, 0, 0, testLocation)
+	seed(t, store, "A", hourAt(jan2, 1200, 0)...)   // 1.2 kWh
+	seed(t, store, "A", hourAt(jan20, 600, 1.2)...) // 0.6 kWh
+	// Di luar bulan: tidak ikut dihitung
+	seed(t, store, "A", hourAt(time.Date(2024, 12, 31, 22, 0, 0, 0, testLocation), 3000, 10)...)
+	seed(t, store, "A", hourAt(time.Date(2025, 2, 1, 0, 0, 0, 0, testLocation), 3000, 20)...)
+
+	report, err := newTestReport(t, store).MonthlyReport(context.Background(), "A", time.Date(2025, 1, 17, 12, 0, 0, 0, testLocation))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.DeviceID != "A" || report.DeviceName != "Panel utama" || report.Month != "2025-01" || report.Timezone != "WIB" {
+		t.Errorf("header = %s %q %s %s", report.DeviceID, report.DeviceName, report.Month, report.Timezone)
+	}
+	if len(report.Daily) != 31 || report.Daily[0].Date != "2025-01-01" || report.Daily[30].Date != "2025-01-31" {
+		t.Fatalf("%d daily rows, want every day of January", len(report.Daily))
+	}
+	near := func(name string, got, want float64) {
+		t.Helper()
+		if math.Abs(got-want) > 1e-6 {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+	near("total energy", report.TotalEnergy, 1.8)
+	near("Jan 2", report.Daily[1].TotalEnergy, 1.2)
+	near("Jan 20", report.Daily[19].TotalEnergy, 0.6)
+	if report.DaysWithData != 2 {
+		t.Errorf("days with data = %d, want 2", report.DaysWithData)
+	}
+	near("average per day", report.AvgDailyEnergy, 0.9)
+	near("carbon", report.CarbonKg, 1.44)
+	near("emission factor", report.CarbonKgPerKWh, 0.8)
+
+	var blocks float64
+	for _, block := range report.CostBlocks {
+		blocks += block.KWh
+	}
+	near("kWh over the cost blocks", blocks, report.TotalEnergy)
+	if report.TotalCost.Amount <= 0 || report.TotalCost.Currency.Code == "" {
+		t.Errorf("total cost = %+v", report.TotalCost)
+	}
+
+	if report.PeakDemand == nil {
+		t.Fatal("no peak demand")
+	}
+	if got := report.PeakDemand.Start; got.Before(jan2) || !got.Before(jan2.Add(time.Hour)) {
+		t.Errorf("peak demand at %v, want within the 1200 W hour of Jan 2", got)
+	}
+	near("peak demand", report.PeakDemand.AverageKW, 1.2)
+	if report.DemandWindowMinutes <= 0 {
+		t.Errorf("demand window = %d minutes", report.DemandWindowMinutes)
+	}
+}
+
+func TestMonthlyReportWithoutData(t *testing.T) {
+	store := database.NewMemoryStore()
+	// Device yang tidak terdaftar memakai ID-nya sebagai nama
+	seed(t, store, "B", hourAt(time.Date(2025, 3, 1, 0, 0, 0, 0, testLocation), 500, 0)...)
+
+	report, err := newTestReport(t, store).MonthlyReport(context.Background(), "B", time.Date(2025, 2, 1, 0, 0, 0, 0, testLocation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DeviceName != "B" || report.Month != "2025-02" || len(report.Daily) != 28 {
+		t.Errorf("report = %q %s with %d days", report.DeviceName, report.Month, len(report.Daily))
+	}
+	if report.TotalEnergy != 0 || report.DaysWithData != 0 || report.AvgDailyEnergy != 0 || report.CarbonKg != 0 {
+		t.Errorf("empty month = %v kWh over %d days, average %v, carbon %v", report.TotalEnergy, report.DaysWithData, report.AvgDailyEnergy, report.CarbonKg)
+	}
+	if report.PeakDemand != nil {
+		t.Errorf("peak demand = %+v, want none", report.PeakDemand)
+	}
+}
+
+func TestMonthlyReportStoreError(t *testing.T) {
+	store := &flakyStore{MemoryStore: database.NewMemoryStore(), err: context.DeadlineExceeded}
+	if _, err := newTestReport(t, store).MonthlyReport(context.Background(), "A", time.Date(2025, 1, 1, 0, 0, 0, 0, testLocation)); err == nil {
+		t.Error("MonthlyReport succeeded over a failing store")
+	}
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxCachedResponses bounds the cache; when full and nothing has expired,
+// new responses are simply not cached
+const maxCachedResponses = 1000
+
+// ResponseCache keeps rendered JSON of read endpoints (daily summary,
+// filtered data) per device and time range. Entries expire after ttl and are
+// dropped as soon as a reading for their device lands inside their range, so
+// "today" is never stale while past days are served from memory.
+type ResponseCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*CachedResponse
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// CachedResponse is one cached body with its ETag
+type CachedResponse struct {
+	Body     []byte
+	ETag     string
+	deviceID string
+	from, to int64 // Unix ms, [from, to)
+	expires  time.Time
+}
+
+// CacheStats is reported by GET /api/energy/cache
+type CacheStats struct {
+	Enabled    bool   `json:"enabled"`
+	TTLSeconds int    `json:"ttl_seconds"`
+	Entries    int    `json:"entries"`
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+
+	// SummaryCache only: TTL of the month that is still running
+	CurrentMonthTTLSeconds int `json:"current_month_ttl_seconds,omitempty"`
+}
+
+// NewResponseCache returns a cache, or nil (caching off) when ttl <= 0
+func NewResponseCache(ttl time.Duration) *ResponseCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &ResponseCache{
+		ttl:     ttl,
+		entries: make(map[string]*CachedResponse),
+	}
+}
+
+// Get returns a live entry and counts the hit or miss
+func (c *ResponseCache) Get(key string) (*CachedResponse, bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return entry, ok
+}
+
+// Set stores body for deviceID's [from, to) range and returns the entry
+func (c *ResponseCache) Set(key, deviceID string, from, to time.Time, body []byte) *CachedResponse {
+	sum := sha256.Sum256(body)
+	now := time.Now()
+	entry := &CachedResponse{
+		Body:     body,
+		ETag:     `"` + hex.EncodeToString(sum[:8]) + `"`,
+		deviceID: deviceID,
+		from:     from.UnixMilli(),
+		to:       to.UnixMilli(),
+		expires:  now.Add(c.ttl),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= maxCachedResponses {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if len(c.entries) < maxCachedResponses {
+		c.entries[key] = entry
+	}
+	return entry
+}
+
+// Invalidate drops deviceID's entries whose range contains timestampMs
+func (c *ResponseCache) Invalidate(deviceID string, timestampMs int64) {
+	c.InvalidateRange(deviceID, timestampMs, timestampMs+1)
+}
+
+// InvalidateRange drops deviceID's entries overlapping [fromMs, toMs)
+func (c *ResponseCache) InvalidateRange(deviceID string, fromMs, toMs int64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, e := range c.entries {
+		if e.deviceID == deviceID && e.from < toMs && fromMs < e.to {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Flush drops every entry and returns how many there were. Safe on a nil
+// cache.
+func (c *ResponseCache) Flush() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.entries)
+	c.entries = make(map[string]*CachedResponse)
+	return n
+}
+
+// Stats returns hit/miss counters and the current size. Safe on a nil cache.
+func (c *ResponseCache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	return CacheStats{
+		Enabled:    true,
+		TTLSeconds: int(c.ttl.Seconds()),
+		Entries:    entries,
+		Hits:       c.hits.Load(),
+		Misses:     c.misses.Load(),
+	}
+}
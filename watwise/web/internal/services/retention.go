@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"wattwise/internal/database"
+)
+
+// RetentionJob deletes readings older than RetentionDays once a night
+type RetentionJob struct {
+	db     *database.IoTDB
+	days   int
+	hour   int
+	logger *slog.Logger
+	stop   chan struct{}
+}
+
+func NewRetentionJob(db *database.IoTDB, days, hour int, logger *slog.Logger) *RetentionJob {
+	if hour < 0 || hour > 23 {
+		hour = 2
+	}
+	return &RetentionJob{
+		db:     db,
+		days:   days,
+		hour:   hour,
+		logger: logger.With("component", "retention"),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start runs the job in the background. RetentionDays <= 0 disables it.
+func (j *RetentionJob) Start() {
+	if j.days <= 0 {
+		j.logger.Info("retention disabled (RETENTION_DAYS=0)")
+		return
+	}
+
+	j.logger.Info("retention enabled", "days", j.days, "hour", j.hour)
+	go j.loop()
+}
+
+func (j *RetentionJob) Stop() {
+	select {
+	case <-j.stop:
+	default:
+		close(j.stop)
+	}
+}
+
+func (j *RetentionJob) loop() {
+	for {
+		next := nextRun(time.Now(), j.hour)
+		j.logger.Debug("next retention run", "at", next)
+
+		select {
+		case <-time.After(time.Until(next)):
+			j.RunOnce(time.Now())
+		case <-j.stop:
+			return
+		}
+	}
+}
+
+// RunOnce deletes everything older than now - RetentionDays
+func (j *RetentionJob) RunOnce(now time.Time) {
+	if !j.db.IsEnabled() {
+		j.logger.Warn("IoTDB not connected, skipping retention run")
+		return
+	}
+
+	cutoff := now.AddDate(0, 0, -j.days)
+	series, err := j.db.DeleteDataBefore(context.Background(), cutoff.UnixMilli())
+	if err != nil {
+		j.logger.Error("retention run failed", "cutoff", cutoff, "error", err)
+		return
+	}
+
+	j.logger.Info("retention run completed", "cutoff", cutoff, "series", series)
+}
+
+// nextRun returns the next time (after now) at hour:00 local time
+func nextRun(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
@@ -0,0 +1,302 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"wattwise/internal/database"
+	"wattwise/internal/models"
+)
+
+var ErrBackfillRunning = errors.New("a rollup backfill is already running")
+
+const hourMs = int64(time.Hour / time.Millisecond)
+
+// RollupJob keeps root.wattwise_rollup up to date: every run it summarizes
+// the complete hours since each device's high-water mark (see
+// models.HourlyRollup). Readings that arrive after their hour was rolled up
+// are only picked up by a backfill.
+type RollupJob struct {
+	db     *database.IoTDB
+	every  time.Duration
+	logger *slog.Logger
+	stop   chan struct{}
+
+	// deviceID -> Unix ms of the first hour that is not rolled up yet
+	mu        sync.Mutex
+	highWater map[string]int64
+
+	backfilling atomic.Bool
+}
+
+// NewRollupJob creates the job; intervalMinutes <= 0 disables it
+func NewRollupJob(db *database.IoTDB, intervalMinutes int, logger *slog.Logger) *RollupJob {
+	return &RollupJob{
+		db:        db,
+		every:     time.Duration(intervalMinutes) * time.Minute,
+		logger:    logger.With("component", "rollup"),
+		stop:      make(chan struct{}),
+		highWater: make(map[string]int64),
+	}
+}
+
+// Enabled reports whether rollups are computed (ROLLUP_INTERVAL_MINUTES > 0)
+func (j *RollupJob) Enabled() bool {
+	return j != nil && j.every > 0
+}
+
+func (j *RollupJob) Start() {
+	if !j.Enabled() {
+		j.logger.Info("hourly rollups disabled (ROLLUP_INTERVAL_MINUTES=0)")
+		return
+	}
+
+	j.logger.Info("hourly rollups enabled", "every", j.every)
+	go j.loop()
+}
+
+func (j *RollupJob) Stop() {
+	select {
+	case <-j.stop:
+	default:
+		close(j.stop)
+	}
+}
+
+func (j *RollupJob) loop() {
+	ticker := time.NewTicker(j.every)
+	defer ticker.Stop()
+
+	for {
+		j.RunOnce(time.Now())
+
+		select {
+		case <-ticker.C:
+		case <-j.stop:
+			return
+		}
+	}
+}
+
+// RunOnce rolls up every device's complete hours before now
+func (j *RollupJob) RunOnce(now time.Time) {
+	if !j.db.IsEnabled() {
+		j.logger.Debug("IoTDB not connected, skipping rollup run")
+		return
+	}
+
+	ctx := context.Background()
+	devices, err := j.db.ListDeviceIDs(ctx)
+	if err != nil {
+		j.logger.Error("failed to list devices", "error", err)
+		return
+	}
+
+	end := truncateHour(now.UnixMilli())
+	total := 0
+	for _, deviceID := range devices {
+		from, err := j.highWaterMark(ctx, deviceID)
+		if err != nil {
+			j.logger.Error("failed to read rollup high-water mark", "device_id", deviceID, "error", err)
+			continue
+		}
+		if from < 0 || from >= end {
+			continue
+		}
+
+		rows, err := j.rollupRange(ctx, deviceID, from, end)
+		total += rows
+		if err != nil {
+			// Device ini dicoba lagi di run berikutnya dari high-water mark terakhir
+			j.logger.Error("rollup failed", "device_id", deviceID, "error", err)
+		}
+	}
+
+	j.logger.Info("rollup run completed", "devices", len(devices), "until", time.UnixMilli(end), "hourly_rows", total)
+}
+
+// Coverage returns the Unix ms up to which a device's rollups are complete,
+// or -1 when it has none
+func (j *RollupJob) Coverage(ctx context.Context, deviceID string) (int64, error) {
+	if !j.Enabled() {
+		return -1, nil
+	}
+	return j.highWaterMark(ctx, deviceID)
+}
+
+// highWaterMark is loaded once per device: after the newest stored rollup,
+// or at the hour of the oldest raw reading for a device without rollups
+func (j *RollupJob) highWaterMark(ctx context.Context, deviceID string) (int64, error) {
+	j.mu.Lock()
+	hw, ok := j.highWater[deviceID]
+	j.mu.Unlock()
+	if ok {
+		return hw, nil
+	}
+
+	latest, err := j.db.LatestRollupHour(ctx, deviceID)
+	if err != nil {
+		return -1, err
+	}
+	if latest >= 0 {
+		hw = latest + hourMs
+	} else {
+		earliest, err := j.db.EarliestReading(ctx, deviceID)
+		if err != nil || earliest < 0 {
+			return -1, err
+		}
+		hw = truncateHour(earliest)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	// Backfill atau run lain bisa saja sudah lebih dulu
+	if current, ok := j.highWater[deviceID]; ok {
+		return current, nil
+	}
+	j.highWater[deviceID] = hw
+	return hw, nil
+}
+
+// advance moves the high-water mark to toMs if [fromMs, toMs) continues it
+func (j *RollupJob) advance(deviceID string, fromMs, toMs int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if hw, ok := j.highWater[deviceID]; ok && fromMs <= hw && toMs > hw {
+		j.highWater[deviceID] = toMs
+	}
+}
+
+// rollupRange writes the rollups of [fromMs, toMs) one day at a time and
+// advances the high-water mark after every written day
+func (j *RollupJob) rollupRange(ctx context.Context, deviceID string, fromMs, toMs int64) (int, error) {
+	const chunk = 24 * hourMs
+
+	total := 0
+	for start := fromMs; start < toMs; start += chunk {
+		end := min(start+chunk, toMs)
+
+		// Satu jam sebelumnya ikut dibaca untuk delta energi reading pertama
+		readings, err := j.db.GetDataByTimeRange(ctx, deviceID, start-hourMs, end-1)
+		if err != nil {
+			return total, err
+		}
+		rollups := BuildHourlyRollups(readings, start, end)
+		if err := j.db.WriteRollups(ctx, deviceID, rollups); err != nil {
+			return total, err
+		}
+
+		total += len(rollups)
+		j.advance(deviceID, start, end)
+	}
+	return total, nil
+}
+
+// Backfill recomputes the rollups of [from, to) in the background, for all
+// devices when devices is empty. to is capped at the last complete hour.
+// Only one backfill runs at a time (ErrBackfillRunning).
+func (j *RollupJob) Backfill(devices []string, from, to time.Time) ([]string, error) {
+	if !j.Enabled() || !j.db.IsEnabled() {
+		return nil, errors.New("hourly rollups are not available")
+	}
+	if !j.backfilling.CompareAndSwap(false, true) {
+		return nil, ErrBackfillRunning
+	}
+
+	if len(devices) == 0 {
+		ids, err := j.db.ListDeviceIDs(context.Background())
+		if err != nil {
+			j.backfilling.Store(false)
+			return nil, err
+		}
+		devices = ids
+	}
+
+	fromMs := truncateHour(from.UnixMilli())
+	toMs := min(to.UnixMilli(), truncateHour(time.Now().UnixMilli()))
+
+	go func() {
+		defer j.backfilling.Store(false)
+
+		ctx := context.Background()
+		total := 0
+		for _, deviceID := range devices {
+			// Dimuat dulu supaya backfill yang menyambung bisa memajukannya
+			if _, err := j.highWaterMark(ctx, deviceID); err != nil {
+				j.logger.Warn("failed to read rollup high-water mark", "device_id", deviceID, "error", err)
+			}
+
+			rows, err := j.rollupRange(ctx, deviceID, fromMs, toMs)
+			total += rows
+			if err != nil {
+				j.logger.Error("rollup backfill failed", "device_id", deviceID, "error", err)
+			}
+		}
+		j.logger.Info("rollup backfill completed", "devices", len(devices),
+			"from", time.UnixMilli(fromMs), "to", time.UnixMilli(toMs), "hourly_rows", total)
+	}()
+
+	return devices, nil
+}
+
+// BuildHourlyRollups summarizes the readings in [fromMs, toMs) per hour.
+// Readings in the hour before fromMs only contribute the energy delta of the
+// first reading in range; hours without readings are left out.
+func BuildHourlyRollups(readings []models.EnergyData, fromMs, toMs int64) []models.HourlyRollup {
+	byHour := make(map[int64]*models.HourlyRollup)
+	for _, r := range readings {
+		if r.Timestamp < fromMs || r.Timestamp >= toMs {
+			continue
+		}
+
+		hour := truncateHour(r.Timestamp)
+		h, ok := byHour[hour]
+		if !ok {
+			h = &models.HourlyRollup{
+				Hour:       hour,
+				PowerMin:   math.Inf(1),
+				PowerMax:   math.Inf(-1),
+				VoltageMin: math.Inf(1),
+				VoltageMax: math.Inf(-1),
+				CurrentMin: math.Inf(1),
+				CurrentMax: math.Inf(-1),
+			}
+			byHour[hour] = h
+		}
+
+		h.PowerMin = min(h.PowerMin, r.Power)
+		h.PowerMax = max(h.PowerMax, r.Power)
+		h.PowerAvg += r.Power
+		h.VoltageMin = min(h.VoltageMin, r.Voltage)
+		h.VoltageMax = max(h.VoltageMax, r.Voltage)
+		h.VoltageAvg += r.Voltage
+		h.CurrentMin = min(h.CurrentMin, r.Current)
+		h.CurrentMax = max(h.CurrentMax, r.Current)
+		h.CurrentAvg += r.Current
+		h.Samples++
+	}
+
+	energy := HourlyEnergy(readings)
+
+	rollups := make([]models.HourlyRollup, 0, len(byHour))
+	for hour, h := range byHour {
+		n := float64(h.Samples)
+		h.PowerAvg /= n
+		h.VoltageAvg /= n
+		h.CurrentAvg /= n
+		h.KWh = energy[hour]
+		rollups = append(rollups, *h)
+	}
+	sort.Slice(rollups, func(i, k int) bool { return rollups[i].Hour < rollups[k].Hour })
+	return rollups
+}
+
+func truncateHour(ms int64) int64 {
+	return ms - ms%hourMs
+}
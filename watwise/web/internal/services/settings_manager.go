@@ -0,0 +1,277 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"wattwise/internal/logger"
+	"wattwise/internal/models"
+	"wattwise/internal/repositories"
+)
+
+// ErrInvalidSettings wraps validation errors from SettingsManager.Update
+var ErrInvalidSettings = errors.New("invalid settings")
+
+// Sources of a settings change, see models.SettingsChangedEvent
+const (
+	SettingsSourceAPI    = "api"
+	SettingsSourceReload = "reload"
+)
+
+// SettingsBroadcaster announces changed settings (*handlers.WebSocketHandler)
+type SettingsBroadcaster interface {
+	BroadcastSettingsChanged(event models.SettingsChangedEvent)
+}
+
+// SettingsManager owns the runtime settings: base values from .env (re-read
+// on Reload) with the overrides of SettingsRepository on top. Every change is
+// pushed into the services that use it (tariff, alert bounds and toggles, log
+// level), logged as a diff and broadcast.
+type SettingsManager struct {
+	repo   *repositories.SettingsRepository
+	reload func() models.RuntimeSettings
+	tariff *TariffService
+	energy *EnergyService
+	logger *slog.Logger
+
+	mu      sync.RWMutex
+	base    models.RuntimeSettings
+	current models.RuntimeSettings
+
+	// Optional, see SetBroadcaster
+	broadcaster SettingsBroadcaster
+}
+
+// NewSettingsManager applies base plus the stored overrides. reload returns
+// the new base for Reload, typically by re-reading .env.
+func NewSettingsManager(repo *repositories.SettingsRepository, base models.RuntimeSettings, reload func() models.RuntimeSettings, tariff *TariffService, energy *EnergyService, logger *slog.Logger) (*SettingsManager, error) {
+	m := &SettingsManager{
+		repo:   repo,
+		reload: reload,
+		tariff: tariff,
+		energy: energy,
+		logger: logger.With("component", "settings"),
+	}
+
+	m.base = base
+	current, err := mergeSettings(m.base, repo.Overrides())
+	if err != nil {
+		return nil, err
+	}
+	m.current = current
+	m.apply(current)
+	return m, nil
+}
+
+// SetBroadcaster announces changes over WebSocket/SSE
+func (m *SettingsManager) SetBroadcaster(broadcaster SettingsBroadcaster) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.broadcaster = broadcaster
+}
+
+// Current returns the effective settings
+func (m *SettingsManager) Current() models.RuntimeSettings {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.current
+}
+
+// Overrides returns the settings changed through the API
+func (m *SettingsManager) Overrides() map[string]json.RawMessage {
+	return m.repo.Overrides()
+}
+
+// Update merges patch (setting name to value, null removes the override so
+// the .env value applies again) into the stored overrides and applies it.
+func (m *SettingsManager) Update(patch map[string]json.RawMessage, by string) (models.RuntimeSettings, []models.SettingChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	overrides := m.repo.Overrides()
+	for key, value := range patch {
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			delete(overrides, key)
+			continue
+		}
+		overrides[key] = value
+	}
+
+	next, err := mergeSettings(m.base, overrides)
+	if err != nil {
+		return m.current, nil, err
+	}
+	if err := m.repo.Replace(overrides); err != nil {
+		return m.current, nil, fmt.Errorf("save settings: %w", err)
+	}
+
+	changes := m.switchTo(next, SettingsSourceAPI, by)
+	return next, changes, nil
+}
+
+// Reload re-reads .env (through reload) and the overrides file. Invalid
+// settings are rejected and the current ones kept.
+func (m *SettingsManager) Reload() ([]models.SettingChange, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.repo.Load(); err != nil {
+		return nil, err
+	}
+	base := m.reload()
+	next, err := mergeSettings(base, m.repo.Overrides())
+	if err != nil {
+		return nil, err
+	}
+
+	m.base = base
+	return m.switchTo(next, SettingsSourceReload, ""), nil
+}
+
+// switchTo applies next and announces what changed; must be called with m.mu
+// held
+func (m *SettingsManager) switchTo(next models.RuntimeSettings, source, by string) []models.SettingChange {
+	changes := diffSettings(m.current, next)
+	if len(changes) == 0 {
+		m.logger.Info("settings unchanged", "source", source)
+		return changes
+	}
+
+	m.current = next
+	m.apply(next)
+	for _, change := range changes {
+		m.logger.Info("setting changed", "key", change.Key, "old", change.Old, "new", change.New, "source", source, "by", by)
+	}
+
+	if m.broadcaster != nil {
+		m.broadcaster.BroadcastSettingsChanged(models.SettingsChangedEvent{
+			Type:      "settings_changed",
+			Source:    source,
+			By:        by,
+			Changes:   changes,
+			Timestamp: time.Now().UnixMilli(),
+		})
+	}
+	return changes
+}
+
+// apply pushes settings into the services that read them
+func (m *SettingsManager) apply(s models.RuntimeSettings) {
+	logger.SetLevel(s.LogLevel)
+
+	m.tariff.SetPerKWh(s.TariffPerKWh)
+	m.tariff.SetTimeOfUse(s.TariffPeakPerKWh, s.TariffPeakStartHour, s.TariffPeakEndHour)
+
+	m.energy.SetAlertThresholds(AlertThresholds{
+		MaxPower:          s.AlertMaxPower,
+		MaxCurrent:        s.AlertMaxCurrent,
+		MinVoltage:        s.AlertMinVoltage,
+		MaxVoltage:        s.AlertMaxVoltage,
+		MinPowerFactor:    s.AlertMinPowerFactor,
+		MinFrequency:      s.AlertMinFrequency,
+		MaxFrequency:      s.AlertMaxFrequency,
+		SustainedReadings: s.AlertSustainedReadings,
+	})
+	m.energy.SetAlertToggles(AlertToggles{
+		Threshold: s.ThresholdAlerts,
+		Quality:   s.QualityAlerts,
+		Anomaly:   s.AnomalyAlerts,
+		Budget:    s.BudgetAlerts,
+	})
+}
+
+// mergeSettings lays overrides over base by JSON name; unknown names and
+// wrongly typed values are rejected
+func mergeSettings(base models.RuntimeSettings, overrides map[string]json.RawMessage) (models.RuntimeSettings, error) {
+	raw, err := json.Marshal(base)
+	if err != nil {
+		return base, err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return base, err
+	}
+
+	for key, value := range overrides {
+		if _, ok := fields[key]; !ok {
+			return base, fmt.Errorf("%w: unknown setting %q", ErrInvalidSettings, key)
+		}
+		fields[key] = value
+	}
+
+	raw, err = json.Marshal(fields)
+	if err != nil {
+		return base, fmt.Errorf("%w: %v", ErrInvalidSettings, err)
+	}
+	var merged models.RuntimeSettings
+	if err := json.Unmarshal(raw, &merged); err != nil {
+		return base, fmt.Errorf("%w: %v", ErrInvalidSettings, err)
+	}
+	if err := validateSettings(merged); err != nil {
+		return base, err
+	}
+	return merged, nil
+}
+
+func validateSettings(s models.RuntimeSettings) error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(slices.Contains([]string{"debug", "info", "warn", "warning", "error"}, strings.ToLower(s.LogLevel)),
+		"log_level must be debug, info, warn or error")
+	check(s.TariffPerKWh >= 0, "tariff_per_kwh must be >= 0")
+	check(s.TariffPeakPerKWh >= 0, "tariff_peak_per_kwh must be >= 0")
+	check(s.TariffPeakStartHour >= 0 && s.TariffPeakStartHour <= 24, "tariff_peak_start_hour must be 0-24")
+	check(s.TariffPeakEndHour >= 0 && s.TariffPeakEndHour <= 24, "tariff_peak_end_hour must be 0-24")
+	check(s.AlertMaxPower > 0, "alert_max_power must be > 0")
+	check(s.AlertMaxCurrent > 0, "alert_max_current must be > 0")
+	check(s.AlertMinVoltage >= 0 && s.AlertMinVoltage < s.AlertMaxVoltage, "alert_min_voltage must be >= 0 and below alert_max_voltage")
+	check(s.AlertMinPowerFactor >= 0 && s.AlertMinPowerFactor <= 1, "alert_min_power_factor must be 0-1")
+	check(s.AlertMinFrequency >= 0 && s.AlertMaxFrequency >= 0, "alert frequencies must be >= 0")
+	check(s.AlertMinFrequency == 0 || s.AlertMaxFrequency == 0 || s.AlertMinFrequency < s.AlertMaxFrequency,
+		"alert_min_frequency must be below alert_max_frequency")
+	check(s.AlertSustainedReadings >= 1, "alert_sustained_readings must be >= 1")
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidSettings, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// diffSettings lists the settings that differ, sorted by name
+func diffSettings(old, next models.RuntimeSettings) []models.SettingChange {
+	before, after := settingsFields(old), settingsFields(next)
+
+	keys := make([]string, 0, len(after))
+	for key := range after {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	changes := []models.SettingChange{}
+	for _, key := range keys {
+		if !reflect.DeepEqual(before[key], after[key]) {
+			changes = append(changes, models.SettingChange{Key: key, Old: before[key], New: after[key]})
+		}
+	}
+	return changes
+}
+
+func settingsFields(s models.RuntimeSettings) map[string]interface{} {
+	fields := make(map[string]interface{})
+	raw, _ := json.Marshal(s)
+	_ = json.Unmarshal(raw, &fields)
+	return fields
+}
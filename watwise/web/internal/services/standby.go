@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"wattwise/internal/models"
+)
+
+// Night window for standby detection, see SetStandbyWindow
+const (
+	DefaultStandbyStartHour  = 1
+	DefaultStandbyEndHour    = 5
+	DefaultStandbyMinSamples = 30
+
+	standbyPercentile = 0.05
+	standbyMonthDays  = 30
+)
+
+// SetStandbyWindow sets the local hours [startHour, endHour) searched for
+// standby power (endHour <= startHour wraps past midnight) and how many
+// readings a night needs to count
+func (s *EnergyService) SetStandbyWindow(startHour, endHour, minSamples int) {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	s.standbyStart, s.standbyEnd = startHour, endHour
+	s.standbyMinSamples = max(minSamples, 1)
+}
+
+func (s *EnergyService) standbyWindow() (startHour, endHour, minSamples int) {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.standbyStart, s.standbyEnd, s.standbyMinSamples
+}
+
+// ComputeStandbyPower estimates deviceID's standby power from the last days
+// completed night windows before now; now's location decides the hours
+func (s *EnergyService) ComputeStandbyPower(ctx context.Context, deviceID string, days int, now time.Time) (*models.StandbyReport, error) {
+	startHour, endHour, _ := s.standbyWindow()
+
+	last := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if _, end := nightWindow(last, startHour, endHour); end.After(now) {
+		last = last.AddDate(0, 0, -1)
+	}
+	return s.standbyReport(ctx, deviceID, last.AddDate(0, 0, -(days-1)), last, now)
+}
+
+// standbyReport covers the night windows starting on first through last
+// (midnights) that ended by now
+func (s *EnergyService) standbyReport(ctx context.Context, deviceID string, first, last, now time.Time) (*models.StandbyReport, error) {
+	startHour, endHour, minSamples := s.standbyWindow()
+	report := &models.StandbyReport{
+		DeviceID:        deviceID,
+		WindowStartHour: startHour,
+		WindowEndHour:   endHour,
+		MinSamples:      minSamples,
+		Nights:          []models.StandbyNight{},
+	}
+
+	var pooled []float64
+	for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+		start, end := nightWindow(d, startHour, endHour)
+		if end.After(now) {
+			break
+		}
+		report.Days++
+
+		readings, err := s.db.GetDataByTimeRange(ctx, deviceID, start.UnixMilli(), end.UnixMilli()-1)
+		if err != nil {
+			s.logger.Error("standby query failed", "device_id", deviceID, "date", d.Format("2006-01-02"), "error", err)
+			return nil, err
+		}
+
+		night := models.StandbyNight{
+			Date:    d.Format("2006-01-02"),
+			Start:   start,
+			End:     end,
+			Samples: len(readings),
+		}
+		if len(readings) < minSamples {
+			night.Excluded = true
+			night.Reason = fmt.Sprintf("insufficient samples: %d of %d", len(readings), minSamples)
+			report.Nights = append(report.Nights, night)
+			continue
+		}
+
+		powers := make([]float64, len(readings))
+		for i, r := range readings {
+			powers[i] = r.Power
+		}
+		sort.Float64s(powers)
+		night.StandbyPower = percentile(powers, standbyPercentile)
+
+		pooled = append(pooled, powers...)
+		report.NightsUsed++
+		report.Nights = append(report.Nights, night)
+	}
+
+	if len(pooled) > 0 {
+		sort.Float64s(pooled)
+		report.StandbyPower = percentile(pooled, standbyPercentile)
+		report.Samples = len(pooled)
+	}
+	report.MonthlyKWh = report.StandbyPower * 24 * standbyMonthDays / 1000
+	report.MonthlyCost = s.tariff.Cost(report.MonthlyKWh)
+	report.MonthlyCostMoney = s.tariff.Money(report.MonthlyCost)
+	return report, nil
+}
+
+// nightWindow returns the window starting on day (a midnight)
+func nightWindow(day time.Time, startHour, endHour int) (time.Time, time.Time) {
+	start := time.Date(day.Year(), day.Month(), day.Day(), startHour, 0, 0, 0, day.Location())
+	end := time.Date(day.Year(), day.Month(), day.Day(), endHour, 0, 0, 0, day.Location())
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+	"wattwise/internal/models"
+)
+
+// SummaryCache keeps computed monthly summaries per device, month and zone.
+// A month needs one range query per day, so repeated dashboard loads are
+// served from memory. Past months live for ttl; the current month, which
+// still grows, only for currentTTL. Saves and deletes drop the months they
+// touch.
+type SummaryCache struct {
+	ttl        time.Duration
+	currentTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*summaryEntry
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type summaryEntry struct {
+	summary  *models.MonthlySummary
+	deviceID string
+	from, to int64 // Unix ms, [from, to)
+	expires  time.Time
+}
+
+// NewSummaryCache returns a cache, or nil (caching off) when ttl <= 0.
+// currentTTL <= 0 never caches the current month.
+func NewSummaryCache(ttl, currentTTL time.Duration) *SummaryCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &SummaryCache{
+		ttl:        ttl,
+		currentTTL: currentTTL,
+		entries:    make(map[string]*summaryEntry),
+	}
+}
+
+func summaryKey(deviceID string, monthStart time.Time) string {
+	return deviceID + "|" + monthStart.Format("2006-01") + "|" + monthStart.Location().String()
+}
+
+// Get returns a live summary and counts the hit or miss. Safe on a nil cache.
+func (c *SummaryCache) Get(deviceID string, monthStart time.Time) (*models.MonthlySummary, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	key := summaryKey(deviceID, monthStart)
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	return entry.summary, true
+}
+
+// Set stores the summary of the month starting at monthStart
+func (c *SummaryCache) Set(deviceID string, monthStart time.Time, summary *models.MonthlySummary) {
+	if c == nil {
+		return
+	}
+
+	now := time.Now()
+	monthEnd := monthStart.AddDate(0, 1, 0)
+	ttl := c.ttl
+	if now.Before(monthEnd) {
+		ttl = c.currentTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= maxCachedResponses {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if len(c.entries) < maxCachedResponses {
+		c.entries[summaryKey(deviceID, monthStart)] = &summaryEntry{
+			summary:  summary,
+			deviceID: deviceID,
+			from:     monthStart.UnixMilli(),
+			to:       monthEnd.UnixMilli(),
+			expires:  now.Add(ttl),
+		}
+	}
+}
+
+// InvalidateRange drops deviceID's months overlapping [fromMs, toMs)
+func (c *SummaryCache) InvalidateRange(deviceID string, fromMs, toMs int64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, e := range c.entries {
+		if e.deviceID == deviceID && e.from < toMs && fromMs < e.to {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Flush drops every entry and returns how many there were. Safe on a nil cache.
+func (c *SummaryCache) Flush() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.entries)
+	c.entries = make(map[string]*summaryEntry)
+	return n
+}
+
+// Stats returns hit/miss counters and the current size. Safe on a nil cache.
+func (c *SummaryCache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	return CacheStats{
+		Enabled:                true,
+		TTLSeconds:             int(c.ttl.Seconds()),
+		CurrentMonthTTLSeconds: int(c.currentTTL.Seconds()),
+		Entries:                entries,
+		Hits:                   c.hits.Load(),
+		Misses:                 c.misses.Load(),
+	}
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"wattwise/internal/database"
+)
+
+func TestMonthlySummaryNotCachedOnError(t *testing.T) {
+	store := &flakyStore{MemoryStore: database.NewMemoryStore()}
+	service := newTestService(store)
+	cache := NewSummaryCache(time.Hour, time.Minute)
+	service.SetSummaryCache(cache)
+
+	month := time.Date(2025, 1, 1, 0, 0, 0, 0, testLocation)
+	seed(t, store, "A", reading(month.Add(8*time.Hour), 100, 1.0), reading(month.Add(9*time.Hour), 100, 1.5))
+
+	// Gangguan sesaat tidak boleh menyimpan bulan berisi 0 kWh
+	store.err = &database.TransientError{Attempts: 3, Err: errors.New("connection refused")}
+	if _, err := service.GetMonthlySummary(context.Background(), "A", month); !database.IsTransient(err) {
+		t.Fatalf("err = %v, want the transient error", err)
+	}
+	if entries := cache.Stats().Entries; entries != 0 {
+		t.Fatalf("%d cached summaries after a failed query, want 0", entries)
+	}
+
+	store.err = nil
+	summary, err := service.GetMonthlySummary(context.Background(), "A", month)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.TotalEnergy != 0.5 {
+		t.Errorf("TotalEnergy = %v, want 0.5", summary.TotalEnergy)
+	}
+	if entries := cache.Stats().Entries; entries != 1 {
+		t.Errorf("%d cached summaries, want 1", entries)
+	}
+}
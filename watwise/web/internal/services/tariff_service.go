@@ -0,0 +1,119 @@
+package services
+
+import (
+	"sync"
+	"wattwise/internal/models"
+)
+
+// DefaultTariffPerKWh adalah tarif PLN (Rp per kWh) kalau TARIFF_PER_KWH tidak di-set
+const DefaultTariffPerKWh = 1450.0
+
+// Time-of-use blocks, see TariffService.SetTimeOfUse
+const (
+	BlockPeak    = "peak"
+	BlockOffPeak = "off_peak"
+)
+
+// TariffService converts consumption into cost. Rates may change at runtime
+// (SettingsManager), so they are read through the getters.
+type TariffService struct {
+	mu       sync.RWMutex
+	perKWh   float64
+	currency models.Currency
+
+	peakPerKWh float64 // 0 = flat rate
+	peakStart  int
+	peakEnd    int
+}
+
+func NewTariffService(perKWh float64) *TariffService {
+	if perKWh <= 0 {
+		perKWh = DefaultTariffPerKWh
+	}
+	return &TariffService{perKWh: perKWh, currency: models.DefaultCurrency}
+}
+
+// SetPerKWh replaces the flat (off-peak) rate; <= 0 means DefaultTariffPerKWh
+func (t *TariffService) SetPerKWh(perKWh float64) {
+	if perKWh <= 0 {
+		perKWh = DefaultTariffPerKWh
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.perKWh = perKWh
+}
+
+// SetCurrency replaces models.DefaultCurrency for Money; an empty code keeps
+// the default
+func (t *TariffService) SetCurrency(code, symbol string, decimals int) {
+	if code == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.currency = models.Currency{Code: code, Symbol: symbol, Decimals: decimals}
+}
+
+// Currency returns the currency costs are expressed in
+func (t *TariffService) Currency() models.Currency {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.currency
+}
+
+// Money wraps a cost in the configured currency
+func (t *TariffService) Money(amount float64) models.Money {
+	return t.Currency().Money(amount)
+}
+
+// PerKWh returns the flat rate
+func (t *TariffService) PerKWh() float64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.perKWh
+}
+
+// Cost returns the cost of kwh
+func (t *TariffService) Cost(kwh float64) float64 {
+	return kwh * t.PerKWh()
+}
+
+// SetTimeOfUse enables a peak rate from startHour up to endHour; endHour <
+// startHour wraps past midnight. peakPerKWh <= 0 or startHour == endHour keeps
+// the flat rate.
+func (t *TariffService) SetTimeOfUse(peakPerKWh float64, startHour, endHour int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if peakPerKWh <= 0 || startHour == endHour {
+		t.peakPerKWh = 0
+		return
+	}
+	t.peakPerKWh = peakPerKWh
+	t.peakStart = startHour
+	t.peakEnd = endHour
+}
+
+// TimeOfUse reports whether a peak rate is configured
+func (t *TariffService) TimeOfUse() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.peakPerKWh > 0
+}
+
+// PeakHours returns the configured peak window [start, end) in local hours
+func (t *TariffService) PeakHours() (start, end int) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.peakStart, t.peakEnd
+}
+
+// BlockRate returns the rate of a time-of-use block
+func (t *TariffService) BlockRate(block string) float64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if block == BlockPeak && t.peakPerKWh > 0 {
+		return t.peakPerKWh
+	}
+	return t.perKWh
+}
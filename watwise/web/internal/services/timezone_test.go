@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+	"wattwise/internal/database"
+	"wattwise/internal/models"
+)
+
+// newYork has DST: 2025-03-09 has 23 hours, 2025-11-02 has 25
+func newYork(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no tz database: %v", err)
+	}
+	return loc
+}
+
+// hourlyReadings is one reading per real hour from start to end, the energy
+// counter rising 0.1 kWh each
+func hourlyReadings(start, end time.Time) []models.EnergyData {
+	var readings []models.EnergyData
+	kwh := 0.0
+	for ts := start; ts.Before(end); ts = ts.Add(time.Hour) {
+		readings = append(readings, reading(ts.Add(30*time.Minute), 100, kwh))
+		kwh += 0.1
+	}
+	return readings
+}
+
+func TestDailySummariesAcrossDST(t *testing.T) {
+	loc := newYork(t)
+
+	tests := []struct {
+		name  string
+		first time.Time
+		hours []int // readings per day
+	}{
+		{"spring forward", time.Date(2025, 3, 8, 0, 0, 0, 0, loc), []int{24, 23, 24}},
+		{"fall back", time.Date(2025, 11, 1, 0, 0, 0, 0, loc), []int{24, 25, 24}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := database.NewMemoryStore()
+			service := newTestService(store)
+			seed(t, store, "A", hourlyReadings(tt.first, tt.first.AddDate(0, 0, len(tt.hours)))...)
+
+			summaries, err := service.CalculateDailySummaries(context.Background(), "A", tt.first, len(tt.hours))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, hours := range tt.hours {
+				date := tt.first.AddDate(0, 0, i).Format("2006-01-02")
+				if summaries[i].Date != date {
+					t.Errorf("day %d = %s, want %s", i, summaries[i].Date, date)
+				}
+				// Satu kenaikan per jam; hari pertama tidak punya reading
+				// sebelumnya, jadi hours-1
+				increases := hours
+				if i == 0 {
+					increases--
+				}
+				want := float64(increases) * 0.1
+				if math.Abs(summaries[i].TotalEnergy-want) > 1e-9 {
+					t.Errorf("%s: %v kWh, want %v (%d hours)", date, summaries[i].TotalEnergy, want, hours)
+				}
+			}
+		})
+	}
+}
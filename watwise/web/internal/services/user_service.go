@@ -2,42 +2,171 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
 	"wattwise/internal/models"
+	"wattwise/internal/repositories"
+	"wattwise/internal/utils"
+)
+
+var validUsername = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,32}$`)
+
+var (
+	// ErrInvalidUser wraps validation errors from Create/Update
+	ErrInvalidUser = errors.New("invalid user")
+	// ErrLastAdmin is returned when a change would leave no admin account
+	ErrLastAdmin = errors.New("at least one admin account is required")
 )
 
 type UserService struct {
+	repo   *repositories.UserRepository
+	logger *slog.Logger
+
+	// Hash checked for unknown users so they take as long as wrong passwords
+	dummyOnce sync.Once
+	dummyHash string
+}
+
+// NewUserService seeds the default admin account (admin/admin123) when the
+// store has no accounts yet, so a fresh instance can always be logged into.
+// Change its password after the first login.
+func NewUserService(repo *repositories.UserRepository, logger *slog.Logger) *UserService {
+	s := &UserService{
+		repo:   repo,
+		logger: logger.With("component", "user_service"),
+	}
+	if len(repo.List()) == 0 {
+		if _, err := s.Create(models.UserInput{
+			Username: "admin",
+			Email:    "admin@wattwise.com",
+			Password: "admin123",
+			Role:     models.RoleAdmin,
+		}); err != nil {
+			s.logger.Error("failed to seed default admin", "error", err)
+		}
+	}
+	return s
+}
+
+// Authenticate checks a username/password pair against the stored hash
+func (s *UserService) Authenticate(username, password string) (models.User, bool) {
+	user, hash, err := s.repo.PasswordHash(username)
+	if err != nil {
+		s.dummyOnce.Do(func() { s.dummyHash, _ = utils.HashPassword("\x00unknown-user") })
+		utils.CheckPassword(s.dummyHash, password)
+		return models.User{}, false
+	}
+	if !utils.CheckPassword(hash, password) {
+		return models.User{}, false
+	}
+	return user, true
 }
 
-func NewUserService() *UserService {
-	return &UserService{}
+func (s *UserService) List() []models.User {
+	return s.repo.List()
 }
 
-// GetUserByID retrieves user by ID
-func (s *UserService) GetUserByID(userID int) (*models.User, error) {
-	// TODO: Implement database query
-	return nil, errors.New("not implemented")
+func (s *UserService) Get(username string) (models.User, error) {
+	return s.repo.Get(username)
 }
 
-// CreateUser creates a new user
-func (s *UserService) CreateUser(user *models.User) error {
-	// TODO: Implement user creation
-	return errors.New("not implemented")
+// Create adds a user. Role defaults to viewer, email to <username>@wattwise.com.
+func (s *UserService) Create(input models.UserInput) (models.User, error) {
+	input.Username = strings.TrimSpace(input.Username)
+	if !validUsername.MatchString(input.Username) {
+		return models.User{}, fmt.Errorf("%w: username %q must be 3-32 letters, digits, '_', '.' or '-'", ErrInvalidUser, input.Username)
+	}
+	if input.Password == "" {
+		return models.User{}, fmt.Errorf("%w: password is required", ErrInvalidUser)
+	}
+	if input.Role == "" {
+		input.Role = models.RoleViewer
+	}
+	if !models.ValidRole(input.Role) {
+		return models.User{}, fmt.Errorf("%w: role must be %q or %q, got %q", ErrInvalidUser, models.RoleAdmin, models.RoleViewer, input.Role)
+	}
+	if input.Email == "" {
+		input.Email = input.Username + "@wattwise.com"
+	}
+
+	hash, err := utils.HashPassword(input.Password)
+	if err != nil {
+		return models.User{}, fmt.Errorf("hash password: %w", err)
+	}
+	user, err := s.repo.Create(models.User{
+		Username: input.Username,
+		Email:    input.Email,
+		Role:     input.Role,
+	}, hash)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	s.logger.Info("user created", "username", user.Username, "role", user.Role)
+	return user, nil
 }
 
-// UpdateUser updates user information
-func (s *UserService) UpdateUser(userID int, user *models.User) error {
-	// TODO: Implement user update
-	return errors.New("not implemented")
+// Update changes a user's email, password and/or role; empty fields are kept.
+// The last admin cannot be demoted.
+func (s *UserService) Update(username string, input models.UserInput) (models.User, error) {
+	user, err := s.repo.Get(username)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if input.Role != "" {
+		if !models.ValidRole(input.Role) {
+			return models.User{}, fmt.Errorf("%w: role must be %q or %q, got %q", ErrInvalidUser, models.RoleAdmin, models.RoleViewer, input.Role)
+		}
+		if user.Role == models.RoleAdmin && input.Role != models.RoleAdmin && s.admins() == 1 {
+			return models.User{}, ErrLastAdmin
+		}
+		user.Role = input.Role
+	}
+	if input.Email != "" {
+		user.Email = input.Email
+	}
+
+	var hash string
+	if input.Password != "" {
+		if hash, err = utils.HashPassword(input.Password); err != nil {
+			return models.User{}, fmt.Errorf("hash password: %w", err)
+		}
+	}
+	if err := s.repo.Update(user, hash); err != nil {
+		return models.User{}, err
+	}
+
+	s.logger.Info("user updated", "username", user.Username, "role", user.Role, "password_changed", input.Password != "")
+	return user, nil
 }
 
-// DeleteUser deletes a user
-func (s *UserService) DeleteUser(userID int) error {
-	// TODO: Implement user deletion
-	return errors.New("not implemented")
+// Delete removes a user; the last admin cannot be deleted
+func (s *UserService) Delete(username string) error {
+	user, err := s.repo.Get(username)
+	if err != nil {
+		return err
+	}
+	if user.Role == models.RoleAdmin && s.admins() == 1 {
+		return ErrLastAdmin
+	}
+
+	if err := s.repo.Delete(username); err != nil {
+		return err
+	}
+	s.logger.Info("user deleted", "username", username)
+	return nil
 }
 
-// AuthenticateUser authenticates user credentials
-func (s *UserService) AuthenticateUser(username, password string) (*models.User, string, error) {
-	// TODO: Implement authentication
-	return nil, "", errors.New("not implemented")
+func (s *UserService) admins() int {
+	n := 0
+	for _, u := range s.repo.List() {
+		if u.Role == models.RoleAdmin {
+			n++
+		}
+	}
+	return n
 }
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// Revoked token ids are kept in memory until the token would have expired
+// anyway; after that the signature check rejects it and the entry is dropped.
+// A restart forgets revocations, which is bounded by the token lifetimes.
+const blacklistSweepInterval = time.Minute
+
+var blacklist = &tokenBlacklist{revoked: make(map[string]time.Time)}
+
+type tokenBlacklist struct {
+	mu        sync.Mutex
+	revoked   map[string]time.Time // token id -> expiry
+	lastSweep time.Time
+}
+
+func (b *tokenBlacklist) add(id string, expiresAt time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.sweep(now)
+	if expiresAt.After(now) {
+		b.revoked[id] = expiresAt
+	}
+}
+
+func (b *tokenBlacklist) contains(id string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sweep(time.Now())
+	_, ok := b.revoked[id]
+	return ok
+}
+
+// sweep drops expired entries, at most once per blacklistSweepInterval
+func (b *tokenBlacklist) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < blacklistSweepInterval {
+		return
+	}
+	b.lastSweep = now
+	for id, expiresAt := range b.revoked {
+		if !expiresAt.After(now) {
+			delete(b.revoked, id)
+		}
+	}
+}
@@ -1,30 +1,97 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"time"
+	"wattwise/internal/models"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 var (
-	// Secret key - in production, use environment variable
-	jwtSecret = []byte("wattwise-secret-key-change-in-production")
+	// Kunci HMAC dari JWT_SECRET, lihat SetJWTSecret. Kosong = semua token ditolak
+	jwtSecret []byte
+
+	// Access token pendek, refresh token untuk minta access token baru
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// Token types, stored in the "typ" claim
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+var (
+	ErrTokenRevoked   = errors.New("token has been revoked")
+	ErrWrongTokenType = errors.New("wrong token type")
+	ErrNoJWTSecret    = errors.New("JWT secret is not set")
 )
 
 type Claims struct {
 	Username string `json:"username"`
+	Role     string `json:"role,omitempty"` // access tokens only
+	Type     string `json:"typ,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken creates a new JWT token for a user
-func GenerateToken(username string) (string, error) {
+// SetJWTSecret sets the key tokens are signed and verified with (JWT_SECRET).
+// Until it is called no token can be issued or validated. Call before
+// serving requests.
+func SetJWTSecret(secret []byte) {
+	jwtSecret = secret
+}
+
+// SetTokenTTL overrides the access and refresh token lifetimes (<= 0 keeps
+// the current value). Call before serving requests.
+func SetTokenTTL(access, refresh time.Duration) {
+	if access > 0 {
+		accessTokenTTL = access
+	}
+	if refresh > 0 {
+		refreshTokenTTL = refresh
+	}
+}
+
+// AccessTokenTTL returns the lifetime of tokens from GenerateToken
+func AccessTokenTTL() time.Duration {
+	return accessTokenTTL
+}
+
+// GenerateToken creates a new short-lived access token for a user
+func GenerateToken(username, role string) (string, error) {
+	return generateToken(username, role, TokenTypeAccess, accessTokenTTL)
+}
+
+// GenerateRefreshToken creates a refresh token, accepted only by
+// ValidateRefreshToken
+func GenerateRefreshToken(username string) (string, error) {
+	return generateToken(username, "", TokenTypeRefresh, refreshTokenTTL)
+}
+
+func generateToken(username, role, tokenType string, ttl time.Duration) (string, error) {
+	if len(jwtSecret) == 0 {
+		return "", ErrNoJWTSecret
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
 	claims := Claims{
 		Username: username,
+		Role:     role,
+		Type:     tokenType,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // Token valid for 24 hours
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        hex.EncodeToString(id), // dipakai untuk revoke saat logout
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
 
@@ -32,8 +99,64 @@ func GenerateToken(username string) (string, error) {
 	return token.SignedString(jwtSecret)
 }
 
-// ValidateToken validates JWT token and returns username
-func ValidateToken(tokenString string) (string, error) {
+// ValidateToken validates an access token and returns username and role.
+// Token lama tanpa "role" dianggap viewer.
+func ValidateToken(tokenString string) (username, role string, err error) {
+	claims, err := validate(tokenString, TokenTypeAccess)
+	if err != nil {
+		return "", "", err
+	}
+	role = claims.Role
+	if role == "" {
+		role = models.RoleViewer
+	}
+	return claims.Username, role, nil
+}
+
+// ValidateRefreshToken validates a refresh token and returns username
+func ValidateRefreshToken(tokenString string) (string, error) {
+	claims, err := validate(tokenString, TokenTypeRefresh)
+	if err != nil {
+		return "", err
+	}
+	return claims.Username, nil
+}
+
+// RevokeToken blacklists a valid token until it expires. Tokens that are
+// already invalid or expired need no revoking and are ignored.
+func RevokeToken(tokenString string) {
+	claims, err := parse(tokenString)
+	if err != nil || claims.ID == "" || claims.ExpiresAt == nil {
+		return
+	}
+	blacklist.add(claims.ID, claims.ExpiresAt.Time)
+}
+
+func validate(tokenString, tokenType string) (*Claims, error) {
+	claims, err := parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Token lama tanpa "typ" dianggap access token
+	typ := claims.Type
+	if typ == "" {
+		typ = TokenTypeAccess
+	}
+	if typ != tokenType {
+		return nil, ErrWrongTokenType
+	}
+	if claims.ID != "" && blacklist.contains(claims.ID) {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+func parse(tokenString string) (*Claims, error) {
+	if len(jwtSecret) == 0 {
+		return nil, ErrNoJWTSecret
+	}
+
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		// Verify signing method
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -43,12 +166,12 @@ func ValidateToken(tokenString string) (string, error) {
 	})
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims.Username, nil
+		return claims, nil
 	}
 
-	return "", errors.New("invalid token")
+	return nil, errors.New("invalid token")
 }
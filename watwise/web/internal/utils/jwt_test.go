@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"wattwise/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultSecret is the JWT_SECRET fallback (config.DefaultJWTSecret), public
+// in the source
+const defaultSecret = "wattwise-secret-key-change-in-production"
+
+func withSecret(t *testing.T, secret string) {
+	t.Helper()
+	previous := jwtSecret
+	SetJWTSecret([]byte(secret))
+	t.Cleanup(func() { jwtSecret = previous })
+}
+
+func signClaims(t *testing.T, secret string, claims Claims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return token
+}
+
+func accessClaims(username, role string) Claims {
+	now := time.Now()
+	return Claims{
+		Username: username,
+		Role:     role,
+		Type:     TokenTypeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+}
+
+func TestGenerateTokenRoundTrip(t *testing.T) {
+	withSecret(t, "test-secret")
+
+	token, err := GenerateToken("alice", models.RoleAdmin)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	username, role, err := ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if username != "alice" || role != models.RoleAdmin {
+		t.Errorf("got %q/%q, want alice/admin", username, role)
+	}
+}
+
+func TestValidateTokenMissingRoleIsViewer(t *testing.T) {
+	withSecret(t, "test-secret")
+
+	_, role, err := ValidateToken(signClaims(t, "test-secret", accessClaims("bob", "")))
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if role != models.RoleViewer {
+		t.Errorf("role = %q, want %q", role, models.RoleViewer)
+	}
+}
+
+func TestValidateTokenRejectsForgedClaims(t *testing.T) {
+	withSecret(t, "test-secret")
+
+	genuine, err := GenerateToken("bob", models.RoleViewer)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	// Payload diganti ke role admin, signature lama dipertahankan
+	parts := strings.Split(genuine, ".")
+	forgedPayload := strings.Split(signClaims(t, "other", accessClaims("bob", models.RoleAdmin)), ".")[1]
+	tampered := parts[0] + "." + forgedPayload + "." + parts[2]
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"signed with the default secret", signClaims(t, defaultSecret, accessClaims("mallory", models.RoleAdmin))},
+		{"signed with another secret", signClaims(t, "guess", accessClaims("mallory", models.RoleAdmin))},
+		{"role claim swapped", tampered},
+		{"alg none", func() string {
+			token, _ := jwt.NewWithClaims(jwt.SigningMethodNone, accessClaims("mallory", models.RoleAdmin)).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return token
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, role, err := ValidateToken(tt.token); err == nil {
+				t.Errorf("forged token accepted with role %q", role)
+			}
+		})
+	}
+}
+
+func TestTokensNeedSecret(t *testing.T) {
+	withSecret(t, "")
+
+	if _, err := GenerateToken("alice", models.RoleAdmin); !errors.Is(err, ErrNoJWTSecret) {
+		t.Errorf("GenerateToken without secret: err = %v, want ErrNoJWTSecret", err)
+	}
+	if _, _, err := ValidateToken(signClaims(t, defaultSecret, accessClaims("alice", models.RoleAdmin))); err == nil {
+		t.Error("ValidateToken without secret accepted a token")
+	}
+}
+
+func TestRefreshTokenIsNotAnAccessToken(t *testing.T) {
+	withSecret(t, "test-secret")
+
+	refresh, err := GenerateRefreshToken("alice")
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken: %v", err)
+	}
+	if _, _, err := ValidateToken(refresh); !errors.Is(err, ErrWrongTokenType) {
+		t.Errorf("ValidateToken(refresh) err = %v, want ErrWrongTokenType", err)
+	}
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Password hashes are PBKDF2-SHA256, stored as
+// pbkdf2-sha256$<iterations>$<salt>$<key> (base64 without padding)
+const (
+	passwordScheme     = "pbkdf2-sha256"
+	passwordIterations = 600000
+	passwordSaltLen    = 16
+	passwordKeyLen     = 32
+)
+
+// HashPassword returns a salted hash of password for storage
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, passwordKeyLen)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("%s$%d$%s$%s", passwordScheme, passwordIterations, enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+// CheckPassword reports whether password matches a hash from HashPassword.
+// A malformed hash never matches.
+func CheckPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	enc := base64.RawStdEncoding
+	salt, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := enc.DecodeString(parts[3])
+	if err != nil || len(want) == 0 {
+		return false
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, want) == 1
+}
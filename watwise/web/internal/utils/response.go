@@ -1,17 +1,139 @@
 package utils
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"net/http"
+	"strings"
 
+	"github.com/gofiber/fiber/v2"
+)
+
+// Error codes in ErrorBody.Code. Clients should switch on these rather than
+// on the message, which may change.
+const (
+	CodeBadRequest          = "BAD_REQUEST"
+	CodeValidationFailed    = "VALIDATION_FAILED"
+	CodeInvalidLineProtocol = "INVALID_LINE_PROTOCOL"
+	CodeDeviceIDRequired    = "DEVICE_ID_REQUIRED"
+	CodeUnauthorized        = "UNAUTHORIZED"
+	CodeForbidden           = "FORBIDDEN"
+	CodeNotFound            = "NOT_FOUND"
+	CodeConflict            = "CONFLICT"
+	CodePayloadTooLarge     = "PAYLOAD_TOO_LARGE"
+	CodeRateLimited         = "RATE_LIMITED"
+	CodeIoTDBUnavailable    = "IOTDB_UNAVAILABLE"
+	CodeIoTDBTimeout        = "IOTDB_TIMEOUT"
+	CodeServiceUnavailable  = "SERVICE_UNAVAILABLE"
+	CodeRequestTimeout      = "REQUEST_TIMEOUT"
+	CodeInternal            = "INTERNAL_ERROR"
+)
+
+// ErrorBody is the JSON of every error response. "success" and "error" (a
+// copy of Message) are kept for clients written before Code existed.
+type ErrorBody struct {
+	Success bool   `json:"success"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Error   string `json:"error"`
+	Details any    `json:"details,omitempty"`
+}
+
+// FieldError is one invalid request field, see ValidationErrorResponse. Code
+// is set for common cases such as a missing field ("DEVICE_ID_REQUIRED").
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	Code    string `json:"code,omitempty"`
+}
+
+// RequiredCode returns the code of a missing field, e.g. device_id ->
+// DEVICE_ID_REQUIRED
+func RequiredCode(field string) string {
+	return strings.ToUpper(field) + "_REQUIRED"
+}
+
+// CodeForStatus is the default code of an HTTP status
+func CodeForStatus(status int) string {
+	switch status {
+	case fiber.StatusBadRequest:
+		return CodeBadRequest
+	case fiber.StatusUnauthorized:
+		return CodeUnauthorized
+	case fiber.StatusForbidden:
+		return CodeForbidden
+	case fiber.StatusNotFound:
+		return CodeNotFound
+	case fiber.StatusConflict:
+		return CodeConflict
+	case fiber.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case fiber.StatusTooManyRequests:
+		return CodeRateLimited
+	case fiber.StatusServiceUnavailable:
+		return CodeServiceUnavailable
+	case fiber.StatusGatewayTimeout:
+		return CodeIoTDBTimeout
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
+
+// ErrorResponse sends an ErrorBody with the default code of status
 func ErrorResponse(c *fiber.Ctx, status int, message string) error {
-	return c.Status(status).JSON(fiber.Map{
-		"success": false,
-		"error":   message,
+	return CodedErrorResponse(c, status, CodeForStatus(status), message, nil)
+}
+
+// CodedErrorResponse sends an ErrorBody with an explicit code and optional
+// details
+func CodedErrorResponse(c *fiber.Ctx, status int, code, message string, details any) error {
+	return c.Status(status).JSON(ErrorBody{
+		Success: false,
+		Code:    code,
+		Message: message,
+		Error:   message,
+		Details: details,
 	})
 }
 
-func SuccessResponse(c *fiber.Ctx, data interface{}) error {
-	return c.JSON(fiber.Map{
+// ValidationErrorResponse sends 400 with every invalid field in details (and
+// "errors", its older name). A single field error with its own code, such as
+// DEVICE_ID_REQUIRED, sets the top-level code; otherwise it is
+// VALIDATION_FAILED.
+func ValidationErrorResponse(c *fiber.Ctx, errs []FieldError) error {
+	message := "invalid request"
+	code := CodeValidationFailed
+	if len(errs) > 0 {
+		message = errs[0].Message
+	}
+	if len(errs) == 1 && errs[0].Code != "" {
+		code = errs[0].Code
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(struct {
+		ErrorBody
+		Errors []FieldError `json:"errors"`
+	}{
+		ErrorBody: ErrorBody{
+			Code:    code,
+			Message: message,
+			Error:   message,
+			Details: errs,
+		},
+		Errors: errs,
+	})
+}
+
+// SuccessResponse sends {"success": true, "data": data}; meta adds top level
+// fields next to data, e.g. {"data_source": "dummy"}
+func SuccessResponse(c *fiber.Ctx, data interface{}, meta ...fiber.Map) error {
+	body := fiber.Map{
 		"success": true,
 		"data":    data,
-	})
+	}
+	for _, m := range meta {
+		for key, value := range m {
+			body[key] = value
+		}
+	}
+	return c.JSON(body)
 }
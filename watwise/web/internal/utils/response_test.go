@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// respond runs handler and returns the status and decoded JSON body
+func respond(t *testing.T, handler fiber.Handler) (int, map[string]any) {
+	t.Helper()
+	app := fiber.New()
+	app.Get("/", handler)
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	var body map[string]any
+	if err := json.Unmarshal(raw, &body); err != nil {
+		t.Fatalf("response is not a JSON object: %s", raw)
+	}
+	return resp.StatusCode, body
+}
+
+func keys(body map[string]any) []string {
+	var names []string
+	for name := range body {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestErrorResponseShape(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler fiber.Handler
+		status  int
+		code    string
+	}{
+		{"bad request", func(c *fiber.Ctx) error { return ErrorResponse(c, 400, "bad") }, 400, CodeBadRequest},
+		{"unauthorized", func(c *fiber.Ctx) error { return ErrorResponse(c, 401, "bad") }, 401, CodeUnauthorized},
+		{"forbidden", func(c *fiber.Ctx) error { return ErrorResponse(c, 403, "bad") }, 403, CodeForbidden},
+		{"not found", func(c *fiber.Ctx) error { return ErrorResponse(c, 404, "bad") }, 404, CodeNotFound},
+		{"too large", func(c *fiber.Ctx) error { return ErrorResponse(c, 413, "bad") }, 413, CodePayloadTooLarge},
+		{"rate limited", func(c *fiber.Ctx) error { return ErrorResponse(c, 429, "bad") }, 429, CodeRateLimited},
+		{"internal", func(c *fiber.Ctx) error { return ErrorResponse(c, 500, "bad") }, 500, CodeInternal},
+		{"explicit code", func(c *fiber.Ctx) error {
+			return CodedErrorResponse(c, 503, CodeIoTDBUnavailable, "bad", nil)
+		}, 503, CodeIoTDBUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := respond(t, tt.handler)
+			if status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+			want := map[string]any{"success": false, "code": tt.code, "message": "bad", "error": "bad"}
+			if !reflect.DeepEqual(body, want) {
+				t.Errorf("body = %v, want %v", body, want)
+			}
+		})
+	}
+}
+
+func TestCodedErrorResponseDetails(t *testing.T) {
+	_, body := respond(t, func(c *fiber.Ctx) error {
+		return CodedErrorResponse(c, 400, CodeBadRequest, "partial", fiber.Map{"inserted": 2})
+	})
+	if got := keys(body); !slices.Equal(got, []string{"code", "details", "error", "message", "success"}) {
+		t.Errorf("keys = %v", got)
+	}
+	if details, _ := body["details"].(map[string]any); details["inserted"] != float64(2) {
+		t.Errorf("details = %v", body["details"])
+	}
+}
+
+func TestValidationErrorResponseShape(t *testing.T) {
+	tests := []struct {
+		name string
+		errs []FieldError
+		code string
+	}{
+		{"single required field", []FieldError{{Field: "device_id", Message: "device_id is required", Code: CodeDeviceIDRequired}}, CodeDeviceIDRequired},
+		{"single field without code", []FieldError{{Field: "limit", Message: "limit must be a number"}}, CodeValidationFailed},
+		{"several fields", []FieldError{
+			{Field: "device_id", Message: "device_id is required", Code: CodeDeviceIDRequired},
+			{Field: "limit", Message: "limit must be a number"},
+		}, CodeValidationFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := respond(t, func(c *fiber.Ctx) error { return ValidationErrorResponse(c, tt.errs) })
+			if status != 400 {
+				t.Errorf("status = %d, want 400", status)
+			}
+			if got := keys(body); !slices.Equal(got, []string{"code", "details", "error", "errors", "message", "success"}) {
+				t.Errorf("keys = %v", got)
+			}
+			if body["code"] != tt.code || body["message"] != tt.errs[0].Message || body["success"] != false {
+				t.Errorf("body = %v", body)
+			}
+			errs, _ := body["errors"].([]any)
+			if len(errs) != len(tt.errs) || !reflect.DeepEqual(body["errors"], body["details"]) {
+				t.Fatalf("errors = %v, details = %v", body["errors"], body["details"])
+			}
+			first := errs[0].(map[string]any)
+			if first["field"] != tt.errs[0].Field || first["message"] != tt.errs[0].Message {
+				t.Errorf("errors[0] = %v", first)
+			}
+		})
+	}
+}
+
+func TestSuccessResponseShape(t *testing.T) {
+	status, body := respond(t, func(c *fiber.Ctx) error {
+		return SuccessResponse(c, fiber.Map{"power": 100}, fiber.Map{"data_source": "dummy"})
+	})
+	if status != 200 {
+		t.Errorf("status = %d", status)
+	}
+	want := map[string]any{"success": true, "data": map[string]any{"power": float64(100)}, "data_source": "dummy"}
+	if !reflect.DeepEqual(body, want) {
+		t.Errorf("body = %v, want %v", body, want)
+	}
+}
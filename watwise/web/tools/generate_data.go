@@ -1,11 +1,22 @@
 // File: watwise/web/tools/generate_data.go
+//
+// Usage (dari folder tools):
+//
+//	go run generate_data.go -days 30 -interval 5 -yes
+//	go run generate_data.go -start 2025-01-01 -end 2025-01-31 -device ESP32_001 -profile office -yes
+//	go run generate_data.go -days 7 -seed 42 -dry-run
+//	go run generate_data.go -days 30 -device ESP32_001,ESP32_002 -yes
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"math/rand"
 	"os"
+	"strings"
 	"time"
 
 	"wattwise/internal/config"
@@ -13,172 +24,418 @@ import (
 	"wattwise/internal/models"
 )
 
+const batchSize = 1000
+
+// Rows printed at the start and end of each device in -dry-run
+const sampleRows = 3
+
+type options struct {
+	days     int
+	interval int
+	device   string
+	start    string
+	end      string
+	yes      bool
+	dryRun   bool
+	seed     int64
+	profile  string
+
+	startEnergy float64
+}
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	
+
+	var opts options
+	flag.IntVar(&opts.days, "days", 7, "days of history to generate, ending now (ignored when -start is set)")
+	flag.IntVar(&opts.interval, "interval", 5, "minutes between readings (1-60)")
+	flag.StringVar(&opts.device, "device", models.DefaultDeviceID, "device id to write to, comma separated for several devices")
+	flag.StringVar(&opts.start, "start", "", "start time, \"2006-01-02\" or \"2006-01-02 15:04\" (local)")
+	flag.StringVar(&opts.end, "end", "", "end time, same format as -start (default: now)")
+	flag.BoolVar(&opts.yes, "yes", false, "skip the confirmation prompt")
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "generate data but do not connect or insert")
+	flag.Int64Var(&opts.seed, "seed", 0, "random seed for reproducible data (0 = random)")
+	flag.StringVar(&opts.profile, "profile", "household", "consumption curve: household, office, industrial")
+	flag.Float64Var(&opts.startEnergy, "start-energy", 0, "meter reading (kWh) to continue from, e.g. the last energy value already stored")
+	flag.Parse()
+
 	fmt.Println("╔════════════════════════════════════════════╗")
 	fmt.Println("║  Wattwise Historical Data Generator       ║")
 	fmt.Println("╚════════════════════════════════════════════╝")
 	fmt.Println()
 
-	// Change to project root
-	if err := os.Chdir(".."); err != nil {
-		log.Fatalf("❌ Failed to change directory: %v", err)
-	}
-
-	wd, _ := os.Getwd()
-	log.Printf("📁 Working directory: %s", wd)
-
-	// Load config
-	log.Println("\n📋 Loading configuration...")
-	cfg := config.Load()
-	log.Printf("   ✓ IoTDB: %s:%s", cfg.IoTDB.Host, cfg.IoTDB.Port)
-
-	// Connect to IoTDB
-	log.Println("\n🗄️  Connecting to IoTDB...")
-	db := database.NewIoTDB(cfg.IoTDB)
-	
-	if err := db.Connect(); err != nil {
-		log.Fatalf("❌ Failed to connect to IoTDB: %v", err)
-	}
-	defer db.Close()
-	
-	log.Println("✅ Connected to IoTDB successfully")
-
-	// Get user input
-	var days int
-	var interval int
-	
-	fmt.Println("\n📊 Data Generation Parameters:")
-	fmt.Print("   How many days of historical data? (1-30): ")
-	fmt.Scanln(&days)
-	
-	if days < 1 || days > 30 {
-		days = 7
-		log.Printf("⚠️  Invalid input, using default: %d days", days)
-	}
-
-	fmt.Print("   Data interval in minutes? (1-60): ")
-	fmt.Scanln(&interval)
-	
-	if interval < 1 || interval > 60 {
-		interval = 5
-		log.Printf("⚠️  Invalid input, using default: %d minutes", interval)
-	}
-
-	// Calculate total records
-	recordsPerDay := (24 * 60) / interval
-	totalRecords := days * recordsPerDay
-	
-	fmt.Printf("\n📈 Will generate ~%d records (%d days × %d records/day)\n", 
-		totalRecords, days, recordsPerDay)
-	fmt.Print("   Continue? (y/n): ")
-	
-	var confirm string
-	fmt.Scanln(&confirm)
-	
-	if confirm != "y" && confirm != "Y" {
-		log.Println("❌ Generation cancelled")
-		return
+	curve, ok := profiles[opts.profile]
+	if !ok {
+		log.Fatalf("❌ Unknown profile %q, use: household, office, industrial", opts.profile)
+	}
+
+	if opts.interval < 1 || opts.interval > 60 {
+		log.Fatalf("❌ -interval must be between 1 and 60 minutes, got %d", opts.interval)
+	}
+	if opts.startEnergy < 0 {
+		log.Fatalf("❌ -start-energy must not be negative, got %g", opts.startEnergy)
+	}
+
+	startTime, endTime, err := timeRange(opts)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	var devices []string
+	for _, device := range strings.Split(opts.device, ",") {
+		if device = strings.TrimSpace(device); device != "" {
+			devices = append(devices, device)
+		}
+	}
+	if len(devices) == 0 {
+		log.Fatalf("❌ -device must name at least one device")
+	}
+
+	seed := opts.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	step := time.Duration(opts.interval) * time.Minute
+	perDevice := int(endTime.Sub(startTime) / step)
+	totalRecords := perDevice * len(devices)
+
+	fmt.Println("📊 Data Generation Parameters:")
+	fmt.Printf("   Devices:  %s\n", strings.Join(devices, ", "))
+	fmt.Printf("   Range:    %s to %s\n", startTime.Format("2006-01-02 15:04"), endTime.Format("2006-01-02 15:04"))
+	fmt.Printf("   Interval: %d minutes\n", opts.interval)
+	fmt.Printf("   Profile:  %s\n", opts.profile)
+	fmt.Printf("   Seed:     %d\n", seed)
+	if opts.startEnergy > 0 {
+		fmt.Printf("   Energy:   continues from %.3f kWh\n", opts.startEnergy)
+	}
+	fmt.Printf("   Records:  ~%d\n", totalRecords)
+	if opts.dryRun {
+		fmt.Println("   Mode:     dry run (nothing is written)")
+	}
+
+	if !opts.yes && !opts.dryRun {
+		fmt.Print("\n   Continue? (y/n): ")
+
+		var confirm string
+		fmt.Scanln(&confirm)
+
+		if confirm != "y" && confirm != "Y" {
+			log.Println("❌ Generation cancelled")
+			return
+		}
+	}
+
+	var db *database.IoTDB
+	if !opts.dryRun {
+		// Change to project root so config.Load() finds .env
+		if err := os.Chdir(".."); err != nil {
+			log.Fatalf("❌ Failed to change directory: %v", err)
+		}
+
+		log.Println("\n📋 Loading configuration...")
+		cfg := config.Load()
+		log.Printf("   ✓ IoTDB: %s:%s", cfg.IoTDB.Host, cfg.IoTDB.Port)
+
+		log.Println("\n🗄️  Connecting to IoTDB...")
+		db = database.NewIoTDB(cfg.IoTDB, slog.Default())
+		if err := db.Connect(); err != nil {
+			log.Fatalf("❌ Failed to connect to IoTDB: %v", err)
+		}
+		defer db.Close()
+		log.Println("✅ Connected to IoTDB successfully")
 	}
 
 	// Generate data
-	log.Println("\n🚀 Starting data generation...")
-	
-	startTime := time.Now().AddDate(0, 0, -days)
-	endTime := time.Now()
-	
+	fmt.Println("\n🚀 Starting data generation...")
+
+	began := time.Now()
 	successCount := 0
 	errorCount := 0
-	
-	for ts := startTime; ts.Before(endTime); ts = ts.Add(time.Duration(interval) * time.Minute) {
-		data := generateRealisticData(ts)
-		
-		if err := db.InsertData(data); err != nil {
-			log.Printf("⚠️  Failed to insert data at %s: %v", ts.Format("2006-01-02 15:04"), err)
-			errorCount++
-		} else {
-			successCount++
-			
-			// Progress indicator
-			if successCount%100 == 0 {
-				progress := float64(successCount) / float64(totalRecords) * 100
-				log.Printf("⏳ Progress: %d/%d (%.1f%%)", successCount, totalRecords, progress)
-			}
+	totalEnergy := 0.0
+
+	for _, device := range devices {
+		if len(devices) > 1 {
+			fmt.Printf("\n🔌 %s\n", device)
+		}
+		// Tiap device punya meter sendiri, mulai dari -start-energy
+		result := generateDevice(db, rng, curve, device, startTime, endTime, step, opts.startEnergy, opts.dryRun,
+			func(done int) { printProgress(successCount+errorCount+done, totalRecords) })
+		fmt.Println()
+
+		successCount += result.inserted
+		errorCount += result.failed
+		totalEnergy += result.energy
+		if opts.dryRun {
+			printSamples(device, result.samples)
 		}
 	}
 
+	elapsed := time.Since(began)
+	rate := float64(successCount) / elapsed.Seconds()
+
 	// Summary
 	fmt.Println("\n" + "═══════════════════════════════════════════")
 	fmt.Println("           GENERATION COMPLETE")
 	fmt.Println("═══════════════════════════════════════════")
-	fmt.Printf("✅ Successfully inserted: %d records\n", successCount)
-	
+	if opts.dryRun {
+		fmt.Printf("✅ Generated (dry run): %d records\n", successCount)
+	} else {
+		fmt.Printf("✅ Successfully inserted: %d records\n", successCount)
+	}
+
 	if errorCount > 0 {
 		fmt.Printf("⚠️  Failed insertions: %d records\n", errorCount)
 	}
-	
-	fmt.Printf("📊 Date range: %s to %s\n", 
-		startTime.Format("2006-01-02 15:04"), 
+
+	fmt.Printf("📊 Date range: %s to %s\n",
+		startTime.Format("2006-01-02 15:04"),
 		endTime.Format("2006-01-02 15:04"))
+	fmt.Printf("⚡ Total energy: %.3f kWh\n", totalEnergy)
+	fmt.Printf("⏱️  Took %s (%.0f records/sec)\n", elapsed.Round(time.Millisecond), rate)
 	fmt.Println("═══════════════════════════════════════════")
-	
-	log.Println("\n✅ Data generation completed!")
+
+	if errorCount > 0 {
+		os.Exit(1)
+	}
+}
+
+type deviceResult struct {
+	inserted int
+	failed   int
+	energy   float64             // kWh added by this run
+	samples  []models.EnergyData // first and last rows, for -dry-run
 }
 
-// generateRealisticData creates realistic energy consumption data
-func generateRealisticData(timestamp time.Time) models.EnergyData {
-	hour := timestamp.Hour()
-	
-	// Base power consumption pattern (Watts)
-	var basePower float64
-	
-	// Realistic daily pattern
+// generateDevice writes one device's readings in batches (db nil = dry run)
+// and calls progress with the number of rows handled so far
+func generateDevice(db *database.IoTDB, rng *rand.Rand, curve powerCurve, device string,
+	startTime, endTime time.Time, step time.Duration, startEnergy float64, dryRun bool, progress func(int)) deviceResult {
+	var result deviceResult
+
+	// Energy is a cumulative meter reading: every step adds power × interval,
+	// so the series only goes up and the delta-based daily totals stay sane
+	cumulativeEnergy := startEnergy
+	batch := make([]models.EnergyData, 0, batchSize)
+	var last []models.EnergyData
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if dryRun {
+			if len(result.samples) < sampleRows {
+				result.samples = append(result.samples, batch[:min(sampleRows, len(batch))]...)
+			}
+			last = append(last[:0], batch[max(0, len(batch)-sampleRows):]...)
+		}
+		if db != nil {
+			if err := db.InsertBatch(context.Background(), device, batch); err != nil {
+				fmt.Println()
+				log.Printf("⚠️  Failed to insert batch starting at %s: %v",
+					time.UnixMilli(batch[0].Timestamp).Format("2006-01-02 15:04"), err)
+				result.failed += len(batch)
+				batch = batch[:0]
+				return
+			}
+		}
+		result.inserted += len(batch)
+		batch = batch[:0]
+		progress(result.inserted + result.failed)
+	}
+
+	for ts := startTime; ts.Before(endTime); ts = ts.Add(step) {
+		data := generateRealisticData(rng, curve, ts)
+
+		cumulativeEnergy += data.Power * step.Hours() / 1000.0
+		data.Energy = cumulativeEnergy
+
+		batch = append(batch, data)
+		if len(batch) == batchSize {
+			flush()
+		}
+	}
+	flush()
+
+	// Baris terakhir, tanpa duplikat kalau datanya sedikit
+	for _, row := range last {
+		if row.Timestamp > result.samples[len(result.samples)-1].Timestamp {
+			result.samples = append(result.samples, row)
+		}
+	}
+	result.energy = cumulativeEnergy - startEnergy
+	return result
+}
+
+func printSamples(device string, rows []models.EnergyData) {
+	if len(rows) == 0 {
+		return
+	}
+	fmt.Printf("   Sample rows (%s):\n", device)
+	fmt.Println("   time              power(W)  voltage(V)  current(A)  energy(kWh)")
+	for i, row := range rows {
+		if i == sampleRows && len(rows) > sampleRows {
+			fmt.Println("   ...")
+		}
+		fmt.Printf("   %s  %8.1f  %10.1f  %10.3f  %11.3f\n",
+			time.UnixMilli(row.Timestamp).Format("2006-01-02 15:04"),
+			row.Power, row.Voltage, row.Current, row.Energy)
+	}
+}
+
+// timeRange resolves -start/-end, falling back to the last -days days
+func timeRange(opts options) (time.Time, time.Time, error) {
+	endTime := time.Now()
+	if opts.end != "" {
+		t, err := parseTime(opts.end)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid -end: %w", err)
+		}
+		endTime = t
+	}
+
+	var startTime time.Time
+	if opts.start != "" {
+		t, err := parseTime(opts.start)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid -start: %w", err)
+		}
+		startTime = t
+	} else {
+		if opts.days < 1 {
+			return time.Time{}, time.Time{}, fmt.Errorf("-days must be at least 1, got %d", opts.days)
+		}
+		startTime = endTime.AddDate(0, 0, -opts.days)
+	}
+
+	if !startTime.Before(endTime) {
+		return time.Time{}, time.Time{}, fmt.Errorf("start (%s) must be before end (%s)",
+			startTime.Format("2006-01-02 15:04"), endTime.Format("2006-01-02 15:04"))
+	}
+	return startTime, endTime, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not \"2006-01-02\" or \"2006-01-02 15:04\"", value)
+}
+
+func printProgress(done, total int) {
+	if total <= 0 {
+		return
+	}
+	const width = 30
+
+	progress := float64(done) / float64(total)
+	if progress > 1 {
+		progress = 1
+	}
+	filled := int(progress * width)
+
+	fmt.Printf("\r⏳ [%s%s] %5.1f%% %d/%d",
+		strings.Repeat("█", filled), strings.Repeat("░", width-filled),
+		progress*100, done, total)
+}
+
+// powerCurve returns the base power range (min, spread in Watts) for a moment in time
+type powerCurve func(t time.Time) (float64, float64)
+
+var profiles = map[string]powerCurve{
+	"household":  householdCurve,
+	"office":     officeCurve,
+	"industrial": industrialCurve,
+}
+
+func householdCurve(t time.Time) (float64, float64) {
+	hour := t.Hour()
+
 	switch {
 	case hour >= 0 && hour < 6:
 		// Night: Low consumption (100-300W)
-		basePower = 100 + rand.Float64()*200
+		return 100, 200
 	case hour >= 6 && hour < 8:
 		// Morning: Medium-high (500-1000W)
-		basePower = 500 + rand.Float64()*500
+		return 500, 500
 	case hour >= 8 && hour < 17:
 		// Daytime: Medium (300-600W)
-		basePower = 300 + rand.Float64()*300
+		return 300, 300
 	case hour >= 17 && hour < 22:
 		// Evening: High (800-1500W)
-		basePower = 800 + rand.Float64()*700
+		return 800, 700
 	default:
 		// Late night: Medium-low (200-500W)
-		basePower = 200 + rand.Float64()*300
+		return 200, 300
+	}
+}
+
+func officeCurve(t time.Time) (float64, float64) {
+	hour := t.Hour()
+
+	// Weekend: only standby load (server, kulkas)
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return 150, 150
+	}
+
+	switch {
+	case hour >= 8 && hour < 12, hour >= 13 && hour < 17:
+		// Office hours: AC + komputer (1500-3000W)
+		return 1500, 1500
+	case hour == 12:
+		// Lunch break
+		return 900, 500
+	case hour >= 7 && hour < 8, hour >= 17 && hour < 19:
+		// Arriving / leaving
+		return 500, 500
+	default:
+		return 150, 150
+	}
+}
+
+func industrialCurve(t time.Time) (float64, float64) {
+	hour := t.Hour()
+
+	switch {
+	case hour >= 6 && hour < 22:
+		// Two shifts: machines running (5000-8000W)
+		return 5000, 3000
+	default:
+		// Night shift with reduced load (3000-4000W)
+		return 3000, 1000
 	}
-	
+}
+
+// generateRealisticData creates realistic energy consumption data.
+// Energy is filled in by the caller, which keeps the cumulative total.
+func generateRealisticData(rng *rand.Rand, curve powerCurve, timestamp time.Time) models.EnergyData {
+	minPower, spread := curve(timestamp)
+	basePower := minPower + rng.Float64()*spread
+
 	// Add random variation (±20%)
-	variation := 1.0 + (rand.Float64()-0.5)*0.4
+	variation := 1.0 + (rng.Float64()-0.5)*0.4
 	power := basePower * variation
-	
+
 	// Calculate realistic voltage (220V ±5%)
-	voltage := 220.0 + (rand.Float64()-0.5)*22.0
-	
+	voltage := 220.0 + (rng.Float64()-0.5)*22.0
+
 	// Calculate current from power and voltage (I = P/V)
 	current := power / voltage
-	
+
 	// Frequency (50Hz ±0.5Hz)
-	frequency := 50.0 + (rand.Float64()-0.5)*1.0
-	
+	frequency := 50.0 + (rng.Float64()-0.5)*1.0
+
 	// Power factor (0.85-0.98)
-	powerFactor := 0.85 + rand.Float64()*0.13
-	
-	// Calculate cumulative energy (kWh)
-	// Get a cumulative value based on time elapsed
-	hoursSinceStart := timestamp.Sub(time.Now().AddDate(0, 0, -30)).Hours()
-	cumulativeEnergy := (basePower * hoursSinceStart) / 1000.0
-	
+	powerFactor := 0.85 + rng.Float64()*0.13
+
 	return models.EnergyData{
 		Timestamp:   timestamp.UnixMilli(),
 		Voltage:     voltage,
 		Current:     current,
 		Power:       power,
-		Energy:      cumulativeEnergy,
 		Frequency:   frequency,
 		PowerFactor: powerFactor,
 	}
@@ -0,0 +1,219 @@
+// File: watwise/web/tools/simulate_device.go
+//
+// Simulasi ESP32 + PZEM-004T lewat MQTT, untuk testing tanpa hardware.
+//
+// Usage (dari folder tools):
+//
+//	go run simulate_device.go
+//	go run simulate_device.go -devices ESP32_001,ESP32_002 -interval 2s
+//	go run simulate_device.go -spike-power 10 -drop-voltage 15 -offline-after 2m
+//	go run simulate_device.go -format cbor
+//
+// The ignore build tag keeps this second main package out of `go build ./...`
+// (generate_data.go lives in the same folder); `go run` on the file still works.
+
+//go:build ignore
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"wattwise/internal/config"
+	"wattwise/internal/models"
+	"wattwise/internal/mqtt"
+)
+
+type simulatedDevice struct {
+	id        string
+	energy    float64 // cumulative kWh, seperti counter PZEM
+	started   time.Time
+	published int
+	failed    int
+	spikes    int
+	drops     int
+	offline   bool
+}
+
+func main() {
+	log.SetFlags(log.LstdFlags)
+
+	devicesFlag := flag.String("devices", models.DefaultDeviceID, "comma separated device ids to simulate")
+	topic := flag.String("topic", "esp32", "MQTT topic to publish on")
+	interval := flag.Duration("interval", 5*time.Second, "time between readings per device")
+	count := flag.Int("count", 0, "readings per device before exiting (0 = run until Ctrl+C)")
+	spikePower := flag.Int("spike-power", 0, "every Nth reading has a power spike above the alert threshold (0 = off)")
+	dropVoltage := flag.Int("drop-voltage", 0, "every Nth reading has a voltage drop below the alert threshold (0 = off)")
+	offlineAfter := flag.Duration("offline-after", 0, "first device stops publishing after this long, to trigger offline detection (0 = never)")
+	format := flag.String("format", mqtt.FormatJSON, "payload format: json, cbor or msgpack")
+	threePhase := flag.Bool("three-phase", false, "publish L1..L3 phases (unbalanced load) like a 3-phase meter")
+	flag.Parse()
+
+	if *interval <= 0 {
+		log.Fatalf("❌ -interval must be > 0")
+	}
+	if _, err := mqtt.EncodePayload(*format, models.MQTTMessage{}); err != nil {
+		log.Fatalf("❌ -format: %v", err)
+	}
+
+	var devices []*simulatedDevice
+	for _, id := range strings.Split(*devicesFlag, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			devices = append(devices, &simulatedDevice{id: id, started: time.Now()})
+		}
+	}
+	if len(devices) == 0 {
+		log.Fatalf("❌ -devices must list at least one device id")
+	}
+
+	// .env ada di root project, tool ini biasanya dijalankan dari folder tools
+	if _, err := os.Stat(".env"); err != nil {
+		if _, err := os.Stat("../.env"); err == nil {
+			os.Chdir("..")
+		}
+	}
+	cfg := config.Load()
+
+	client := mqtt.NewClient(cfg.MQTT.Broker, fmt.Sprintf("%s_simulator_%d", cfg.MQTT.ClientID, os.Getpid()))
+	client.SetCredentials(cfg.MQTT.Username, cfg.MQTT.Password)
+
+	log.Printf("📡 Connecting to %s...", cfg.MQTT.Broker)
+	if err := client.Connect(); err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	defer client.Disconnect()
+
+	log.Printf("🚀 Simulating %d device(s) on topic %q every %s (%s payloads)", len(devices), *topic, *interval, *format)
+	if *offlineAfter > 0 {
+		log.Printf("   ℹ️  %s goes offline after %s", devices[0].id, *offlineAfter)
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	began := time.Now()
+	for round := 1; ; round++ {
+		for i, device := range devices {
+			if i == 0 && *offlineAfter > 0 && time.Since(began) >= *offlineAfter {
+				if !device.offline {
+					log.Printf("🔌 %s stopped publishing (simulated offline)", device.id)
+					device.offline = true
+				}
+				continue
+			}
+
+			msg := device.nextReading(*interval)
+
+			switch {
+			case *spikePower > 0 && round%*spikePower == 0:
+				// Di atas threshold 2200W
+				msg.Power = 2500 + rand.Float64()*1000
+				msg.Current = msg.Power / msg.Voltage
+				device.spikes++
+			case *dropVoltage > 0 && round%*dropVoltage == 0:
+				// Di bawah threshold 200V
+				msg.Voltage = 170 + rand.Float64()*20
+				msg.Current = msg.Power / msg.Voltage
+				device.drops++
+			}
+			if *threePhase {
+				splitPhases(&msg)
+			}
+
+			payload, err := mqtt.EncodePayload(*format, msg)
+			if err != nil {
+				log.Fatalf("❌ Failed to encode reading: %v", err)
+			}
+
+			if err := client.Publish(*topic, payload); err != nil {
+				log.Printf("⚠️  %s: %v", device.id, err)
+				device.failed++
+				continue
+			}
+			device.published++
+			log.Printf("📤 %s: %.1fV %.3fA %.1fW %.3fkWh", device.id, msg.Voltage, msg.Current, msg.Power, msg.Energy)
+		}
+
+		if *count > 0 && round >= *count {
+			break
+		}
+
+		select {
+		case <-ticker.C:
+		case <-quit:
+			printSummary(devices, time.Since(began))
+			return
+		}
+	}
+
+	printSummary(devices, time.Since(began))
+}
+
+// nextReading returns a PZEM-style reading and advances the energy counter
+func (d *simulatedDevice) nextReading(interval time.Duration) models.MQTTMessage {
+	hour := time.Now().Hour()
+
+	var basePower float64
+	switch {
+	case hour >= 17 && hour < 22:
+		basePower = 800 + rand.Float64()*700
+	case hour >= 6 && hour < 17:
+		basePower = 300 + rand.Float64()*400
+	default:
+		basePower = 100 + rand.Float64()*200
+	}
+
+	voltage := 220.0 + (rand.Float64()-0.5)*16.0
+	d.energy += basePower * interval.Hours() / 1000.0
+
+	return models.MQTTMessage{
+		DeviceID:    d.id,
+		Voltage:     voltage,
+		Current:     basePower / voltage,
+		Power:       basePower,
+		Energy:      d.energy,
+		Frequency:   50.0 + (rand.Float64()-0.5)*0.4,
+		PowerFactor: 0.85 + rand.Float64()*0.13,
+		Rssi:        -50 - rand.Intn(30),
+		Uptime:      int(time.Since(d.started).Seconds()),
+	}
+}
+
+// splitPhases spreads a reading over L1..L3 with an unbalanced load; the
+// server derives the totals from the phases
+func splitPhases(msg *models.MQTTMessage) {
+	shares := []float64{0.45, 0.35, 0.20}
+	msg.Phases = make([]models.PhaseReading, len(shares))
+	for i, share := range shares {
+		voltage := msg.Voltage + (rand.Float64()-0.5)*4.0
+		power := msg.Power * share
+		msg.Phases[i] = models.PhaseReading{Voltage: voltage, Current: power / voltage, Power: power}
+	}
+}
+
+func printSummary(devices []*simulatedDevice, elapsed time.Duration) {
+	fmt.Println("\n" + "═══════════════════════════════════════════")
+	fmt.Println("           SIMULATION SUMMARY")
+	fmt.Println("═══════════════════════════════════════════")
+
+	total := 0
+	for _, device := range devices {
+		total += device.published
+		fmt.Printf("📟 %-16s published=%d failed=%d spikes=%d drops=%d\n",
+			device.id, device.published, device.failed, device.spikes, device.drops)
+	}
+
+	fmt.Printf("✅ Total published: %d messages in %s\n", total, elapsed.Round(time.Second))
+	fmt.Println("═══════════════════════════════════════════")
+}
@@ -319,7 +319,8 @@ function initWebSocket() {
     addConsoleLog('🔌 Connecting to: ' + wsUrl, 'info');
     
     try {
-        ws = new WebSocket(wsUrl);
+        // Browser tidak bisa set Authorization di WebSocket, token lewat query
+        ws = new WebSocket(`${wsUrl}?token=${encodeURIComponent(getToken() || '')}`);
         
         ws.onopen = function() {
             addConsoleLog('✅ WebSocket connected', 'success');
@@ -329,8 +330,7 @@ function initWebSocket() {
         
         ws.onmessage = function(event) {
             try {
-                const data = JSON.parse(event.data);
-                handleWebSocketData(data);
+                handleWebSocketMessage(JSON.parse(event.data));
             } catch (error) {
                 console.error('❌ Parse error:', error);
             }
@@ -376,15 +376,29 @@ function updateConnectionStatus(connected) {
     }
 }
 
-function handleWebSocketData(data) {
-    if (data.type === 'connected') {
-        addConsoleLog('✅ ' + data.message, 'success');
-        return;
-    }
-    
-    // Handle real-time data from MQTT
-    if (data.device_id || data.voltage) {
-        updateDashboardWithRealtimeData(data);
+// Setiap frame: {"type": "...", "ts": <ms>, "data": {...}}
+function handleWebSocketMessage(message) {
+    switch (message.type) {
+        case 'connected':
+            addConsoleLog('✅ ' + message.data.message, 'success');
+            break;
+        case 'reading':
+            // Handle real-time data from MQTT
+            updateDashboardWithRealtimeData(message.data);
+            break;
+        case 'reading_batch':
+            // Server mengirim beberapa device sekaligus tiap flush
+            message.data.forEach(updateDashboardWithRealtimeData);
+            break;
+        case 'alert':
+            addConsoleLog('⚠️ ' + message.data.device_id + ': ' + message.data.message, 'warning');
+            break;
+        case 'device_status':
+            addConsoleLog('🔌 ' + message.data.device_id + ' ' + message.data.status, 'info');
+            break;
+        case 'error':
+            addConsoleLog('❌ ' + message.data.message, 'error');
+            break;
     }
 }
 
@@ -44,11 +44,17 @@ class EnergyWebSocket {
 
     handleMessage(event) {
         try {
-            const data = JSON.parse(event.data);
-            console.log('📨 Received data:', data);
+            const message = JSON.parse(event.data);
+            console.log('📨 Received message:', message);
             
             if (this.onDataCallback) {
-                this.onDataCallback(data);
+                // Frame: {"type", "ts", "data"}; beberapa device sekaligus
+                // tiap flush sebagai "reading_batch"
+                if (message.type === 'reading') {
+                    this.onDataCallback(message.data);
+                } else if (message.type === 'reading_batch') {
+                    message.data.forEach((item) => this.onDataCallback(item));
+                }
             }
         } catch (error) {
             console.error('❌ Failed to parse WebSocket message:', error);